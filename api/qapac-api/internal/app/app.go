@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/dom1nux/qapac-api/internal/cache"
 	"github.com/dom1nux/qapac-api/internal/config"
+	"github.com/dom1nux/qapac-api/internal/geocoding"
 	"github.com/dom1nux/qapac-api/internal/handler"
 	"github.com/dom1nux/qapac-api/internal/middleware"
+	"github.com/dom1nux/qapac-api/internal/refresh"
 	"github.com/dom1nux/qapac-api/internal/routing"
 	"github.com/dom1nux/qapac-api/internal/service"
 	"github.com/dom1nux/qapac-api/internal/storage"
@@ -34,6 +38,8 @@ type App struct {
 	DB     *pgxpool.Pool
 	Router *gin.Engine
 	cfg    *config.Config
+	// stop cancels the background workers.
+	stop context.CancelFunc
 }
 
 // New initializes the application: connects to PostGIS, runs migrations,
@@ -49,6 +55,13 @@ func New(cfg *config.Config) (*App, error) {
 	poolCfg.MaxConnLifetime = 30 * time.Second
 	poolCfg.MaxConnIdleTime = 10 * time.Second
 
+	// The in-memory cache tier skips the invalidations of its own writes,
+	// which Postgres tells apart by the instance ID of the connection.
+	instanceID := cache.NewInstanceID()
+	if cfg.CacheLocalEntries > 0 {
+		cache.TagConnections(poolCfg, instanceID)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -73,21 +86,150 @@ func New(cfg *config.Config) (*App, error) {
 	// --- Domain dependencies ---
 	stopsRepo := storage.NewStopsRepository(pool)
 
-	googleRouter := routing.NewGoogleRouter(cfg.GoogleAPIKey)
-	cachedRouter := routing.NewCachedRouter(
-		googleRouter,
-		routing.NewPgCacheStore(pool),
-		routing.WithLogger(log.Printf),
+	// googleQuota meters the paid Google calls; nil when Google is not used.
+	var googleQuota *routing.QuotaMeter
+	var routeLinks []routing.ChainLink
+	for _, p := range cfg.RoutingProviders {
+		switch p {
+		case config.RoutingProviderOSRM:
+			if cfg.OSRMWalkURL == "" {
+				log.Println("OSRM_WALK_URL not set: walking routes, the /routes/to-stop default, skip osrm")
+			}
+			routeLinks = append(routeLinks, routing.ChainLink{Name: routing.ProviderOSRM, Router: routing.NewOSRMRouter(map[routing.TravelMode]string{
+				routing.TravelModeDrive:   cfg.OSRMURL,
+				routing.TravelModeWalk:    cfg.OSRMWalkURL,
+				routing.TravelModeBicycle: cfg.OSRMBicycleURL,
+			})})
+		case config.RoutingProviderValhalla:
+			routeLinks = append(routeLinks, routing.ChainLink{Name: routing.ProviderValhalla, Router: routing.NewValhallaRouter(cfg.ValhallaURL)})
+		case config.RoutingProviderGoogle:
+			if cfg.GoogleAPIKey == "" {
+				log.Println("GOOGLE_API_KEY not set: skipping google routing provider")
+				continue
+			}
+			googleQuota = routing.NewQuotaMeter(routing.NewPgUsageStore(pool), routing.QuotaCaps{
+				SoftDaily:   cfg.GoogleRoutesSoftDaily,
+				HardDaily:   cfg.GoogleRoutesHardDaily,
+				SoftMonthly: cfg.GoogleRoutesSoftMonthly,
+				HardMonthly: cfg.GoogleRoutesHardMonthly,
+			}, cfg.GoogleRoutesPricePer1000, routing.WithQuotaLogger(log.Printf))
+			routeLinks = append(routeLinks, routing.ChainLink{Name: routing.ProviderGoogle, Router: routing.NewGoogleRouter(cfg.GoogleAPIKey, routing.WithGoogleQuota(googleQuota))})
+		}
+	}
+	routeLinks = append(routeLinks, routing.ChainLink{Name: routing.ProviderStraightLine, Router: routing.StraightLineRouter{}})
+	var routeNames []string
+	for _, l := range routeLinks {
+		routeNames = append(routeNames, l.Name)
+	}
+	log.Printf("routing providers: %s", strings.Join(routeNames, " -> "))
+
+	routeProvider := routing.NewChainRouter(routeLinks, routing.WithChainLogger(log.Printf))
+
+	cacheOpts := []routing.CachedRouterOption{routing.WithLogger(log.Printf)}
+	if googleQuota != nil {
+		cacheOpts = append(cacheOpts, routing.WithQuotaMeter(googleQuota))
+	}
+	// Background workers run until Shutdown.
+	bgCtx, stop := context.WithCancel(context.Background())
+
+	// Route and ETA caches: Postgres, behind an in-memory tier unless it is
+	// disabled.
+	var (
+		routeStore routing.CacheStore    = routing.NewPgCacheStore(pool)
+		etaStore   service.ETACacheStore = service.NewPgETACacheStore(pool)
+		localCache *cache.Store
 	)
+	if cfg.CacheLocalEntries > 0 {
+		localCache = cache.NewStore(routeStore, etaStore,
+			cache.WithMaxEntries(cfg.CacheLocalEntries),
+			cache.WithTTL(cfg.CacheLocalTTL),
+			cache.WithLogger(log.Printf),
+			cache.WithInstanceID(instanceID),
+		)
+		routeStore, etaStore = localCache, localCache
+		go localCache.Listen(bgCtx, pool)
+		log.Printf("in-memory cache tier: %d entries, ttl %s", cfg.CacheLocalEntries, cfg.CacheLocalTTL)
+	}
+
+	// Only the instance holding the janitor's advisory lock purges at a time.
+	var janitor *cache.Janitor
+	if cfg.CacheJanitorInterval > 0 {
+		janitor = cache.NewJanitor(cache.NewPgJanitorStore(pool),
+			cache.WithJanitorInterval(cfg.CacheJanitorInterval),
+			cache.WithJanitorBatch(cfg.CacheJanitorBatch),
+			cache.WithJanitorLogger(log.Printf),
+		)
+		go janitor.Run(bgCtx)
+	} else {
+		log.Println("CACHE_JANITOR_INTERVAL is 0: cache janitor disabled")
+	}
+
+	// Stale route and ETA entries are served while these workers refresh
+	// them; without them, a stale entry is a miss.
+	var (
+		refreshPool *refresh.Pool
+		etaOpts     []service.ETAServiceOption
+	)
+	if cfg.CacheRefreshWorkers > 0 {
+		refreshPool = refresh.NewPool(bgCtx, cfg.CacheRefreshWorkers)
+		cacheOpts = append(cacheOpts, routing.WithRefreshPool(refreshPool))
+		etaOpts = append(etaOpts, service.WithETARefreshPool(refreshPool))
+	} else {
+		log.Println("CACHE_REFRESH_WORKERS is 0: stale cache entries are not served")
+	}
+
+	cachedRouter := routing.NewCachedRouter(routeProvider, routeStore, cacheOpts...)
 
 	routingService := service.NewRoutingService(cachedRouter, stopsRepo)
 
 	etaProvider := service.NewSimpleETAProvider()
-	etaStore := service.NewPgETACacheStore(pool)
-	etaService := service.NewETAService(etaProvider, etaStore)
+	etaService := service.NewETAService(etaProvider, etaStore, etaOpts...)
+
+	headwaysRepo := storage.NewHeadwaysRepository(pool)
+	headwayService := service.NewHeadwayService(headwaysRepo)
+	vehiclesRepo := storage.NewVehiclesRepository(pool)
+	fareService := service.NewFareService(storage.NewFaresRepository(pool))
+	tripsRepo := storage.NewTripsRepository(pool)
+	tripService := service.NewTripService(tripsRepo, fareService)
+	ratingService := service.NewRatingService(storage.NewRatingsRepository(pool), tripsRepo, vehiclesRepo)
+	favoriteService := service.NewFavoriteService(storage.NewFavoritesRepository(pool))
+	occupancyService := service.NewOccupancyService(storage.NewOccupancyRepository(pool),
+		service.WithApproachingVehicles(headwaysRepo),
+	)
+
+	// Position reports feed the off-route detector and the stop arrivals of
+	// the headway reports. Off-route incidents are only logged until
+	// rider-facing service alerts exist.
+	offRouteDetector := service.NewOffRouteDetector(storage.NewRoutesRepository(pool), service.NewPgDeviationStore(pool),
+		service.WithAlertPublisher(service.NewLogAlertPublisher(log.Printf)),
+	)
+	positionService := service.NewPositionService(vehiclesRepo, offRouteDetector,
+		service.WithStopArrivals(headwaysRepo),
+		service.WithPositionLogger(log.Printf),
+	)
+
+	tileService := service.NewTileService(storage.NewTilesRepository(pool))
+	bundleService := service.NewBundleService(storage.NewNetworkRepository(pool))
+
+	// Place search: the local gazetteer always answers first; Google is only
+	// consulted (through a 24 h cache) when an API key is configured.
+	gazetteer := geocoding.NewGazetteer(pool)
+	geocoder := geocoding.Chain{gazetteer}
+	if cfg.GoogleAPIKey != "" {
+		geocoder = append(geocoder, geocoding.NewCachedGeocoder(
+			geocoding.NewGoogleGeocoder(cfg.GoogleAPIKey),
+			geocoding.NewPgCacheStore(pool),
+		))
+	}
 
 	// --- HTTP engine ---
 	router := gin.New()
+	// c.ClientIP(), which keys the rider occupancy throttle, only believes
+	// X-Forwarded-For when the peer is one of these proxies.
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		stop()
+		return nil, fmt.Errorf("app: trusted proxies: %w", err)
+	}
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 	router.Use(middleware.Timeout(10 * time.Second))
@@ -98,24 +240,113 @@ func New(cfg *config.Config) (*App, error) {
 	})
 
 	// API v1 routes.
-	h := handler.New(stopsRepo, etaService, routingService)
+	h := handler.New(stopsRepo, etaService, routingService,
+		handler.WithHeadwayService(headwayService),
+		handler.WithVehiclesRepository(vehiclesRepo),
+		handler.WithFareService(fareService),
+		handler.WithOccupancyService(occupancyService),
+		handler.WithPositionService(positionService),
+		handler.WithTripService(tripService),
+		handler.WithRatingService(ratingService),
+		handler.WithFavoriteService(favoriteService),
+		handler.WithGeocoder(geocoder),
+		handler.WithGazetteerImporter(gazetteer),
+		handler.WithTileService(tileService),
+		handler.WithBundleService(bundleService),
+		handler.WithRoutingQuota(googleQuota),
+		handler.WithRouteCache(cachedRouter),
+		handler.WithLocalCache(localCache),
+		handler.WithCacheJanitor(janitor),
+		handler.WithRefreshPool(refreshPool),
+	)
 
 	api := router.Group("/api/v1")
 	{
+		api.GET("/stops", h.ListStops)
 		api.GET("/stops/nearby", h.ListStopsNear)
+		api.GET("/stops/search", h.SearchStops)
 		api.GET("/stops/:id", h.GetStop)
+		api.GET("/etas", h.ListStopETAs)
 		api.GET("/routes/to-stop", h.GetRouteToStop)
+		api.GET("/fares/quote", h.GetFareQuote)
+		api.GET("/vehicles/:id/occupancy", h.GetVehicleOccupancy)
+		api.POST("/vehicles/:id/occupancy", h.ReportVehicleOccupancy)
+		api.GET("/vehicles/:id/crew", h.GetVehicleCrew)
+		api.GET("/drivers/:id/rating", h.GetDriverRating)
+		api.GET("/collectors/:id/rating", h.GetCollectorRating)
+		api.GET("/routes/:id/rating", h.GetRouteRating)
+		api.GET("/me/trips", h.ListRiderTrips)
+		api.POST("/me/trips", h.RecordRiderTrip)
+		api.GET("/me/trips/summary", h.GetRiderTripSummary)
+		api.POST("/me/trips/:id/alight", h.AlightRiderTrip)
+		api.POST("/me/trips/:id/rating", h.RateRiderTrip)
+		api.POST("/me/checkins", h.CheckInRiderTrip)
+		api.GET("/me/favorites", h.ListFavorites)
+		api.PUT("/me/favorites/stops/:id", h.PutFavoriteStop)
+		api.DELETE("/me/favorites/stops/:id", h.DeleteFavoriteStop)
+		api.PUT("/me/favorites/routes/:id", h.PutFavoriteRoute)
+		api.DELETE("/me/favorites/routes/:id", h.DeleteFavoriteRoute)
+		api.POST("/me/favorites/places", h.CreateSavedPlace)
+		api.PUT("/me/favorites/places/:id", h.UpdateSavedPlace)
+		api.DELETE("/me/favorites/places/:id", h.DeleteSavedPlace)
+		api.GET("/me/dashboard", h.GetRiderDashboard)
+		api.GET("/geocode", h.Geocode)
+		api.GET("/geocode/reverse", h.ReverseGeocode)
+		api.GET("/tiles/:z/:x/:y", h.GetTile)
+		api.GET("/bundle", h.GetBundle)
+		api.GET("/bundle/diff", h.GetBundleDiff)
+	}
+
+	// Operator endpoints. Disabled unless ADMIN_API_TOKEN is set.
+	if cfg.AdminAPIToken != "" {
+		admin := api.Group("/admin", middleware.AdminToken(cfg.AdminAPIToken))
+		{
+			admin.GET("/routes/:id/headways", h.GetRouteHeadways)
+			admin.GET("/routes/:id/bunching", h.ListRouteBunching)
+
+			admin.GET("/vehicles", h.ListVehicles)
+			admin.POST("/vehicles", h.CreateVehicle)
+			admin.GET("/vehicles/:id", h.GetVehicle)
+			admin.PUT("/vehicles/:id", h.UpdateVehicle)
+			admin.DELETE("/vehicles/:id", h.DeactivateVehicle)
+			admin.GET("/vehicles/:id/assignments", h.ListVehicleAssignments)
+			admin.POST("/vehicles/:id/assignments", h.CreateVehicleAssignment)
+			admin.DELETE("/vehicles/:id/assignments/:assignment_id", h.DeleteVehicleAssignment)
+			admin.POST("/vehicles/:id/occupancy", h.ReportCrewOccupancy)
+			admin.POST("/vehicles/:id/positions", h.ReportVehiclePosition)
+			admin.POST("/drivers/:id/shifts/start", h.StartDriverShift)
+			admin.POST("/drivers/:id/shifts/end", h.EndDriverShift)
+			admin.GET("/ratings", h.ListRatings)
+			admin.PATCH("/ratings/:id", h.ModerateRating)
+
+			admin.POST("/gazetteer", h.ImportGazetteer)
+
+			admin.GET("/cache/stats", h.GetCacheStats)
+			if janitor != nil {
+				admin.GET("/cache/janitor", h.GetCacheJanitor)
+			}
+			if googleQuota != nil {
+				admin.GET("/routing/quota", h.GetRoutingQuota)
+			}
+		}
+	} else {
+		log.Println("ADMIN_API_TOKEN not set: admin endpoints disabled")
 	}
 
 	return &App{
 		DB:     pool,
 		Router: router,
 		cfg:    cfg,
+		stop:   stop,
 	}, nil
 }
 
-// Shutdown gracefully closes the database pool.
+// Shutdown stops the background workers and gracefully closes the database
+// pool.
 func (a *App) Shutdown() {
+	if a.stop != nil {
+		a.stop()
+	}
 	if a.DB != nil {
 		a.DB.Close()
 		log.Println("database connection pool closed")
@@ -25,12 +25,21 @@ func init() {
 
 type stubStopsRepo struct{}
 
-func (s *stubStopsRepo) FindStopsNear(_ context.Context, _, _, _ float64) ([]storage.Stop, error) {
+func (s *stubStopsRepo) FindStopsNear(_ context.Context, _, _, _ float64) ([]storage.NearbyStop, error) {
 	return nil, nil
 }
 func (s *stubStopsRepo) GetStop(_ context.Context, _ int32) (*storage.Stop, error) {
 	return nil, nil
 }
+func (s *stubStopsRepo) ListRoutesServingStops(_ context.Context, _ []int32) (map[int32][]storage.StopRoute, error) {
+	return nil, nil
+}
+func (s *stubStopsRepo) ListStopsInBBox(_ context.Context, _ storage.BBox, _ float64, _ int32, _ int) ([]storage.Stop, error) {
+	return nil, nil
+}
+func (s *stubStopsRepo) SearchStops(_ context.Context, _ storage.StopSearch) ([]storage.StopMatch, error) {
+	return nil, nil
+}
 
 type stubETAProvider struct{}
 
@@ -40,8 +49,11 @@ func (s *stubETAProvider) GetETA(_ context.Context, _ int32) (int, string, error
 
 type stubETACacheStore struct{}
 
-func (s *stubETACacheStore) GetCachedETA(_ context.Context, _ int32) (int, bool, error) {
-	return 0, false, nil
+func (s *stubETACacheStore) GetCachedETA(_ context.Context, _ int32) (service.CachedETA, bool, error) {
+	return service.CachedETA{}, false, nil
+}
+func (s *stubETACacheStore) GetCachedETAs(_ context.Context, _ []int32) (map[int32]service.CachedETA, error) {
+	return nil, nil
 }
 func (s *stubETACacheStore) SetCachedETA(_ context.Context, _ int32, _ int) error { return nil }
 
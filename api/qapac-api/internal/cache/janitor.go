@@ -0,0 +1,352 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// DefaultJanitorInterval is how often expired cache rows are purged.
+	DefaultJanitorInterval = 5 * time.Minute
+
+	// DefaultJanitorBatch is how many rows each DELETE removes, so that a
+	// large backlog does not hold locks on a hot table for long.
+	DefaultJanitorBatch = 1000
+
+	// janitorLockKey is the advisory lock held by the instance running the
+	// janitor ("qapac" + 1).
+	janitorLockKey int64 = 0x7161706163_01
+
+	// janitorQueryTimeout is the deadline for each janitor query.
+	janitorQueryTimeout = 30 * time.Second
+)
+
+// JanitorTables are the cache tables purged by the janitor. All of them
+// have an expires_at column.
+var JanitorTables = []string{"route_to_stop_cache", "stop_eta_cache", "geocode_cache"}
+
+// JanitorRun is the outcome of one janitor run.
+type JanitorRun struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Purged is the number of rows deleted from each table.
+	Purged map[string]int64 `json:"purged"`
+	// Error is set when the run stopped early.
+	Error string `json:"error,omitempty"`
+}
+
+// TableStats is the size of a cache table.
+type TableStats struct {
+	Table       string `json:"table"`
+	Rows        int64  `json:"rows"`
+	ExpiredRows int64  `json:"expired_rows"`
+	Bytes       int64  `json:"bytes"`
+}
+
+// JanitorStats is what the janitor reports for monitoring.
+type JanitorStats struct {
+	IntervalS int64 `json:"interval_s"`
+	BatchSize int   `json:"batch_size"`
+	// LastRun is the last run of any instance; nil before the first one.
+	LastRun *JanitorRun  `json:"last_run"`
+	Tables  []TableStats `json:"tables"`
+}
+
+// JanitorStore abstracts the database work of the janitor.
+type JanitorStore interface {
+	// WithLock runs fn while holding the janitor's advisory lock. It returns
+	// ran = false without calling fn when another instance holds the lock.
+	WithLock(ctx context.Context, fn func(ctx context.Context) error) (ran bool, err error)
+
+	// PurgeExpired deletes up to limit expired rows of table and returns how
+	// many it deleted.
+	PurgeExpired(ctx context.Context, table string, limit int) (int64, error)
+
+	// SaveRun records run as the last one.
+	SaveRun(ctx context.Context, run JanitorRun) error
+
+	// LastRun returns the last recorded run, or nil if there is none.
+	LastRun(ctx context.Context) (*JanitorRun, error)
+
+	// TableStats returns the size of each table.
+	TableStats(ctx context.Context, tables []string) ([]TableStats, error)
+}
+
+// Janitor periodically deletes the expired rows of the cache tables, which
+// are otherwise only filtered out on read. With several instances, only the
+// one that takes the advisory lock runs it.
+type Janitor struct {
+	store    JanitorStore
+	interval time.Duration
+	batch    int
+	logger   func(format string, args ...any)
+	now      func() time.Time
+}
+
+// JanitorOption configures a Janitor.
+type JanitorOption func(*Janitor)
+
+// WithJanitorInterval overrides DefaultJanitorInterval.
+func WithJanitorInterval(d time.Duration) JanitorOption {
+	return func(j *Janitor) { j.interval = d }
+}
+
+// WithJanitorBatch overrides DefaultJanitorBatch.
+func WithJanitorBatch(n int) JanitorOption {
+	return func(j *Janitor) { j.batch = n }
+}
+
+// WithJanitorLogger sets a logger for the outcome of each run. If not set,
+// runs are silent.
+func WithJanitorLogger(l func(format string, args ...any)) JanitorOption {
+	return func(j *Janitor) { j.logger = l }
+}
+
+// withJanitorClock injects a fake clock for unit testing.
+func withJanitorClock(fn func() time.Time) JanitorOption {
+	return func(j *Janitor) { j.now = fn }
+}
+
+// NewJanitor creates a Janitor backed by store.
+func NewJanitor(store JanitorStore, opts ...JanitorOption) *Janitor {
+	j := &Janitor{
+		store:    store,
+		interval: DefaultJanitorInterval,
+		batch:    DefaultJanitorBatch,
+		now:      time.Now,
+	}
+	for _, o := range opts {
+		o(j)
+	}
+	return j
+}
+
+// Run purges the cache tables every interval until ctx is done.
+func (j *Janitor) Run(ctx context.Context) {
+	t := time.NewTicker(j.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		run, err := j.RunOnce(ctx)
+		switch {
+		case err != nil:
+			j.logf("cache: janitor: %v", err)
+		case run != nil:
+			j.logf("cache: janitor: purged %v in %s", run.Purged, run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond))
+		}
+	}
+}
+
+// RunOnce purges every table, batch by batch, and records the run. It
+// returns a nil run when another instance holds the lock.
+func (j *Janitor) RunOnce(ctx context.Context) (*JanitorRun, error) {
+	var run *JanitorRun
+	_, err := j.store.WithLock(ctx, func(ctx context.Context) error {
+		run = &JanitorRun{StartedAt: j.now(), Purged: make(map[string]int64, len(JanitorTables))}
+		var purgeErr error
+		for _, table := range JanitorTables {
+			if purgeErr = j.purge(ctx, table, run); purgeErr != nil {
+				run.Error = purgeErr.Error()
+				break
+			}
+		}
+		run.FinishedAt = j.now()
+
+		if err := j.store.SaveRun(ctx, *run); err != nil {
+			return errors.Join(purgeErr, err)
+		}
+		return purgeErr
+	})
+	if err != nil {
+		return run, fmt.Errorf("cache: janitor: %w", err)
+	}
+	return run, nil
+}
+
+// purge deletes the expired rows of table until a batch comes back short.
+func (j *Janitor) purge(ctx context.Context, table string, run *JanitorRun) error {
+	for {
+		n, err := j.store.PurgeExpired(ctx, table, j.batch)
+		run.Purged[table] += n
+		if err != nil {
+			return fmt.Errorf("purge %s: %w", table, err)
+		}
+		if n < int64(j.batch) {
+			return nil
+		}
+	}
+}
+
+// Stats returns the configuration, the last run and the size of the tables.
+func (j *Janitor) Stats(ctx context.Context) (*JanitorStats, error) {
+	last, err := j.store.LastRun(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cache: janitor stats: %w", err)
+	}
+	tables, err := j.store.TableStats(ctx, JanitorTables)
+	if err != nil {
+		return nil, fmt.Errorf("cache: janitor stats: %w", err)
+	}
+	return &JanitorStats{
+		IntervalS: int64(j.interval / time.Second),
+		BatchSize: j.batch,
+		LastRun:   last,
+		Tables:    tables,
+	}, nil
+}
+
+func (j *Janitor) logf(format string, args ...any) {
+	if j.logger != nil {
+		j.logger(format, args...)
+	}
+}
+
+// --- pgx-backed JanitorStore implementation ---
+
+// pgJanitorStore is the production implementation of JanitorStore.
+type pgJanitorStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPgJanitorStore creates a JanitorStore backed by the given connection
+// pool.
+func NewPgJanitorStore(pool *pgxpool.Pool) JanitorStore {
+	return &pgJanitorStore{pool: pool}
+}
+
+// WithLock takes a session-level advisory lock on a dedicated connection, so
+// that it is released if this instance dies mid-run.
+func (s *pgJanitorStore) WithLock(ctx context.Context, fn func(ctx context.Context) error) (bool, error) {
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("acquire: %w", err)
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, janitorLockKey).Scan(&locked); err != nil {
+		return false, fmt.Errorf("lock: %w", err)
+	}
+	if !locked {
+		return false, nil
+	}
+	defer func() {
+		unlockCtx, cancel := context.WithTimeout(context.Background(), janitorQueryTimeout)
+		defer cancel()
+		if _, err := conn.Exec(unlockCtx, `SELECT pg_advisory_unlock($1)`, janitorLockKey); err != nil {
+			// Do not hand a connection that may still hold the lock back
+			// to the pool.
+			_ = conn.Conn().Close(unlockCtx)
+		}
+	}()
+
+	return true, fn(ctx)
+}
+
+// PurgeExpired deletes by ctid, as geocode_cache has no id column.
+// table must be one of JanitorTables.
+func (s *pgJanitorStore) PurgeExpired(ctx context.Context, table string, limit int) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, janitorQueryTimeout)
+	defer cancel()
+
+	q := fmt.Sprintf(`
+		DELETE FROM %[1]s
+		WHERE ctid IN (
+			SELECT ctid FROM %[1]s
+			WHERE expires_at <= NOW()
+			LIMIT $1
+		)`, pgx.Identifier{table}.Sanitize())
+
+	tag, err := s.pool.Exec(ctx, q, limit)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// SaveRun upserts the single row of cache_janitor_runs.
+func (s *pgJanitorStore) SaveRun(ctx context.Context, run JanitorRun) error {
+	ctx, cancel := context.WithTimeout(ctx, janitorQueryTimeout)
+	defer cancel()
+
+	purged, err := json.Marshal(run.Purged)
+	if err != nil {
+		return fmt.Errorf("save run: %w", err)
+	}
+	var runErr *string
+	if run.Error != "" {
+		runErr = &run.Error
+	}
+
+	const q = `
+		INSERT INTO cache_janitor_runs (id, started_at, finished_at, purged, error)
+		VALUES (true, $1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET
+			started_at  = EXCLUDED.started_at,
+			finished_at = EXCLUDED.finished_at,
+			purged      = EXCLUDED.purged,
+			error       = EXCLUDED.error`
+
+	if _, err := s.pool.Exec(ctx, q, run.StartedAt, run.FinishedAt, purged, runErr); err != nil {
+		return fmt.Errorf("save run: %w", err)
+	}
+	return nil
+}
+
+// LastRun reads the single row of cache_janitor_runs.
+func (s *pgJanitorStore) LastRun(ctx context.Context) (*JanitorRun, error) {
+	ctx, cancel := context.WithTimeout(ctx, janitorQueryTimeout)
+	defer cancel()
+
+	const q = `SELECT started_at, finished_at, purged, COALESCE(error, '') FROM cache_janitor_runs`
+
+	var (
+		run    JanitorRun
+		purged []byte
+	)
+	err := s.pool.QueryRow(ctx, q).Scan(&run.StartedAt, &run.FinishedAt, &purged, &run.Error)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("last run: %w", err)
+	}
+	if err := json.Unmarshal(purged, &run.Purged); err != nil {
+		return nil, fmt.Errorf("last run: decode purged: %w", err)
+	}
+	return &run, nil
+}
+
+// TableStats counts the rows of each table and reads its size on disk,
+// indexes included.
+func (s *pgJanitorStore) TableStats(ctx context.Context, tables []string) ([]TableStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, janitorQueryTimeout)
+	defer cancel()
+
+	out := make([]TableStats, 0, len(tables))
+	for _, table := range tables {
+		q := fmt.Sprintf(`
+			SELECT COUNT(*),
+			       COUNT(*) FILTER (WHERE expires_at <= NOW()),
+			       pg_total_relation_size($1::regclass)
+			FROM %s`, pgx.Identifier{table}.Sanitize())
+
+		ts := TableStats{Table: table}
+		if err := s.pool.QueryRow(ctx, q, table).Scan(&ts.Rows, &ts.ExpiredRows, &ts.Bytes); err != nil {
+			return nil, fmt.Errorf("table stats %s: %w", table, err)
+		}
+		out = append(out, ts)
+	}
+	return out, nil
+}
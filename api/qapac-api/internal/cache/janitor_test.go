@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// mockJanitorStore pretends each table has a number of expired rows.
+type mockJanitorStore struct {
+	expired   map[string]int64
+	locked    bool // held by another instance
+	purgeErr  error
+	deletes   []int64 // rows deleted by each PurgeExpired call
+	saved     *JanitorRun
+	lockCalls int
+}
+
+func (m *mockJanitorStore) WithLock(ctx context.Context, fn func(ctx context.Context) error) (bool, error) {
+	m.lockCalls++
+	if m.locked {
+		return false, nil
+	}
+	return true, fn(ctx)
+}
+
+func (m *mockJanitorStore) PurgeExpired(_ context.Context, table string, limit int) (int64, error) {
+	if m.purgeErr != nil {
+		return 0, m.purgeErr
+	}
+	n := min(m.expired[table], int64(limit))
+	m.expired[table] -= n
+	m.deletes = append(m.deletes, n)
+	return n, nil
+}
+
+func (m *mockJanitorStore) SaveRun(_ context.Context, run JanitorRun) error {
+	m.saved = &run
+	return nil
+}
+
+func (m *mockJanitorStore) LastRun(_ context.Context) (*JanitorRun, error) {
+	return m.saved, nil
+}
+
+func (m *mockJanitorStore) TableStats(_ context.Context, tables []string) ([]TableStats, error) {
+	out := make([]TableStats, 0, len(tables))
+	for _, t := range tables {
+		out = append(out, TableStats{Table: t, ExpiredRows: m.expired[t]})
+	}
+	return out, nil
+}
+
+func TestJanitor_PurgesInBatches(t *testing.T) {
+	store := &mockJanitorStore{expired: map[string]int64{"route_to_stop_cache": 25, "stop_eta_cache": 10}}
+	clock := &fakeClock{t: time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)}
+	j := NewJanitor(store, WithJanitorBatch(10), withJanitorClock(clock.now))
+
+	run, err := j.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	want := map[string]int64{"route_to_stop_cache": 25, "stop_eta_cache": 10, "geocode_cache": 0}
+	for table, n := range want {
+		if run.Purged[table] != n {
+			t.Errorf("purged %s = %d, want %d", table, run.Purged[table], n)
+		}
+	}
+	// routes: 10+10+5; etas: 10 then an empty batch; geocode: one empty batch.
+	if len(store.deletes) != 6 {
+		t.Errorf("DELETE batches = %v, want 6", store.deletes)
+	}
+	if store.saved == nil || store.saved.Purged["route_to_stop_cache"] != 25 {
+		t.Errorf("saved run = %+v, want the run recorded", store.saved)
+	}
+}
+
+func TestJanitor_LockHeldElsewhere_Skips(t *testing.T) {
+	store := &mockJanitorStore{expired: map[string]int64{"stop_eta_cache": 5}, locked: true}
+	j := NewJanitor(store)
+
+	run, err := j.RunOnce(context.Background())
+	if err != nil || run != nil {
+		t.Errorf("RunOnce = %+v, %v; want nil, nil", run, err)
+	}
+	if len(store.deletes) != 0 || store.saved != nil {
+		t.Error("janitor purged without holding the lock")
+	}
+}
+
+func TestJanitor_PurgeError_Recorded(t *testing.T) {
+	store := &mockJanitorStore{expired: map[string]int64{}, purgeErr: errors.New("lock timeout")}
+	j := NewJanitor(store)
+
+	run, err := j.RunOnce(context.Background())
+	if err == nil {
+		t.Fatal("expected the purge error")
+	}
+	if run == nil || run.Error == "" {
+		t.Fatalf("run = %+v, want the error recorded", run)
+	}
+	if store.saved == nil || store.saved.Error != run.Error {
+		t.Errorf("saved run = %+v, want the failed run recorded", store.saved)
+	}
+}
+
+func TestJanitor_Run_StopsWithContext(t *testing.T) {
+	store := &mockJanitorStore{expired: map[string]int64{}}
+	j := NewJanitor(store, WithJanitorInterval(time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		j.Run(ctx)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	if store.lockCalls == 0 {
+		t.Error("Run never ran the janitor")
+	}
+}
+
+func TestJanitor_Stats(t *testing.T) {
+	store := &mockJanitorStore{expired: map[string]int64{"geocode_cache": 3}}
+	j := NewJanitor(store, WithJanitorInterval(2*time.Minute), WithJanitorBatch(500))
+
+	stats, err := j.Stats(context.Background())
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if stats.IntervalS != 120 || stats.BatchSize != 500 || stats.LastRun != nil {
+		t.Errorf("stats = %+v, want interval 120, batch 500, no run", stats)
+	}
+	if len(stats.Tables) != len(JanitorTables) || stats.Tables[2].ExpiredRows != 3 {
+		t.Errorf("tables = %+v, want the three cache tables", stats.Tables)
+	}
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// invalidationChannel is the channel notified by the triggers of
+	// 016_cache_invalidation.sql on every write to the cache tables.
+	invalidationChannel = "cache_invalidation"
+
+	// instanceSetting is the session setting read by the triggers of
+	// 018_cache_invalidation_origin.sql to tag each notification with the
+	// instance that wrote the row.
+	instanceSetting = "qapac.instance"
+
+	// listenMinBackoff and listenMaxBackoff bound the wait before the
+	// listener reconnects after losing its connection.
+	listenMinBackoff = time.Second
+	listenMaxBackoff = time.Minute
+)
+
+// NewInstanceID returns a random ID for this process, to tell its own
+// invalidation notifications apart from those of other instances.
+func NewInstanceID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b) // never fails
+	return hex.EncodeToString(b)
+}
+
+// TagConnections makes every connection of cfg set the instance ID that the
+// cache triggers copy into their notifications. Pair it with
+// WithInstanceID(instanceID) on the Store listening on that pool.
+func TagConnections(cfg *pgxpool.Config, instanceID string) {
+	next := cfg.AfterConnect
+	cfg.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		if _, err := conn.Exec(ctx, "SELECT set_config($1, $2, false)", instanceSetting, instanceID); err != nil {
+			return fmt.Errorf("cache: tag connection: %w", err)
+		}
+		if next != nil {
+			return next(ctx, conn)
+		}
+		return nil
+	}
+}
+
+// Listen clears the entries that other instances write to the cache tables,
+// as Postgres notifies them, until ctx is done. It holds one connection of
+// pool for itself and reconnects with backoff when it is lost; notifications
+// sent meanwhile are missed, so the whole in-memory tier is cleared on
+// reconnection. Notifications of the Store's own writes are skipped when it
+// has an instance ID (see WithInstanceID).
+func (s *Store) Listen(ctx context.Context, pool *pgxpool.Pool) {
+	backoff := listenMinBackoff
+	for {
+		err := s.listen(ctx, pool, func() { backoff = listenMinBackoff })
+		if ctx.Err() != nil {
+			return
+		}
+		s.logf("cache: invalidation listener: %v (retrying in %s)", err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, listenMaxBackoff)
+	}
+}
+
+// listen runs one LISTEN session, calling onListening once it is set up.
+func (s *Store) listen(ctx context.Context, pool *pgxpool.Pool, onListening func()) error {
+	pc, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire: %w", err)
+	}
+	// A LISTENing connection must not go back to the pool.
+	conn := pc.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+invalidationChannel); err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	s.Clear()
+	onListening()
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("wait: %w", err)
+		}
+		s.Invalidate(n.Payload)
+	}
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lru is a map bounded to maxEntries that evicts the least recently used
+// entry and drops entries older than ttl. It is safe for concurrent use.
+type lru[K comparable, V any] struct {
+	maxEntries int
+	ttl        time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[K]*list.Element
+	order   *list.List // front = most recently used
+}
+
+type lruEntry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+func newLRU[K comparable, V any](maxEntries int, ttl time.Duration, now func() time.Time) *lru[K, V] {
+	return &lru[K, V]{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		now:        now,
+		entries:    make(map[K]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// get returns the value of key if it is present and not expired.
+func (c *lru[K, V]) get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	e := el.Value.(*lruEntry[K, V])
+	if !c.now().Before(e.expiresAt) {
+		c.removeElement(el)
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+// set stores value under key for ttl, evicting the least recently used
+// entries beyond maxEntries.
+func (c *lru[K, V]) set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := c.now().Add(c.ttl)
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*lruEntry[K, V])
+		e.value, e.expiresAt = value, expiresAt
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value, expiresAt: expiresAt})
+	for c.order.Len() > c.maxEntries {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// delete removes key, if present.
+func (c *lru[K, V]) delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// deleteFunc removes every entry whose key matches fn.
+func (c *lru[K, V]) deleteFunc(fn func(K) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, el := range c.entries {
+		if fn(k) {
+			c.removeElement(el)
+		}
+	}
+}
+
+// len returns the number of entries, expired ones included.
+func (c *lru[K, V]) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// removeElement drops el. Called with c.mu held.
+func (c *lru[K, V]) removeElement(el *list.Element) {
+	e := c.order.Remove(el).(*lruEntry[K, V])
+	delete(c.entries, e.key)
+}
@@ -0,0 +1,293 @@
+// Package cache manages the Postgres cache tables: Store keeps the most used
+// route and ETA entries in memory in front of them, so that hot keys do not
+// cost a database round trip on every hit, and Janitor deletes their expired
+// rows.
+package cache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/routing"
+	"github.com/dom1nux/qapac-api/internal/service"
+)
+
+const (
+	// DefaultMaxEntries bounds the entries kept in memory. A route entry
+	// without steps is well under 1 KB.
+	DefaultMaxEntries = 10000
+
+	// DefaultTTL is how long an entry is served from memory. Other instances
+	// clear changed entries through NOTIFY, so the TTL only bounds how long
+	// an entry can outlive its row (which is not notified when deleted).
+	DefaultTTL = 10 * time.Second
+)
+
+// kind tells route and ETA entries apart in the shared LRU.
+type kind uint8
+
+const (
+	kindRoute kind = iota + 1
+	kindETA
+)
+
+// key identifies an entry. ETA entries only use stopID.
+type key struct {
+	kind   kind
+	origin string
+	stopID int32
+	mode   routing.TravelMode
+}
+
+// Store is a two-tier cache: an in-process LRU with TTL in front of the
+// Postgres route and ETA stores. It implements both routing.CacheStore and
+// service.ETACacheStore.
+//
+// Reads fill the LRU from Postgres; writes go to Postgres and then to the
+// LRU, stamped with the time of the write as Postgres does. Entries written
+// by other instances are cleared by Listen.
+type Store struct {
+	routes     routing.CacheStore
+	etas       service.ETACacheStore
+	maxEntries int
+	ttl        time.Duration
+	logger     func(format string, args ...any)
+	instanceID string // tags this instance's notifications; "" = none
+	now        func() time.Time
+	local      *lru[key, any]
+
+	routeHits, routeMisses atomic.Uint64
+	etaHits, etaMisses     atomic.Uint64
+}
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithMaxEntries overrides DefaultMaxEntries.
+func WithMaxEntries(n int) Option {
+	return func(s *Store) { s.maxEntries = n }
+}
+
+// WithTTL overrides DefaultTTL.
+func WithTTL(d time.Duration) Option {
+	return func(s *Store) { s.ttl = d }
+}
+
+// WithLogger sets a logger for invalidation listener failures. If not set,
+// they are silent.
+func WithLogger(l func(format string, args ...any)) Option {
+	return func(s *Store) { s.logger = l }
+}
+
+// WithInstanceID skips the invalidation notifications of writes made with
+// id, i.e. by this instance through a pool set up with TagConnections: the
+// Store already holds what it wrote.
+func WithInstanceID(id string) Option {
+	return func(s *Store) { s.instanceID = id }
+}
+
+// withClock injects a fake clock for unit testing.
+func withClock(fn func() time.Time) Option {
+	return func(s *Store) { s.now = fn }
+}
+
+// NewStore creates a Store in front of routes and etas.
+func NewStore(routes routing.CacheStore, etas service.ETACacheStore, opts ...Option) *Store {
+	s := &Store{
+		routes:     routes,
+		etas:       etas,
+		maxEntries: DefaultMaxEntries,
+		ttl:        DefaultTTL,
+		now:        time.Now,
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	s.local = newLRU[key, any](s.maxEntries, s.ttl, s.now)
+	return s
+}
+
+func routeKey(originHash string, stopID int32, mode routing.TravelMode) key {
+	return key{kind: kindRoute, origin: originHash, stopID: stopID, mode: mode}
+}
+
+func etaKey(stopID int32) key {
+	return key{kind: kindETA, stopID: stopID}
+}
+
+// --- routing.CacheStore ---
+
+// GetCachedRoute implements routing.CacheStore.
+func (s *Store) GetCachedRoute(ctx context.Context, originHash string, stopID int32, mode routing.TravelMode) (*routing.RoutingResponse, error) {
+	k := routeKey(originHash, stopID, mode)
+	if v, ok := s.local.get(k); ok {
+		s.routeHits.Add(1)
+		return v.(*routing.RoutingResponse), nil
+	}
+	s.routeMisses.Add(1)
+
+	resp, err := s.routes.GetCachedRoute(ctx, originHash, stopID, mode)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	s.local.set(k, resp)
+	return resp, nil
+}
+
+// GetCachedRouteNear implements routing.CacheStore. It always reads
+// Postgres: the LRU is keyed by exact origin.
+func (s *Store) GetCachedRouteNear(ctx context.Context, cell string, stopID int32, mode routing.TravelMode) (*routing.RoutingResponse, error) {
+	return s.routes.GetCachedRouteNear(ctx, cell, stopID, mode)
+}
+
+// SetCachedRoute implements routing.CacheStore.
+func (s *Store) SetCachedRoute(ctx context.Context, originHash string, stopID int32, mode routing.TravelMode, resp *routing.RoutingResponse) error {
+	k := routeKey(originHash, stopID, mode)
+	if err := s.routes.SetCachedRoute(ctx, originHash, stopID, mode, resp); err != nil {
+		s.local.delete(k)
+		return err
+	}
+	cached := *resp
+	cached.CachedAt = s.now()
+	s.local.set(k, &cached)
+	return nil
+}
+
+// --- service.ETACacheStore ---
+
+// GetCachedETA implements service.ETACacheStore.
+func (s *Store) GetCachedETA(ctx context.Context, stopID int32) (service.CachedETA, bool, error) {
+	k := etaKey(stopID)
+	if v, ok := s.local.get(k); ok {
+		s.etaHits.Add(1)
+		return v.(service.CachedETA), true, nil
+	}
+	s.etaMisses.Add(1)
+
+	eta, found, err := s.etas.GetCachedETA(ctx, stopID)
+	if err != nil || !found {
+		return eta, found, err
+	}
+	s.local.set(k, eta)
+	return eta, true, nil
+}
+
+// GetCachedETAs implements service.ETACacheStore. Only the stops missing from
+// memory are read from Postgres. If that read fails, the error is returned
+// along with the entries found in memory.
+func (s *Store) GetCachedETAs(ctx context.Context, stopIDs []int32) (map[int32]service.CachedETA, error) {
+	out := make(map[int32]service.CachedETA, len(stopIDs))
+	var missing []int32
+	for _, id := range stopIDs {
+		if v, ok := s.local.get(etaKey(id)); ok {
+			out[id] = v.(service.CachedETA)
+			continue
+		}
+		missing = append(missing, id)
+	}
+	s.etaHits.Add(uint64(len(out)))
+	s.etaMisses.Add(uint64(len(missing)))
+	if len(missing) == 0 {
+		return out, nil
+	}
+
+	found, err := s.etas.GetCachedETAs(ctx, missing)
+	if err != nil {
+		return out, err
+	}
+	for id, eta := range found {
+		s.local.set(etaKey(id), eta)
+		out[id] = eta
+	}
+	return out, nil
+}
+
+// SetCachedETA implements service.ETACacheStore.
+func (s *Store) SetCachedETA(ctx context.Context, stopID int32, seconds int) error {
+	k := etaKey(stopID)
+	if err := s.etas.SetCachedETA(ctx, stopID, seconds); err != nil {
+		s.local.delete(k)
+		return err
+	}
+	s.local.set(k, service.CachedETA{Seconds: seconds, CachedAt: s.now()})
+	return nil
+}
+
+// --- invalidation ---
+
+// Invalidate clears the entries named by the payload of a cache_invalidation
+// notification (see 018_cache_invalidation_origin.sql), which starts with the
+// ID of the instance that wrote the row:
+//
+//	<instance>|route|<origin_hash>|<stop_id>|<mode>   one route entry
+//	<instance>|eta|<stop_id>                          one ETA entry
+//	<instance>|route, <instance>|eta                  every entry of that kind
+//
+// A payload with the Store's own instance ID is ignored. Any other payload
+// clears everything.
+func (s *Store) Invalidate(payload string) {
+	origin, body, _ := strings.Cut(payload, "|")
+	if s.instanceID != "" && origin == s.instanceID {
+		return
+	}
+	parts := strings.Split(body, "|")
+	switch {
+	case parts[0] == "route" && len(parts) == 1:
+		s.local.deleteFunc(func(k key) bool { return k.kind == kindRoute })
+		return
+	case parts[0] == "eta" && len(parts) == 1:
+		s.local.deleteFunc(func(k key) bool { return k.kind == kindETA })
+		return
+	case parts[0] == "route" && len(parts) == 4:
+		if stopID, err := strconv.ParseInt(parts[2], 10, 32); err == nil {
+			s.local.delete(routeKey(parts[1], int32(stopID), routing.TravelMode(parts[3])))
+			return
+		}
+	case parts[0] == "eta" && len(parts) == 2:
+		if stopID, err := strconv.ParseInt(parts[1], 10, 32); err == nil {
+			s.local.delete(etaKey(int32(stopID)))
+			return
+		}
+	}
+	s.Clear()
+}
+
+// Clear drops every entry kept in memory.
+func (s *Store) Clear() {
+	s.local.deleteFunc(func(key) bool { return true })
+}
+
+// --- monitoring ---
+
+// TierStats counts the reads of one kind of entry answered from memory.
+type TierStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// Stats describes the in-memory tier since start.
+type Stats struct {
+	Entries    int       `json:"entries"`
+	MaxEntries int       `json:"max_entries"`
+	Routes     TierStats `json:"routes"`
+	ETAs       TierStats `json:"etas"`
+}
+
+// Stats returns the size and hit counters of the in-memory tier.
+func (s *Store) Stats() Stats {
+	return Stats{
+		Entries:    s.local.len(),
+		MaxEntries: s.maxEntries,
+		Routes:     TierStats{Hits: s.routeHits.Load(), Misses: s.routeMisses.Load()},
+		ETAs:       TierStats{Hits: s.etaHits.Load(), Misses: s.etaMisses.Load()},
+	}
+}
+
+func (s *Store) logf(format string, args ...any) {
+	if s.logger != nil {
+		s.logger(format, args...)
+	}
+}
@@ -0,0 +1,299 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/routing"
+	"github.com/dom1nux/qapac-api/internal/service"
+)
+
+// ---------------------------------------------------------------------------
+// Test doubles
+// ---------------------------------------------------------------------------
+
+// memRouteStore is an in-memory routing.CacheStore that counts reads.
+type memRouteStore struct {
+	data   map[string]*routing.RoutingResponse
+	gets   int
+	setErr error
+}
+
+func newMemRouteStore() *memRouteStore {
+	return &memRouteStore{data: make(map[string]*routing.RoutingResponse)}
+}
+
+func routeID(origin string, stopID int32, mode routing.TravelMode) string {
+	return fmt.Sprintf("%s|%d|%s", origin, stopID, mode)
+}
+
+func (m *memRouteStore) GetCachedRoute(_ context.Context, origin string, stopID int32, mode routing.TravelMode) (*routing.RoutingResponse, error) {
+	m.gets++
+	return m.data[routeID(origin, stopID, mode)], nil
+}
+
+func (m *memRouteStore) GetCachedRouteNear(_ context.Context, _ string, _ int32, _ routing.TravelMode) (*routing.RoutingResponse, error) {
+	m.gets++
+	return nil, nil
+}
+
+func (m *memRouteStore) SetCachedRoute(_ context.Context, origin string, stopID int32, mode routing.TravelMode, resp *routing.RoutingResponse) error {
+	if m.setErr != nil {
+		return m.setErr
+	}
+	m.data[routeID(origin, stopID, mode)] = resp
+	return nil
+}
+
+// memETAStore is an in-memory service.ETACacheStore that counts reads.
+type memETAStore struct {
+	data   map[int32]int
+	gets   int
+	getErr error
+}
+
+func newMemETAStore() *memETAStore {
+	return &memETAStore{data: make(map[int32]int)}
+}
+
+func (m *memETAStore) GetCachedETA(_ context.Context, stopID int32) (service.CachedETA, bool, error) {
+	m.gets++
+	secs, ok := m.data[stopID]
+	return service.CachedETA{Seconds: secs}, ok, m.getErr
+}
+
+func (m *memETAStore) GetCachedETAs(_ context.Context, stopIDs []int32) (map[int32]service.CachedETA, error) {
+	m.gets++
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	out := make(map[int32]service.CachedETA)
+	for _, id := range stopIDs {
+		if secs, ok := m.data[id]; ok {
+			out[id] = service.CachedETA{Seconds: secs}
+		}
+	}
+	return out, nil
+}
+
+func (m *memETAStore) SetCachedETA(_ context.Context, stopID int32, seconds int) error {
+	m.data[stopID] = seconds
+	return nil
+}
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestStore(opts ...Option) (*Store, *memRouteStore, *memETAStore, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)}
+	routes, etas := newMemRouteStore(), newMemETAStore()
+	s := NewStore(routes, etas, append([]Option{withClock(clock.now)}, opts...)...)
+	return s, routes, etas, clock
+}
+
+// ---------------------------------------------------------------------------
+// lru
+// ---------------------------------------------------------------------------
+
+func TestLRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	c := newLRU[string, int](2, time.Minute, clock.now)
+	c.set("a", 1)
+	c.set("b", 2)
+	c.get("a") // b is now the least recently used
+	c.set("c", 3)
+
+	if _, ok := c.get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	if v, ok := c.get("a"); !ok || v != 1 {
+		t.Errorf("a = %d, %v; want 1, true", v, ok)
+	}
+	if c.len() != 2 {
+		t.Errorf("len = %d, want 2", c.len())
+	}
+}
+
+func TestLRU_Expires(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	c := newLRU[string, int](10, 10*time.Second, clock.now)
+	c.set("a", 1)
+
+	clock.advance(9 * time.Second)
+	if _, ok := c.get("a"); !ok {
+		t.Error("entry expired before its TTL")
+	}
+	clock.advance(time.Second)
+	if _, ok := c.get("a"); ok {
+		t.Error("entry served after its TTL")
+	}
+	if c.len() != 0 {
+		t.Errorf("len = %d, want 0 after reading an expired entry", c.len())
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Store
+// ---------------------------------------------------------------------------
+
+func TestStore_RouteHit_SkipsPostgres(t *testing.T) {
+	s, routes, _, _ := newTestStore()
+	routes.data[routeID("6mc5", 3, routing.TravelModeWalk)] = &routing.RoutingResponse{Polyline: "abc"}
+
+	for range 3 {
+		got, err := s.GetCachedRoute(context.Background(), "6mc5", 3, routing.TravelModeWalk)
+		if err != nil || got == nil || got.Polyline != "abc" {
+			t.Fatalf("GetCachedRoute = %+v, %v; want abc", got, err)
+		}
+	}
+	if routes.gets != 1 {
+		t.Errorf("postgres reads = %d, want 1", routes.gets)
+	}
+	if st := s.Stats(); st.Routes != (TierStats{Hits: 2, Misses: 1}) {
+		t.Errorf("route stats = %+v, want 2 hits 1 miss", st.Routes)
+	}
+}
+
+func TestStore_RouteMiss_NotCachedInMemory(t *testing.T) {
+	s, routes, _, _ := newTestStore()
+
+	for range 2 {
+		if got, _ := s.GetCachedRoute(context.Background(), "6mc5", 3, routing.TravelModeWalk); got != nil {
+			t.Fatalf("got %+v, want miss", got)
+		}
+	}
+	if routes.gets != 2 {
+		t.Errorf("postgres reads = %d, want 2 (misses are not cached)", routes.gets)
+	}
+}
+
+func TestStore_Expiry_ReadsPostgresAgain(t *testing.T) {
+	s, routes, _, clock := newTestStore(WithTTL(5 * time.Second))
+	routes.data[routeID("6mc5", 3, routing.TravelModeWalk)] = &routing.RoutingResponse{Polyline: "abc"}
+
+	_, _ = s.GetCachedRoute(context.Background(), "6mc5", 3, routing.TravelModeWalk)
+	clock.advance(5 * time.Second)
+	_, _ = s.GetCachedRoute(context.Background(), "6mc5", 3, routing.TravelModeWalk)
+
+	if routes.gets != 2 {
+		t.Errorf("postgres reads = %d, want 2", routes.gets)
+	}
+}
+
+func TestStore_SetRoute_WritesThrough(t *testing.T) {
+	s, routes, _, clock := newTestStore()
+	resp := &routing.RoutingResponse{Polyline: "new"}
+
+	if err := s.SetCachedRoute(context.Background(), "6mc5", 3, routing.TravelModeDrive, resp); err != nil {
+		t.Fatalf("SetCachedRoute: %v", err)
+	}
+	if routes.data[routeID("6mc5", 3, routing.TravelModeDrive)] != resp {
+		t.Error("route not written to postgres")
+	}
+	got, _ := s.GetCachedRoute(context.Background(), "6mc5", 3, routing.TravelModeDrive)
+	if got == nil || got.Polyline != "new" || routes.gets != 0 {
+		t.Fatalf("got %+v after %d postgres reads; want the written route from memory", got, routes.gets)
+	}
+	if !got.CachedAt.Equal(clock.now()) {
+		t.Errorf("CachedAt = %v, want the time of the write", got.CachedAt)
+	}
+}
+
+func TestStore_SetRouteError_DropsMemoryEntry(t *testing.T) {
+	s, routes, _, _ := newTestStore()
+	routes.data[routeID("6mc5", 3, routing.TravelModeWalk)] = &routing.RoutingResponse{Polyline: "old"}
+	_, _ = s.GetCachedRoute(context.Background(), "6mc5", 3, routing.TravelModeWalk)
+
+	routes.setErr = errors.New("db down")
+	if err := s.SetCachedRoute(context.Background(), "6mc5", 3, routing.TravelModeWalk, &routing.RoutingResponse{}); err == nil {
+		t.Fatal("expected the postgres error")
+	}
+	_, _ = s.GetCachedRoute(context.Background(), "6mc5", 3, routing.TravelModeWalk)
+	if routes.gets != 2 {
+		t.Errorf("postgres reads = %d, want 2", routes.gets)
+	}
+}
+
+func TestStore_GetCachedETAs_ReadsOnlyMissing(t *testing.T) {
+	s, _, etas, _ := newTestStore()
+	etas.data[1], etas.data[2] = 100, 200
+	_, _, _ = s.GetCachedETA(context.Background(), 1) // now in memory
+	etas.gets = 0
+
+	got, err := s.GetCachedETAs(context.Background(), []int32{1, 2, 3})
+	if err != nil {
+		t.Fatalf("GetCachedETAs: %v", err)
+	}
+	if len(got) != 2 || got[1].Seconds != 100 || got[2].Seconds != 200 {
+		t.Errorf("got %v, want 1:100 2:200", got)
+	}
+	if etas.gets != 1 {
+		t.Errorf("postgres reads = %d, want 1", etas.gets)
+	}
+
+	// Everything found is now in memory.
+	if _, err := s.GetCachedETAs(context.Background(), []int32{1, 2}); err != nil || etas.gets != 1 {
+		t.Errorf("postgres reads = %d (err %v), want no new read", etas.gets, err)
+	}
+}
+
+func TestStore_GetCachedETAs_ErrorKeepsMemoryHits(t *testing.T) {
+	s, _, etas, _ := newTestStore()
+	etas.data[1] = 100
+	_, _, _ = s.GetCachedETA(context.Background(), 1)
+	etas.getErr = errors.New("db down")
+
+	got, err := s.GetCachedETAs(context.Background(), []int32{1, 2})
+	if err == nil {
+		t.Error("expected the postgres error")
+	}
+	if got[1].Seconds != 100 {
+		t.Errorf("got %v, want the in-memory entry of stop 1", got)
+	}
+}
+
+func TestStore_Invalidate(t *testing.T) {
+	s, routes, etas, _ := newTestStore(WithInstanceID("a1"))
+	routes.data[routeID("6mc5", 3, routing.TravelModeWalk)] = &routing.RoutingResponse{}
+	routes.data[routeID("6mc5", 4, routing.TravelModeWalk)] = &routing.RoutingResponse{}
+	etas.data[3], etas.data[4] = 100, 200
+
+	warm := func() {
+		_, _ = s.GetCachedRoute(context.Background(), "6mc5", 3, routing.TravelModeWalk)
+		_, _ = s.GetCachedRoute(context.Background(), "6mc5", 4, routing.TravelModeWalk)
+		_, _, _ = s.GetCachedETA(context.Background(), 3)
+		_, _, _ = s.GetCachedETA(context.Background(), 4)
+	}
+
+	tests := []struct {
+		payload string
+		want    int // entries left
+	}{
+		{"b7|route|6mc5|3|walk", 3},
+		{"b7|eta|4", 3},
+		{"|route", 2}, // written by a session without an instance ID
+		{"b7|eta", 2},
+		{"a1|route|6mc5|3|walk", 4}, // written by this instance
+		{"a1|route", 4},
+		{"b7|route|6mc5|x|walk", 0}, // malformed: clear everything
+		{"route|6mc5|3|walk", 0},    // no instance ID
+		{"network", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.payload, func(t *testing.T) {
+			warm()
+			if n := s.Stats().Entries; n != 4 {
+				t.Fatalf("entries before = %d, want 4", n)
+			}
+			s.Invalidate(tt.payload)
+			if n := s.Stats().Entries; n != tt.want {
+				t.Errorf("entries after = %d, want %d", n, tt.want)
+			}
+		})
+	}
+}
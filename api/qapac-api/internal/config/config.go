@@ -3,8 +3,11 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // ConfigError represents a configuration error.
@@ -17,13 +20,92 @@ func (e *ConfigError) Error() string {
 	return fmt.Sprintf("config error: field %q: %s", e.Field, e.Message)
 }
 
+// Routing providers selectable with ROUTING_PROVIDER.
+const (
+	RoutingProviderGoogle   = "google"
+	RoutingProviderOSRM     = "osrm"
+	RoutingProviderValhalla = "valhalla"
+)
+
 // Config holds all runtime configuration loaded from environment variables.
 type Config struct {
 	DBDSN        string
 	GoogleAPIKey string
 	Port         int
+	// AdminAPIToken is the bearer token required by the /admin endpoints.
+	// Empty disables those endpoints.
+	AdminAPIToken string
+	// TrustedProxies are the IPs and CIDRs of the reverse proxies whose
+	// X-Forwarded-For header names the client. Empty trusts none: the client
+	// is the peer of the connection.
+	TrustedProxies []string
+
+	// RoutingProviders are the engines behind /routes/to-stop, tried in
+	// order: google (default), osrm or valhalla. A straight-line estimate is
+	// always the last resort.
+	RoutingProviders []string
+	// OSRMURL, OSRMWalkURL and OSRMBicycleURL are the base URLs of the OSRM
+	// engines for driving, walking and cycling (osrm-routed serves one
+	// profile); at least one is required when osrm is selected.
+	OSRMURL        string
+	OSRMWalkURL    string
+	OSRMBicycleURL string
+	// ValhallaURL is the base URL of the Valhalla engine, which serves every
+	// travel mode; required when valhalla is selected.
+	ValhallaURL string
+
+	// GoogleRoutesSoftDaily ... GoogleRoutesHardMonthly cap the calls to the
+	// Google Routes API per day and month; 0 disables a cap. At a soft cap
+	// cached routes are looked up in a wider area, at a hard cap Google is
+	// not called.
+	GoogleRoutesSoftDaily   int64
+	GoogleRoutesHardDaily   int64
+	GoogleRoutesSoftMonthly int64
+	GoogleRoutesHardMonthly int64
+	// GoogleRoutesPricePer1000 is the price of 1000 calls in USD, used to
+	// report the spend.
+	GoogleRoutesPricePer1000 float64
+
+	// CacheLocalEntries bounds the route and ETA cache entries each instance
+	// keeps in memory in front of Postgres; 0 disables the in-memory tier.
+	CacheLocalEntries int
+	// CacheLocalTTL is how long an entry is served from memory.
+	CacheLocalTTL time.Duration
+	// CacheJanitorInterval is how often expired cache rows are deleted; 0
+	// disables the janitor on this instance.
+	CacheJanitorInterval time.Duration
+	// CacheJanitorBatch is how many rows each janitor DELETE removes.
+	CacheJanitorBatch int
+	// CacheRefreshWorkers is how many stale route and ETA entries are
+	// refreshed at once in the background; 0 disables stale serving.
+	CacheRefreshWorkers int
 }
 
+const (
+	// defaultGoogleRoutesPricePer1000 is the list price of Routes API Compute
+	// Routes Essentials in USD.
+	defaultGoogleRoutesPricePer1000 = 5.0
+
+	// defaultCacheLocalEntries and defaultCacheLocalTTL size the in-memory
+	// cache tier.
+	defaultCacheLocalEntries = 10000
+	defaultCacheLocalTTL     = 10 * time.Second
+
+	// defaultCacheJanitorInterval and defaultCacheJanitorBatch pace the
+	// deletion of expired cache rows.
+	defaultCacheJanitorInterval = 5 * time.Minute
+	defaultCacheJanitorBatch    = 1000
+
+	// defaultCacheRefreshWorkers bounds the background refreshes of stale
+	// cache entries.
+	defaultCacheRefreshWorkers = 4
+
+	// maxCacheLocalTTL caps CACHE_LOCAL_TTL. An in-memory entry can outlive
+	// its row by up to the TTL, which must stay small next to the 60 s ETA
+	// cache.
+	maxCacheLocalTTL = time.Minute
+)
+
 // Load reads and validates required environment variables.
 // Returns a ConfigError for any missing or invalid value.
 func Load() (*Config, error) {
@@ -38,6 +120,33 @@ func Load() (*Config, error) {
 	cfg.GoogleAPIKey = os.Getenv("GOOGLE_API_KEY")
 	// Not strictly required for bootstrap; warn but don't fail.
 
+	cfg.AdminAPIToken = os.Getenv("ADMIN_API_TOKEN")
+
+	cfg.TrustedProxies = parseList(os.Getenv("TRUSTED_PROXIES"))
+	if err := cfg.validateTrustedProxies(); err != nil {
+		return nil, err
+	}
+
+	cfg.RoutingProviders = parseList(os.Getenv("ROUTING_PROVIDER"))
+	if len(cfg.RoutingProviders) == 0 {
+		cfg.RoutingProviders = []string{RoutingProviderGoogle}
+	}
+	cfg.OSRMURL = os.Getenv("OSRM_URL")
+	cfg.OSRMWalkURL = os.Getenv("OSRM_WALK_URL")
+	cfg.OSRMBicycleURL = os.Getenv("OSRM_BICYCLE_URL")
+	cfg.ValhallaURL = os.Getenv("VALHALLA_URL")
+	if err := cfg.validateRouting(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.loadGoogleRoutesQuota(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.loadCacheTier(); err != nil {
+		return nil, err
+	}
+
 	portStr := os.Getenv("PORT")
 	if portStr == "" {
 		cfg.Port = 8080
@@ -64,5 +173,166 @@ func (c *Config) Validate() error {
 	if c.Port < 1 || c.Port > 65535 {
 		errs = append(errs, &ConfigError{Field: "PORT", Message: "must be between 1 and 65535"})
 	}
+	if err := c.validateTrustedProxies(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.validateRouting(); err != nil {
+		errs = append(errs, err)
+	}
 	return errors.Join(errs...)
 }
+
+// validateTrustedProxies checks that every trusted proxy is an IP address or
+// a CIDR block.
+func (c *Config) validateTrustedProxies() error {
+	for _, p := range c.TrustedProxies {
+		if net.ParseIP(p) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(p); err != nil {
+			return &ConfigError{Field: "TRUSTED_PROXIES", Message: fmt.Sprintf("%q is not an IP address or CIDR block", p)}
+		}
+	}
+	return nil
+}
+
+// validateRouting checks that the selected routing providers are known,
+// listed once and have their URL configured.
+func (c *Config) validateRouting() error {
+	seen := make(map[string]bool, len(c.RoutingProviders))
+	for _, p := range c.RoutingProviders {
+		if seen[p] {
+			return &ConfigError{Field: "ROUTING_PROVIDER", Message: fmt.Sprintf("%s listed twice", p)}
+		}
+		seen[p] = true
+
+		switch p {
+		case RoutingProviderGoogle:
+		case RoutingProviderOSRM:
+			if c.OSRMURL == "" && c.OSRMWalkURL == "" && c.OSRMBicycleURL == "" {
+				return &ConfigError{Field: "OSRM_URL", Message: "OSRM_URL, OSRM_WALK_URL or OSRM_BICYCLE_URL required when ROUTING_PROVIDER includes osrm"}
+			}
+		case RoutingProviderValhalla:
+			if c.ValhallaURL == "" {
+				return &ConfigError{Field: "VALHALLA_URL", Message: "required when ROUTING_PROVIDER includes valhalla"}
+			}
+		default:
+			return &ConfigError{Field: "ROUTING_PROVIDER", Message: "must be a comma-separated list of google, osrm or valhalla"}
+		}
+	}
+
+	// /routes/to-stop defaults to walking. With osrm as the only engine that
+	// could route on foot, a missing walk profile would leave every default
+	// request to the straight line.
+	walkers := seen[RoutingProviderValhalla] || (seen[RoutingProviderGoogle] && c.GoogleAPIKey != "")
+	if seen[RoutingProviderOSRM] && c.OSRMWalkURL == "" && !walkers {
+		return &ConfigError{Field: "OSRM_WALK_URL", Message: "required when osrm is the only routing provider that can route on foot"}
+	}
+	return nil
+}
+
+// loadGoogleRoutesQuota reads the GOOGLE_ROUTES_* caps and price.
+func (c *Config) loadGoogleRoutesQuota() error {
+	caps := []struct {
+		env string
+		dst *int64
+	}{
+		{"GOOGLE_ROUTES_SOFT_DAILY", &c.GoogleRoutesSoftDaily},
+		{"GOOGLE_ROUTES_HARD_DAILY", &c.GoogleRoutesHardDaily},
+		{"GOOGLE_ROUTES_SOFT_MONTHLY", &c.GoogleRoutesSoftMonthly},
+		{"GOOGLE_ROUTES_HARD_MONTHLY", &c.GoogleRoutesHardMonthly},
+	}
+	for _, cp := range caps {
+		raw := os.Getenv(cp.env)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 0 {
+			return &ConfigError{Field: cp.env, Message: "must be a non-negative integer"}
+		}
+		*cp.dst = n
+	}
+	if exceeds(c.GoogleRoutesSoftDaily, c.GoogleRoutesHardDaily) {
+		return &ConfigError{Field: "GOOGLE_ROUTES_SOFT_DAILY", Message: "must not exceed GOOGLE_ROUTES_HARD_DAILY"}
+	}
+	if exceeds(c.GoogleRoutesSoftMonthly, c.GoogleRoutesHardMonthly) {
+		return &ConfigError{Field: "GOOGLE_ROUTES_SOFT_MONTHLY", Message: "must not exceed GOOGLE_ROUTES_HARD_MONTHLY"}
+	}
+
+	c.GoogleRoutesPricePer1000 = defaultGoogleRoutesPricePer1000
+	if raw := os.Getenv("GOOGLE_ROUTES_PRICE_PER_1000"); raw != "" {
+		price, err := strconv.ParseFloat(raw, 64)
+		if err != nil || price < 0 {
+			return &ConfigError{Field: "GOOGLE_ROUTES_PRICE_PER_1000", Message: "must be a non-negative number"}
+		}
+		c.GoogleRoutesPricePer1000 = price
+	}
+	return nil
+}
+
+// loadCacheTier reads the CACHE_LOCAL_*, CACHE_JANITOR_* and
+// CACHE_REFRESH_WORKERS settings.
+func (c *Config) loadCacheTier() error {
+	c.CacheLocalEntries = defaultCacheLocalEntries
+	if raw := os.Getenv("CACHE_LOCAL_ENTRIES"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return &ConfigError{Field: "CACHE_LOCAL_ENTRIES", Message: "must be a non-negative integer"}
+		}
+		c.CacheLocalEntries = n
+	}
+
+	c.CacheLocalTTL = defaultCacheLocalTTL
+	if raw := os.Getenv("CACHE_LOCAL_TTL"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 || d > maxCacheLocalTTL {
+			return &ConfigError{Field: "CACHE_LOCAL_TTL", Message: "must be a duration between 0s and 1m, e.g. 10s"}
+		}
+		c.CacheLocalTTL = d
+	}
+
+	c.CacheJanitorInterval = defaultCacheJanitorInterval
+	if raw := os.Getenv("CACHE_JANITOR_INTERVAL"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 || (d > 0 && d < time.Second) {
+			return &ConfigError{Field: "CACHE_JANITOR_INTERVAL", Message: "must be 0 or a duration of at least 1s, e.g. 5m"}
+		}
+		c.CacheJanitorInterval = d
+	}
+
+	c.CacheJanitorBatch = defaultCacheJanitorBatch
+	if raw := os.Getenv("CACHE_JANITOR_BATCH"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return &ConfigError{Field: "CACHE_JANITOR_BATCH", Message: "must be a positive integer"}
+		}
+		c.CacheJanitorBatch = n
+	}
+
+	c.CacheRefreshWorkers = defaultCacheRefreshWorkers
+	if raw := os.Getenv("CACHE_REFRESH_WORKERS"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return &ConfigError{Field: "CACHE_REFRESH_WORKERS", Message: "must be a non-negative integer"}
+		}
+		c.CacheRefreshWorkers = n
+	}
+	return nil
+}
+
+// exceeds reports whether a soft cap is above its hard cap, when both are set.
+func exceeds(soft, hard int64) bool {
+	return soft > 0 && hard > 0 && soft > hard
+}
+
+// parseList splits a comma-separated value, dropping blanks.
+func parseList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -8,10 +8,157 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type Area struct {
+	ID   string
+	Name string
+}
+
+type CacheJanitorRun struct {
+	ID         bool
+	StartedAt  pgtype.Timestamptz
+	FinishedAt pgtype.Timestamptz
+	Purged     []byte
+	Error      pgtype.Text
+}
+
+type FareLegRule struct {
+	ID            int32
+	LegGroupID    pgtype.Text
+	NetworkID     pgtype.Text
+	FromAreaID    pgtype.Text
+	ToAreaID      pgtype.Text
+	MinDistanceM  pgtype.Int4
+	MaxDistanceM  pgtype.Int4
+	FareProductID string
+	RulePriority  int32
+}
+
+type FareProduct struct {
+	ID              string
+	RiderCategoryID string
+	Name            string
+	AmountCents     int32
+	Currency        string
+}
+
+type FareTransferRule struct {
+	ID               int32
+	FromLegGroupID   pgtype.Text
+	ToLegGroupID     pgtype.Text
+	FareTransferType int16
+	FareProductID    pgtype.Text
+}
+
+type FavoriteRoute struct {
+	DeviceID  string
+	RouteID   int32
+	CreatedAt pgtype.Timestamp
+}
+
+type FavoriteStop struct {
+	DeviceID  string
+	StopID    int32
+	CreatedAt pgtype.Timestamp
+}
+
+type GazetteerPlace struct {
+	ID        int32
+	Name      string
+	Kind      string
+	Geom      interface{}
+	CreatedAt pgtype.Timestamp
+}
+
+type GeocodeCache struct {
+	CacheKey  string
+	Places    []byte
+	CalcTs    pgtype.Timestamp
+	ExpiresAt pgtype.Timestamp
+}
+
+type GoogleRoutesUsage struct {
+	Day   pgtype.Date
+	Calls int64
+}
+
+type Network struct {
+	ID   string
+	Name string
+}
+
+type NetworkChange struct {
+	ID        int64
+	Version   int64
+	Entity    string
+	EntityID  pgtype.Int4
+	ChangedAt pgtype.Timestamp
+}
+
+type NetworkVersion struct {
+	ID        bool
+	Version   int64
+	UpdatedAt pgtype.Timestamp
+}
+
+type OccupancyReport struct {
+	ID         int32
+	VehicleID  int32
+	Status     int16
+	Source     string
+	ReportedAt pgtype.Timestamp
+}
+
+type Rating struct {
+	ID           int32
+	TripID       int32
+	RouteID      int32
+	VehicleID    pgtype.Int4
+	AssignmentID pgtype.Int4
+	DriverID     pgtype.Int4
+	CollectorID  pgtype.Int4
+	Stars        int16
+	Comment      string
+	Tags         []string
+	Status       string
+	CreatedAt    pgtype.Timestamp
+}
+
+type RiderCategory struct {
+	ID        string
+	Name      string
+	IsDefault bool
+}
+
+type RiderTrip struct {
+	ID            int32
+	DeviceID      string
+	RouteID       int32
+	VehicleID     pgtype.Int4
+	BoardingStop  int32
+	AlightingStop pgtype.Int4
+	BoardedAt     pgtype.Timestamp
+	AlightedAt    pgtype.Timestamp
+	FareCents     pgtype.Int4
+	Source        string
+	CreatedAt     pgtype.Timestamp
+}
+
 type Route struct {
-	ID     int32
-	Name   string
-	Active pgtype.Bool
+	ID                int32
+	Name              string
+	Active            pgtype.Bool
+	ScheduledHeadwayS pgtype.Int4
+	NetworkID         pgtype.Text
+}
+
+type RouteDeviationIncident struct {
+	ID           int32
+	RouteID      int32
+	Geom         interface{}
+	MaxDistanceM int32
+	OpenedAt     pgtype.Timestamp
+	ClosedAt     pgtype.Timestamp
+	VehicleID    int32
 }
 
 type RouteShape struct {
@@ -37,6 +184,18 @@ type RouteToStopCache struct {
 	DurationS  int32
 	CalcTs     pgtype.Timestamp
 	ExpiresAt  pgtype.Timestamp
+	Provider   string
+	Mode       string
+	Legs       []byte
+	Alternates []byte
+}
+
+type SavedPlace struct {
+	ID        int32
+	DeviceID  string
+	Name      string
+	Geom      interface{}
+	CreatedAt pgtype.Timestamp
 }
 
 type SchemaMigration struct {
@@ -52,6 +211,19 @@ type Stop struct {
 	CreatedAt pgtype.Timestamp
 }
 
+type StopArea struct {
+	AreaID string
+	StopID int32
+}
+
+type StopArrival struct {
+	ID        int32
+	RouteID   int32
+	StopID    int32
+	ArrivedAt pgtype.Timestamp
+	VehicleID int32
+}
+
 type StopEtaCache struct {
 	ID         int32
 	StopID     int32
@@ -59,3 +231,25 @@ type StopEtaCache struct {
 	CalcTs     pgtype.Timestamp
 	ExpiresAt  pgtype.Timestamp
 }
+
+type Vehicle struct {
+	ID                    int32
+	Plate                 string
+	Operator              string
+	Capacity              int32
+	AccessibilityFeatures []string
+	Active                bool
+	CreatedAt             pgtype.Timestamp
+}
+
+type VehicleAssignment struct {
+	ID          int32
+	VehicleID   int32
+	RouteID     int32
+	DriverID    pgtype.Int4
+	StartsAt    pgtype.Timestamp
+	EndsAt      pgtype.Timestamp
+	CollectorID pgtype.Int4
+	StartedAt   pgtype.Timestamp
+	EndedAt     pgtype.Timestamp
+}
@@ -9,12 +9,32 @@ import (
 	"context"
 )
 
+const distanceToRouteShape = `-- name: DistanceToRouteShape :one
+SELECT ST_Distance(geom::geography, ST_SetSRID(ST_MakePoint($1::float8, $2::float8), 4326)::geography)::float8 AS distance_m
+FROM route_shapes
+WHERE route_id = $3::int
+`
+
+type DistanceToRouteShapeParams struct {
+	Lon     float64
+	Lat     float64
+	RouteID int32
+}
+
+func (q *Queries) DistanceToRouteShape(ctx context.Context, arg DistanceToRouteShapeParams) (float64, error) {
+	row := q.db.QueryRow(ctx, distanceToRouteShape, arg.Lon, arg.Lat, arg.RouteID)
+	var distance_m float64
+	err := row.Scan(&distance_m)
+	return distance_m, err
+}
+
 const findStopsNear = `-- name: FindStopsNear :many
-SELECT id, name, ST_AsText(geom) AS geom
+SELECT id, name, ST_AsText(geom) AS geom,
+       ST_Distance(geom::geography, ST_SetSRID(ST_MakePoint($1::float8, $2::float8), 4326)::geography)::float8 AS distance_m
 FROM stops
 WHERE ST_DWithin(geom::geography, ST_SetSRID(ST_MakePoint($1::float8, $2::float8), 4326)::geography, $3::float8)
   AND active = true
-ORDER BY ST_Distance(geom::geography, ST_SetSRID(ST_MakePoint($1::float8, $2::float8), 4326)::geography)
+ORDER BY distance_m
 `
 
 type FindStopsNearParams struct {
@@ -24,9 +44,10 @@ type FindStopsNearParams struct {
 }
 
 type FindStopsNearRow struct {
-	ID   int32
-	Name string
-	Geom interface{}
+	ID        int32
+	Name      string
+	Geom      interface{}
+	DistanceM float64
 }
 
 func (q *Queries) FindStopsNear(ctx context.Context, arg FindStopsNearParams) ([]FindStopsNearRow, error) {
@@ -38,7 +59,12 @@ func (q *Queries) FindStopsNear(ctx context.Context, arg FindStopsNearParams) ([
 	var items []FindStopsNearRow
 	for rows.Next() {
 		var i FindStopsNearRow
-		if err := rows.Scan(&i.ID, &i.Name, &i.Geom); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Geom,
+			&i.DistanceM,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -86,3 +112,164 @@ func (q *Queries) GetStop(ctx context.Context, id int32) (GetStopRow, error) {
 	err := row.Scan(&i.ID, &i.Name, &i.Geom)
 	return i, err
 }
+
+const listRoutesServingStops = `-- name: ListRoutesServingStops :many
+SELECT DISTINCT rs.stop_id, r.id, r.name
+FROM route_stops rs
+JOIN routes r ON r.id = rs.route_id AND r.active = true
+WHERE rs.stop_id = ANY($1::int[])
+ORDER BY rs.stop_id, r.id
+`
+
+type ListRoutesServingStopsRow struct {
+	StopID int32
+	ID     int32
+	Name   string
+}
+
+func (q *Queries) ListRoutesServingStops(ctx context.Context, stopIds []int32) ([]ListRoutesServingStopsRow, error) {
+	rows, err := q.db.Query(ctx, listRoutesServingStops, stopIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListRoutesServingStopsRow
+	for rows.Next() {
+		var i ListRoutesServingStopsRow
+		if err := rows.Scan(&i.StopID, &i.ID, &i.Name); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStopsInBBox = `-- name: ListStopsInBBox :many
+SELECT id, name, geom
+FROM (
+  SELECT DISTINCT ON (cell_x, cell_y) id, name, ST_AsText(geom) AS geom
+  FROM (
+    SELECT id, name, geom,
+           CASE WHEN $1::float8 > 0 THEN floor(ST_X(geom) / $1::float8) ELSE id END AS cell_x,
+           CASE WHEN $1::float8 > 0 THEN floor(ST_Y(geom) / $1::float8) ELSE 0 END AS cell_y
+    FROM stops
+    WHERE geom && ST_MakeEnvelope($2::float8, $3::float8, $4::float8, $5::float8, 4326)
+      AND active = true
+  ) cells
+  ORDER BY cell_x, cell_y, id
+) thinned
+WHERE id > $6::int
+ORDER BY id
+LIMIT $7::int
+`
+
+type ListStopsInBBoxParams struct {
+	GridDeg   float64
+	MinLon    float64
+	MinLat    float64
+	MaxLon    float64
+	MaxLat    float64
+	AfterID   int32
+	PageLimit int32
+}
+
+type ListStopsInBBoxRow struct {
+	ID   int32
+	Name string
+	Geom interface{}
+}
+
+// With grid_deg > 0 only the lowest-ID stop of each grid cell is kept, so
+// dense areas are thinned at low zoom levels; 0 disables thinning.
+func (q *Queries) ListStopsInBBox(ctx context.Context, arg ListStopsInBBoxParams) ([]ListStopsInBBoxRow, error) {
+	rows, err := q.db.Query(ctx, listStopsInBBox,
+		arg.GridDeg,
+		arg.MinLon,
+		arg.MinLat,
+		arg.MaxLon,
+		arg.MaxLat,
+		arg.AfterID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListStopsInBBoxRow
+	for rows.Next() {
+		var i ListStopsInBBoxRow
+		if err := rows.Scan(&i.ID, &i.Name, &i.Geom); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchStops = `-- name: SearchStops :many
+WITH q AS (SELECT lower(immutable_unaccent($1::text)) AS text)
+SELECT s.id, s.name, ST_AsText(s.geom) AS geom,
+       (word_similarity(q.text, lower(immutable_unaccent(s.name)))
+        - CASE WHEN $2::bool
+               THEN 0.3 * least(ST_Distance(s.geom::geography, ST_SetSRID(ST_MakePoint($3::float8, $4::float8), 4326)::geography) / 20000.0, 1)
+               ELSE 0 END)::float8 AS score
+FROM stops s, q
+WHERE q.text <% lower(immutable_unaccent(s.name))
+  AND s.active = true
+ORDER BY score DESC, s.id
+LIMIT $5::int
+`
+
+type SearchStopsParams struct {
+	Query     string
+	Near      bool
+	Lon       float64
+	Lat       float64
+	PageLimit int32
+}
+
+type SearchStopsRow struct {
+	ID    int32
+	Name  string
+	Geom  interface{}
+	Score float64
+}
+
+// Ranks by trigram word similarity of the accent-folded name; with near a
+// stop 20 km or more away loses 0.3, closer stops proportionally less.
+func (q *Queries) SearchStops(ctx context.Context, arg SearchStopsParams) ([]SearchStopsRow, error) {
+	rows, err := q.db.Query(ctx, searchStops,
+		arg.Query,
+		arg.Near,
+		arg.Lon,
+		arg.Lat,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchStopsRow
+	for rows.Next() {
+		var i SearchStopsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Geom,
+			&i.Score,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
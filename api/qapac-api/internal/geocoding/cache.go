@@ -0,0 +1,163 @@
+package geocoding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mmcloughlin/geohash"
+)
+
+const (
+	// cacheTTL is how long a geocoding answer is reused. Place names and
+	// addresses change rarely; a day keeps provider costs low.
+	cacheTTL = 24 * time.Hour
+
+	// cacheQueryTimeout is the deadline for each cache read/write query.
+	cacheQueryTimeout = 5 * time.Second
+
+	// reverseGeohashPrecision groups reverse lookups into ≈ 38 m × 19 m
+	// cells: finer than a city block, so the cached answer still describes
+	// the point.
+	reverseGeohashPrecision = 8
+)
+
+// CacheStore abstracts the persistence layer for geocoding answers.
+type CacheStore interface {
+	// GetCachedPlaces returns the cached places for key and whether a valid
+	// (non-expired) entry exists. A hit may hold zero places.
+	GetCachedPlaces(ctx context.Context, key string) ([]Place, bool, error)
+
+	// SetCachedPlaces upserts the entry for key with an expiry of now + cacheTTL.
+	SetCachedPlaces(ctx context.Context, key string, places []Place) error
+}
+
+// CachedGeocoder wraps another Geocoder and caches its answers, including
+// empty ones, so repeated lookups never reach the provider. Errors are not
+// cached.
+type CachedGeocoder struct {
+	inner Geocoder
+	store CacheStore
+}
+
+// NewCachedGeocoder wraps inner with a cache-aside layer backed by store.
+func NewCachedGeocoder(inner Geocoder, store CacheStore) *CachedGeocoder {
+	return &CachedGeocoder{inner: inner, store: store}
+}
+
+// Search implements Geocoder.
+func (c *CachedGeocoder) Search(ctx context.Context, query string, limit int) ([]Place, error) {
+	key := "fwd:" + strconv.Itoa(limit) + ":" + normalizeQuery(query)
+	if places, ok, err := c.store.GetCachedPlaces(ctx, key); err == nil && ok {
+		return places, nil
+	}
+	// Cache read failures are non-fatal: fall through to the provider.
+
+	places, err := c.inner.Search(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	_ = c.store.SetCachedPlaces(ctx, key, places) // best effort
+	return places, nil
+}
+
+// Reverse implements Geocoder.
+func (c *CachedGeocoder) Reverse(ctx context.Context, lat, lon float64) (*Place, error) {
+	key := "rev:" + geohash.EncodeWithPrecision(lat, lon, reverseGeohashPrecision)
+	if places, ok, err := c.store.GetCachedPlaces(ctx, key); err == nil && ok {
+		if len(places) == 0 {
+			return nil, nil
+		}
+		return &places[0], nil
+	}
+
+	p, err := c.inner.Reverse(ctx, lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	var places []Place
+	if p != nil {
+		places = []Place{*p}
+	}
+	_ = c.store.SetCachedPlaces(ctx, key, places) // best effort
+	return p, nil
+}
+
+// normalizeQuery lowercases query and collapses whitespace so that trivially
+// different spellings share a cache entry.
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// --- pgx-backed CacheStore implementation ---
+
+// pgCacheStore is the production implementation of CacheStore backed by pgx.
+type pgCacheStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPgCacheStore creates a CacheStore backed by the given connection pool.
+func NewPgCacheStore(pool *pgxpool.Pool) CacheStore {
+	return &pgCacheStore{pool: pool}
+}
+
+// GetCachedPlaces queries geocode_cache for a valid (non-expired) entry.
+func (s *pgCacheStore) GetCachedPlaces(ctx context.Context, key string) ([]Place, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, cacheQueryTimeout)
+	defer cancel()
+
+	const q = `
+		SELECT places
+		FROM geocode_cache
+		WHERE cache_key  = $1
+		  AND expires_at > NOW()`
+
+	var raw []byte
+	err := s.pool.QueryRow(ctx, q, key).Scan(&raw)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, nil // cache miss
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("geocoding: cache: get: %w", err)
+	}
+
+	var places []Place
+	if err := json.Unmarshal(raw, &places); err != nil {
+		return nil, false, fmt.Errorf("geocoding: cache: get: %w", err)
+	}
+	return places, true, nil
+}
+
+// SetCachedPlaces upserts an entry into geocode_cache.
+func (s *pgCacheStore) SetCachedPlaces(ctx context.Context, key string, places []Place) error {
+	ctx, cancel := context.WithTimeout(ctx, cacheQueryTimeout)
+	defer cancel()
+
+	if places == nil {
+		places = []Place{}
+	}
+	raw, err := json.Marshal(places)
+	if err != nil {
+		return fmt.Errorf("geocoding: cache: set: %w", err)
+	}
+
+	const q = `
+		INSERT INTO geocode_cache (cache_key, places, calc_ts, expires_at)
+		VALUES ($1, $2, NOW(), $3)
+		ON CONFLICT (cache_key)
+		DO UPDATE SET
+			places     = EXCLUDED.places,
+			calc_ts    = EXCLUDED.calc_ts,
+			expires_at = EXCLUDED.expires_at`
+
+	if _, err := s.pool.Exec(ctx, q, key, raw, time.Now().Add(cacheTTL)); err != nil {
+		return fmt.Errorf("geocoding: cache: set: %w", err)
+	}
+	return nil
+}
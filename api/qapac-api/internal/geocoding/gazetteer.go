@@ -0,0 +1,343 @@
+package geocoding
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// gazetteerQueryTimeout is the deadline for each gazetteer query.
+	gazetteerQueryTimeout = 5 * time.Second
+
+	// gazetteerImportTimeout is the deadline for a whole import transaction.
+	gazetteerImportTimeout = 60 * time.Second
+
+	// landmarkReverseRadiusM is how close a landmark must be to describe a
+	// point: about two blocks.
+	landmarkReverseRadiusM = 250
+)
+
+// ErrInvalidGazetteer is returned by the gazetteer parsers for malformed
+// input.
+var ErrInvalidGazetteer = errors.New("invalid gazetteer file")
+
+// GazetteerEntry is a place to import into the gazetteer.
+type GazetteerEntry struct {
+	Name string
+	Kind string
+	// Geometry is a GeoJSON Point, Polygon or MultiPolygon in WGS-84.
+	Geometry json.RawMessage
+}
+
+// Importer loads entries into the gazetteer. Gazetteer implements it; the
+// interface lets handlers be tested without a database.
+type Importer interface {
+	Import(ctx context.Context, entries []GazetteerEntry) (int, error)
+}
+
+// Gazetteer is a Geocoder over the gazetteer_places table: landmarks and
+// districts curated for the service area. Names are matched like stop names
+// (trigram similarity, ignoring case and accents).
+type Gazetteer struct {
+	pool *pgxpool.Pool
+}
+
+// NewGazetteer creates a Gazetteer backed by the given connection pool.
+func NewGazetteer(pool *pgxpool.Pool) *Gazetteer {
+	return &Gazetteer{pool: pool}
+}
+
+// Search implements Geocoder.
+func (g *Gazetteer) Search(ctx context.Context, query string, limit int) ([]Place, error) {
+	ctx, cancel := context.WithTimeout(ctx, gazetteerQueryTimeout)
+	defer cancel()
+
+	const q = `
+		WITH q AS (SELECT lower(immutable_unaccent($1::text)) AS text)
+		SELECT p.name, p.kind,
+		       ST_Y(ST_PointOnSurface(p.geom)), ST_X(ST_PointOnSurface(p.geom))
+		FROM gazetteer_places p, q
+		WHERE q.text <% lower(immutable_unaccent(p.name))
+		ORDER BY word_similarity(q.text, lower(immutable_unaccent(p.name))) DESC, p.id
+		LIMIT $2`
+
+	rows, err := g.pool.Query(ctx, q, query, int32(limit))
+	if err != nil {
+		return nil, fmt.Errorf("geocoding: gazetteer: search: %w", err)
+	}
+	places, err := pgx.CollectRows(rows, scanGazetteerPlace)
+	if err != nil {
+		return nil, fmt.Errorf("geocoding: gazetteer: search: %w", err)
+	}
+	return places, nil
+}
+
+// Reverse implements Geocoder. It returns the nearest landmark within
+// landmarkReverseRadiusM or, failing that, the district whose polygon
+// contains the point.
+func (g *Gazetteer) Reverse(ctx context.Context, lat, lon float64) (*Place, error) {
+	ctx, cancel := context.WithTimeout(ctx, gazetteerQueryTimeout)
+	defer cancel()
+
+	const q = `
+		WITH pt AS (SELECT ST_SetSRID(ST_MakePoint($2::float8, $1::float8), 4326) AS geom)
+		SELECT p.name, p.kind,
+		       ST_Y(ST_PointOnSurface(p.geom)), ST_X(ST_PointOnSurface(p.geom))
+		FROM gazetteer_places p, pt
+		WHERE (p.kind = 'landmark' AND ST_DWithin(p.geom::geography, pt.geom::geography, $3))
+		   OR (p.kind = 'district' AND ST_Intersects(p.geom, pt.geom))
+		ORDER BY p.kind = 'landmark' DESC, ST_Distance(p.geom::geography, pt.geom::geography), p.id
+		LIMIT 1`
+
+	rows, err := g.pool.Query(ctx, q, lat, lon, float64(landmarkReverseRadiusM))
+	if err != nil {
+		return nil, fmt.Errorf("geocoding: gazetteer: reverse: %w", err)
+	}
+	p, err := pgx.CollectExactlyOneRow(rows, scanGazetteerPlace)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("geocoding: gazetteer: reverse: %w", err)
+	}
+	return &p, nil
+}
+
+func scanGazetteerPlace(row pgx.CollectableRow) (Place, error) {
+	p := Place{Source: "gazetteer"}
+	err := row.Scan(&p.Name, &p.Kind, &p.Lat, &p.Lon)
+	return p, err
+}
+
+// Import upserts entries by (name, kind) in a single transaction: either the
+// whole file is loaded or nothing is. Returns the number of entries written.
+func (g *Gazetteer) Import(ctx context.Context, entries []GazetteerEntry) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, gazetteerImportTimeout)
+	defer cancel()
+
+	tx, err := g.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("geocoding: gazetteer: import: begin: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // no-op after Commit
+
+	const q = `
+		INSERT INTO gazetteer_places (name, kind, geom)
+		VALUES ($1, $2, ST_SetSRID(ST_GeomFromGeoJSON($3), 4326))
+		ON CONFLICT (name, kind) DO UPDATE SET geom = EXCLUDED.geom`
+
+	for i, e := range entries {
+		if _, err := tx.Exec(ctx, q, e.Name, e.Kind, string(e.Geometry)); err != nil {
+			return 0, fmt.Errorf("geocoding: gazetteer: import: entry %d (%q): %w", i+1, e.Name, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("geocoding: gazetteer: import: commit: %w", err)
+	}
+	return len(entries), nil
+}
+
+// ParseGazetteerCSV reads gazetteer entries from CSV with the header
+// name,kind,lat,lon (in any order; extra columns are ignored).
+//
+//	name,kind,lat,lon
+//	Parque Kennedy,landmark,-12.1219,-77.0297
+func ParseGazetteerCSV(r io.Reader) ([]GazetteerEntry, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("geocoding: %w: read header: %w", ErrInvalidGazetteer, err)
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, name := range []string{"name", "kind", "lat", "lon"} {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf("geocoding: %w: missing column %q", ErrInvalidGazetteer, name)
+		}
+	}
+
+	var entries []GazetteerEntry
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("geocoding: %w: %w", ErrInvalidGazetteer, err)
+		}
+
+		lat, latErr := strconv.ParseFloat(strings.TrimSpace(rec[col["lat"]]), 64)
+		lon, lonErr := strconv.ParseFloat(strings.TrimSpace(rec[col["lon"]]), 64)
+		if latErr != nil || lonErr != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+			return nil, fmt.Errorf("geocoding: %w: line %d: invalid lat/lon", ErrInvalidGazetteer, line)
+		}
+		geom, _ := json.Marshal(map[string]any{"type": "Point", "coordinates": []float64{lon, lat}})
+
+		e := GazetteerEntry{
+			Name:     strings.TrimSpace(rec[col["name"]]),
+			Kind:     strings.TrimSpace(rec[col["kind"]]),
+			Geometry: geom,
+		}
+		if err := e.validate(); err != nil {
+			return nil, fmt.Errorf("geocoding: %w: line %d: %v", ErrInvalidGazetteer, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// ParseGazetteerGeoJSON reads gazetteer entries from a GeoJSON
+// FeatureCollection. Each feature needs a "name" property; "kind" defaults to
+// landmark for points and district for polygons.
+func ParseGazetteerGeoJSON(r io.Reader) ([]GazetteerEntry, error) {
+	var fc struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Properties struct {
+				Name string `json:"name"`
+				Kind string `json:"kind"`
+			} `json:"properties"`
+			Geometry json.RawMessage `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.NewDecoder(r).Decode(&fc); err != nil {
+		return nil, fmt.Errorf("geocoding: %w: %w", ErrInvalidGazetteer, err)
+	}
+	if fc.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("geocoding: %w: expected a FeatureCollection", ErrInvalidGazetteer)
+	}
+
+	entries := make([]GazetteerEntry, 0, len(fc.Features))
+	for i, f := range fc.Features {
+		var geom struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(f.Geometry, &geom); err != nil {
+			return nil, fmt.Errorf("geocoding: %w: feature %d: invalid geometry", ErrInvalidGazetteer, i)
+		}
+
+		e := GazetteerEntry{
+			Name:     strings.TrimSpace(f.Properties.Name),
+			Kind:     f.Properties.Kind,
+			Geometry: f.Geometry,
+		}
+		switch geom.Type {
+		case "Point":
+			if e.Kind == "" {
+				e.Kind = KindLandmark
+			}
+		case "Polygon", "MultiPolygon":
+			if e.Kind == "" {
+				e.Kind = KindDistrict
+			}
+		default:
+			return nil, fmt.Errorf("geocoding: %w: feature %d: unsupported geometry %q", ErrInvalidGazetteer, i, geom.Type)
+		}
+		// PostGIS would reject a malformed geometry only at insert time,
+		// failing the import as a storage error.
+		if err := validateGeometry(geom.Type, f.Geometry); err != nil {
+			return nil, fmt.Errorf("geocoding: %w: feature %d: %v", ErrInvalidGazetteer, i, err)
+		}
+		if err := e.validate(); err != nil {
+			return nil, fmt.Errorf("geocoding: %w: feature %d: %v", ErrInvalidGazetteer, i, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// validate checks the fields constrained by the gazetteer_places table.
+func (e GazetteerEntry) validate() error {
+	if e.Name == "" || len(e.Name) > 200 {
+		return errors.New("name must be between 1 and 200 characters")
+	}
+	if !slices.Contains([]string{KindLandmark, KindDistrict}, e.Kind) {
+		return fmt.Errorf("kind must be %s or %s", KindLandmark, KindDistrict)
+	}
+	return nil
+}
+
+// validateGeometry checks the coordinates of a GeoJSON Point, Polygon or
+// MultiPolygon: 2D WGS-84 positions, and closed rings of at least four
+// positions.
+func validateGeometry(typ string, raw json.RawMessage) error {
+	switch typ {
+	case "Point":
+		var g struct {
+			Coordinates []float64 `json:"coordinates"`
+		}
+		if err := json.Unmarshal(raw, &g); err != nil {
+			return errors.New("point coordinates must be [lon, lat]")
+		}
+		return validatePosition(g.Coordinates)
+	case "Polygon":
+		var g struct {
+			Coordinates [][][]float64 `json:"coordinates"`
+		}
+		if err := json.Unmarshal(raw, &g); err != nil {
+			return errors.New("polygon coordinates must be a list of rings")
+		}
+		return validatePolygon(g.Coordinates)
+	case "MultiPolygon":
+		var g struct {
+			Coordinates [][][][]float64 `json:"coordinates"`
+		}
+		if err := json.Unmarshal(raw, &g); err != nil {
+			return errors.New("multipolygon coordinates must be a list of polygons")
+		}
+		if len(g.Coordinates) == 0 {
+			return errors.New("multipolygon has no polygons")
+		}
+		for _, polygon := range g.Coordinates {
+			if err := validatePolygon(polygon); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validatePolygon(rings [][][]float64) error {
+	if len(rings) == 0 {
+		return errors.New("polygon has no rings")
+	}
+	for _, ring := range rings {
+		if len(ring) < 4 {
+			return errors.New("polygon rings need at least 4 positions")
+		}
+		for _, pos := range ring {
+			if err := validatePosition(pos); err != nil {
+				return err
+			}
+		}
+		if !slices.Equal(ring[0], ring[len(ring)-1]) {
+			return errors.New("polygon rings must be closed")
+		}
+	}
+	return nil
+}
+
+func validatePosition(pos []float64) error {
+	if len(pos) != 2 {
+		return errors.New("positions must be [lon, lat]")
+	}
+	if pos[0] < -180 || pos[0] > 180 || pos[1] < -90 || pos[1] > 90 {
+		return fmt.Errorf("position [%g, %g] is out of range", pos[0], pos[1])
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package geocoding
+
+import "context"
+
+// Place kinds.
+const (
+	KindLandmark = "landmark"
+	KindDistrict = "district"
+	KindAddress  = "address"
+)
+
+// Place is a named location.
+type Place struct {
+	Name string `json:"name"`
+	// Address is the full formatted address; empty for gazetteer places.
+	Address string  `json:"address,omitempty"`
+	Kind    string  `json:"kind"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+	// Source identifies the geocoder that produced the place ("gazetteer",
+	// "google").
+	Source string `json:"source"`
+}
+
+// Geocoder resolves place names to coordinates and back.
+type Geocoder interface {
+	// Search returns up to limit places matching query, best match first.
+	Search(ctx context.Context, query string, limit int) ([]Place, error)
+
+	// Reverse returns the place that best describes (lat, lon), or
+	// (nil, nil) when there is none.
+	Reverse(ctx context.Context, lat, lon float64) (*Place, error)
+}
+
+// Chain is a Geocoder that asks each geocoder in order and returns the first
+// non-empty answer. A failing geocoder is skipped; its error is returned only
+// when no later geocoder answers.
+//
+// The local gazetteer goes first so that well-known places never reach the
+// paid provider:
+//
+//	geocoding.Chain{gazetteer, cachedGoogle}
+type Chain []Geocoder
+
+// Search implements Geocoder.
+func (c Chain) Search(ctx context.Context, query string, limit int) ([]Place, error) {
+	var lastErr error
+	for _, g := range c {
+		places, err := g.Search(ctx, query, limit)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(places) > 0 {
+			return places, nil
+		}
+	}
+	return nil, lastErr
+}
+
+// Reverse implements Geocoder.
+func (c Chain) Reverse(ctx context.Context, lat, lon float64) (*Place, error) {
+	var lastErr error
+	for _, g := range c {
+		p, err := g.Reverse(ctx, lat, lon)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if p != nil {
+			return p, nil
+		}
+	}
+	return nil, lastErr
+}
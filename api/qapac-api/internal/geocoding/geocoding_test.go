@@ -0,0 +1,312 @@
+package geocoding
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// ---- Chain ----
+
+// stubGeocoder returns fixed answers and counts calls.
+type stubGeocoder struct {
+	places []Place
+	err    error
+	calls  int
+}
+
+func (s *stubGeocoder) Search(_ context.Context, _ string, _ int) ([]Place, error) {
+	s.calls++
+	return s.places, s.err
+}
+
+func (s *stubGeocoder) Reverse(_ context.Context, _, _ float64) (*Place, error) {
+	s.calls++
+	if s.err != nil || len(s.places) == 0 {
+		return nil, s.err
+	}
+	return &s.places[0], nil
+}
+
+func TestChain_FirstNonEmptyWins(t *testing.T) {
+	local := &stubGeocoder{places: []Place{{Name: "Parque Kennedy", Source: "gazetteer"}}}
+	remote := &stubGeocoder{places: []Place{{Name: "Parque Kennedy, Miraflores", Source: "google"}}}
+
+	places, err := Chain{local, remote}.Search(context.Background(), "kennedy", 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(places) != 1 || places[0].Source != "gazetteer" {
+		t.Errorf("places = %+v, want the gazetteer answer", places)
+	}
+	if remote.calls != 0 {
+		t.Errorf("remote called %d times, want 0", remote.calls)
+	}
+}
+
+func TestChain_SkipsEmptyAndFailing(t *testing.T) {
+	empty := &stubGeocoder{}
+	failing := &stubGeocoder{err: errors.New("boom")}
+	remote := &stubGeocoder{places: []Place{{Name: "Av. Arequipa 100", Source: "google"}}}
+
+	p, err := Chain{empty, failing, remote}.Reverse(context.Background(), -12.1, -77.0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p == nil || p.Source != "google" {
+		t.Errorf("place = %+v, want the google answer", p)
+	}
+}
+
+func TestChain_ReturnsErrorWhenNobodyAnswers(t *testing.T) {
+	failing := &stubGeocoder{err: errors.New("boom")}
+
+	places, err := Chain{failing, &stubGeocoder{}}.Search(context.Background(), "x", 5)
+	if err == nil {
+		t.Fatalf("expected error, got places=%+v", places)
+	}
+
+	// Nothing found without failures is not an error.
+	places, err = Chain{&stubGeocoder{}}.Search(context.Background(), "x", 5)
+	if err != nil || len(places) != 0 {
+		t.Errorf("got (%+v, %v), want (empty, nil)", places, err)
+	}
+}
+
+// ---- GoogleGeocoder ----
+
+func newTestGoogle(t *testing.T, body string, gotQuery *string) *GoogleGeocoder {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if gotQuery != nil {
+			*gotQuery = r.URL.RawQuery
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	g := NewGoogleGeocoder("test-key")
+	g.apiURL = srv.URL
+	return g
+}
+
+func TestGoogleGeocoder_Search(t *testing.T) {
+	const body = `{"status":"OK","results":[
+		{"formatted_address":"Av. Arequipa 100, Lima 15046, Perú",
+		 "address_components":[{"long_name":"100"}],
+		 "geometry":{"location":{"lat":-12.07,"lng":-77.03}},
+		 "types":["street_address"]},
+		{"formatted_address":"Parque Kennedy, Miraflores 15074, Perú",
+		 "address_components":[{"long_name":"Parque Kennedy"}],
+		 "geometry":{"location":{"lat":-12.12,"lng":-77.03}},
+		 "types":["park","point_of_interest"]}]}`
+
+	var query string
+	g := newTestGoogle(t, body, &query)
+
+	places, err := g.Search(context.Background(), "av arequipa 100", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(places) != 1 {
+		t.Fatalf("len(places) = %d, want 1 (limit)", len(places))
+	}
+	if places[0].Kind != KindAddress || places[0].Source != "google" || places[0].Lat != -12.07 {
+		t.Errorf("place = %+v", places[0])
+	}
+	for _, want := range []string{"address=av+arequipa+100", "components=country%3APE", "language=es", "key=test-key"} {
+		if !strings.Contains(query, want) {
+			t.Errorf("query %q missing %q", query, want)
+		}
+	}
+}
+
+func TestGoogleGeocoder_ReverseKind(t *testing.T) {
+	const body = `{"status":"OK","results":[
+		{"formatted_address":"Parque Kennedy, Miraflores 15074, Perú",
+		 "address_components":[{"long_name":"Parque Kennedy"}],
+		 "geometry":{"location":{"lat":-12.12,"lng":-77.03}},
+		 "types":["park","point_of_interest"]}]}`
+
+	p, err := newTestGoogle(t, body, nil).Reverse(context.Background(), -12.12, -77.03)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p == nil || p.Name != "Parque Kennedy" || p.Kind != KindLandmark {
+		t.Errorf("place = %+v, want landmark Parque Kennedy", p)
+	}
+}
+
+func TestGoogleGeocoder_ZeroResults(t *testing.T) {
+	g := newTestGoogle(t, `{"status":"ZERO_RESULTS","results":[]}`, nil)
+
+	places, err := g.Search(context.Background(), "zzz", 5)
+	if err != nil || len(places) != 0 {
+		t.Errorf("Search = (%+v, %v), want (empty, nil)", places, err)
+	}
+	p, err := g.Reverse(context.Background(), 0, 0)
+	if err != nil || p != nil {
+		t.Errorf("Reverse = (%+v, %v), want (nil, nil)", p, err)
+	}
+}
+
+func TestGoogleGeocoder_ErrorStatus(t *testing.T) {
+	g := newTestGoogle(t, `{"status":"OVER_QUERY_LIMIT","error_message":"quota"}`, nil)
+
+	if _, err := g.Search(context.Background(), "lima", 5); err == nil {
+		t.Error("expected error for OVER_QUERY_LIMIT")
+	}
+}
+
+// ---- CachedGeocoder ----
+
+type memCacheStore struct {
+	mu      sync.Mutex
+	entries map[string][]Place
+}
+
+func (m *memCacheStore) GetCachedPlaces(_ context.Context, key string) ([]Place, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	places, ok := m.entries[key]
+	return places, ok, nil
+}
+
+func (m *memCacheStore) SetCachedPlaces(_ context.Context, key string, places []Place) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entries == nil {
+		m.entries = map[string][]Place{}
+	}
+	m.entries[key] = places
+	return nil
+}
+
+func TestCachedGeocoder_SearchNormalizesKey(t *testing.T) {
+	inner := &stubGeocoder{places: []Place{{Name: "Av. Arequipa 100"}}}
+	c := NewCachedGeocoder(inner, &memCacheStore{})
+
+	for _, q := range []string{"Av Arequipa  100", "av arequipa 100 "} {
+		if _, err := c.Search(context.Background(), q, 5); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if inner.calls != 1 {
+		t.Errorf("inner called %d times, want 1", inner.calls)
+	}
+}
+
+func TestCachedGeocoder_CachesEmptyReverse(t *testing.T) {
+	inner := &stubGeocoder{}
+	c := NewCachedGeocoder(inner, &memCacheStore{})
+
+	for range 2 {
+		p, err := c.Reverse(context.Background(), -12.1, -77.0)
+		if err != nil || p != nil {
+			t.Fatalf("Reverse = (%+v, %v), want (nil, nil)", p, err)
+		}
+	}
+	if inner.calls != 1 {
+		t.Errorf("inner called %d times, want 1", inner.calls)
+	}
+}
+
+func TestCachedGeocoder_DoesNotCacheErrors(t *testing.T) {
+	inner := &stubGeocoder{err: errors.New("boom")}
+	store := &memCacheStore{}
+	c := NewCachedGeocoder(inner, store)
+
+	if _, err := c.Search(context.Background(), "lima", 5); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(store.entries) != 0 {
+		t.Errorf("store has %d entries, want 0", len(store.entries))
+	}
+}
+
+// ---- gazetteer parsers ----
+
+func TestParseGazetteerCSV(t *testing.T) {
+	const in = "kind,name,lat,lon\n" +
+		"landmark,Parque Kennedy,-12.1219,-77.0297\n" +
+		"district, Miraflores ,-12.1211,-77.0297\n"
+
+	entries, err := ParseGazetteerCSV(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("len(entries) = %d, want 2", len(entries))
+	}
+	if entries[1].Name != "Miraflores" || entries[1].Kind != KindDistrict {
+		t.Errorf("entries[1] = %+v", entries[1])
+	}
+	if got := string(entries[0].Geometry); got != `{"coordinates":[-77.0297,-12.1219],"type":"Point"}` {
+		t.Errorf("geometry = %s", got)
+	}
+}
+
+func TestParseGazetteerCSV_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"missing column": "name,lat,lon\nX,1,2\n",
+		"bad lat":        "name,kind,lat,lon\nX,landmark,abc,2\n",
+		"out of range":   "name,kind,lat,lon\nX,landmark,95,2\n",
+		"bad kind":       "name,kind,lat,lon\nX,street,1,2\n",
+		"empty name":     "name,kind,lat,lon\n,landmark,1,2\n",
+	}
+	for name, in := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseGazetteerCSV(strings.NewReader(in))
+			if !errors.Is(err, ErrInvalidGazetteer) {
+				t.Errorf("err = %v, want ErrInvalidGazetteer", err)
+			}
+		})
+	}
+}
+
+func TestParseGazetteerGeoJSON(t *testing.T) {
+	const in = `{"type":"FeatureCollection","features":[
+		{"type":"Feature","properties":{"name":"Estadio Nacional"},
+		 "geometry":{"type":"Point","coordinates":[-77.0336,-12.0671]}},
+		{"type":"Feature","properties":{"name":"Lince"},
+		 "geometry":{"type":"Polygon","coordinates":[[[-77.04,-12.08],[-77.03,-12.08],[-77.03,-12.09],[-77.04,-12.08]]]}}]}`
+
+	entries, err := ParseGazetteerGeoJSON(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("len(entries) = %d, want 2", len(entries))
+	}
+	if entries[0].Kind != KindLandmark || entries[1].Kind != KindDistrict {
+		t.Errorf("kinds = %q, %q; want landmark, district", entries[0].Kind, entries[1].Kind)
+	}
+}
+
+func TestParseGazetteerGeoJSON_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"not json":           `{`,
+		"not collection":     `{"type":"Feature"}`,
+		"line string":        `{"type":"FeatureCollection","features":[{"properties":{"name":"X"},"geometry":{"type":"LineString","coordinates":[]}}]}`,
+		"no name":            `{"type":"FeatureCollection","features":[{"properties":{},"geometry":{"type":"Point","coordinates":[0,0]}}]}`,
+		"point as text":      `{"type":"FeatureCollection","features":[{"properties":{"name":"X"},"geometry":{"type":"Point","coordinates":"-77,-12"}}]}`,
+		"point out of range": `{"type":"FeatureCollection","features":[{"properties":{"name":"X"},"geometry":{"type":"Point","coordinates":[-12,-95]}}]}`,
+		"point with z":       `{"type":"FeatureCollection","features":[{"properties":{"name":"X"},"geometry":{"type":"Point","coordinates":[-77,-12,150]}}]}`,
+		"open ring":          `{"type":"FeatureCollection","features":[{"properties":{"name":"X"},"geometry":{"type":"Polygon","coordinates":[[[-77.04,-12.08],[-77.03,-12.08],[-77.03,-12.09],[-77.04,-12.09]]]}}]}`,
+		"short ring":         `{"type":"FeatureCollection","features":[{"properties":{"name":"X"},"geometry":{"type":"Polygon","coordinates":[[[-77.04,-12.08],[-77.03,-12.08],[-77.04,-12.08]]]}}]}`,
+		"empty multi":        `{"type":"FeatureCollection","features":[{"properties":{"name":"X"},"geometry":{"type":"MultiPolygon","coordinates":[]}}]}`,
+	}
+	for name, in := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseGazetteerGeoJSON(strings.NewReader(in))
+			if !errors.Is(err, ErrInvalidGazetteer) {
+				t.Errorf("err = %v, want ErrInvalidGazetteer", err)
+			}
+		})
+	}
+}
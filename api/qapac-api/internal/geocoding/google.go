@@ -0,0 +1,165 @@
+package geocoding
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	// geocodeAPIURL is the Google Geocoding API endpoint.
+	geocodeAPIURL = "https://maps.googleapis.com/maps/api/geocode/json"
+
+	// googleTimeout is the maximum duration for a Google API call.
+	googleTimeout = 5 * time.Second
+)
+
+// GoogleGeocoder implements Geocoder using the Google Geocoding API, biased
+// to Peru and answering in Spanish.
+type GoogleGeocoder struct {
+	apiKey     string
+	httpClient *http.Client
+	// apiURL is the Google Geocoding API endpoint. Overrideable in tests.
+	apiURL string
+}
+
+// NewGoogleGeocoder creates a Geocoder backed by the Google Geocoding API.
+// apiKey must be a valid Google Cloud API key with the Geocoding API enabled.
+func NewGoogleGeocoder(apiKey string) *GoogleGeocoder {
+	return &GoogleGeocoder{
+		apiKey:     apiKey,
+		apiURL:     geocodeAPIURL,
+		httpClient: &http.Client{Timeout: googleTimeout},
+	}
+}
+
+// Search implements Geocoder. Unlike GoogleRouter it has no fallback of its
+// own: errors are returned so that Chain and CachedGeocoder can tell a
+// failure from "no results".
+func (g *GoogleGeocoder) Search(ctx context.Context, query string, limit int) ([]Place, error) {
+	results, err := g.call(ctx, url.Values{
+		"address":    {query},
+		"components": {"country:PE"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	places := make([]Place, 0, len(results))
+	for _, r := range results {
+		places = append(places, r.place())
+	}
+	return places, nil
+}
+
+// Reverse implements Geocoder and returns the most specific result.
+func (g *GoogleGeocoder) Reverse(ctx context.Context, lat, lon float64) (*Place, error) {
+	results, err := g.call(ctx, url.Values{
+		"latlng": {strconv.FormatFloat(lat, 'f', -1, 64) + "," + strconv.FormatFloat(lon, 'f', -1, 64)},
+	})
+	if err != nil || len(results) == 0 {
+		return nil, err
+	}
+	p := results[0].place()
+	return &p, nil
+}
+
+// call performs the HTTP request and returns the results. ZERO_RESULTS is
+// not an error.
+func (g *GoogleGeocoder) call(ctx context.Context, params url.Values) ([]geocodeAPIResult, error) {
+	params.Set("key", g.apiKey)
+	params.Set("language", "es")
+	params.Set("region", "pe")
+
+	reqCtx, cancel := context.WithTimeout(ctx, googleTimeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(reqCtx, http.MethodGet, g.apiURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("geocoding: google: create request: %w", err)
+	}
+
+	httpResp, err := g.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("geocoding: google: http: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	respBytes, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("geocoding: google: read response: %w", err)
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("geocoding: google: status %d: %s", httpResp.StatusCode, string(respBytes))
+	}
+
+	var apiResp geocodeAPIResponse
+	if err := json.Unmarshal(respBytes, &apiResp); err != nil {
+		return nil, fmt.Errorf("geocoding: google: unmarshal response: %w", err)
+	}
+
+	switch apiResp.Status {
+	case "OK":
+		return apiResp.Results, nil
+	case "ZERO_RESULTS":
+		return nil, nil
+	default:
+		// The Geocoding API reports quota and key problems with HTTP 200.
+		return nil, fmt.Errorf("geocoding: google: status %s: %s", apiResp.Status, apiResp.ErrorMessage)
+	}
+}
+
+// --- JSON types for the Google Geocoding API ---
+
+type geocodeAPIResponse struct {
+	Status       string             `json:"status"`
+	ErrorMessage string             `json:"error_message"`
+	Results      []geocodeAPIResult `json:"results"`
+}
+
+type geocodeAPIResult struct {
+	FormattedAddress  string `json:"formatted_address"`
+	AddressComponents []struct {
+		LongName string `json:"long_name"`
+	} `json:"address_components"`
+	Geometry struct {
+		Location struct {
+			Lat float64 `json:"lat"`
+			Lng float64 `json:"lng"`
+		} `json:"location"`
+	} `json:"geometry"`
+	Types []string `json:"types"`
+}
+
+// place converts a Google result to a Place. The name is the first address
+// component (the place or street itself); the kind is derived from the result
+// types.
+func (r geocodeAPIResult) place() Place {
+	p := Place{
+		Name:    r.FormattedAddress,
+		Address: r.FormattedAddress,
+		Kind:    KindAddress,
+		Lat:     r.Geometry.Location.Lat,
+		Lon:     r.Geometry.Location.Lng,
+		Source:  "google",
+	}
+	if len(r.AddressComponents) > 0 {
+		p.Name = r.AddressComponents[0].LongName
+	}
+	switch {
+	case slices.Contains(r.Types, "point_of_interest") || slices.Contains(r.Types, "establishment"):
+		p.Kind = KindLandmark
+	case slices.Contains(r.Types, "sublocality") || slices.Contains(r.Types, "locality"):
+		p.Kind = KindDistrict
+	}
+	return p
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// GetBundle handles GET /api/v1/bundle
+//
+// Returns every active stop and route (stops in sequence, encoded polyline
+// shape, scheduled headway) so the app can work offline. The body is gzipped
+// when the client accepts it.
+//
+// Headers:
+//   - ETag: SHA-256 of the uncompressed document; send it back in
+//     If-None-Match to skip unchanged downloads
+//   - X-Bundle-Version: network version, the since of the next diff
+//
+// Response 200:
+//
+//	{"version":42,"stops":[{"id":1,"name":"Plaza Mayor","lat":-12.0453,"lon":-77.0301}],
+//	 "routes":[{"id":1,"name":"Ruta 1","stop_ids":[1,2],"shape":"~ig@tcnuM","headway_s":600}]}
+//
+// Response 304: If-None-Match matches the current bundle.
+// Response 500: storage error.
+func (h *Handler) GetBundle(c *gin.Context) {
+	b, err := h.bundleService.GetBundle(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build bundle"})
+		return
+	}
+
+	etag := `"` + b.Hash + `"`
+	c.Header("ETag", etag)
+	c.Header("X-Bundle-Version", strconv.FormatInt(b.Version, 10))
+	c.Header("Vary", "Accept-Encoding")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	if strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+		c.Header("Content-Encoding", "gzip")
+		c.Data(http.StatusOK, "application/json; charset=utf-8", b.Gzip)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", b.JSON)
+}
+
+// GetBundleDiff handles GET /api/v1/bundle/diff
+//
+// Returns what changed after a bundle version: the full current state of each
+// changed stop and route, and the IDs of those deleted or deactivated.
+//
+// Query params:
+//   - since (required) int64 — version of the client's bundle
+//
+// Response 200:
+//
+//	{"since":40,"version":42,"stops":[],"routes":[{"id":2,...}],"removed_stop_ids":[9],"removed_route_ids":[]}
+//
+// Response 400: since missing, invalid or ahead of the server.
+// Response 410: changes since that version are not available; download the full bundle.
+// Response 500: storage error.
+func (h *Handler) GetBundleDiff(c *gin.Context) {
+	since, err := strconv.ParseInt(c.Query("since"), 10, 64)
+	if err != nil || since < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "since must be a non-negative integer"})
+		return
+	}
+
+	diff, err := h.bundleService.GetBundleDiff(c.Request.Context(), since)
+	switch {
+	case errors.Is(err, service.ErrUnknownBundleVersion):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "since is ahead of the current version"})
+		return
+	case errors.Is(err, service.ErrBundleVersionGone):
+		c.JSON(http.StatusGone, gin.H{"error": "version too old, download the full bundle"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute bundle diff"})
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
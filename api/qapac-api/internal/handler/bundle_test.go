@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/dom1nux/qapac-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// mockNetworkRepo is at version 5; its change log starts at version 2.
+type mockNetworkRepo struct{}
+
+func (mockNetworkRepo) GetNetworkVersion(_ context.Context) (int64, error) { return 5, nil }
+
+func (mockNetworkRepo) GetNetworkSnapshot(_ context.Context) (*storage.NetworkSnapshot, error) {
+	return &storage.NetworkSnapshot{
+		Version: 5,
+		Stops:   []storage.Stop{{ID: 1, Name: "Plaza Mayor", Lat: -12.0453, Lon: -77.0301}},
+		Routes:  []storage.NetworkRoute{{ID: 1, Name: "Ruta 1", StopIDs: []int32{1}}},
+	}, nil
+}
+
+func (mockNetworkRepo) GetNetworkChangesSince(_ context.Context, since int64) (*storage.NetworkSnapshot, error) {
+	if since < 2 {
+		return nil, storage.ErrChangeLogGap
+	}
+	return &storage.NetworkSnapshot{Version: 5, RemovedStopIDs: []int32{9}}, nil
+}
+
+func newBundleRouter() *gin.Engine {
+	h := New(&mockStopsRepo{}, nil, nil, WithBundleService(service.NewBundleService(mockNetworkRepo{})))
+	r := gin.New()
+	r.GET("/api/v1/bundle", h.GetBundle)
+	r.GET("/api/v1/bundle/diff", h.GetBundleDiff)
+	return r
+}
+
+func TestGetBundle(t *testing.T) {
+	r := newBundleRouter()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/bundle", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("X-Bundle-Version") != "5" {
+		t.Errorf("headers = %v", w.Header())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	plain, _ := io.ReadAll(zr)
+	var body struct {
+		Version int64 `json:"version"`
+		Stops   []any `json:"stops"`
+	}
+	if err := json.Unmarshal(plain, &body); err != nil || body.Version != 5 || len(body.Stops) != 1 {
+		t.Errorf("body = %s (%v)", plain, err)
+	}
+
+	// Revalidation with the ETag skips the download.
+	etag := w.Header().Get("ETag")
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/bundle", nil)
+	req.Header.Set("If-None-Match", etag)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("revalidation: status = %d, want 304", w.Code)
+	}
+}
+
+func TestGetBundle_Uncompressed(t *testing.T) {
+	r := newBundleRouter()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/bundle", nil))
+
+	if w.Header().Get("Content-Encoding") != "" || !bytes.HasPrefix(w.Body.Bytes(), []byte(`{"version":5`)) {
+		t.Errorf("body = %s, want plain JSON", w.Body.String())
+	}
+}
+
+func TestGetBundleDiff(t *testing.T) {
+	r := newBundleRouter()
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"?since=3", http.StatusOK},
+		{"?since=5", http.StatusOK},
+		{"?since=1", http.StatusGone},
+		{"?since=9", http.StatusBadRequest},
+		{"?since=-1", http.StatusBadRequest},
+		{"", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/bundle/diff"+tt.query, nil))
+
+		if w.Code != tt.want {
+			t.Errorf("%q: status = %d, want %d", tt.query, w.Code, tt.want)
+		}
+	}
+}
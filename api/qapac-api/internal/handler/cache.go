@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCacheStats handles GET /api/v1/admin/cache/stats
+//
+// Reports the counters of the route and ETA caches since the server started:
+//   - "coalescing": cache misses and how many of them shared an upstream
+//     call already in flight for the same key instead of making their own.
+//   - "local": reads answered by the in-memory tier, and its size. Absent
+//     when the tier is disabled.
+//   - "refresh": background refreshes of stale entries. Absent when stale
+//     entries are not served.
+//
+// Response 200:
+//
+//	{"routes":{"coalescing":{"misses":120,"flights":80,"deduplicated":40},
+//	           "local":{"hits":900,"misses":160}},
+//	 "etas":{"coalescing":{"misses":300,"flights":210,"deduplicated":90},
+//	         "local":{"hits":4000,"misses":350}},
+//	 "local":{"entries":812,"max_entries":10000},
+//	 "refresh":{"workers":4,"queue_size":256,"pending":1,"submitted":340,
+//	            "deduplicated":2100,"dropped":0,"completed":339}}
+func (h *Handler) GetCacheStats(c *gin.Context) {
+	routes := gin.H{"coalescing": h.routeCache.CoalesceStats()}
+	etas := gin.H{"coalescing": h.etaService.CoalesceStats()}
+	resp := gin.H{"routes": routes, "etas": etas}
+
+	if h.localCache != nil {
+		s := h.localCache.Stats()
+		routes["local"] = s.Routes
+		etas["local"] = s.ETAs
+		resp["local"] = gin.H{"entries": s.Entries, "max_entries": s.MaxEntries}
+	}
+	if h.refreshPool != nil {
+		resp["refresh"] = h.refreshPool.Stats()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetCacheJanitor handles GET /api/v1/admin/cache/janitor
+//
+// Reports the janitor that deletes expired cache rows: its settings, its last
+// run (by any instance) and the current size of the cache tables.
+//
+// Response 200:
+//
+//	{"interval_s":300,"batch_size":1000,
+//	 "last_run":{"started_at":"...","finished_at":"...",
+//	             "purged":{"route_to_stop_cache":5210,"stop_eta_cache":830,"geocode_cache":12}},
+//	 "tables":[{"table":"route_to_stop_cache","rows":1840,"expired_rows":95,"bytes":1245184}, ...]}
+//
+// Response 500: storage error.
+func (h *Handler) GetCacheJanitor(c *gin.Context) {
+	stats, err := h.cacheJanitor.Stats(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read cache janitor stats"})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
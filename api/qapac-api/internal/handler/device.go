@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// deviceIDHeader carries the ID the rider app generates on install. Until
+// riders sign in (MVP v2-B), the /me endpoints are scoped to it: whoever
+// knows a device ID sees its trips, so apps must keep it private.
+const deviceIDHeader = "X-Device-ID"
+
+const (
+	minDeviceIDLen = 8
+	maxDeviceIDLen = 64
+)
+
+// requireDeviceID reads the X-Device-ID header: 8 to 64 letters, digits,
+// '-' or '_' (a UUID qualifies).
+// On failure it writes a 400 response and returns ok = false.
+func requireDeviceID(c *gin.Context) (string, bool) {
+	id := c.GetHeader(deviceIDHeader)
+	if !validDeviceID(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "X-Device-ID header must be 8-64 letters, digits, '-' or '_'"})
+		return "", false
+	}
+	return id, true
+}
+
+func validDeviceID(id string) bool {
+	if len(id) < minDeviceIDLen || len(id) > maxDeviceIDLen {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// maxBatchETAStops caps the stops of a batch ETA request: a map viewport
+// rarely shows more, and each miss costs a provider call.
+const maxBatchETAStops = 50
+
+// stopETAJSON is one element of the ListStopETAs response. Exactly one of
+// ETASeconds or Error is set. CacheAgeS is set when Source is "cache", and
+// Occupancy when the bus expected next is known and has recent reports.
+type stopETAJSON struct {
+	StopID     int32          `json:"stop_id"`
+	ETASeconds *int           `json:"eta_seconds,omitempty"`
+	Source     string         `json:"source,omitempty"`
+	CacheAgeS  *int           `json:"cache_age_s,omitempty"`
+	Occupancy  *occupancyJSON `json:"occupancy,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// ListStopETAs handles GET /api/v1/etas
+//
+// Resolves the ETA of many stops in one request. Stops that fail do not fail
+// the request: their element carries an error instead of eta_seconds. An ETA
+// served from the cache carries cache_age_s, the seconds since it was
+// computed, and a stop whose next bus is known carries its occupancy (see
+// GetVehicleOccupancy).
+//
+// Query params:
+//   - ids (required) comma-separated stop IDs, at most 50; duplicates are
+//     answered once
+//
+// Response 200:
+//
+//	{"etas":[{"stop_id":1,"eta_seconds":181,"source":"cache","cache_age_s":42,
+//	          "occupancy":{"vehicle_id":3,"occupancy_status":"STANDING_ROOM_ONLY",
+//	                       "reports":4,"updated_at":"2025-03-10T07:58:12-05:00"}},
+//	         {"stop_id":2,"error":"eta unavailable"}]}
+//
+// Response 400: ids missing, malformed or over the limit.
+func (h *Handler) ListStopETAs(c *gin.Context) {
+	ids, ok := parseStopIDs(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	results := h.etaService.GetETAsForStops(ctx, ids)
+	occupancy := h.approachingOccupancy(ctx, ids)
+
+	out := make([]stopETAJSON, len(results))
+	for i, r := range results {
+		out[i] = toStopETAJSON(r, occupancy)
+	}
+	c.JSON(http.StatusOK, gin.H{"etas": out})
+}
+
+// toStopETAJSON converts one result of ETAService.GetETAsForStops, with the
+// occupancy of the bus expected next at its stop when known.
+func toStopETAJSON(r service.StopETA, occupancy map[int32]*occupancyJSON) stopETAJSON {
+	out := stopETAJSON{StopID: r.StopID}
+	if r.Err != nil {
+		out.Error = "eta unavailable"
+		return out
+	}
+	secs := r.Seconds
+	out.ETASeconds = &secs
+	out.Source = r.Source
+	if r.Source == "cache" {
+		age := int(r.Age / time.Second)
+		out.CacheAgeS = &age
+	}
+	out.Occupancy = occupancy[r.StopID]
+	return out
+}
+
+// parseStopIDs reads the ids query parameter as a list of distinct stop IDs.
+// On failure it writes a 400 response and returns ok = false.
+func parseStopIDs(c *gin.Context) ([]int32, bool) {
+	raw := c.Query("ids")
+	if raw == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids query parameter is required"})
+		return nil, false
+	}
+
+	parts := strings.Split(raw, ",")
+	ids := make([]int32, 0, len(parts))
+	for _, p := range parts {
+		id, ok := parsePositiveID(p)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ids must be a comma-separated list of positive integers"})
+			return nil, false
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > maxBatchETAStops {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids must not exceed 50 stops"})
+		return nil, false
+	}
+	return ids, true
+}
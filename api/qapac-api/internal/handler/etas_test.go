@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+// failingStopETAProvider fails for stop 3 and returns 100s otherwise.
+type failingStopETAProvider struct{}
+
+func (failingStopETAProvider) GetETA(_ context.Context, stopID int32) (int, string, error) {
+	if stopID == 3 {
+		return 0, "", errors.New("provider down")
+	}
+	return 100, "simple", nil
+}
+
+func newETAsHandler() *Handler {
+	return New(&mockStopsRepo{}, service.NewETAService(failingStopETAProvider{}, &mockETACacheStore{}), nil)
+}
+
+func TestListStopETAs_InvalidParams(t *testing.T) {
+	h := newETAsHandler()
+	r := newRouter(h)
+	r.GET("/api/v1/etas", h.ListStopETAs)
+
+	tooMany := make([]string, maxBatchETAStops+1)
+	for i := range tooMany {
+		tooMany[i] = strconv.Itoa(i + 1)
+	}
+	for _, q := range []string{"", "?ids=", "?ids=1,abc", "?ids=1,-2", "?ids=" + strings.Join(tooMany, ",")} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/etas"+q, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want 400", q, w.Code)
+		}
+	}
+}
+
+func TestListStopETAs_PartialResults(t *testing.T) {
+	h := newETAsHandler()
+	r := newRouter(h)
+	r.GET("/api/v1/etas", h.ListStopETAs)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/etas?ids=1,3,1,2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	var result struct {
+		ETAs []stopETAJSON `json:"etas"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if len(result.ETAs) != 3 {
+		t.Fatalf("got %d etas, want 3 (duplicates removed)", len(result.ETAs))
+	}
+	for _, e := range result.ETAs {
+		failed := e.StopID == 3
+		if failed && (e.Error == "" || e.ETASeconds != nil) {
+			t.Errorf("stop 3 = %+v, want error without eta", e)
+		}
+		if !failed && (e.ETASeconds == nil || *e.ETASeconds != 100 || e.Error != "") {
+			t.Errorf("stop %d = %+v, want 100s", e.StopID, e)
+		}
+	}
+}
+
+// agedETACacheStore has stop 1 cached 30 seconds ago.
+type agedETACacheStore struct{ mockETACacheStore }
+
+func (agedETACacheStore) GetCachedETA(_ context.Context, stopID int32) (service.CachedETA, bool, error) {
+	if stopID != 1 {
+		return service.CachedETA{}, false, nil
+	}
+	return service.CachedETA{Seconds: 240, CachedAt: time.Now().Add(-30 * time.Second)}, true, nil
+}
+
+func (agedETACacheStore) GetCachedETAs(_ context.Context, _ []int32) (map[int32]service.CachedETA, error) {
+	return map[int32]service.CachedETA{1: {Seconds: 240, CachedAt: time.Now().Add(-30 * time.Second)}}, nil
+}
+
+func TestListStopETAs_CacheAge(t *testing.T) {
+	h := New(&mockStopsRepo{}, service.NewETAService(failingStopETAProvider{}, &agedETACacheStore{}), nil)
+	r := newRouter(h)
+	r.GET("/api/v1/etas", h.ListStopETAs)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/etas?ids=1,2", nil))
+
+	var result struct {
+		ETAs []stopETAJSON `json:"etas"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if e := result.ETAs[0]; e.Source != "cache" || e.CacheAgeS == nil || *e.CacheAgeS != 30 {
+		t.Errorf("stop 1 = %+v, want a cached ETA 30s old", e)
+	}
+	if e := result.ETAs[1]; e.CacheAgeS != nil {
+		t.Errorf("stop 2 = %+v, want no cache age for an ETA computed now", e)
+	}
+}
+
+func TestStops_CacheAge(t *testing.T) {
+	repo := &mockStopsRepo{
+		getResult: &storage.Stop{ID: 1, Name: "Centro"},
+		findResult: []storage.NearbyStop{
+			{Stop: storage.Stop{ID: 1}, DistanceM: 10},
+			{Stop: storage.Stop{ID: 2}, DistanceM: 20},
+		},
+	}
+	h := New(repo, service.NewETAService(failingStopETAProvider{}, &agedETACacheStore{}), nil)
+	r := newRouter(h)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/stops/1", nil))
+	var stop map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &stop); err != nil {
+		t.Fatalf("unmarshal stop: %v", err)
+	}
+	if stop["cache_age_s"] != float64(30) {
+		t.Errorf("stop cache_age_s = %v, want 30", stop["cache_age_s"])
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/stops/nearby?lat=-12.05&lon=-77.04&include=eta", nil))
+	var nearby []nearbyStopJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &nearby); err != nil {
+		t.Fatalf("unmarshal nearby: %v", err)
+	}
+	if len(nearby) != 2 {
+		t.Fatalf("got %d nearby stops, want 2", len(nearby))
+	}
+	if s := nearby[0]; s.CacheAgeS == nil || *s.CacheAgeS != 30 {
+		t.Errorf("nearby stop 1 = %+v, want a cached ETA 30s old", s)
+	}
+	if s := nearby[1]; s.ETASeconds == nil || s.CacheAgeS != nil {
+		t.Errorf("nearby stop 2 = %+v, want an ETA computed now", s)
+	}
+}
+
+func TestListStopETAs_Occupancy(t *testing.T) {
+	// Vehicle 3, with a recent FULL report, is the next bus at stop 1.
+	occupancy := service.NewOccupancyService(
+		&mockOccupancyRepo{reports: []storage.OccupancyReport{
+			{VehicleID: 3, Status: int(service.OccupancyFull), Source: storage.OccupancySourceCollector, ReportedAt: time.Now()},
+		}},
+		service.WithApproachingVehicles(&mockHeadwaysRepo{approaching: map[int32]int32{1: 3}}),
+	)
+	h := New(&mockStopsRepo{}, service.NewETAService(failingStopETAProvider{}, &mockETACacheStore{}), nil,
+		WithOccupancyService(occupancy))
+	r := newRouter(h)
+	r.GET("/api/v1/etas", h.ListStopETAs)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/etas?ids=1,2", nil))
+
+	var result struct {
+		ETAs []stopETAJSON `json:"etas"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if e := result.ETAs[0]; e.Occupancy == nil || e.Occupancy.VehicleID != 3 || e.Occupancy.OccupancyStatus != "FULL" {
+		t.Errorf("stop 1 = %+v, want vehicle 3 FULL", e)
+	}
+	if e := result.ETAs[1]; e.Occupancy != nil {
+		t.Errorf("stop 2 = %+v, want no occupancy", e)
+	}
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// maxFareLegs caps the number of legs in a multi-leg quote.
+const maxFareLegs = 5
+
+// GetFareQuote handles GET /api/v1/fares/quote
+//
+// A single ride is given with route_id, from_stop_id and to_stop_id; a
+// multi-leg itinerary with legs instead (the two forms are exclusive).
+//
+// Query params:
+//   - route_id       (single) int32 — route ridden
+//   - from_stop_id   (single) int32 — boarding stop
+//   - to_stop_id     (single) int32 — alighting stop
+//   - legs           (multi)  "route:from:to,route:from:to" — up to 5 legs
+//   - rider_category (optional) e.g. "estudiante"; default category if omitted
+//
+// Response 200:
+//
+//	{"rider_category":"general","currency":"PEN","total_cents":250,
+//	 "legs":[{"route_id":1,"from_stop_id":1,"to_stop_id":5,"distance_m":12325,
+//	          "fare_product_id":"tramo_largo","fare_product_name":"Tramo largo","amount_cents":250}],
+//	 "transfers":[]}
+//
+// Response 400: invalid parameters, unknown rider category, or a leg the route
+// does not run.
+// Response 404: no fare rule applies to a leg.
+// Response 500: storage error.
+func (h *Handler) GetFareQuote(c *gin.Context) {
+	legs, ok := parseFareLegs(c)
+	if !ok {
+		return
+	}
+
+	quote, err := h.fareService.Quote(c.Request.Context(), c.Query("rider_category"), legs)
+	switch {
+	case errors.Is(err, service.ErrUnknownRiderCategory):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown rider_category"})
+		return
+	case errors.Is(err, service.ErrInvalidFareLeg):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "route does not run between the given stops in that direction"})
+		return
+	case errors.Is(err, service.ErrNoFare):
+		c.JSON(http.StatusNotFound, gin.H{"error": "no fare applies to this itinerary"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to calculate fare"})
+		return
+	}
+
+	type legJSON struct {
+		RouteID         int32  `json:"route_id"`
+		FromStopID      int32  `json:"from_stop_id"`
+		ToStopID        int32  `json:"to_stop_id"`
+		DistanceM       int    `json:"distance_m"`
+		FareProductID   string `json:"fare_product_id"`
+		FareProductName string `json:"fare_product_name"`
+		AmountCents     int    `json:"amount_cents"`
+	}
+	type transferJSON struct {
+		FromLeg          int    `json:"from_leg"`
+		FareTransferType int    `json:"fare_transfer_type"`
+		FareProductID    string `json:"fare_product_id,omitempty"`
+		AdjustmentCents  int    `json:"adjustment_cents"`
+	}
+
+	outLegs := make([]legJSON, len(quote.Legs))
+	for i, l := range quote.Legs {
+		outLegs[i] = legJSON{
+			RouteID:         l.RouteID,
+			FromStopID:      l.FromStopID,
+			ToStopID:        l.ToStopID,
+			DistanceM:       l.DistanceM,
+			FareProductID:   l.FareProductID,
+			FareProductName: l.FareProductName,
+			AmountCents:     l.AmountCents,
+		}
+	}
+	outTransfers := make([]transferJSON, len(quote.Transfers))
+	for i, t := range quote.Transfers {
+		outTransfers[i] = transferJSON{
+			FromLeg:          t.FromLeg,
+			FareTransferType: t.TransferType,
+			FareProductID:    t.FareProductID,
+			AdjustmentCents:  t.AdjustmentCents,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rider_category": quote.RiderCategoryID,
+		"currency":       quote.Currency,
+		"total_cents":    quote.TotalCents,
+		"legs":           outLegs,
+		"transfers":      outTransfers,
+	})
+}
+
+// parseFareLegs reads either the legs parameter or the single-leg
+// route_id/from_stop_id/to_stop_id parameters.
+// On failure it writes a 400 response and returns ok = false.
+func parseFareLegs(c *gin.Context) ([]service.FareLegRequest, bool) {
+	raw := c.Query("legs")
+	if raw == "" {
+		var ids [3]int32
+		for i, name := range []string{"route_id", "from_stop_id", "to_stop_id"} {
+			id, ok := parsePositiveID(c.Query(name))
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a positive integer (or use legs)"})
+				return nil, false
+			}
+			ids[i] = id
+		}
+		return []service.FareLegRequest{{RouteID: ids[0], FromStopID: ids[1], ToStopID: ids[2]}}, true
+	}
+
+	if c.Query("route_id") != "" || c.Query("from_stop_id") != "" || c.Query("to_stop_id") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "legs cannot be combined with route_id, from_stop_id or to_stop_id"})
+		return nil, false
+	}
+
+	parts := strings.Split(raw, ",")
+	if len(parts) > maxFareLegs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "legs must not exceed 5 entries"})
+		return nil, false
+	}
+	legs := make([]service.FareLegRequest, 0, len(parts))
+	for _, p := range parts {
+		fields := strings.Split(p, ":")
+		if len(fields) != 3 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "each leg must be route_id:from_stop_id:to_stop_id"})
+			return nil, false
+		}
+		var ids [3]int32
+		for i, f := range fields {
+			id, ok := parsePositiveID(f)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "each leg must be route_id:from_stop_id:to_stop_id"})
+				return nil, false
+			}
+			ids[i] = id
+		}
+		legs = append(legs, service.FareLegRequest{RouteID: ids[0], FromStopID: ids[1], ToStopID: ids[2]})
+	}
+	return legs, true
+}
+
+// parsePositiveID parses raw as a positive int32.
+func parsePositiveID(raw string) (int32, bool) {
+	id64, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 32)
+	if err != nil || id64 <= 0 {
+		return 0, false
+	}
+	return int32(id64), true
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/dom1nux/qapac-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// mockFaresRepo prices every leg of route 1 with a single flat product and
+// treats every other route as not serving the stops.
+type mockFaresRepo struct{}
+
+func (mockFaresRepo) GetFareTables(_ context.Context) (*storage.FareTables, error) {
+	return &storage.FareTables{
+		RiderCategories: []storage.RiderCategory{{ID: "general", IsDefault: true}, {ID: "estudiante"}},
+		Products: []storage.FareProduct{
+			{ID: "plano", RiderCategoryID: "general", Name: "Pasaje", AmountCents: 200, Currency: "PEN"},
+			{ID: "plano", RiderCategoryID: "estudiante", Name: "Pasaje", AmountCents: 100, Currency: "PEN"},
+		},
+		LegRules: []storage.FareLegRule{{ID: 1, NetworkID: "lima_urbano", FareProductID: "plano"}},
+	}, nil
+}
+
+func (mockFaresRepo) GetRideLeg(_ context.Context, routeID, fromStopID, toStopID int32) (*storage.RideLeg, error) {
+	if routeID != 1 {
+		return nil, nil
+	}
+	return &storage.RideLeg{
+		RouteID: routeID, FromStopID: fromStopID, ToStopID: toStopID,
+		NetworkID: "lima_urbano", FromSequence: 1, ToSequence: 2, DistanceM: 3000,
+	}, nil
+}
+
+func newFaresRouter() *gin.Engine {
+	h := New(&mockStopsRepo{}, nil, nil, WithFareService(service.NewFareService(mockFaresRepo{})))
+	r := gin.New()
+	r.GET("/api/v1/fares/quote", h.GetFareQuote)
+	return r
+}
+
+func TestGetFareQuote_InvalidParams(t *testing.T) {
+	r := newFaresRouter()
+
+	for _, path := range []string{
+		"/api/v1/fares/quote",
+		"/api/v1/fares/quote?route_id=1&from_stop_id=1",
+		"/api/v1/fares/quote?route_id=1&from_stop_id=x&to_stop_id=2",
+		"/api/v1/fares/quote?legs=1:1",
+		"/api/v1/fares/quote?legs=1:1:2&route_id=1",
+		"/api/v1/fares/quote?legs=1:1:2,1:2:3,1:3:4,1:4:5,1:5:6,1:6:7",
+		"/api/v1/fares/quote?route_id=1&from_stop_id=1&to_stop_id=2&rider_category=jubilado",
+		"/api/v1/fares/quote?route_id=2&from_stop_id=1&to_stop_id=2",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", path, w.Code)
+		}
+	}
+}
+
+func TestGetFareQuote_SingleLeg(t *testing.T) {
+	r := newFaresRouter()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/fares/quote?route_id=1&from_stop_id=1&to_stop_id=3&rider_category=estudiante", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+	}
+
+	var result struct {
+		RiderCategory string `json:"rider_category"`
+		Currency      string `json:"currency"`
+		TotalCents    int    `json:"total_cents"`
+		Legs          []struct {
+			ToStopID    int32 `json:"to_stop_id"`
+			AmountCents int   `json:"amount_cents"`
+		} `json:"legs"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if result.RiderCategory != "estudiante" || result.Currency != "PEN" || result.TotalCents != 100 {
+		t.Errorf("quote = %+v, want estudiante PEN 100", result)
+	}
+	if len(result.Legs) != 1 || result.Legs[0].ToStopID != 3 {
+		t.Errorf("legs = %+v, want one leg to stop 3", result.Legs)
+	}
+}
+
+func TestGetFareQuote_MultiLeg(t *testing.T) {
+	r := newFaresRouter()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/fares/quote?legs=1:1:3,1:3:5", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+	}
+
+	var result struct {
+		TotalCents int               `json:"total_cents"`
+		Legs       []json.RawMessage `json:"legs"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if result.TotalCents != 400 || len(result.Legs) != 2 {
+		t.Errorf("total = %d over %d legs, want 400 over 2", result.TotalCents, len(result.Legs))
+	}
+}
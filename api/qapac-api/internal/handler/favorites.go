@@ -0,0 +1,351 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/dom1nux/qapac-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// placeRequest is the body of CreateSavedPlace and UpdateSavedPlace.
+type placeRequest struct {
+	Name string   `json:"name"`
+	Lat  *float64 `json:"lat"`
+	Lon  *float64 `json:"lon"`
+}
+
+// stopJSON is a stop without search or ETA details.
+type stopJSON struct {
+	ID   int32   `json:"id"`
+	Name string  `json:"name"`
+	Lat  float64 `json:"lat"`
+	Lon  float64 `json:"lon"`
+}
+
+// placeJSON is the JSON representation of a saved place.
+type placeJSON struct {
+	ID        int32     `json:"id"`
+	Name      string    `json:"name"`
+	Lat       float64   `json:"lat"`
+	Lon       float64   `json:"lon"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// dashboardStopJSON is one element of the GetRiderDashboard response.
+type dashboardStopJSON struct {
+	stopJSON
+	ETA stopETAJSON `json:"eta"`
+}
+
+// ListFavorites handles GET /api/v1/me/favorites
+//
+// Returns the favorite stops and routes and the saved places of the device,
+// each in the order it was added. Stops and routes deactivated since they
+// were marked are left out.
+//
+// Header X-Device-ID identifies the rider's device (see requireDeviceID).
+//
+// Response 200:
+//
+//	{"stops":[{"id":1,"name":"Paradero Central","lat":-12.0464,"lon":-77.0282}],
+//	 "routes":[{"id":1,"name":"Ruta 1"}],
+//	 "places":[{"id":3,"name":"Casa","lat":-12.12,"lon":-77.03,
+//	            "created_at":"2025-03-10T08:10:00-05:00"}]}
+//
+// Response 400: missing header.
+// Response 500: storage error.
+func (h *Handler) ListFavorites(c *gin.Context) {
+	deviceID, ok := requireDeviceID(c)
+	if !ok {
+		return
+	}
+
+	favs, err := h.favoriteService.List(c.Request.Context(), deviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list favorites"})
+		return
+	}
+
+	stops := make([]stopJSON, len(favs.Stops))
+	for i, s := range favs.Stops {
+		stops[i] = toStopJSON(s)
+	}
+	routes := make([]stopRouteJSON, len(favs.Routes))
+	for i, r := range favs.Routes {
+		routes[i] = stopRouteJSON{ID: r.ID, Name: r.Name}
+	}
+	places := make([]placeJSON, len(favs.Places))
+	for i, p := range favs.Places {
+		places[i] = toPlaceJSON(p)
+	}
+	c.JSON(http.StatusOK, gin.H{"stops": stops, "routes": routes, "places": places})
+}
+
+// PutFavoriteStop handles PUT /api/v1/me/favorites/stops/:id
+//
+// Marks a stop as a favorite of the device. Marking it again is not an error
+// and keeps its place in the list. A device keeps up to 20 favorite stops.
+//
+// Header X-Device-ID identifies the rider's device.
+//
+// Response 204: the stop is a favorite.
+// Response 400: missing header or invalid id.
+// Response 404: the stop does not exist or is inactive.
+// Response 409: the device already has 20 favorite stops.
+// Response 500: storage error.
+func (h *Handler) PutFavoriteStop(c *gin.Context) {
+	h.putFavorite(c, "stop", h.favoriteService.AddStop)
+}
+
+// DeleteFavoriteStop handles DELETE /api/v1/me/favorites/stops/:id
+//
+// Response 204: removed.
+// Response 400: missing header or invalid id.
+// Response 404: the stop was not a favorite of the device.
+// Response 500: storage error.
+func (h *Handler) DeleteFavoriteStop(c *gin.Context) {
+	h.deleteFavorite(c, "stop", h.favoriteService.RemoveStop)
+}
+
+// PutFavoriteRoute handles PUT /api/v1/me/favorites/routes/:id
+//
+// Like PutFavoriteStop, for routes.
+func (h *Handler) PutFavoriteRoute(c *gin.Context) {
+	h.putFavorite(c, "route", h.favoriteService.AddRoute)
+}
+
+// DeleteFavoriteRoute handles DELETE /api/v1/me/favorites/routes/:id
+//
+// Like DeleteFavoriteStop, for routes.
+func (h *Handler) DeleteFavoriteRoute(c *gin.Context) {
+	h.deleteFavorite(c, "route", h.favoriteService.RemoveRoute)
+}
+
+// putFavorite marks the stop or route :id, by kind, with add.
+func (h *Handler) putFavorite(c *gin.Context, kind string, add func(ctx context.Context, deviceID string, id int32) (bool, error)) {
+	deviceID, ok := requireDeviceID(c)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	found, err := add(c.Request.Context(), deviceID, id)
+	switch {
+	case errors.Is(err, service.ErrTooManyFavorites):
+		c.JSON(http.StatusConflict, gin.H{"error": "at most 20 favorite " + kind + "s"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add favorite " + kind})
+	case !found:
+		c.JSON(http.StatusNotFound, gin.H{"error": kind + " not found"})
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// deleteFavorite unmarks the stop or route :id, by kind, with remove.
+func (h *Handler) deleteFavorite(c *gin.Context, kind string, remove func(ctx context.Context, deviceID string, id int32) (bool, error)) {
+	deviceID, ok := requireDeviceID(c)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	removed, err := remove(c.Request.Context(), deviceID, id)
+	switch {
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove favorite " + kind})
+	case !removed:
+		c.JSON(http.StatusNotFound, gin.H{"error": "favorite " + kind + " not found"})
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// CreateSavedPlace handles POST /api/v1/me/favorites/places
+//
+// Saves a named place of the device, such as home or work. A device keeps up
+// to 20 places, with distinct names.
+//
+// Header X-Device-ID identifies the rider's device.
+//
+// Body:
+//
+//	{"name":"Casa","lat":-12.12,"lon":-77.03}
+//
+// Response 201: the saved place.
+// Response 400: missing header, or invalid body: name of 1 to 50 characters
+// and lat and lon are required.
+// Response 409: the device has a place with that name, or already 20 places.
+// Response 500: storage error.
+func (h *Handler) CreateSavedPlace(c *gin.Context) {
+	deviceID, ok := requireDeviceID(c)
+	if !ok {
+		return
+	}
+	place, ok := bindPlace(c)
+	if !ok {
+		return
+	}
+	place.DeviceID = deviceID
+
+	created, err := h.favoriteService.CreatePlace(c.Request.Context(), place)
+	if !writePlaceError(c, err, "failed to save place") {
+		return
+	}
+	c.JSON(http.StatusCreated, toPlaceJSON(*created))
+}
+
+// UpdateSavedPlace handles PUT /api/v1/me/favorites/places/:id
+//
+// Replaces the name and location of a saved place. Same body as
+// CreateSavedPlace.
+//
+// Response 200: the saved place.
+// Response 400: missing header, invalid id or body.
+// Response 404: the device has no such place.
+// Response 409: another place of the device has that name.
+// Response 500: storage error.
+func (h *Handler) UpdateSavedPlace(c *gin.Context) {
+	deviceID, ok := requireDeviceID(c)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	place, ok := bindPlace(c)
+	if !ok {
+		return
+	}
+	place.ID, place.DeviceID = id, deviceID
+
+	updated, err := h.favoriteService.UpdatePlace(c.Request.Context(), place)
+	if !writePlaceError(c, err, "failed to update place") {
+		return
+	}
+	if updated == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "place not found"})
+		return
+	}
+	c.JSON(http.StatusOK, toPlaceJSON(*updated))
+}
+
+// DeleteSavedPlace handles DELETE /api/v1/me/favorites/places/:id
+//
+// Response 204: deleted.
+// Response 400: missing header or invalid id.
+// Response 404: the device has no such place.
+// Response 500: storage error.
+func (h *Handler) DeleteSavedPlace(c *gin.Context) {
+	deviceID, ok := requireDeviceID(c)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	deleted, err := h.favoriteService.DeletePlace(c.Request.Context(), deviceID, id)
+	switch {
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete place"})
+	case !deleted:
+		c.JSON(http.StatusNotFound, gin.H{"error": "place not found"})
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// GetRiderDashboard handles GET /api/v1/me/dashboard
+//
+// Returns each favorite stop of the device with its ETA, resolved in one
+// batch as in ListStopETAs: one cache read for every stop, and the misses
+// computed concurrently. A stop whose ETA fails does not fail the response;
+// its eta carries an error instead.
+//
+// Header X-Device-ID identifies the rider's device.
+//
+// Response 200:
+//
+//	{"stops":[{"id":1,"name":"Paradero Central","lat":-12.0464,"lon":-77.0282,
+//	           "eta":{"stop_id":1,"eta_seconds":181,"source":"cache","cache_age_s":42}},
+//	          {"id":5,"name":"Paradero Miraflores Centro","lat":-12.117,"lon":-77.03,
+//	           "eta":{"stop_id":5,"error":"eta unavailable"}}]}
+//
+// Response 400: missing header.
+// Response 500: storage error.
+func (h *Handler) GetRiderDashboard(c *gin.Context) {
+	deviceID, ok := requireDeviceID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	stops, err := h.favoriteService.Stops(ctx, deviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list favorite stops"})
+		return
+	}
+
+	ids := make([]int32, len(stops))
+	for i, s := range stops {
+		ids[i] = s.ID
+	}
+	etas := h.etaService.GetETAsForStops(ctx, ids)
+	occupancy := h.approachingOccupancy(ctx, ids)
+
+	out := make([]dashboardStopJSON, len(stops))
+	for i, s := range stops {
+		out[i] = dashboardStopJSON{stopJSON: toStopJSON(s), ETA: toStopETAJSON(etas[i], occupancy)}
+	}
+	c.JSON(http.StatusOK, gin.H{"stops": out})
+}
+
+// bindPlace reads the body of CreateSavedPlace and UpdateSavedPlace.
+// On failure it writes a 400 response and returns ok = false.
+func bindPlace(c *gin.Context) (storage.SavedPlace, bool) {
+	var req placeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Lat == nil || req.Lon == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name, lat and lon are required"})
+		return storage.SavedPlace{}, false
+	}
+	return storage.SavedPlace{Name: req.Name, Lat: *req.Lat, Lon: *req.Lon}, true
+}
+
+// writePlaceError writes the response for an error of CreatePlace or
+// UpdatePlace, and reports whether err was nil.
+func writePlaceError(c *gin.Context, err error, failure string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, service.ErrInvalidPlace):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must be 1-50 characters, lat between -90 and 90 and lon between -180 and 180"})
+	case errors.Is(err, service.ErrTooManyFavorites):
+		c.JSON(http.StatusConflict, gin.H{"error": "at most 20 saved places"})
+	case errors.Is(err, storage.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "a place with that name already exists"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+	}
+	return false
+}
+
+func toStopJSON(s storage.Stop) stopJSON {
+	return stopJSON{ID: s.ID, Name: s.Name, Lat: s.Lat, Lon: s.Lon}
+}
+
+func toPlaceJSON(p storage.SavedPlace) placeJSON {
+	return placeJSON{ID: p.ID, Name: p.Name, Lat: p.Lat, Lon: p.Lon, CreatedAt: p.CreatedAt}
+}
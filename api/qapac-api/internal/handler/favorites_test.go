@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/dom1nux/qapac-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// mockFavoritesRepo is an in-memory storage.FavoritesRepository keyed by
+// device. Stops 1, 3 and 5 and route 1 exist.
+type mockFavoritesRepo struct {
+	stops  map[string][]int32
+	routes map[string][]int32
+	places []storage.SavedPlace
+}
+
+func newMockFavoritesRepo() *mockFavoritesRepo {
+	return &mockFavoritesRepo{stops: map[string][]int32{}, routes: map[string][]int32{}}
+}
+
+func (m *mockFavoritesRepo) ListFavoriteStops(_ context.Context, deviceID string) ([]storage.Stop, error) {
+	var out []storage.Stop
+	for _, id := range m.stops[deviceID] {
+		out = append(out, storage.Stop{ID: id, Name: "Paradero", Lat: -12, Lon: -77})
+	}
+	return out, nil
+}
+
+func (m *mockFavoritesRepo) AddFavoriteStop(_ context.Context, deviceID string, stopID int32) (bool, error) {
+	if stopID != 1 && stopID != 3 && stopID != 5 {
+		return false, nil
+	}
+	if !slices.Contains(m.stops[deviceID], stopID) {
+		m.stops[deviceID] = append(m.stops[deviceID], stopID)
+	}
+	return true, nil
+}
+
+func (m *mockFavoritesRepo) RemoveFavoriteStop(_ context.Context, deviceID string, stopID int32) (bool, error) {
+	n := len(m.stops[deviceID])
+	m.stops[deviceID] = slices.DeleteFunc(m.stops[deviceID], func(id int32) bool { return id == stopID })
+	return len(m.stops[deviceID]) < n, nil
+}
+
+func (m *mockFavoritesRepo) ListFavoriteRoutes(_ context.Context, deviceID string) ([]storage.FavoriteRoute, error) {
+	var out []storage.FavoriteRoute
+	for _, id := range m.routes[deviceID] {
+		out = append(out, storage.FavoriteRoute{ID: id, Name: "Ruta"})
+	}
+	return out, nil
+}
+
+func (m *mockFavoritesRepo) AddFavoriteRoute(_ context.Context, deviceID string, routeID int32) (bool, error) {
+	if routeID != 1 {
+		return false, nil
+	}
+	if !slices.Contains(m.routes[deviceID], routeID) {
+		m.routes[deviceID] = append(m.routes[deviceID], routeID)
+	}
+	return true, nil
+}
+
+func (m *mockFavoritesRepo) RemoveFavoriteRoute(_ context.Context, deviceID string, routeID int32) (bool, error) {
+	n := len(m.routes[deviceID])
+	m.routes[deviceID] = slices.DeleteFunc(m.routes[deviceID], func(id int32) bool { return id == routeID })
+	return len(m.routes[deviceID]) < n, nil
+}
+
+func (m *mockFavoritesRepo) ListSavedPlaces(_ context.Context, deviceID string) ([]storage.SavedPlace, error) {
+	var out []storage.SavedPlace
+	for _, p := range m.places {
+		if p.DeviceID == deviceID {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockFavoritesRepo) CreateSavedPlace(_ context.Context, p storage.SavedPlace) (*storage.SavedPlace, error) {
+	for _, existing := range m.places {
+		if existing.DeviceID == p.DeviceID && existing.Name == p.Name {
+			return nil, storage.ErrConflict
+		}
+	}
+	p.ID = int32(len(m.places) + 1)
+	m.places = append(m.places, p)
+	return &p, nil
+}
+
+func (m *mockFavoritesRepo) UpdateSavedPlace(_ context.Context, p storage.SavedPlace) (*storage.SavedPlace, error) {
+	for i := range m.places {
+		if m.places[i].ID == p.ID && m.places[i].DeviceID == p.DeviceID {
+			m.places[i] = p
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockFavoritesRepo) DeleteSavedPlace(_ context.Context, deviceID string, id int32) (bool, error) {
+	n := len(m.places)
+	m.places = slices.DeleteFunc(m.places, func(p storage.SavedPlace) bool { return p.ID == id && p.DeviceID == deviceID })
+	return len(m.places) < n, nil
+}
+
+func newFavoritesRouter(repo *mockFavoritesRepo) *gin.Engine {
+	h := New(&mockStopsRepo{}, service.NewETAService(failingStopETAProvider{}, &mockETACacheStore{}), nil,
+		WithFavoriteService(service.NewFavoriteService(repo)))
+	r := gin.New()
+	r.GET("/api/v1/me/favorites", h.ListFavorites)
+	r.PUT("/api/v1/me/favorites/stops/:id", h.PutFavoriteStop)
+	r.DELETE("/api/v1/me/favorites/stops/:id", h.DeleteFavoriteStop)
+	r.PUT("/api/v1/me/favorites/routes/:id", h.PutFavoriteRoute)
+	r.DELETE("/api/v1/me/favorites/routes/:id", h.DeleteFavoriteRoute)
+	r.POST("/api/v1/me/favorites/places", h.CreateSavedPlace)
+	r.PUT("/api/v1/me/favorites/places/:id", h.UpdateSavedPlace)
+	r.DELETE("/api/v1/me/favorites/places/:id", h.DeleteSavedPlace)
+	r.GET("/api/v1/me/dashboard", h.GetRiderDashboard)
+	return r
+}
+
+func TestFavorites(t *testing.T) {
+	repo := newMockFavoritesRepo()
+	r := newFavoritesRouter(repo)
+
+	tests := []struct {
+		name, method, path, device, body string
+		want                             int
+	}{
+		{"missing device", http.MethodPut, "/api/v1/me/favorites/stops/1", "", "", http.StatusBadRequest},
+		{"invalid id", http.MethodPut, "/api/v1/me/favorites/stops/x", testDevice, "", http.StatusBadRequest},
+		{"unknown stop", http.MethodPut, "/api/v1/me/favorites/stops/9", testDevice, "", http.StatusNotFound},
+		{"add stop", http.MethodPut, "/api/v1/me/favorites/stops/1", testDevice, "", http.StatusNoContent},
+		{"add stop again", http.MethodPut, "/api/v1/me/favorites/stops/1", testDevice, "", http.StatusNoContent},
+		{"add stop 3", http.MethodPut, "/api/v1/me/favorites/stops/3", testDevice, "", http.StatusNoContent},
+		{"add route", http.MethodPut, "/api/v1/me/favorites/routes/1", testDevice, "", http.StatusNoContent},
+		{"remove unknown route", http.MethodDelete, "/api/v1/me/favorites/routes/2", testDevice, "", http.StatusNotFound},
+		{"place without coordinates", http.MethodPost, "/api/v1/me/favorites/places", testDevice, `{"name":"Casa"}`, http.StatusBadRequest},
+		{"place without name", http.MethodPost, "/api/v1/me/favorites/places", testDevice, `{"name":"","lat":-12.1,"lon":-77}`, http.StatusBadRequest},
+		{"create place", http.MethodPost, "/api/v1/me/favorites/places", testDevice, `{"name":"Casa","lat":-12.1,"lon":-77}`, http.StatusCreated},
+		{"repeated name", http.MethodPost, "/api/v1/me/favorites/places", testDevice, `{"name":"Casa","lat":-12.2,"lon":-77}`, http.StatusConflict},
+		{"update place", http.MethodPut, "/api/v1/me/favorites/places/1", testDevice, `{"name":"Casa","lat":-12.3,"lon":-77}`, http.StatusOK},
+		{"update place of another device", http.MethodPut, "/api/v1/me/favorites/places/1", "other-device-1", `{"name":"Casa","lat":-12.3,"lon":-77}`, http.StatusNotFound},
+		{"delete place of another device", http.MethodDelete, "/api/v1/me/favorites/places/1", "other-device-1", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := doDeviceJSON(r, tt.method, tt.path, tt.device, tt.body); w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+
+	w := doDeviceJSON(r, http.MethodGet, "/api/v1/me/favorites", testDevice, "")
+	var favs struct {
+		Stops  []stopJSON      `json:"stops"`
+		Routes []stopRouteJSON `json:"routes"`
+		Places []placeJSON     `json:"places"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &favs); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(favs.Stops) != 2 || len(favs.Routes) != 1 || len(favs.Places) != 1 || favs.Places[0].Lat != -12.3 {
+		t.Errorf("favorites = %+v, want 2 stops, 1 route and the updated place", favs)
+	}
+
+	w = doDeviceJSON(r, http.MethodGet, "/api/v1/me/favorites", "other-device-1", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &favs); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(favs.Stops) != 0 || len(favs.Routes) != 0 || len(favs.Places) != 0 {
+		t.Errorf("favorites of another device = %+v, want none", favs)
+	}
+}
+
+func TestGetRiderDashboard(t *testing.T) {
+	repo := newMockFavoritesRepo()
+	repo.stops[testDevice] = []int32{3, 1}
+	r := newFavoritesRouter(repo)
+
+	w := doDeviceJSON(r, http.MethodGet, "/api/v1/me/dashboard", testDevice, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Stops []dashboardStopJSON `json:"stops"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(body.Stops) != 2 {
+		t.Fatalf("stops = %+v, want 2", body.Stops)
+	}
+	// Stop 3 fails in failingStopETAProvider without failing the response.
+	if s := body.Stops[0]; s.ID != 3 || s.ETA.Error == "" || s.ETA.ETASeconds != nil {
+		t.Errorf("stop 3 = %+v, want an ETA error", s)
+	}
+	if s := body.Stops[1]; s.ID != 1 || s.ETA.ETASeconds == nil || *s.ETA.ETASeconds != 100 {
+		t.Errorf("stop 1 = %+v, want a 100 s ETA", s)
+	}
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dom1nux/qapac-api/internal/geocoding"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultGeocodeLimit = 5
+	maxGeocodeLimit     = 10
+
+	// maxGazetteerUpload caps the body of ImportGazetteer. District polygons
+	// for all of Lima fit comfortably.
+	maxGazetteerUpload = 5 << 20
+)
+
+// Geocode handles GET /api/v1/geocode
+//
+// Resolves a place name or address ("parque kennedy", "av arequipa 100") to
+// coordinates, looking in the local gazetteer first.
+//
+// Query params:
+//   - q     (required) string — 2 to 100 characters
+//   - limit (optional) int — default 5, max 10
+//
+// Response 200 (best match first; empty list when nothing matches):
+//
+//	{"places":[{"name":"Parque Kennedy","kind":"landmark","lat":-12.1219,"lon":-77.0297,"source":"gazetteer"}]}
+//
+// Response 400: missing or invalid query parameters.
+// Response 502: no geocoder could answer.
+func (h *Handler) Geocode(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if n := utf8.RuneCountInString(query); n < minSearchQueryLen || n > maxSearchQueryLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q must be between 2 and 100 characters"})
+		return
+	}
+
+	limit := defaultGeocodeLimit
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > maxGeocodeLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 10"})
+			return
+		}
+		limit = v
+	}
+
+	places, err := h.geocoder.Search(c.Request.Context(), query, limit)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "geocoding unavailable"})
+		return
+	}
+	if places == nil {
+		places = []geocoding.Place{}
+	}
+	c.JSON(http.StatusOK, gin.H{"places": places})
+}
+
+// ReverseGeocode handles GET /api/v1/geocode/reverse
+//
+// Describes a point: the nearest landmark, else its district, else the
+// provider's street address.
+//
+// Query params:
+//   - lat (required) float64
+//   - lon (required) float64
+//
+// Response 200:
+//
+//	{"name":"Parque Kennedy","kind":"landmark","lat":-12.1219,"lon":-77.0297,"source":"gazetteer"}
+//
+// Response 400: missing or invalid query parameters.
+// Response 404: no place describes the point.
+// Response 502: no geocoder could answer.
+func (h *Handler) ReverseGeocode(c *gin.Context) {
+	lat, ok := parseRequiredFloat(c, "lat")
+	if !ok {
+		return
+	}
+	lon, ok := parseRequiredFloat(c, "lon")
+	if !ok {
+		return
+	}
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lat/lon out of range"})
+		return
+	}
+
+	place, err := h.geocoder.Reverse(c.Request.Context(), lat, lon)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "geocoding unavailable"})
+		return
+	}
+	if place == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no place found"})
+		return
+	}
+	c.JSON(http.StatusOK, place)
+}
+
+// ImportGazetteer handles POST /api/v1/admin/gazetteer
+//
+// Loads landmarks and districts into the local gazetteer. Entries are upserted
+// by (name, kind); the whole file is rejected if any entry is invalid.
+//
+// Body (max 5 MB), by Content-Type:
+//   - text/csv: header name,kind,lat,lon
+//   - application/geo+json or application/json: FeatureCollection with a
+//     "name" property (and optional "kind") per feature
+//
+// Response 200:
+//
+//	{"imported":42}
+//
+// Response 400: malformed file.
+// Response 413: body too large.
+// Response 415: unsupported Content-Type.
+// Response 500: storage error.
+func (h *Handler) ImportGazetteer(c *gin.Context) {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+
+	var parse func(io.Reader) ([]geocoding.GazetteerEntry, error)
+	switch mediaType {
+	case "text/csv":
+		parse = geocoding.ParseGazetteerCSV
+	case "application/geo+json", "application/json":
+		parse = geocoding.ParseGazetteerGeoJSON
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be text/csv or application/geo+json"})
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxGazetteerUpload)
+	entries, err := parse(body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file exceeds 5 MB"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	n, err := h.gazetteer.Import(c.Request.Context(), entries)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to import gazetteer"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"imported": n})
+}
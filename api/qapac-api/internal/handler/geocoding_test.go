@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dom1nux/qapac-api/internal/geocoding"
+	"github.com/gin-gonic/gin"
+)
+
+// mockGeocoder knows one place; the query "fail" and lat 0 simulate provider
+// errors.
+type mockGeocoder struct{}
+
+var kennedy = geocoding.Place{Name: "Parque Kennedy", Kind: geocoding.KindLandmark, Lat: -12.1219, Lon: -77.0297, Source: "gazetteer"}
+
+func (mockGeocoder) Search(_ context.Context, query string, _ int) ([]geocoding.Place, error) {
+	switch query {
+	case "fail":
+		return nil, errors.New("provider down")
+	case "kennedy":
+		return []geocoding.Place{kennedy}, nil
+	}
+	return nil, nil
+}
+
+func (mockGeocoder) Reverse(_ context.Context, lat, _ float64) (*geocoding.Place, error) {
+	switch {
+	case lat == 0:
+		return nil, errors.New("provider down")
+	case lat < -12.12 && lat > -12.13:
+		return &kennedy, nil
+	}
+	return nil, nil
+}
+
+// mockImporter records imported entries.
+type mockImporter struct {
+	entries []geocoding.GazetteerEntry
+}
+
+func (m *mockImporter) Import(_ context.Context, entries []geocoding.GazetteerEntry) (int, error) {
+	m.entries = append(m.entries, entries...)
+	return len(entries), nil
+}
+
+func newGeocodingRouter(imp geocoding.Importer) *gin.Engine {
+	h := New(&mockStopsRepo{}, nil, nil, WithGeocoder(mockGeocoder{}), WithGazetteerImporter(imp))
+	r := gin.New()
+	r.GET("/api/v1/geocode", h.Geocode)
+	r.GET("/api/v1/geocode/reverse", h.ReverseGeocode)
+	r.POST("/api/v1/admin/gazetteer", h.ImportGazetteer)
+	return r
+}
+
+func TestGeocode(t *testing.T) {
+	r := newGeocodingRouter(&mockImporter{})
+
+	tests := []struct {
+		query     string
+		want      int
+		wantCount int
+	}{
+		{"?q=kennedy", http.StatusOK, 1},
+		{"?q=nowhere", http.StatusOK, 0},
+		{"?q=k", http.StatusBadRequest, 0},
+		{"?q=kennedy&limit=11", http.StatusBadRequest, 0},
+		{"?q=fail", http.StatusBadGateway, 0},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/geocode"+tt.query, nil))
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.query, w.Code, tt.want)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		var body struct {
+			Places []geocoding.Place `json:"places"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: unmarshal: %v", tt.query, err)
+		}
+		if body.Places == nil || len(body.Places) != tt.wantCount {
+			t.Errorf("%s: places = %v, want %d", tt.query, body.Places, tt.wantCount)
+		}
+	}
+}
+
+func TestReverseGeocode(t *testing.T) {
+	r := newGeocodingRouter(&mockImporter{})
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"?lat=-12.1219&lon=-77.0297", http.StatusOK},
+		{"?lat=-11.5&lon=-77.0", http.StatusNotFound},
+		{"?lat=-12.1", http.StatusBadRequest},
+		{"?lat=-95&lon=-77.0", http.StatusBadRequest},
+		{"?lat=0&lon=0", http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/geocode/reverse"+tt.query, nil))
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.query, w.Code, tt.want)
+		}
+	}
+}
+
+func TestImportGazetteer(t *testing.T) {
+	imp := &mockImporter{}
+	r := newGeocodingRouter(imp)
+
+	tests := []struct {
+		contentType, body string
+		want              int
+	}{
+		{"text/csv; charset=utf-8", "name,kind,lat,lon\nParque Kennedy,landmark,-12.1219,-77.0297\n", http.StatusOK},
+		{"application/geo+json", `{"type":"FeatureCollection","features":[{"properties":{"name":"Lince"},"geometry":{"type":"Point","coordinates":[-77.03,-12.08]}}]}`, http.StatusOK},
+		{"text/csv", "name,kind,lat,lon\nX,street,1,2\n", http.StatusBadRequest},
+		{"text/plain", "hello", http.StatusUnsupportedMediaType},
+		{"text/csv", "name,kind,lat,lon\n" + strings.Repeat("Parque,landmark,1,2\n", 300_000), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/gazetteer", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.contentType, w.Code, tt.want, w.Body.String())
+		}
+	}
+
+	if len(imp.entries) != 2 || imp.entries[1].Kind != geocoding.KindLandmark {
+		t.Errorf("entries = %+v, want 2 with Lince defaulted to landmark", imp.entries)
+	}
+
+	// A malformed geometry is rejected before the import, naming its feature.
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/gazetteer", strings.NewReader(`{"type":"FeatureCollection","features":[
+		{"properties":{"name":"Lince"},"geometry":{"type":"Point","coordinates":[-77.03,-12.08]}},
+		{"properties":{"name":"Jesús María"},"geometry":{"type":"Polygon","coordinates":[[[-77.04,-12.08],[-77.03,-12.08]]]}}]}`))
+	req.Header.Set("Content-Type", "application/geo+json")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "feature 1") {
+		t.Errorf("malformed polygon: status = %d (%s), want 400 naming feature 1", w.Code, w.Body.String())
+	}
+	if len(imp.entries) != 2 {
+		t.Errorf("entries = %d, want the malformed file not imported", len(imp.entries))
+	}
+}
@@ -1,6 +1,10 @@
 package handler
 
 import (
+	"github.com/dom1nux/qapac-api/internal/cache"
+	"github.com/dom1nux/qapac-api/internal/geocoding"
+	"github.com/dom1nux/qapac-api/internal/refresh"
+	"github.com/dom1nux/qapac-api/internal/routing"
 	"github.com/dom1nux/qapac-api/internal/service"
 	"github.com/dom1nux/qapac-api/internal/storage"
 )
@@ -9,9 +13,122 @@ import (
 // A single Handler is shared across all route groups; individual methods are
 // registered as gin handler functions.
 type Handler struct {
-	stopsRepo      storage.StopsRepository
-	etaService     *service.ETAService
-	routingService *service.RoutingService
+	stopsRepo        storage.StopsRepository
+	etaService       *service.ETAService
+	routingService   *service.RoutingService
+	headwayService   *service.HeadwayService
+	vehiclesRepo     storage.VehiclesRepository
+	fareService      *service.FareService
+	occupancyService *service.OccupancyService
+	positionService  *service.PositionService
+	tripService      *service.TripService
+	ratingService    *service.RatingService
+	favoriteService  *service.FavoriteService
+	geocoder         geocoding.Geocoder
+	gazetteer        geocoding.Importer
+	tileService      *service.TileService
+	bundleService    *service.BundleService
+	routingQuota     *routing.QuotaMeter
+	routeCache       *routing.CachedRouter
+	localCache       *cache.Store
+	cacheJanitor     *cache.Janitor
+	refreshPool      *refresh.Pool
+}
+
+// Option configures optional Handler dependencies. Handlers whose dependency
+// was not provided must not be registered.
+type Option func(*Handler)
+
+// WithHeadwayService provides the dependency of the headway analytics handlers.
+func WithHeadwayService(s *service.HeadwayService) Option {
+	return func(h *Handler) { h.headwayService = s }
+}
+
+// WithVehiclesRepository provides the dependency of the fleet registry handlers.
+func WithVehiclesRepository(r storage.VehiclesRepository) Option {
+	return func(h *Handler) { h.vehiclesRepo = r }
+}
+
+// WithFareService provides the dependency of the fare quote handler.
+func WithFareService(s *service.FareService) Option {
+	return func(h *Handler) { h.fareService = s }
+}
+
+// WithOccupancyService provides the dependency of the vehicle occupancy
+// handlers.
+func WithOccupancyService(s *service.OccupancyService) Option {
+	return func(h *Handler) { h.occupancyService = s }
+}
+
+// WithPositionService provides the dependency of the vehicle position
+// handler.
+func WithPositionService(s *service.PositionService) Option {
+	return func(h *Handler) { h.positionService = s }
+}
+
+// WithTripService provides the dependency of the rider trip history
+// handlers.
+func WithTripService(s *service.TripService) Option {
+	return func(h *Handler) { h.tripService = s }
+}
+
+// WithRatingService provides the dependency of the trip rating handlers.
+func WithRatingService(s *service.RatingService) Option {
+	return func(h *Handler) { h.ratingService = s }
+}
+
+// WithFavoriteService provides the dependency of the rider favorites and
+// dashboard handlers.
+func WithFavoriteService(s *service.FavoriteService) Option {
+	return func(h *Handler) { h.favoriteService = s }
+}
+
+// WithGeocoder provides the dependency of the place search handlers.
+func WithGeocoder(g geocoding.Geocoder) Option {
+	return func(h *Handler) { h.geocoder = g }
+}
+
+// WithGazetteerImporter provides the dependency of the gazetteer import
+// handler.
+func WithGazetteerImporter(i geocoding.Importer) Option {
+	return func(h *Handler) { h.gazetteer = i }
+}
+
+// WithTileService provides the dependency of the vector tile handler.
+func WithTileService(s *service.TileService) Option {
+	return func(h *Handler) { h.tileService = s }
+}
+
+// WithBundleService provides the dependency of the offline bundle handlers.
+func WithBundleService(s *service.BundleService) Option {
+	return func(h *Handler) { h.bundleService = s }
+}
+
+// WithRoutingQuota provides the dependency of the routing quota handler.
+func WithRoutingQuota(m *routing.QuotaMeter) Option {
+	return func(h *Handler) { h.routingQuota = m }
+}
+
+// WithRouteCache provides the route cache for the cache stats handler.
+func WithRouteCache(r *routing.CachedRouter) Option {
+	return func(h *Handler) { h.routeCache = r }
+}
+
+// WithLocalCache provides the in-memory cache tier for the cache stats
+// handler. Without it, the stats omit that tier.
+func WithLocalCache(s *cache.Store) Option {
+	return func(h *Handler) { h.localCache = s }
+}
+
+// WithRefreshPool provides the refresh pool of stale cache entries for the
+// cache stats handler.
+func WithRefreshPool(p *refresh.Pool) Option {
+	return func(h *Handler) { h.refreshPool = p }
+}
+
+// WithCacheJanitor provides the dependency of the cache janitor handler.
+func WithCacheJanitor(j *cache.Janitor) Option {
+	return func(h *Handler) { h.cacheJanitor = j }
 }
 
 // New creates a Handler with the given dependencies.
@@ -19,10 +136,15 @@ func New(
 	stopsRepo storage.StopsRepository,
 	etaService *service.ETAService,
 	routingService *service.RoutingService,
+	opts ...Option,
 ) *Handler {
-	return &Handler{
+	h := &Handler{
 		stopsRepo:      stopsRepo,
 		etaService:     etaService,
 		routingService: routingService,
 	}
+	for _, o := range opts {
+		o(h)
+	}
+	return h
 }
@@ -6,8 +6,11 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/dom1nux/qapac-api/internal/cache"
 	"github.com/dom1nux/qapac-api/internal/routing"
 	"github.com/dom1nux/qapac-api/internal/service"
 	"github.com/dom1nux/qapac-api/internal/storage"
@@ -24,20 +27,46 @@ func init() {
 // ---------------------------------------------------------------------------
 
 type mockStopsRepo struct {
-	findResult []storage.Stop
+	findResult []storage.NearbyStop
 	findErr    error
 	getResult  *storage.Stop
 	getErr     error
+	routes     map[int32][]storage.StopRoute
+	routesErr  error
+	bboxStops  []storage.Stop // ordered by ID
+	bboxGrid   float64        // last gridDeg passed to ListStopsInBBox
+	search     storage.StopSearch
+	matches    []storage.StopMatch
 }
 
-func (m *mockStopsRepo) FindStopsNear(_ context.Context, _, _, _ float64) ([]storage.Stop, error) {
+func (m *mockStopsRepo) FindStopsNear(_ context.Context, _, _, _ float64) ([]storage.NearbyStop, error) {
 	return m.findResult, m.findErr
 }
 
+func (m *mockStopsRepo) ListRoutesServingStops(_ context.Context, _ []int32) (map[int32][]storage.StopRoute, error) {
+	return m.routes, m.routesErr
+}
+
 func (m *mockStopsRepo) GetStop(_ context.Context, _ int32) (*storage.Stop, error) {
 	return m.getResult, m.getErr
 }
 
+func (m *mockStopsRepo) SearchStops(_ context.Context, q storage.StopSearch) ([]storage.StopMatch, error) {
+	m.search = q
+	return m.matches, nil
+}
+
+func (m *mockStopsRepo) ListStopsInBBox(_ context.Context, _ storage.BBox, gridDeg float64, afterID int32, limit int) ([]storage.Stop, error) {
+	m.bboxGrid = gridDeg
+	var out []storage.Stop
+	for _, s := range m.bboxStops {
+		if s.ID > afterID && len(out) < limit {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
 // mockETAProvider satisfies service.ETAProvider.
 type mockETAProvider struct {
 	seconds int
@@ -52,21 +81,42 @@ func (m *mockETAProvider) GetETA(_ context.Context, _ int32) (int, string, error
 // mockETACacheStore satisfies service.ETACacheStore; always misses.
 type mockETACacheStore struct{}
 
-func (m *mockETACacheStore) GetCachedETA(_ context.Context, _ int32) (int, bool, error) {
-	return 0, false, nil
+func (m *mockETACacheStore) GetCachedETA(_ context.Context, _ int32) (service.CachedETA, bool, error) {
+	return service.CachedETA{}, false, nil
+}
+
+func (m *mockETACacheStore) GetCachedETAs(_ context.Context, _ []int32) (map[int32]service.CachedETA, error) {
+	return nil, nil
 }
 
 func (m *mockETACacheStore) SetCachedETA(_ context.Context, _ int32, _ int) error {
 	return nil
 }
 
+// mockRouteCacheStore satisfies routing.CacheStore; always misses.
+type mockRouteCacheStore struct{}
+
+func (m *mockRouteCacheStore) GetCachedRoute(_ context.Context, _ string, _ int32, _ routing.TravelMode) (*routing.RoutingResponse, error) {
+	return nil, nil
+}
+
+func (m *mockRouteCacheStore) GetCachedRouteNear(_ context.Context, _ string, _ int32, _ routing.TravelMode) (*routing.RoutingResponse, error) {
+	return nil, nil
+}
+
+func (m *mockRouteCacheStore) SetCachedRoute(_ context.Context, _ string, _ int32, _ routing.TravelMode, _ *routing.RoutingResponse) error {
+	return nil
+}
+
 // mockRoutingService is a thin wrapper so we can control GetRouteTo responses.
 type mockRoutingServiceRouter struct {
-	resp *routing.RoutingResponse
-	err  error
+	resp    *routing.RoutingResponse
+	err     error
+	lastReq routing.RoutingRequest
 }
 
-func (m *mockRoutingServiceRouter) Route(_ context.Context, _ routing.RoutingRequest) (*routing.RoutingResponse, error) {
+func (m *mockRoutingServiceRouter) Route(_ context.Context, req routing.RoutingRequest) (*routing.RoutingResponse, error) {
+	m.lastReq = req
 	return m.resp, m.err
 }
 
@@ -173,7 +223,7 @@ func TestListStopsNear_StorageError(t *testing.T) {
 }
 
 func TestListStopsNear_EmptyResult(t *testing.T) {
-	repo := &mockStopsRepo{findResult: []storage.Stop{}}
+	repo := &mockStopsRepo{findResult: []storage.NearbyStop{}}
 	h := newTestHandler(repo, &mockETAProvider{}, &mockRoutingServiceRouter{}, &mockStopsRepo{})
 	r := newRouter(h)
 
@@ -194,9 +244,9 @@ func TestListStopsNear_EmptyResult(t *testing.T) {
 }
 
 func TestListStopsNear_Success(t *testing.T) {
-	stops := []storage.Stop{
-		{ID: 1, Name: "Paradero Centro", Lat: -12.05, Lon: -77.04},
-		{ID: 2, Name: "Paradero Norte", Lat: -12.03, Lon: -77.02},
+	stops := []storage.NearbyStop{
+		{Stop: storage.Stop{ID: 1, Name: "Paradero Centro", Lat: -12.05, Lon: -77.04}},
+		{Stop: storage.Stop{ID: 2, Name: "Paradero Norte", Lat: -12.03, Lon: -77.02}},
 	}
 	repo := &mockStopsRepo{findResult: stops}
 	h := newTestHandler(repo, &mockETAProvider{}, &mockRoutingServiceRouter{}, &mockStopsRepo{})
@@ -228,7 +278,7 @@ func TestListStopsNear_Success(t *testing.T) {
 
 func TestListStopsNear_DefaultRadius(t *testing.T) {
 	// Verify the handler accepts requests without a radius param (uses default 1000m).
-	repo := &mockStopsRepo{findResult: []storage.Stop{}}
+	repo := &mockStopsRepo{findResult: []storage.NearbyStop{}}
 	h := newTestHandler(repo, &mockETAProvider{}, &mockRoutingServiceRouter{}, &mockStopsRepo{})
 	r := newRouter(h)
 
@@ -241,6 +291,121 @@ func TestListStopsNear_DefaultRadius(t *testing.T) {
 	}
 }
 
+func TestListStopsNear_InvalidInclude(t *testing.T) {
+	repo := &mockStopsRepo{findResult: []storage.NearbyStop{}}
+	h := newTestHandler(repo, &mockETAProvider{}, &mockRoutingServiceRouter{}, &mockStopsRepo{})
+	r := newRouter(h)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/stops/nearby?lat=-12.05&lon=-77.04&include=distance,fares", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestListStopsNear_IncludeAll(t *testing.T) {
+	repo := &mockStopsRepo{
+		findResult: []storage.NearbyStop{
+			{Stop: storage.Stop{ID: 1, Name: "Paradero Centro"}, DistanceM: 120.4},
+			{Stop: storage.Stop{ID: 2, Name: "Paradero Norte"}, DistanceM: 850.6},
+		},
+		routes: map[int32][]storage.StopRoute{1: {{ID: 7, Name: "Ruta 7"}}},
+	}
+	h := newTestHandler(repo, &mockETAProvider{seconds: 240, source: "simple"}, &mockRoutingServiceRouter{}, &mockStopsRepo{})
+	r := newRouter(h)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/stops/nearby?lat=-12.05&lon=-77.04&include=distance,routes,eta", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var result []nearbyStopJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if len(result) != 2 {
+		t.Fatalf("expected 2 stops, got %d", len(result))
+	}
+	first, second := result[0], result[1]
+	if first.DistanceM == nil || *first.DistanceM != 120 || second.DistanceM == nil || *second.DistanceM != 851 {
+		t.Errorf("distances = %v, %v, want 120 and 851", first.DistanceM, second.DistanceM)
+	}
+	if first.Routes == nil || len(*first.Routes) != 1 || (*first.Routes)[0].ID != 7 {
+		t.Errorf("first stop routes = %v, want route 7", first.Routes)
+	}
+	if second.Routes == nil || len(*second.Routes) != 0 {
+		t.Errorf("second stop routes = %v, want an empty list", second.Routes)
+	}
+	if first.ETASeconds == nil || *first.ETASeconds != 240 {
+		t.Errorf("first stop eta = %v, want 240", first.ETASeconds)
+	}
+}
+
+// countingETAProvider returns 100 s for every stop and counts the calls.
+type countingETAProvider struct {
+	calls atomic.Int32
+}
+
+func (p *countingETAProvider) GetETA(_ context.Context, _ int32) (int, string, error) {
+	p.calls.Add(1)
+	return 100, "simple", nil
+}
+
+func TestListStopsNear_IncludeETA_OnlyNearestStops(t *testing.T) {
+	repo := &mockStopsRepo{}
+	for i := range maxBatchETAStops + 10 {
+		repo.findResult = append(repo.findResult, storage.NearbyStop{Stop: storage.Stop{ID: int32(i + 1)}, DistanceM: float64(i)})
+	}
+	provider := &countingETAProvider{}
+	h := newTestHandler(repo, provider, &mockRoutingServiceRouter{}, &mockStopsRepo{})
+	r := newRouter(h)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/stops/nearby?lat=-12.05&lon=-77.04&radius=50000&include=eta", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var result []nearbyStopJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if len(result) != maxBatchETAStops+10 {
+		t.Fatalf("got %d stops, want every stop in the radius", len(result))
+	}
+	if got := provider.calls.Load(); got != maxBatchETAStops {
+		t.Errorf("provider calls = %d, want %d", got, maxBatchETAStops)
+	}
+	if result[maxBatchETAStops-1].ETASeconds == nil || result[maxBatchETAStops].ETASeconds != nil {
+		t.Errorf("want ETAs for the nearest %d stops only", maxBatchETAStops)
+	}
+}
+
+func TestListStopsNear_NoIncludeOmitsExtras(t *testing.T) {
+	repo := &mockStopsRepo{findResult: []storage.NearbyStop{{Stop: storage.Stop{ID: 1}, DistanceM: 10}}}
+	h := newTestHandler(repo, &mockETAProvider{}, &mockRoutingServiceRouter{}, &mockStopsRepo{})
+	r := newRouter(h)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/stops/nearby?lat=-12.05&lon=-77.04", nil)
+	r.ServeHTTP(w, req)
+
+	var result []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	for _, key := range []string{"distance_m", "routes", "eta_seconds"} {
+		if _, ok := result[0][key]; ok {
+			t.Errorf("%s present without include", key)
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // GetStop tests
 // ---------------------------------------------------------------------------
@@ -325,6 +490,9 @@ func TestGetStop_Success(t *testing.T) {
 	if result["eta_seconds"].(float64) != 240 {
 		t.Errorf("eta_seconds = %v, want 240", result["eta_seconds"])
 	}
+	if _, ok := result["cache_age_s"]; ok {
+		t.Errorf("cache_age_s = %v, want it omitted for an ETA computed now", result["cache_age_s"])
+	}
 }
 
 func TestGetStop_ETAErrorNonFatal(t *testing.T) {
@@ -482,6 +650,121 @@ func TestGetRouteToStop_Success(t *testing.T) {
 	}
 }
 
+func TestGetRouteToStop_CacheAge(t *testing.T) {
+	stop := &storage.Stop{ID: 5, Name: "Centro", Lat: -12.05, Lon: -77.04}
+	routingRouter := &mockRoutingServiceRouter{resp: &routing.RoutingResponse{}}
+	h := newTestHandler(&mockStopsRepo{}, &mockETAProvider{}, routingRouter, &mockStopsRepo{getResult: stop})
+	r := newRouter(h)
+
+	get := func() map[string]any {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/routes/to-stop?lat=-12.05&lon=-77.04&stop_id=5", nil))
+		var result map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("unmarshal response: %v", err)
+		}
+		return result
+	}
+
+	if got, ok := get()["cache_age_s"]; ok {
+		t.Errorf("cache_age_s = %v on a route computed now, want absent", got)
+	}
+	routingRouter.resp = &routing.RoutingResponse{CachedAt: time.Now().Add(-150 * time.Second)}
+	if got := get()["cache_age_s"]; got != float64(150) {
+		t.Errorf("cache_age_s = %v, want 150", got)
+	}
+}
+
+func TestGetRouteToStop_Mode(t *testing.T) {
+	stop := &storage.Stop{ID: 5, Name: "Centro", Lat: -12.05, Lon: -77.04}
+	routingRouter := &mockRoutingServiceRouter{resp: &routing.RoutingResponse{}}
+	h := newTestHandler(&mockStopsRepo{}, &mockETAProvider{}, routingRouter, &mockStopsRepo{getResult: stop})
+	r := newRouter(h)
+
+	cases := []struct {
+		query      string
+		wantStatus int
+		wantMode   routing.TravelMode
+	}{
+		{"", http.StatusOK, routing.TravelModeWalk},
+		{"&mode=bicycle", http.StatusOK, routing.TravelModeBicycle},
+		{"&mode=drive", http.StatusOK, routing.TravelModeDrive},
+		{"&mode=car", http.StatusBadRequest, ""},
+	}
+	for _, tc := range cases {
+		routingRouter.lastReq = routing.RoutingRequest{}
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/routes/to-stop?lat=-12.05&lon=-77.04&stop_id=5"+tc.query, nil)
+		r.ServeHTTP(w, req)
+
+		if w.Code != tc.wantStatus {
+			t.Errorf("%q: status = %d, want %d", tc.query, w.Code, tc.wantStatus)
+		}
+		if routingRouter.lastReq.Mode != tc.wantMode {
+			t.Errorf("%q: mode = %q, want %q", tc.query, routingRouter.lastReq.Mode, tc.wantMode)
+		}
+	}
+}
+
+func TestGetRouteToStop_StepsAndAlternatives(t *testing.T) {
+	stop := &storage.Stop{ID: 5, Name: "Centro", Lat: -12.05, Lon: -77.04}
+	legs := []routing.Leg{{DistanceM: 800, DurationS: 420, Steps: []routing.Step{
+		{Instruction: "Gira a la derecha hacia Av. Tacna", DistanceM: 800, DurationS: 420, Maneuver: routing.ManeuverTurnRight, Polyline: "s1"},
+	}}}
+	routingRouter := &mockRoutingServiceRouter{resp: &routing.RoutingResponse{
+		Polyline:   "encodedPoly",
+		Legs:       legs,
+		Alternates: []routing.Route{{Polyline: "alt", DistanceM: 900, DurationS: 480, Legs: legs}},
+	}}
+	h := newTestHandler(&mockStopsRepo{}, &mockETAProvider{}, routingRouter, &mockStopsRepo{getResult: stop})
+	r := newRouter(h)
+
+	cases := []struct {
+		query                    string
+		wantLegs, wantAlternates bool
+		wantAlternateLegs        bool
+	}{
+		{"", false, false, false},
+		{"&steps=true", true, false, false},
+		{"&alternatives=true", false, true, false},
+		{"&steps=true&alternatives=true", true, true, true},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/routes/to-stop?lat=-12.05&lon=-77.04&stop_id=5"+tc.query, nil)
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: status = %d, want 200", tc.query, w.Code)
+		}
+		if routingRouter.lastReq.Steps != tc.wantLegs || routingRouter.lastReq.Alternatives != tc.wantAlternates {
+			t.Errorf("%q: request = %+v", tc.query, routingRouter.lastReq)
+		}
+
+		var result struct {
+			Legs       []routing.Leg   `json:"legs"`
+			Alternates []routing.Route `json:"alternates"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("unmarshal response: %v", err)
+		}
+		if got := result.Legs != nil; got != tc.wantLegs {
+			t.Errorf("%q: legs present = %v, want %v", tc.query, got, tc.wantLegs)
+		}
+		if got := result.Alternates != nil; got != tc.wantAlternates {
+			t.Errorf("%q: alternates present = %v, want %v", tc.query, got, tc.wantAlternates)
+		}
+		if tc.wantLegs && result.Legs[0].Steps[0].Maneuver != routing.ManeuverTurnRight {
+			t.Errorf("%q: step = %+v", tc.query, result.Legs[0].Steps[0])
+		}
+		if tc.wantAlternates {
+			if got := result.Alternates[0].Legs != nil; got != tc.wantAlternateLegs {
+				t.Errorf("%q: alternate legs present = %v, want %v", tc.query, got, tc.wantAlternateLegs)
+			}
+		}
+	}
+}
+
 func TestGetRouteToStop_FallbackExposed(t *testing.T) {
 	// When the router uses the straight-line fallback, is_fallback must be true in the response.
 	stop := &storage.Stop{ID: 5, Name: "Centro", Lat: -12.05, Lon: -77.04}
@@ -515,3 +798,172 @@ func TestGetRouteToStop_FallbackExposed(t *testing.T) {
 		t.Errorf("polyline = %q, want empty string for fallback", result["polyline"])
 	}
 }
+
+// ---------------------------------------------------------------------------
+// GetRoutingQuota tests
+// ---------------------------------------------------------------------------
+
+// mockUsageStore returns fixed usage counters.
+type mockUsageStore struct {
+	usage routing.Usage
+	err   error
+}
+
+func (m *mockUsageStore) IncrementUsage(_ context.Context, _ time.Time) (routing.Usage, error) {
+	return m.usage, m.err
+}
+
+func (m *mockUsageStore) GetUsage(_ context.Context, _ time.Time) (routing.Usage, error) {
+	return m.usage, m.err
+}
+
+func newQuotaRouter(store routing.UsageStore) *gin.Engine {
+	quota := routing.NewQuotaMeter(store, routing.QuotaCaps{SoftDaily: 10, HardDaily: 20}, 5)
+	h := New(&mockStopsRepo{}, nil, nil, WithRoutingQuota(quota))
+	r := gin.New()
+	r.GET("/api/v1/admin/routing/quota", h.GetRoutingQuota)
+	return r
+}
+
+func TestGetRoutingQuota_Success(t *testing.T) {
+	r := newQuotaRouter(&mockUsageStore{usage: routing.Usage{Day: 12, Month: 400}})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/routing/quota", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var result routing.QuotaReport
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if result.DayCalls != 12 || result.MonthCalls != 400 || result.Level != "soft" {
+		t.Errorf("report = %+v, want 12/400 at soft", result)
+	}
+	if result.MonthSpendUSD != 2 {
+		t.Errorf("month_spend_usd = %v, want 2", result.MonthSpendUSD)
+	}
+}
+
+func TestGetRoutingQuota_StoreError(t *testing.T) {
+	r := newQuotaRouter(&mockUsageStore{err: errors.New("db down")})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/routing/quota", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// GetCacheStats tests
+// ---------------------------------------------------------------------------
+
+func TestGetCacheStats(t *testing.T) {
+	routeCache := routing.NewCachedRouter(&mockRoutingServiceRouter{resp: &routing.RoutingResponse{}}, &mockRouteCacheStore{})
+	etaSvc := service.NewETAService(&mockETAProvider{seconds: 60}, &mockETACacheStore{})
+	h := New(&mockStopsRepo{}, etaSvc, nil, WithRouteCache(routeCache))
+	r := gin.New()
+	r.GET("/api/v1/admin/cache/stats", h.GetCacheStats)
+
+	if _, err := routeCache.Route(context.Background(), routing.RoutingRequest{}); err != nil {
+		t.Fatalf("Route: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/cache/stats", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var result struct {
+		Routes struct {
+			Coalescing routing.CoalesceStats `json:"coalescing"`
+		} `json:"routes"`
+		ETAs struct {
+			Coalescing service.CoalesceStats `json:"coalescing"`
+		} `json:"etas"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if got := result.Routes.Coalescing; got.Misses != 1 || got.Flights != 1 {
+		t.Errorf("routes coalescing = %+v, want 1 miss in 1 flight", got)
+	}
+	if got := result.ETAs.Coalescing; got.Misses != 0 {
+		t.Errorf("etas coalescing = %+v, want no misses", got)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// GetCacheJanitor tests
+// ---------------------------------------------------------------------------
+
+// mockJanitorStore satisfies cache.JanitorStore with a fixed last run.
+type mockJanitorStore struct {
+	last *cache.JanitorRun
+	err  error
+}
+
+func (m *mockJanitorStore) WithLock(ctx context.Context, fn func(ctx context.Context) error) (bool, error) {
+	return true, fn(ctx)
+}
+
+func (m *mockJanitorStore) PurgeExpired(_ context.Context, _ string, _ int) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockJanitorStore) SaveRun(_ context.Context, _ cache.JanitorRun) error { return nil }
+
+func (m *mockJanitorStore) LastRun(_ context.Context) (*cache.JanitorRun, error) {
+	return m.last, m.err
+}
+
+func (m *mockJanitorStore) TableStats(_ context.Context, tables []string) ([]cache.TableStats, error) {
+	out := make([]cache.TableStats, 0, len(tables))
+	for _, t := range tables {
+		out = append(out, cache.TableStats{Table: t, Rows: 10})
+	}
+	return out, nil
+}
+
+func TestGetCacheJanitor(t *testing.T) {
+	last := &cache.JanitorRun{Purged: map[string]int64{"stop_eta_cache": 42}}
+	janitor := cache.NewJanitor(&mockJanitorStore{last: last})
+	h := New(&mockStopsRepo{}, nil, nil, WithCacheJanitor(janitor))
+	r := gin.New()
+	r.GET("/api/v1/admin/cache/janitor", h.GetCacheJanitor)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/cache/janitor", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var result cache.JanitorStats
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if result.LastRun == nil || result.LastRun.Purged["stop_eta_cache"] != 42 {
+		t.Errorf("last_run = %+v, want 42 ETA rows purged", result.LastRun)
+	}
+	if len(result.Tables) != len(cache.JanitorTables) {
+		t.Errorf("tables = %+v, want one per cache table", result.Tables)
+	}
+}
+
+func TestGetCacheJanitor_StoreError_Returns500(t *testing.T) {
+	janitor := cache.NewJanitor(&mockJanitorStore{err: errors.New("db down")})
+	h := New(&mockStopsRepo{}, nil, nil, WithCacheJanitor(janitor))
+	r := gin.New()
+	r.GET("/api/v1/admin/cache/janitor", h.GetCacheJanitor)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/cache/janitor", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// maxHeadwayRangeDays caps the date range of the headway reports so a single
+// request cannot scan months of arrival events.
+const maxHeadwayRangeDays = 31
+
+// GetRouteHeadways handles GET /api/v1/admin/routes/:id/headways
+//
+// Path param:
+//   - id (required) int32 — route identifier
+//
+// Query params:
+//   - from        (optional) date YYYY-MM-DD — first day, local time; default today
+//   - to          (optional) date YYYY-MM-DD — last day (inclusive); default from
+//   - granularity (optional) "hourly" | "daily"; default "hourly"
+//
+// Response 200:
+//
+//	{"route_id":1,"scheduled_headway_s":600,"bunching_threshold_s":300,"granularity":"hourly",
+//	 "buckets":[{"start":"2025-03-10T07:00:00-05:00","headways":12,"mean_s":540.5,
+//	             "stddev_s":210.2,"cv":0.39,"min_s":45,"bunched":2}]}
+//
+// Response 400: invalid id, dates or granularity.
+// Response 500: storage error.
+func (h *Handler) GetRouteHeadways(c *gin.Context) {
+	routeID, ok := parseRouteID(c)
+	if !ok {
+		return
+	}
+	from, to, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	granularity := service.HeadwayGranularity(c.DefaultQuery("granularity", string(service.HeadwayHourly)))
+	if granularity != service.HeadwayHourly && granularity != service.HeadwayDaily {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "granularity must be hourly or daily"})
+		return
+	}
+
+	report, err := h.headwayService.Regularity(c.Request.Context(), routeID, from, to, granularity)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute headways"})
+		return
+	}
+
+	type bucketJSON struct {
+		Start    time.Time `json:"start"`
+		Headways int       `json:"headways"`
+		MeanS    float64   `json:"mean_s"`
+		StdDevS  float64   `json:"stddev_s"`
+		CV       float64   `json:"cv"`
+		MinS     int       `json:"min_s"`
+		Bunched  int       `json:"bunched"`
+	}
+	buckets := make([]bucketJSON, len(report.Buckets))
+	for i, b := range report.Buckets {
+		buckets[i] = bucketJSON{
+			Start:    b.Start,
+			Headways: b.Headways,
+			MeanS:    b.MeanS,
+			StdDevS:  b.StdDevS,
+			CV:       b.CV,
+			MinS:     b.MinS,
+			Bunched:  b.Bunched,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"route_id":             report.RouteID,
+		"scheduled_headway_s":  report.ScheduledS,
+		"bunching_threshold_s": report.BunchingThresholdS,
+		"granularity":          granularity,
+		"buckets":              buckets,
+	})
+}
+
+// ListRouteBunching handles GET /api/v1/admin/routes/:id/bunching
+//
+// Path param:
+//   - id (required) int32 — route identifier
+//
+// Query params:
+//   - from (optional) date YYYY-MM-DD — first day, local time; default today
+//   - to   (optional) date YYYY-MM-DD — last day (inclusive); default from
+//
+// Response 200:
+//
+//	{"route_id":1,"events":[{"stop_id":3,"leader_vehicle_id":7,"follower_vehicle_id":12,
+//	                         "arrived_at":"2025-03-10T07:42:10-05:00","headway_s":45}]}
+//
+// Response 400: invalid id or dates.
+// Response 500: storage error.
+func (h *Handler) ListRouteBunching(c *gin.Context) {
+	routeID, ok := parseRouteID(c)
+	if !ok {
+		return
+	}
+	from, to, ok := parseDateRange(c)
+	if !ok {
+		return
+	}
+
+	events, err := h.headwayService.Bunching(c.Request.Context(), routeID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute bunching"})
+		return
+	}
+
+	type eventJSON struct {
+		StopID            int32     `json:"stop_id"`
+		LeaderVehicleID   int32     `json:"leader_vehicle_id"`
+		FollowerVehicleID int32     `json:"follower_vehicle_id"`
+		ArrivedAt         time.Time `json:"arrived_at"`
+		HeadwayS          int       `json:"headway_s"`
+	}
+	out := make([]eventJSON, len(events))
+	for i, e := range events {
+		out[i] = eventJSON{
+			StopID:            e.StopID,
+			LeaderVehicleID:   e.LeaderVehicleID,
+			FollowerVehicleID: e.FollowerVehicleID,
+			ArrivedAt:         e.ArrivedAt,
+			HeadwayS:          e.HeadwayS,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"route_id": routeID, "events": out})
+}
+
+// parseRouteID extracts the :id path parameter as a positive route ID.
+// On failure it writes a 400 response and returns (0, false).
+func parseRouteID(c *gin.Context) (int32, bool) {
+	return parseIDParam(c, "id")
+}
+
+// parseDateRange reads the optional from/to query dates (YYYY-MM-DD, local
+// time, both inclusive) and returns the half-open range [from, to+1d).
+// On failure it writes a 400 response and returns ok = false.
+func parseDateRange(c *gin.Context) (from, to time.Time, ok bool) {
+	now := time.Now()
+	from = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if raw := c.Query("from"); raw != "" {
+		d, err := time.ParseInLocation(time.DateOnly, raw, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date in YYYY-MM-DD format"})
+			return time.Time{}, time.Time{}, false
+		}
+		from = d
+	}
+
+	last := from
+	if raw := c.Query("to"); raw != "" {
+		d, err := time.ParseInLocation(time.DateOnly, raw, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date in YYYY-MM-DD format"})
+			return time.Time{}, time.Time{}, false
+		}
+		last = d
+	}
+	if last.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from"})
+		return time.Time{}, time.Time{}, false
+	}
+
+	to = last.AddDate(0, 0, 1)
+	if to.After(from.AddDate(0, 0, maxHeadwayRangeDays)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date range must not exceed 31 days"})
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
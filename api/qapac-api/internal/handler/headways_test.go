@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/dom1nux/qapac-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// mockHeadwaysRepo satisfies storage.HeadwaysRepository and records the
+// requested range. approaching maps a stop to the vehicle expected next.
+type mockHeadwaysRepo struct {
+	arrivals    []storage.StopArrival
+	scheduledS  int
+	from, to    time.Time
+	approaching map[int32]int32
+}
+
+func (m *mockHeadwaysRepo) RecordStopArrival(_ context.Context, _ storage.StopArrival) error {
+	return nil
+}
+
+func (m *mockHeadwaysRepo) FindRouteStopNear(_ context.Context, _ int32, _, _, _ float64) (int32, bool, error) {
+	return 0, false, nil
+}
+
+func (m *mockHeadwaysRepo) ListStopArrivals(_ context.Context, _ int32, from, to time.Time) ([]storage.StopArrival, error) {
+	m.from, m.to = from, to
+	return m.arrivals, nil
+}
+
+func (m *mockHeadwaysRepo) ListApproachingVehicles(_ context.Context, _ []int32, _ time.Time) (map[int32]int32, error) {
+	return m.approaching, nil
+}
+
+func (m *mockHeadwaysRepo) GetScheduledHeadway(_ context.Context, _ int32) (int, bool, error) {
+	return m.scheduledS, m.scheduledS > 0, nil
+}
+
+func newHeadwaysRouter(repo storage.HeadwaysRepository) *gin.Engine {
+	h := New(&mockStopsRepo{}, nil, nil, WithHeadwayService(service.NewHeadwayService(repo)))
+	r := gin.New()
+	admin := r.Group("/api/v1/admin")
+	admin.GET("/routes/:id/headways", h.GetRouteHeadways)
+	admin.GET("/routes/:id/bunching", h.ListRouteBunching)
+	return r
+}
+
+func TestGetRouteHeadways_InvalidParams(t *testing.T) {
+	r := newHeadwaysRouter(&mockHeadwaysRepo{})
+
+	for _, path := range []string{
+		"/api/v1/admin/routes/abc/headways",
+		"/api/v1/admin/routes/0/headways",
+		"/api/v1/admin/routes/1/headways?from=10-03-2025",
+		"/api/v1/admin/routes/1/headways?from=2025-03-10&to=2025-03-09",
+		"/api/v1/admin/routes/1/headways?from=2025-01-01&to=2025-03-01",
+		"/api/v1/admin/routes/1/headways?granularity=weekly",
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", path, w.Code)
+		}
+	}
+}
+
+func TestGetRouteHeadways_Success(t *testing.T) {
+	base := time.Date(2025, 3, 10, 7, 0, 0, 0, time.Local)
+	repo := &mockHeadwaysRepo{
+		scheduledS: 600,
+		arrivals: []storage.StopArrival{
+			{RouteID: 1, StopID: 1, VehicleID: 1, ArrivedAt: base},
+			{RouteID: 1, StopID: 1, VehicleID: 2, ArrivedAt: base.Add(2 * time.Minute)},
+		},
+	}
+	r := newHeadwaysRouter(repo)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/routes/1/headways?from=2025-03-10&to=2025-03-11&granularity=daily", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if want := time.Date(2025, 3, 12, 0, 0, 0, 0, time.Local); !repo.to.Equal(want) {
+		t.Errorf("queried up to %v, want %v (to is inclusive)", repo.to, want)
+	}
+
+	var result struct {
+		ScheduledS int `json:"scheduled_headway_s"`
+		Buckets    []struct {
+			Headways int `json:"headways"`
+			Bunched  int `json:"bunched"`
+		} `json:"buckets"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if result.ScheduledS != 600 {
+		t.Errorf("scheduled_headway_s = %d, want 600", result.ScheduledS)
+	}
+	if len(result.Buckets) != 1 || result.Buckets[0].Bunched != 1 {
+		t.Errorf("buckets = %+v, want one bucket with one bunched headway", result.Buckets)
+	}
+}
+
+func TestListRouteBunching_Success(t *testing.T) {
+	base := time.Date(2025, 3, 10, 7, 0, 0, 0, time.Local)
+	repo := &mockHeadwaysRepo{
+		scheduledS: 600,
+		arrivals: []storage.StopArrival{
+			{RouteID: 1, StopID: 4, VehicleID: 1, ArrivedAt: base},
+			{RouteID: 1, StopID: 4, VehicleID: 2, ArrivedAt: base.Add(time.Minute)},
+		},
+	}
+	r := newHeadwaysRouter(repo)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/routes/1/bunching?from=2025-03-10", nil)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	var result struct {
+		Events []struct {
+			StopID            int32 `json:"stop_id"`
+			FollowerVehicleID int32 `json:"follower_vehicle_id"`
+			HeadwayS          int   `json:"headway_s"`
+		} `json:"events"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if len(result.Events) != 1 {
+		t.Fatalf("got %d events, want 1", len(result.Events))
+	}
+	if e := result.Events[0]; e.StopID != 4 || e.FollowerVehicleID != 2 || e.HeadwayS != 60 {
+		t.Errorf("event = %+v, want stop 4, follower vehicle 2, 60s", e)
+	}
+}
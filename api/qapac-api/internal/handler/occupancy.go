@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/dom1nux/qapac-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// occupancyRequest is the body of ReportVehicleOccupancy.
+type occupancyRequest struct {
+	OccupancyStatus string `json:"occupancy_status"`
+}
+
+// crewOccupancyRequest is the body of ReportCrewOccupancy.
+type crewOccupancyRequest struct {
+	OccupancyStatus string `json:"occupancy_status"`
+	Source          string `json:"source"`
+}
+
+// occupancyJSON is the JSON representation of an occupancy estimate.
+type occupancyJSON struct {
+	VehicleID       int32      `json:"vehicle_id"`
+	OccupancyStatus string     `json:"occupancy_status"`
+	Reports         int        `json:"reports"`
+	UpdatedAt       *time.Time `json:"updated_at"`
+}
+
+// ReportVehicleOccupancy handles POST /api/v1/vehicles/:id/occupancy
+//
+// Records a rider's crowding report for a vehicle.
+//
+// Body:
+//
+//	{"occupancy_status":"STANDING_ROOM_ONLY"}
+//
+// occupancy_status is a GTFS-Realtime OccupancyStatus name other than
+// NO_DATA_AVAILABLE. Each client (by IP) can report a given vehicle once
+// every two minutes.
+//
+// Response 204: report recorded.
+// Response 400: invalid id or body.
+// Response 404: vehicle not found.
+// Response 429: the client reported this vehicle too recently; Retry-After
+// carries the seconds to wait.
+// Response 500: storage error.
+func (h *Handler) ReportVehicleOccupancy(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	var req occupancyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	status, ok := parseReportedOccupancy(c, req.OccupancyStatus)
+	if !ok {
+		return
+	}
+
+	wait, err := h.occupancyService.ReportRider(c.Request.Context(), id, status, c.ClientIP())
+	if errors.Is(err, service.ErrOccupancyReportThrottled) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "occupancy already reported for this vehicle, try again later"})
+		return
+	}
+	if errors.Is(err, service.ErrUnknownVehicle) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "vehicle not found"})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidOccupancyReport) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid occupancy report"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record occupancy"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ReportCrewOccupancy handles POST /api/v1/admin/vehicles/:id/occupancy
+//
+// Records a crowding report by the driver or collector of a vehicle. Crew
+// reports weigh more than rider reports and are not throttled. Until drivers
+// sign in (MVP v2-B), the crew app reports through the operator's backend
+// with the admin token.
+//
+// Body:
+//
+//	{"occupancy_status":"FULL","source":"collector"}
+//
+// source is "driver" or "collector".
+//
+// Response 204: report recorded.
+// Response 400: invalid id or body.
+// Response 404: vehicle not found.
+// Response 500: storage error.
+func (h *Handler) ReportCrewOccupancy(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	var req crewOccupancyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	status, ok := parseReportedOccupancy(c, req.OccupancyStatus)
+	if !ok {
+		return
+	}
+	if req.Source != storage.OccupancySourceDriver && req.Source != storage.OccupancySourceCollector {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source must be driver or collector"})
+		return
+	}
+
+	err := h.occupancyService.Report(c.Request.Context(), id, status, req.Source)
+	if errors.Is(err, service.ErrUnknownVehicle) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "vehicle not found"})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidOccupancyReport) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid occupancy report"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record occupancy"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// parseReportedOccupancy parses the occupancy_status of a report, writing a
+// 400 response when it is not a status a report can carry.
+func parseReportedOccupancy(c *gin.Context, name string) (service.OccupancyStatus, bool) {
+	status, ok := service.ParseOccupancyStatus(name)
+	if !ok || status == service.OccupancyNoDataAvailable {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "occupancy_status must be a GTFS-Realtime OccupancyStatus other than NO_DATA_AVAILABLE"})
+		return 0, false
+	}
+	return status, true
+}
+
+// GetVehicleOccupancy handles GET /api/v1/vehicles/:id/occupancy
+//
+// Response 200:
+//
+//	{"vehicle_id":3,"occupancy_status":"STANDING_ROOM_ONLY","reports":4,
+//	 "updated_at":"2025-03-10T07:58:12-05:00"}
+//
+// occupancy_status is NO_DATA_AVAILABLE and updated_at is null when the
+// vehicle has no recent reports.
+//
+// Response 400: invalid id.
+// Response 500: storage error.
+func (h *Handler) GetVehicleOccupancy(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	estimates, err := h.occupancyService.Current(c.Request.Context(), []int32{id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get occupancy"})
+		return
+	}
+	c.JSON(http.StatusOK, toOccupancyJSON(id, estimates[id]))
+}
+
+// approachingOccupancy returns the occupancy of the vehicle expected next at
+// each stop in stopIDs, for the ETA responses. It is best effort: stops
+// without one, and every stop when the estimate fails, are absent.
+func (h *Handler) approachingOccupancy(ctx context.Context, stopIDs []int32) map[int32]*occupancyJSON {
+	if h.occupancyService == nil {
+		return nil
+	}
+	next, err := h.occupancyService.Approaching(ctx, stopIDs)
+	if err != nil {
+		return nil
+	}
+	out := make(map[int32]*occupancyJSON, len(next))
+	for stopID, a := range next {
+		occ := toOccupancyJSON(a.VehicleID, a.OccupancyEstimate)
+		out[stopID] = &occ
+	}
+	return out
+}
+
+func toOccupancyJSON(vehicleID int32, e service.OccupancyEstimate) occupancyJSON {
+	out := occupancyJSON{
+		VehicleID:       vehicleID,
+		OccupancyStatus: e.Status.String(),
+		Reports:         e.Reports,
+	}
+	if !e.UpdatedAt.IsZero() {
+		out.UpdatedAt = &e.UpdatedAt
+	}
+	return out
+}
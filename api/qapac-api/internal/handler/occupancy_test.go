@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/dom1nux/qapac-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// mockOccupancyRepo satisfies storage.OccupancyRepository; vehicle 99 does
+// not exist.
+type mockOccupancyRepo struct {
+	reports   []storage.OccupancyReport
+	recordErr error
+	listErr   error
+}
+
+func (m *mockOccupancyRepo) RecordOccupancyReport(_ context.Context, r storage.OccupancyReport) error {
+	if r.VehicleID == 99 {
+		return storage.ErrInvalidReference
+	}
+	if m.recordErr != nil {
+		return m.recordErr
+	}
+	m.reports = append(m.reports, r)
+	return nil
+}
+
+func (m *mockOccupancyRepo) ListOccupancyReportsSince(_ context.Context, _ []int32, _ time.Time) ([]storage.OccupancyReport, error) {
+	if m.listErr != nil {
+		return nil, m.listErr
+	}
+	return m.reports, nil
+}
+
+func newOccupancyRouter(repo storage.OccupancyRepository) *gin.Engine {
+	h := New(&mockStopsRepo{}, nil, nil, WithOccupancyService(service.NewOccupancyService(repo)))
+	r := gin.New()
+	// As in app.New without TRUSTED_PROXIES.
+	if err := r.SetTrustedProxies(nil); err != nil {
+		panic(err)
+	}
+	r.GET("/api/v1/vehicles/:id/occupancy", h.GetVehicleOccupancy)
+	r.POST("/api/v1/vehicles/:id/occupancy", h.ReportVehicleOccupancy)
+	r.POST("/api/v1/admin/vehicles/:id/occupancy", h.ReportCrewOccupancy)
+	return r
+}
+
+func TestReportVehicleOccupancy(t *testing.T) {
+	repo := &mockOccupancyRepo{}
+	r := newOccupancyRouter(repo)
+
+	tests := []struct {
+		path, body string
+		want       int
+	}{
+		{"/api/v1/vehicles/1/occupancy", `{"occupancy_status":"FULL"}`, http.StatusNoContent},
+		{"/api/v1/vehicles/abc/occupancy", `{"occupancy_status":"FULL"}`, http.StatusBadRequest},
+		{"/api/v1/vehicles/1/occupancy", `{"occupancy_status":"full"}`, http.StatusBadRequest},
+		{"/api/v1/vehicles/1/occupancy", `{"occupancy_status":"NO_DATA_AVAILABLE"}`, http.StatusBadRequest},
+		{"/api/v1/vehicles/1/occupancy", `not json`, http.StatusBadRequest},
+		{"/api/v1/vehicles/99/occupancy", `{"occupancy_status":"FULL"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s %s: status = %d, want %d", tt.path, tt.body, w.Code, tt.want)
+		}
+	}
+
+	if len(repo.reports) != 1 || repo.reports[0].Source != storage.OccupancySourceRider {
+		t.Errorf("reports = %+v, want one rider report", repo.reports)
+	}
+}
+
+func TestReportCrewOccupancy(t *testing.T) {
+	repo := &mockOccupancyRepo{}
+	r := newOccupancyRouter(repo)
+
+	tests := []struct {
+		path, body string
+		want       int
+	}{
+		{"/api/v1/admin/vehicles/1/occupancy", `{"occupancy_status":"FULL","source":"driver"}`, http.StatusNoContent},
+		// Crew reports are not throttled.
+		{"/api/v1/admin/vehicles/1/occupancy", `{"occupancy_status":"FULL","source":"collector"}`, http.StatusNoContent},
+		{"/api/v1/admin/vehicles/1/occupancy", `{"occupancy_status":"FULL","source":"rider"}`, http.StatusBadRequest},
+		{"/api/v1/admin/vehicles/1/occupancy", `{"occupancy_status":"FULL"}`, http.StatusBadRequest},
+		{"/api/v1/admin/vehicles/1/occupancy", `{"occupancy_status":"NO_DATA_AVAILABLE","source":"driver"}`, http.StatusBadRequest},
+		{"/api/v1/admin/vehicles/99/occupancy", `{"occupancy_status":"FULL","source":"driver"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s %s: status = %d, want %d", tt.path, tt.body, w.Code, tt.want)
+		}
+	}
+
+	if len(repo.reports) != 2 || repo.reports[0].Source != storage.OccupancySourceDriver || repo.reports[1].Source != storage.OccupancySourceCollector {
+		t.Errorf("reports = %+v, want a driver and a collector report", repo.reports)
+	}
+}
+
+func TestReportVehicleOccupancy_Throttled_Returns429(t *testing.T) {
+	repo := &mockOccupancyRepo{}
+	r := newOccupancyRouter(repo)
+
+	post := func(remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/vehicles/1/occupancy", strings.NewReader(`{"occupancy_status":"FULL"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		req.RemoteAddr = remoteAddr
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post("198.51.100.7:1234", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("first report: status = %d, want 204", w.Code)
+	}
+	w := post("198.51.100.7:4321", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "120" {
+		t.Errorf("repeat report: status = %d, Retry-After = %q; want 429 and 120", w.Code, w.Header().Get("Retry-After"))
+	}
+	// The peer is not a trusted proxy: a forged X-Forwarded-For is ignored.
+	if w := post("198.51.100.7:4321", "203.0.113.50"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("spoofed X-Forwarded-For: status = %d, want 429", w.Code)
+	}
+	if w := post("198.51.100.8:1234", ""); w.Code != http.StatusNoContent {
+		t.Errorf("other rider: status = %d, want 204", w.Code)
+	}
+	if len(repo.reports) != 2 {
+		t.Errorf("recorded %d reports, want 2", len(repo.reports))
+	}
+}
+
+func TestReportVehicleOccupancy_StorageError_Returns500(t *testing.T) {
+	r := newOccupancyRouter(&mockOccupancyRepo{recordErr: errors.New("connection refused")})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/vehicles/1/occupancy", strings.NewReader(`{"occupancy_status":"FULL"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+}
+
+func TestGetVehicleOccupancy(t *testing.T) {
+	repo := &mockOccupancyRepo{}
+	r := newOccupancyRouter(repo)
+
+	get := func() (int, occupancyJSON) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/vehicles/1/occupancy", nil))
+		var body occupancyJSON
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("unmarshal response: %v", err)
+			}
+		}
+		return w.Code, body
+	}
+
+	code, body := get()
+	if code != http.StatusOK || body.OccupancyStatus != "NO_DATA_AVAILABLE" || body.UpdatedAt != nil {
+		t.Errorf("without reports: %d %+v, want NO_DATA_AVAILABLE with null updated_at", code, body)
+	}
+
+	repo.reports = []storage.OccupancyReport{{
+		VehicleID: 1, Status: int(service.OccupancyStandingRoomOnly),
+		Source: storage.OccupancySourceRider, ReportedAt: time.Now(),
+	}}
+	code, body = get()
+	if code != http.StatusOK || body.OccupancyStatus != "STANDING_ROOM_ONLY" || body.Reports != 1 || body.UpdatedAt == nil {
+		t.Errorf("with a report: %d %+v, want STANDING_ROOM_ONLY from 1 report", code, body)
+	}
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// positionRequest is the body of ReportVehiclePosition.
+type positionRequest struct {
+	Lat        *float64   `json:"lat"`
+	Lon        *float64   `json:"lon"`
+	ReportedAt *time.Time `json:"reported_at"` // default now
+}
+
+// ReportVehiclePosition handles POST /api/v1/admin/vehicles/:id/positions
+//
+// Ingests a GPS position of a vehicle in service and feeds it to the
+// off-route detector and the stop arrival log. The route is the one of the
+// vehicle's assignment in effect at reported_at. Until drivers sign in (MVP
+// v2-B), the crew app or the operator's AVL system reports through the
+// operator's backend with the admin token.
+//
+// Body:
+//
+//	{"lat":-12.0464,"lon":-77.0428,"reported_at":"2025-03-10T07:58:12-05:00"}
+//
+// reported_at is optional and defaults to the time of the request.
+//
+// Response 204: position accepted.
+// Response 400: invalid id or body, or reported_at in the future.
+// Response 404: vehicle not found.
+// Response 409: the vehicle has no assignment at reported_at, or its driver
+// had not started that shift (or had already ended it).
+// Response 500: the position could not be processed.
+func (h *Handler) ReportVehiclePosition(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	var req positionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if req.Lat == nil || req.Lon == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lat and lon are required"})
+		return
+	}
+
+	pos := service.VehiclePosition{
+		VehicleID: id,
+		Lat:       *req.Lat,
+		Lon:       *req.Lon,
+	}
+	if req.ReportedAt != nil {
+		pos.ReportedAt = *req.ReportedAt
+	}
+
+	err := h.positionService.Ingest(c.Request.Context(), pos)
+	if errors.Is(err, service.ErrInvalidPosition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid position: lat, lon or reported_at out of range"})
+		return
+	}
+	if errors.Is(err, service.ErrUnknownVehicle) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "vehicle not found"})
+		return
+	}
+	if errors.Is(err, service.ErrNoActiveAssignment) {
+		c.JSON(http.StatusConflict, gin.H{"error": "vehicle has no active assignment"})
+		return
+	}
+	if errors.Is(err, service.ErrShiftNotInProgress) {
+		c.JSON(http.StatusConflict, gin.H{"error": "vehicle shift not started by its driver"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process position"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
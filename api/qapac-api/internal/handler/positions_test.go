@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/dom1nux/qapac-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// mockRoutesRepo places every position distM metres from every route shape.
+type mockRoutesRepo struct {
+	distM float64
+}
+
+func (m *mockRoutesRepo) GetRouteShape(_ context.Context, _ int32) (*storage.RouteShape, error) {
+	return nil, nil
+}
+
+func (m *mockRoutesRepo) DistanceToRouteShape(_ context.Context, _ int32, _, _ float64) (float64, bool, error) {
+	return m.distM, true, nil
+}
+
+// mockDeviationStore records opened incidents.
+type mockDeviationStore struct {
+	opened []service.DeviationIncident
+}
+
+func (m *mockDeviationStore) OpenDeviation(_ context.Context, inc service.DeviationIncident) (int32, error) {
+	m.opened = append(m.opened, inc)
+	return int32(len(m.opened)), nil
+}
+
+func (m *mockDeviationStore) CloseDeviation(_ context.Context, _ int32, _ time.Time, _ int) error {
+	return nil
+}
+
+func newPositionsRouter(vehicles storage.VehiclesRepository, store service.DeviationStore) *gin.Engine {
+	detector := service.NewOffRouteDetector(&mockRoutesRepo{distM: 400}, store, service.WithPersistenceWindow(0))
+	h := New(&mockStopsRepo{}, nil, nil, WithPositionService(service.NewPositionService(vehicles, detector)))
+	r := gin.New()
+	r.POST("/api/v1/admin/vehicles/:id/positions", h.ReportVehiclePosition)
+	return r
+}
+
+func TestReportVehiclePosition(t *testing.T) {
+	// Vehicle 1 is on a shift on route 3; vehicle 2 is unassigned; the shift
+	// of vehicle 3 has not been started.
+	vehicles := newMockVehiclesRepo(storage.Vehicle{ID: 1, Active: true}, storage.Vehicle{ID: 2, Active: true}, storage.Vehicle{ID: 3, Active: true})
+	planned := time.Now().Add(-time.Hour)
+	vehicles.assignments = []storage.VehicleAssignment{
+		{ID: 1, VehicleID: 1, RouteID: 3, StartsAt: planned, StartedAt: &planned},
+		{ID: 2, VehicleID: 3, RouteID: 3, StartsAt: planned},
+	}
+	store := &mockDeviationStore{}
+	r := newPositionsRouter(vehicles, store)
+
+	tests := []struct {
+		path, body string
+		want       int
+	}{
+		{"/api/v1/admin/vehicles/1/positions", `{"lat":-12.05,"lon":-77.04}`, http.StatusNoContent},
+		{"/api/v1/admin/vehicles/abc/positions", `{"lat":-12.05,"lon":-77.04}`, http.StatusBadRequest},
+		{"/api/v1/admin/vehicles/1/positions", `{"lat":-12.05}`, http.StatusBadRequest},
+		{"/api/v1/admin/vehicles/1/positions", `{"lat":-95,"lon":-77.04}`, http.StatusBadRequest},
+		{"/api/v1/admin/vehicles/1/positions", `{"lat":-12.05,"lon":-77.04,"reported_at":"2999-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"/api/v1/admin/vehicles/2/positions", `{"lat":-12.05,"lon":-77.04}`, http.StatusConflict},
+		{"/api/v1/admin/vehicles/3/positions", `{"lat":-12.05,"lon":-77.04}`, http.StatusConflict},
+		{"/api/v1/admin/vehicles/9/positions", `{"lat":-12.05,"lon":-77.04}`, http.StatusNotFound},
+		{"/api/v1/admin/vehicles/1/positions", `not json`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := doJSON(r, http.MethodPost, tt.path, tt.body)
+		if w.Code != tt.want {
+			t.Errorf("%s %s: status = %d, want %d", tt.path, tt.body, w.Code, tt.want)
+		}
+	}
+
+	if len(store.opened) != 1 || store.opened[0].VehicleID != 1 || store.opened[0].RouteID != 3 {
+		t.Errorf("opened = %+v, want one incident for vehicle 1 on route 3", store.opened)
+	}
+}
@@ -0,0 +1,272 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/dom1nux/qapac-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultRatingsLimit = 20
+	maxRatingsLimit     = 100
+)
+
+// ratingRequest is the body of RateRiderTrip.
+type ratingRequest struct {
+	Stars   int      `json:"stars"`
+	Comment string   `json:"comment"`
+	Tags    []string `json:"tags"`
+}
+
+// moderationRequest is the body of ModerateRating.
+type moderationRequest struct {
+	Status string `json:"status"`
+}
+
+// ratingJSON is the JSON representation of a trip rating.
+type ratingJSON struct {
+	ID          int32     `json:"id"`
+	TripID      int32     `json:"trip_id"`
+	RouteID     int32     `json:"route_id"`
+	VehicleID   *int32    `json:"vehicle_id"`
+	DriverID    *int32    `json:"driver_id"`
+	CollectorID *int32    `json:"collector_id"`
+	Stars       int       `json:"stars"`
+	Comment     string    `json:"comment"`
+	Tags        []string  `json:"tags"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// RateRiderTrip handles POST /api/v1/me/trips/:id/rating
+//
+// Rates a completed trip of the device. The rating is tied to the trip's
+// route and vehicle, and to the driver and collector of the shift the
+// vehicle was on when the trip was boarded. A trip is rated once.
+//
+// Header X-Device-ID identifies the rider's device (see requireDeviceID).
+//
+// Body:
+//
+//	{"stars":4,"comment":"Buen trato, pero corría mucho","tags":["courtesy","driving"]}
+//
+// comment (up to 500 characters) and tags are optional. Tags are driving,
+// cleanliness, courtesy and overcharging.
+//
+// Response 201: the rating.
+// Response 400: missing header, invalid id or body.
+// Response 404: the device has no such trip.
+// Response 409: the trip is not completed, or is already rated.
+// Response 500: storage error.
+func (h *Handler) RateRiderTrip(c *gin.Context) {
+	deviceID, ok := requireDeviceID(c)
+	if !ok {
+		return
+	}
+	tripID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	var req ratingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	rating, err := h.ratingService.Rate(c.Request.Context(), deviceID, tripID, storage.Rating{
+		Stars:   req.Stars,
+		Comment: req.Comment,
+		Tags:    req.Tags,
+	})
+	switch {
+	case errors.Is(err, service.ErrInvalidRating):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "stars must be between 1 and 5, comment at most 500 characters, and tags among driving, cleanliness, courtesy and overcharging"})
+		return
+	case errors.Is(err, service.ErrTripNotCompleted):
+		c.JSON(http.StatusConflict, gin.H{"error": "only completed trips can be rated"})
+		return
+	case errors.Is(err, storage.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "trip already rated"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to rate trip"})
+		return
+	case rating == nil:
+		c.JSON(http.StatusNotFound, gin.H{"error": "trip not found"})
+		return
+	}
+	c.JSON(http.StatusCreated, toRatingJSON(*rating))
+}
+
+// GetDriverRating handles GET /api/v1/drivers/:id/rating
+func (h *Handler) GetDriverRating(c *gin.Context) {
+	h.getRatingScore(c, storage.RatingSubjectDriver)
+}
+
+// GetCollectorRating handles GET /api/v1/collectors/:id/rating
+func (h *Handler) GetCollectorRating(c *gin.Context) {
+	h.getRatingScore(c, storage.RatingSubjectCollector)
+}
+
+// GetRouteRating handles GET /api/v1/routes/:id/rating
+func (h *Handler) GetRouteRating(c *gin.Context) {
+	h.getRatingScore(c, storage.RatingSubjectRoute)
+}
+
+// getRatingScore writes the score of the driver, collector or route :id.
+//
+// Response 200:
+//
+//	{"subject":"driver","id":5,"ratings":23,"average_stars":4.3,
+//	 "tags":{"courtesy":6,"driving":2}}
+//
+// average_stars is null, and tags empty, until there are 5 visible ratings.
+// A subject without ratings is not an error.
+//
+// Response 400: invalid id.
+// Response 500: storage error.
+func (h *Handler) getRatingScore(c *gin.Context, subject string) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	score, err := h.ratingService.Score(c.Request.Context(), subject, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get rating"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"subject":       subject,
+		"id":            id,
+		"ratings":       score.Ratings,
+		"average_stars": score.AverageStars,
+		"tags":          score.Tags,
+	})
+}
+
+// ListRatings handles GET /api/v1/admin/ratings
+//
+// Returns the ratings to moderate, most recent first, one page at a time.
+//
+// Query params:
+//   - status (optional) visible | hidden — default: every status
+//   - limit  (optional) int — page size; default 20, max 100
+//   - cursor (optional) next_cursor of the previous page
+//
+// Response 200:
+//
+//	{"ratings":[{"id":31,"trip_id":12,"route_id":1,"vehicle_id":7,"driver_id":5,
+//	             "collector_id":null,"stars":1,"comment":"...","tags":["overcharging"],
+//	             "status":"visible","created_at":"2025-03-10T08:10:00-05:00"}],
+//	 "next_cursor":"MzE"}
+//
+// next_cursor is null on the last page.
+//
+// Response 400: invalid query parameters.
+// Response 500: storage error.
+func (h *Handler) ListRatings(c *gin.Context) {
+	limit := defaultRatingsLimit
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > maxRatingsLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return
+		}
+		limit = v
+	}
+
+	var beforeID int32
+	if raw := c.Query("cursor"); raw != "" {
+		id, ok := decodeIDCursor(raw)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+		beforeID = id
+	}
+
+	// One extra row tells whether there is a next page.
+	ratings, err := h.ratingService.List(c.Request.Context(), c.Query("status"), beforeID, limit+1)
+	if errors.Is(err, service.ErrInvalidRating) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be visible or hidden"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list ratings"})
+		return
+	}
+
+	var nextCursor *string
+	if len(ratings) > limit {
+		ratings = ratings[:limit]
+		cur := encodeIDCursor(ratings[limit-1].ID)
+		nextCursor = &cur
+	}
+
+	out := make([]ratingJSON, len(ratings))
+	for i, r := range ratings {
+		out[i] = toRatingJSON(r)
+	}
+	c.JSON(http.StatusOK, gin.H{"ratings": out, "next_cursor": nextCursor})
+}
+
+// ModerateRating handles PATCH /api/v1/admin/ratings/:id
+//
+// Hides a rating from every score, or shows it again.
+//
+// Body:
+//
+//	{"status":"hidden"}
+//
+// Response 200: the rating.
+// Response 400: invalid id, or status is not visible or hidden.
+// Response 404: the rating does not exist.
+// Response 500: storage error.
+func (h *Handler) ModerateRating(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	var req moderationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	rating, err := h.ratingService.Moderate(c.Request.Context(), id, req.Status)
+	if errors.Is(err, service.ErrInvalidRating) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be visible or hidden"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to moderate rating"})
+		return
+	}
+	if rating == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rating not found"})
+		return
+	}
+	c.JSON(http.StatusOK, toRatingJSON(*rating))
+}
+
+func toRatingJSON(r storage.Rating) ratingJSON {
+	return ratingJSON{
+		ID:          r.ID,
+		TripID:      r.TripID,
+		RouteID:     r.RouteID,
+		VehicleID:   r.VehicleID,
+		DriverID:    r.DriverID,
+		CollectorID: r.CollectorID,
+		Stars:       r.Stars,
+		Comment:     r.Comment,
+		Tags:        r.Tags,
+		Status:      r.Status,
+		CreatedAt:   r.CreatedAt,
+	}
+}
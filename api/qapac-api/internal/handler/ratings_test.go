@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/dom1nux/qapac-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// mockRatingsRepo is an in-memory storage.RatingsRepository; aggregates
+// count the visible ratings of a driver.
+type mockRatingsRepo struct {
+	ratings []storage.Rating
+}
+
+func (m *mockRatingsRepo) CreateRating(_ context.Context, r storage.Rating) (*storage.Rating, error) {
+	for _, existing := range m.ratings {
+		if existing.TripID == r.TripID {
+			return nil, storage.ErrConflict
+		}
+	}
+	r.ID = int32(len(m.ratings) + 1)
+	r.Status = storage.RatingVisible
+	m.ratings = append(m.ratings, r)
+	return &r, nil
+}
+
+func (m *mockRatingsRepo) ListRatings(_ context.Context, status string, beforeID int32, limit int) ([]storage.Rating, error) {
+	var out []storage.Rating
+	for i := len(m.ratings) - 1; i >= 0 && len(out) < limit; i-- {
+		r := m.ratings[i]
+		if (status == "" || r.Status == status) && (beforeID == 0 || r.ID < beforeID) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockRatingsRepo) SetRatingStatus(_ context.Context, id int32, status string) (*storage.Rating, error) {
+	for i := range m.ratings {
+		if m.ratings[i].ID == id {
+			m.ratings[i].Status = status
+			return &m.ratings[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockRatingsRepo) GetRatingAggregate(_ context.Context, _ string, id int32) (*storage.RatingAggregate, error) {
+	agg := &storage.RatingAggregate{Tags: map[string]int{}}
+	sum := 0
+	for _, r := range m.ratings {
+		if r.Status == storage.RatingVisible && r.DriverID != nil && *r.DriverID == id {
+			agg.Ratings++
+			sum += r.Stars
+			for _, tag := range r.Tags {
+				agg.Tags[tag]++
+			}
+		}
+	}
+	if agg.Ratings > 0 {
+		agg.AverageStars = float64(sum) / float64(agg.Ratings)
+	}
+	return agg, nil
+}
+
+// newRatingsRouter rates the trips of trips. Vehicle 7 is on a shift of
+// route 1 driven by driver 5.
+func newRatingsRouter(trips *mockTripsRepo, ratings *mockRatingsRepo) *gin.Engine {
+	started := time.Now().Add(-3 * time.Hour)
+	vehicles := newMockVehiclesRepo(storage.Vehicle{ID: 7, Active: true})
+	driver := int32(5)
+	vehicles.assignments = []storage.VehicleAssignment{
+		{ID: 1, VehicleID: 7, RouteID: 1, DriverID: &driver, StartsAt: started, StartedAt: &started},
+	}
+	h := New(&mockStopsRepo{}, nil, nil, WithRatingService(service.NewRatingService(ratings, trips, vehicles)))
+	r := gin.New()
+	r.POST("/api/v1/me/trips/:id/rating", h.RateRiderTrip)
+	r.GET("/api/v1/drivers/:id/rating", h.GetDriverRating)
+	r.GET("/api/v1/admin/ratings", h.ListRatings)
+	r.PATCH("/api/v1/admin/ratings/:id", h.ModerateRating)
+	return r
+}
+
+func TestRateRiderTrip(t *testing.T) {
+	vehicle := int32(7)
+	stop := int32(2)
+	boarded := time.Now().Add(-time.Hour)
+	alighted := boarded.Add(20 * time.Minute)
+	trips := &mockTripsRepo{trips: []storage.RiderTrip{
+		{ID: 1, DeviceID: testDevice, RouteID: 1, VehicleID: &vehicle, BoardingStopID: 1, AlightingStopID: &stop, BoardedAt: boarded, AlightedAt: &alighted},
+		{ID: 2, DeviceID: testDevice, RouteID: 1, BoardingStopID: 1, BoardedAt: time.Now()},
+	}}
+	ratings := &mockRatingsRepo{}
+	r := newRatingsRouter(trips, ratings)
+
+	tests := []struct {
+		name, device, path, body string
+		want                     int
+	}{
+		{"missing device", "", "/api/v1/me/trips/1/rating", `{"stars":4}`, http.StatusBadRequest},
+		{"other device", "other-device-1", "/api/v1/me/trips/1/rating", `{"stars":4}`, http.StatusNotFound},
+		{"invalid id", testDevice, "/api/v1/me/trips/x/rating", `{"stars":4}`, http.StatusBadRequest},
+		{"no stars", testDevice, "/api/v1/me/trips/1/rating", `{"comment":"ok"}`, http.StatusBadRequest},
+		{"unknown tag", testDevice, "/api/v1/me/trips/1/rating", `{"stars":4,"tags":["music"]}`, http.StatusBadRequest},
+		{"not json", testDevice, "/api/v1/me/trips/1/rating", `nope`, http.StatusBadRequest},
+		{"trip in progress", testDevice, "/api/v1/me/trips/2/rating", `{"stars":4}`, http.StatusConflict},
+		{"rated", testDevice, "/api/v1/me/trips/1/rating", `{"stars":2,"tags":["driving","overcharging"]}`, http.StatusCreated},
+		{"already rated", testDevice, "/api/v1/me/trips/1/rating", `{"stars":5}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		w := doDeviceJSON(r, http.MethodPost, tt.path, tt.device, tt.body)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+
+	if len(ratings.ratings) != 1 || ratings.ratings[0].DriverID == nil || *ratings.ratings[0].DriverID != 5 {
+		t.Errorf("ratings = %+v, want one rating of driver 5", ratings.ratings)
+	}
+}
+
+func TestGetDriverRating_HidesAverageUntilEnoughRatings(t *testing.T) {
+	driver := int32(5)
+	ratings := &mockRatingsRepo{}
+	for i := range 5 {
+		ratings.ratings = append(ratings.ratings, storage.Rating{
+			ID: int32(i + 1), TripID: int32(i + 1), DriverID: &driver, Stars: 4,
+			Tags: []string{"courtesy"}, Status: storage.RatingVisible,
+		})
+	}
+	r := newRatingsRouter(&mockTripsRepo{}, ratings)
+
+	score := func() (n int, avg *float64) {
+		w := doJSON(r, http.MethodGet, "/api/v1/drivers/5/rating", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+		}
+		var body struct {
+			Ratings      int      `json:"ratings"`
+			AverageStars *float64 `json:"average_stars"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return body.Ratings, body.AverageStars
+	}
+
+	if n, avg := score(); n != 5 || avg == nil || *avg != 4 {
+		t.Errorf("score = %d ratings, average %v; want 5 ratings averaging 4", n, avg)
+	}
+
+	// Hiding one leaves too few ratings to publish an average.
+	if w := doJSON(r, http.MethodPatch, "/api/v1/admin/ratings/3", `{"status":"hidden"}`); w.Code != http.StatusOK {
+		t.Fatalf("moderate: status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if n, avg := score(); n != 4 || avg != nil {
+		t.Errorf("score = %d ratings, average %v; want 4 ratings and no average", n, avg)
+	}
+}
+
+func TestListAndModerateRatings(t *testing.T) {
+	ratings := &mockRatingsRepo{}
+	for i := range 3 {
+		ratings.ratings = append(ratings.ratings, storage.Rating{ID: int32(i + 1), TripID: int32(i + 1), Stars: 3, Status: storage.RatingVisible})
+	}
+	r := newRatingsRouter(&mockTripsRepo{}, ratings)
+
+	w := doJSON(r, http.MethodGet, "/api/v1/admin/ratings?limit=2", "")
+	var page struct {
+		Ratings    []ratingJSON `json:"ratings"`
+		NextCursor *string      `json:"next_cursor"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(page.Ratings) != 2 || page.Ratings[0].ID != 3 || page.NextCursor == nil {
+		t.Fatalf("first page = %+v, want ratings 3 and 2 and a cursor", page)
+	}
+	w = doJSON(r, http.MethodGet, "/api/v1/admin/ratings?limit=2&cursor="+*page.NextCursor, "")
+	page.NextCursor = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(page.Ratings) != 1 || page.Ratings[0].ID != 1 || page.NextCursor != nil {
+		t.Errorf("last page = %+v, want rating 1 and no cursor", page)
+	}
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodGet, "/api/v1/admin/ratings?status=deleted", "", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/admin/ratings?limit=0", "", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/admin/ratings?cursor=bm9wZQ", "", http.StatusBadRequest},
+		{http.MethodPatch, "/api/v1/admin/ratings/2", `{"status":"deleted"}`, http.StatusBadRequest},
+		{http.MethodPatch, "/api/v1/admin/ratings/9", `{"status":"hidden"}`, http.StatusNotFound},
+		{http.MethodPatch, "/api/v1/admin/ratings/2", `{"status":"hidden"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := doJSON(r, tt.method, tt.path, tt.body); w.Code != tt.want {
+			t.Errorf("%s %s: status = %d, want %d: %s", tt.method, tt.path, w.Code, tt.want, w.Body.String())
+		}
+	}
+
+	w = doJSON(r, http.MethodGet, "/api/v1/admin/ratings?status=hidden", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(page.Ratings) != 1 || page.Ratings[0].ID != 2 {
+		t.Errorf("hidden ratings = %+v, want rating 2", page.Ratings)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/dom1nux/qapac-api/internal/routing"
 	"github.com/dom1nux/qapac-api/internal/service"
 	"github.com/gin-gonic/gin"
 )
@@ -15,10 +17,20 @@ import (
 //   - lat     (required) float64 — user's WGS-84 latitude
 //   - lon     (required) float64 — user's WGS-84 longitude
 //   - stop_id (required) int32   — destination stop identifier
+//   - mode         (optional) string — walk (default), drive or bicycle
+//   - steps        (optional) bool   — "true" adds turn-by-turn legs
+//   - alternatives (optional) bool   — "true" adds alternate routes
 //
 // Response 200:
 //
-//	{"polyline":"...","distance_m":500,"duration_s":600,"is_fallback":false}
+//	{"polyline":"...","distance_m":500,"duration_s":600,"is_fallback":false,"provider":"google"}
+//
+// provider names the engine that answered: google, osrm, valhalla or
+// straight_line (is_fallback true). A route served from the cache adds
+// "cache_age_s", the seconds since it was computed. With steps=true the
+// response adds "legs"
+// (see routing.Leg); with alternatives=true it adds "alternates" (see
+// routing.Route), with their legs when steps=true.
 //
 // Response 400: missing or invalid query parameters.
 // Response 404: stop does not exist.
@@ -46,7 +58,19 @@ func (h *Handler) GetRouteToStop(c *gin.Context) {
 	}
 	stopID := int32(stopID64)
 
-	resp, err := h.routingService.GetRouteTo(c.Request.Context(), lat, lon, stopID)
+	mode, err := routing.ParseTravelMode(c.Query("mode"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be walk, drive or bicycle"})
+		return
+	}
+
+	opts := service.RouteOptions{
+		Mode:         mode,
+		Steps:        c.Query("steps") == "true",
+		Alternatives: c.Query("alternatives") == "true",
+	}
+
+	resp, err := h.routingService.GetRouteTo(c.Request.Context(), lat, lon, stopID, opts)
 	if err != nil {
 		if errors.Is(err, service.ErrStopNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "stop not found"})
@@ -56,10 +80,55 @@ func (h *Handler) GetRouteToStop(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	body := gin.H{
 		"polyline":    resp.Polyline,
 		"distance_m":  resp.DistanceM,
 		"duration_s":  resp.DurationS,
 		"is_fallback": resp.IsFallback,
-	})
+		"provider":    resp.Provider,
+	}
+	if !resp.CachedAt.IsZero() {
+		body["cache_age_s"] = int(time.Since(resp.CachedAt) / time.Second)
+	}
+	// A cached route may carry more than was asked for: only return what was.
+	if opts.Steps {
+		legs := resp.Legs
+		if legs == nil {
+			legs = []routing.Leg{} // the straight-line estimate has no steps
+		}
+		body["legs"] = legs
+	}
+	if opts.Alternatives {
+		alternates := make([]routing.Route, 0, len(resp.Alternates))
+		for _, alt := range resp.Alternates {
+			if !opts.Steps {
+				alt.Legs = nil
+			}
+			alternates = append(alternates, alt)
+		}
+		body["alternates"] = alternates
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// GetRoutingQuota handles GET /api/v1/admin/routing/quota
+//
+// Reports the Google Routes API usage of today and the month, the caps and
+// the spend projected for the month from its daily average so far.
+//
+// Response 200:
+//
+//	{"day":"2026-10-18","day_calls":812,"month_calls":14230,"level":"normal",
+//	 "caps":{"soft_daily":1500,"hard_daily":2000,"soft_monthly":0,"hard_monthly":40000},
+//	 "price_per_1000_usd":5,"month_spend_usd":71.15,
+//	 "projected_month_calls":24507,"projected_month_spend_usd":122.53}
+//
+// Response 500: storage error.
+func (h *Handler) GetRoutingQuota(c *gin.Context) {
+	report, err := h.routingQuota.Report(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read routing quota"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
 }
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// crewJSON is the response of GetVehicleCrew.
+type crewJSON struct {
+	VehicleID      int32     `json:"vehicle_id"`
+	RouteID        int32     `json:"route_id"`
+	DriverID       *int32    `json:"driver_id"`
+	CollectorID    *int32    `json:"collector_id"`
+	ShiftStartedAt time.Time `json:"shift_started_at"`
+}
+
+// StartDriverShift handles POST /api/v1/admin/drivers/:id/shifts/start
+//
+// Starts the shift of a driver: the assignment naming the driver as
+// driver_id that is in effect now. Until drivers sign in (MVP v2-B), the
+// driver app starts and ends shifts through the operator's backend with the
+// admin token.
+//
+// Response 200: the started assignment.
+// Response 400: invalid id.
+// Response 409: the driver has no assignment in effect now, it was already
+// started, or the driver has another shift in progress.
+// Response 500: storage error.
+func (h *Handler) StartDriverShift(c *gin.Context) {
+	driverID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	a, err := h.vehiclesRepo.StartShift(c.Request.Context(), driverID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start shift"})
+		return
+	}
+	if a == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "driver has no planned shift to start now, or already has one in progress"})
+		return
+	}
+	c.JSON(http.StatusOK, toAssignmentJSON(*a))
+}
+
+// EndDriverShift handles POST /api/v1/admin/drivers/:id/shifts/end
+//
+// Ends the shift in progress of a driver. Positions of the vehicle are
+// rejected from then on.
+//
+// Response 200: the ended assignment.
+// Response 400: invalid id.
+// Response 409: the driver has no shift in progress.
+// Response 500: storage error.
+func (h *Handler) EndDriverShift(c *gin.Context) {
+	driverID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	a, err := h.vehiclesRepo.EndShift(c.Request.Context(), driverID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to end shift"})
+		return
+	}
+	if a == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "driver has no shift in progress"})
+		return
+	}
+	c.JSON(http.StatusOK, toAssignmentJSON(*a))
+}
+
+// GetVehicleCrew handles GET /api/v1/vehicles/:id/crew
+//
+// Response 200:
+//
+//	{"vehicle_id":1,"route_id":2,"driver_id":5,"collector_id":null,
+//	 "shift_started_at":"2025-03-10T05:02:10-05:00"}
+//
+// Only IDs are returned until the users table exists (MVP v2-B).
+//
+// Response 400: invalid id.
+// Response 404: the vehicle does not exist or has no shift in progress.
+// Response 500: storage error.
+func (h *Handler) GetVehicleCrew(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	a, err := h.vehiclesRepo.GetActiveAssignment(c.Request.Context(), id, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get crew"})
+		return
+	}
+	if a == nil || !a.InProgress(now) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "vehicle has no shift in progress"})
+		return
+	}
+	c.JSON(http.StatusOK, toCrewJSON(*a))
+}
+
+func toCrewJSON(a storage.VehicleAssignment) crewJSON {
+	return crewJSON{
+		VehicleID:      a.VehicleID,
+		RouteID:        a.RouteID,
+		DriverID:       a.DriverID,
+		CollectorID:    a.CollectorID,
+		ShiftStartedAt: *a.StartedAt,
+	}
+}
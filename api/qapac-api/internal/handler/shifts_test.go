@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+func newShiftsRouter(repo storage.VehiclesRepository) *gin.Engine {
+	h := New(&mockStopsRepo{}, nil, nil, WithVehiclesRepository(repo))
+	r := gin.New()
+	r.GET("/api/v1/vehicles/:id/crew", h.GetVehicleCrew)
+	r.POST("/api/v1/admin/drivers/:id/shifts/start", h.StartDriverShift)
+	r.POST("/api/v1/admin/drivers/:id/shifts/end", h.EndDriverShift)
+	return r
+}
+
+func TestDriverShift_StartCrewEnd(t *testing.T) {
+	driver, collector := int32(5), int32(6)
+	repo := newMockVehiclesRepo(storage.Vehicle{ID: 1, Active: true})
+	repo.assignments = []storage.VehicleAssignment{{
+		ID: 1, VehicleID: 1, RouteID: 2, DriverID: &driver, CollectorID: &collector,
+		StartsAt: time.Now().Add(-time.Hour),
+	}}
+	r := newShiftsRouter(repo)
+
+	if w := doJSON(r, http.MethodGet, "/api/v1/vehicles/1/crew", ""); w.Code != http.StatusNotFound {
+		t.Errorf("crew before start: status = %d, want 404", w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, "/api/v1/admin/drivers/9/shifts/start", ""); w.Code != http.StatusConflict {
+		t.Errorf("start without planned shift: status = %d, want 409", w.Code)
+	}
+
+	w := doJSON(r, http.MethodPost, "/api/v1/admin/drivers/5/shifts/start", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("start: status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var started assignmentJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &started); err != nil {
+		t.Fatalf("start: decode: %v", err)
+	}
+	if started.StartedAt == nil || started.EndedAt != nil {
+		t.Errorf("start: started_at = %v, ended_at = %v, want only started_at", started.StartedAt, started.EndedAt)
+	}
+	if w := doJSON(r, http.MethodPost, "/api/v1/admin/drivers/5/shifts/start", ""); w.Code != http.StatusConflict {
+		t.Errorf("second start: status = %d, want 409", w.Code)
+	}
+
+	w = doJSON(r, http.MethodGet, "/api/v1/vehicles/1/crew", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("crew: status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var crew crewJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &crew); err != nil {
+		t.Fatalf("crew: decode: %v", err)
+	}
+	if crew.RouteID != 2 || crew.DriverID == nil || *crew.DriverID != 5 || crew.CollectorID == nil || *crew.CollectorID != 6 {
+		t.Errorf("crew = %+v, want driver 5 and collector 6 on route 2", crew)
+	}
+
+	if w := doJSON(r, http.MethodPost, "/api/v1/admin/drivers/5/shifts/end", ""); w.Code != http.StatusOK {
+		t.Errorf("end: status = %d, want 200", w.Code)
+	}
+	if w := doJSON(r, http.MethodPost, "/api/v1/admin/drivers/5/shifts/end", ""); w.Code != http.StatusConflict {
+		t.Errorf("second end: status = %d, want 409", w.Code)
+	}
+	if w := doJSON(r, http.MethodGet, "/api/v1/vehicles/1/crew", ""); w.Code != http.StatusNotFound {
+		t.Errorf("crew after end: status = %d, want 404", w.Code)
+	}
+}
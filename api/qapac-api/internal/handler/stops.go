@@ -1,26 +1,69 @@
 package handler
 
 import (
+	"encoding/base64"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/dom1nux/qapac-api/internal/storage"
 	"github.com/gin-gonic/gin"
 )
 
 const defaultRadiusMeters = 1000.0
 const maxRadiusMeters = 50_000.0
 
+// nearbyStopJSON is an element of the ListStopsNear response. The optional
+// fields are present only when requested with include.
+type nearbyStopJSON struct {
+	ID         int32            `json:"id"`
+	Name       string           `json:"name"`
+	Lat        float64          `json:"lat"`
+	Lon        float64          `json:"lon"`
+	DistanceM  *int             `json:"distance_m,omitempty"`
+	Routes     *[]stopRouteJSON `json:"routes,omitempty"`
+	ETASeconds *int             `json:"eta_seconds,omitempty"`
+	CacheAgeS  *int             `json:"cache_age_s,omitempty"`
+	Occupancy  *occupancyJSON   `json:"occupancy,omitempty"`
+}
+
+type stopRouteJSON struct {
+	ID   int32  `json:"id"`
+	Name string `json:"name"`
+}
+
+// Values accepted by the include parameter of ListStopsNear.
+const (
+	includeDistance = "distance"
+	includeRoutes   = "routes"
+	includeETA      = "eta"
+)
+
 // ListStopsNear handles GET /api/v1/stops/nearby
 //
 // Query params:
-//   - lat    (required) float64 — WGS-84 latitude
-//   - lon    (required) float64 — WGS-84 longitude
-//   - radius (optional) float64 — search radius in metres; default 1000
+//   - lat     (required) float64 — WGS-84 latitude
+//   - lon     (required) float64 — WGS-84 longitude
+//   - radius  (optional) float64 — search radius in metres; default 1000
+//   - include (optional) comma-separated subset of distance, routes, eta
 //
 // Response 200:
 //
 //	[{"id":1,"name":"Paradero Centro","lat":-12.123,"lon":-76.456}]
 //
+// With include=distance,routes,eta each stop also carries:
+//
+//	"distance_m":120,"routes":[{"id":1,"name":"Ruta 1"}],"eta_seconds":181
+//
+// Routes are fetched with one query for all stops and ETAs in one batch, for
+// the 50 nearest stops only (see maxBatchETAStops). A stop beyond those, or
+// whose ETA could not be computed, omits eta_seconds. An ETA served from the
+// cache also carries cache_age_s, and a stop whose next bus is known its
+// occupancy, as in ListStopETAs.
+//
 // Response 400: missing or invalid query parameters.
 // Response 500: storage error.
 func (h *Handler) ListStopsNear(c *gin.Context) {
@@ -48,24 +91,300 @@ func (h *Handler) ListStopsNear(c *gin.Context) {
 		radius = v
 	}
 
-	stops, err := h.stopsRepo.FindStopsNear(c.Request.Context(), lat, lon, radius)
+	include, ok := parseInclude(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	stops, err := h.stopsRepo.FindStopsNear(ctx, lat, lon, radius)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query stops"})
 		return
 	}
 
-	type stopJSON struct {
-		ID   int32   `json:"id"`
-		Name string  `json:"name"`
-		Lat  float64 `json:"lat"`
-		Lon  float64 `json:"lon"`
+	ids := make([]int32, len(stops))
+	out := make([]nearbyStopJSON, len(stops))
+	for i, s := range stops {
+		ids[i] = s.ID
+		out[i] = nearbyStopJSON{ID: s.ID, Name: s.Name, Lat: s.Lat, Lon: s.Lon}
+		if include[includeDistance] {
+			d := int(math.Round(s.DistanceM))
+			out[i].DistanceM = &d
+		}
+	}
+
+	if include[includeRoutes] && len(stops) > 0 {
+		routes, err := h.stopsRepo.ListRoutesServingStops(ctx, ids)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query routes"})
+			return
+		}
+		for i, s := range stops {
+			rs := make([]stopRouteJSON, len(routes[s.ID]))
+			for j, r := range routes[s.ID] {
+				rs[j] = stopRouteJSON{ID: r.ID, Name: r.Name}
+			}
+			out[i].Routes = &rs
+		}
+	}
+
+	if include[includeETA] && len(stops) > 0 {
+		// Only the nearest stops get an ETA, within the cap of a batch ETA
+		// request: a 50 km radius can hold thousands of stops, and each
+		// cache miss costs a provider call. ETA errors are non-fatal, as in
+		// GetStop: the stop is still returned.
+		etaIDs := ids[:min(len(ids), maxBatchETAStops)]
+		occupancy := h.approachingOccupancy(ctx, etaIDs)
+		for i, r := range h.etaService.GetETAsForStops(ctx, etaIDs) {
+			if r.Err == nil {
+				eta := toStopETAJSON(r, occupancy)
+				out[i].ETASeconds, out[i].CacheAgeS, out[i].Occupancy = eta.ETASeconds, eta.CacheAgeS, eta.Occupancy
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, out)
+}
+
+// parseInclude reads the include query parameter of ListStopsNear.
+// On failure it writes a 400 response and returns ok = false.
+func parseInclude(c *gin.Context) (map[string]bool, bool) {
+	include := map[string]bool{}
+	raw := c.Query("include")
+	if raw == "" {
+		return include, true
+	}
+	for _, v := range strings.Split(raw, ",") {
+		switch v = strings.TrimSpace(v); v {
+		case includeDistance, includeRoutes, includeETA:
+			include[v] = true
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "include must be a comma-separated subset of distance, routes, eta"})
+			return nil, false
+		}
+	}
+	return include, true
+}
+
+const (
+	defaultBBoxLimit = 200
+	maxBBoxLimit     = 500
+
+	// Thinning applies below thinningMaxZoom: each map tile is split into
+	// thinningCellsPerTile × thinningCellsPerTile cells (32 px at 256 px
+	// tiles) and one stop is kept per cell.
+	thinningMaxZoom      = 15
+	thinningCellsPerTile = 8
+	maxZoom              = 22
+)
+
+// ListStops handles GET /api/v1/stops
+//
+// Returns the active stops inside a map viewport, one page at a time.
+//
+// Query params:
+//   - bbox   (required) "minLon,minLat,maxLon,maxLat" — WGS-84
+//   - zoom   (optional) int 0-22 — map zoom; below 15 dense areas are thinned
+//     to one stop per ~32 px cell
+//   - limit  (optional) int — page size; default 200, max 500
+//   - cursor (optional) next_cursor of the previous page, with the same bbox
+//     and zoom
+//
+// Response 200:
+//
+//	{"stops":[{"id":1,"name":"Paradero Centro","lat":-12.123,"lon":-76.456}],
+//	 "next_cursor":"Mg"}
+//
+// next_cursor is null on the last page.
+//
+// Response 400: missing or invalid query parameters.
+// Response 500: storage error.
+func (h *Handler) ListStops(c *gin.Context) {
+	bbox, ok := parseBBox(c)
+	if !ok {
+		return
+	}
+
+	gridDeg := 0.0
+	if raw := c.Query("zoom"); raw != "" {
+		zoom, err := strconv.Atoi(raw)
+		if err != nil || zoom < 0 || zoom > maxZoom {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "zoom must be an integer between 0 and 22"})
+			return
+		}
+		gridDeg = thinningGridDeg(zoom)
 	}
 
-	out := make([]stopJSON, len(stops))
+	limit := defaultBBoxLimit
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > maxBBoxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+			return
+		}
+		limit = v
+	}
+
+	var afterID int32
+	if raw := c.Query("cursor"); raw != "" {
+		id, ok := decodeIDCursor(raw)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+		afterID = id
+	}
+
+	// One extra row tells whether there is a next page.
+	stops, err := h.stopsRepo.ListStopsInBBox(c.Request.Context(), bbox, gridDeg, afterID, limit+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query stops"})
+		return
+	}
+
+	var nextCursor *string
+	if len(stops) > limit {
+		stops = stops[:limit]
+		cur := encodeIDCursor(stops[limit-1].ID)
+		nextCursor = &cur
+	}
+
+	out := make([]nearbyStopJSON, len(stops))
 	for i, s := range stops {
-		out[i] = stopJSON{ID: s.ID, Name: s.Name, Lat: s.Lat, Lon: s.Lon}
+		out[i] = nearbyStopJSON{ID: s.ID, Name: s.Name, Lat: s.Lat, Lon: s.Lon}
+	}
+	c.JSON(http.StatusOK, gin.H{"stops": out, "next_cursor": nextCursor})
+}
+
+// parseBBox reads the bbox query parameter.
+// On failure it writes a 400 response and returns ok = false.
+func parseBBox(c *gin.Context) (storage.BBox, bool) {
+	raw := c.Query("bbox")
+	if raw == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bbox query parameter is required"})
+		return storage.BBox{}, false
+	}
+
+	parts := strings.Split(raw, ",")
+	if len(parts) != 4 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bbox must be minLon,minLat,maxLon,maxLat"})
+		return storage.BBox{}, false
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bbox must be minLon,minLat,maxLon,maxLat"})
+			return storage.BBox{}, false
+		}
+		v[i] = f
 	}
 
+	b := storage.BBox{MinLon: v[0], MinLat: v[1], MaxLon: v[2], MaxLat: v[3]}
+	if b.MinLon < -180 || b.MaxLon > 180 || b.MinLat < -90 || b.MaxLat > 90 ||
+		b.MinLon >= b.MaxLon || b.MinLat >= b.MaxLat {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bbox must be a valid WGS-84 box with min < max"})
+		return storage.BBox{}, false
+	}
+	return b, true
+}
+
+// thinningGridDeg returns the thinning cell size in degrees for a map zoom
+// level, or 0 when the zoom is close enough to show every stop.
+func thinningGridDeg(zoom int) float64 {
+	if zoom >= thinningMaxZoom {
+		return 0
+	}
+	tileDeg := 360 / math.Exp2(float64(zoom))
+	return tileDeg / thinningCellsPerTile
+}
+
+// encodeIDCursor returns the opaque cursor that resumes after the row with
+// the given id, in lists ordered by ID.
+func encodeIDCursor(id int32) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(int(id))))
+}
+
+func decodeIDCursor(cursor string) (int32, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, false
+	}
+	return parsePositiveID(string(raw))
+}
+
+const (
+	minSearchQueryLen  = 2
+	maxSearchQueryLen  = 100
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+)
+
+// SearchStops handles GET /api/v1/stops/search
+//
+// Fuzzy, accent-insensitive search by stop name: "ovalo gutierez" finds
+// "Paradero Ovalo Gutierrez".
+//
+// Query params:
+//   - q     (required) string — 2 to 100 characters
+//   - lat   (optional) float64 — with lon, ranks nearby stops higher
+//   - lon   (optional) float64
+//   - limit (optional) int — default 10, max 50
+//
+// Response 200 (best match first):
+//
+//	[{"id":6,"name":"Paradero Ovalo Gutierrez","lat":-12.105,"lon":-77.035,"score":0.93}]
+//
+// Response 400: missing or invalid query parameters.
+// Response 500: storage error.
+func (h *Handler) SearchStops(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if n := utf8.RuneCountInString(query); n < minSearchQueryLen || n > maxSearchQueryLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q must be between 2 and 100 characters"})
+		return
+	}
+	search := storage.StopSearch{Query: query, Limit: defaultSearchLimit}
+
+	if c.Query("lat") != "" || c.Query("lon") != "" {
+		lat, ok := parseRequiredFloat(c, "lat")
+		if !ok {
+			return
+		}
+		lon, ok := parseRequiredFloat(c, "lon")
+		if !ok {
+			return
+		}
+		search.Near, search.Lat, search.Lon = true, lat, lon
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > maxSearchLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 50"})
+			return
+		}
+		search.Limit = v
+	}
+
+	matches, err := h.stopsRepo.SearchStops(c.Request.Context(), search)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search stops"})
+		return
+	}
+
+	type matchJSON struct {
+		ID    int32   `json:"id"`
+		Name  string  `json:"name"`
+		Lat   float64 `json:"lat"`
+		Lon   float64 `json:"lon"`
+		Score float64 `json:"score"`
+	}
+
+	out := make([]matchJSON, len(matches))
+	for i, m := range matches {
+		out[i] = matchJSON{ID: m.ID, Name: m.Name, Lat: m.Lat, Lon: m.Lon, Score: math.Round(m.Score*100) / 100}
+	}
 	c.JSON(http.StatusOK, out)
 }
 
@@ -78,6 +397,10 @@ func (h *Handler) ListStopsNear(c *gin.Context) {
 //
 //	{"id":1,"name":"Paradero Centro","lat":-12.123,"lon":-76.456,"eta_seconds":300}
 //
+// An ETA served from the cache also carries "cache_age_s", its age in
+// seconds. When the next bus is known, "occupancy" carries its crowding, as
+// in ListStopETAs.
+//
 // Response 400: id is not a valid integer.
 // Response 404: stop does not exist.
 // Response 500: storage or ETA error.
@@ -100,16 +423,23 @@ func (h *Handler) GetStop(c *gin.Context) {
 		return
 	}
 
-	etaSecs, _, _ := h.etaService.GetETAForStop(c.Request.Context(), id)
+	etaSecs, source, age, _ := h.etaService.GetETAForStop(c.Request.Context(), id)
 	// ETA errors are non-fatal: we still return stop data with eta_seconds = 0.
 
-	c.JSON(http.StatusOK, gin.H{
+	resp := gin.H{
 		"id":          stop.ID,
 		"name":        stop.Name,
 		"lat":         stop.Lat,
 		"lon":         stop.Lon,
 		"eta_seconds": etaSecs,
-	})
+	}
+	if source == "cache" {
+		resp["cache_age_s"] = int(age / time.Second)
+	}
+	if occ := h.approachingOccupancy(c.Request.Context(), []int32{id})[id]; occ != nil {
+		resp["occupancy"] = occ
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // parseRequiredFloat extracts a required float64 query parameter.
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+const limaBBox = "-77.1,-12.2,-76.9,-12.0"
+
+func TestListStops_InvalidParams(t *testing.T) {
+	h := newTestHandler(&mockStopsRepo{}, &mockETAProvider{}, &mockRoutingServiceRouter{}, &mockStopsRepo{})
+	r := newRouter(h)
+	r.GET("/api/v1/stops", h.ListStops)
+
+	for _, q := range []string{
+		"",
+		"?bbox=-77.1,-12.2,-76.9",
+		"?bbox=-77.1,-12.2,abc,-12.0",
+		"?bbox=-76.9,-12.2,-77.1,-12.0", // min > max
+		"?bbox=-190,-12.2,-76.9,-12.0",
+		"?bbox=" + limaBBox + "&zoom=23",
+		"?bbox=" + limaBBox + "&limit=501",
+		"?bbox=" + limaBBox + "&cursor=!!",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/stops"+q, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want 400", q, w.Code)
+		}
+	}
+}
+
+func TestListStops_CursorPagination(t *testing.T) {
+	repo := &mockStopsRepo{bboxStops: []storage.Stop{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 5}, {ID: 8}}}
+	h := newTestHandler(repo, &mockETAProvider{}, &mockRoutingServiceRouter{}, &mockStopsRepo{})
+	r := newRouter(h)
+	r.GET("/api/v1/stops", h.ListStops)
+
+	var got []int32
+	cursor := ""
+	for page := 0; page < 5; page++ {
+		q := url.Values{"bbox": {limaBBox}, "limit": {"2"}}
+		if cursor != "" {
+			q.Set("cursor", cursor)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/stops?"+q.Encode(), nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("page %d: status = %d, want 200", page, w.Code)
+		}
+
+		var result struct {
+			Stops      []nearbyStopJSON `json:"stops"`
+			NextCursor *string          `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("unmarshal response: %v", err)
+		}
+		for _, s := range result.Stops {
+			got = append(got, s.ID)
+		}
+		if result.NextCursor == nil {
+			break
+		}
+		cursor = *result.NextCursor
+	}
+
+	want := []int32{1, 2, 3, 5, 8}
+	if len(got) != len(want) {
+		t.Fatalf("got stops %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got stops %v, want %v", got, want)
+		}
+	}
+}
+
+func TestListStops_ZoomThinning(t *testing.T) {
+	repo := &mockStopsRepo{}
+	h := newTestHandler(repo, &mockETAProvider{}, &mockRoutingServiceRouter{}, &mockStopsRepo{})
+	r := newRouter(h)
+	r.GET("/api/v1/stops", h.ListStops)
+
+	tests := []struct {
+		zoom string
+		want float64
+	}{
+		{"", 0},
+		{"16", 0},
+		{"12", 360.0 / 4096 / 8},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/stops?bbox="+limaBBox+"&zoom="+tt.zoom, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("zoom %q: status = %d, want 200", tt.zoom, w.Code)
+		}
+		if repo.bboxGrid != tt.want {
+			t.Errorf("zoom %q: grid = %v, want %v", tt.zoom, repo.bboxGrid, tt.want)
+		}
+	}
+}
+
+func TestSearchStops_InvalidParams(t *testing.T) {
+	h := newTestHandler(&mockStopsRepo{}, &mockETAProvider{}, &mockRoutingServiceRouter{}, &mockStopsRepo{})
+	r := newRouter(h)
+	r.GET("/api/v1/stops/search", h.SearchStops)
+
+	for _, q := range []string{
+		"",
+		"?q=+o+",
+		"?q=" + strings.Repeat("a", 101),
+		"?q=ovalo&lat=-12.1",
+		"?q=ovalo&lat=abc&lon=-77.0",
+		"?q=ovalo&limit=0",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/stops/search"+q, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want 400", q, w.Code)
+		}
+	}
+}
+
+func TestSearchStops_Success(t *testing.T) {
+	repo := &mockStopsRepo{matches: []storage.StopMatch{
+		{Stop: storage.Stop{ID: 6, Name: "Paradero Ovalo Gutierrez"}, Score: 0.8235},
+	}}
+	h := newTestHandler(repo, &mockETAProvider{}, &mockRoutingServiceRouter{}, &mockStopsRepo{})
+	r := newRouter(h)
+	r.GET("/api/v1/stops/search", h.SearchStops)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/stops/search?q=+ovalo+gutierez+&lat=-12.1&lon=-77.03&limit=5", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	want := storage.StopSearch{Query: "ovalo gutierez", Near: true, Lat: -12.1, Lon: -77.03, Limit: 5}
+	if repo.search != want {
+		t.Errorf("search = %+v, want %+v", repo.search, want)
+	}
+
+	var result []struct {
+		ID    int32   `json:"id"`
+		Score float64 `json:"score"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if len(result) != 1 || result[0].ID != 6 || result[0].Score != 0.82 {
+		t.Errorf("result = %+v, want stop 6 with score 0.82", result)
+	}
+}
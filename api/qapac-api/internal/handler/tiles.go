@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// mvtContentType is the registered media type of Mapbox Vector Tiles.
+const mvtContentType = "application/vnd.mapbox-vector-tile"
+
+// GetTile handles GET /api/v1/tiles/:z/:x/:y.mvt
+//
+// Serves the network as Mapbox Vector Tiles (XYZ scheme, Web Mercator) for
+// map clients:
+//   - layer "routes" (from zoom 9): id, name
+//   - layer "stops"  (from zoom 14): id, name, route_count
+//
+// The ETag is the network version, so clients revalidate with If-None-Match
+// and only download tiles again after the network is edited.
+//
+// Response 200: tile (application/vnd.mapbox-vector-tile).
+// Response 204: the tile has no features.
+// Response 304: If-None-Match matches the current network version.
+// Response 400: invalid tile coordinates.
+// Response 500: storage error.
+func (h *Handler) GetTile(c *gin.Context) {
+	yRaw, ok := strings.CutSuffix(c.Param("y"), ".mvt")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tile must end in .mvt"})
+		return
+	}
+	z, errZ := strconv.Atoi(c.Param("z"))
+	x, errX := strconv.Atoi(c.Param("x"))
+	y, errY := strconv.Atoi(yRaw)
+	if errZ != nil || errX != nil || errY != nil || z < 0 || z > service.MaxTileZoom {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "z, x and y must be integers with z between 0 and 20"})
+		return
+	}
+	if n := 1 << z; x < 0 || x >= n || y < 0 || y >= n {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "x and y must be between 0 and 2^z - 1"})
+		return
+	}
+
+	tile, err := h.tileService.GetTile(c.Request.Context(), z, x, y)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render tile"})
+		return
+	}
+
+	etag := `"` + strconv.FormatInt(tile.Version, 10) + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "public, max-age=60")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	if len(tile.Data) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.Data(http.StatusOK, mvtContentType, tile.Data)
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// mockTilesRepo returns a non-empty tile only for x = 1.
+type mockTilesRepo struct{}
+
+func (mockTilesRepo) GetNetworkVersion(_ context.Context) (int64, error) { return 7, nil }
+
+func (mockTilesRepo) GetTile(_ context.Context, _, x, _ int, _ bool) ([]byte, error) {
+	if x == 1 {
+		return []byte{0x1a, 0x00}, nil
+	}
+	return nil, nil
+}
+
+func newTilesRouter() *gin.Engine {
+	h := New(&mockStopsRepo{}, nil, nil, WithTileService(service.NewTileService(mockTilesRepo{})))
+	r := gin.New()
+	r.GET("/api/v1/tiles/:z/:x/:y", h.GetTile)
+	return r
+}
+
+func TestGetTile(t *testing.T) {
+	r := newTilesRouter()
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/api/v1/tiles/15/1/2.mvt", http.StatusOK},
+		{"/api/v1/tiles/15/2/2.mvt", http.StatusNoContent},
+		{"/api/v1/tiles/15/1/2.png", http.StatusBadRequest},
+		{"/api/v1/tiles/21/1/2.mvt", http.StatusBadRequest},
+		{"/api/v1/tiles/2/4/0.mvt", http.StatusBadRequest},
+		{"/api/v1/tiles/a/1/2.mvt", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.path, w.Code, tt.want)
+		}
+		if w.Code == http.StatusOK {
+			if ct := w.Header().Get("Content-Type"); ct != mvtContentType {
+				t.Errorf("%s: Content-Type = %q", tt.path, ct)
+			}
+			if etag := w.Header().Get("ETag"); etag != `"7"` {
+				t.Errorf("%s: ETag = %q, want \"7\"", tt.path, etag)
+			}
+		}
+	}
+}
+
+func TestGetTile_NotModified(t *testing.T) {
+	r := newTilesRouter()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/tiles/15/1/2.mvt", nil)
+	req.Header.Set("If-None-Match", `"7"`)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want 304", w.Code)
+	}
+}
@@ -0,0 +1,391 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/dom1nux/qapac-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTripsLimit    = 20
+	maxTripsLimit        = 100
+	defaultSummaryMonths = 6
+	maxSummaryMonths     = 24
+)
+
+// tripRequest is the body of RecordRiderTrip.
+type tripRequest struct {
+	RouteID         int32      `json:"route_id"`
+	VehicleID       *int32     `json:"vehicle_id"`
+	BoardingStopID  int32      `json:"boarding_stop_id"`
+	AlightingStopID *int32     `json:"alighting_stop_id"`
+	BoardedAt       *time.Time `json:"boarded_at"`
+	AlightedAt      *time.Time `json:"alighted_at"`
+	RiderCategory   string     `json:"rider_category"`
+}
+
+// checkinRequest is the body of CheckInRiderTrip.
+type checkinRequest struct {
+	RouteID        int32  `json:"route_id"`
+	VehicleID      *int32 `json:"vehicle_id"`
+	BoardingStopID int32  `json:"boarding_stop_id"`
+}
+
+// alightRequest is the body of AlightRiderTrip.
+type alightRequest struct {
+	AlightingStopID int32  `json:"alighting_stop_id"`
+	RiderCategory   string `json:"rider_category"`
+}
+
+// tripJSON is the JSON representation of a rider trip.
+type tripJSON struct {
+	ID              int32      `json:"id"`
+	RouteID         int32      `json:"route_id"`
+	VehicleID       *int32     `json:"vehicle_id"`
+	BoardingStopID  int32      `json:"boarding_stop_id"`
+	AlightingStopID *int32     `json:"alighting_stop_id"`
+	BoardedAt       time.Time  `json:"boarded_at"`
+	AlightedAt      *time.Time `json:"alighted_at"`
+	FareCents       *int       `json:"fare_cents"`
+	Source          string     `json:"source"`
+	Status          string     `json:"status"`
+}
+
+// monthlyTripsJSON is one month of GetRiderTripSummary.
+type monthlyTripsJSON struct {
+	Month      string `json:"month"`
+	Trips      int    `json:"trips"`
+	TotalCents int    `json:"total_cents"`
+}
+
+// RecordRiderTrip handles POST /api/v1/me/trips
+//
+// Records a past trip entered by the rider. The fare is priced with the fare
+// engine and kept, so later fare changes do not rewrite the history.
+//
+// Header X-Device-ID identifies the rider's device (see requireDeviceID).
+//
+// Body:
+//
+//	{"route_id":1,"vehicle_id":7,"boarding_stop_id":1,"alighting_stop_id":5,
+//	 "boarded_at":"2025-03-10T07:40:00-05:00","alighted_at":"2025-03-10T08:05:00-05:00",
+//	 "rider_category":"estudiante"}
+//
+// vehicle_id and rider_category are optional.
+//
+// Response 201: the recorded trip; fare_cents is null when no fare applies.
+// Response 400: missing header, invalid body, unknown route, vehicle, stop or
+// rider category, or a ride the route does not run.
+// Response 500: storage error.
+func (h *Handler) RecordRiderTrip(c *gin.Context) {
+	deviceID, ok := requireDeviceID(c)
+	if !ok {
+		return
+	}
+	var req tripRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if req.BoardedAt == nil || req.AlightedAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "boarded_at and alighted_at are required"})
+		return
+	}
+
+	trip, err := h.tripService.RecordTrip(c.Request.Context(), storage.RiderTrip{
+		DeviceID:        deviceID,
+		RouteID:         req.RouteID,
+		VehicleID:       req.VehicleID,
+		BoardingStopID:  req.BoardingStopID,
+		AlightingStopID: req.AlightingStopID,
+		BoardedAt:       *req.BoardedAt,
+		AlightedAt:      req.AlightedAt,
+	}, req.RiderCategory)
+	if !writeTripError(c, err, "failed to record trip") {
+		return
+	}
+	c.JSON(http.StatusCreated, toTripJSON(*trip, time.Now()))
+}
+
+// CheckInRiderTrip handles POST /api/v1/me/checkins
+//
+// Opens a trip boarded now. The app closes it with AlightRiderTrip; a
+// check-in left open is abandoned three hours after boarding, or when the
+// device checks in again, and is kept without an alighting stop or fare.
+//
+// Header X-Device-ID identifies the rider's device.
+//
+// Body:
+//
+//	{"route_id":1,"vehicle_id":7,"boarding_stop_id":1}
+//
+// vehicle_id is optional.
+//
+// Response 201: the open trip.
+// Response 400: missing header, invalid body, or unknown route, vehicle or
+// stop.
+// Response 409: a concurrent check-in of the device won.
+// Response 500: storage error.
+func (h *Handler) CheckInRiderTrip(c *gin.Context) {
+	deviceID, ok := requireDeviceID(c)
+	if !ok {
+		return
+	}
+	var req checkinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	trip, err := h.tripService.CheckIn(c.Request.Context(), storage.RiderTrip{
+		DeviceID:       deviceID,
+		RouteID:        req.RouteID,
+		VehicleID:      req.VehicleID,
+		BoardingStopID: req.BoardingStopID,
+	})
+	if errors.Is(err, storage.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "device checked in concurrently"})
+		return
+	}
+	if !writeTripError(c, err, "failed to check in") {
+		return
+	}
+	c.JSON(http.StatusCreated, toTripJSON(*trip, time.Now()))
+}
+
+// AlightRiderTrip handles POST /api/v1/me/trips/:id/alight
+//
+// Completes an open check-in at the stop where the rider got off, and prices
+// it.
+//
+// Header X-Device-ID identifies the rider's device.
+//
+// Body:
+//
+//	{"alighting_stop_id":5,"rider_category":"estudiante"}
+//
+// rider_category is optional.
+//
+// Response 200: the completed trip.
+// Response 400: missing header, invalid id or body, unknown rider category,
+// or a ride the route does not run.
+// Response 404: the device has no such trip.
+// Response 409: the trip is already completed or was abandoned.
+// Response 500: storage error.
+func (h *Handler) AlightRiderTrip(c *gin.Context) {
+	deviceID, ok := requireDeviceID(c)
+	if !ok {
+		return
+	}
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	var req alightRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.AlightingStopID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "alighting_stop_id must be a positive integer"})
+		return
+	}
+
+	trip, err := h.tripService.Alight(c.Request.Context(), deviceID, id, req.AlightingStopID, req.RiderCategory)
+	if errors.Is(err, service.ErrTripNotOpen) {
+		c.JSON(http.StatusConflict, gin.H{"error": "trip is not in progress"})
+		return
+	}
+	if !writeTripError(c, err, "failed to complete trip") {
+		return
+	}
+	if trip == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "trip not found"})
+		return
+	}
+	c.JSON(http.StatusOK, toTripJSON(*trip, time.Now()))
+}
+
+// ListRiderTrips handles GET /api/v1/me/trips
+//
+// Returns the trip history of the device, most recent first, one page at a
+// time.
+//
+// Header X-Device-ID identifies the rider's device.
+//
+// Query params:
+//   - limit  (optional) int — page size; default 20, max 100
+//   - cursor (optional) next_cursor of the previous page
+//
+// Response 200:
+//
+//	{"trips":[{"id":12,"route_id":1,"vehicle_id":7,"boarding_stop_id":1,"alighting_stop_id":5,
+//	           "boarded_at":"2025-03-10T07:40:00-05:00","alighted_at":"2025-03-10T08:05:00-05:00",
+//	           "fare_cents":250,"source":"checkin","status":"completed"}],
+//	 "next_cursor":"MTc0MTYxMDQwMDAwMDAwMDAwMDoxMg"}
+//
+// status is in_progress, completed or abandoned. next_cursor is null on the
+// last page.
+//
+// Response 400: missing header or invalid query parameters.
+// Response 500: storage error.
+func (h *Handler) ListRiderTrips(c *gin.Context) {
+	deviceID, ok := requireDeviceID(c)
+	if !ok {
+		return
+	}
+
+	limit := defaultTripsLimit
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > maxTripsLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return
+		}
+		limit = v
+	}
+
+	var before *storage.TripCursor
+	if raw := c.Query("cursor"); raw != "" {
+		cur, ok := decodeTripCursor(raw)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+		before = &cur
+	}
+
+	// One extra row tells whether there is a next page.
+	trips, err := h.tripService.History(c.Request.Context(), deviceID, before, limit+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list trips"})
+		return
+	}
+
+	var nextCursor *string
+	if len(trips) > limit {
+		trips = trips[:limit]
+		last := trips[limit-1]
+		cur := encodeTripCursor(storage.TripCursor{BoardedAt: last.BoardedAt, ID: last.ID})
+		nextCursor = &cur
+	}
+
+	now := time.Now()
+	out := make([]tripJSON, len(trips))
+	for i, t := range trips {
+		out[i] = toTripJSON(t, now)
+	}
+	c.JSON(http.StatusOK, gin.H{"trips": out, "next_cursor": nextCursor})
+}
+
+// GetRiderTripSummary handles GET /api/v1/me/trips/summary
+//
+// Returns the trips and spending of the device per calendar month (local
+// time), oldest first, the current month included.
+//
+// Header X-Device-ID identifies the rider's device.
+//
+// Query params:
+//   - months (optional) int — months to return; default 6, max 24
+//
+// Response 200:
+//
+//	{"months":[{"month":"2025-02","trips":38,"total_cents":7150},
+//	           {"month":"2025-03","trips":12,"total_cents":2400}]}
+//
+// Trips without a fare count towards trips but not towards total_cents.
+//
+// Response 400: missing header or invalid months.
+// Response 500: storage error.
+func (h *Handler) GetRiderTripSummary(c *gin.Context) {
+	deviceID, ok := requireDeviceID(c)
+	if !ok {
+		return
+	}
+
+	months := defaultSummaryMonths
+	if raw := c.Query("months"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > maxSummaryMonths {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "months must be between 1 and 24"})
+			return
+		}
+		months = v
+	}
+
+	summary, err := h.tripService.MonthlySummary(c.Request.Context(), deviceID, months)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to summarize trips"})
+		return
+	}
+
+	out := make([]monthlyTripsJSON, len(summary))
+	for i, m := range summary {
+		out[i] = monthlyTripsJSON{Month: m.Month.Format("2006-01"), Trips: m.Trips, TotalCents: m.TotalCents}
+	}
+	c.JSON(http.StatusOK, gin.H{"months": out})
+}
+
+// writeTripError writes the response for an error of the trip service that
+// is common to every write, and reports whether err was nil.
+func writeTripError(c *gin.Context, err error, failure string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, service.ErrInvalidTrip):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid trip: route, stops and times are required, and a trip must end after it starts, not in the future, within 3 hours"})
+	case errors.Is(err, service.ErrInvalidFareLeg):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "route does not run between the given stops in that direction"})
+	case errors.Is(err, service.ErrUnknownRiderCategory):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown rider_category"})
+	case errors.Is(err, storage.ErrInvalidReference):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "route, vehicle or stop not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+	}
+	return false
+}
+
+func toTripJSON(t storage.RiderTrip, now time.Time) tripJSON {
+	return tripJSON{
+		ID:              t.ID,
+		RouteID:         t.RouteID,
+		VehicleID:       t.VehicleID,
+		BoardingStopID:  t.BoardingStopID,
+		AlightingStopID: t.AlightingStopID,
+		BoardedAt:       t.BoardedAt,
+		AlightedAt:      t.AlightedAt,
+		FareCents:       t.FareCents,
+		Source:          t.Source,
+		Status:          service.TripStatus(t, now),
+	}
+}
+
+// encodeTripCursor returns the opaque cursor that resumes after cur.
+func encodeTripCursor(cur storage.TripCursor) string {
+	raw := strconv.FormatInt(cur.BoardedAt.UnixNano(), 10) + ":" + strconv.Itoa(int(cur.ID))
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeTripCursor(cursor string) (storage.TripCursor, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return storage.TripCursor{}, false
+	}
+	ts, id, found := strings.Cut(string(raw), ":")
+	if !found {
+		return storage.TripCursor{}, false
+	}
+	nanos, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return storage.TripCursor{}, false
+	}
+	tripID, ok := parsePositiveID(id)
+	if !ok {
+		return storage.TripCursor{}, false
+	}
+	return storage.TripCursor{BoardedAt: time.Unix(0, nanos), ID: tripID}, true
+}
@@ -0,0 +1,284 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/dom1nux/qapac-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// mockTripsRepo is an in-memory storage.TripsRepository; route 99 does not
+// exist.
+type mockTripsRepo struct {
+	trips []storage.RiderTrip
+}
+
+func (m *mockTripsRepo) CreateTrip(_ context.Context, t storage.RiderTrip) (*storage.RiderTrip, error) {
+	if t.RouteID == 99 {
+		return nil, storage.ErrInvalidReference
+	}
+	t.ID = int32(len(m.trips) + 1)
+	m.trips = append(m.trips, t)
+	return &t, nil
+}
+
+func (m *mockTripsRepo) GetTrip(_ context.Context, deviceID string, id int32) (*storage.RiderTrip, error) {
+	for _, t := range m.trips {
+		if t.ID == id && t.DeviceID == deviceID {
+			return &t, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockTripsRepo) OpenTrip(_ context.Context, t storage.RiderTrip, expiry time.Duration) (*storage.RiderTrip, error) {
+	if t.RouteID == 99 {
+		return nil, storage.ErrInvalidReference // rolled back: the open trip stays open
+	}
+	for i, open := range m.trips {
+		if open.DeviceID == t.DeviceID && open.AlightedAt == nil {
+			at := open.BoardedAt.Add(expiry)
+			if t.BoardedAt.Before(at) {
+				at = t.BoardedAt
+			}
+			m.trips[i].AlightedAt = &at
+		}
+	}
+	return m.CreateTrip(context.Background(), t)
+}
+
+func (m *mockTripsRepo) CloseTrip(_ context.Context, deviceID string, id int32, stopID *int32, at time.Time, fare *int) (*storage.RiderTrip, error) {
+	for i, t := range m.trips {
+		if t.ID == id && t.DeviceID == deviceID && t.AlightedAt == nil {
+			t.AlightingStopID, t.AlightedAt, t.FareCents = stopID, &at, fare
+			m.trips[i] = t
+			return &t, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockTripsRepo) ListTrips(_ context.Context, deviceID string, before *storage.TripCursor, limit int) ([]storage.RiderTrip, error) {
+	var out []storage.RiderTrip
+	for _, t := range m.trips {
+		if t.DeviceID != deviceID {
+			continue
+		}
+		if before != nil && !t.BoardedAt.Before(before.BoardedAt) &&
+			!(t.BoardedAt.Equal(before.BoardedAt) && t.ID < before.ID) {
+			continue
+		}
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].BoardedAt.Equal(out[j].BoardedAt) {
+			return out[i].BoardedAt.After(out[j].BoardedAt)
+		}
+		return out[i].ID > out[j].ID
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (m *mockTripsRepo) SummarizeTrips(_ context.Context, _ string, _ time.Time) ([]storage.MonthlyTrips, error) {
+	return nil, nil
+}
+
+func newTripsRouter(repo storage.TripsRepository) *gin.Engine {
+	trips := service.NewTripService(repo, service.NewFareService(mockFaresRepo{}))
+	h := New(&mockStopsRepo{}, nil, nil, WithTripService(trips))
+	r := gin.New()
+	r.GET("/api/v1/me/trips", h.ListRiderTrips)
+	r.POST("/api/v1/me/trips", h.RecordRiderTrip)
+	r.GET("/api/v1/me/trips/summary", h.GetRiderTripSummary)
+	r.POST("/api/v1/me/trips/:id/alight", h.AlightRiderTrip)
+	r.POST("/api/v1/me/checkins", h.CheckInRiderTrip)
+	return r
+}
+
+// doDeviceJSON sends body as a request of the device deviceID.
+func doDeviceJSON(r *gin.Engine, method, path, deviceID, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if deviceID != "" {
+		req.Header.Set(deviceIDHeader, deviceID)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+const testDevice = "3f2b9c1e-device"
+
+func TestRecordRiderTrip(t *testing.T) {
+	r := newTripsRouter(&mockTripsRepo{})
+	boarded := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	alighted := time.Now().Add(-30 * time.Minute).Format(time.RFC3339)
+	trip := func(routeID, category string) string {
+		return `{"route_id":` + routeID + `,"boarding_stop_id":1,"alighting_stop_id":2,"boarded_at":"` + boarded +
+			`","alighted_at":"` + alighted + `","rider_category":"` + category + `"}`
+	}
+
+	tests := []struct {
+		name, device, body string
+		want               int
+	}{
+		{"recorded", testDevice, trip("1", ""), http.StatusCreated},
+		{"missing device", "", trip("1", ""), http.StatusBadRequest},
+		{"short device", "abc", trip("1", ""), http.StatusBadRequest},
+		{"bad device characters", "abc 12345/x", trip("1", ""), http.StatusBadRequest},
+		{"missing times", testDevice, `{"route_id":1,"boarding_stop_id":1,"alighting_stop_id":2}`, http.StatusBadRequest},
+		{"route does not run the ride", testDevice, trip("2", ""), http.StatusBadRequest},
+		{"unknown category", testDevice, trip("1", "jubilado"), http.StatusBadRequest},
+		{"not json", testDevice, `nope`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := doDeviceJSON(r, http.MethodPost, "/api/v1/me/trips", tt.device, tt.body)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+
+	w := doDeviceJSON(r, http.MethodPost, "/api/v1/me/trips", testDevice, trip("1", "estudiante"))
+	var got tripJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.FareCents == nil || *got.FareCents != 100 || got.Source != "manual" || got.Status != service.TripCompleted {
+		t.Errorf("trip = %+v, want a completed manual trip with a 100 student fare", got)
+	}
+}
+
+func TestCheckInAndAlightRiderTrip(t *testing.T) {
+	r := newTripsRouter(&mockTripsRepo{})
+
+	w := doDeviceJSON(r, http.MethodPost, "/api/v1/me/checkins", testDevice, `{"route_id":1,"boarding_stop_id":1,"vehicle_id":7}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("check-in: status = %d, want 201: %s", w.Code, w.Body.String())
+	}
+	var open tripJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &open); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if open.Status != service.TripInProgress || open.FareCents != nil || open.VehicleID == nil || *open.VehicleID != 7 {
+		t.Errorf("check-in = %+v, want an unpriced trip in progress on vehicle 7", open)
+	}
+
+	if w := doDeviceJSON(r, http.MethodPost, "/api/v1/me/checkins", testDevice, `{"route_id":99,"boarding_stop_id":1}`); w.Code != http.StatusBadRequest {
+		t.Errorf("check-in on unknown route: status = %d, want 400", w.Code)
+	}
+
+	tests := []struct {
+		name, device, path, body string
+		want                     int
+	}{
+		{"other device", "other-device-1", "/api/v1/me/trips/1/alight", `{"alighting_stop_id":2}`, http.StatusNotFound},
+		{"missing stop", testDevice, "/api/v1/me/trips/1/alight", `{}`, http.StatusBadRequest},
+		{"invalid id", testDevice, "/api/v1/me/trips/x/alight", `{"alighting_stop_id":2}`, http.StatusBadRequest},
+		{"alighted", testDevice, "/api/v1/me/trips/1/alight", `{"alighting_stop_id":2}`, http.StatusOK},
+		{"already alighted", testDevice, "/api/v1/me/trips/1/alight", `{"alighting_stop_id":2}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		w := doDeviceJSON(r, http.MethodPost, tt.path, tt.device, tt.body)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
+
+func TestListRiderTrips_Pagination(t *testing.T) {
+	base := time.Now().Add(-48 * time.Hour)
+	repo := &mockTripsRepo{}
+	for i := range 5 {
+		at := base.Add(time.Duration(i) * time.Hour)
+		repo.trips = append(repo.trips, storage.RiderTrip{
+			ID: int32(i + 1), DeviceID: testDevice, RouteID: 1, BoardingStopID: 1,
+			BoardedAt: at, AlightedAt: &at, Source: storage.TripSourceCheckin,
+		})
+	}
+	repo.trips = append(repo.trips, storage.RiderTrip{ID: 6, DeviceID: "other-device-1", RouteID: 1, BoardedAt: base})
+	r := newTripsRouter(repo)
+
+	var ids []int32
+	cursor := ""
+	for range 3 {
+		path := "/api/v1/me/trips?limit=2"
+		if cursor != "" {
+			path += "&cursor=" + cursor
+		}
+		w := doDeviceJSON(r, http.MethodGet, path, testDevice, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200", path, w.Code)
+		}
+		var page struct {
+			Trips      []tripJSON `json:"trips"`
+			NextCursor *string    `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		for _, trip := range page.Trips {
+			ids = append(ids, trip.ID)
+			if trip.Status != service.TripAbandoned {
+				t.Errorf("trip %d status = %s, want abandoned", trip.ID, trip.Status)
+			}
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		cursor = *page.NextCursor
+	}
+
+	want := []int32{5, 4, 3, 2, 1}
+	if len(ids) != len(want) {
+		t.Fatalf("ids = %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("ids = %v, want %v", ids, want)
+		}
+	}
+
+	for _, path := range []string{"/api/v1/me/trips?limit=0", "/api/v1/me/trips?limit=101", "/api/v1/me/trips?cursor=bm9wZQ"} {
+		if w := doDeviceJSON(r, http.MethodGet, path, testDevice, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", path, w.Code)
+		}
+	}
+}
+
+func TestGetRiderTripSummary(t *testing.T) {
+	r := newTripsRouter(&mockTripsRepo{})
+
+	w := doDeviceJSON(r, http.MethodGet, "/api/v1/me/trips/summary?months=3", testDevice, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp struct {
+		Months []monthlyTripsJSON `json:"months"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Months) != 3 || resp.Months[2].Month != time.Now().Format("2006-01") {
+		t.Errorf("months = %+v, want the last 3 ending with the current one", resp.Months)
+	}
+
+	for _, path := range []string{"/api/v1/me/trips/summary?months=0", "/api/v1/me/trips/summary?months=25"} {
+		if w := doDeviceJSON(r, http.MethodGet, path, testDevice, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", path, w.Code)
+		}
+	}
+	if w := doDeviceJSON(r, http.MethodGet, "/api/v1/me/trips/summary", "", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("missing device: status = %d, want 400", w.Code)
+	}
+}
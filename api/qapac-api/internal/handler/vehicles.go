@@ -0,0 +1,483 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxPlateLen mirrors vehicles.plate VARCHAR(20).
+	maxPlateLen = 20
+	// maxVehicleCapacity rejects obvious typos; the largest articulated buses
+	// in service carry around 250 passengers.
+	maxVehicleCapacity = 300
+)
+
+// allowedAccessibilityFeatures lists the values accepted in
+// accessibility_features.
+var allowedAccessibilityFeatures = []string{
+	storage.FeatureWheelchairRamp,
+	storage.FeatureLowFloor,
+	storage.FeaturePrioritySeating,
+	storage.FeatureAudioAnnouncements,
+}
+
+// vehicleRequest is the body of POST and PUT /api/v1/admin/vehicles.
+type vehicleRequest struct {
+	Plate                 string   `json:"plate"`
+	Operator              string   `json:"operator"`
+	Capacity              int      `json:"capacity"`
+	AccessibilityFeatures []string `json:"accessibility_features"`
+	Active                *bool    `json:"active"` // default true
+}
+
+// vehicleJSON is the wire representation of a storage.Vehicle.
+type vehicleJSON struct {
+	ID                    int32     `json:"id"`
+	Plate                 string    `json:"plate"`
+	Operator              string    `json:"operator"`
+	Capacity              int       `json:"capacity"`
+	AccessibilityFeatures []string  `json:"accessibility_features"`
+	Active                bool      `json:"active"`
+	CreatedAt             time.Time `json:"created_at"`
+	// OccupancyStatus is the current crowding estimate, as in
+	// GetVehicleOccupancy. Only ListVehicles and GetVehicle set it, and they
+	// omit it when the estimate fails.
+	OccupancyStatus string `json:"occupancy_status,omitempty"`
+}
+
+// assignmentRequest is the body of POST /api/v1/admin/vehicles/:id/assignments.
+type assignmentRequest struct {
+	RouteID     int32      `json:"route_id"`
+	DriverID    *int32     `json:"driver_id"`
+	CollectorID *int32     `json:"collector_id"`
+	StartsAt    time.Time  `json:"starts_at"`
+	EndsAt      *time.Time `json:"ends_at"`
+}
+
+// assignmentJSON is the wire representation of a storage.VehicleAssignment.
+type assignmentJSON struct {
+	ID          int32      `json:"id"`
+	VehicleID   int32      `json:"vehicle_id"`
+	RouteID     int32      `json:"route_id"`
+	DriverID    *int32     `json:"driver_id"`
+	CollectorID *int32     `json:"collector_id"`
+	StartsAt    time.Time  `json:"starts_at"`
+	EndsAt      *time.Time `json:"ends_at"`
+	StartedAt   *time.Time `json:"started_at"`
+	EndedAt     *time.Time `json:"ended_at"`
+}
+
+// ListVehicles handles GET /api/v1/admin/vehicles
+//
+// Query params:
+//   - active (optional) "true" — only vehicles in service
+//
+// Response 200:
+//
+//	{"vehicles":[{"id":1,"plate":"ABC-123","operator":"ETUL 4","capacity":80,
+//	              "accessibility_features":["low_floor"],"active":true,
+//	              "created_at":"2025-03-10T07:00:00-05:00",
+//	              "occupancy_status":"STANDING_ROOM_ONLY"}]}
+//
+// occupancy_status is omitted when the crowding estimate fails: it does not
+// fail the listing.
+//
+// Response 500: storage error.
+func (h *Handler) ListVehicles(c *gin.Context) {
+	vehicles, err := h.vehiclesRepo.ListVehicles(c.Request.Context(), c.Query("active") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list vehicles"})
+		return
+	}
+
+	out := make([]vehicleJSON, len(vehicles))
+	for i, v := range vehicles {
+		out[i] = toVehicleJSON(v)
+	}
+	h.setVehicleOccupancy(c, out)
+	c.JSON(http.StatusOK, gin.H{"vehicles": out})
+}
+
+// GetVehicle handles GET /api/v1/admin/vehicles/:id
+//
+// Response 200: a single vehicle, as in ListVehicles.
+// Response 400: invalid id.
+// Response 404: vehicle not found.
+// Response 500: storage error.
+func (h *Handler) GetVehicle(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	v, err := h.vehiclesRepo.GetVehicle(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get vehicle"})
+		return
+	}
+	if v == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "vehicle not found"})
+		return
+	}
+	out := []vehicleJSON{toVehicleJSON(*v)}
+	h.setVehicleOccupancy(c, out)
+	c.JSON(http.StatusOK, out[0])
+}
+
+// setVehicleOccupancy fills the occupancy_status of vehicles in one query.
+// It is best-effort: on error, or without an occupancy service, the field
+// stays empty and is omitted.
+func (h *Handler) setVehicleOccupancy(c *gin.Context, vehicles []vehicleJSON) {
+	if h.occupancyService == nil || len(vehicles) == 0 {
+		return
+	}
+	ids := make([]int32, len(vehicles))
+	for i, v := range vehicles {
+		ids[i] = v.ID
+	}
+	estimates, err := h.occupancyService.Current(c.Request.Context(), ids)
+	if err != nil {
+		return
+	}
+	for i := range vehicles {
+		vehicles[i].OccupancyStatus = estimates[vehicles[i].ID].Status.String()
+	}
+}
+
+// CreateVehicle handles POST /api/v1/admin/vehicles
+//
+// Body:
+//
+//	{"plate":"ABC-123","operator":"ETUL 4","capacity":80,
+//	 "accessibility_features":["low_floor","wheelchair_ramp"],"active":true}
+//
+// The plate is trimmed and upper-cased. active defaults to true.
+//
+// Response 201: the created vehicle.
+// Response 400: invalid body.
+// Response 409: plate already registered.
+// Response 500: storage error.
+func (h *Handler) CreateVehicle(c *gin.Context) {
+	v, ok := bindVehicle(c)
+	if !ok {
+		return
+	}
+
+	created, err := h.vehiclesRepo.CreateVehicle(c.Request.Context(), v)
+	if errors.Is(err, storage.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "plate already registered"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create vehicle"})
+		return
+	}
+	c.JSON(http.StatusCreated, toVehicleJSON(*created))
+}
+
+// UpdateVehicle handles PUT /api/v1/admin/vehicles/:id
+//
+// Body: same as CreateVehicle; every field is replaced.
+//
+// Response 200: the updated vehicle.
+// Response 400: invalid id or body.
+// Response 404: vehicle not found.
+// Response 409: plate already registered to another vehicle.
+// Response 500: storage error.
+func (h *Handler) UpdateVehicle(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	v, ok := bindVehicle(c)
+	if !ok {
+		return
+	}
+	v.ID = id
+
+	updated, err := h.vehiclesRepo.UpdateVehicle(c.Request.Context(), v)
+	if errors.Is(err, storage.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "plate already registered"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update vehicle"})
+		return
+	}
+	if updated == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "vehicle not found"})
+		return
+	}
+	c.JSON(http.StatusOK, toVehicleJSON(*updated))
+}
+
+// DeactivateVehicle handles DELETE /api/v1/admin/vehicles/:id
+//
+// Vehicles are deactivated rather than deleted, since incidents and arrival
+// events keep referencing them.
+//
+// Response 204: vehicle deactivated.
+// Response 400: invalid id.
+// Response 404: vehicle not found.
+// Response 500: storage error.
+func (h *Handler) DeactivateVehicle(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	found, err := h.vehiclesRepo.DeactivateVehicle(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to deactivate vehicle"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "vehicle not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListVehicleAssignments handles GET /api/v1/admin/vehicles/:id/assignments
+//
+// Response 200:
+//
+//	{"assignments":[{"id":3,"vehicle_id":1,"route_id":2,"driver_id":null,
+//	                 "starts_at":"2025-03-10T05:00:00-05:00","ends_at":null}]}
+//
+// Response 400: invalid id.
+// Response 404: vehicle not found.
+// Response 500: storage error.
+func (h *Handler) ListVehicleAssignments(c *gin.Context) {
+	vehicleID, ok := h.requireVehicle(c)
+	if !ok {
+		return
+	}
+
+	assignments, err := h.vehiclesRepo.ListAssignments(c.Request.Context(), vehicleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list assignments"})
+		return
+	}
+
+	out := make([]assignmentJSON, len(assignments))
+	for i, a := range assignments {
+		out[i] = toAssignmentJSON(a)
+	}
+	c.JSON(http.StatusOK, gin.H{"assignments": out})
+}
+
+// CreateVehicleAssignment handles POST /api/v1/admin/vehicles/:id/assignments
+//
+// Body:
+//
+//	{"route_id":2,"driver_id":5,"collector_id":null,
+//	 "starts_at":"2025-03-10T05:00:00-05:00","ends_at":null}
+//
+// ends_at null means open-ended. driver_id and collector_id are optional;
+// without a driver, nobody can start the shift.
+//
+// Response 201: the created assignment.
+// Response 400: invalid body, or unknown route.
+// Response 404: vehicle not found.
+// Response 409: overlaps another assignment of the vehicle, the driver or the
+// collector.
+// Response 500: storage error.
+func (h *Handler) CreateVehicleAssignment(c *gin.Context) {
+	vehicleID, ok := h.requireVehicle(c)
+	if !ok {
+		return
+	}
+
+	var req assignmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if req.RouteID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "route_id must be a positive integer"})
+		return
+	}
+	if req.DriverID != nil && *req.DriverID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "driver_id must be a positive integer"})
+		return
+	}
+	if req.CollectorID != nil && *req.CollectorID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "collector_id must be a positive integer"})
+		return
+	}
+	if req.DriverID != nil && req.CollectorID != nil && *req.DriverID == *req.CollectorID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "collector_id must differ from driver_id"})
+		return
+	}
+	if req.StartsAt.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "starts_at is required"})
+		return
+	}
+	if req.EndsAt != nil && !req.EndsAt.After(req.StartsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be after starts_at"})
+		return
+	}
+
+	created, err := h.vehiclesRepo.CreateAssignment(c.Request.Context(), storage.VehicleAssignment{
+		VehicleID:   vehicleID,
+		RouteID:     req.RouteID,
+		DriverID:    req.DriverID,
+		CollectorID: req.CollectorID,
+		StartsAt:    req.StartsAt,
+		EndsAt:      req.EndsAt,
+	})
+	switch {
+	case errors.Is(err, storage.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "assignment overlaps an existing one for this vehicle, driver or collector"})
+		return
+	case errors.Is(err, storage.ErrInvalidReference):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "route not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create assignment"})
+		return
+	}
+	c.JSON(http.StatusCreated, toAssignmentJSON(*created))
+}
+
+// DeleteVehicleAssignment handles DELETE /api/v1/admin/vehicles/:id/assignments/:assignment_id
+//
+// Response 204: assignment deleted.
+// Response 400: invalid ids.
+// Response 404: no such assignment for this vehicle.
+// Response 500: storage error.
+func (h *Handler) DeleteVehicleAssignment(c *gin.Context) {
+	vehicleID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	assignmentID, ok := parseIDParam(c, "assignment_id")
+	if !ok {
+		return
+	}
+
+	found, err := h.vehiclesRepo.DeleteAssignment(c.Request.Context(), vehicleID, assignmentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete assignment"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "assignment not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// requireVehicle parses the :id path parameter and checks that the vehicle
+// exists. On failure it writes the error response and returns ok = false.
+func (h *Handler) requireVehicle(c *gin.Context) (int32, bool) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return 0, false
+	}
+	v, err := h.vehiclesRepo.GetVehicle(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get vehicle"})
+		return 0, false
+	}
+	if v == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "vehicle not found"})
+		return 0, false
+	}
+	return id, true
+}
+
+// bindVehicle decodes and validates a vehicleRequest body.
+// On failure it writes a 400 response and returns ok = false.
+func bindVehicle(c *gin.Context) (storage.Vehicle, bool) {
+	var req vehicleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return storage.Vehicle{}, false
+	}
+
+	plate := strings.ToUpper(strings.TrimSpace(req.Plate))
+	if plate == "" || len(plate) > maxPlateLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "plate must be between 1 and 20 characters"})
+		return storage.Vehicle{}, false
+	}
+	operator := strings.TrimSpace(req.Operator)
+	if operator == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "operator is required"})
+		return storage.Vehicle{}, false
+	}
+	if req.Capacity < 1 || req.Capacity > maxVehicleCapacity {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "capacity must be between 1 and 300"})
+		return storage.Vehicle{}, false
+	}
+
+	features := make([]string, 0, len(req.AccessibilityFeatures))
+	for _, f := range req.AccessibilityFeatures {
+		if !slices.Contains(allowedAccessibilityFeatures, f) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "accessibility_features must be a subset of " + strings.Join(allowedAccessibilityFeatures, ", "),
+			})
+			return storage.Vehicle{}, false
+		}
+		if !slices.Contains(features, f) {
+			features = append(features, f)
+		}
+	}
+
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	}
+
+	return storage.Vehicle{
+		Plate:                 plate,
+		Operator:              operator,
+		Capacity:              req.Capacity,
+		AccessibilityFeatures: features,
+		Active:                active,
+	}, true
+}
+
+// parseIDParam extracts the named path parameter as a positive int32 ID.
+// On failure it writes a 400 response and returns (0, false).
+func parseIDParam(c *gin.Context, name string) (int32, bool) {
+	id, ok := parsePositiveID(c.Param(name))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a positive integer"})
+	}
+	return id, ok
+}
+
+func toVehicleJSON(v storage.Vehicle) vehicleJSON {
+	return vehicleJSON{
+		ID:                    v.ID,
+		Plate:                 v.Plate,
+		Operator:              v.Operator,
+		Capacity:              v.Capacity,
+		AccessibilityFeatures: v.AccessibilityFeatures,
+		Active:                v.Active,
+		CreatedAt:             v.CreatedAt,
+	}
+}
+
+func toAssignmentJSON(a storage.VehicleAssignment) assignmentJSON {
+	return assignmentJSON{
+		ID:          a.ID,
+		VehicleID:   a.VehicleID,
+		RouteID:     a.RouteID,
+		DriverID:    a.DriverID,
+		CollectorID: a.CollectorID,
+		StartsAt:    a.StartsAt,
+		EndsAt:      a.EndsAt,
+		StartedAt:   a.StartedAt,
+		EndedAt:     a.EndedAt,
+	}
+}
@@ -0,0 +1,329 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/service"
+	"github.com/dom1nux/qapac-api/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// mockVehiclesRepo is an in-memory storage.VehiclesRepository.
+type mockVehiclesRepo struct {
+	vehicles    map[int32]*storage.Vehicle
+	assignments []storage.VehicleAssignment
+	createErr   error
+	assignErr   error
+}
+
+func newMockVehiclesRepo(vs ...storage.Vehicle) *mockVehiclesRepo {
+	m := &mockVehiclesRepo{vehicles: make(map[int32]*storage.Vehicle)}
+	for i := range vs {
+		m.vehicles[vs[i].ID] = &vs[i]
+	}
+	return m
+}
+
+func (m *mockVehiclesRepo) ListVehicles(_ context.Context, onlyActive bool) ([]storage.Vehicle, error) {
+	var out []storage.Vehicle
+	for _, v := range m.vehicles {
+		if !onlyActive || v.Active {
+			out = append(out, *v)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockVehiclesRepo) GetVehicle(_ context.Context, id int32) (*storage.Vehicle, error) {
+	return m.vehicles[id], nil
+}
+
+func (m *mockVehiclesRepo) CreateVehicle(_ context.Context, v storage.Vehicle) (*storage.Vehicle, error) {
+	if m.createErr != nil {
+		return nil, m.createErr
+	}
+	v.ID = int32(len(m.vehicles) + 1)
+	m.vehicles[v.ID] = &v
+	return &v, nil
+}
+
+func (m *mockVehiclesRepo) UpdateVehicle(_ context.Context, v storage.Vehicle) (*storage.Vehicle, error) {
+	if m.vehicles[v.ID] == nil {
+		return nil, nil
+	}
+	m.vehicles[v.ID] = &v
+	return &v, nil
+}
+
+func (m *mockVehiclesRepo) DeactivateVehicle(_ context.Context, id int32) (bool, error) {
+	v := m.vehicles[id]
+	if v == nil {
+		return false, nil
+	}
+	v.Active = false
+	return true, nil
+}
+
+func (m *mockVehiclesRepo) ListAssignments(_ context.Context, _ int32) ([]storage.VehicleAssignment, error) {
+	return m.assignments, nil
+}
+
+func (m *mockVehiclesRepo) CreateAssignment(_ context.Context, a storage.VehicleAssignment) (*storage.VehicleAssignment, error) {
+	if m.assignErr != nil {
+		return nil, m.assignErr
+	}
+	a.ID = int32(len(m.assignments) + 1)
+	m.assignments = append(m.assignments, a)
+	return &a, nil
+}
+
+func (m *mockVehiclesRepo) DeleteAssignment(_ context.Context, _, assignmentID int32) (bool, error) {
+	return int(assignmentID) <= len(m.assignments), nil
+}
+
+func (m *mockVehiclesRepo) GetActiveAssignment(_ context.Context, vehicleID int32, at time.Time) (*storage.VehicleAssignment, error) {
+	for _, a := range m.assignments {
+		if a.VehicleID == vehicleID && !a.StartsAt.After(at) && (a.EndsAt == nil || a.EndsAt.After(at)) {
+			return &a, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockVehiclesRepo) StartShift(_ context.Context, driverID int32, at time.Time) (*storage.VehicleAssignment, error) {
+	for i := range m.assignments {
+		a := &m.assignments[i]
+		if a.DriverID != nil && *a.DriverID == driverID && a.StartedAt != nil && a.EndedAt == nil {
+			return nil, nil // another shift in progress
+		}
+	}
+	for i := range m.assignments {
+		a := &m.assignments[i]
+		if a.DriverID != nil && *a.DriverID == driverID && a.StartedAt == nil &&
+			!a.StartsAt.After(at) && (a.EndsAt == nil || a.EndsAt.After(at)) {
+			a.StartedAt = &at
+			return a, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockVehiclesRepo) EndShift(_ context.Context, driverID int32, at time.Time) (*storage.VehicleAssignment, error) {
+	for i := range m.assignments {
+		a := &m.assignments[i]
+		if a.DriverID != nil && *a.DriverID == driverID && a.StartedAt != nil && a.EndedAt == nil {
+			a.EndedAt = &at
+			return a, nil
+		}
+	}
+	return nil, nil
+}
+
+func newVehiclesRouter(repo storage.VehiclesRepository) *gin.Engine {
+	h := New(&mockStopsRepo{}, nil, nil, WithVehiclesRepository(repo))
+	r := gin.New()
+	admin := r.Group("/api/v1/admin")
+	admin.GET("/vehicles", h.ListVehicles)
+	admin.POST("/vehicles", h.CreateVehicle)
+	admin.GET("/vehicles/:id", h.GetVehicle)
+	admin.PUT("/vehicles/:id", h.UpdateVehicle)
+	admin.DELETE("/vehicles/:id", h.DeactivateVehicle)
+	admin.GET("/vehicles/:id/assignments", h.ListVehicleAssignments)
+	admin.POST("/vehicles/:id/assignments", h.CreateVehicleAssignment)
+	admin.DELETE("/vehicles/:id/assignments/:assignment_id", h.DeleteVehicleAssignment)
+	return r
+}
+
+func doJSON(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCreateVehicle_Success(t *testing.T) {
+	repo := newMockVehiclesRepo()
+	r := newVehiclesRouter(repo)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/admin/vehicles",
+		`{"plate":" abc-123 ","operator":"ETUL 4","capacity":80,"accessibility_features":["low_floor","low_floor"]}`)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201 (body %s)", w.Code, w.Body)
+	}
+	var got vehicleJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if got.Plate != "ABC-123" || !got.Active {
+		t.Errorf("vehicle = %+v, want plate ABC-123 and active by default", got)
+	}
+	if len(got.AccessibilityFeatures) != 1 {
+		t.Errorf("features = %v, want duplicates removed", got.AccessibilityFeatures)
+	}
+}
+
+func TestCreateVehicle_Invalid(t *testing.T) {
+	r := newVehiclesRouter(newMockVehiclesRepo())
+
+	for _, body := range []string{
+		`not json`,
+		`{"plate":"","operator":"ETUL 4","capacity":80}`,
+		`{"plate":"ABC-123456789012345678","operator":"ETUL 4","capacity":80}`,
+		`{"plate":"ABC-123","operator":" ","capacity":80}`,
+		`{"plate":"ABC-123","operator":"ETUL 4","capacity":0}`,
+		`{"plate":"ABC-123","operator":"ETUL 4","capacity":80,"accessibility_features":["wifi"]}`,
+	} {
+		if w := doJSON(r, http.MethodPost, "/api/v1/admin/vehicles", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestCreateVehicle_DuplicatePlate(t *testing.T) {
+	repo := newMockVehiclesRepo()
+	repo.createErr = storage.ErrConflict
+	r := newVehiclesRouter(repo)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/admin/vehicles", `{"plate":"ABC-123","operator":"ETUL 4","capacity":80}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("status = %d, want 409", w.Code)
+	}
+}
+
+func TestUpdateAndDeactivateVehicle(t *testing.T) {
+	repo := newMockVehiclesRepo(storage.Vehicle{ID: 1, Plate: "ABC-123", Operator: "ETUL 4", Capacity: 80, Active: true})
+	r := newVehiclesRouter(repo)
+
+	w := doJSON(r, http.MethodPut, "/api/v1/admin/vehicles/1", `{"plate":"ABC-123","operator":"ETUL 4","capacity":90}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d, want 200", w.Code)
+	}
+	if repo.vehicles[1].Capacity != 90 {
+		t.Errorf("capacity = %d, want 90", repo.vehicles[1].Capacity)
+	}
+
+	if w := doJSON(r, http.MethodPut, "/api/v1/admin/vehicles/9", `{"plate":"X-1","operator":"ETUL 4","capacity":90}`); w.Code != http.StatusNotFound {
+		t.Errorf("PUT unknown: status = %d, want 404", w.Code)
+	}
+
+	if w := doJSON(r, http.MethodDelete, "/api/v1/admin/vehicles/1", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE status = %d, want 204", w.Code)
+	}
+	if repo.vehicles[1].Active {
+		t.Error("vehicle still active after DELETE")
+	}
+
+	w = doJSON(r, http.MethodGet, "/api/v1/admin/vehicles?active=true", "")
+	var list struct {
+		Vehicles []vehicleJSON `json:"vehicles"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if len(list.Vehicles) != 0 {
+		t.Errorf("active vehicles = %d, want 0", len(list.Vehicles))
+	}
+}
+
+func TestCreateVehicleAssignment(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		body      string
+		assignErr error
+		want      int
+	}{
+		{"ok", "/api/v1/admin/vehicles/1/assignments",
+			`{"route_id":2,"starts_at":"2025-03-10T05:00:00-05:00"}`, nil, http.StatusCreated},
+		{"unknown vehicle", "/api/v1/admin/vehicles/9/assignments",
+			`{"route_id":2,"starts_at":"2025-03-10T05:00:00-05:00"}`, nil, http.StatusNotFound},
+		{"missing start", "/api/v1/admin/vehicles/1/assignments",
+			`{"route_id":2}`, nil, http.StatusBadRequest},
+		{"end before start", "/api/v1/admin/vehicles/1/assignments",
+			`{"route_id":2,"starts_at":"2025-03-10T05:00:00-05:00","ends_at":"2025-03-10T04:00:00-05:00"}`, nil, http.StatusBadRequest},
+		{"with crew", "/api/v1/admin/vehicles/1/assignments",
+			`{"route_id":2,"driver_id":5,"collector_id":6,"starts_at":"2025-03-10T05:00:00-05:00"}`, nil, http.StatusCreated},
+		{"collector is driver", "/api/v1/admin/vehicles/1/assignments",
+			`{"route_id":2,"driver_id":5,"collector_id":5,"starts_at":"2025-03-10T05:00:00-05:00"}`, nil, http.StatusBadRequest},
+		{"invalid collector", "/api/v1/admin/vehicles/1/assignments",
+			`{"route_id":2,"collector_id":0,"starts_at":"2025-03-10T05:00:00-05:00"}`, nil, http.StatusBadRequest},
+		{"overlap", "/api/v1/admin/vehicles/1/assignments",
+			`{"route_id":2,"starts_at":"2025-03-10T05:00:00-05:00"}`, storage.ErrConflict, http.StatusConflict},
+		{"unknown route", "/api/v1/admin/vehicles/1/assignments",
+			`{"route_id":99,"starts_at":"2025-03-10T05:00:00-05:00"}`, storage.ErrInvalidReference, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMockVehiclesRepo(storage.Vehicle{ID: 1, Plate: "ABC-123", Active: true})
+			repo.assignErr = tt.assignErr
+			r := newVehiclesRouter(repo)
+
+			if w := doJSON(r, http.MethodPost, tt.path, tt.body); w.Code != tt.want {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestDeleteVehicleAssignment(t *testing.T) {
+	repo := newMockVehiclesRepo(storage.Vehicle{ID: 1})
+	repo.assignments = []storage.VehicleAssignment{{ID: 1, VehicleID: 1, RouteID: 2}}
+	r := newVehiclesRouter(repo)
+
+	if w := doJSON(r, http.MethodDelete, "/api/v1/admin/vehicles/1/assignments/1", ""); w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want 204", w.Code)
+	}
+	if w := doJSON(r, http.MethodDelete, "/api/v1/admin/vehicles/1/assignments/5", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown assignment: status = %d, want 404", w.Code)
+	}
+	if w := doJSON(r, http.MethodDelete, "/api/v1/admin/vehicles/1/assignments/x", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid id: status = %d, want 400", w.Code)
+	}
+}
+
+func TestListVehicles_OccupancyStatus(t *testing.T) {
+	repo := newMockVehiclesRepo(
+		storage.Vehicle{ID: 1, Plate: "ABC-123", Active: true},
+		storage.Vehicle{ID: 2, Plate: "XYZ-789", Active: true},
+	)
+	occupancy := &mockOccupancyRepo{reports: []storage.OccupancyReport{{
+		VehicleID: 1, Status: int(service.OccupancyStandingRoomOnly),
+		Source: storage.OccupancySourceRider, ReportedAt: time.Now(),
+	}}}
+	h := New(&mockStopsRepo{}, nil, nil, WithVehiclesRepository(repo),
+		WithOccupancyService(service.NewOccupancyService(occupancy)))
+	r := gin.New()
+	r.GET("/api/v1/admin/vehicles", h.ListVehicles)
+	r.GET("/api/v1/admin/vehicles/:id", h.GetVehicle)
+
+	w := doJSON(r, http.MethodGet, "/api/v1/admin/vehicles", "")
+	var list struct {
+		Vehicles []vehicleJSON `json:"vehicles"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	want := map[int32]string{1: "STANDING_ROOM_ONLY", 2: "NO_DATA_AVAILABLE"}
+	for _, v := range list.Vehicles {
+		if v.OccupancyStatus != want[v.ID] {
+			t.Errorf("vehicle %d: occupancy_status = %q, want %q", v.ID, v.OccupancyStatus, want[v.ID])
+		}
+	}
+
+	// A failing estimate does not fail the vehicle: the field is omitted.
+	occupancy.listErr = errors.New("connection refused")
+	w = doJSON(r, http.MethodGet, "/api/v1/admin/vehicles/1", "")
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "occupancy_status") {
+		t.Errorf("with a failing estimate: %d %s, want 200 without occupancy_status", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminToken returns a Gin middleware that only lets through requests carrying
+// "Authorization: Bearer <token>". It guards the operator-facing /admin
+// endpoints until JWT authentication (MVP v2-B) replaces it with real roles.
+//
+// The comparison is constant-time so the token cannot be guessed byte by byte
+// from response latency. An empty token rejects every request; app.New does
+// not register the admin routes at all in that case.
+func AdminToken(token string) gin.HandlerFunc {
+	want := []byte(token)
+	return func(c *gin.Context) {
+		got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || len(want) == 0 || subtle.ConstantTimeCompare([]byte(got), want) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "admin token required",
+			})
+			return
+		}
+		c.Next()
+	}
+}
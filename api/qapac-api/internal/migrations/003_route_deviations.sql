@@ -0,0 +1,17 @@
+-- Migration: 003_route_deviations
+-- Off-route detection: one row per detour episode of a vehicle away from its
+-- route shape. An incident is open while closed_at IS NULL.
+
+CREATE TABLE IF NOT EXISTS route_deviation_incidents (
+  id             SERIAL PRIMARY KEY,
+  vehicle_ref    VARCHAR(100) NOT NULL,
+  route_id       INT NOT NULL REFERENCES routes(id),
+  geom           GEOMETRY(POINT, 4326) NOT NULL, -- first off-route position
+  max_distance_m INT NOT NULL,
+  opened_at      TIMESTAMP NOT NULL,
+  closed_at      TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_route_deviations_open
+  ON route_deviation_incidents(route_id)
+  WHERE closed_at IS NULL;
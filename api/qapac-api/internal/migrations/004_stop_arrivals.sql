@@ -0,0 +1,22 @@
+-- Migration: 004_stop_arrivals
+-- Stop arrival events and scheduled headways for headway adherence analytics.
+
+-- Scheduled (planned) time between consecutive buses of a route, in seconds.
+-- NULL means the route has no published frequency; bunching is not flagged.
+ALTER TABLE routes ADD COLUMN IF NOT EXISTS scheduled_headway_s INT;
+
+-- Demo routes run every 10 minutes.
+UPDATE routes SET scheduled_headway_s = 600
+WHERE id IN (1, 2) AND scheduled_headway_s IS NULL;
+
+-- One row per vehicle arriving at a stop of its route. Logged table: these are
+-- operational facts used for reporting, not cache.
+CREATE TABLE IF NOT EXISTS stop_arrivals (
+  id          SERIAL PRIMARY KEY,
+  route_id    INT NOT NULL REFERENCES routes(id),
+  stop_id     INT NOT NULL REFERENCES stops(id),
+  vehicle_ref VARCHAR(100) NOT NULL,
+  arrived_at  TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_stop_arrivals_route_ts ON stop_arrivals(route_id, arrived_at);
@@ -0,0 +1,41 @@
+-- Migration: 005_vehicles
+-- Fleet registry: vehicles and their time-bound assignment to a route and a
+-- driver. Position-derived tables now reference the vehicle instead of an
+-- opaque device string.
+
+-- Needed for the exclusion constraints below (= on INT inside a GiST index).
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+CREATE TABLE IF NOT EXISTS vehicles (
+  id                     SERIAL PRIMARY KEY,
+  plate                  VARCHAR(20) NOT NULL UNIQUE,
+  operator               VARCHAR(255) NOT NULL,
+  capacity               INT NOT NULL CHECK (capacity > 0),
+  -- Subset of: wheelchair_ramp, low_floor, priority_seating, audio_announcements.
+  accessibility_features TEXT[] NOT NULL DEFAULT '{}',
+  active                 BOOLEAN NOT NULL DEFAULT true,
+  created_at             TIMESTAMP DEFAULT NOW()
+);
+
+-- driver_id stays a plain INT until the users table exists (MVP v2-B); the
+-- foreign key is added then.
+CREATE TABLE IF NOT EXISTS vehicle_assignments (
+  id         SERIAL PRIMARY KEY,
+  vehicle_id INT NOT NULL REFERENCES vehicles(id),
+  route_id   INT NOT NULL REFERENCES routes(id),
+  driver_id  INT,
+  starts_at  TIMESTAMP NOT NULL,
+  ends_at    TIMESTAMP, -- NULL = open-ended
+  CHECK (ends_at IS NULL OR ends_at > starts_at),
+  -- A vehicle serves one route at a time, and a driver drives one vehicle.
+  EXCLUDE USING gist (vehicle_id WITH =, tsrange(starts_at, ends_at) WITH &&),
+  EXCLUDE USING gist (driver_id WITH =, tsrange(starts_at, ends_at) WITH &&)
+);
+
+-- Nothing writes these tables yet (see TECH_DEBT TD-07), so they are empty and
+-- the NOT NULL column can be added without a backfill.
+ALTER TABLE route_deviation_incidents DROP COLUMN IF EXISTS vehicle_ref;
+ALTER TABLE route_deviation_incidents ADD COLUMN IF NOT EXISTS vehicle_id INT NOT NULL REFERENCES vehicles(id);
+
+ALTER TABLE stop_arrivals DROP COLUMN IF EXISTS vehicle_ref;
+ALTER TABLE stop_arrivals ADD COLUMN IF NOT EXISTS vehicle_id INT NOT NULL REFERENCES vehicles(id);
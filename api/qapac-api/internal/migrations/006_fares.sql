@@ -0,0 +1,102 @@
+-- Migration: 006_fares
+-- Fare model following GTFS-Fares v2: networks, areas, rider categories, fare
+-- products and the leg/transfer rules that select them. Amounts are stored in
+-- céntimos de sol (INT) to keep money out of floating point.
+
+CREATE TABLE IF NOT EXISTS networks (
+  id   VARCHAR(50) PRIMARY KEY,
+  name VARCHAR(255) NOT NULL
+);
+
+-- A route belongs to at most one fare network. Route-specific fares are
+-- modelled as a network with a single route, as in GTFS.
+ALTER TABLE routes ADD COLUMN IF NOT EXISTS network_id VARCHAR(50) REFERENCES networks(id);
+
+CREATE TABLE IF NOT EXISTS areas (
+  id   VARCHAR(50) PRIMARY KEY,
+  name VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS stop_areas (
+  area_id VARCHAR(50) NOT NULL REFERENCES areas(id),
+  stop_id INT NOT NULL REFERENCES stops(id),
+  PRIMARY KEY (area_id, stop_id)
+);
+
+CREATE TABLE IF NOT EXISTS rider_categories (
+  id         VARCHAR(50) PRIMARY KEY,
+  name       VARCHAR(255) NOT NULL,
+  is_default BOOLEAN NOT NULL DEFAULT false
+);
+
+-- At most one default category: the fare charged when a product has no price
+-- for the rider's category.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_rider_categories_default
+  ON rider_categories(is_default) WHERE is_default;
+
+-- One row per product and rider category (GTFS fare_products.txt repeats the
+-- fare_product_id for each category).
+CREATE TABLE IF NOT EXISTS fare_products (
+  id                VARCHAR(50) NOT NULL,
+  rider_category_id VARCHAR(50) NOT NULL REFERENCES rider_categories(id),
+  name              VARCHAR(255) NOT NULL,
+  amount_cents      INT NOT NULL CHECK (amount_cents >= 0),
+  currency          CHAR(3) NOT NULL DEFAULT 'PEN',
+  PRIMARY KEY (id, rider_category_id)
+);
+
+-- NULL columns match any value. Distance bands are [min, max) metres measured
+-- along the route shape between the boarding and alighting stops.
+CREATE TABLE IF NOT EXISTS fare_leg_rules (
+  id              SERIAL PRIMARY KEY,
+  leg_group_id    VARCHAR(50),
+  network_id      VARCHAR(50) REFERENCES networks(id),
+  from_area_id    VARCHAR(50) REFERENCES areas(id),
+  to_area_id      VARCHAR(50) REFERENCES areas(id),
+  min_distance_m  INT,
+  max_distance_m  INT,
+  fare_product_id VARCHAR(50) NOT NULL,
+  rule_priority   INT NOT NULL DEFAULT 0,
+  CHECK (min_distance_m IS NULL OR max_distance_m IS NULL OR max_distance_m > min_distance_m)
+);
+
+-- fare_transfer_type: 0 = A + AB, 1 = A + AB + B, 2 = AB (GTFS semantics).
+-- A NULL fare_product_id is a free transfer (AB = 0).
+CREATE TABLE IF NOT EXISTS fare_transfer_rules (
+  id                 SERIAL PRIMARY KEY,
+  from_leg_group_id  VARCHAR(50),
+  to_leg_group_id    VARCHAR(50),
+  fare_transfer_type SMALLINT NOT NULL CHECK (fare_transfer_type IN (0, 1, 2)),
+  fare_product_id    VARCHAR(50)
+);
+
+-- =====================
+-- Demo fares: urban buses in Lima charge by distance band ("tramo"), and
+-- students pay half fare (medio pasaje, Ley 26271).
+-- =====================
+
+INSERT INTO networks (id, name) VALUES
+  ('lima_urbano', 'Transporte urbano de Lima')
+ON CONFLICT DO NOTHING;
+
+UPDATE routes SET network_id = 'lima_urbano'
+WHERE id IN (1, 2) AND network_id IS NULL;
+
+INSERT INTO rider_categories (id, name, is_default) VALUES
+  ('general',    'Pasaje general',  true),
+  ('estudiante', 'Medio pasaje',    false)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO fare_products (id, rider_category_id, name, amount_cents, currency) VALUES
+  ('tramo_corto', 'general',    'Tramo corto', 150, 'PEN'),
+  ('tramo_corto', 'estudiante', 'Tramo corto',  75, 'PEN'),
+  ('tramo_largo', 'general',    'Tramo largo', 250, 'PEN'),
+  ('tramo_largo', 'estudiante', 'Tramo largo', 125, 'PEN')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO fare_leg_rules (id, leg_group_id, network_id, min_distance_m, max_distance_m, fare_product_id) VALUES
+  (1, 'urbano', 'lima_urbano', NULL, 6000, 'tramo_corto'),
+  (2, 'urbano', 'lima_urbano', 6000, NULL, 'tramo_largo')
+ON CONFLICT DO NOTHING;
+
+SELECT setval('fare_leg_rules_id_seq', (SELECT MAX(id) FROM fare_leg_rules));
@@ -0,0 +1,15 @@
+-- Migration: 007_occupancy_reports
+-- Crowding reports per vehicle. status uses the GTFS-Realtime OccupancyStatus
+-- enum values (0 = EMPTY ... 8 = NOT_BOARDABLE) so feeds can be exported as is.
+
+CREATE TABLE IF NOT EXISTS occupancy_reports (
+  id          SERIAL PRIMARY KEY,
+  vehicle_id  INT NOT NULL REFERENCES vehicles(id),
+  status      SMALLINT NOT NULL CHECK (status BETWEEN 0 AND 8),
+  source      VARCHAR(20) NOT NULL CHECK (source IN ('driver', 'collector', 'rider')),
+  reported_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Reads always fetch the recent reports of a few vehicles.
+CREATE INDEX IF NOT EXISTS idx_occupancy_reports_vehicle_ts
+  ON occupancy_reports(vehicle_id, reported_at DESC);
@@ -0,0 +1,15 @@
+-- Migration: 008_stop_search
+-- Accent-insensitive fuzzy search on stop names.
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+-- unaccent() is only STABLE (its dictionary could change), so it cannot be
+-- used in an index expression. This wrapper pins the dictionary and is
+-- declared IMMUTABLE; queries must use the same expression to hit the index.
+CREATE OR REPLACE FUNCTION immutable_unaccent(text) RETURNS text
+  LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT
+  AS $$ SELECT public.unaccent('public.unaccent'::regdictionary, $1) $$;
+
+CREATE INDEX IF NOT EXISTS idx_stops_name_trgm
+  ON stops USING GIN (lower(immutable_unaccent(name)) gin_trgm_ops);
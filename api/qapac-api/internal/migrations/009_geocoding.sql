@@ -0,0 +1,50 @@
+-- Migration: 009_geocoding
+-- Local gazetteer of landmarks and districts, and the geocoding cache.
+
+-- Named places resolved before (and instead of) the paid geocoding provider.
+-- Landmarks are points; districts may be points or polygons. Reverse
+-- geocoding falls back to a district only when its polygon contains the
+-- point, so districts loaded as points are found by name only.
+CREATE TABLE IF NOT EXISTS gazetteer_places (
+  id         SERIAL PRIMARY KEY,
+  name       VARCHAR(200) NOT NULL,
+  kind       VARCHAR(20) NOT NULL CHECK (kind IN ('landmark', 'district')),
+  geom       GEOMETRY(Geometry, 4326) NOT NULL,
+  created_at TIMESTAMP DEFAULT NOW(),
+  UNIQUE (name, kind)
+);
+
+CREATE INDEX IF NOT EXISTS idx_gazetteer_places_geom ON gazetteer_places USING GIST(geom);
+-- Same expression as idx_stops_name_trgm (008_stop_search.sql).
+CREATE INDEX IF NOT EXISTS idx_gazetteer_places_name_trgm
+  ON gazetteer_places USING GIN (lower(immutable_unaccent(name)) gin_trgm_ops);
+
+-- Demo landmarks and districts of central Lima (approximate coordinates).
+INSERT INTO gazetteer_places (name, kind, geom) VALUES
+  ('Plaza Mayor de Lima',        'landmark', ST_SetSRID(ST_Point(-77.0301, -12.0453), 4326)),
+  ('Parque Kennedy',             'landmark', ST_SetSRID(ST_Point(-77.0297, -12.1219), 4326)),
+  ('Óvalo Gutiérrez',            'landmark', ST_SetSRID(ST_Point(-77.0350, -12.1050), 4326)),
+  ('Real Plaza Centro Cívico',   'landmark', ST_SetSRID(ST_Point(-77.0370, -12.0563), 4326)),
+  ('Estadio Nacional',           'landmark', ST_SetSRID(ST_Point(-77.0336, -12.0671), 4326)),
+  ('Cercado de Lima',            'district', ST_SetSRID(ST_Point(-77.0428, -12.0464), 4326)),
+  ('Breña',                      'district', ST_SetSRID(ST_Point(-77.0500, -12.0597), 4326)),
+  ('La Victoria',                'district', ST_SetSRID(ST_Point(-77.0164, -12.0731), 4326)),
+  ('San Borja',                  'district', ST_SetSRID(ST_Point(-76.9986, -12.1000), 4326)),
+  ('San Isidro',                 'district', ST_SetSRID(ST_Point(-77.0365, -12.0977), 4326)),
+  ('Miraflores',                 'district', ST_SetSRID(ST_Point(-77.0297, -12.1211), 4326)),
+  ('Surquillo',                  'district', ST_SetSRID(ST_Point(-77.0197, -12.1128), 4326))
+ON CONFLICT DO NOTHING;
+
+-- =====================
+-- Cache table (unlogged, like the other caches)
+-- =====================
+
+-- Results of the external geocoding provider, keyed by normalized query
+-- ("fwd:<limit>:<query>") or origin geohash ("rev:<geohash>"). An empty
+-- array caches "no results".
+CREATE UNLOGGED TABLE IF NOT EXISTS geocode_cache (
+  cache_key  VARCHAR(300) PRIMARY KEY,
+  places     JSONB NOT NULL,
+  calc_ts    TIMESTAMP DEFAULT NOW(),
+  expires_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,42 @@
+-- Migration: 010_network_version
+-- A counter bumped by every edit of the network geometry. Caches derived from
+-- stops and routes (vector tiles) compare it to know when they are stale.
+
+-- Single-row table: id is always true.
+CREATE TABLE IF NOT EXISTS network_version (
+  id         BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+  version    BIGINT NOT NULL DEFAULT 1,
+  updated_at TIMESTAMP DEFAULT NOW()
+);
+
+INSERT INTO network_version (id) VALUES (true) ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION bump_network_version() RETURNS trigger
+  LANGUAGE plpgsql
+  AS $$
+BEGIN
+  UPDATE network_version SET version = version + 1, updated_at = NOW();
+  RETURN NULL;
+END
+$$;
+
+-- Statement-level: a bulk import bumps the version once, not once per row.
+DROP TRIGGER IF EXISTS trg_stops_network_version ON stops;
+CREATE TRIGGER trg_stops_network_version
+  AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON stops
+  FOR EACH STATEMENT EXECUTE FUNCTION bump_network_version();
+
+DROP TRIGGER IF EXISTS trg_routes_network_version ON routes;
+CREATE TRIGGER trg_routes_network_version
+  AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON routes
+  FOR EACH STATEMENT EXECUTE FUNCTION bump_network_version();
+
+DROP TRIGGER IF EXISTS trg_route_stops_network_version ON route_stops;
+CREATE TRIGGER trg_route_stops_network_version
+  AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON route_stops
+  FOR EACH STATEMENT EXECUTE FUNCTION bump_network_version();
+
+DROP TRIGGER IF EXISTS trg_route_shapes_network_version ON route_shapes;
+CREATE TRIGGER trg_route_shapes_network_version
+  AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON route_shapes
+  FOR EACH STATEMENT EXECUTE FUNCTION bump_network_version();
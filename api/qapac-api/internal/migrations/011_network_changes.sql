@@ -0,0 +1,90 @@
+-- Migration: 011_network_changes
+-- Change log of stops and routes, so offline clients can sync the network
+-- incrementally (GET /api/v1/bundle/diff?since=<version>).
+
+-- One row per stop or route changed in a network version (see
+-- 010_network_version.sql). A 'reset' row means the changes up to its version
+-- are not itemized and clients older than it need the full bundle.
+CREATE TABLE IF NOT EXISTS network_changes (
+  id         BIGSERIAL PRIMARY KEY,
+  version    BIGINT NOT NULL,
+  entity     VARCHAR(10) NOT NULL CHECK (entity IN ('stop', 'route', 'reset')),
+  entity_id  INT CHECK ((entity = 'reset') = (entity_id IS NULL)),
+  changed_at TIMESTAMP DEFAULT NOW(),
+  UNIQUE (version, entity, entity_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_network_changes_version ON network_changes(version);
+
+-- Nothing before this migration is itemized.
+INSERT INTO network_changes (version, entity)
+SELECT version, 'reset' FROM network_version;
+
+-- Row-level: logs the changed stop or route. TG_ARGV[0] is the entity and
+-- TG_ARGV[1] the column holding its ID (route_stops and route_shapes change
+-- their route).
+--
+-- Row triggers fire before the statement-level bump_network_version(), so the
+-- change belongs to the next version. FOR UPDATE waits for concurrent
+-- writers, which keeps the numbering in commit order.
+CREATE OR REPLACE FUNCTION log_network_change() RETURNS trigger
+  LANGUAGE plpgsql
+  AS $$
+DECLARE
+  v BIGINT;
+BEGIN
+  SELECT version + 1 INTO v FROM network_version FOR UPDATE;
+  IF TG_OP IN ('UPDATE', 'DELETE') THEN
+    INSERT INTO network_changes (version, entity, entity_id)
+    VALUES (v, TG_ARGV[0], (to_jsonb(OLD) ->> TG_ARGV[1])::int)
+    ON CONFLICT DO NOTHING;
+  END IF;
+  IF TG_OP IN ('INSERT', 'UPDATE') THEN
+    INSERT INTO network_changes (version, entity, entity_id)
+    VALUES (v, TG_ARGV[0], (to_jsonb(NEW) ->> TG_ARGV[1])::int)
+    ON CONFLICT DO NOTHING;
+  END IF;
+  RETURN NULL;
+END
+$$;
+
+-- TRUNCATE has no rows to log: clients must download the full bundle.
+CREATE OR REPLACE FUNCTION log_network_reset() RETURNS trigger
+  LANGUAGE plpgsql
+  AS $$
+BEGIN
+  INSERT INTO network_changes (version, entity)
+  SELECT version + 1, 'reset' FROM network_version FOR UPDATE;
+  RETURN NULL;
+END
+$$;
+
+DROP TRIGGER IF EXISTS trg_stops_network_changes ON stops;
+CREATE TRIGGER trg_stops_network_changes
+  AFTER INSERT OR UPDATE OR DELETE ON stops
+  FOR EACH ROW EXECUTE FUNCTION log_network_change('stop', 'id');
+
+DROP TRIGGER IF EXISTS trg_routes_network_changes ON routes;
+CREATE TRIGGER trg_routes_network_changes
+  AFTER INSERT OR UPDATE OR DELETE ON routes
+  FOR EACH ROW EXECUTE FUNCTION log_network_change('route', 'id');
+
+DROP TRIGGER IF EXISTS trg_route_stops_network_changes ON route_stops;
+CREATE TRIGGER trg_route_stops_network_changes
+  AFTER INSERT OR UPDATE OR DELETE ON route_stops
+  FOR EACH ROW EXECUTE FUNCTION log_network_change('route', 'route_id');
+
+DROP TRIGGER IF EXISTS trg_route_shapes_network_changes ON route_shapes;
+CREATE TRIGGER trg_route_shapes_network_changes
+  AFTER INSERT OR UPDATE OR DELETE ON route_shapes
+  FOR EACH ROW EXECUTE FUNCTION log_network_change('route', 'route_id');
+
+DROP TRIGGER IF EXISTS trg_network_reset ON stops;
+CREATE TRIGGER trg_network_reset
+  AFTER TRUNCATE ON stops
+  FOR EACH STATEMENT EXECUTE FUNCTION log_network_reset();
+
+DROP TRIGGER IF EXISTS trg_network_reset ON routes;
+CREATE TRIGGER trg_network_reset
+  AFTER TRUNCATE ON routes
+  FOR EACH STATEMENT EXECUTE FUNCTION log_network_reset();
@@ -0,0 +1,10 @@
+-- Migration: 012_route_cache_provider
+-- Routes come from an ordered chain of providers (see routing.ChainRouter);
+-- cached routes keep the name of the provider that computed them.
+
+-- Rows cached before this migration may be straight-line estimates stored
+-- when the Google API failed; the table is a cache, so drop them.
+TRUNCATE route_to_stop_cache;
+
+ALTER TABLE route_to_stop_cache
+  ADD COLUMN IF NOT EXISTS provider VARCHAR(20) NOT NULL;
@@ -0,0 +1,16 @@
+-- Migration: 013_route_cache_mode
+-- Routes are calculated for a travel mode (walk, drive or bicycle), which is
+-- part of the cache key.
+
+-- Routes cached so far were all calculated driving.
+ALTER TABLE route_to_stop_cache
+  ADD COLUMN IF NOT EXISTS mode VARCHAR(10) NOT NULL DEFAULT 'drive'
+    CHECK (mode IN ('walk', 'drive', 'bicycle'));
+ALTER TABLE route_to_stop_cache ALTER COLUMN mode DROP DEFAULT;
+
+ALTER TABLE route_to_stop_cache
+  DROP CONSTRAINT IF EXISTS route_to_stop_cache_origin_hash_stop_id_key;
+DROP INDEX IF EXISTS idx_route_cache_hash_stop;
+
+ALTER TABLE route_to_stop_cache
+  ADD CONSTRAINT route_to_stop_cache_origin_hash_stop_id_mode_key UNIQUE (origin_hash, stop_id, mode);
@@ -0,0 +1,7 @@
+-- Migration: 014_route_cache_details
+-- Turn-by-turn steps and alternate routes of cached routes. NULL means they
+-- were not requested: such an entry cannot answer a request that asks for
+-- them (see routing.CachedRouter).
+ALTER TABLE route_to_stop_cache
+  ADD COLUMN IF NOT EXISTS legs       JSONB,
+  ADD COLUMN IF NOT EXISTS alternates JSONB;
@@ -0,0 +1,7 @@
+-- Migration: 015_google_routes_usage
+-- Calls made to the Google Routes API per day (server local time), so that
+-- usage caps hold across restarts and instances (see routing.QuotaMeter).
+CREATE TABLE IF NOT EXISTS google_routes_usage (
+  day   DATE PRIMARY KEY,
+  calls BIGINT NOT NULL DEFAULT 0
+);
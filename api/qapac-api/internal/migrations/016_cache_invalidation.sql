@@ -0,0 +1,53 @@
+-- Migration: 016_cache_invalidation
+-- Every instance keeps the hottest cache entries in memory. Writes to the
+-- cache tables are notified on the cache_invalidation channel so that the
+-- other instances drop their copy; the payload format is read by
+-- cache.Store.Invalidate. Deletes are not notified: in-memory entries live a
+-- few seconds at most, so a deleted row is not served for much longer.
+
+CREATE OR REPLACE FUNCTION notify_route_cache_change() RETURNS trigger
+  LANGUAGE plpgsql
+  AS $$
+BEGIN
+  IF TG_OP = 'TRUNCATE' THEN
+    PERFORM pg_notify('cache_invalidation', 'route');
+  ELSE
+    PERFORM pg_notify('cache_invalidation',
+      'route|' || NEW.origin_hash || '|' || NEW.stop_id || '|' || NEW.mode);
+  END IF;
+  RETURN NULL;
+END
+$$;
+
+CREATE OR REPLACE FUNCTION notify_eta_cache_change() RETURNS trigger
+  LANGUAGE plpgsql
+  AS $$
+BEGIN
+  IF TG_OP = 'TRUNCATE' THEN
+    PERFORM pg_notify('cache_invalidation', 'eta');
+  ELSE
+    PERFORM pg_notify('cache_invalidation', 'eta|' || NEW.stop_id);
+  END IF;
+  RETURN NULL;
+END
+$$;
+
+DROP TRIGGER IF EXISTS trg_route_cache_notify ON route_to_stop_cache;
+CREATE TRIGGER trg_route_cache_notify
+  AFTER INSERT OR UPDATE ON route_to_stop_cache
+  FOR EACH ROW EXECUTE FUNCTION notify_route_cache_change();
+
+DROP TRIGGER IF EXISTS trg_route_cache_notify_truncate ON route_to_stop_cache;
+CREATE TRIGGER trg_route_cache_notify_truncate
+  AFTER TRUNCATE ON route_to_stop_cache
+  FOR EACH STATEMENT EXECUTE FUNCTION notify_route_cache_change();
+
+DROP TRIGGER IF EXISTS trg_eta_cache_notify ON stop_eta_cache;
+CREATE TRIGGER trg_eta_cache_notify
+  AFTER INSERT OR UPDATE ON stop_eta_cache
+  FOR EACH ROW EXECUTE FUNCTION notify_eta_cache_change();
+
+DROP TRIGGER IF EXISTS trg_eta_cache_notify_truncate ON stop_eta_cache;
+CREATE TRIGGER trg_eta_cache_notify_truncate
+  AFTER TRUNCATE ON stop_eta_cache
+  FOR EACH STATEMENT EXECUTE FUNCTION notify_eta_cache_change();
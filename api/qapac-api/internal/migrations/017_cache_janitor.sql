@@ -0,0 +1,17 @@
+-- Migration: 017_cache_janitor
+-- Expired cache rows are filtered on read but were never deleted. The
+-- janitor (cache.Janitor) deletes them in batches; these indexes let it find
+-- them without scanning the tables.
+CREATE INDEX IF NOT EXISTS idx_route_cache_expires_at ON route_to_stop_cache(expires_at);
+CREATE INDEX IF NOT EXISTS idx_eta_cache_expires_at ON stop_eta_cache(expires_at);
+CREATE INDEX IF NOT EXISTS idx_geocode_cache_expires_at ON geocode_cache(expires_at);
+
+-- Last janitor run, whichever instance made it. Single-row table: id is
+-- always true.
+CREATE TABLE IF NOT EXISTS cache_janitor_runs (
+  id          BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+  started_at  TIMESTAMPTZ NOT NULL,
+  finished_at TIMESTAMPTZ NOT NULL,
+  purged      JSONB NOT NULL,
+  error       TEXT
+);
@@ -0,0 +1,38 @@
+-- Migration: 018_cache_invalidation_origin
+-- NOTIFY is also delivered to the session's own instance, which then cleared
+-- the entry it had just written. Each instance tags its connections with
+-- set_config('qapac.instance', <id>) (cache.TagConnections); the payload now
+-- starts with that ID so the writer skips its own notifications. Sessions
+-- without the setting (psql, a build without the tag) send an empty ID,
+-- which every instance honours.
+
+CREATE OR REPLACE FUNCTION notify_route_cache_change() RETURNS trigger
+  LANGUAGE plpgsql
+  AS $$
+DECLARE
+  origin TEXT := COALESCE(current_setting('qapac.instance', true), '');
+BEGIN
+  IF TG_OP = 'TRUNCATE' THEN
+    PERFORM pg_notify('cache_invalidation', origin || '|route');
+  ELSE
+    PERFORM pg_notify('cache_invalidation',
+      origin || '|route|' || NEW.origin_hash || '|' || NEW.stop_id || '|' || NEW.mode);
+  END IF;
+  RETURN NULL;
+END
+$$;
+
+CREATE OR REPLACE FUNCTION notify_eta_cache_change() RETURNS trigger
+  LANGUAGE plpgsql
+  AS $$
+DECLARE
+  origin TEXT := COALESCE(current_setting('qapac.instance', true), '');
+BEGIN
+  IF TG_OP = 'TRUNCATE' THEN
+    PERFORM pg_notify('cache_invalidation', origin || '|eta');
+  ELSE
+    PERFORM pg_notify('cache_invalidation', origin || '|eta|' || NEW.stop_id);
+  END IF;
+  RETURN NULL;
+END
+$$;
@@ -0,0 +1,23 @@
+-- Migration: 019_vehicle_shifts
+-- Shifts: an assignment planned by the operator is also the shift of its
+-- crew. It gains the collector, and records when the driver actually started
+-- and ended it (starts_at / ends_at remain the plan). Only positions of a
+-- vehicle whose shift is in progress are ingested.
+
+-- collector_id stays a plain INT, like driver_id, until the users table
+-- exists (MVP v2-B).
+ALTER TABLE vehicle_assignments
+  ADD COLUMN IF NOT EXISTS collector_id INT,
+  ADD COLUMN IF NOT EXISTS started_at   TIMESTAMP,
+  ADD COLUMN IF NOT EXISTS ended_at     TIMESTAMP;
+
+ALTER TABLE vehicle_assignments
+  -- A shift can only end after it started.
+  ADD CONSTRAINT vehicle_assignments_shift_check
+    CHECK (ended_at IS NULL OR (started_at IS NOT NULL AND ended_at >= started_at)),
+  -- A collector works on one vehicle at a time.
+  ADD CONSTRAINT vehicle_assignments_collector_excl
+    EXCLUDE USING gist (collector_id WITH =, tsrange(starts_at, ends_at) WITH &&);
+
+-- Shift start and end look up the assignments of a driver.
+CREATE INDEX IF NOT EXISTS idx_vehicle_assignments_driver ON vehicle_assignments(driver_id, starts_at);
@@ -0,0 +1,33 @@
+-- Migration: 020_rider_trips
+-- Trip history of riders. There are no rider accounts yet (MVP v2-B): a trip
+-- belongs to the device ID the app generates on install and sends in the
+-- X-Device-ID header. When accounts exist, a user claims the trips of their
+-- devices.
+
+CREATE TABLE IF NOT EXISTS rider_trips (
+  id             SERIAL PRIMARY KEY,
+  device_id      VARCHAR(64) NOT NULL,
+  route_id       INT NOT NULL REFERENCES routes(id),
+  vehicle_id     INT REFERENCES vehicles(id),  -- NULL when the app does not know it
+  boarding_stop  INT NOT NULL REFERENCES stops(id),
+  alighting_stop INT REFERENCES stops(id),     -- NULL while open, or if the check-in was abandoned
+  boarded_at     TIMESTAMP NOT NULL,
+  alighted_at    TIMESTAMP,                    -- NULL while the check-in is open
+  -- Fare in céntimos, priced when the trip is completed and kept: a fare
+  -- change does not rewrite the history. NULL when no fare applies or the
+  -- alighting stop is unknown.
+  fare_cents     INT CHECK (fare_cents >= 0),
+  source         VARCHAR(20) NOT NULL CHECK (source IN ('manual', 'checkin')),
+  created_at     TIMESTAMP NOT NULL DEFAULT NOW(),
+  CHECK (alighted_at IS NULL OR alighted_at >= boarded_at),
+  CHECK (alighting_stop IS NULL OR alighted_at IS NOT NULL)
+);
+
+-- History pages and monthly summaries read the trips of one device, most
+-- recent first.
+CREATE INDEX IF NOT EXISTS idx_rider_trips_device
+  ON rider_trips(device_id, boarded_at DESC, id DESC);
+
+-- A device has at most one open check-in.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_rider_trips_device_open
+  ON rider_trips(device_id) WHERE alighted_at IS NULL;
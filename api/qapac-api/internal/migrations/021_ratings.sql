@@ -0,0 +1,27 @@
+-- Migration: 021_ratings
+-- Ratings of completed rider trips. A rating belongs to the trip, and through
+-- it to the rider's device; the vehicle and crew are copied from the trip and
+-- the shift in progress when it was boarded, so the rating keeps pointing at
+-- who drove even if the assignment is later deleted.
+
+CREATE TABLE IF NOT EXISTS ratings (
+  id            SERIAL PRIMARY KEY,
+  trip_id       INT NOT NULL UNIQUE REFERENCES rider_trips(id), -- one rating per trip
+  route_id      INT NOT NULL REFERENCES routes(id),
+  vehicle_id    INT REFERENCES vehicles(id),                      -- NULL when the trip has no vehicle
+  assignment_id INT REFERENCES vehicle_assignments(id) ON DELETE SET NULL,
+  -- driver_id and collector_id stay plain INTs, like in vehicle_assignments,
+  -- until the users table exists (MVP v2-B).
+  driver_id     INT,
+  collector_id  INT,
+  stars         SMALLINT NOT NULL CHECK (stars BETWEEN 1 AND 5),
+  comment       VARCHAR(500) NOT NULL DEFAULT '',
+  tags          TEXT[] NOT NULL DEFAULT '{}',  -- driving, cleanliness, courtesy, overcharging
+  status        VARCHAR(20) NOT NULL DEFAULT 'visible' CHECK (status IN ('visible', 'hidden')),
+  created_at    TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Scores aggregate the visible ratings of one driver, collector or route.
+CREATE INDEX IF NOT EXISTS idx_ratings_driver ON ratings(driver_id) WHERE status = 'visible';
+CREATE INDEX IF NOT EXISTS idx_ratings_collector ON ratings(collector_id) WHERE status = 'visible';
+CREATE INDEX IF NOT EXISTS idx_ratings_route ON ratings(route_id) WHERE status = 'visible';
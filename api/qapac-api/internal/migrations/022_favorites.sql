@@ -0,0 +1,27 @@
+-- Migration: 022_favorites
+-- Favorite stops and routes and named saved places of riders. Like the trip
+-- history (020), they belong to the device ID sent in X-Device-ID until rider
+-- accounts exist (MVP v2-B).
+
+CREATE TABLE IF NOT EXISTS favorite_stops (
+  device_id  VARCHAR(64) NOT NULL,
+  stop_id    INT NOT NULL REFERENCES stops(id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (device_id, stop_id)
+);
+
+CREATE TABLE IF NOT EXISTS favorite_routes (
+  device_id  VARCHAR(64) NOT NULL,
+  route_id   INT NOT NULL REFERENCES routes(id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (device_id, route_id)
+);
+
+CREATE TABLE IF NOT EXISTS saved_places (
+  id         SERIAL PRIMARY KEY,
+  device_id  VARCHAR(64) NOT NULL,
+  name       VARCHAR(50) NOT NULL,  -- "Casa", "Trabajo"
+  geom       GEOMETRY(POINT, 4326) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  UNIQUE (device_id, name)
+);
@@ -81,6 +81,24 @@ func CheckSchema(ctx context.Context, pool *pgxpool.Pool) error {
 		"route_shapes",
 		"stop_eta_cache",
 		"route_to_stop_cache",
+		"route_deviation_incidents",
+		"stop_arrivals",
+		"vehicles",
+		"vehicle_assignments",
+		"fare_products",
+		"fare_leg_rules",
+		"occupancy_reports",
+		"rider_trips",
+		"ratings",
+		"favorite_stops",
+		"favorite_routes",
+		"saved_places",
+		"gazetteer_places",
+		"geocode_cache",
+		"network_version",
+		"network_changes",
+		"google_routes_usage",
+		"cache_janitor_runs",
 	}
 
 	for _, table := range required {
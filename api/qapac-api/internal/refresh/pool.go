@@ -0,0 +1,157 @@
+// Package refresh runs the background refreshes of stale cache entries: the
+// route and ETA caches serve an entry past its soft TTL and hand the
+// recomputation to a Pool instead of making the rider wait for it.
+package refresh
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultQueueSize bounds the refreshes waiting for a worker. When the
+	// queue is full new ones are dropped: the entry stays stale and the next
+	// request for it submits again.
+	DefaultQueueSize = 256
+
+	// jobTimeout is the deadline of each refresh.
+	jobTimeout = 30 * time.Second
+)
+
+// Job recomputes one cache entry.
+type Job func(ctx context.Context)
+
+type job struct {
+	key string
+	fn  Job
+}
+
+// Pool runs Jobs on a fixed number of workers. A key already queued or
+// running is not submitted again, so many requests for the same stale entry
+// cost one refresh.
+type Pool struct {
+	ctx       context.Context
+	workers   int
+	queueSize int
+	jobs      chan job
+
+	mu      sync.Mutex
+	pending map[string]struct{} // queued or running
+
+	submitted, deduplicated, dropped, completed atomic.Uint64
+}
+
+// Option configures a Pool.
+type Option func(*Pool)
+
+// WithQueueSize overrides DefaultQueueSize.
+func WithQueueSize(n int) Option {
+	return func(p *Pool) { p.queueSize = n }
+}
+
+// NewPool starts workers that run the submitted Jobs until ctx is done.
+func NewPool(ctx context.Context, workers int, opts ...Option) *Pool {
+	p := &Pool{
+		ctx:       ctx,
+		workers:   workers,
+		queueSize: DefaultQueueSize,
+		pending:   make(map[string]struct{}),
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	p.jobs = make(chan job, p.queueSize)
+	for range workers {
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues fn under key and reports whether it did. It does not block:
+// fn is not queued when key is already pending, the queue is full or the
+// pool is stopped.
+func (p *Pool) Submit(key string, fn Job) bool {
+	if p.ctx.Err() != nil {
+		return false
+	}
+
+	p.mu.Lock()
+	if _, ok := p.pending[key]; ok {
+		p.mu.Unlock()
+		p.deduplicated.Add(1)
+		return false
+	}
+	p.pending[key] = struct{}{}
+	p.mu.Unlock()
+
+	select {
+	case p.jobs <- job{key: key, fn: fn}:
+		p.submitted.Add(1)
+		return true
+	default:
+		p.done(key)
+		p.dropped.Add(1)
+		return false
+	}
+}
+
+func (p *Pool) work() {
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case j := <-p.jobs:
+			p.run(j)
+		}
+	}
+}
+
+func (p *Pool) run(j job) {
+	ctx, cancel := context.WithTimeout(p.ctx, jobTimeout)
+	defer cancel()
+	defer p.done(j.key)
+
+	j.fn(ctx)
+	p.completed.Add(1)
+}
+
+func (p *Pool) done(key string) {
+	p.mu.Lock()
+	delete(p.pending, key)
+	p.mu.Unlock()
+}
+
+// Stats counts the refreshes of a Pool since start.
+type Stats struct {
+	Workers   int `json:"workers"`
+	QueueSize int `json:"queue_size"`
+	// Pending is the number of refreshes queued or running now.
+	Pending int `json:"pending"`
+	// Submitted is the number of refreshes queued.
+	Submitted uint64 `json:"submitted"`
+	// Deduplicated is the number of submits skipped because the same entry
+	// was already pending.
+	Deduplicated uint64 `json:"deduplicated"`
+	// Dropped is the number of submits skipped because the queue was full.
+	Dropped uint64 `json:"dropped"`
+	// Completed is the number of refreshes that ran.
+	Completed uint64 `json:"completed"`
+}
+
+// Stats returns the size and counters of the pool.
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	pending := len(p.pending)
+	p.mu.Unlock()
+	return Stats{
+		Workers:      p.workers,
+		QueueSize:    p.queueSize,
+		Pending:      pending,
+		Submitted:    p.submitted.Load(),
+		Deduplicated: p.deduplicated.Load(),
+		Dropped:      p.dropped.Load(),
+		Completed:    p.completed.Load(),
+	}
+}
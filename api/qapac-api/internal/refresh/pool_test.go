@@ -0,0 +1,106 @@
+package refresh
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it holds or the test times out.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPool_RunsJobs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := NewPool(ctx, 2)
+
+	var ran atomic.Int32
+	for _, key := range []string{"a", "b", "c"} {
+		if !p.Submit(key, func(context.Context) { ran.Add(1) }) {
+			t.Fatalf("Submit(%s) = false, want true", key)
+		}
+	}
+	waitFor(t, func() bool { return p.Stats().Completed == 3 })
+
+	if ran.Load() != 3 {
+		t.Errorf("jobs run = %d, want 3", ran.Load())
+	}
+	if st := p.Stats(); st.Submitted != 3 || st.Pending != 0 {
+		t.Errorf("stats = %+v, want 3 submitted, none pending", st)
+	}
+}
+
+func TestPool_SameKeyPending_Deduplicated(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := NewPool(ctx, 1)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	p.Submit("a", func(context.Context) {
+		close(started)
+		<-release
+	})
+	<-started
+
+	if p.Submit("a", func(context.Context) {}) {
+		t.Error("Submit of a running key = true, want false")
+	}
+	close(release)
+	waitFor(t, func() bool { return p.Stats().Pending == 0 })
+
+	// Once done, the key can be refreshed again.
+	if !p.Submit("a", func(context.Context) {}) {
+		t.Error("Submit after the job finished = false, want true")
+	}
+	if st := p.Stats(); st.Deduplicated != 1 {
+		t.Errorf("deduplicated = %d, want 1", st.Deduplicated)
+	}
+}
+
+func TestPool_QueueFull_Drops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := NewPool(ctx, 1, WithQueueSize(1))
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	p.Submit("running", func(context.Context) {
+		close(started)
+		<-release
+	})
+	<-started
+
+	if !p.Submit("queued", func(context.Context) {}) {
+		t.Fatal("Submit into the free queue slot = false, want true")
+	}
+	if p.Submit("dropped", func(context.Context) {}) {
+		t.Error("Submit into a full queue = true, want false")
+	}
+	close(release)
+	waitFor(t, func() bool { return p.Stats().Completed == 2 })
+
+	if st := p.Stats(); st.Dropped != 1 || st.Submitted != 2 {
+		t.Errorf("stats = %+v, want 2 submitted, 1 dropped", st)
+	}
+}
+
+func TestPool_Stopped_RejectsJobs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := NewPool(ctx, 1)
+	cancel()
+
+	if p.Submit("a", func(context.Context) { t.Error("job ran after stop") }) {
+		t.Error("Submit after stop = true, want false")
+	}
+}
@@ -0,0 +1,235 @@
+package routing
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets every call through and tracks the error rate.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects calls until the cooldown elapses.
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe call through: its outcome closes or
+	// re-opens the breaker.
+	BreakerHalfOpen
+)
+
+// String returns the lowercase name of s.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+const (
+	// defaultBreakerWindow is the span over which the error rate is measured.
+	defaultBreakerWindow = 30 * time.Second
+
+	// breakerBuckets is the number of slices the window is divided into;
+	// outcomes expire one slice at a time.
+	breakerBuckets = 10
+
+	// defaultBreakerMinRequests avoids tripping on a single early failure.
+	defaultBreakerMinRequests = 5
+
+	// defaultBreakerFailureRatio is the error rate that opens the breaker.
+	defaultBreakerFailureRatio = 0.5
+
+	// defaultBreakerCooldown is how long an open breaker rejects calls before
+	// letting a probe through.
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+type breakerBucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+// CircuitBreaker stops calling a provider that keeps failing. It opens when,
+// over the last window, at least minRequests calls were made and the failure
+// ratio reached failureRatio; after cooldown it lets one probe through.
+//
+// Every call allowed by Allow must be reported with exactly one of Success,
+// Failure or Ignore.
+type CircuitBreaker struct {
+	window        time.Duration
+	minRequests   int
+	failureRatio  float64
+	cooldown      time.Duration
+	now           func() time.Time
+	onStateChange func(from, to BreakerState)
+
+	mu       sync.Mutex
+	state    BreakerState
+	openedAt time.Time
+	probing  bool // a half-open probe is in flight
+	buckets  [breakerBuckets]breakerBucket
+}
+
+// BreakerOption configures a CircuitBreaker.
+type BreakerOption func(*CircuitBreaker)
+
+// WithBreakerThreshold overrides the error-rate window, the minimum number of
+// calls in the window and the failure ratio that opens the breaker.
+func WithBreakerThreshold(window time.Duration, minRequests int, failureRatio float64) BreakerOption {
+	return func(b *CircuitBreaker) {
+		b.window = window
+		b.minRequests = minRequests
+		b.failureRatio = failureRatio
+	}
+}
+
+// WithBreakerCooldown overrides how long the breaker stays open.
+func WithBreakerCooldown(d time.Duration) BreakerOption {
+	return func(b *CircuitBreaker) { b.cooldown = d }
+}
+
+// WithBreakerStateChange sets a function called (with the lock held) on
+// every state transition.
+func WithBreakerStateChange(fn func(from, to BreakerState)) BreakerOption {
+	return func(b *CircuitBreaker) { b.onStateChange = fn }
+}
+
+// withBreakerClock injects a fake clock for unit testing.
+func withBreakerClock(fn func() time.Time) BreakerOption {
+	return func(b *CircuitBreaker) { b.now = fn }
+}
+
+// NewCircuitBreaker creates a closed CircuitBreaker.
+func NewCircuitBreaker(opts ...BreakerOption) *CircuitBreaker {
+	b := &CircuitBreaker{
+		window:       defaultBreakerWindow,
+		minRequests:  defaultBreakerMinRequests,
+		failureRatio: defaultBreakerFailureRatio,
+		cooldown:     defaultBreakerCooldown,
+		now:          time.Now,
+	}
+	for _, o := range opts {
+		o(b)
+	}
+	return b
+}
+
+// State returns the current state.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Allow reports whether a call may proceed.
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+	}
+	// Half-open: one probe at a time.
+	if b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// Success records a successful call.
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerHalfOpen:
+		b.probing = false
+		b.buckets = [breakerBuckets]breakerBucket{}
+		b.setState(BreakerClosed)
+	case BreakerClosed:
+		b.bucket().successes++
+	}
+}
+
+// Failure records a failed call and opens the breaker when the error rate
+// crosses the threshold.
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerHalfOpen:
+		b.probing = false
+		b.open()
+	case BreakerClosed:
+		b.bucket().failures++
+		var successes, failures int
+		cutoff := b.now().Add(-b.window)
+		for _, bk := range b.buckets {
+			if bk.start.After(cutoff) {
+				successes += bk.successes
+				failures += bk.failures
+			}
+		}
+		total := successes + failures
+		if total >= b.minRequests && float64(failures) >= b.failureRatio*float64(total) {
+			b.open()
+		}
+	}
+}
+
+// Ignore releases a call whose outcome says nothing about the provider, such
+// as one cancelled by the caller.
+func (b *CircuitBreaker) Ignore() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen {
+		b.probing = false
+	}
+}
+
+// bucket returns the bucket of the current time slice, clearing it if it
+// still holds an older slice.
+func (b *CircuitBreaker) bucket() *breakerBucket {
+	size := b.window / breakerBuckets
+	start := b.now().Truncate(size)
+	bk := &b.buckets[(start.UnixNano()/int64(size))%breakerBuckets]
+	if !bk.start.Equal(start) {
+		*bk = breakerBucket{start: start}
+	}
+	return bk
+}
+
+func (b *CircuitBreaker) open() {
+	b.openedAt = b.now()
+	b.setState(BreakerOpen)
+}
+
+func (b *CircuitBreaker) setState(s BreakerState) {
+	if s == b.state {
+		return
+	}
+	from := b.state
+	b.state = s
+	if b.onStateChange != nil {
+		b.onStateChange(from, s)
+	}
+}
@@ -2,18 +2,29 @@ package routing
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
+	"github.com/dom1nux/qapac-api/internal/refresh"
+	"github.com/dom1nux/qapac-api/internal/storage"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mmcloughlin/geohash"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
-	// cacheTTL is how long a cached route entry remains valid.
-	cacheTTL = 120 * time.Second
+	// cacheSoftTTL is how long a cached route is served as fresh. Past it,
+	// and until cacheHardTTL, it is still served while a refresh runs in the
+	// background (see WithRefreshPool).
+	cacheSoftTTL = 120 * time.Second
+
+	// cacheHardTTL is how long a cached route entry remains valid at all.
+	cacheHardTTL = 10 * time.Minute
 
 	// cacheQueryTimeout is the deadline for each cache read/write query.
 	cacheQueryTimeout = 5 * time.Second
@@ -35,11 +46,18 @@ const (
 // test double in unit tests.
 type CacheStore interface {
 	// GetCachedRoute returns a cached RoutingResponse for the given key, or
-	// (nil, nil) when there is no valid (non-expired) entry.
-	GetCachedRoute(ctx context.Context, originHash string, stopID int32) (*RoutingResponse, error)
-
-	// SetCachedRoute upserts a route entry with an expiry of now + cacheTTL.
-	SetCachedRoute(ctx context.Context, originHash string, stopID int32, resp *RoutingResponse) error
+	// (nil, nil) when there is no valid (non-expired) entry. CachedAt is set
+	// on the returned response.
+	GetCachedRoute(ctx context.Context, originHash string, stopID int32, mode TravelMode) (*RoutingResponse, error)
+
+	// GetCachedRouteNear is GetCachedRoute for any origin whose geohash
+	// starts with cell, i.e. lies in that coarser cell. Used when the quota
+	// of a paid provider runs low.
+	GetCachedRouteNear(ctx context.Context, cell string, stopID int32, mode TravelMode) (*RoutingResponse, error)
+
+	// SetCachedRoute upserts a route entry computed now, with an expiry of
+	// now + cacheHardTTL.
+	SetCachedRoute(ctx context.Context, originHash string, stopID int32, mode TravelMode, resp *RoutingResponse) error
 }
 
 // Logger is a printf-style logging function injected into CachedRouter.
@@ -48,12 +66,39 @@ type CacheStore interface {
 type Logger func(format string, args ...any)
 
 // CachedRouter wraps another Router and transparently caches its results.
-// Cache keys are composed of a geohash of the origin and the destination stop ID.
+// Cache keys are composed of a geohash of the origin, the destination stop ID
+// and the travel mode.
+//
+// Concurrent misses for the same key share a single call to the inner Router:
+// riders in the same cell asking for the same stop at once cost one upstream
+// call, not one each.
+//
+// With a refresh pool, an entry older than cacheSoftTTL is still served while
+// the pool recomputes it; without one, it counts as a miss.
 type CachedRouter struct {
 	inner      Router
 	store      CacheStore
-	logger     Logger // called when async cache writes fail; nil = silent
+	logger     Logger        // called when async cache writes fail; nil = silent
+	quota      *QuotaMeter   // widens lookups at the soft cap; nil = never
+	refresh    *refresh.Pool // refreshes stale entries; nil = treat them as misses
+	now        func() time.Time
 	afterStore func() // optional hook called after every async store attempt; used in tests for synchronization
+
+	flights     singleflight.Group
+	misses      atomic.Uint64
+	flightCount atomic.Uint64
+}
+
+// CoalesceStats counts the cache misses of a CachedRouter and how many of
+// them were answered by a call already in flight.
+type CoalesceStats struct {
+	// Misses is the number of requests not answered by the cache.
+	Misses uint64 `json:"misses"`
+	// Flights is the number of misses resolved by a call of their own.
+	Flights uint64 `json:"flights"`
+	// Deduplicated is Misses - Flights: the misses that shared the call of
+	// an earlier one instead.
+	Deduplicated uint64 `json:"deduplicated"`
 }
 
 // CachedRouterOption configures a CachedRouter.
@@ -66,6 +111,28 @@ func WithLogger(l Logger) CachedRouterOption {
 	return func(r *CachedRouter) { r.logger = l }
 }
 
+// WithQuotaMeter switches the metered provider to cache only once m reaches
+// its soft cap: a miss is looked up again in the surrounding geohash cell
+// (±610m), trading route accuracy for fewer paid calls, and a miss there
+// too is routed by the inner router without the providers metered with
+// WithGoogleQuota, which return ErrQuotaExceeded.
+func WithQuotaMeter(m *QuotaMeter) CachedRouterOption {
+	return func(r *CachedRouter) { r.quota = m }
+}
+
+// WithRefreshPool serves routes past their soft TTL and refreshes them on p
+// instead of making the caller wait for the provider. Refreshes are skipped
+// while the quota meter is at its soft cap: the stale route is served until
+// its hard TTL instead of paying for a new one.
+func WithRefreshPool(p *refresh.Pool) CachedRouterOption {
+	return func(r *CachedRouter) { r.refresh = p }
+}
+
+// withClock injects a fake clock for unit testing.
+func withClock(fn func() time.Time) CachedRouterOption {
+	return func(r *CachedRouter) { r.now = fn }
+}
+
 // withAfterStore sets a hook called after every async store attempt (success or
 // failure). Intended exclusively for test synchronization — do not use in production.
 func withAfterStore(fn func()) CachedRouterOption {
@@ -75,7 +142,7 @@ func withAfterStore(fn func()) CachedRouterOption {
 // NewCachedRouter wraps inner with a cache-aside layer backed by store.
 // Optional behavior (logging, test synchronization) is configured via opts.
 func NewCachedRouter(inner Router, store CacheStore, opts ...CachedRouterOption) *CachedRouter {
-	r := &CachedRouter{inner: inner, store: store}
+	r := &CachedRouter{inner: inner, store: store, now: time.Now}
 	for _, o := range opts {
 		o(r)
 	}
@@ -84,9 +151,14 @@ func NewCachedRouter(inner Router, store CacheStore, opts ...CachedRouterOption)
 
 // Route satisfies the Router interface.
 // It checks the cache first; on a miss it delegates to the inner Router and
-// persists the result.
+// persists the result. A caller whose context ends while waiting for a shared
+// call returns its context error; the call goes on for the others.
+//
+// A route served from the cache has CachedAt set; one computed for this call
+// does not.
 func (r *CachedRouter) Route(ctx context.Context, req RoutingRequest) (*RoutingResponse, error) {
 	key := originHash(req.OriginLat, req.OriginLon)
+	mode := req.mode()
 	stopID := noStopID // sentinel: no stop ID in context
 
 	// When callers supply the stop ID through the context (see WithStopID),
@@ -95,21 +167,114 @@ func (r *CachedRouter) Route(ctx context.Context, req RoutingRequest) (*RoutingR
 		stopID = id
 	}
 
-	cached, err := r.store.GetCachedRoute(ctx, key, stopID)
+	cached, err := r.store.GetCachedRoute(ctx, key, stopID, mode)
 	if err != nil {
 		// Cache read failures are non-fatal: fall through to the real router.
 		_ = err
 	}
-	if cached != nil {
+	if covers(cached, req) && r.usable(cached, req, key, stopID, mode) {
 		return cached, nil
 	}
 
-	// Cache miss — call the inner router.
+	// Cache miss — call the inner router, sharing the call with concurrent
+	// misses for the same request.
+	r.misses.Add(1)
+	flightKey := fmt.Sprintf("%s|%s|%d|%s|%t|%t", key,
+		originHash(req.DestinationLat, req.DestinationLon), stopID, mode, req.Steps, req.Alternatives)
+	ch := r.flights.DoChan(flightKey, func() (any, error) {
+		// The call outlives a caller that goes away: others may be waiting.
+		return r.route(context.WithoutCancel(ctx), req, key, stopID, mode)
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*RoutingResponse), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// CoalesceStats returns the miss and deduplication counters since start.
+func (r *CachedRouter) CoalesceStats() CoalesceStats {
+	// Read flights first: it never exceeds misses read afterwards.
+	flights := r.flightCount.Load()
+	misses := r.misses.Load()
+	return CoalesceStats{Misses: misses, Flights: flights, Deduplicated: misses - flights}
+}
+
+// usable reports whether a cached entry can be served. An entry past
+// cacheSoftTTL is only served with a refresh pool, which is then asked to
+// recompute it.
+func (r *CachedRouter) usable(cached *RoutingResponse, req RoutingRequest, key string, stopID int32, mode TravelMode) bool {
+	if r.now().Sub(cached.CachedAt) < cacheSoftTTL {
+		return true
+	}
+	if r.refresh == nil {
+		return false
+	}
+
+	// Keep what the stale entry had, so that the refreshed one still
+	// answers the requests it answered.
+	req.Steps = req.Steps || cached.Legs != nil
+	req.Alternatives = req.Alternatives || cached.Alternates != nil
+	r.refresh.Submit(fmt.Sprintf("route|%s|%d|%s", key, stopID, mode), func(ctx context.Context) {
+		r.revalidate(WithStopID(ctx, stopID), req, key, stopID, mode)
+	})
+	return true
+}
+
+// revalidate recomputes a stale entry and replaces it. On failure the stale
+// entry stays until its hard TTL; the next request submits again.
+func (r *CachedRouter) revalidate(ctx context.Context, req RoutingRequest, key string, stopID int32, mode TravelMode) {
+	if r.quota != nil && r.quota.Level(ctx) >= QuotaSoft {
+		return
+	}
+	resp, err := r.inner.Route(ctx, req)
+	if err != nil {
+		if r.logger != nil {
+			r.logger("routing: cache: refresh failed (origin=%s stop=%d mode=%s): %v", key, stopID, mode, err)
+		}
+		return
+	}
+	if resp.IsFallback {
+		return
+	}
+	if err := r.store.SetCachedRoute(ctx, key, stopID, mode, resp); err != nil && r.logger != nil {
+		r.logger("routing: cache: refresh write failed (origin=%s stop=%d mode=%s): %v", key, stopID, mode, err)
+	}
+}
+
+// route resolves a cache miss: it searches the wider cell when the quota is
+// low, then calls the inner router and persists the result. At the soft cap
+// the inner router is called without the metered providers.
+func (r *CachedRouter) route(ctx context.Context, req RoutingRequest, key string, stopID int32, mode TravelMode) (*RoutingResponse, error) {
+	r.flightCount.Add(1)
+	if r.quota != nil && r.quota.Level(ctx) >= QuotaSoft {
+		near, err := r.store.GetCachedRouteNear(ctx, key[:wideGeohashPrecision], stopID, mode)
+		if err != nil && r.logger != nil {
+			r.logger("routing: cache: near lookup failed (cell=%s stop=%d): %v", key[:wideGeohashPrecision], stopID, err)
+		}
+		if covers(near, req) {
+			return near, nil
+		}
+		// Cache only for the paid provider: the chain moves on to the
+		// free ones.
+		ctx = withSkipMetered(ctx)
+	}
+
 	resp, err := r.inner.Route(ctx, req)
 	if err != nil {
 		return nil, err
 	}
 
+	// Straight-line estimates are not cached: the next request should try
+	// the real providers again.
+	if resp.IsFallback {
+		return resp, nil
+	}
+
 	// Persist asynchronously so we don't add cache-write latency to the hot path.
 	// We use a background context to avoid cancellation if the caller's context
 	// expires right after the API call returns.
@@ -117,9 +282,9 @@ func (r *CachedRouter) Route(ctx context.Context, req RoutingRequest) (*RoutingR
 		storeCtx, cancel := context.WithTimeout(context.Background(), cacheQueryTimeout)
 		defer cancel()
 
-		if err := r.store.SetCachedRoute(storeCtx, key, stopID, resp); err != nil {
+		if err := r.store.SetCachedRoute(storeCtx, key, stopID, mode, resp); err != nil {
 			if r.logger != nil {
-				r.logger("routing: cache: async write failed (origin=%s stop=%d): %v", key, stopID, err)
+				r.logger("routing: cache: async write failed (origin=%s stop=%d mode=%s): %v", key, stopID, mode, err)
 			}
 		}
 
@@ -131,6 +296,13 @@ func (r *CachedRouter) Route(ctx context.Context, req RoutingRequest) (*RoutingR
 	return resp, nil
 }
 
+// covers reports whether a cached entry can answer req. An entry stored
+// without steps or alternates cannot answer a request that asks for them;
+// the new route replaces it.
+func covers(cached *RoutingResponse, req RoutingRequest) bool {
+	return cached != nil && (!req.Steps || cached.Legs != nil) && (!req.Alternatives || cached.Alternates != nil)
+}
+
 // originHash returns a geohash string that uniquely identifies the origin cell.
 func originHash(lat, lon float64) string {
 	return geohash.EncodeWithPrecision(lat, lon, geohashPrecision)
@@ -149,24 +321,58 @@ func NewPgCacheStore(pool *pgxpool.Pool) CacheStore {
 }
 
 // GetCachedRoute queries route_to_stop_cache for a valid (non-expired) entry.
-func (s *pgCacheStore) GetCachedRoute(ctx context.Context, originHash string, stopID int32) (*RoutingResponse, error) {
-	ctx, cancel := context.WithTimeout(ctx, cacheQueryTimeout)
-	defer cancel()
-
+func (s *pgCacheStore) GetCachedRoute(ctx context.Context, originHash string, stopID int32, mode TravelMode) (*RoutingResponse, error) {
 	const q = `
-		SELECT polyline, distance_m, duration_s
+		SELECT polyline, distance_m, duration_s, provider, legs, alternates, calc_ts
 		FROM route_to_stop_cache
 		WHERE origin_hash = $1
 		  AND stop_id     = $2
+		  AND mode        = $3
 		  AND expires_at  > NOW()`
 
+	return s.getCachedRoute(ctx, q, originHash, stopID, mode)
+}
+
+// GetCachedRouteNear returns the most recent valid entry whose origin lies
+// in cell, preferring ones with steps and alternates.
+func (s *pgCacheStore) GetCachedRouteNear(ctx context.Context, cell string, stopID int32, mode TravelMode) (*RoutingResponse, error) {
+	const q = `
+		SELECT polyline, distance_m, duration_s, provider, legs, alternates, calc_ts
+		FROM route_to_stop_cache
+		WHERE origin_hash LIKE $1 || '%'
+		  AND stop_id     = $2
+		  AND mode        = $3
+		  AND expires_at  > NOW()
+		ORDER BY (legs IS NOT NULL) DESC, (alternates IS NOT NULL) DESC, calc_ts DESC
+		LIMIT 1`
+
+	return s.getCachedRoute(ctx, q, cell, stopID, mode)
+}
+
+// getCachedRoute runs a lookup query with (origin, stop_id, mode) arguments.
+func (s *pgCacheStore) getCachedRoute(ctx context.Context, q, origin string, stopID int32, mode TravelMode) (*RoutingResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, cacheQueryTimeout)
+	defer cancel()
+
 	var (
-		polyline  string
-		distanceM int32
-		durationS int32
+		polyline   string
+		distanceM  int32
+		durationS  int32
+		provider   string
+		legs       []byte
+		alternates []byte
+		calcTS     pgtype.Timestamp
 	)
 
-	err := s.pool.QueryRow(ctx, q, originHash, stopID).Scan(&polyline, &distanceM, &durationS)
+	err := s.pool.QueryRow(ctx, q, origin, stopID, string(mode)).Scan(
+		&polyline,
+		&distanceM,
+		&durationS,
+		&provider,
+		&legs,
+		&alternates,
+		&calcTS,
+	)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, nil // cache miss
 	}
@@ -174,41 +380,82 @@ func (s *pgCacheStore) GetCachedRoute(ctx context.Context, originHash string, st
 		return nil, fmt.Errorf("routing: cache: get: %w", err)
 	}
 
-	return &RoutingResponse{
+	resp := &RoutingResponse{
 		Polyline:  polyline,
 		DistanceM: int(distanceM),
 		DurationS: int(durationS),
-	}, nil
+		Provider:  provider,
+		CachedAt:  storage.LocalTime(calcTS),
+	}
+	if legs != nil {
+		if err := json.Unmarshal(legs, &resp.Legs); err != nil {
+			return nil, fmt.Errorf("routing: cache: get: decode legs: %w", err)
+		}
+	}
+	if alternates != nil {
+		if err := json.Unmarshal(alternates, &resp.Alternates); err != nil {
+			return nil, fmt.Errorf("routing: cache: get: decode alternates: %w", err)
+		}
+	}
+	return resp, nil
 }
 
 // SetCachedRoute upserts a route entry into route_to_stop_cache.
-// The expiry time is computed in Go from cacheTTL so that the constant is the
-// single source of truth — the SQL never encodes the TTL value directly.
-func (s *pgCacheStore) SetCachedRoute(ctx context.Context, originHash string, stopID int32, resp *RoutingResponse) error {
+// Both timestamps are computed in Go so that cacheHardTTL is the single
+// source of truth — the SQL never encodes the TTL value directly — and the
+// age of an entry is measured with the clock of the service, not the
+// database.
+func (s *pgCacheStore) SetCachedRoute(ctx context.Context, originHash string, stopID int32, mode TravelMode, resp *RoutingResponse) error {
 	ctx, cancel := context.WithTimeout(ctx, cacheQueryTimeout)
 	defer cancel()
 
-	expiresAt := time.Now().Add(cacheTTL)
+	calcTS := time.Now()
+	expiresAt := calcTS.Add(cacheHardTTL)
+
+	// nil slices (not requested) are stored as NULL rather than JSON null.
+	var legs, alternates []byte
+	if resp.Legs != nil {
+		b, err := json.Marshal(resp.Legs)
+		if err != nil {
+			return fmt.Errorf("routing: cache: set: encode legs: %w", err)
+		}
+		legs = b
+	}
+	if resp.Alternates != nil {
+		b, err := json.Marshal(resp.Alternates)
+		if err != nil {
+			return fmt.Errorf("routing: cache: set: encode alternates: %w", err)
+		}
+		alternates = b
+	}
 
 	const q = `
 		INSERT INTO route_to_stop_cache
-			(origin_hash, stop_id, polyline, distance_m, duration_s, calc_ts, expires_at)
+			(origin_hash, stop_id, mode, polyline, distance_m, duration_s, provider, legs, alternates, calc_ts, expires_at)
 		VALUES
-			($1, $2, $3, $4, $5, NOW(), $6)
-		ON CONFLICT (origin_hash, stop_id)
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (origin_hash, stop_id, mode)
 		DO UPDATE SET
 			polyline   = EXCLUDED.polyline,
 			distance_m = EXCLUDED.distance_m,
 			duration_s = EXCLUDED.duration_s,
+			provider   = EXCLUDED.provider,
+			legs       = EXCLUDED.legs,
+			alternates = EXCLUDED.alternates,
 			calc_ts    = EXCLUDED.calc_ts,
 			expires_at = EXCLUDED.expires_at`
 
 	_, err := s.pool.Exec(ctx, q,
 		originHash,
 		stopID,
+		string(mode),
 		resp.Polyline,
 		int32(resp.DistanceM),
 		int32(resp.DurationS),
+		resp.Provider,
+		legs,
+		alternates,
+		calcTS,
 		expiresAt,
 	)
 	if err != nil {
@@ -221,7 +468,10 @@ func (s *pgCacheStore) SetCachedRoute(ctx context.Context, originHash string, st
 
 type contextKey int
 
-const stopIDKey contextKey = iota
+const (
+	stopIDKey contextKey = iota
+	skipMeteredKey
+)
 
 // WithStopID returns a new context carrying the stop ID.
 // CachedRouter reads this to build a more precise cache key.
@@ -240,3 +490,15 @@ func StopIDFromContext(ctx context.Context) (int32, bool) {
 func stopIDFromContext(ctx context.Context) (int32, bool) {
 	return StopIDFromContext(ctx)
 }
+
+// withSkipMetered marks a call that must not reach a provider with a quota
+// meter. CachedRouter sets it at the soft cap once the cache missed.
+func withSkipMetered(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipMeteredKey, true)
+}
+
+// skipMetered reports whether ctx was marked by withSkipMetered.
+func skipMetered(ctx context.Context) bool {
+	v, _ := ctx.Value(skipMeteredKey).(bool)
+	return v
+}
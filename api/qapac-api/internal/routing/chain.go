@@ -0,0 +1,137 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Provider names reported in RoutingResponse.Provider.
+const (
+	ProviderGoogle       = "google"
+	ProviderOSRM         = "osrm"
+	ProviderValhalla     = "valhalla"
+	ProviderStraightLine = "straight_line"
+)
+
+// ErrCircuitOpen is reported for a provider skipped because its circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// ChainLink is a provider of a ChainRouter.
+type ChainLink struct {
+	Name   string
+	Router Router
+}
+
+type chainLink struct {
+	ChainLink
+	breaker *CircuitBreaker
+}
+
+// ChainRouter is a Router that tries its providers in order and returns the
+// first answer. Each provider has its own CircuitBreaker, so a provider that
+// keeps failing is skipped without being called until it recovers.
+//
+// End the chain with StraightLineRouter so that a route is always returned:
+//
+//	routing.NewChainRouter([]routing.ChainLink{
+//		{Name: routing.ProviderOSRM, Router: osrm},
+//		{Name: routing.ProviderGoogle, Router: google},
+//		{Name: routing.ProviderStraightLine, Router: routing.StraightLineRouter{}},
+//	})
+type ChainRouter struct {
+	links  []chainLink
+	logger Logger
+}
+
+// ChainOption configures a ChainRouter.
+type ChainOption func(*chainConfig)
+
+type chainConfig struct {
+	logger         Logger
+	breakerOptions []BreakerOption
+}
+
+// WithChainLogger sets a logger for provider failures and breaker
+// transitions. If not set, they are silent.
+func WithChainLogger(l Logger) ChainOption {
+	return func(c *chainConfig) { c.logger = l }
+}
+
+// WithBreakerOptions configures the circuit breaker of every provider.
+func WithBreakerOptions(opts ...BreakerOption) ChainOption {
+	return func(c *chainConfig) { c.breakerOptions = append(c.breakerOptions, opts...) }
+}
+
+// NewChainRouter creates a ChainRouter over links, tried in order.
+func NewChainRouter(links []ChainLink, opts ...ChainOption) *ChainRouter {
+	var cfg chainConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	c := &ChainRouter{logger: cfg.logger}
+	for _, l := range links {
+		breakerOpts := cfg.breakerOptions
+		if c.logger != nil {
+			name := l.Name
+			breakerOpts = append(breakerOpts[:len(breakerOpts):len(breakerOpts)], WithBreakerStateChange(func(from, to BreakerState) {
+				c.logger("routing: chain: %s circuit %s -> %s", name, from, to)
+			}))
+		}
+		c.links = append(c.links, chainLink{ChainLink: l, breaker: NewCircuitBreaker(breakerOpts...)})
+	}
+	return c
+}
+
+// Route satisfies the Router interface. The response's Provider names the
+// provider that answered.
+func (c *ChainRouter) Route(ctx context.Context, req RoutingRequest) (*RoutingResponse, error) {
+	var errs []error
+	for _, l := range c.links {
+		if !l.breaker.Allow() {
+			errs = append(errs, fmt.Errorf("%s: %w", l.Name, ErrCircuitOpen))
+			continue
+		}
+
+		resp, err := l.Router.Route(ctx, req)
+		if err == nil {
+			l.breaker.Success()
+			if resp.Provider == "" {
+				resp.Provider = l.Name
+			}
+			return resp, nil
+		}
+
+		// A provider without the travel mode or out of quota is not failing.
+		if errors.Is(err, ErrUnsupportedMode) || errors.Is(err, ErrQuotaExceeded) {
+			l.breaker.Ignore()
+			errs = append(errs, fmt.Errorf("%s: %w", l.Name, err))
+			continue
+		}
+
+		// A caller that gave up says nothing about the provider, and the
+		// next providers would fail the same way.
+		if ctx.Err() != nil {
+			l.breaker.Ignore()
+			return nil, fmt.Errorf("routing: chain: %s: %w", l.Name, err)
+		}
+
+		l.breaker.Failure()
+		if c.logger != nil {
+			c.logger("routing: chain: %s failed, trying next provider: %v", l.Name, err)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", l.Name, err))
+	}
+	return nil, fmt.Errorf("routing: chain: all providers failed: %w", errors.Join(errs...))
+}
+
+// States returns the circuit state of each provider, by name.
+func (c *ChainRouter) States() map[string]BreakerState {
+	states := make(map[string]BreakerState, len(c.links))
+	for _, l := range c.links {
+		states[l.Name] = l.breaker.State()
+	}
+	return states
+}
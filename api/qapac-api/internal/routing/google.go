@@ -6,8 +6,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
-	"math"
 	"net/http"
 	"time"
 )
@@ -19,9 +17,6 @@ const (
 	// googleTimeout is the maximum duration for a Google API call.
 	googleTimeout = 5 * time.Second
 
-	// straightLineSpeedMPS is the fallback speed in m/s (~30 km/h, typical urban speed).
-	straightLineSpeedMPS = 30.0 / 3.6
-
 	// httpMaxIdleConns is the maximum number of idle (keep-alive) connections
 	// kept in the transport pool across all hosts.
 	httpMaxIdleConns = 10
@@ -30,44 +25,83 @@ const (
 	// before being closed. 30 s is a safe value for APIs that enforce shorter
 	// server-side keep-alive timeouts.
 	httpIdleConnTimeout = 30 * time.Second
+
+	// googleFieldMask lists the route fields we read; Google bills by them.
+	googleFieldMask = "routes.duration,routes.distanceMeters,routes.polyline.encodedPolyline"
+
+	// googleStepsFieldMask adds the fields of the turn-by-turn steps.
+	googleStepsFieldMask = "routes.legs.distanceMeters,routes.legs.duration," +
+		"routes.legs.steps.distanceMeters,routes.legs.steps.staticDuration," +
+		"routes.legs.steps.polyline.encodedPolyline,routes.legs.steps.navigationInstruction"
 )
 
+// googleTravelMode maps each travel mode to its Routes API value.
+var googleTravelMode = map[TravelMode]string{
+	TravelModeWalk:    "WALK",
+	TravelModeDrive:   "DRIVE",
+	TravelModeBicycle: "BICYCLE",
+}
+
 // GoogleRouter implements Router using the Google Routes API v2.
 type GoogleRouter struct {
 	apiKey     string
 	httpClient *http.Client
 	// apiURL is the Google Routes API endpoint. Overrideable in tests.
 	apiURL string
+	quota  *QuotaMeter // nil = unmetered
+}
+
+// GoogleOption configures a GoogleRouter.
+type GoogleOption func(*GoogleRouter)
+
+// WithGoogleQuota counts every call with m and stops calling the API at its
+// hard cap, returning ErrQuotaExceeded. It also returns ErrQuotaExceeded for
+// the calls CachedRouter makes at the soft cap.
+func WithGoogleQuota(m *QuotaMeter) GoogleOption {
+	return func(g *GoogleRouter) { g.quota = m }
 }
 
 // NewGoogleRouter creates a Router backed by the Google Routes API v2.
 // apiKey must be a valid Google Cloud API key with the Routes API enabled.
-func NewGoogleRouter(apiKey string) *GoogleRouter {
+func NewGoogleRouter(apiKey string, opts ...GoogleOption) *GoogleRouter {
+	g := &GoogleRouter{
+		apiKey:     apiKey,
+		apiURL:     routesAPIURL,
+		httpClient: newHTTPClient(googleTimeout),
+	}
+	for _, o := range opts {
+		o(g)
+	}
+	return g
+}
+
+// newHTTPClient returns a client with its own keep-alive connection pool, as
+// each provider talks to a single host.
+func newHTTPClient(timeout time.Duration) *http.Client {
 	transport := &http.Transport{
 		MaxIdleConns:        httpMaxIdleConns,
 		MaxIdleConnsPerHost: httpMaxIdleConns,
 		IdleConnTimeout:     httpIdleConnTimeout,
 	}
-	return &GoogleRouter{
-		apiKey: apiKey,
-		apiURL: routesAPIURL,
-		httpClient: &http.Client{
-			Timeout:   googleTimeout,
-			Transport: transport,
-		},
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
 	}
 }
 
 // Route calls the Google Routes API v2 and returns the primary route.
-// On failure it logs the error and falls back to a straight-line estimate
-// with IsFallback set to true so callers can detect degraded responses.
+// Errors are returned as is; put the router in a ChainRouter to fall back to
+// other providers.
 func (g *GoogleRouter) Route(ctx context.Context, req RoutingRequest) (*RoutingResponse, error) {
-	resp, err := g.callAPI(ctx, req)
-	if err != nil {
-		log.Printf("routing: google API error (using straight-line fallback): %v", err)
-		return straightLineFallback(req), nil
+	if g.quota != nil {
+		if skipMetered(ctx) {
+			return nil, fmt.Errorf("routing: google: %w", ErrQuotaExceeded)
+		}
+		if err := g.quota.Reserve(ctx); err != nil {
+			return nil, fmt.Errorf("routing: google: %w", err)
+		}
 	}
-	return resp, nil
+	return g.callAPI(ctx, req)
 }
 
 // callAPI performs the actual HTTP call to the Google Routes API v2.
@@ -90,16 +124,19 @@ func (g *GoogleRouter) callAPI(ctx context.Context, req RoutingRequest) (*Routin
 				},
 			},
 		},
-		TravelMode:             "DRIVE",
-		RoutingPreference:      "TRAFFIC_AWARE",
-		ComputeAlternateRoutes: false,
-		RouteModifiers: routesAPIRouteModifiers{
+		TravelMode:             googleTravelMode[req.mode()],
+		ComputeAlternateRoutes: req.Alternatives,
+		LanguageCode:           "es-419",
+		Units:                  "METRIC",
+	}
+	// Routing preference and route modifiers are only accepted for driving.
+	if req.mode() == TravelModeDrive {
+		body.RoutingPreference = "TRAFFIC_AWARE"
+		body.RouteModifiers = &routesAPIRouteModifiers{
 			AvoidTolls:    false,
 			AvoidHighways: false,
 			AvoidFerries:  false,
-		},
-		LanguageCode: "es-419",
-		Units:        "METRIC",
+		}
 	}
 
 	bodyBytes, err := json.Marshal(body)
@@ -119,7 +156,11 @@ func (g *GoogleRouter) callAPI(ctx context.Context, req RoutingRequest) (*Routin
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("X-Goog-Api-Key", g.apiKey)
 	// Request only the fields we need to minimize response size and latency.
-	httpReq.Header.Set("X-Goog-FieldMask", "routes.duration,routes.distanceMeters,routes.polyline.encodedPolyline")
+	fieldMask := googleFieldMask
+	if req.Steps {
+		fieldMask += "," + googleStepsFieldMask
+	}
+	httpReq.Header.Set("X-Goog-FieldMask", fieldMask)
 
 	httpResp, err := g.httpClient.Do(httpReq)
 	if err != nil {
@@ -145,34 +186,56 @@ func (g *GoogleRouter) callAPI(ctx context.Context, req RoutingRequest) (*Routin
 		return nil, fmt.Errorf("routing: google: no routes returned")
 	}
 
-	route := apiResp.Routes[0]
+	routes := make([]Route, 0, len(apiResp.Routes))
+	for _, r := range apiResp.Routes {
+		route, err := googleRoute(r, req.Steps)
+		if err != nil {
+			return nil, fmt.Errorf("routing: google: %w", err)
+		}
+		routes = append(routes, route)
+	}
+	return newResponse(req, ProviderGoogle, routes), nil
+}
 
+// googleRoute converts a Routes API route, with its legs when withSteps.
+func googleRoute(r routesAPIRoute, withSteps bool) (Route, error) {
 	// Parse duration string: Google returns e.g. "123s".
-	durationS, err := parseDurationSeconds(route.Duration)
+	durationS, err := parseDurationSeconds(r.Duration)
 	if err != nil {
-		return nil, fmt.Errorf("routing: google: parse duration %q: %w", route.Duration, err)
+		return Route{}, fmt.Errorf("parse duration %q: %w", r.Duration, err)
 	}
-
-	return &RoutingResponse{
-		Polyline:  route.Polyline.EncodedPolyline,
-		DistanceM: route.DistanceMeters,
+	route := Route{
+		Polyline:  r.Polyline.EncodedPolyline,
+		DistanceM: r.DistanceMeters,
 		DurationS: durationS,
-	}, nil
-}
+	}
+	if !withSteps {
+		return route, nil
+	}
 
-// straightLineFallback returns a rough estimate based on straight-line distance.
-// IsFallback is set to true so callers can detect degraded responses.
-// Used when the Google API is unavailable.
-func straightLineFallback(req RoutingRequest) *RoutingResponse {
-	distM := haversineMeters(req.OriginLat, req.OriginLon, req.DestinationLat, req.DestinationLon)
-	durationS := int(float64(distM) / straightLineSpeedMPS)
-	// Return an empty polyline on fallback — no encoded path available.
-	return &RoutingResponse{
-		Polyline:   "",
-		DistanceM:  int(distM),
-		DurationS:  durationS,
-		IsFallback: true,
+	route.Legs = make([]Leg, 0, len(r.Legs))
+	for _, l := range r.Legs {
+		legDurationS, err := parseOptionalDurationSeconds(l.Duration)
+		if err != nil {
+			return Route{}, fmt.Errorf("parse leg duration %q: %w", l.Duration, err)
+		}
+		leg := Leg{DistanceM: l.DistanceMeters, DurationS: legDurationS, Steps: make([]Step, 0, len(l.Steps))}
+		for _, st := range l.Steps {
+			stepDurationS, err := parseOptionalDurationSeconds(st.StaticDuration)
+			if err != nil {
+				return Route{}, fmt.Errorf("parse step duration %q: %w", st.StaticDuration, err)
+			}
+			leg.Steps = append(leg.Steps, Step{
+				Instruction: st.NavigationInstruction.Instructions,
+				DistanceM:   st.DistanceMeters,
+				DurationS:   stepDurationS,
+				Maneuver:    googleManeuver(st.NavigationInstruction.Maneuver),
+				Polyline:    st.Polyline.EncodedPolyline,
+			})
+		}
+		route.Legs = append(route.Legs, leg)
 	}
+	return route, nil
 }
 
 // parseDurationSeconds parses a Google duration string like "123s" into an integer.
@@ -200,34 +263,26 @@ func parseDurationSeconds(s string) (int, error) {
 	return seconds, nil
 }
 
-// haversineMeters computes the great-circle distance in meters between two WGS84 points.
-func haversineMeters(lat1, lon1, lat2, lon2 float64) float64 {
-	const earthRadiusM = 6_371_000.0
-	const deg2rad = math.Pi / 180.0
-
-	dLat := (lat2 - lat1) * deg2rad
-	dLon := (lon2 - lon1) * deg2rad
-	lat1r := lat1 * deg2rad
-	lat2r := lat2 * deg2rad
-
-	sinDLat := math.Sin(dLat / 2)
-	sinDLon := math.Sin(dLon / 2)
-	a := sinDLat*sinDLat + math.Cos(lat1r)*math.Cos(lat2r)*sinDLon*sinDLon
-	c := 2 * math.Asin(math.Sqrt(a))
-	return earthRadiusM * c
+// parseOptionalDurationSeconds is parseDurationSeconds for leg and step
+// durations, which Google omits when they are zero.
+func parseOptionalDurationSeconds(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return parseDurationSeconds(s)
 }
 
 // --- JSON types for the Google Routes API v2 ---
 
 type routesAPIRequest struct {
-	Origin                 routesAPIWaypoint       `json:"origin"`
-	Destination            routesAPIWaypoint       `json:"destination"`
-	TravelMode             string                  `json:"travelMode"`
-	RoutingPreference      string                  `json:"routingPreference"`
-	ComputeAlternateRoutes bool                    `json:"computeAlternateRoutes"`
-	RouteModifiers         routesAPIRouteModifiers `json:"routeModifiers"`
-	LanguageCode           string                  `json:"languageCode"`
-	Units                  string                  `json:"units"`
+	Origin                 routesAPIWaypoint        `json:"origin"`
+	Destination            routesAPIWaypoint        `json:"destination"`
+	TravelMode             string                   `json:"travelMode"`
+	RoutingPreference      string                   `json:"routingPreference,omitempty"`
+	ComputeAlternateRoutes bool                     `json:"computeAlternateRoutes"`
+	RouteModifiers         *routesAPIRouteModifiers `json:"routeModifiers,omitempty"`
+	LanguageCode           string                   `json:"languageCode"`
+	Units                  string                   `json:"units"`
 }
 
 type routesAPIWaypoint struct {
@@ -257,6 +312,25 @@ type routesAPIRoute struct {
 	DistanceMeters int               `json:"distanceMeters"`
 	Duration       string            `json:"duration"`
 	Polyline       routesAPIPolyline `json:"polyline"`
+	Legs           []routesAPILeg    `json:"legs"`
+}
+
+type routesAPILeg struct {
+	DistanceMeters int             `json:"distanceMeters"`
+	Duration       string          `json:"duration"`
+	Steps          []routesAPIStep `json:"steps"`
+}
+
+type routesAPIStep struct {
+	DistanceMeters        int                            `json:"distanceMeters"`
+	StaticDuration        string                         `json:"staticDuration"`
+	Polyline              routesAPIPolyline              `json:"polyline"`
+	NavigationInstruction routesAPINavigationInstruction `json:"navigationInstruction"`
+}
+
+type routesAPINavigationInstruction struct {
+	Maneuver     string `json:"maneuver"`
+	Instructions string `json:"instructions"`
 }
 
 type routesAPIPolyline struct {
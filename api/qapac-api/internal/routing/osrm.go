@@ -0,0 +1,182 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// osrmTimeout is the maximum duration for an OSRM call. A self-hosted engine
+// answers urban queries in milliseconds.
+const osrmTimeout = 3 * time.Second
+
+// osrmProfile maps each travel mode to the profile segment of the request
+// path.
+var osrmProfile = map[TravelMode]string{
+	TravelModeWalk:    "walking",
+	TravelModeDrive:   "driving",
+	TravelModeBicycle: "cycling",
+}
+
+// OSRMRouter implements Router using the HTTP API of self-hosted OSRM
+// engines (http://project-osrm.org/docs/v5.24.0/api/).
+type OSRMRouter struct {
+	baseURLs   map[TravelMode]string
+	httpClient *http.Client
+}
+
+// NewOSRMRouter creates a Router backed by OSRM servers. An osrm-routed
+// process serves the single profile its graph was built with, so baseURLs
+// maps each travel mode to its server (e.g. TravelModeDrive:
+// "http://osrm-car:5000"). Modes without a server return ErrUnsupportedMode.
+func NewOSRMRouter(baseURLs map[TravelMode]string) *OSRMRouter {
+	o := &OSRMRouter{
+		baseURLs:   make(map[TravelMode]string, len(baseURLs)),
+		httpClient: newHTTPClient(osrmTimeout),
+	}
+	for mode, u := range baseURLs {
+		if u != "" {
+			o.baseURLs[mode] = strings.TrimRight(u, "/")
+		}
+	}
+	return o
+}
+
+// Route calls the OSRM route service and returns the primary route.
+func (o *OSRMRouter) Route(ctx context.Context, req RoutingRequest) (*RoutingResponse, error) {
+	mode := req.mode()
+	baseURL, ok := o.baseURLs[mode]
+	if !ok {
+		return nil, fmt.Errorf("routing: osrm: %s: %w", mode, ErrUnsupportedMode)
+	}
+
+	// OSRM takes lon,lat pairs. The profile segment is ignored by osrm-routed,
+	// which serves the single profile its graph was built with.
+	coords := formatCoord(req.OriginLon) + "," + formatCoord(req.OriginLat) + ";" +
+		formatCoord(req.DestinationLon) + "," + formatCoord(req.DestinationLat)
+	url := baseURL + "/route/v1/" + osrmProfile[mode] + "/" + coords + "?overview=full&geometries=polyline"
+	if req.Steps {
+		url += "&steps=true"
+	}
+	if req.Alternatives {
+		url += "&alternatives=true"
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, osrmTimeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("routing: osrm: create request: %w", err)
+	}
+
+	httpResp, err := o.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("routing: osrm: http: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	respBytes, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("routing: osrm: read response: %w", err)
+	}
+
+	// OSRM reports errors (NoRoute, InvalidQuery...) in the body, with 400
+	// or 200 depending on the error.
+	var apiResp osrmRouteResponse
+	if err := json.Unmarshal(respBytes, &apiResp); err != nil {
+		return nil, fmt.Errorf("routing: osrm: status %d: %s", httpResp.StatusCode, string(respBytes))
+	}
+	if apiResp.Code != "Ok" {
+		return nil, fmt.Errorf("routing: osrm: %s: %s", apiResp.Code, apiResp.Message)
+	}
+	if len(apiResp.Routes) == 0 {
+		return nil, fmt.Errorf("routing: osrm: no routes returned")
+	}
+
+	routes := make([]Route, 0, len(apiResp.Routes))
+	for _, r := range apiResp.Routes {
+		routes = append(routes, osrmToRoute(r, req.Steps))
+	}
+	return newResponse(req, ProviderOSRM, routes), nil
+}
+
+// osrmToRoute converts an OSRM route, with its legs when withSteps. OSRM
+// has no instruction text, so it is built from the maneuver and street name.
+func osrmToRoute(r osrmRoute, withSteps bool) Route {
+	route := Route{
+		Polyline:  r.Geometry,
+		DistanceM: int(math.Round(r.Distance)),
+		DurationS: int(math.Round(r.Duration)),
+	}
+	if !withSteps {
+		return route
+	}
+
+	route.Legs = make([]Leg, 0, len(r.Legs))
+	for _, l := range r.Legs {
+		leg := Leg{
+			DistanceM: int(math.Round(l.Distance)),
+			DurationS: int(math.Round(l.Duration)),
+			Steps:     make([]Step, 0, len(l.Steps)),
+		}
+		for _, st := range l.Steps {
+			maneuver := osrmManeuver(st.Maneuver.Type, st.Maneuver.Modifier)
+			leg.Steps = append(leg.Steps, Step{
+				Instruction: instructionFor(maneuver, st.Name),
+				DistanceM:   int(math.Round(st.Distance)),
+				DurationS:   int(math.Round(st.Duration)),
+				Maneuver:    maneuver,
+				Polyline:    st.Geometry,
+			})
+		}
+		route.Legs = append(route.Legs, leg)
+	}
+	return route
+}
+
+// formatCoord formats a coordinate with the shortest exact representation.
+func formatCoord(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// --- JSON types for the OSRM route service ---
+
+type osrmRouteResponse struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Routes  []osrmRoute `json:"routes"`
+}
+
+type osrmRoute struct {
+	// Geometry is an encoded polyline (precision 5) with geometries=polyline.
+	Geometry string    `json:"geometry"`
+	Distance float64   `json:"distance"` // metres
+	Duration float64   `json:"duration"` // seconds
+	Legs     []osrmLeg `json:"legs"`
+}
+
+type osrmLeg struct {
+	Distance float64    `json:"distance"`
+	Duration float64    `json:"duration"`
+	Steps    []osrmStep `json:"steps"` // only with steps=true
+}
+
+type osrmStep struct {
+	Geometry string           `json:"geometry"`
+	Distance float64          `json:"distance"`
+	Duration float64          `json:"duration"`
+	Name     string           `json:"name"` // street the step travels on
+	Maneuver osrmStepManeuver `json:"maneuver"`
+}
+
+type osrmStepManeuver struct {
+	Type     string `json:"type"`
+	Modifier string `json:"modifier"`
+}
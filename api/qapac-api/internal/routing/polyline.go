@@ -0,0 +1,101 @@
+package routing
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+// Encoded Polyline Algorithm precisions. Google and OSRM use 5 decimal
+// places; Valhalla uses 6. RoutingResponse.Polyline is always precision 5.
+const (
+	polylinePrecision5 = 5
+	polylinePrecision6 = 6
+)
+
+// errInvalidPolyline is returned by decodePolyline for truncated input.
+var errInvalidPolyline = errors.New("invalid encoded polyline")
+
+// latLng is a WGS-84 coordinate pair.
+type latLng struct {
+	Lat, Lng float64
+}
+
+// decodePolyline decodes an Encoded Polyline Algorithm string with the given
+// number of decimal places.
+func decodePolyline(s string, precision int) ([]latLng, error) {
+	factor := math.Pow10(precision)
+	var (
+		points   []latLng
+		lat, lng int64
+	)
+	for i := 0; i < len(s); {
+		var deltas [2]int64
+		for k := range deltas {
+			var result int64
+			var shift uint
+			for {
+				if i >= len(s) {
+					return nil, errInvalidPolyline
+				}
+				b := int64(s[i]) - 63
+				i++
+				result |= (b & 0x1f) << shift
+				shift += 5
+				if b < 0x20 {
+					break
+				}
+			}
+			if result&1 != 0 {
+				deltas[k] = ^(result >> 1)
+			} else {
+				deltas[k] = result >> 1
+			}
+		}
+		lat += deltas[0]
+		lng += deltas[1]
+		points = append(points, latLng{Lat: float64(lat) / factor, Lng: float64(lng) / factor})
+	}
+	return points, nil
+}
+
+// encodePolyline encodes points with the given number of decimal places.
+func encodePolyline(points []latLng, precision int) string {
+	factor := math.Pow10(precision)
+	var (
+		b                strings.Builder
+		prevLat, prevLng int64
+	)
+	for _, p := range points {
+		lat := int64(math.Round(p.Lat * factor))
+		lng := int64(math.Round(p.Lng * factor))
+		encodePolylineValue(&b, lat-prevLat)
+		encodePolylineValue(&b, lng-prevLng)
+		prevLat, prevLng = lat, lng
+	}
+	return b.String()
+}
+
+func encodePolylineValue(b *strings.Builder, v int64) {
+	u := v << 1
+	if v < 0 {
+		u = ^u
+	}
+	for u >= 0x20 {
+		b.WriteByte(byte((0x20 | (u & 0x1f)) + 63))
+		u >>= 5
+	}
+	b.WriteByte(byte(u + 63))
+}
+
+// reencodePolyline converts an encoded polyline between precisions.
+func reencodePolyline(s string, from, to int) (string, error) {
+	if from == to {
+		return s, nil
+	}
+	points, err := decodePolyline(s, from)
+	if err != nil {
+		return "", err
+	}
+	return encodePolyline(points, to), nil
+}
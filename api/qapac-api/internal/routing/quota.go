@@ -0,0 +1,354 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// quotaRefresh is how often QuotaMeter re-reads the counters, so that
+	// calls made by other instances count towards the caps.
+	quotaRefresh = 30 * time.Second
+
+	// quotaQueryTimeout is the deadline for each usage query.
+	quotaQueryTimeout = 2 * time.Second
+
+	// wideGeohashPrecision is the origin cell searched by CachedRouter at the
+	// soft cap: precision 6 ≈ ±610m, a walk of a few blocks.
+	wideGeohashPrecision = 6
+)
+
+// ErrQuotaExceeded is returned by a Router whose provider reached its hard
+// usage cap. ChainRouter moves on to the next provider without counting it
+// as a failure.
+var ErrQuotaExceeded = errors.New("usage cap reached")
+
+// QuotaLevel is how close a provider is to its usage caps.
+type QuotaLevel int
+
+const (
+	// QuotaNormal is below every soft cap.
+	QuotaNormal QuotaLevel = iota
+	// QuotaSoft is at a soft cap: behind a CachedRouter the provider is
+	// cache only, searched with a wider geohash.
+	QuotaSoft
+	// QuotaHard is at a hard cap: the provider is not called.
+	QuotaHard
+)
+
+// String returns the lowercase name of l.
+func (l QuotaLevel) String() string {
+	switch l {
+	case QuotaNormal:
+		return "normal"
+	case QuotaSoft:
+		return "soft"
+	case QuotaHard:
+		return "hard"
+	}
+	return fmt.Sprintf("QuotaLevel(%d)", int(l))
+}
+
+// QuotaCaps are the call limits of a provider. Zero disables a cap.
+type QuotaCaps struct {
+	SoftDaily   int64 `json:"soft_daily"`
+	HardDaily   int64 `json:"hard_daily"`
+	SoftMonthly int64 `json:"soft_monthly"`
+	HardMonthly int64 `json:"hard_monthly"`
+}
+
+// Usage is the number of calls made on a day and in its month up to and
+// including that day.
+type Usage struct {
+	Day   int64
+	Month int64
+}
+
+// UsageStore persists the call counters of a QuotaMeter.
+type UsageStore interface {
+	// IncrementUsage counts a call on day and returns the updated usage.
+	IncrementUsage(ctx context.Context, day time.Time) (Usage, error)
+
+	// GetUsage returns the usage of day.
+	GetUsage(ctx context.Context, day time.Time) (Usage, error)
+}
+
+// QuotaReport is the usage of a provider, for the admin endpoint.
+type QuotaReport struct {
+	Day        string    `json:"day"`
+	DayCalls   int64     `json:"day_calls"`
+	MonthCalls int64     `json:"month_calls"`
+	Level      string    `json:"level"`
+	Caps       QuotaCaps `json:"caps"`
+
+	// PricePer1000 is the price of 1000 calls in USD.
+	PricePer1000  float64 `json:"price_per_1000_usd"`
+	MonthSpendUSD float64 `json:"month_spend_usd"`
+	// ProjectedMonthCalls extrapolates the daily average of the month so far
+	// to the whole month.
+	ProjectedMonthCalls    int64   `json:"projected_month_calls"`
+	ProjectedMonthSpendUSD float64 `json:"projected_month_spend_usd"`
+}
+
+// QuotaMeter counts the calls made to a paid provider per day and month and
+// reports how close they are to the caps. Days follow the server's local
+// time zone.
+type QuotaMeter struct {
+	store        UsageStore
+	caps         QuotaCaps
+	pricePer1000 float64
+	logger       Logger
+	now          func() time.Time
+
+	mu        sync.Mutex // guards the cached fields below; never held across a query
+	day       time.Time  // local midnight of the cached usage
+	usage     Usage
+	fetchedAt time.Time // zero forces a read
+}
+
+// QuotaOption configures a QuotaMeter.
+type QuotaOption func(*QuotaMeter)
+
+// WithQuotaLogger sets a logger for store failures and cap transitions. If
+// not set, they are silent.
+func WithQuotaLogger(l Logger) QuotaOption {
+	return func(m *QuotaMeter) { m.logger = l }
+}
+
+// withQuotaClock injects a fake clock for unit testing.
+func withQuotaClock(fn func() time.Time) QuotaOption {
+	return func(m *QuotaMeter) { m.now = fn }
+}
+
+// NewQuotaMeter creates a QuotaMeter that enforces caps and prices calls at
+// pricePer1000 USD per thousand.
+func NewQuotaMeter(store UsageStore, caps QuotaCaps, pricePer1000 float64, opts ...QuotaOption) *QuotaMeter {
+	m := &QuotaMeter{
+		store:        store,
+		caps:         caps,
+		pricePer1000: pricePer1000,
+		now:          time.Now,
+	}
+	for _, o := range opts {
+		o(m)
+	}
+	return m
+}
+
+// Level returns the current quota level. If the counters cannot be read,
+// the last known usage is used.
+func (m *QuotaMeter) Level(ctx context.Context) QuotaLevel {
+	m.refresh(ctx)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.level(m.usage)
+}
+
+// Reserve counts a call about to be made, or returns ErrQuotaExceeded at
+// the hard cap. Calls are counted before they are made, and the decision is
+// taken on the counter returned by the store, so concurrent requests on any
+// instance cannot overshoot the cap. A call refused that way stays counted.
+func (m *QuotaMeter) Reserve(ctx context.Context) error {
+	m.refresh(ctx)
+	m.mu.Lock()
+	day, before := m.day, m.level(m.usage)
+	m.mu.Unlock()
+	if before == QuotaHard {
+		return ErrQuotaExceeded
+	}
+
+	ictx, cancel := context.WithTimeout(ctx, quotaQueryTimeout)
+	usage, err := m.store.IncrementUsage(ictx, day)
+	cancel()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		// Count locally: the call is made anyway.
+		m.logf("routing: quota: increment failed: %v", err)
+		if m.day.Equal(day) {
+			m.usage.Day++
+			m.usage.Month++
+		}
+		return nil
+	}
+
+	if m.day.Equal(day) {
+		prev := m.level(m.usage)
+		m.usage = maxUsage(m.usage, usage)
+		m.fetchedAt = m.now()
+		if after := m.level(m.usage); after != prev {
+			m.logf("routing: quota: %s cap reached (day=%d month=%d)", after, m.usage.Day, m.usage.Month)
+		}
+	}
+	if m.overHard(usage) {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// Report returns the usage of today and the projected spend of the month.
+func (m *QuotaMeter) Report(ctx context.Context) (*QuotaReport, error) {
+	now := m.now()
+	day := localMidnight(now)
+
+	ctx, cancel := context.WithTimeout(ctx, quotaQueryTimeout)
+	defer cancel()
+	usage, err := m.store.GetUsage(ctx, day)
+	if err != nil {
+		return nil, fmt.Errorf("routing: quota: report: %w", err)
+	}
+
+	// Extrapolate from the elapsed fraction of the month.
+	monthStart := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+	monthEnd := monthStart.AddDate(0, 1, 0)
+	elapsed := now.Sub(monthStart).Hours()
+	projected := usage.Month
+	if elapsed > 0 {
+		projected = int64(float64(usage.Month) * monthEnd.Sub(monthStart).Hours() / elapsed)
+	}
+
+	return &QuotaReport{
+		Day:                    day.Format(time.DateOnly),
+		DayCalls:               usage.Day,
+		MonthCalls:             usage.Month,
+		Level:                  m.level(usage).String(),
+		Caps:                   m.caps,
+		PricePer1000:           m.pricePer1000,
+		MonthSpendUSD:          m.spend(usage.Month),
+		ProjectedMonthCalls:    projected,
+		ProjectedMonthSpendUSD: m.spend(projected),
+	}, nil
+}
+
+// refresh re-reads the counters when they are stale or the day changed. The
+// query runs without m.mu held; callers that arrive meanwhile use the last
+// known usage.
+func (m *QuotaMeter) refresh(ctx context.Context) {
+	now := m.now()
+	day := localMidnight(now)
+
+	m.mu.Lock()
+	if day.Equal(m.day) && now.Sub(m.fetchedAt) < quotaRefresh {
+		m.mu.Unlock()
+		return
+	}
+	if !day.Equal(m.day) {
+		if day.Month() != m.day.Month() || day.Year() != m.day.Year() {
+			m.usage.Month = 0
+		}
+		m.day, m.usage.Day = day, 0
+	}
+	m.fetchedAt = now // on failure, retry after quotaRefresh
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, quotaQueryTimeout)
+	defer cancel()
+	usage, err := m.store.GetUsage(ctx, day)
+	if err != nil {
+		m.logf("routing: quota: read failed, using last known usage: %v", err)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Increments that finished during the read may be newer than it.
+	if m.day.Equal(day) {
+		m.usage = maxUsage(m.usage, usage)
+	}
+}
+
+func (m *QuotaMeter) level(u Usage) QuotaLevel {
+	reached := func(n, limit int64) bool { return limit > 0 && n >= limit }
+	switch {
+	case reached(u.Day, m.caps.HardDaily), reached(u.Month, m.caps.HardMonthly):
+		return QuotaHard
+	case reached(u.Day, m.caps.SoftDaily), reached(u.Month, m.caps.SoftMonthly):
+		return QuotaSoft
+	}
+	return QuotaNormal
+}
+
+// overHard reports whether u includes calls past a hard cap: the call that
+// reaches the cap is the last one allowed.
+func (m *QuotaMeter) overHard(u Usage) bool {
+	over := func(n, limit int64) bool { return limit > 0 && n > limit }
+	return over(u.Day, m.caps.HardDaily) || over(u.Month, m.caps.HardMonthly)
+}
+
+func maxUsage(a, b Usage) Usage {
+	return Usage{Day: max(a.Day, b.Day), Month: max(a.Month, b.Month)}
+}
+
+func (m *QuotaMeter) spend(calls int64) float64 {
+	return float64(calls) * m.pricePer1000 / 1000
+}
+
+func (m *QuotaMeter) logf(format string, args ...any) {
+	if m.logger != nil {
+		m.logger(format, args...)
+	}
+}
+
+func localMidnight(t time.Time) time.Time {
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// --- pgx-backed UsageStore implementation ---
+
+// pgUsageStore is the production implementation of UsageStore, with one row
+// per day in google_routes_usage.
+type pgUsageStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPgUsageStore creates a UsageStore backed by the given connection pool.
+func NewPgUsageStore(pool *pgxpool.Pool) UsageStore {
+	return &pgUsageStore{pool: pool}
+}
+
+// IncrementUsage upserts the row of day. The month total reads the other
+// days of the month and adds the updated row, which the statement's snapshot
+// does not see.
+func (s *pgUsageStore) IncrementUsage(ctx context.Context, day time.Time) (Usage, error) {
+	const q = `
+		WITH today AS (
+			INSERT INTO google_routes_usage (day, calls)
+			VALUES ($1::date, 1)
+			ON CONFLICT (day) DO UPDATE SET calls = google_routes_usage.calls + 1
+			RETURNING calls
+		)
+		SELECT today.calls,
+		       today.calls + COALESCE((
+		           SELECT SUM(calls) FROM google_routes_usage
+		           WHERE day >= date_trunc('month', $1::date) AND day < $1::date
+		       ), 0)::bigint
+		FROM today`
+
+	var u Usage
+	if err := s.pool.QueryRow(ctx, q, day.Format(time.DateOnly)).Scan(&u.Day, &u.Month); err != nil {
+		return Usage{}, fmt.Errorf("routing: usage: increment: %w", err)
+	}
+	return u, nil
+}
+
+// GetUsage sums the rows of the month of day, up to day.
+func (s *pgUsageStore) GetUsage(ctx context.Context, day time.Time) (Usage, error) {
+	const q = `
+		SELECT COALESCE(SUM(calls) FILTER (WHERE day = $1::date), 0)::bigint,
+		       COALESCE(SUM(calls), 0)::bigint
+		FROM google_routes_usage
+		WHERE day >= date_trunc('month', $1::date) AND day <= $1::date`
+
+	var u Usage
+	if err := s.pool.QueryRow(ctx, q, day.Format(time.DateOnly)).Scan(&u.Day, &u.Month); err != nil {
+		return Usage{}, fmt.Errorf("routing: usage: get: %w", err)
+	}
+	return u, nil
+}
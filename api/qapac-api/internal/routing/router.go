@@ -1,6 +1,38 @@
 package routing
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TravelMode is how the route is travelled.
+type TravelMode string
+
+// Travel modes supported by every provider.
+const (
+	TravelModeWalk    TravelMode = "walk"
+	TravelModeDrive   TravelMode = "drive"
+	TravelModeBicycle TravelMode = "bicycle"
+)
+
+// ErrUnsupportedMode is returned by a Router that is not configured for the
+// requested TravelMode. ChainRouter moves on to the next provider without
+// counting it as a failure.
+var ErrUnsupportedMode = errors.New("travel mode not supported")
+
+// ParseTravelMode parses "walk", "drive" or "bicycle". An empty string is
+// walking, the default.
+func ParseTravelMode(s string) (TravelMode, error) {
+	switch m := TravelMode(s); m {
+	case "":
+		return TravelModeWalk, nil
+	case TravelModeWalk, TravelModeDrive, TravelModeBicycle:
+		return m, nil
+	}
+	return "", fmt.Errorf("routing: unknown travel mode %q", s)
+}
 
 // RoutingRequest holds the origin and destination coordinates for a route calculation.
 type RoutingRequest struct {
@@ -8,6 +40,23 @@ type RoutingRequest struct {
 	OriginLon      float64
 	DestinationLat float64
 	DestinationLon float64
+
+	// Mode is the travel mode; the zero value is TravelModeWalk.
+	Mode TravelMode
+
+	// Steps asks for turn-by-turn instructions (RoutingResponse.Legs).
+	Steps bool
+	// Alternatives asks for other routes besides the best one
+	// (RoutingResponse.Alternates).
+	Alternatives bool
+}
+
+// mode returns req.Mode, defaulting to walking.
+func (req RoutingRequest) mode() TravelMode {
+	if req.Mode == "" {
+		return TravelModeWalk
+	}
+	return req.Mode
 }
 
 // RoutingResponse holds the result of a route calculation.
@@ -22,6 +71,39 @@ type RoutingResponse struct {
 	// fallback estimator instead of a live API call. Callers can use this field
 	// to surface a warning to the end user or to avoid caching stale estimates.
 	IsFallback bool
+
+	// Provider names the engine that computed the route (ProviderGoogle,
+	// ProviderOSRM, ...).
+	Provider string
+
+	// Legs holds the turn-by-turn steps. It is nil unless steps were
+	// requested and the provider can give them.
+	Legs []Leg
+
+	// Alternates are other routes between the same points, best first. It is
+	// nil unless alternatives were requested, and empty when there are none.
+	Alternates []Route
+
+	// CachedAt is when a route served from the cache was computed. It is
+	// zero for a route computed for this request.
+	CachedAt time.Time
+}
+
+// newResponse builds the response of a provider from its routes, best first:
+// the first is the primary route, the rest its alternates if requested.
+func newResponse(req RoutingRequest, provider string, routes []Route) *RoutingResponse {
+	best := routes[0]
+	resp := &RoutingResponse{
+		Polyline:  best.Polyline,
+		DistanceM: best.DistanceM,
+		DurationS: best.DurationS,
+		Provider:  provider,
+		Legs:      best.Legs,
+	}
+	if req.Alternatives {
+		resp.Alternates = append([]Route{}, routes[1:]...)
+	}
+	return resp
 }
 
 // Router calculates a route between two geographic points.
@@ -2,13 +2,19 @@ package routing
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/dom1nux/qapac-api/internal/refresh"
 )
 
 // ---- parseDurationSeconds ----
@@ -109,39 +115,61 @@ func TestHaversineMeters(t *testing.T) {
 
 // mockCacheStore is a simple in-memory CacheStore for tests.
 type mockCacheStore struct {
-	data     map[string]*RoutingResponse
-	getErr   error
-	setErr   error
-	getCalls int
-	setCalls int
+	data      map[string]*RoutingResponse
+	getErr    error
+	setErr    error
+	getCalls  int
+	setCalls  int
+	nearCalls int
 }
 
 func newMockCacheStore() *mockCacheStore {
 	return &mockCacheStore{data: make(map[string]*RoutingResponse)}
 }
 
-func (m *mockCacheStore) cacheKey(origin string, stopID int32) string {
-	return fmt.Sprintf("%s|%d", origin, stopID)
+func (m *mockCacheStore) cacheKey(origin string, stopID int32, mode TravelMode) string {
+	return fmt.Sprintf("%s|%d|%s", origin, stopID, mode)
 }
 
-func (m *mockCacheStore) GetCachedRoute(_ context.Context, originHash string, stopID int32) (*RoutingResponse, error) {
+func (m *mockCacheStore) GetCachedRoute(_ context.Context, originHash string, stopID int32, mode TravelMode) (*RoutingResponse, error) {
 	m.getCalls++
 	if m.getErr != nil {
 		return nil, m.getErr
 	}
-	v, ok := m.data[m.cacheKey(originHash, stopID)]
+	v, ok := m.data[m.cacheKey(originHash, stopID, mode)]
 	if !ok {
 		return nil, nil
 	}
-	return v, nil
+	return stamped(v), nil
+}
+
+// stamped returns v as read from the cache: entries put in data without a
+// CachedAt count as just computed.
+func stamped(v *RoutingResponse) *RoutingResponse {
+	if !v.CachedAt.IsZero() {
+		return v
+	}
+	c := *v
+	c.CachedAt = time.Now()
+	return &c
+}
+
+func (m *mockCacheStore) GetCachedRouteNear(_ context.Context, cell string, stopID int32, mode TravelMode) (*RoutingResponse, error) {
+	m.nearCalls++
+	for k, v := range m.data {
+		if strings.HasPrefix(k, cell) && strings.HasSuffix(k, fmt.Sprintf("|%d|%s", stopID, mode)) {
+			return stamped(v), nil
+		}
+	}
+	return nil, nil
 }
 
-func (m *mockCacheStore) SetCachedRoute(_ context.Context, originHash string, stopID int32, resp *RoutingResponse) error {
+func (m *mockCacheStore) SetCachedRoute(_ context.Context, originHash string, stopID int32, mode TravelMode, resp *RoutingResponse) error {
 	m.setCalls++
 	if m.setErr != nil {
 		return m.setErr
 	}
-	m.data[m.cacheKey(originHash, stopID)] = resp
+	m.data[m.cacheKey(originHash, stopID, mode)] = resp
 	return nil
 }
 
@@ -197,7 +225,7 @@ func TestCachedRouter_CacheHit_DoesNotCallInner(t *testing.T) {
 	req := RoutingRequest{OriginLat: -12.046, OriginLon: -77.042, DestinationLat: -12.055, DestinationLon: -77.053}
 	key := originHash(req.OriginLat, req.OriginLon)
 	cachedResp := &RoutingResponse{Polyline: "cached", DistanceM: 100, DurationS: 30}
-	store.data[store.cacheKey(key, 0)] = cachedResp
+	store.data[store.cacheKey(key, 0, TravelModeWalk)] = cachedResp
 
 	got, err := cr.Route(context.Background(), req)
 	if err != nil {
@@ -221,7 +249,7 @@ func TestCachedRouter_CacheHit_WithStopID(t *testing.T) {
 
 	const stopID int32 = 7
 	cachedResp := &RoutingResponse{Polyline: "cached_stop7", DistanceM: 300, DurationS: 90}
-	store.data[store.cacheKey(key, stopID)] = cachedResp
+	store.data[store.cacheKey(key, stopID, TravelModeWalk)] = cachedResp
 
 	ctx := WithStopID(context.Background(), stopID)
 	got, err := cr.Route(ctx, req)
@@ -268,6 +296,83 @@ func TestCachedRouter_InnerError_Propagated(t *testing.T) {
 	}
 }
 
+func TestCachedRouter_FallbackNotCached(t *testing.T) {
+	store := newMockCacheStore()
+	inner := &mockRouter{resp: &RoutingResponse{DistanceM: 300, DurationS: 40, IsFallback: true}}
+	cr := NewCachedRouter(inner, store, withAfterStore(func() { t.Error("fallback response was stored") }))
+
+	req := RoutingRequest{OriginLat: -12.046, OriginLon: -77.042}
+	if _, err := cr.Route(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.setCalls != 0 {
+		t.Errorf("SetCachedRoute called %d times, want 0", store.setCalls)
+	}
+}
+
+func TestCachedRouter_KeyedByMode(t *testing.T) {
+	store := newMockCacheStore()
+	inner := &mockRouter{resp: &RoutingResponse{Polyline: "drive"}}
+	cr := NewCachedRouter(inner, store)
+
+	req := RoutingRequest{OriginLat: -12.046, OriginLon: -77.042}
+	store.data[store.cacheKey(originHash(req.OriginLat, req.OriginLon), noStopID, TravelModeWalk)] = &RoutingResponse{Polyline: "walk"}
+
+	req.Mode = TravelModeDrive
+	got, err := cr.Route(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Polyline != "drive" || inner.calls != 1 {
+		t.Errorf("polyline = %q, inner calls = %d; a walking entry must not answer a driving request", got.Polyline, inner.calls)
+	}
+}
+
+func TestCachedRouter_EntryWithoutSteps_IsMiss(t *testing.T) {
+	store := newMockCacheStore()
+	legs := []Leg{{Steps: []Step{{Instruction: "Sal"}}}}
+	inner := &mockRouter{resp: &RoutingResponse{Polyline: "fresh", Legs: legs, Alternates: []Route{}}}
+	stored := make(chan struct{}, 1)
+	cr := NewCachedRouter(inner, store, withAfterStore(func() { stored <- struct{}{} }))
+
+	req := RoutingRequest{OriginLat: -12.046, OriginLon: -77.042}
+	key := store.cacheKey(originHash(req.OriginLat, req.OriginLon), noStopID, TravelModeWalk)
+	store.data[key] = &RoutingResponse{Polyline: "plain"}
+
+	// A plain request is answered by the plain entry...
+	if got, _ := cr.Route(context.Background(), req); got.Polyline != "plain" {
+		t.Errorf("polyline = %q, want cached plain entry", got.Polyline)
+	}
+	// ...but one asking for steps or alternates is not.
+	for _, r := range []RoutingRequest{{Steps: true}, {Alternatives: true}} {
+		r.OriginLat, r.OriginLon = req.OriginLat, req.OriginLon
+		if got, _ := cr.Route(context.Background(), r); got.Polyline != "fresh" {
+			t.Errorf("%+v: polyline = %q, want fresh route", r, got.Polyline)
+		}
+		<-stored
+		store.data[key] = &RoutingResponse{Polyline: "plain"}
+	}
+
+	// An entry with steps answers plain requests too.
+	store.data[key] = &RoutingResponse{Polyline: "rich", Legs: legs, Alternates: []Route{}}
+	for _, r := range []RoutingRequest{req, {OriginLat: req.OriginLat, OriginLon: req.OriginLon, Steps: true, Alternatives: true}} {
+		if got, _ := cr.Route(context.Background(), r); got.Polyline != "rich" {
+			t.Errorf("%+v: polyline = %q, want cached rich entry", r, got.Polyline)
+		}
+	}
+}
+
+func TestParseTravelMode(t *testing.T) {
+	for in, want := range map[string]TravelMode{"": TravelModeWalk, "walk": TravelModeWalk, "drive": TravelModeDrive, "bicycle": TravelModeBicycle} {
+		if got, err := ParseTravelMode(in); err != nil || got != want {
+			t.Errorf("ParseTravelMode(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseTravelMode("DRIVE"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
 // ---- originHash / context helpers ----
 
 func TestOriginHash_Deterministic(t *testing.T) {
@@ -328,11 +433,15 @@ type spyCacheStore struct {
 	onSet func(originHash string, stopID int32, resp *RoutingResponse)
 }
 
-func (s *spyCacheStore) GetCachedRoute(_ context.Context, _ string, _ int32) (*RoutingResponse, error) {
+func (s *spyCacheStore) GetCachedRoute(_ context.Context, _ string, _ int32, _ TravelMode) (*RoutingResponse, error) {
 	return nil, nil // always miss
 }
 
-func (s *spyCacheStore) SetCachedRoute(_ context.Context, originHash string, stopID int32, resp *RoutingResponse) error {
+func (s *spyCacheStore) GetCachedRouteNear(_ context.Context, _ string, _ int32, _ TravelMode) (*RoutingResponse, error) {
+	return nil, nil
+}
+
+func (s *spyCacheStore) SetCachedRoute(_ context.Context, originHash string, stopID int32, _ TravelMode, resp *RoutingResponse) error {
 	if s.onSet != nil {
 		s.onSet(originHash, stopID, resp)
 	}
@@ -452,45 +561,1231 @@ func TestGoogleRouter_Success_IsFallbackFalse(t *testing.T) {
 	}
 }
 
-func TestGoogleRouter_Fallback_SetsIsFallback(t *testing.T) {
-	// Server returns 503 — callAPI fails, Route falls back to straight-line.
+func TestGoogleRouter_APIError_Returned(t *testing.T) {
+	// Server returns 503 — the error is left to the ChainRouter.
 	_, router := newFakeGoogleServer(t, func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusServiceUnavailable)
 	})
 
 	req := RoutingRequest{OriginLat: -12.046, OriginLon: -77.042, DestinationLat: -12.055, DestinationLon: -77.053}
-	resp, err := router.Route(context.Background(), req)
+	if resp, err := router.Route(context.Background(), req); err == nil {
+		t.Fatalf("expected error, got %+v", resp)
+	}
+}
+
+func TestGoogleRouter_NoRoutes_Returned(t *testing.T) {
+	// Server returns 200 but with empty routes array.
+	_, router := newFakeGoogleServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"routes":[]}`))
+	})
+
+	req := RoutingRequest{OriginLat: -12.046, OriginLon: -77.042, DestinationLat: -12.055, DestinationLon: -77.053}
+	if resp, err := router.Route(context.Background(), req); err == nil {
+		t.Fatalf("expected error, got %+v", resp)
+	}
+}
+
+func TestGoogleRouter_TravelMode(t *testing.T) {
+	var got map[string]any
+	_, router := newFakeGoogleServer(t, func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"routes":[{"distanceMeters":400,"duration":"290s","polyline":{"encodedPolyline":"x"}}]}`))
+	})
+
+	cases := []struct {
+		mode           TravelMode
+		want           string
+		wantPreference bool
+	}{
+		{"", "WALK", false},
+		{TravelModeBicycle, "BICYCLE", false},
+		{TravelModeDrive, "DRIVE", true},
+	}
+	for _, tc := range cases {
+		if _, err := router.Route(context.Background(), RoutingRequest{Mode: tc.mode}); err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.mode, err)
+		}
+		if got["travelMode"] != tc.want {
+			t.Errorf("%q: travelMode = %v, want %s", tc.mode, got["travelMode"], tc.want)
+		}
+		// The API rejects a routing preference outside of driving.
+		if _, ok := got["routingPreference"]; ok != tc.wantPreference {
+			t.Errorf("%q: routingPreference sent = %v, want %v", tc.mode, ok, tc.wantPreference)
+		}
+	}
+}
+
+func TestGoogleRouter_StepsAndAlternates(t *testing.T) {
+	var gotMask string
+	var gotAlternates bool
+	body := `{"routes":[
+		{"distanceMeters":900,"duration":"700s","polyline":{"encodedPolyline":"best"},
+		 "legs":[{"distanceMeters":900,"duration":"700s","steps":[
+			{"distanceMeters":100,"staticDuration":"80s","polyline":{"encodedPolyline":"s1"},
+			 "navigationInstruction":{"maneuver":"DEPART","instructions":"Dirígete al norte por Jr. Ica"}},
+			{"distanceMeters":800,"staticDuration":"620s","polyline":{"encodedPolyline":"s2"},
+			 "navigationInstruction":{"maneuver":"TURN_LEFT","instructions":"Gira a la izquierda hacia Av. Tacna"}}]}]},
+		{"distanceMeters":950,"duration":"730s","polyline":{"encodedPolyline":"alt"},
+		 "legs":[{"distanceMeters":950,"duration":"730s","steps":[{"polyline":{"encodedPolyline":"a1"}}]}]}]}`
+	_, router := newFakeGoogleServer(t, func(w http.ResponseWriter, r *http.Request) {
+		gotMask = r.Header.Get("X-Goog-FieldMask")
+		var req routesAPIRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		gotAlternates = req.ComputeAlternateRoutes
+		_, _ = w.Write([]byte(body))
+	})
+
+	resp, err := router.Route(context.Background(), RoutingRequest{Steps: true, Alternatives: true})
 	if err != nil {
-		t.Fatalf("fallback should not return error, got: %v", err)
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(gotMask, "routes.legs.steps.navigationInstruction") || !gotAlternates {
+		t.Errorf("field mask = %q, computeAlternateRoutes = %v", gotMask, gotAlternates)
+	}
+	if len(resp.Legs) != 1 || len(resp.Legs[0].Steps) != 2 {
+		t.Fatalf("legs = %+v, want 1 leg with 2 steps", resp.Legs)
+	}
+	want := Step{Instruction: "Gira a la izquierda hacia Av. Tacna", DistanceM: 800, DurationS: 620, Maneuver: ManeuverTurnLeft, Polyline: "s2"}
+	if got := resp.Legs[0].Steps[1]; got != want {
+		t.Errorf("step = %+v, want %+v", got, want)
 	}
-	if !resp.IsFallback {
-		t.Error("IsFallback should be true when Google API fails")
+	if len(resp.Alternates) != 1 || resp.Alternates[0].Polyline != "alt" || resp.Alternates[0].DurationS != 730 {
+		t.Errorf("alternates = %+v", resp.Alternates)
+	}
+	// Omitted zero durations are zero.
+	if got := resp.Alternates[0].Legs[0].Steps[0].DurationS; got != 0 {
+		t.Errorf("alternate step duration = %d, want 0", got)
+	}
+}
+
+func TestGoogleRouter_NoStepsRequested(t *testing.T) {
+	var gotMask string
+	_, router := newFakeGoogleServer(t, func(w http.ResponseWriter, r *http.Request) {
+		gotMask = r.Header.Get("X-Goog-FieldMask")
+		_, _ = w.Write([]byte(`{"routes":[{"distanceMeters":1,"duration":"1s","polyline":{"encodedPolyline":"a"}},{"distanceMeters":2,"duration":"2s","polyline":{"encodedPolyline":"b"}}]}`))
+	})
+
+	resp, err := router.Route(context.Background(), RoutingRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
 	}
-	if resp.DistanceM <= 0 {
-		t.Errorf("fallback distance should be > 0, got %d", resp.DistanceM)
+	if gotMask != googleFieldMask {
+		t.Errorf("field mask = %q, want %q", gotMask, googleFieldMask)
 	}
-	if resp.DurationS <= 0 {
-		t.Errorf("fallback duration should be > 0, got %d", resp.DurationS)
+	if resp.Legs != nil || resp.Alternates != nil {
+		t.Errorf("legs = %v, alternates = %v; want nil when not requested", resp.Legs, resp.Alternates)
+	}
+}
+
+func TestStraightLineRouter_SpeedByMode(t *testing.T) {
+	req := RoutingRequest{OriginLat: -12.046, OriginLon: -77.042, DestinationLat: -12.055, DestinationLon: -77.053}
+	walk, _ := StraightLineRouter{}.Route(context.Background(), req)
+	req.Mode = TravelModeDrive
+	drive, _ := StraightLineRouter{}.Route(context.Background(), req)
+	if walk.DistanceM != drive.DistanceM || walk.DurationS <= drive.DurationS {
+		t.Errorf("walk = %+v, drive = %+v; want same distance, longer walk", walk, drive)
+	}
+}
+
+func TestStraightLineRouter(t *testing.T) {
+	req := RoutingRequest{OriginLat: -12.046, OriginLon: -77.042, DestinationLat: -12.055, DestinationLon: -77.053}
+	resp, err := StraightLineRouter{}.Route(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.IsFallback || resp.Provider != ProviderStraightLine {
+		t.Errorf("IsFallback = %v, Provider = %q; want true, %q", resp.IsFallback, resp.Provider, ProviderStraightLine)
+	}
+	if resp.DistanceM <= 0 || resp.DurationS <= 0 {
+		t.Errorf("distance = %d, duration = %d; want > 0", resp.DistanceM, resp.DurationS)
 	}
 	if resp.Polyline != "" {
-		t.Errorf("fallback polyline should be empty, got %q", resp.Polyline)
+		t.Errorf("polyline should be empty, got %q", resp.Polyline)
 	}
 }
 
-func TestGoogleRouter_Fallback_NoRoutes(t *testing.T) {
-	// Server returns 200 but with empty routes array.
+// ---- polyline ----
+
+func TestPolyline_GoogleExample(t *testing.T) {
+	// Example from Google's Encoded Polyline Algorithm documentation.
+	const encoded = "_p~iF~ps|U_ulLnnqC_mqNvxq`@"
+	want := []latLng{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}
+
+	got, err := decodePolyline(encoded, polylinePrecision5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("len = %d, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if math.Abs(got[i].Lat-want[i].Lat) > 1e-9 || math.Abs(got[i].Lng-want[i].Lng) > 1e-9 {
+			t.Errorf("point %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if enc := encodePolyline(want, polylinePrecision5); enc != encoded {
+		t.Errorf("encode = %q, want %q", enc, encoded)
+	}
+}
+
+func TestPolyline_Reencode(t *testing.T) {
+	points := []latLng{{-12.046374, -77.042793}, {-12.055123, -77.053456}}
+	p6 := encodePolyline(points, polylinePrecision6)
+
+	p5, err := reencodePolyline(p6, polylinePrecision6, polylinePrecision5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := encodePolyline(points, polylinePrecision5); p5 != want {
+		t.Errorf("reencode = %q, want %q", p5, want)
+	}
+}
+
+func TestPolyline_Truncated(t *testing.T) {
+	if _, err := decodePolyline("_p~iF~ps|", polylinePrecision5); err == nil {
+		t.Error("expected error for truncated polyline")
+	}
+}
+
+// ---- OSRMRouter ----
+
+func TestOSRMRouter_Success(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_, _ = w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"_p~iF~ps|U","distance":1234.6,"duration":301.2}]}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	req := RoutingRequest{OriginLat: -12.046, OriginLon: -77.042, DestinationLat: -12.055, DestinationLon: -77.053, Mode: TravelModeDrive}
+	resp, err := NewOSRMRouter(map[TravelMode]string{TravelModeDrive: srv.URL + "/"}).Route(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotPath != "/route/v1/driving/-77.042,-12.046;-77.053,-12.055" {
+		t.Errorf("path = %q", gotPath)
+	}
+	if resp.Polyline != "_p~iF~ps|U" || resp.DistanceM != 1235 || resp.DurationS != 301 || resp.IsFallback {
+		t.Errorf("resp = %+v", resp)
+	}
+}
+
+func TestOSRMRouter_Errors(t *testing.T) {
+	cases := map[string]struct {
+		status int
+		body   string
+	}{
+		"no route":  {http.StatusOK, `{"code":"NoRoute","message":"Impossible route between points"}`},
+		"bad query": {http.StatusBadRequest, `{"code":"InvalidQuery","message":"Query string malformed"}`},
+		"not json":  {http.StatusBadGateway, `<html>bad gateway</html>`},
+		"empty":     {http.StatusOK, `{"code":"Ok","routes":[]}`},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			t.Cleanup(srv.Close)
+
+			if _, err := NewOSRMRouter(map[TravelMode]string{TravelModeWalk: srv.URL}).Route(context.Background(), RoutingRequest{}); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestOSRMRouter_ModeServers(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_, _ = w.Write([]byte(`{"code":"Ok","routes":[{"geometry":"_p~iF~ps|U","distance":400,"duration":290}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	router := NewOSRMRouter(map[TravelMode]string{TravelModeWalk: srv.URL, TravelModeBicycle: ""})
+
+	if _, err := router.Route(context.Background(), RoutingRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(gotPath, "/route/v1/walking/") {
+		t.Errorf("path = %q, want walking profile", gotPath)
+	}
+
+	for _, mode := range []TravelMode{TravelModeDrive, TravelModeBicycle} {
+		if _, err := router.Route(context.Background(), RoutingRequest{Mode: mode}); !errors.Is(err, ErrUnsupportedMode) {
+			t.Errorf("%s: err = %v, want ErrUnsupportedMode", mode, err)
+		}
+	}
+}
+
+func TestOSRMRouter_StepsAndAlternates(t *testing.T) {
+	var gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		_, _ = w.Write([]byte(`{"code":"Ok","routes":[
+			{"geometry":"best","distance":500,"duration":360,"legs":[{"distance":500,"duration":360,"steps":[
+				{"geometry":"s1","distance":120.4,"duration":90,"name":"Jr. Ica","maneuver":{"type":"depart"}},
+				{"geometry":"s2","distance":379.6,"duration":270,"name":"Av. Tacna","maneuver":{"type":"turn","modifier":"slight right"}},
+				{"geometry":"s3","distance":0,"duration":0,"name":"Av. Tacna","maneuver":{"type":"arrive"}}]}]},
+			{"geometry":"alt","distance":560,"duration":400,"legs":[{"distance":560,"duration":400,"steps":[]}]}]}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	req := RoutingRequest{Steps: true, Alternatives: true}
+	resp, err := NewOSRMRouter(map[TravelMode]string{TravelModeWalk: srv.URL}).Route(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(gotQuery, "steps=true") || !strings.Contains(gotQuery, "alternatives=true") {
+		t.Errorf("query = %q", gotQuery)
+	}
+	steps := resp.Legs[0].Steps
+	if len(steps) != 3 {
+		t.Fatalf("steps = %+v, want 3", steps)
+	}
+	want := Step{Instruction: "Gira levemente a la derecha por Av. Tacna", DistanceM: 380, DurationS: 270, Maneuver: ManeuverTurnSlightRight, Polyline: "s2"}
+	if steps[1] != want {
+		t.Errorf("step = %+v, want %+v", steps[1], want)
+	}
+	if steps[2].Instruction != "Llegaste a tu destino" {
+		t.Errorf("arrive instruction = %q", steps[2].Instruction)
+	}
+	if len(resp.Alternates) != 1 || resp.Alternates[0].Polyline != "alt" {
+		t.Errorf("alternates = %+v", resp.Alternates)
+	}
+}
+
+func TestOSRMManeuver(t *testing.T) {
+	cases := []struct{ typ, modifier, want string }{
+		{"depart", "", ManeuverDepart},
+		{"turn", "left", ManeuverTurnLeft},
+		{"turn", "sharp right", ManeuverTurnSharpRight},
+		{"new name", "straight", ManeuverStraight},
+		{"continue", "uturn", ManeuverUturnLeft},
+		{"fork", "slight left", ManeuverForkLeft},
+		{"off ramp", "right", ManeuverRampRight},
+		{"rotary", "right", ManeuverRoundabout},
+		{"end of road", "right", ManeuverTurnRight},
+	}
+	for _, tc := range cases {
+		if got := osrmManeuver(tc.typ, tc.modifier); got != tc.want {
+			t.Errorf("osrmManeuver(%q, %q) = %q, want %q", tc.typ, tc.modifier, got, tc.want)
+		}
+	}
+}
+
+func TestGoogleManeuver(t *testing.T) {
+	for in, want := range map[string]string{
+		"TURN_SLIGHT_LEFT":     ManeuverTurnSlightLeft,
+		"ROUNDABOUT_RIGHT":     ManeuverRoundaboutRight,
+		"NAME_CHANGE":          ManeuverStraight,
+		"FERRY_TRAIN":          ManeuverFerry,
+		"MANEUVER_UNSPECIFIED": "",
+		"SOMETHING_NEW":        "",
+	} {
+		if got := googleManeuver(in); got != want {
+			t.Errorf("googleManeuver(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// ---- ValhallaRouter ----
+
+func TestValhallaRouter_Success(t *testing.T) {
+	points := []latLng{{-12.046, -77.042}, {-12.050, -77.047}, {-12.055, -77.053}}
+	var gotCosting string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body valhallaRouteRequest
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		gotCosting = body.Costing
+		resp := valhallaRouteResponse{Trip: valhallaTrip{
+			Legs:    []valhallaLeg{{Shape: encodePolyline(points, polylinePrecision6)}},
+			Summary: valhallaSummary{Length: 1.2345, Time: 300.4},
+		}}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+
+	resp, err := NewValhallaRouter(srv.URL).Route(context.Background(), RoutingRequest{Mode: TravelModeDrive})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotCosting != "auto" {
+		t.Errorf("costing = %q, want auto", gotCosting)
+	}
+	if want := encodePolyline(points, polylinePrecision5); resp.Polyline != want {
+		t.Errorf("polyline = %q, want precision-5 %q", resp.Polyline, want)
+	}
+	if resp.DistanceM != 1235 || resp.DurationS != 300 {
+		t.Errorf("distance = %d, duration = %d; want 1235, 300", resp.DistanceM, resp.DurationS)
+	}
+}
+
+func TestValhallaRouter_Costing(t *testing.T) {
+	var gotCosting string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body valhallaRouteRequest
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		gotCosting = body.Costing
+		resp := valhallaRouteResponse{Trip: valhallaTrip{Legs: []valhallaLeg{{Shape: ""}}}}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+
+	for mode, want := range map[TravelMode]string{"": "pedestrian", TravelModeWalk: "pedestrian", TravelModeBicycle: "bicycle", TravelModeDrive: "auto"} {
+		if _, err := NewValhallaRouter(srv.URL).Route(context.Background(), RoutingRequest{Mode: mode}); err != nil {
+			t.Fatalf("%q: unexpected error: %v", mode, err)
+		}
+		if gotCosting != want {
+			t.Errorf("%q: costing = %q, want %q", mode, gotCosting, want)
+		}
+	}
+}
+
+func TestValhallaRouter_StepsAndAlternates(t *testing.T) {
+	points := []latLng{{-12.046, -77.042}, {-12.050, -77.047}, {-12.055, -77.053}}
+	shape := encodePolyline(points, polylinePrecision6)
+	var gotBody valhallaRouteRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+		trip := valhallaTrip{
+			Legs: []valhallaLeg{{
+				Shape:   shape,
+				Summary: valhallaSummary{Length: 1.2, Time: 300},
+				Maneuvers: []valhallaManeuver{
+					{Type: 1, Instruction: "Camina hacia el norte por Jirón Ica.", Length: 0.5, Time: 120, BeginShapeIndex: 0, EndShapeIndex: 1},
+					{Type: 15, Instruction: "Gira a la izquierda en Avenida Tacna.", Length: 0.7, Time: 180, BeginShapeIndex: 1, EndShapeIndex: 2},
+					{Type: 4, Instruction: "Has llegado a tu destino.", BeginShapeIndex: 2, EndShapeIndex: 2},
+				},
+			}},
+			Summary: valhallaSummary{Length: 1.2, Time: 300},
+		}
+		_ = json.NewEncoder(w).Encode(valhallaRouteResponse{Trip: trip, Alternates: []valhallaAlternate{{Trip: trip}}})
+	}))
+	t.Cleanup(srv.Close)
+
+	resp, err := NewValhallaRouter(srv.URL).Route(context.Background(), RoutingRequest{Steps: true, Alternatives: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !gotBody.Narrative || gotBody.Alternates != valhallaAlternates {
+		t.Errorf("narrative = %v, alternates = %d", gotBody.Narrative, gotBody.Alternates)
+	}
+	steps := resp.Legs[0].Steps
+	if len(steps) != 3 {
+		t.Fatalf("steps = %+v, want 3", steps)
+	}
+	want := Step{
+		Instruction: "Gira a la izquierda en Avenida Tacna.",
+		DistanceM:   700,
+		DurationS:   180,
+		Maneuver:    ManeuverTurnLeft,
+		Polyline:    encodePolyline(points[1:3], polylinePrecision5),
+	}
+	if steps[1] != want {
+		t.Errorf("step = %+v, want %+v", steps[1], want)
+	}
+	if steps[2].Maneuver != ManeuverArrive {
+		t.Errorf("last maneuver = %q, want arrive", steps[2].Maneuver)
+	}
+	if len(resp.Alternates) != 1 || len(resp.Alternates[0].Legs) != 1 {
+		t.Errorf("alternates = %+v", resp.Alternates)
+	}
+}
+
+func TestValhallaRouter_ErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error_code":442,"error":"No path could be found for input"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	if _, err := NewValhallaRouter(srv.URL).Route(context.Background(), RoutingRequest{}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+// ---- CircuitBreaker ----
+
+// fakeClock is a manually advanced clock for breaker tests.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(clock *fakeClock) *CircuitBreaker {
+	return NewCircuitBreaker(
+		WithBreakerThreshold(10*time.Second, 4, 0.5),
+		WithBreakerCooldown(5*time.Second),
+		withBreakerClock(clock.now),
+	)
+}
+
+func TestCircuitBreaker_OpensOnErrorRate(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	b := newTestBreaker(clock)
+
+	// 3 failures are below minRequests.
+	for range 3 {
+		b.Allow()
+		b.Failure()
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("state = %s before minRequests, want closed", b.State())
+	}
+
+	b.Allow()
+	b.Failure()
+	if b.State() != BreakerOpen {
+		t.Fatalf("state = %s, want open", b.State())
+	}
+	if b.Allow() {
+		t.Error("open breaker allowed a call")
+	}
+}
+
+func TestCircuitBreaker_StaysClosedBelowRatio(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	b := newTestBreaker(clock)
+
+	for range 4 {
+		b.Allow()
+		b.Success()
+	}
+	for range 3 {
+		b.Allow()
+		b.Failure()
+	}
+	if b.State() != BreakerClosed {
+		t.Errorf("state = %s at 3/7 failures, want closed", b.State())
+	}
+}
+
+func TestCircuitBreaker_OldOutcomesExpire(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	b := newTestBreaker(clock)
+
+	for range 3 {
+		b.Allow()
+		b.Failure()
+	}
+	// The window has moved on: the earlier failures no longer count.
+	clock.advance(11 * time.Second)
+	b.Allow()
+	b.Failure()
+	if b.State() != BreakerClosed {
+		t.Errorf("state = %s, want closed once old failures expired", b.State())
+	}
+}
+
+func TestCircuitBreaker_HalfOpenProbe(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	b := newTestBreaker(clock)
+	for range 4 {
+		b.Allow()
+		b.Failure()
+	}
+
+	clock.advance(5 * time.Second)
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("state = %s after cooldown, want half-open", b.State())
+	}
+	if !b.Allow() {
+		t.Fatal("half-open breaker rejected the probe")
+	}
+	if b.Allow() {
+		t.Error("half-open breaker allowed a second concurrent probe")
+	}
+
+	// A failed probe re-opens for another cooldown.
+	b.Failure()
+	if b.State() != BreakerOpen || b.Allow() {
+		t.Fatalf("state = %s after failed probe, want open", b.State())
+	}
+
+	clock.advance(5 * time.Second)
+	if !b.Allow() {
+		t.Fatal("half-open breaker rejected the probe")
+	}
+	b.Success()
+	if b.State() != BreakerClosed {
+		t.Errorf("state = %s after successful probe, want closed", b.State())
+	}
+	// The failures that opened it are forgotten.
+	b.Allow()
+	b.Failure()
+	if b.State() != BreakerClosed {
+		t.Errorf("state = %s after one failure, want closed", b.State())
+	}
+}
+
+func TestCircuitBreaker_IgnoreReleasesProbe(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	b := newTestBreaker(clock)
+	for range 4 {
+		b.Allow()
+		b.Failure()
+	}
+	clock.advance(5 * time.Second)
+
+	b.Allow()
+	b.Ignore()
+	if !b.Allow() {
+		t.Error("ignored probe did not release the half-open slot")
+	}
+}
+
+// ---- ChainRouter ----
+
+func TestChainRouter_FirstSuccessWins(t *testing.T) {
+	first := &mockRouter{resp: &RoutingResponse{Polyline: "osrm", Provider: ProviderOSRM}}
+	second := &mockRouter{resp: &RoutingResponse{Polyline: "google"}}
+	chain := NewChainRouter([]ChainLink{
+		{Name: ProviderOSRM, Router: first},
+		{Name: ProviderGoogle, Router: second},
+	})
+
+	resp, err := chain.Route(context.Background(), RoutingRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Provider != ProviderOSRM || second.calls != 0 {
+		t.Errorf("provider = %q, second calls = %d; want osrm, 0", resp.Provider, second.calls)
+	}
+}
+
+func TestChainRouter_FallsThroughAndSetsProvider(t *testing.T) {
+	failing := &mockRouter{err: errors.New("boom")}
+	// The second router does not set Provider: the chain fills in its name.
+	ok := &mockRouter{resp: &RoutingResponse{Polyline: "v"}}
+	var logged int
+	chain := NewChainRouter([]ChainLink{
+		{Name: ProviderOSRM, Router: failing},
+		{Name: ProviderValhalla, Router: ok},
+	}, WithChainLogger(func(string, ...any) { logged++ }))
+
+	resp, err := chain.Route(context.Background(), RoutingRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Provider != ProviderValhalla {
+		t.Errorf("provider = %q, want valhalla", resp.Provider)
+	}
+	if logged == 0 {
+		t.Error("provider failure was not logged")
+	}
+}
+
+func TestChainRouter_SkipsOpenCircuit(t *testing.T) {
+	failing := &mockRouter{err: errors.New("boom")}
+	fallback := &mockRouter{resp: &RoutingResponse{}}
+	chain := NewChainRouter([]ChainLink{
+		{Name: ProviderGoogle, Router: failing},
+		{Name: ProviderStraightLine, Router: fallback},
+	}, WithBreakerOptions(WithBreakerThreshold(time.Minute, 2, 0.5)))
+
+	for range 5 {
+		if _, err := chain.Route(context.Background(), RoutingRequest{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if failing.calls != 2 {
+		t.Errorf("failing provider called %d times, want 2 before its circuit opened", failing.calls)
+	}
+	if got := chain.States()[ProviderGoogle]; got != BreakerOpen {
+		t.Errorf("google circuit = %s, want open", got)
+	}
+}
+
+func TestChainRouter_UnsupportedModeSkipped(t *testing.T) {
+	unsupported := &mockRouter{err: fmt.Errorf("osrm: %w", ErrUnsupportedMode)}
+	ok := &mockRouter{resp: &RoutingResponse{}}
+	chain := NewChainRouter([]ChainLink{
+		{Name: ProviderOSRM, Router: unsupported},
+		{Name: ProviderGoogle, Router: ok},
+	}, WithBreakerOptions(WithBreakerThreshold(time.Minute, 1, 0.5)))
+
+	for range 3 {
+		if _, err := chain.Route(context.Background(), RoutingRequest{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if unsupported.calls != 3 {
+		t.Errorf("unsupported provider called %d times, want 3", unsupported.calls)
+	}
+	if got := chain.States()[ProviderOSRM]; got != BreakerClosed {
+		t.Errorf("osrm circuit = %s, want closed", got)
+	}
+}
+
+func TestChainRouter_AllFail(t *testing.T) {
+	errA, errB := errors.New("a down"), errors.New("b down")
+	chain := NewChainRouter([]ChainLink{
+		{Name: ProviderOSRM, Router: &mockRouter{err: errA}},
+		{Name: ProviderGoogle, Router: &mockRouter{err: errB}},
+	})
+
+	_, err := chain.Route(context.Background(), RoutingRequest{})
+	if !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Errorf("err = %v, want both provider errors", err)
+	}
+}
+
+func TestChainRouter_CancelledContext_NotCountedAsFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	first := &mockRouter{err: context.Canceled}
+	second := &mockRouter{resp: &RoutingResponse{}}
+	chain := NewChainRouter([]ChainLink{
+		{Name: ProviderOSRM, Router: first},
+		{Name: ProviderStraightLine, Router: second},
+	}, WithBreakerOptions(WithBreakerThreshold(time.Minute, 1, 0.5)))
+
+	if _, err := chain.Route(ctx, RoutingRequest{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if second.calls != 0 {
+		t.Errorf("next provider called %d times after cancellation, want 0", second.calls)
+	}
+	if got := chain.States()[ProviderOSRM]; got != BreakerClosed {
+		t.Errorf("osrm circuit = %s, want closed", got)
+	}
+}
+
+// ---- QuotaMeter ----
+
+// mockUsageStore is an in-memory UsageStore keyed by day.
+type mockUsageStore struct {
+	calls  map[string]int64
+	getErr error
+	incErr error
+}
+
+func newMockUsageStore() *mockUsageStore {
+	return &mockUsageStore{calls: make(map[string]int64)}
+}
+
+func (m *mockUsageStore) usage(day time.Time) Usage {
+	u := Usage{Day: m.calls[day.Format(time.DateOnly)]}
+	for d, n := range m.calls {
+		if d[:7] == day.Format("2006-01") && d <= day.Format(time.DateOnly) {
+			u.Month += n
+		}
+	}
+	return u
+}
+
+func (m *mockUsageStore) IncrementUsage(_ context.Context, day time.Time) (Usage, error) {
+	if m.incErr != nil {
+		return Usage{}, m.incErr
+	}
+	m.calls[day.Format(time.DateOnly)]++
+	return m.usage(day), nil
+}
+
+func (m *mockUsageStore) GetUsage(_ context.Context, day time.Time) (Usage, error) {
+	if m.getErr != nil {
+		return Usage{}, m.getErr
+	}
+	return m.usage(day), nil
+}
+
+func TestQuotaMeter_Levels(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)}
+	store := newMockUsageStore()
+	m := NewQuotaMeter(store, QuotaCaps{SoftDaily: 2, HardDaily: 3}, 5, withQuotaClock(clock.now))
+
+	for i, want := range []QuotaLevel{QuotaNormal, QuotaNormal, QuotaSoft, QuotaHard} {
+		if got := m.Level(context.Background()); got != want {
+			t.Errorf("after %d calls: level = %s, want %s", i, got, want)
+		}
+		if i < 3 {
+			if err := m.Reserve(context.Background()); err != nil {
+				t.Fatalf("Reserve %d: %v", i, err)
+			}
+		}
+	}
+
+	if err := m.Reserve(context.Background()); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Reserve at hard cap: err = %v, want ErrQuotaExceeded", err)
+	}
+	if got := store.calls["2026-03-10"]; got != 3 {
+		t.Errorf("stored calls = %d, want 3 (the refused call is not counted)", got)
+	}
+
+	// A new day resets the daily caps.
+	clock.advance(24 * time.Hour)
+	if got := m.Level(context.Background()); got != QuotaNormal {
+		t.Errorf("next day: level = %s, want normal", got)
+	}
+}
+
+func TestQuotaMeter_MonthlyCap(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)}
+	store := newMockUsageStore()
+	store.calls["2026-03-01"] = 10
+	store.calls["2026-02-28"] = 50 // previous month: not counted
+	m := NewQuotaMeter(store, QuotaCaps{HardMonthly: 10}, 5, withQuotaClock(clock.now))
+
+	if got := m.Level(context.Background()); got != QuotaHard {
+		t.Errorf("level = %s, want hard", got)
+	}
+}
+
+func TestQuotaMeter_StoreFailure_CountsLocally(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)}
+	store := newMockUsageStore()
+	store.getErr = errors.New("db down")
+	store.incErr = errors.New("db down")
+	var logged int
+	m := NewQuotaMeter(store, QuotaCaps{HardDaily: 2}, 5,
+		withQuotaClock(clock.now), WithQuotaLogger(func(string, ...any) { logged++ }))
+
+	for range 2 {
+		if err := m.Reserve(context.Background()); err != nil {
+			t.Fatalf("Reserve: %v", err)
+		}
+	}
+	if err := m.Reserve(context.Background()); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("err = %v, want ErrQuotaExceeded from the local count", err)
+	}
+	if logged == 0 {
+		t.Error("store failures were not logged")
+	}
+}
+
+func TestQuotaMeter_Reserve_DecidesOnStoreCounter(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)}
+	store := newMockUsageStore()
+	m := NewQuotaMeter(store, QuotaCaps{HardDaily: 3}, 5, withQuotaClock(clock.now))
+
+	if got := m.Level(context.Background()); got != QuotaNormal {
+		t.Fatalf("level = %s, want normal", got)
+	}
+	// Other instances used up the cap since the last read.
+	store.calls["2026-03-10"] = 3
+
+	if err := m.Reserve(context.Background()); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("err = %v, want ErrQuotaExceeded from the returned counter", err)
+	}
+	if got := m.Level(context.Background()); got != QuotaHard {
+		t.Errorf("level = %s, want hard", got)
+	}
+}
+
+// blockingUsageStore holds IncrementUsage until release is closed.
+type blockingUsageStore struct {
+	*mockUsageStore
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingUsageStore) IncrementUsage(ctx context.Context, day time.Time) (Usage, error) {
+	close(b.entered)
+	<-b.release
+	return b.mockUsageStore.IncrementUsage(ctx, day)
+}
+
+func TestQuotaMeter_Reserve_DoesNotLockAcrossIncrement(t *testing.T) {
+	store := &blockingUsageStore{mockUsageStore: newMockUsageStore(), entered: make(chan struct{}), release: make(chan struct{})}
+	m := NewQuotaMeter(store, QuotaCaps{HardDaily: 10}, 5)
+
+	reserved := make(chan error, 1)
+	go func() { reserved <- m.Reserve(context.Background()) }()
+	<-store.entered
+
+	level := make(chan QuotaLevel, 1)
+	go func() { level <- m.Level(context.Background()) }()
+	select {
+	case <-level:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Level waited for the increment of Reserve")
+	}
+	close(store.release)
+	if err := <-reserved; err != nil {
+		t.Errorf("Reserve: %v", err)
+	}
+}
+
+func TestQuotaMeter_Report(t *testing.T) {
+	// Noon of day 10 of a 30-day month: a third of the month has elapsed
+	// (9.5 of 30 days ≈ 0.3167).
+	clock := &fakeClock{t: time.Date(2026, 4, 10, 12, 0, 0, 0, time.Local)}
+	store := newMockUsageStore()
+	store.calls["2026-04-01"] = 900
+	store.calls["2026-04-10"] = 100
+	m := NewQuotaMeter(store, QuotaCaps{SoftMonthly: 1000}, 5, withQuotaClock(clock.now))
+
+	r, err := m.Report(context.Background())
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	if r.Day != "2026-04-10" || r.DayCalls != 100 || r.MonthCalls != 1000 {
+		t.Errorf("usage = %s %d/%d, want 2026-04-10 100/1000", r.Day, r.DayCalls, r.MonthCalls)
+	}
+	if r.Level != "soft" {
+		t.Errorf("level = %q, want soft", r.Level)
+	}
+	if r.MonthSpendUSD != 5 {
+		t.Errorf("month spend = %v, want 5", r.MonthSpendUSD)
+	}
+	// 1000 calls in 9.5 days → 3157 in 30 days.
+	if r.ProjectedMonthCalls != 3157 {
+		t.Errorf("projected calls = %d, want 3157", r.ProjectedMonthCalls)
+	}
+	if math.Abs(r.ProjectedMonthSpendUSD-15.785) > 1e-9 {
+		t.Errorf("projected spend = %v, want 15.785", r.ProjectedMonthSpendUSD)
+	}
+}
+
+func TestGoogleRouter_HardCap_DoesNotCallAPI(t *testing.T) {
+	var hits int
 	_, router := newFakeGoogleServer(t, func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte(`{"routes":[]}`))
+		hits++
+		_, _ = w.Write([]byte(`{"routes":[{"distanceMeters":1,"duration":"1s","polyline":{"encodedPolyline":"x"}}]}`))
 	})
+	router.quota = NewQuotaMeter(newMockUsageStore(), QuotaCaps{HardDaily: 1}, 5)
 
 	req := RoutingRequest{OriginLat: -12.046, OriginLon: -77.042, DestinationLat: -12.055, DestinationLon: -77.053}
-	resp, err := router.Route(context.Background(), req)
+	if _, err := router.Route(context.Background(), req); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	if _, err := router.Route(context.Background(), req); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("second call: err = %v, want ErrQuotaExceeded", err)
+	}
+	if hits != 1 {
+		t.Errorf("API called %d times, want 1", hits)
+	}
+}
+
+func TestChainRouter_QuotaExceededSkipped(t *testing.T) {
+	capped := &mockRouter{err: fmt.Errorf("google: %w", ErrQuotaExceeded)}
+	ok := &mockRouter{resp: &RoutingResponse{}}
+	chain := NewChainRouter([]ChainLink{
+		{Name: ProviderGoogle, Router: capped},
+		{Name: ProviderStraightLine, Router: ok},
+	}, WithBreakerOptions(WithBreakerThreshold(time.Minute, 1, 0.5)))
+
+	if _, err := chain.Route(context.Background(), RoutingRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := chain.States()[ProviderGoogle]; got != BreakerClosed {
+		t.Errorf("google circuit = %s, want closed", got)
+	}
+}
+
+func TestCachedRouter_SoftCap_SearchesWiderCell(t *testing.T) {
+	store := newMockCacheStore()
+	inner := &mockRouter{resp: &RoutingResponse{Polyline: "inner"}}
+	quotaStore := newMockUsageStore()
+	quota := NewQuotaMeter(quotaStore, QuotaCaps{SoftDaily: 1}, 5)
+	done := make(chan struct{}, 1)
+	cr := NewCachedRouter(inner, store, WithQuotaMeter(quota), withAfterStore(func() { done <- struct{}{} }))
+
+	// A route cached from a nearby origin in the same precision-6 cell.
+	req := RoutingRequest{OriginLat: -12.046, OriginLon: -77.042, DestinationLat: -12.055, DestinationLon: -77.053}
+	key := originHash(req.OriginLat, req.OriginLon)
+	neighbour := key[:wideGeohashPrecision] + strings.Repeat("0", len(key)-wideGeohashPrecision)
+	if neighbour == key {
+		t.Fatal("test neighbour must differ from the origin hash")
+	}
+	store.data[store.cacheKey(neighbour, 0, TravelModeWalk)] = &RoutingResponse{Polyline: "near"}
+
+	// Below the soft cap the wider cell is not searched.
+	got, err := cr.Route(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Polyline != "inner" || store.nearCalls != 0 {
+		t.Errorf("polyline = %q, near lookups = %d; want inner, 0", got.Polyline, store.nearCalls)
+	}
+	<-done
+	delete(store.data, store.cacheKey(key, 0, TravelModeWalk))
+
+	if err := quota.Reserve(context.Background()); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	got, err = cr.Route(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Polyline != "near" || inner.calls != 1 {
+		t.Errorf("polyline = %q, inner calls = %d; want near, 1", got.Polyline, inner.calls)
+	}
+}
+
+func TestCachedRouter_SoftCap_MissSkipsMeteredProvider(t *testing.T) {
+	var hits int
+	_, google := newFakeGoogleServer(t, func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		_, _ = w.Write([]byte(`{"routes":[{"distanceMeters":1,"duration":"1s","polyline":{"encodedPolyline":"x"}}]}`))
+	})
+	quota := NewQuotaMeter(newMockUsageStore(), QuotaCaps{SoftDaily: 1, HardDaily: 100}, 5)
+	google.quota = quota
+	free := &mockRouter{resp: &RoutingResponse{Polyline: "free"}}
+	chain := NewChainRouter([]ChainLink{
+		{Name: ProviderGoogle, Router: google},
+		{Name: ProviderOSRM, Router: free},
+	})
+	cr := NewCachedRouter(chain, newMockCacheStore(), WithQuotaMeter(quota))
+
+	if err := quota.Reserve(context.Background()); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	req := RoutingRequest{OriginLat: -12.046, OriginLon: -77.042, DestinationLat: -12.055, DestinationLon: -77.053}
+	got, err := cr.Route(context.Background(), req)
 	if err != nil {
-		t.Fatalf("fallback should not return error, got: %v", err)
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Polyline != "free" || hits != 0 {
+		t.Errorf("polyline = %q, google hits = %d; want free, 0 at the soft cap", got.Polyline, hits)
+	}
+
+	// Outside the cache layer the soft cap does not apply.
+	if _, err := google.Route(context.Background(), req); err != nil || hits != 1 {
+		t.Errorf("direct call: err = %v, hits = %d; want the API called", err, hits)
+	}
+}
+
+// ---- CachedRouter coalescing ----
+
+// blockingRouter holds every call until release is closed.
+type blockingRouter struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (b *blockingRouter) Route(ctx context.Context, req RoutingRequest) (*RoutingResponse, error) {
+	b.calls.Add(1)
+	select {
+	case <-b.release:
+		return &RoutingResponse{Polyline: "shared", DistanceM: 300}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// waitForMisses blocks until cr has counted n cache misses, then gives the
+// last callers a moment to join the flight.
+func waitForMisses(t *testing.T, cr *CachedRouter, n uint64) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for cr.CoalesceStats().Misses < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("misses = %d, want %d", cr.CoalesceStats().Misses, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+}
+
+func TestCachedRouter_ConcurrentMisses_ShareOneCall(t *testing.T) {
+	const callers = 10
+	inner := &blockingRouter{release: make(chan struct{})}
+	cr := NewCachedRouter(inner, &spyCacheStore{})
+
+	// Origins a few metres apart fall in the same geohash cell.
+	var wg sync.WaitGroup
+	got := make([]*RoutingResponse, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := RoutingRequest{OriginLat: -12.04600 + float64(i)*1e-6, OriginLon: -77.042, DestinationLat: -12.055, DestinationLon: -77.053}
+			got[i], _ = cr.Route(WithStopID(context.Background(), 4), req)
+		}()
+	}
+	waitForMisses(t, cr, callers)
+	close(inner.release)
+	wg.Wait()
+
+	if n := inner.calls.Load(); n != 1 {
+		t.Errorf("inner calls = %d, want 1", n)
+	}
+	for i, r := range got {
+		if r == nil || r.Polyline != "shared" {
+			t.Errorf("caller %d: got %+v, want the shared route", i, r)
+		}
+	}
+	want := CoalesceStats{Misses: callers, Flights: 1, Deduplicated: callers - 1}
+	if s := cr.CoalesceStats(); s != want {
+		t.Errorf("stats = %+v, want %+v", s, want)
+	}
+}
+
+func TestCachedRouter_DifferentKeys_NotShared(t *testing.T) {
+	inner := &blockingRouter{release: make(chan struct{})}
+	close(inner.release)
+	cr := NewCachedRouter(inner, &spyCacheStore{})
+
+	req := RoutingRequest{OriginLat: -12.046, OriginLon: -77.042, DestinationLat: -12.055, DestinationLon: -77.053}
+	ctx := WithStopID(context.Background(), 4)
+	if _, err := cr.Route(ctx, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Same origin and stop but steps requested: a different answer.
+	req.Steps = true
+	if _, err := cr.Route(ctx, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := inner.calls.Load(); n != 2 {
+		t.Errorf("inner calls = %d, want 2", n)
+	}
+}
+
+func TestCachedRouter_CancelledWaiter_DoesNotCancelFlight(t *testing.T) {
+	inner := &blockingRouter{release: make(chan struct{})}
+	cr := NewCachedRouter(inner, &spyCacheStore{})
+	req := RoutingRequest{OriginLat: -12.046, OriginLon: -77.042, DestinationLat: -12.055, DestinationLon: -77.053}
+
+	// The first caller starts the flight and goes away.
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := cr.Route(ctx, req)
+		errc <- err
+	}()
+	waitForMisses(t, cr, 1)
+
+	done := make(chan *RoutingResponse, 1)
+	go func() {
+		resp, _ := cr.Route(context.Background(), req)
+		done <- resp
+	}()
+	waitForMisses(t, cr, 2)
+
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller: err = %v, want context.Canceled", err)
+	}
+	close(inner.release)
+	if resp := <-done; resp == nil || resp.Polyline != "shared" {
+		t.Errorf("waiting caller: got %+v, want the shared route", resp)
+	}
+}
+
+// ---- CachedRouter stale-while-revalidate ----
+
+// recordingRouter returns a fixed response and records the requests it gets.
+type recordingRouter struct {
+	resp *RoutingResponse
+	mu   sync.Mutex
+	reqs []RoutingRequest
+}
+
+func (m *recordingRouter) Route(_ context.Context, req RoutingRequest) (*RoutingResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reqs = append(m.reqs, req)
+	return m.resp, nil
+}
+
+func (m *recordingRouter) calls() []RoutingRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]RoutingRequest(nil), m.reqs...)
+}
+
+// waitForRefreshes waits until p has run n refreshes.
+func waitForRefreshes(t *testing.T, p *refresh.Pool, n uint64) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for p.Stats().Completed < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("refreshes = %d, want %d", p.Stats().Completed, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCachedRouter_StaleWithoutPool_IsMiss(t *testing.T) {
+	store := newMockCacheStore()
+	inner := &mockRouter{resp: &RoutingResponse{Polyline: "fresh"}}
+	clock := &fakeClock{t: time.Now()}
+	cr := NewCachedRouter(inner, store, withClock(clock.now))
+
+	req := RoutingRequest{OriginLat: -12.046, OriginLon: -77.042}
+	key := store.cacheKey(originHash(req.OriginLat, req.OriginLon), noStopID, TravelModeWalk)
+	store.data[key] = &RoutingResponse{Polyline: "old", CachedAt: clock.t.Add(-cacheSoftTTL)}
+
+	got, err := cr.Route(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Polyline != "fresh" || inner.calls != 1 {
+		t.Errorf("polyline = %q, inner calls = %d; want fresh, 1", got.Polyline, inner.calls)
+	}
+}
+
+func TestCachedRouter_Stale_ServedAndRefreshed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool := refresh.NewPool(ctx, 1)
+
+	store := newMockCacheStore()
+	inner := &recordingRouter{resp: &RoutingResponse{Polyline: "fresh", Legs: []Leg{}}}
+	clock := &fakeClock{t: time.Now()}
+	cr := NewCachedRouter(inner, store, WithRefreshPool(pool), withClock(clock.now))
+
+	req := RoutingRequest{OriginLat: -12.046, OriginLon: -77.042}
+	key := store.cacheKey(originHash(req.OriginLat, req.OriginLon), 7, TravelModeWalk)
+	cachedAt := clock.t.Add(-cacheSoftTTL - 30*time.Second)
+	store.data[key] = &RoutingResponse{Polyline: "old", Legs: []Leg{}, CachedAt: cachedAt}
+
+	// Fresh entries are served without a refresh.
+	clock.advance(-time.Minute)
+	if got, _ := cr.Route(WithStopID(context.Background(), 7), req); got.Polyline != "old" || pool.Stats().Submitted != 0 {
+		t.Fatalf("fresh entry: polyline = %q, refreshes = %d; want old, 0", got.Polyline, pool.Stats().Submitted)
+	}
+	clock.advance(time.Minute)
+
+	got, err := cr.Route(WithStopID(context.Background(), 7), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Polyline != "old" || !got.CachedAt.Equal(cachedAt) {
+		t.Errorf("got %+v, want the stale entry with its CachedAt", got)
+	}
+
+	waitForRefreshes(t, pool, 1)
+	calls := inner.calls()
+	if len(calls) != 1 {
+		t.Fatalf("inner calls = %d, want 1 (the refresh)", len(calls))
+	}
+	if !calls[0].Steps {
+		t.Error("refresh dropped the steps of the stale entry")
+	}
+	if store.data[key].Polyline != "fresh" {
+		t.Errorf("stored polyline = %q, want the refreshed route", store.data[key].Polyline)
+	}
+}
+
+func TestCachedRouter_Stale_NoRefreshAtSoftCap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool := refresh.NewPool(ctx, 1)
+
+	quota := NewQuotaMeter(newMockUsageStore(), QuotaCaps{SoftDaily: 1}, 5)
+	if err := quota.Reserve(context.Background()); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	store := newMockCacheStore()
+	inner := &recordingRouter{resp: &RoutingResponse{Polyline: "fresh"}}
+	clock := &fakeClock{t: time.Now()}
+	cr := NewCachedRouter(inner, store, WithRefreshPool(pool), WithQuotaMeter(quota), withClock(clock.now))
+
+	req := RoutingRequest{OriginLat: -12.046, OriginLon: -77.042}
+	key := store.cacheKey(originHash(req.OriginLat, req.OriginLon), noStopID, TravelModeWalk)
+	store.data[key] = &RoutingResponse{Polyline: "old", CachedAt: clock.t.Add(-cacheSoftTTL)}
+
+	if got, _ := cr.Route(context.Background(), req); got.Polyline != "old" {
+		t.Errorf("polyline = %q, want the stale entry", got.Polyline)
 	}
-	if !resp.IsFallback {
-		t.Error("IsFallback should be true when no routes returned")
+	waitForRefreshes(t, pool, 1)
+	if n := len(inner.calls()); n != 0 {
+		t.Errorf("inner calls = %d, want 0 at the soft cap", n)
 	}
 }
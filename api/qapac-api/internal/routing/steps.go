@@ -0,0 +1,184 @@
+package routing
+
+import "strings"
+
+// Route is a route between the request points. RoutingResponse describes the
+// primary route; Route is used for its alternates and for caching.
+type Route struct {
+	Polyline  string `json:"polyline"`
+	DistanceM int    `json:"distance_m"`
+	DurationS int    `json:"duration_s"`
+	Legs      []Leg  `json:"legs,omitempty"`
+}
+
+// Leg is the part of a route between two consecutive waypoints. A request
+// from an origin to a stop has a single leg.
+type Leg struct {
+	DistanceM int    `json:"distance_m"`
+	DurationS int    `json:"duration_s"`
+	Steps     []Step `json:"steps"`
+}
+
+// Step is a turn-by-turn instruction and the stretch of road it covers.
+type Step struct {
+	// Instruction is the text shown to the rider, in Spanish.
+	Instruction string `json:"instruction"`
+	DistanceM   int    `json:"distance_m"`
+	DurationS   int    `json:"duration_s"`
+	// Maneuver is one of the Maneuver* constants, or empty when the provider
+	// reports one we do not know.
+	Maneuver string `json:"maneuver,omitempty"`
+	// Polyline is the step geometry, in the same format as the route's.
+	Polyline string `json:"polyline"`
+}
+
+// Maneuvers reported in Step.Maneuver. The names follow the Google Routes API
+// in lowercase; the other providers are mapped onto them.
+const (
+	ManeuverDepart          = "depart"
+	ManeuverArrive          = "arrive"
+	ManeuverStraight        = "straight"
+	ManeuverTurnLeft        = "turn_left"
+	ManeuverTurnRight       = "turn_right"
+	ManeuverTurnSlightLeft  = "turn_slight_left"
+	ManeuverTurnSlightRight = "turn_slight_right"
+	ManeuverTurnSharpLeft   = "turn_sharp_left"
+	ManeuverTurnSharpRight  = "turn_sharp_right"
+	ManeuverUturnLeft       = "uturn_left"
+	ManeuverUturnRight      = "uturn_right"
+	ManeuverRoundabout      = "roundabout"
+	ManeuverRoundaboutLeft  = "roundabout_left"
+	ManeuverRoundaboutRight = "roundabout_right"
+	ManeuverMerge           = "merge"
+	ManeuverForkLeft        = "fork_left"
+	ManeuverForkRight       = "fork_right"
+	ManeuverRampLeft        = "ramp_left"
+	ManeuverRampRight       = "ramp_right"
+	ManeuverFerry           = "ferry"
+)
+
+// maneuverPhrases are the Spanish instructions for providers that only
+// report the maneuver (OSRM).
+var maneuverPhrases = map[string]string{
+	ManeuverDepart:          "Sal",
+	ManeuverArrive:          "Llegaste a tu destino",
+	ManeuverStraight:        "Sigue recto",
+	ManeuverTurnLeft:        "Gira a la izquierda",
+	ManeuverTurnRight:       "Gira a la derecha",
+	ManeuverTurnSlightLeft:  "Gira levemente a la izquierda",
+	ManeuverTurnSlightRight: "Gira levemente a la derecha",
+	ManeuverTurnSharpLeft:   "Gira completamente a la izquierda",
+	ManeuverTurnSharpRight:  "Gira completamente a la derecha",
+	ManeuverUturnLeft:       "Da la vuelta en U",
+	ManeuverUturnRight:      "Da la vuelta en U",
+	ManeuverRoundabout:      "Toma el óvalo",
+	ManeuverRoundaboutLeft:  "Toma el óvalo",
+	ManeuverRoundaboutRight: "Toma el óvalo",
+	ManeuverMerge:           "Incorpórate",
+	ManeuverForkLeft:        "Mantente a la izquierda",
+	ManeuverForkRight:       "Mantente a la derecha",
+	ManeuverRampLeft:        "Toma la rampa a la izquierda",
+	ManeuverRampRight:       "Toma la rampa a la derecha",
+	ManeuverFerry:           "Toma el ferry",
+}
+
+// instructionFor builds a Spanish instruction from a maneuver and the name of
+// the street it leads onto (e.g. "Gira a la derecha por Av. Arequipa").
+func instructionFor(maneuver, street string) string {
+	phrase, ok := maneuverPhrases[maneuver]
+	if !ok {
+		phrase = maneuverPhrases[ManeuverStraight]
+	}
+	if street == "" || maneuver == ManeuverArrive {
+		return phrase
+	}
+	return phrase + " por " + street
+}
+
+// googleManeuver maps a Routes API maneuver (e.g. "TURN_LEFT") to ours.
+func googleManeuver(m string) string {
+	switch m {
+	case "", "MANEUVER_UNSPECIFIED":
+		return ""
+	case "NAME_CHANGE":
+		return ManeuverStraight
+	case "FERRY_TRAIN":
+		return ManeuverFerry
+	}
+	m = strings.ToLower(m)
+	if _, ok := maneuverPhrases[m]; !ok {
+		return ""
+	}
+	return m
+}
+
+// osrmManeuver maps an OSRM maneuver type and modifier
+// (http://project-osrm.org/docs/v5.24.0/api/#stepmaneuver-object) to ours.
+func osrmManeuver(typ, modifier string) string {
+	side := func(left, right string) string {
+		switch {
+		case strings.HasSuffix(modifier, "left"):
+			return left
+		case strings.HasSuffix(modifier, "right"):
+			return right
+		}
+		return ManeuverStraight
+	}
+
+	switch typ {
+	case "depart":
+		return ManeuverDepart
+	case "arrive":
+		return ManeuverArrive
+	case "merge":
+		return ManeuverMerge
+	case "roundabout", "rotary", "roundabout turn", "exit roundabout", "exit rotary":
+		return ManeuverRoundabout
+	case "on ramp", "off ramp":
+		return side(ManeuverRampLeft, ManeuverRampRight)
+	case "fork":
+		return side(ManeuverForkLeft, ManeuverForkRight)
+	}
+
+	switch modifier {
+	case "uturn":
+		return ManeuverUturnLeft
+	case "sharp left":
+		return ManeuverTurnSharpLeft
+	case "left":
+		return ManeuverTurnLeft
+	case "slight left":
+		return ManeuverTurnSlightLeft
+	case "sharp right":
+		return ManeuverTurnSharpRight
+	case "right":
+		return ManeuverTurnRight
+	case "slight right":
+		return ManeuverTurnSlightRight
+	}
+	return ManeuverStraight
+}
+
+// valhallaManeuvers maps Valhalla maneuver types
+// (https://valhalla.github.io/valhalla/api/turn-by-turn/api-reference/#trip-legs-and-maneuvers)
+// to ours. Types not listed (transit, elevators...) have no maneuver.
+var valhallaManeuvers = map[int]string{
+	1: ManeuverDepart, 2: ManeuverDepart, 3: ManeuverDepart,
+	4: ManeuverArrive, 5: ManeuverArrive, 6: ManeuverArrive,
+	7: ManeuverStraight, 8: ManeuverStraight, 17: ManeuverStraight, 22: ManeuverStraight,
+	9:  ManeuverTurnSlightRight,
+	10: ManeuverTurnRight,
+	11: ManeuverTurnSharpRight,
+	12: ManeuverUturnRight,
+	13: ManeuverUturnLeft,
+	14: ManeuverTurnSharpLeft,
+	15: ManeuverTurnLeft,
+	16: ManeuverTurnSlightLeft,
+	18: ManeuverRampRight, 20: ManeuverRampRight,
+	19: ManeuverRampLeft, 21: ManeuverRampLeft,
+	23: ManeuverForkRight,
+	24: ManeuverForkLeft,
+	25: ManeuverMerge, 37: ManeuverMerge, 38: ManeuverMerge,
+	26: ManeuverRoundabout, 27: ManeuverRoundabout,
+	28: ManeuverFerry,
+}
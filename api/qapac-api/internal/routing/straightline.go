@@ -0,0 +1,56 @@
+package routing
+
+import (
+	"context"
+	"math"
+)
+
+// straightLineSpeedMPS is the estimated speed in m/s of each travel mode in
+// the city: ~4.5 km/h walking, ~15 km/h cycling, ~30 km/h driving.
+var straightLineSpeedMPS = map[TravelMode]float64{
+	TravelModeWalk:    4.5 / 3.6,
+	TravelModeBicycle: 15.0 / 3.6,
+	TravelModeDrive:   30.0 / 3.6,
+}
+
+// StraightLineRouter estimates a route from the great-circle distance at a
+// typical urban speed for the travel mode. It never fails, so it belongs at
+// the end of a ChainRouter.
+type StraightLineRouter struct{}
+
+// Route satisfies the Router interface.
+func (StraightLineRouter) Route(_ context.Context, req RoutingRequest) (*RoutingResponse, error) {
+	return straightLineFallback(req), nil
+}
+
+// straightLineFallback returns a rough estimate based on straight-line distance.
+// IsFallback is set to true so callers can detect degraded responses.
+func straightLineFallback(req RoutingRequest) *RoutingResponse {
+	distM := haversineMeters(req.OriginLat, req.OriginLon, req.DestinationLat, req.DestinationLon)
+	durationS := int(distM / straightLineSpeedMPS[req.mode()])
+	// Return an empty polyline on fallback — no encoded path available.
+	return &RoutingResponse{
+		Polyline:   "",
+		DistanceM:  int(distM),
+		DurationS:  durationS,
+		IsFallback: true,
+		Provider:   ProviderStraightLine,
+	}
+}
+
+// haversineMeters computes the great-circle distance in meters between two WGS84 points.
+func haversineMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusM = 6_371_000.0
+	const deg2rad = math.Pi / 180.0
+
+	dLat := (lat2 - lat1) * deg2rad
+	dLon := (lon2 - lon1) * deg2rad
+	lat1r := lat1 * deg2rad
+	lat2r := lat2 * deg2rad
+
+	sinDLat := math.Sin(dLat / 2)
+	sinDLon := math.Sin(dLon / 2)
+	a := sinDLat*sinDLat + math.Cos(lat1r)*math.Cos(lat2r)*sinDLon*sinDLon
+	c := 2 * math.Asin(math.Sqrt(a))
+	return earthRadiusM * c
+}
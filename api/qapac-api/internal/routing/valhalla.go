@@ -0,0 +1,217 @@
+package routing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// valhallaTimeout is the maximum duration for a Valhalla call.
+	valhallaTimeout = 3 * time.Second
+
+	// valhallaAlternates is how many alternate routes to ask for, as Google
+	// returns up to three.
+	valhallaAlternates = 3
+)
+
+// valhallaCosting maps each travel mode to its Valhalla costing model.
+var valhallaCosting = map[TravelMode]string{
+	TravelModeWalk:    "pedestrian",
+	TravelModeDrive:   "auto",
+	TravelModeBicycle: "bicycle",
+}
+
+// ValhallaRouter implements Router using the HTTP API of a self-hosted
+// Valhalla engine (https://valhalla.github.io/valhalla/api/turn-by-turn/api-reference/).
+type ValhallaRouter struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewValhallaRouter creates a Router backed by the Valhalla server at baseURL
+// (e.g. "http://valhalla:8002").
+func NewValhallaRouter(baseURL string) *ValhallaRouter {
+	return &ValhallaRouter{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: newHTTPClient(valhallaTimeout),
+	}
+}
+
+// Route calls the Valhalla route action and returns the trip and its
+// alternates, with their shapes re-encoded from precision 6 to 5.
+func (v *ValhallaRouter) Route(ctx context.Context, req RoutingRequest) (*RoutingResponse, error) {
+	body := valhallaRouteRequest{
+		Locations: []valhallaLocation{
+			{Lat: req.OriginLat, Lon: req.OriginLon},
+			{Lat: req.DestinationLat, Lon: req.DestinationLon},
+		},
+		Costing:   valhallaCosting[req.mode()],
+		Units:     "kilometers",
+		Language:  "es-ES",
+		Narrative: req.Steps,
+	}
+	if req.Alternatives {
+		body.Alternates = valhallaAlternates
+	}
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("routing: valhalla: marshal request: %w", err)
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, valhallaTimeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(reqCtx, http.MethodPost, v.baseURL+"/route", bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("routing: valhalla: create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := v.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("routing: valhalla: http: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	respBytes, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("routing: valhalla: read response: %w", err)
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("routing: valhalla: status %d: %s", httpResp.StatusCode, string(respBytes))
+	}
+
+	var apiResp valhallaRouteResponse
+	if err := json.Unmarshal(respBytes, &apiResp); err != nil {
+		return nil, fmt.Errorf("routing: valhalla: unmarshal response: %w", err)
+	}
+	trips := []valhallaTrip{apiResp.Trip}
+	for _, a := range apiResp.Alternates {
+		trips = append(trips, a.Trip)
+	}
+	routes := make([]Route, 0, len(trips))
+	for _, trip := range trips {
+		route, err := valhallaToRoute(trip, req.Steps)
+		if err != nil {
+			return nil, fmt.Errorf("routing: valhalla: %w", err)
+		}
+		routes = append(routes, route)
+	}
+	return newResponse(req, ProviderValhalla, routes), nil
+}
+
+// valhallaToRoute converts a Valhalla trip, re-encoding its shape from
+// precision 6 to 5, with its legs when withSteps.
+func valhallaToRoute(trip valhallaTrip, withSteps bool) (Route, error) {
+	if len(trip.Legs) == 0 {
+		return Route{}, fmt.Errorf("no legs returned")
+	}
+
+	route := Route{
+		DistanceM: int(math.Round(trip.Summary.Length * 1000)),
+		DurationS: int(math.Round(trip.Summary.Time)),
+	}
+	if withSteps {
+		route.Legs = make([]Leg, 0, len(trip.Legs))
+	}
+
+	// Two locations give a single leg; join them anyway in case of via points.
+	var points []latLng
+	for _, leg := range trip.Legs {
+		legPoints, err := decodePolyline(leg.Shape, polylinePrecision6)
+		if err != nil {
+			return Route{}, fmt.Errorf("decode shape: %w", err)
+		}
+		if withSteps {
+			route.Legs = append(route.Legs, valhallaToLeg(leg, legPoints))
+		}
+		if len(points) > 0 && len(legPoints) > 0 {
+			legPoints = legPoints[1:] // shared with the previous leg
+		}
+		points = append(points, legPoints...)
+	}
+	route.Polyline = encodePolyline(points, polylinePrecision5)
+	return route, nil
+}
+
+// valhallaToLeg converts the maneuvers of a leg; each one covers a slice of
+// the leg shape given by its shape indexes.
+func valhallaToLeg(leg valhallaLeg, points []latLng) Leg {
+	l := Leg{
+		DistanceM: int(math.Round(leg.Summary.Length * 1000)),
+		DurationS: int(math.Round(leg.Summary.Time)),
+		Steps:     make([]Step, 0, len(leg.Maneuvers)),
+	}
+	for _, m := range leg.Maneuvers {
+		begin := min(max(m.BeginShapeIndex, 0), len(points))
+		end := min(max(m.EndShapeIndex+1, begin), len(points))
+		l.Steps = append(l.Steps, Step{
+			Instruction: m.Instruction,
+			DistanceM:   int(math.Round(m.Length * 1000)),
+			DurationS:   int(math.Round(m.Time)),
+			Maneuver:    valhallaManeuvers[m.Type],
+			Polyline:    encodePolyline(points[begin:end], polylinePrecision5),
+		})
+	}
+	return l
+}
+
+// --- JSON types for the Valhalla route action ---
+
+type valhallaRouteRequest struct {
+	Locations []valhallaLocation `json:"locations"`
+	Costing   string             `json:"costing"`
+	Units     string             `json:"units"`
+	Language  string             `json:"language"`
+	Narrative bool               `json:"narrative"`
+	// Alternates is the maximum number of alternate routes.
+	Alternates int `json:"alternates,omitempty"`
+}
+
+type valhallaLocation struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+type valhallaRouteResponse struct {
+	Trip       valhallaTrip        `json:"trip"`
+	Alternates []valhallaAlternate `json:"alternates"`
+}
+
+type valhallaAlternate struct {
+	Trip valhallaTrip `json:"trip"`
+}
+
+type valhallaTrip struct {
+	Legs    []valhallaLeg   `json:"legs"`
+	Summary valhallaSummary `json:"summary"`
+}
+
+type valhallaLeg struct {
+	// Shape is an encoded polyline with precision 6.
+	Shape     string             `json:"shape"`
+	Summary   valhallaSummary    `json:"summary"`
+	Maneuvers []valhallaManeuver `json:"maneuvers"` // only with narrative
+}
+
+type valhallaManeuver struct {
+	Type            int     `json:"type"`
+	Instruction     string  `json:"instruction"`
+	Length          float64 `json:"length"` // kilometres
+	Time            float64 `json:"time"`   // seconds
+	BeginShapeIndex int     `json:"begin_shape_index"`
+	EndShapeIndex   int     `json:"end_shape_index"`
+}
+
+type valhallaSummary struct {
+	Length float64 `json:"length"` // kilometres (units=kilometers)
+	Time   float64 `json:"time"`   // seconds
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+var (
+	// ErrBundleVersionGone is returned by GetBundleDiff when the changes since
+	// the requested version are no longer itemized; the client must download
+	// the full bundle.
+	ErrBundleVersionGone = errors.New("bundle version too old")
+
+	// ErrUnknownBundleVersion is returned by GetBundleDiff for a version the
+	// server has not reached.
+	ErrUnknownBundleVersion = errors.New("unknown bundle version")
+)
+
+// BundleStop is a stop in the offline bundle.
+type BundleStop struct {
+	ID   int32   `json:"id"`
+	Name string  `json:"name"`
+	Lat  float64 `json:"lat"`
+	Lon  float64 `json:"lon"`
+}
+
+// BundleRoute is a route in the offline bundle. The timetable of a route is
+// its scheduled headway: the network runs by frequency, not by trip times.
+type BundleRoute struct {
+	ID       int32   `json:"id"`
+	Name     string  `json:"name"`
+	StopIDs  []int32 `json:"stop_ids"`
+	Shape    string  `json:"shape"`
+	HeadwayS *int    `json:"headway_s"`
+}
+
+// BundleDiff is the set of changes between two network versions. Stops and
+// Routes hold the full current state of every changed item.
+type BundleDiff struct {
+	Since           int64         `json:"since"`
+	Version         int64         `json:"version"`
+	Stops           []BundleStop  `json:"stops"`
+	Routes          []BundleRoute `json:"routes"`
+	RemovedStopIDs  []int32       `json:"removed_stop_ids"`
+	RemovedRouteIDs []int32       `json:"removed_route_ids"`
+}
+
+// bundleDocument is the JSON body of the full bundle.
+type bundleDocument struct {
+	Version int64         `json:"version"`
+	Stops   []BundleStop  `json:"stops"`
+	Routes  []BundleRoute `json:"routes"`
+}
+
+// Bundle is an encoded snapshot of the network for offline use.
+type Bundle struct {
+	Version int64
+	// JSON is the uncompressed document and Gzip the same bytes compressed.
+	JSON []byte
+	Gzip []byte
+	// Hash is the hex SHA-256 of JSON.
+	Hash string
+}
+
+// BundleService builds the offline network bundle. The last bundle is kept
+// in memory and rebuilt only when the network version changes.
+type BundleService struct {
+	repo storage.NetworkRepository
+
+	mu   sync.Mutex
+	last *Bundle
+}
+
+// NewBundleService creates a BundleService backed by repo.
+func NewBundleService(repo storage.NetworkRepository) *BundleService {
+	return &BundleService{repo: repo}
+}
+
+// GetBundle returns the bundle of the current network version.
+func (s *BundleService) GetBundle(ctx context.Context) (*Bundle, error) {
+	version, err := s.repo.GetNetworkVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: GetBundle: %w", err)
+	}
+
+	// Holding the lock while building makes concurrent requests for a new
+	// version wait for a single build instead of each running it.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.last != nil && s.last.Version >= version {
+		return s.last, nil
+	}
+
+	snap, err := s.repo.GetNetworkSnapshot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: GetBundle: %w", err)
+	}
+	b, err := encodeBundle(bundleDocument{
+		Version: snap.Version,
+		Stops:   toBundleStops(snap.Stops),
+		Routes:  toBundleRoutes(snap.Routes),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("service: GetBundle: %w", err)
+	}
+	b.Version = snap.Version
+	s.last = b
+	return b, nil
+}
+
+// GetBundleDiff returns the changes after version since. A since equal to the
+// current version yields an empty diff.
+func (s *BundleService) GetBundleDiff(ctx context.Context, since int64) (*BundleDiff, error) {
+	snap, err := s.repo.GetNetworkChangesSince(ctx, since)
+	if errors.Is(err, storage.ErrChangeLogGap) {
+		return nil, fmt.Errorf("service: GetBundleDiff: %w: %d", ErrBundleVersionGone, since)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("service: GetBundleDiff: %w", err)
+	}
+	if snap.Version < since {
+		return nil, fmt.Errorf("service: GetBundleDiff: %w: %d", ErrUnknownBundleVersion, since)
+	}
+
+	return &BundleDiff{
+		Since:           since,
+		Version:         snap.Version,
+		Stops:           toBundleStops(snap.Stops),
+		Routes:          toBundleRoutes(snap.Routes),
+		RemovedStopIDs:  nonNil(snap.RemovedStopIDs),
+		RemovedRouteIDs: nonNil(snap.RemovedRouteIDs),
+	}, nil
+}
+
+// encodeBundle marshals doc and compresses it.
+func encodeBundle(doc bundleDocument) (*Bundle, error) {
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var gz bytes.Buffer
+	w, _ := gzip.NewWriterLevel(&gz, gzip.BestCompression)
+	if _, err := w.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(raw)
+	return &Bundle{JSON: raw, Gzip: gz.Bytes(), Hash: hex.EncodeToString(sum[:])}, nil
+}
+
+func toBundleStops(stops []storage.Stop) []BundleStop {
+	out := make([]BundleStop, len(stops))
+	for i, s := range stops {
+		out[i] = BundleStop{ID: s.ID, Name: s.Name, Lat: s.Lat, Lon: s.Lon}
+	}
+	return out
+}
+
+func toBundleRoutes(routes []storage.NetworkRoute) []BundleRoute {
+	out := make([]BundleRoute, len(routes))
+	for i, r := range routes {
+		out[i] = BundleRoute{
+			ID:       r.ID,
+			Name:     r.Name,
+			StopIDs:  nonNil(r.StopIDs),
+			Shape:    r.Shape,
+			HeadwayS: r.HeadwayS,
+		}
+	}
+	return out
+}
+
+// nonNil returns ids, or an empty slice when ids is nil, so that it encodes
+// as [] rather than null.
+func nonNil(ids []int32) []int32 {
+	if ids == nil {
+		return []int32{}
+	}
+	return ids
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+// mockNetworkRepo serves a two-stop network and counts snapshot reads.
+type mockNetworkRepo struct {
+	version   int64
+	snapshots int
+	diff      *storage.NetworkSnapshot
+	diffErr   error
+}
+
+func (m *mockNetworkRepo) GetNetworkVersion(_ context.Context) (int64, error) {
+	return m.version, nil
+}
+
+func (m *mockNetworkRepo) GetNetworkSnapshot(_ context.Context) (*storage.NetworkSnapshot, error) {
+	m.snapshots++
+	headway := 600
+	return &storage.NetworkSnapshot{
+		Version: m.version,
+		Stops:   []storage.Stop{{ID: 1, Name: "Plaza Mayor", Lat: -12.0453, Lon: -77.0301}, {ID: 2, Name: "Plaza San Martín", Lat: -12.0519, Lon: -77.0345}},
+		Routes:  []storage.NetworkRoute{{ID: 1, Name: "Ruta 1", HeadwayS: &headway, StopIDs: []int32{1, 2}, Shape: "~ig@tcnuM"}},
+	}, nil
+}
+
+func (m *mockNetworkRepo) GetNetworkChangesSince(_ context.Context, _ int64) (*storage.NetworkSnapshot, error) {
+	return m.diff, m.diffErr
+}
+
+func TestBundleService_GetBundle(t *testing.T) {
+	repo := &mockNetworkRepo{version: 3}
+	s := NewBundleService(repo)
+	ctx := context.Background()
+
+	b, err := s.GetBundle(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b.Version != 3 {
+		t.Errorf("Version = %d, want 3", b.Version)
+	}
+	sum := sha256.Sum256(b.JSON)
+	if b.Hash != hex.EncodeToString(sum[:]) {
+		t.Errorf("Hash does not match the JSON document")
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(b.Gzip))
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	plain, _ := io.ReadAll(zr)
+	if !bytes.Equal(plain, b.JSON) {
+		t.Errorf("Gzip does not decompress to JSON")
+	}
+	if !bytes.Contains(b.JSON, []byte(`"stop_ids":[1,2]`)) || !bytes.Contains(b.JSON, []byte(`"headway_s":600`)) {
+		t.Errorf("JSON = %s", b.JSON)
+	}
+}
+
+func TestBundleService_RebuildsOnNewVersion(t *testing.T) {
+	repo := &mockNetworkRepo{version: 3}
+	s := NewBundleService(repo)
+	ctx := context.Background()
+
+	first, _ := s.GetBundle(ctx)
+	again, _ := s.GetBundle(ctx)
+	if repo.snapshots != 1 || again != first {
+		t.Fatalf("snapshots = %d, want the cached bundle to be reused", repo.snapshots)
+	}
+
+	repo.version = 4
+	next, _ := s.GetBundle(ctx)
+	if repo.snapshots != 2 || next.Version != 4 {
+		t.Errorf("snapshots = %d, version = %d; want a rebuild at version 4", repo.snapshots, next.Version)
+	}
+	if next.Hash == first.Hash {
+		t.Errorf("hash unchanged across versions")
+	}
+}
+
+func TestBundleService_GetBundleDiff(t *testing.T) {
+	repo := &mockNetworkRepo{diff: &storage.NetworkSnapshot{
+		Version:        5,
+		Stops:          []storage.Stop{{ID: 2, Name: "Plaza San Martín"}},
+		RemovedStopIDs: []int32{7},
+	}}
+	s := NewBundleService(repo)
+
+	d, err := s.GetBundleDiff(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Since != 3 || d.Version != 5 || len(d.Stops) != 1 || len(d.RemovedStopIDs) != 1 {
+		t.Errorf("diff = %+v", d)
+	}
+	if d.Routes == nil || d.RemovedRouteIDs == nil {
+		t.Errorf("empty lists must be non-nil: %+v", d)
+	}
+}
+
+func TestBundleService_GetBundleDiffErrors(t *testing.T) {
+	gap := &mockNetworkRepo{diffErr: storage.ErrChangeLogGap}
+	if _, err := NewBundleService(gap).GetBundleDiff(context.Background(), 1); !errors.Is(err, ErrBundleVersionGone) {
+		t.Errorf("gap: err = %v, want ErrBundleVersionGone", err)
+	}
+
+	future := &mockNetworkRepo{diff: &storage.NetworkSnapshot{Version: 5}}
+	if _, err := NewBundleService(future).GetBundleDiff(context.Background(), 9); !errors.Is(err, ErrUnknownBundleVersion) {
+		t.Errorf("future: err = %v, want ErrUnknownBundleVersion", err)
+	}
+}
@@ -4,32 +4,61 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/dom1nux/qapac-api/internal/refresh"
+	"github.com/dom1nux/qapac-api/internal/storage"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
-	// etaCacheTTL is how long a cached ETA entry remains valid.
-	// ETA changes frequently, so we keep the TTL short.
-	etaCacheTTL = 60 * time.Second
+	// etaCacheSoftTTL is how long a cached ETA is served as fresh. ETA
+	// changes frequently, so we keep the TTL short. Past it, and until
+	// etaCacheHardTTL, it is still served while a refresh runs in the
+	// background (see WithETARefreshPool).
+	etaCacheSoftTTL = 60 * time.Second
+
+	// etaCacheHardTTL is how long a cached ETA entry remains valid at all.
+	etaCacheHardTTL = 3 * time.Minute
 
 	// etaCacheQueryTimeout is the deadline for each cache read/write query.
 	etaCacheQueryTimeout = 5 * time.Second
+
+	// etaBatchConcurrency bounds the provider calls GetETAsForStops runs at
+	// once for cache misses, so one batch cannot exhaust the pool or hammer a
+	// GPS provider.
+	etaBatchConcurrency = 8
 )
 
 // ETACacheStore abstracts the persistence layer for ETA caching.
 // Using an interface lets unit tests swap in an in-memory double without a DB.
 type ETACacheStore interface {
-	// GetCachedETA returns the cached ETA seconds for stopID, or (0, false, nil)
+	// GetCachedETA returns the cached ETA for stopID, or (CachedETA{}, false, nil)
 	// when there is no valid (non-expired) entry.
-	GetCachedETA(ctx context.Context, stopID int32) (seconds int, found bool, err error)
+	GetCachedETA(ctx context.Context, stopID int32) (eta CachedETA, found bool, err error)
+
+	// GetCachedETAs returns the valid cached ETA of each stop in stopIDs in
+	// a single read. Stops without a valid entry are absent.
+	GetCachedETAs(ctx context.Context, stopIDs []int32) (map[int32]CachedETA, error)
 
-	// SetCachedETA upserts an ETA entry with an expiry of now + etaCacheTTL.
+	// SetCachedETA upserts an ETA entry computed now, with an expiry of
+	// now + etaCacheHardTTL.
 	SetCachedETA(ctx context.Context, stopID int32, seconds int) error
 }
 
+// CachedETA is an ETA read from the cache.
+type CachedETA struct {
+	Seconds int
+	// CachedAt is when the ETA was computed.
+	CachedAt time.Time
+}
+
 // ETAService wraps one or two ETAProviders with a database-backed cache.
 //
 // Resolution order on a cache miss:
@@ -42,10 +71,47 @@ type ETACacheStore interface {
 //   - MVP v1: primary = SimpleETAProvider, no fallback.
 //   - MVP v2: primary = GPSETAProvider,    fallback = SimpleETAProvider.
 //     Swapping primary is the only change required in app.go.
+//
+// Concurrent misses for the same stop share a single provider call.
+//
+// With a refresh pool, an entry older than etaCacheSoftTTL is still served
+// while the pool recomputes it; without one, it counts as a miss.
 type ETAService struct {
 	primary  ETAProvider
 	fallback ETAProvider // optional; nil means no fallback
 	store    ETACacheStore
+	refresh  *refresh.Pool // refreshes stale entries; nil = treat them as misses
+	now      func() time.Time
+
+	flights     singleflight.Group
+	misses      atomic.Uint64
+	flightCount atomic.Uint64
+}
+
+// CoalesceStats counts the cache misses of an ETAService and how many of
+// them were answered by a provider call already in flight.
+type CoalesceStats struct {
+	// Misses is the number of stops not answered by the cache.
+	Misses uint64 `json:"misses"`
+	// Flights is the number of misses resolved by a provider call of their own.
+	Flights uint64 `json:"flights"`
+	// Deduplicated is Misses - Flights: the misses that shared the call of
+	// an earlier one instead.
+	Deduplicated uint64 `json:"deduplicated"`
+}
+
+// ETAServiceOption configures an ETAService.
+type ETAServiceOption func(*ETAService)
+
+// WithETARefreshPool serves ETAs past their soft TTL and refreshes them on p
+// instead of making the caller wait for the provider.
+func WithETARefreshPool(p *refresh.Pool) ETAServiceOption {
+	return func(s *ETAService) { s.refresh = p }
+}
+
+// withETAClock injects a fake clock for unit testing.
+func withETAClock(fn func() time.Time) ETAServiceOption {
+	return func(s *ETAService) { s.now = fn }
 }
 
 // NewETAService creates an ETAService with a single provider and no fallback.
@@ -53,26 +119,35 @@ type ETAService struct {
 //
 //   - primary is the strategy used to compute ETA on a cache miss.
 //   - store   is the cache backend (use NewPgETACacheStore for production).
-func NewETAService(primary ETAProvider, store ETACacheStore) *ETAService {
-	return &ETAService{primary: primary, store: store}
+func NewETAService(primary ETAProvider, store ETACacheStore, opts ...ETAServiceOption) *ETAService {
+	return NewETAServiceWithFallback(primary, nil, store, opts...)
 }
 
 // NewETAServiceWithFallback creates an ETAService where fallback is called
 // whenever primary returns ErrNoVehicleData.  Use this for MVP v2:
 //
 //	NewETAServiceWithFallback(gpsProvider, simpleProvider, pgStore)
-func NewETAServiceWithFallback(primary, fallback ETAProvider, store ETACacheStore) *ETAService {
-	return &ETAService{primary: primary, fallback: fallback, store: store}
+func NewETAServiceWithFallback(primary, fallback ETAProvider, store ETACacheStore, opts ...ETAServiceOption) *ETAService {
+	s := &ETAService{primary: primary, fallback: fallback, store: store, now: time.Now}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
 }
 
 // GetETAForStop returns the estimated bus arrival time (in seconds) for the
-// given stop.
+// given stop. age is how long ago a cached ETA was computed, as in
+// StopETA.Age; zero when it was computed for this call.
 //
 // Resolution order:
-//  1. Cache hit  → returns immediately with source="cache".
+//  1. Cache hit  → returns immediately with source="cache". A stale entry
+//     is returned too when a refresh pool is set (see usable).
 //  2. Primary provider → used on cache miss.
 //  3. Fallback provider → used only when primary returns ErrNoVehicleData.
 //
+// Concurrent misses for the same stop wait for one provider call and share
+// its result.
+//
 // The source string in the return value identifies where the value came from
 // ("cache", "simple", "gps", "simple_fallback", …) for telemetry purposes.
 //
@@ -81,18 +156,149 @@ func NewETAServiceWithFallback(primary, fallback ETAProvider, store ETACacheStor
 //   - Primary fails with a non-ErrNoVehicleData error → error is returned.
 //   - Primary returns ErrNoVehicleData but no fallback is set → error is returned.
 //   - Cache read/write failures are non-fatal; the computed value is still returned.
-func (s *ETAService) GetETAForStop(ctx context.Context, stopID int32) (seconds int, source string, err error) {
+func (s *ETAService) GetETAForStop(ctx context.Context, stopID int32) (seconds int, source string, age time.Duration, err error) {
 	if stopID <= 0 {
-		return 0, "", fmt.Errorf("eta: GetETAForStop: invalid stop ID %d", stopID)
+		return 0, "", 0, fmt.Errorf("eta: GetETAForStop: invalid stop ID %d", stopID)
 	}
 
 	// --- cache read ---
 	cached, found, _ := s.store.GetCachedETA(ctx, stopID)
-	if found {
-		return cached, "cache", nil
+	if found && s.usable(stopID, cached) {
+		return cached.Seconds, "cache", s.now().Sub(cached.CachedAt), nil
 	}
 	// Cache failures are non-fatal; fall through to the provider.
 
+	secs, src, err := s.computeShared(ctx, stopID)
+	if err != nil {
+		return 0, "", 0, fmt.Errorf("eta: GetETAForStop: %w", err)
+	}
+	return secs, src, 0, nil
+}
+
+// StopETA is the outcome of one stop in GetETAsForStops. Err is non-nil when
+// the ETA of that stop could not be computed; Seconds and Source are then
+// zero values.
+type StopETA struct {
+	StopID  int32
+	Seconds int
+	Source  string
+	// Age is how long ago a cached ETA was computed; zero when it was
+	// computed for this call.
+	Age time.Duration
+	Err error
+}
+
+// GetETAsForStops resolves the ETA of many stops at once. The result has one
+// entry per element of stopIDs, in the same order.
+//
+// All stops are looked up in the cache with a single read; the misses go to
+// the providers exactly as in GetETAForStop, at most etaBatchConcurrency at a
+// time. A failure affects only its own entry: invalid IDs and provider errors
+// are reported in StopETA.Err, and a failed cache read is treated as a miss
+// for every stop.
+func (s *ETAService) GetETAsForStops(ctx context.Context, stopIDs []int32) []StopETA {
+	out := make([]StopETA, len(stopIDs))
+	valid := make([]int32, 0, len(stopIDs))
+	for i, id := range stopIDs {
+		out[i].StopID = id
+		if id <= 0 {
+			out[i].Err = fmt.Errorf("eta: GetETAsForStops: invalid stop ID %d", id)
+			continue
+		}
+		valid = append(valid, id)
+	}
+
+	// --- cache read (best-effort) ---
+	cached, _ := s.store.GetCachedETAs(ctx, valid)
+
+	// --- providers for the misses ---
+	sem := make(chan struct{}, etaBatchConcurrency)
+	var wg sync.WaitGroup
+	for i := range out {
+		r := &out[i]
+		if r.Err != nil {
+			continue
+		}
+		if e, ok := cached[r.StopID]; ok && s.usable(r.StopID, e) {
+			r.Seconds, r.Source, r.Age = e.Seconds, "cache", s.now().Sub(e.CachedAt)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			secs, src, err := s.computeShared(ctx, r.StopID)
+			if err != nil {
+				r.Err = fmt.Errorf("eta: GetETAsForStops: stop %d: %w", r.StopID, err)
+				return
+			}
+			r.Seconds, r.Source = secs, src
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+// CoalesceStats returns the miss and deduplication counters since start.
+func (s *ETAService) CoalesceStats() CoalesceStats {
+	// Read flights first: it never exceeds misses read afterwards.
+	flights := s.flightCount.Load()
+	misses := s.misses.Load()
+	return CoalesceStats{Misses: misses, Flights: flights, Deduplicated: misses - flights}
+}
+
+// usable reports whether a cached entry can be served. An entry past
+// etaCacheSoftTTL is only served with a refresh pool, which is then asked to
+// recompute it.
+func (s *ETAService) usable(stopID int32, cached CachedETA) bool {
+	if s.now().Sub(cached.CachedAt) < etaCacheSoftTTL {
+		return true
+	}
+	if s.refresh == nil {
+		return false
+	}
+	s.refresh.Submit("eta|"+strconv.Itoa(int(stopID)), func(ctx context.Context) {
+		// Failures leave the stale entry until its hard TTL; the next
+		// request submits again.
+		_, _, _ = s.compute(ctx, stopID)
+	})
+	return true
+}
+
+// etaResult is the value shared by the callers of one computeShared flight.
+type etaResult struct {
+	seconds int
+	source  string
+}
+
+// computeShared is compute, sharing the call with concurrent misses for the
+// same stop.
+func (s *ETAService) computeShared(ctx context.Context, stopID int32) (seconds int, source string, err error) {
+	s.misses.Add(1)
+	ch := s.flights.DoChan(strconv.Itoa(int(stopID)), func() (any, error) {
+		s.flightCount.Add(1)
+		// The call outlives a caller that goes away: others may be waiting.
+		secs, src, err := s.compute(context.WithoutCancel(ctx), stopID)
+		return etaResult{secs, src}, err
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return 0, "", res.Err
+		}
+		r := res.Val.(etaResult)
+		return r.seconds, r.source, nil
+	case <-ctx.Done():
+		return 0, "", ctx.Err()
+	}
+}
+
+// compute resolves the ETA of stopID through the providers, bypassing the
+// cache read, and stores the result in the cache.
+func (s *ETAService) compute(ctx context.Context, stopID int32) (seconds int, source string, err error) {
 	// --- primary provider ---
 	secs, src, provErr := s.primary.GetETA(ctx, stopID)
 	if provErr != nil {
@@ -100,12 +306,12 @@ func (s *ETAService) GetETAForStop(ctx context.Context, stopID int32) (seconds i
 		if errors.Is(provErr, ErrNoVehicleData) && s.fallback != nil {
 			secs, src, provErr = s.fallback.GetETA(ctx, stopID)
 			if provErr != nil {
-				return 0, "", fmt.Errorf("eta: GetETAForStop: fallback provider: %w", provErr)
+				return 0, "", fmt.Errorf("fallback provider: %w", provErr)
 			}
 			// Annotate source so callers/telemetry know GPS was attempted.
 			src = src + "_fallback"
 		} else {
-			return 0, "", fmt.Errorf("eta: GetETAForStop: primary provider: %w", provErr)
+			return 0, "", fmt.Errorf("primary provider: %w", provErr)
 		}
 	}
 
@@ -128,46 +334,90 @@ func NewPgETACacheStore(pool *pgxpool.Pool) ETACacheStore {
 }
 
 // GetCachedETA queries stop_eta_cache for a valid (non-expired) entry.
-func (s *pgETACacheStore) GetCachedETA(ctx context.Context, stopID int32) (seconds int, found bool, err error) {
+func (s *pgETACacheStore) GetCachedETA(ctx context.Context, stopID int32) (eta CachedETA, found bool, err error) {
 	ctx, cancel := context.WithTimeout(ctx, etaCacheQueryTimeout)
 	defer cancel()
 
 	const q = `
-		SELECT eta_seconds
+		SELECT eta_seconds, calc_ts
 		FROM stop_eta_cache
 		WHERE stop_id   = $1
 		  AND expires_at > NOW()`
 
-	var etaSecs int32
-	err = s.pool.QueryRow(ctx, q, stopID).Scan(&etaSecs)
+	var (
+		etaSecs int32
+		calcTS  pgtype.Timestamp
+	)
+	err = s.pool.QueryRow(ctx, q, stopID).Scan(&etaSecs, &calcTS)
 	if errors.Is(err, pgx.ErrNoRows) {
-		return 0, false, nil // cache miss
+		return CachedETA{}, false, nil // cache miss
+	}
+	if err != nil {
+		return CachedETA{}, false, fmt.Errorf("eta: cache: get: %w", err)
+	}
+
+	return CachedETA{Seconds: int(etaSecs), CachedAt: storage.LocalTime(calcTS)}, true, nil
+}
+
+// GetCachedETAs reads the valid entries of all stopIDs with one query.
+func (s *pgETACacheStore) GetCachedETAs(ctx context.Context, stopIDs []int32) (map[int32]CachedETA, error) {
+	if len(stopIDs) == 0 {
+		return map[int32]CachedETA{}, nil
 	}
+
+	ctx, cancel := context.WithTimeout(ctx, etaCacheQueryTimeout)
+	defer cancel()
+
+	const q = `
+		SELECT stop_id, eta_seconds, calc_ts
+		FROM stop_eta_cache
+		WHERE stop_id = ANY($1::int[])
+		  AND expires_at > NOW()`
+
+	rows, err := s.pool.Query(ctx, q, stopIDs)
 	if err != nil {
-		return 0, false, fmt.Errorf("eta: cache: get: %w", err)
+		return nil, fmt.Errorf("eta: cache: get many: %w", err)
 	}
+	defer rows.Close()
 
-	return int(etaSecs), true, nil
+	out := make(map[int32]CachedETA, len(stopIDs))
+	for rows.Next() {
+		var (
+			stopID, etaSecs int32
+			calcTS          pgtype.Timestamp
+		)
+		if err := rows.Scan(&stopID, &etaSecs, &calcTS); err != nil {
+			return nil, fmt.Errorf("eta: cache: get many: %w", err)
+		}
+		out[stopID] = CachedETA{Seconds: int(etaSecs), CachedAt: storage.LocalTime(calcTS)}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("eta: cache: get many: %w", err)
+	}
+	return out, nil
 }
 
 // SetCachedETA upserts an ETA entry into stop_eta_cache.
-// The expiry time is computed in Go so that etaCacheTTL is the single source of truth.
+// Both timestamps are computed in Go so that etaCacheHardTTL is the single
+// source of truth and the age of an entry is measured with the clock of the
+// service, not the database.
 func (s *pgETACacheStore) SetCachedETA(ctx context.Context, stopID int32, seconds int) error {
 	ctx, cancel := context.WithTimeout(ctx, etaCacheQueryTimeout)
 	defer cancel()
 
-	expiresAt := time.Now().Add(etaCacheTTL)
+	calcTS := time.Now()
+	expiresAt := calcTS.Add(etaCacheHardTTL)
 
 	const q = `
 		INSERT INTO stop_eta_cache (stop_id, eta_seconds, calc_ts, expires_at)
-		VALUES ($1, $2, NOW(), $3)
+		VALUES ($1, $2, $3, $4)
 		ON CONFLICT (stop_id)
 		DO UPDATE SET
 			eta_seconds = EXCLUDED.eta_seconds,
 			calc_ts     = EXCLUDED.calc_ts,
 			expires_at  = EXCLUDED.expires_at`
 
-	_, err := s.pool.Exec(ctx, q, stopID, int32(seconds), expiresAt)
+	_, err := s.pool.Exec(ctx, q, stopID, int32(seconds), calcTS, expiresAt)
 	if err != nil {
 		return fmt.Errorf("eta: cache: set: %w", err)
 	}
@@ -3,8 +3,12 @@ package service
 import (
 	"context"
 	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/dom1nux/qapac-api/internal/refresh"
 )
 
 // ---------------------------------------------------------------------------
@@ -31,10 +35,12 @@ type memETACacheStore struct {
 	getErr   error
 	setCalls int
 	getCalls int
+	mu       sync.Mutex // GetETAsForStops writes concurrently
 }
 
 type memCacheEntry struct {
 	seconds   int
+	cachedAt  time.Time
 	expiresAt time.Time
 }
 
@@ -42,26 +48,47 @@ func newMemStore() *memETACacheStore {
 	return &memETACacheStore{entries: make(map[int32]memCacheEntry)}
 }
 
-func (m *memETACacheStore) GetCachedETA(_ context.Context, stopID int32) (int, bool, error) {
+func (m *memETACacheStore) GetCachedETA(_ context.Context, stopID int32) (CachedETA, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.getCalls++
 	if m.getErr != nil {
-		return 0, false, m.getErr
+		return CachedETA{}, false, m.getErr
 	}
 	e, ok := m.entries[stopID]
 	if !ok || time.Now().After(e.expiresAt) {
-		return 0, false, nil
+		return CachedETA{}, false, nil
+	}
+	return CachedETA{Seconds: e.seconds, CachedAt: e.cachedAt}, true, nil
+}
+
+func (m *memETACacheStore) GetCachedETAs(_ context.Context, stopIDs []int32) (map[int32]CachedETA, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.getCalls++
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	out := make(map[int32]CachedETA)
+	for _, id := range stopIDs {
+		if e, ok := m.entries[id]; ok && time.Now().Before(e.expiresAt) {
+			out[id] = CachedETA{Seconds: e.seconds, CachedAt: e.cachedAt}
+		}
 	}
-	return e.seconds, true, nil
+	return out, nil
 }
 
 func (m *memETACacheStore) SetCachedETA(_ context.Context, stopID int32, seconds int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.setCalls++
 	if m.setErr != nil {
 		return m.setErr
 	}
 	m.entries[stopID] = memCacheEntry{
 		seconds:   seconds,
-		expiresAt: time.Now().Add(etaCacheTTL),
+		cachedAt:  time.Now(),
+		expiresAt: time.Now().Add(etaCacheHardTTL),
 	}
 	return nil
 }
@@ -85,7 +112,7 @@ func TestETAService_CacheHit(t *testing.T) {
 
 	_ = store.SetCachedETA(context.Background(), 1, 120)
 
-	secs, source, err := svc.GetETAForStop(context.Background(), 1)
+	secs, source, _, err := svc.GetETAForStop(context.Background(), 1)
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -105,7 +132,7 @@ func TestETAService_CacheMiss_CallsPrimary(t *testing.T) {
 	primary := &mockETAProvider{seconds: 240, source: "simple"}
 	svc := NewETAService(primary, newMemStore())
 
-	secs, source, err := svc.GetETAForStop(context.Background(), 2)
+	secs, source, _, err := svc.GetETAForStop(context.Background(), 2)
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -126,13 +153,13 @@ func TestETAService_CacheMiss_WritesCache(t *testing.T) {
 	primary := &mockETAProvider{seconds: 300, source: "simple"}
 	svc := NewETAService(primary, store)
 
-	_, _, _ = svc.GetETAForStop(context.Background(), 3)
+	_, _, _, _ = svc.GetETAForStop(context.Background(), 3)
 
 	if store.setCalls != 1 {
 		t.Errorf("SetCachedETA called %d times, want 1", store.setCalls)
 	}
 	// Second call must be a cache hit — primary not called again.
-	_, src, _ := svc.GetETAForStop(context.Background(), 3)
+	_, src, _, _ := svc.GetETAForStop(context.Background(), 3)
 	if src != "cache" {
 		t.Errorf("second call source = %q, want %q", src, "cache")
 	}
@@ -148,7 +175,7 @@ func TestETAService_ExpiredCache_CallsPrimary(t *testing.T) {
 	primary := &mockETAProvider{seconds: 180, source: "simple"}
 	svc := NewETAService(primary, store)
 
-	secs, src, err := svc.GetETAForStop(context.Background(), 4)
+	secs, src, _, err := svc.GetETAForStop(context.Background(), 4)
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -161,11 +188,103 @@ func TestETAService_ExpiredCache_CallsPrimary(t *testing.T) {
 	}
 }
 
+// blockingETAProvider holds every call until release is closed.
+type blockingETAProvider struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (p *blockingETAProvider) GetETA(ctx context.Context, _ int32) (int, string, error) {
+	p.calls.Add(1)
+	select {
+	case <-p.release:
+		return 200, "simple", nil
+	case <-ctx.Done():
+		return 0, "", ctx.Err()
+	}
+}
+
+// waitForMisses blocks until svc has counted n cache misses, then gives the
+// last callers a moment to join the flight.
+func waitForMisses(t *testing.T, svc *ETAService, n uint64) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for svc.CoalesceStats().Misses < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("misses = %d, want %d", svc.CoalesceStats().Misses, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+}
+
+func TestETAService_ConcurrentMisses_ShareOneCall(t *testing.T) {
+	const callers = 10
+	primary := &blockingETAProvider{release: make(chan struct{})}
+	svc := NewETAService(primary, newMemStore())
+
+	var wg sync.WaitGroup
+	secs := make([]int, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			secs[i], _, _, _ = svc.GetETAForStop(context.Background(), 8)
+		}()
+	}
+	waitForMisses(t, svc, callers)
+	close(primary.release)
+	wg.Wait()
+
+	if got := primary.calls.Load(); got != 1 {
+		t.Errorf("provider calls = %d, want 1", got)
+	}
+	for i, s := range secs {
+		if s != 200 {
+			t.Errorf("caller %d: seconds = %d, want 200", i, s)
+		}
+	}
+	want := CoalesceStats{Misses: callers, Flights: 1, Deduplicated: callers - 1}
+	if got := svc.CoalesceStats(); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestETAService_CancelledWaiter_DoesNotCancelFlight(t *testing.T) {
+	primary := &blockingETAProvider{release: make(chan struct{})}
+	svc := NewETAService(primary, newMemStore())
+
+	// The first caller starts the flight and goes away.
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, _, _, err := svc.GetETAForStop(ctx, 9)
+		errc <- err
+	}()
+	waitForMisses(t, svc, 1)
+
+	done := make(chan int, 1)
+	go func() {
+		secs, _, _, _ := svc.GetETAForStop(context.Background(), 9)
+		done <- secs
+	}()
+	waitForMisses(t, svc, 2)
+
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller: err = %v, want context.Canceled", err)
+	}
+	close(primary.release)
+	if secs := <-done; secs != 200 {
+		t.Errorf("waiting caller: seconds = %d, want 200", secs)
+	}
+}
+
 func TestETAService_InvalidStopID(t *testing.T) {
 	svc := NewETAService(&mockETAProvider{}, newMemStore())
 
 	for _, id := range []int32{0, -1, -100} {
-		_, _, err := svc.GetETAForStop(context.Background(), id)
+		_, _, _, err := svc.GetETAForStop(context.Background(), id)
 		if err == nil {
 			t.Errorf("stopID=%d: expected error, got nil", id)
 		}
@@ -176,7 +295,7 @@ func TestETAService_PrimaryError_NoFallback(t *testing.T) {
 	primary := &mockETAProvider{err: errors.New("db down")}
 	svc := NewETAService(primary, newMemStore())
 
-	_, _, err := svc.GetETAForStop(context.Background(), 5)
+	_, _, _, err := svc.GetETAForStop(context.Background(), 5)
 	if err == nil {
 		t.Fatal("expected error when primary fails, got nil")
 	}
@@ -188,7 +307,7 @@ func TestETAService_CacheGetError_FallsBackToPrimary(t *testing.T) {
 	primary := &mockETAProvider{seconds: 240, source: "simple"}
 	svc := NewETAService(primary, store)
 
-	secs, src, err := svc.GetETAForStop(context.Background(), 6)
+	secs, src, _, err := svc.GetETAForStop(context.Background(), 6)
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -210,7 +329,7 @@ func TestETAService_CacheSetError_StillReturnsValue(t *testing.T) {
 	primary := &mockETAProvider{seconds: 360, source: "simple"}
 	svc := NewETAService(primary, store)
 
-	secs, src, err := svc.GetETAForStop(context.Background(), 7)
+	secs, src, _, err := svc.GetETAForStop(context.Background(), 7)
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -232,7 +351,7 @@ func TestETAService_Fallback_UsedWhenPrimaryReturnsNoVehicleData(t *testing.T) {
 	fallback := &mockETAProvider{seconds: 200, source: "simple"}
 	svc := NewETAServiceWithFallback(primary, fallback, newMemStore())
 
-	secs, src, err := svc.GetETAForStop(context.Background(), 10)
+	secs, src, _, err := svc.GetETAForStop(context.Background(), 10)
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -257,7 +376,7 @@ func TestETAService_Fallback_NotCalledOnPrimarySuccess(t *testing.T) {
 	fallback := &mockETAProvider{seconds: 999, source: "simple"}
 	svc := NewETAServiceWithFallback(primary, fallback, newMemStore())
 
-	secs, src, err := svc.GetETAForStop(context.Background(), 11)
+	secs, src, _, err := svc.GetETAForStop(context.Background(), 11)
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -278,7 +397,7 @@ func TestETAService_Fallback_ErrorPropagatesWhenFallbackAlsoFails(t *testing.T)
 	fallback := &mockETAProvider{err: errors.New("fallback also down")}
 	svc := NewETAServiceWithFallback(primary, fallback, newMemStore())
 
-	_, _, err := svc.GetETAForStop(context.Background(), 12)
+	_, _, _, err := svc.GetETAForStop(context.Background(), 12)
 	if err == nil {
 		t.Fatal("expected error when both primary and fallback fail, got nil")
 	}
@@ -289,7 +408,7 @@ func TestETAService_Fallback_NoVehicleDataWithoutFallbackIsError(t *testing.T) {
 	primary := &mockETAProvider{err: ErrNoVehicleData}
 	svc := NewETAService(primary, newMemStore())
 
-	_, _, err := svc.GetETAForStop(context.Background(), 13)
+	_, _, _, err := svc.GetETAForStop(context.Background(), 13)
 	if err == nil {
 		t.Fatal("expected error when primary returns ErrNoVehicleData and no fallback is set")
 	}
@@ -301,19 +420,211 @@ func TestETAService_Fallback_ResultCached(t *testing.T) {
 	fallback := &mockETAProvider{seconds: 180, source: "simple"}
 	svc := NewETAServiceWithFallback(primary, fallback, store)
 
-	_, _, _ = svc.GetETAForStop(context.Background(), 14)
+	_, _, _, _ = svc.GetETAForStop(context.Background(), 14)
 
 	// Cache must have been written with the fallback value.
 	if store.setCalls != 1 {
 		t.Errorf("SetCachedETA calls = %d, want 1", store.setCalls)
 	}
 	// Second call must be served from cache.
-	_, src, _ := svc.GetETAForStop(context.Background(), 14)
+	_, src, _, _ := svc.GetETAForStop(context.Background(), 14)
 	if src != "cache" {
 		t.Errorf("second call source = %q, want %q", src, "cache")
 	}
 }
 
+// ---------------------------------------------------------------------------
+// ETAService — batch resolution
+// ---------------------------------------------------------------------------
+
+// perStopETAProvider returns stopID*10 seconds, fails for the stops in fail
+// and records the peak number of concurrent calls.
+type perStopETAProvider struct {
+	fail map[int32]bool
+
+	mu            sync.Mutex
+	calls         int
+	inFlight, max int
+	release       chan struct{} // when set, calls block until it is closed
+}
+
+func (p *perStopETAProvider) GetETA(_ context.Context, stopID int32) (int, string, error) {
+	p.mu.Lock()
+	p.calls++
+	p.inFlight++
+	p.max = max(p.max, p.inFlight)
+	p.mu.Unlock()
+
+	if p.release != nil {
+		<-p.release
+	}
+
+	p.mu.Lock()
+	p.inFlight--
+	p.mu.Unlock()
+
+	if p.fail[stopID] {
+		return 0, "", errors.New("provider down")
+	}
+	return int(stopID) * 10, "simple", nil
+}
+
+func TestETAService_GetETAsForStops_PartialResults(t *testing.T) {
+	store := newMemStore()
+	store.entries[2] = memCacheEntry{seconds: 999, cachedAt: time.Now(), expiresAt: time.Now().Add(time.Minute)}
+	provider := &perStopETAProvider{fail: map[int32]bool{3: true}}
+	svc := NewETAService(provider, store)
+
+	got := svc.GetETAsForStops(context.Background(), []int32{1, 2, 3, 0})
+
+	if len(got) != 4 {
+		t.Fatalf("got %d results, want 4", len(got))
+	}
+	if got[0].StopID != 1 || got[0].Seconds != 10 || got[0].Source != "simple" || got[0].Err != nil {
+		t.Errorf("stop 1 = %+v, want 10s from provider", got[0])
+	}
+	if got[1].Seconds != 999 || got[1].Source != "cache" {
+		t.Errorf("stop 2 = %+v, want 999s from cache", got[1])
+	}
+	if got[2].Err == nil {
+		t.Errorf("stop 3 = %+v, want provider error", got[2])
+	}
+	if got[3].Err == nil {
+		t.Errorf("stop 0 = %+v, want invalid ID error", got[3])
+	}
+	if store.getCalls != 1 {
+		t.Errorf("cache reads = %d, want a single batch read", store.getCalls)
+	}
+	if provider.calls != 2 {
+		t.Errorf("provider calls = %d, want 2 (misses only)", provider.calls)
+	}
+	if _, ok := store.entries[1]; !ok {
+		t.Error("computed ETA of stop 1 was not cached")
+	}
+}
+
+func TestETAService_GetETAsForStops_CacheErrorTreatedAsMiss(t *testing.T) {
+	store := newMemStore()
+	store.getErr = errors.New("db down")
+	svc := NewETAService(&perStopETAProvider{}, store)
+
+	got := svc.GetETAsForStops(context.Background(), []int32{4, 5})
+	for _, r := range got {
+		if r.Err != nil || r.Seconds != int(r.StopID)*10 {
+			t.Errorf("stop %d = %+v, want provider result", r.StopID, r)
+		}
+	}
+}
+
+func TestETAService_GetETAsForStops_BoundedConcurrency(t *testing.T) {
+	provider := &perStopETAProvider{release: make(chan struct{})}
+	svc := NewETAService(provider, newMemStore())
+
+	ids := make([]int32, 3*etaBatchConcurrency)
+	for i := range ids {
+		ids[i] = int32(i + 1)
+	}
+
+	done := make(chan []StopETA)
+	go func() { done <- svc.GetETAsForStops(context.Background(), ids) }()
+
+	// Wait until the first wave is blocked in the provider, then let it drain.
+	for {
+		provider.mu.Lock()
+		n := provider.inFlight
+		provider.mu.Unlock()
+		if n == etaBatchConcurrency {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(provider.release)
+	got := <-done
+
+	if provider.max != etaBatchConcurrency {
+		t.Errorf("peak concurrent provider calls = %d, want %d", provider.max, etaBatchConcurrency)
+	}
+	for _, r := range got {
+		if r.Err != nil {
+			t.Errorf("stop %d: unexpected error %v", r.StopID, r.Err)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// ETAService — stale-while-revalidate
+// ---------------------------------------------------------------------------
+
+// waitForRefreshes waits until p has run n refreshes.
+func waitForRefreshes(t *testing.T, p *refresh.Pool, n uint64) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for p.Stats().Completed < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("refreshes = %d, want %d", p.Stats().Completed, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestETAService_StaleWithoutPool_IsMiss(t *testing.T) {
+	store := newMemStore()
+	_ = store.SetCachedETA(context.Background(), 1, 120)
+	primary := &mockETAProvider{seconds: 90, source: "simple"}
+	later := time.Now().Add(etaCacheSoftTTL)
+	svc := NewETAService(primary, store, withETAClock(func() time.Time { return later }))
+
+	secs, src, age, err := svc.GetETAForStop(context.Background(), 1)
+	if err != nil || secs != 90 || src != "simple" || age != 0 || primary.calls != 1 {
+		t.Errorf("got %d, %q, age %s, %v after %d calls; want the provider's 90", secs, src, age, err, primary.calls)
+	}
+}
+
+func TestETAService_Stale_ServedAndRefreshed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool := refresh.NewPool(ctx, 1)
+
+	store := newMemStore()
+	_ = store.SetCachedETA(context.Background(), 1, 120)
+	primary := &mockETAProvider{seconds: 90, source: "simple"}
+	later := time.Now().Add(etaCacheSoftTTL + 10*time.Second)
+	svc := NewETAService(primary, store, WithETARefreshPool(pool), withETAClock(func() time.Time { return later }))
+
+	got := svc.GetETAsForStops(context.Background(), []int32{1})[0]
+	if got.Err != nil || got.Seconds != 120 || got.Source != "cache" {
+		t.Fatalf("got %+v, want the stale cached 120", got)
+	}
+	if got.Age < etaCacheSoftTTL {
+		t.Errorf("age = %s, want at least %s", got.Age, etaCacheSoftTTL)
+	}
+
+	waitForRefreshes(t, pool, 1)
+	if primary.calls != 1 {
+		t.Errorf("provider calls = %d, want 1 (the refresh)", primary.calls)
+	}
+	if e, _, _ := store.GetCachedETA(context.Background(), 1); e.Seconds != 90 {
+		t.Errorf("cached = %d, want the refreshed 90", e.Seconds)
+	}
+}
+
+func TestETAService_Fresh_NoRefresh(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool := refresh.NewPool(ctx, 1)
+
+	store := newMemStore()
+	_ = store.SetCachedETA(context.Background(), 1, 120)
+	svc := NewETAService(&mockETAProvider{seconds: 90}, store, WithETARefreshPool(pool))
+
+	if secs, src, age, _ := svc.GetETAForStop(context.Background(), 1); secs != 120 || src != "cache" || age < 0 || age > time.Minute {
+		t.Errorf("got %d, %q, age %s; want the cached 120 from just now", secs, src, age)
+	}
+	if n := pool.Stats().Submitted; n != 0 {
+		t.Errorf("refreshes = %d, want 0 for a fresh entry", n)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // SimpleETAProvider — ETA of bus arriving at stop
 // ---------------------------------------------------------------------------
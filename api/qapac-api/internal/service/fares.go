@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+var (
+	// ErrInvalidFareLeg is returned by Quote when a leg's stops are not served
+	// by its route, or the alighting stop comes before the boarding stop.
+	ErrInvalidFareLeg = errors.New("invalid fare leg")
+	// ErrUnknownRiderCategory is returned by Quote for an unknown category.
+	ErrUnknownRiderCategory = errors.New("unknown rider category")
+	// ErrNoFare is returned by Quote when no fare rule prices a leg.
+	ErrNoFare = errors.New("no fare applies")
+)
+
+// GTFS-Fares v2 fare_transfer_type values.
+const (
+	// TransferFromPlusTransfer charges A + AB: the transfer product replaces
+	// the fare of the second leg.
+	TransferFromPlusTransfer = 0
+	// TransferFromPlusTransferPlusTo charges A + AB + B: the transfer product
+	// is a surcharge on top of both legs.
+	TransferFromPlusTransferPlusTo = 1
+	// TransferOnly charges AB: the transfer product replaces both legs.
+	TransferOnly = 2
+)
+
+// FareLegRequest is one leg of an itinerary to price.
+type FareLegRequest struct {
+	RouteID    int32
+	FromStopID int32
+	ToStopID   int32
+}
+
+// FareLegQuote is the price of a single leg before transfers.
+type FareLegQuote struct {
+	FareLegRequest
+	DistanceM       int
+	LegGroupID      string
+	FareProductID   string
+	FareProductName string
+	AmountCents     int
+}
+
+// FareTransferQuote records a transfer rule applied between legs FromLeg and
+// FromLeg+1. AdjustmentCents is what it adds to (or, when negative, removes
+// from) the sum of the leg fares.
+type FareTransferQuote struct {
+	FromLeg         int
+	TransferType    int
+	FareProductID   string
+	AdjustmentCents int
+}
+
+// FareQuote is the total price of an itinerary for a rider category.
+type FareQuote struct {
+	RiderCategoryID string
+	Currency        string
+	TotalCents      int
+	Legs            []FareLegQuote
+	Transfers       []FareTransferQuote
+}
+
+// FareService prices rides using the GTFS-Fares v2 style tables.
+type FareService struct {
+	repo storage.FaresRepository
+}
+
+// NewFareService creates a FareService reading fares from repo.
+func NewFareService(repo storage.FaresRepository) *FareService {
+	return &FareService{repo: repo}
+}
+
+// Quote prices an itinerary of one or more legs for riderCategoryID; an empty
+// category means the default one.
+//
+// Each leg is priced by the matching fare leg rule with the highest priority;
+// among rules of equal priority the most specific one wins. When a product has
+// no price for the rider's category, the default category's price applies.
+// Transfer rules are then applied between consecutive legs. Quotes are for
+// planning: transfers are assumed to happen within any time limit.
+//
+// Errors:
+//   - ErrUnknownRiderCategory (wrapped) for an unknown category.
+//   - ErrInvalidFareLeg (wrapped) when a leg is not a valid ride.
+//   - ErrNoFare (wrapped) when no rule or product prices a leg.
+func (s *FareService) Quote(ctx context.Context, riderCategoryID string, legs []FareLegRequest) (*FareQuote, error) {
+	if len(legs) == 0 {
+		return nil, fmt.Errorf("service: Quote: %w: empty itinerary", ErrInvalidFareLeg)
+	}
+
+	tables, err := s.repo.GetFareTables(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: Quote: %w", err)
+	}
+
+	defaultCategory := ""
+	for _, c := range tables.RiderCategories {
+		if c.IsDefault {
+			defaultCategory = c.ID
+		}
+	}
+	if riderCategoryID == "" {
+		riderCategoryID = defaultCategory
+	}
+	if !slices.ContainsFunc(tables.RiderCategories, func(c storage.RiderCategory) bool { return c.ID == riderCategoryID }) {
+		return nil, fmt.Errorf("service: Quote: %w: %q", ErrUnknownRiderCategory, riderCategoryID)
+	}
+	prices := fareCatalog{tables: tables, category: riderCategoryID, fallback: defaultCategory}
+
+	quote := &FareQuote{RiderCategoryID: riderCategoryID, Legs: make([]FareLegQuote, 0, len(legs))}
+	for i, req := range legs {
+		leg, err := s.repo.GetRideLeg(ctx, req.RouteID, req.FromStopID, req.ToStopID)
+		if err != nil {
+			return nil, fmt.Errorf("service: Quote: leg %d: %w", i, err)
+		}
+		if leg == nil || leg.ToSequence <= leg.FromSequence {
+			return nil, fmt.Errorf("service: Quote: leg %d: %w: route %d does not run from stop %d to stop %d",
+				i, ErrInvalidFareLeg, req.RouteID, req.FromStopID, req.ToStopID)
+		}
+
+		rule := matchLegRule(tables.LegRules, leg)
+		if rule == nil {
+			return nil, fmt.Errorf("service: Quote: leg %d: %w", i, ErrNoFare)
+		}
+		product := prices.lookup(rule.FareProductID)
+		if product == nil {
+			return nil, fmt.Errorf("service: Quote: leg %d: %w: product %q has no price", i, ErrNoFare, rule.FareProductID)
+		}
+		if err := quote.setCurrency(product.Currency); err != nil {
+			return nil, err
+		}
+
+		quote.Legs = append(quote.Legs, FareLegQuote{
+			FareLegRequest:  req,
+			DistanceM:       int(leg.DistanceM),
+			LegGroupID:      rule.LegGroupID,
+			FareProductID:   product.ID,
+			FareProductName: product.Name,
+			AmountCents:     product.AmountCents,
+		})
+		quote.TotalCents += product.AmountCents
+	}
+
+	for i := 0; i+1 < len(quote.Legs); i++ {
+		from, to := quote.Legs[i], quote.Legs[i+1]
+		rule := matchTransferRule(tables.TransferRules, from.LegGroupID, to.LegGroupID)
+		if rule == nil {
+			continue
+		}
+
+		transferCents := 0
+		if rule.FareProductID != "" {
+			product := prices.lookup(rule.FareProductID)
+			if product == nil {
+				continue // unpriced transfer product: charge the legs separately
+			}
+			if err := quote.setCurrency(product.Currency); err != nil {
+				return nil, err
+			}
+			transferCents = product.AmountCents
+		}
+
+		adj := transferCents
+		switch rule.TransferType {
+		case TransferFromPlusTransfer:
+			adj -= to.AmountCents
+		case TransferOnly:
+			adj -= from.AmountCents + to.AmountCents
+		}
+		quote.TotalCents += adj
+		quote.Transfers = append(quote.Transfers, FareTransferQuote{
+			FromLeg:         i,
+			TransferType:    rule.TransferType,
+			FareProductID:   rule.FareProductID,
+			AdjustmentCents: adj,
+		})
+		if rule.TransferType == TransferOnly {
+			i++ // both legs are consumed; the next transfer starts after them
+		}
+	}
+	return quote, nil
+}
+
+// setCurrency records the currency of the quote; every product of an
+// itinerary must share it.
+func (q *FareQuote) setCurrency(currency string) error {
+	if q.Currency == "" {
+		q.Currency = currency
+		return nil
+	}
+	if q.Currency != currency {
+		return fmt.Errorf("service: Quote: mixed currencies %s and %s", q.Currency, currency)
+	}
+	return nil
+}
+
+// fareCatalog looks up product prices for a rider category.
+type fareCatalog struct {
+	tables   *storage.FareTables
+	category string
+	fallback string // default category; its price applies when category has none
+}
+
+// lookup returns the price of productID for the catalog's category, falling
+// back to the default category. Returns nil when neither has a price.
+func (c fareCatalog) lookup(productID string) *storage.FareProduct {
+	var fallback *storage.FareProduct
+	for i := range c.tables.Products {
+		p := &c.tables.Products[i]
+		if p.ID != productID {
+			continue
+		}
+		if p.RiderCategoryID == c.category {
+			return p
+		}
+		if p.RiderCategoryID == c.fallback {
+			fallback = p
+		}
+	}
+	return fallback
+}
+
+// matchLegRule returns the rule that prices leg: the highest priority match,
+// then the most specific one, then the lowest ID. Returns nil if none match.
+func matchLegRule(rules []storage.FareLegRule, leg *storage.RideLeg) *storage.FareLegRule {
+	var best *storage.FareLegRule
+	bestSpecificity := 0
+	for i := range rules {
+		r := &rules[i]
+		if !legRuleMatches(r, leg) {
+			continue
+		}
+		spec := legRuleSpecificity(r)
+		if best == nil || r.Priority > best.Priority ||
+			(r.Priority == best.Priority && spec > bestSpecificity) {
+			best, bestSpecificity = r, spec
+		}
+	}
+	return best
+}
+
+func legRuleMatches(r *storage.FareLegRule, leg *storage.RideLeg) bool {
+	if r.NetworkID != "" && r.NetworkID != leg.NetworkID {
+		return false
+	}
+	if r.FromAreaID != "" && !slices.Contains(leg.FromAreas, r.FromAreaID) {
+		return false
+	}
+	if r.ToAreaID != "" && !slices.Contains(leg.ToAreas, r.ToAreaID) {
+		return false
+	}
+	if r.MinDistanceM != nil && leg.DistanceM < float64(*r.MinDistanceM) {
+		return false
+	}
+	if r.MaxDistanceM != nil && leg.DistanceM >= float64(*r.MaxDistanceM) {
+		return false
+	}
+	return true
+}
+
+// legRuleSpecificity counts the constrained fields of a rule.
+func legRuleSpecificity(r *storage.FareLegRule) int {
+	n := 0
+	for _, set := range []bool{
+		r.NetworkID != "",
+		r.FromAreaID != "",
+		r.ToAreaID != "",
+		r.MinDistanceM != nil,
+		r.MaxDistanceM != nil,
+	} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// matchTransferRule returns the first rule (lowest ID) matching a transfer
+// between the given leg groups, or nil.
+func matchTransferRule(rules []storage.FareTransferRule, fromGroup, toGroup string) *storage.FareTransferRule {
+	for i := range rules {
+		r := &rules[i]
+		if (r.FromLegGroupID == "" || r.FromLegGroupID == fromGroup) &&
+			(r.ToLegGroupID == "" || r.ToLegGroupID == toGroup) {
+			return r
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+// fakeFaresRepo serves fixed fare tables and ride legs keyed by route.
+type fakeFaresRepo struct {
+	tables *storage.FareTables
+	legs   map[int32]storage.RideLeg // keyed by route ID
+}
+
+func (f *fakeFaresRepo) GetFareTables(_ context.Context) (*storage.FareTables, error) {
+	return f.tables, nil
+}
+
+func (f *fakeFaresRepo) GetRideLeg(_ context.Context, routeID, fromStopID, toStopID int32) (*storage.RideLeg, error) {
+	leg, ok := f.legs[routeID]
+	if !ok {
+		return nil, nil
+	}
+	leg.RouteID, leg.FromStopID, leg.ToStopID = routeID, fromStopID, toStopID
+	return &leg, nil
+}
+
+func intRef(n int) *int { return &n }
+
+// limaFares mirrors the seed of 006_fares.sql plus a feeder network whose
+// transfers to the urban network are discounted.
+func limaFares() *fakeFaresRepo {
+	return &fakeFaresRepo{
+		tables: &storage.FareTables{
+			RiderCategories: []storage.RiderCategory{
+				{ID: "general", IsDefault: true},
+				{ID: "estudiante"},
+			},
+			Products: []storage.FareProduct{
+				{ID: "tramo_corto", RiderCategoryID: "general", Name: "Tramo corto", AmountCents: 150, Currency: "PEN"},
+				{ID: "tramo_corto", RiderCategoryID: "estudiante", Name: "Tramo corto", AmountCents: 75, Currency: "PEN"},
+				{ID: "tramo_largo", RiderCategoryID: "general", Name: "Tramo largo", AmountCents: 250, Currency: "PEN"},
+				{ID: "tramo_largo", RiderCategoryID: "estudiante", Name: "Tramo largo", AmountCents: 125, Currency: "PEN"},
+				{ID: "alimentador", RiderCategoryID: "general", Name: "Alimentador", AmountCents: 100, Currency: "PEN"},
+				{ID: "transbordo", RiderCategoryID: "general", Name: "Transbordo", AmountCents: 50, Currency: "PEN"},
+			},
+			LegRules: []storage.FareLegRule{
+				{ID: 1, LegGroupID: "urbano", NetworkID: "lima_urbano", MaxDistanceM: intRef(6000), FareProductID: "tramo_corto"},
+				{ID: 2, LegGroupID: "urbano", NetworkID: "lima_urbano", MinDistanceM: intRef(6000), FareProductID: "tramo_largo"},
+				{ID: 3, LegGroupID: "alimentador", NetworkID: "alimentador", FareProductID: "alimentador"},
+			},
+			TransferRules: []storage.FareTransferRule{
+				{ID: 1, FromLegGroupID: "alimentador", ToLegGroupID: "urbano", TransferType: TransferFromPlusTransfer, FareProductID: "transbordo"},
+			},
+		},
+		legs: map[int32]storage.RideLeg{
+			1: {NetworkID: "lima_urbano", FromSequence: 1, ToSequence: 3, DistanceM: 4200},
+			2: {NetworkID: "lima_urbano", FromSequence: 1, ToSequence: 5, DistanceM: 9100},
+			3: {NetworkID: "alimentador", FromSequence: 1, ToSequence: 2, DistanceM: 1500},
+			4: {NetworkID: "lima_urbano", FromSequence: 4, ToSequence: 2, DistanceM: 3000}, // backwards
+			5: {NetworkID: "sin_tarifa", FromSequence: 1, ToSequence: 2, DistanceM: 1000},
+		},
+	}
+}
+
+func TestFareService_SingleLeg_DistanceBands(t *testing.T) {
+	svc := NewFareService(limaFares())
+
+	tests := []struct {
+		name     string
+		category string
+		routeID  int32
+		want     int
+		product  string
+	}{
+		{"short band, default category", "", 1, 150, "tramo_corto"},
+		{"long band", "general", 2, 250, "tramo_largo"},
+		{"student half fare", "estudiante", 2, 125, "tramo_largo"},
+		{"student falls back to default price", "estudiante", 3, 100, "alimentador"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := svc.Quote(context.Background(), tt.category, []FareLegRequest{{RouteID: tt.routeID, FromStopID: 1, ToStopID: 2}})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if q.TotalCents != tt.want || q.Legs[0].FareProductID != tt.product {
+				t.Errorf("quote = %d (%s), want %d (%s)", q.TotalCents, q.Legs[0].FareProductID, tt.want, tt.product)
+			}
+			if q.Currency != "PEN" {
+				t.Errorf("currency = %q, want PEN", q.Currency)
+			}
+		})
+	}
+}
+
+func TestFareService_MultiLeg_Transfer(t *testing.T) {
+	svc := NewFareService(limaFares())
+
+	// Feeder (100) then urban long (250): A + AB replaces the urban fare with
+	// the 50-cent transfer product.
+	q, err := svc.Quote(context.Background(), "", []FareLegRequest{
+		{RouteID: 3, FromStopID: 10, ToStopID: 11},
+		{RouteID: 2, FromStopID: 11, ToStopID: 12},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if q.TotalCents != 150 {
+		t.Errorf("total = %d, want 150", q.TotalCents)
+	}
+	if len(q.Transfers) != 1 || q.Transfers[0].AdjustmentCents != -200 {
+		t.Errorf("transfers = %+v, want one with -200 adjustment", q.Transfers)
+	}
+
+	// Urban then feeder: no rule in that direction, legs add up.
+	q, err = svc.Quote(context.Background(), "", []FareLegRequest{
+		{RouteID: 1, FromStopID: 1, ToStopID: 3},
+		{RouteID: 3, FromStopID: 3, ToStopID: 4},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if q.TotalCents != 250 || len(q.Transfers) != 0 {
+		t.Errorf("total = %d with %d transfers, want 250 with none", q.TotalCents, len(q.Transfers))
+	}
+}
+
+func TestFareService_TransferTypes(t *testing.T) {
+	tests := []struct {
+		transferType int
+		want         int
+	}{
+		{TransferFromPlusTransfer, 100 + 50},
+		{TransferFromPlusTransferPlusTo, 100 + 50 + 150},
+		{TransferOnly, 50},
+	}
+	for _, tt := range tests {
+		repo := limaFares()
+		repo.tables.TransferRules[0].TransferType = tt.transferType
+
+		q, err := NewFareService(repo).Quote(context.Background(), "", []FareLegRequest{
+			{RouteID: 3, FromStopID: 10, ToStopID: 11},
+			{RouteID: 1, FromStopID: 11, ToStopID: 12},
+		})
+		if err != nil {
+			t.Fatalf("type %d: unexpected error: %v", tt.transferType, err)
+		}
+		if q.TotalCents != tt.want {
+			t.Errorf("type %d: total = %d, want %d", tt.transferType, q.TotalCents, tt.want)
+		}
+	}
+}
+
+func TestFareService_RulePriority(t *testing.T) {
+	repo := limaFares()
+	// A flat-fare promotion on the urban network outranks the distance bands.
+	repo.tables.LegRules = append(repo.tables.LegRules, storage.FareLegRule{
+		ID: 4, LegGroupID: "urbano", FareProductID: "transbordo", Priority: 1,
+	})
+
+	q, err := NewFareService(repo).Quote(context.Background(), "", []FareLegRequest{{RouteID: 2, FromStopID: 1, ToStopID: 5}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if q.Legs[0].FareProductID != "transbordo" {
+		t.Errorf("product = %q, want the higher priority rule", q.Legs[0].FareProductID)
+	}
+}
+
+func TestFareService_Errors(t *testing.T) {
+	svc := NewFareService(limaFares())
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		category string
+		legs     []FareLegRequest
+		want     error
+	}{
+		{"empty itinerary", "", nil, ErrInvalidFareLeg},
+		{"unknown category", "jubilado", []FareLegRequest{{RouteID: 1, FromStopID: 1, ToStopID: 2}}, ErrUnknownRiderCategory},
+		{"stops not on route", "", []FareLegRequest{{RouteID: 9, FromStopID: 1, ToStopID: 2}}, ErrInvalidFareLeg},
+		{"wrong direction", "", []FareLegRequest{{RouteID: 4, FromStopID: 4, ToStopID: 2}}, ErrInvalidFareLeg},
+		{"no matching rule", "", []FareLegRequest{{RouteID: 5, FromStopID: 1, ToStopID: 2}}, ErrNoFare},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.Quote(ctx, tt.category, tt.legs)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+const (
+	// maxFavorites is how many favorite stops, favorite routes and saved
+	// places a device may keep of each kind. The dashboard resolves the ETA
+	// of every favorite stop on each load.
+	maxFavorites = 20
+
+	// maxPlaceName is the longest name, in characters, of a saved place.
+	maxPlaceName = 50
+)
+
+var (
+	// ErrTooManyFavorites is returned when a device already keeps
+	// maxFavorites favorites of the kind being added.
+	ErrTooManyFavorites = errors.New("too many favorites")
+
+	// ErrInvalidPlace is returned for a saved place without a name, with a
+	// name that is too long, or with coordinates out of range.
+	ErrInvalidPlace = errors.New("invalid saved place")
+)
+
+// Favorites are the favorite stops and routes and the saved places of a
+// device.
+type Favorites struct {
+	Stops  []storage.Stop
+	Routes []storage.FavoriteRoute
+	Places []storage.SavedPlace
+}
+
+// FavoriteService keeps the favorite stops and routes and the saved places of
+// rider devices.
+type FavoriteService struct {
+	repo storage.FavoritesRepository
+}
+
+// NewFavoriteService creates a FavoriteService storing favorites in repo.
+func NewFavoriteService(repo storage.FavoritesRepository) *FavoriteService {
+	return &FavoriteService{repo: repo}
+}
+
+// List returns every favorite of deviceID.
+func (s *FavoriteService) List(ctx context.Context, deviceID string) (*Favorites, error) {
+	stops, err := s.repo.ListFavoriteStops(ctx, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("service: List: %w", err)
+	}
+	routes, err := s.repo.ListFavoriteRoutes(ctx, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("service: List: %w", err)
+	}
+	places, err := s.repo.ListSavedPlaces(ctx, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("service: List: %w", err)
+	}
+	return &Favorites{Stops: stops, Routes: routes, Places: places}, nil
+}
+
+// Stops returns the favorite stops of deviceID in the order they were added.
+func (s *FavoriteService) Stops(ctx context.Context, deviceID string) ([]storage.Stop, error) {
+	stops, err := s.repo.ListFavoriteStops(ctx, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("service: Stops: %w", err)
+	}
+	return stops, nil
+}
+
+// AddStop marks stopID as a favorite of deviceID. Adding a favorite again is
+// not an error. Returns false when the stop does not exist or is inactive.
+//
+// Errors:
+//   - ErrTooManyFavorites (wrapped) when the device already has
+//     maxFavorites favorite stops.
+func (s *FavoriteService) AddStop(ctx context.Context, deviceID string, stopID int32) (bool, error) {
+	stops, err := s.repo.ListFavoriteStops(ctx, deviceID)
+	if err != nil {
+		return false, fmt.Errorf("service: AddStop: %w", err)
+	}
+	isStop := func(st storage.Stop) bool { return st.ID == stopID }
+	if !slices.ContainsFunc(stops, isStop) && len(stops) >= maxFavorites {
+		return false, fmt.Errorf("service: AddStop: %w: at most %d stops", ErrTooManyFavorites, maxFavorites)
+	}
+	found, err := s.repo.AddFavoriteStop(ctx, deviceID, stopID)
+	if err != nil {
+		return false, fmt.Errorf("service: AddStop: %w", err)
+	}
+	return found, nil
+}
+
+// RemoveStop returns false when stopID was not a favorite of deviceID.
+func (s *FavoriteService) RemoveStop(ctx context.Context, deviceID string, stopID int32) (bool, error) {
+	removed, err := s.repo.RemoveFavoriteStop(ctx, deviceID, stopID)
+	if err != nil {
+		return false, fmt.Errorf("service: RemoveStop: %w", err)
+	}
+	return removed, nil
+}
+
+// AddRoute marks routeID as a favorite of deviceID, like AddStop.
+func (s *FavoriteService) AddRoute(ctx context.Context, deviceID string, routeID int32) (bool, error) {
+	routes, err := s.repo.ListFavoriteRoutes(ctx, deviceID)
+	if err != nil {
+		return false, fmt.Errorf("service: AddRoute: %w", err)
+	}
+	isRoute := func(r storage.FavoriteRoute) bool { return r.ID == routeID }
+	if !slices.ContainsFunc(routes, isRoute) && len(routes) >= maxFavorites {
+		return false, fmt.Errorf("service: AddRoute: %w: at most %d routes", ErrTooManyFavorites, maxFavorites)
+	}
+	found, err := s.repo.AddFavoriteRoute(ctx, deviceID, routeID)
+	if err != nil {
+		return false, fmt.Errorf("service: AddRoute: %w", err)
+	}
+	return found, nil
+}
+
+// RemoveRoute returns false when routeID was not a favorite of deviceID.
+func (s *FavoriteService) RemoveRoute(ctx context.Context, deviceID string, routeID int32) (bool, error) {
+	removed, err := s.repo.RemoveFavoriteRoute(ctx, deviceID, routeID)
+	if err != nil {
+		return false, fmt.Errorf("service: RemoveRoute: %w", err)
+	}
+	return removed, nil
+}
+
+// CreatePlace saves place p of p.DeviceID. Only p.DeviceID, p.Name, p.Lat and
+// p.Lon are read; the name is trimmed.
+//
+// Errors:
+//   - ErrInvalidPlace (wrapped) for a missing or long name, or coordinates
+//     out of range.
+//   - ErrTooManyFavorites (wrapped) when the device already has
+//     maxFavorites saved places.
+//   - storage.ErrConflict (wrapped) when the device has a place with that
+//     name.
+func (s *FavoriteService) CreatePlace(ctx context.Context, p storage.SavedPlace) (*storage.SavedPlace, error) {
+	p, err := validatePlace(p)
+	if err != nil {
+		return nil, fmt.Errorf("service: CreatePlace: %w", err)
+	}
+	places, err := s.repo.ListSavedPlaces(ctx, p.DeviceID)
+	if err != nil {
+		return nil, fmt.Errorf("service: CreatePlace: %w", err)
+	}
+	if len(places) >= maxFavorites {
+		return nil, fmt.Errorf("service: CreatePlace: %w: at most %d places", ErrTooManyFavorites, maxFavorites)
+	}
+	created, err := s.repo.CreateSavedPlace(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("service: CreatePlace: %w", err)
+	}
+	return created, nil
+}
+
+// UpdatePlace replaces the name and location of place p.ID of p.DeviceID.
+// Returns (nil, nil) when the device has no such place.
+//
+// Errors:
+//   - ErrInvalidPlace (wrapped), as in CreatePlace.
+//   - storage.ErrConflict (wrapped) when another place of the device has
+//     the new name.
+func (s *FavoriteService) UpdatePlace(ctx context.Context, p storage.SavedPlace) (*storage.SavedPlace, error) {
+	p, err := validatePlace(p)
+	if err != nil {
+		return nil, fmt.Errorf("service: UpdatePlace: %w", err)
+	}
+	updated, err := s.repo.UpdateSavedPlace(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("service: UpdatePlace: %w", err)
+	}
+	return updated, nil
+}
+
+// DeletePlace returns false when deviceID has no place id.
+func (s *FavoriteService) DeletePlace(ctx context.Context, deviceID string, id int32) (bool, error) {
+	deleted, err := s.repo.DeleteSavedPlace(ctx, deviceID, id)
+	if err != nil {
+		return false, fmt.Errorf("service: DeletePlace: %w", err)
+	}
+	return deleted, nil
+}
+
+// validatePlace checks the rider-supplied fields of p and returns it with its
+// name trimmed.
+func validatePlace(p storage.SavedPlace) (storage.SavedPlace, error) {
+	p.Name = strings.TrimSpace(p.Name)
+	switch {
+	case p.Name == "":
+		return p, fmt.Errorf("%w: name is required", ErrInvalidPlace)
+	case utf8.RuneCountInString(p.Name) > maxPlaceName:
+		return p, fmt.Errorf("%w: name longer than %d characters", ErrInvalidPlace, maxPlaceName)
+	case p.Lat < -90 || p.Lat > 90 || p.Lon < -180 || p.Lon > 180:
+		return p, fmt.Errorf("%w: coordinates out of range", ErrInvalidPlace)
+	}
+	return p, nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+// memFavoritesRepo is an in-memory storage.FavoritesRepository in which every
+// positive stop and route ID exists.
+type memFavoritesRepo struct {
+	stops  []int32
+	routes []int32
+	places []storage.SavedPlace
+}
+
+func (m *memFavoritesRepo) ListFavoriteStops(_ context.Context, _ string) ([]storage.Stop, error) {
+	out := make([]storage.Stop, len(m.stops))
+	for i, id := range m.stops {
+		out[i] = storage.Stop{ID: id}
+	}
+	return out, nil
+}
+
+func (m *memFavoritesRepo) AddFavoriteStop(_ context.Context, _ string, stopID int32) (bool, error) {
+	if !slices.Contains(m.stops, stopID) {
+		m.stops = append(m.stops, stopID)
+	}
+	return true, nil
+}
+
+func (m *memFavoritesRepo) RemoveFavoriteStop(_ context.Context, _ string, stopID int32) (bool, error) {
+	n := len(m.stops)
+	m.stops = slices.DeleteFunc(m.stops, func(id int32) bool { return id == stopID })
+	return len(m.stops) < n, nil
+}
+
+func (m *memFavoritesRepo) ListFavoriteRoutes(_ context.Context, _ string) ([]storage.FavoriteRoute, error) {
+	out := make([]storage.FavoriteRoute, len(m.routes))
+	for i, id := range m.routes {
+		out[i] = storage.FavoriteRoute{ID: id}
+	}
+	return out, nil
+}
+
+func (m *memFavoritesRepo) AddFavoriteRoute(_ context.Context, _ string, routeID int32) (bool, error) {
+	if !slices.Contains(m.routes, routeID) {
+		m.routes = append(m.routes, routeID)
+	}
+	return true, nil
+}
+
+func (m *memFavoritesRepo) RemoveFavoriteRoute(_ context.Context, _ string, routeID int32) (bool, error) {
+	n := len(m.routes)
+	m.routes = slices.DeleteFunc(m.routes, func(id int32) bool { return id == routeID })
+	return len(m.routes) < n, nil
+}
+
+func (m *memFavoritesRepo) ListSavedPlaces(_ context.Context, _ string) ([]storage.SavedPlace, error) {
+	return m.places, nil
+}
+
+func (m *memFavoritesRepo) CreateSavedPlace(_ context.Context, p storage.SavedPlace) (*storage.SavedPlace, error) {
+	for _, existing := range m.places {
+		if existing.Name == p.Name {
+			return nil, storage.ErrConflict
+		}
+	}
+	p.ID = int32(len(m.places) + 1)
+	m.places = append(m.places, p)
+	return &p, nil
+}
+
+func (m *memFavoritesRepo) UpdateSavedPlace(_ context.Context, p storage.SavedPlace) (*storage.SavedPlace, error) {
+	for i := range m.places {
+		if m.places[i].ID == p.ID {
+			m.places[i] = p
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memFavoritesRepo) DeleteSavedPlace(_ context.Context, _ string, id int32) (bool, error) {
+	n := len(m.places)
+	m.places = slices.DeleteFunc(m.places, func(p storage.SavedPlace) bool { return p.ID == id })
+	return len(m.places) < n, nil
+}
+
+func TestFavorites_AddStop_Limit(t *testing.T) {
+	repo := &memFavoritesRepo{}
+	s := NewFavoriteService(repo)
+	ctx := context.Background()
+
+	for id := int32(1); id <= maxFavorites; id++ {
+		if _, err := s.AddStop(ctx, "abc12345", id); err != nil {
+			t.Fatalf("AddStop(%d): unexpected error: %v", id, err)
+		}
+	}
+	if _, err := s.AddStop(ctx, "abc12345", maxFavorites+1); !errors.Is(err, ErrTooManyFavorites) {
+		t.Errorf("stop over the limit: err = %v, want ErrTooManyFavorites", err)
+	}
+	// Marking a favorite again is idempotent, even at the limit.
+	if found, err := s.AddStop(ctx, "abc12345", 1); !found || err != nil {
+		t.Errorf("repeated stop = %v, %v; want true, nil", found, err)
+	}
+	if _, err := s.AddRoute(ctx, "abc12345", 1); err != nil {
+		t.Errorf("routes have their own limit: unexpected error: %v", err)
+	}
+	if len(repo.stops) != maxFavorites {
+		t.Errorf("stops = %d, want %d", len(repo.stops), maxFavorites)
+	}
+}
+
+func TestFavorites_CreatePlace(t *testing.T) {
+	repo := &memFavoritesRepo{}
+	s := NewFavoriteService(repo)
+	ctx := context.Background()
+
+	for name, p := range map[string]storage.SavedPlace{
+		"no name":   {Name: "  ", Lat: -12.1, Lon: -77},
+		"long name": {Name: strings.Repeat("ñ", maxPlaceName+1), Lat: -12.1, Lon: -77},
+		"bad lat":   {Name: "Casa", Lat: -91, Lon: -77},
+		"bad lon":   {Name: "Casa", Lat: -12.1, Lon: 181},
+	} {
+		if _, err := s.CreatePlace(ctx, p); !errors.Is(err, ErrInvalidPlace) {
+			t.Errorf("%s: err = %v, want ErrInvalidPlace", name, err)
+		}
+	}
+
+	got, err := s.CreatePlace(ctx, storage.SavedPlace{DeviceID: "abc12345", Name: " Casa ", Lat: -12.1, Lon: -77})
+	if err != nil {
+		t.Fatalf("CreatePlace: unexpected error: %v", err)
+	}
+	if got.Name != "Casa" {
+		t.Errorf("name = %q, want it trimmed", got.Name)
+	}
+	if _, err := s.CreatePlace(ctx, storage.SavedPlace{Name: "Casa", Lat: -12, Lon: -77}); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("repeated name: err = %v, want storage.ErrConflict", err)
+	}
+
+	for i := len(repo.places); i < maxFavorites; i++ {
+		repo.places = append(repo.places, storage.SavedPlace{ID: int32(i + 1)})
+	}
+	if _, err := s.CreatePlace(ctx, storage.SavedPlace{Name: "Trabajo", Lat: -12, Lon: -77}); !errors.Is(err, ErrTooManyFavorites) {
+		t.Errorf("place over the limit: err = %v, want ErrTooManyFavorites", err)
+	}
+}
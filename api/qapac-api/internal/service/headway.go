@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+// defaultBunchingFraction flags a pair of buses as bunched when they arrive
+// less than half a scheduled headway apart.
+const defaultBunchingFraction = 0.5
+
+// HeadwayGranularity selects the bucket size of a headway report.
+type HeadwayGranularity string
+
+const (
+	HeadwayHourly HeadwayGranularity = "hourly"
+	HeadwayDaily  HeadwayGranularity = "daily"
+)
+
+// HeadwayBucket aggregates the headways observed in one hour or one day.
+// A headway is attributed to the bucket of the second (following) arrival.
+type HeadwayBucket struct {
+	Start    time.Time
+	Headways int
+	MeanS    float64
+	StdDevS  float64
+	// CV is the coefficient of variation (StdDevS / MeanS), the usual headway
+	// regularity indicator: 0 is perfectly even service, values above ~0.5
+	// mean riders see buses arrive in clumps.
+	CV   float64
+	MinS int
+	// Bunched counts the headways below the bunching threshold. Always 0 when
+	// the route has no scheduled headway.
+	Bunched int
+}
+
+// HeadwayReport is the regularity report of a route over a time range.
+type HeadwayReport struct {
+	RouteID int32
+	// ScheduledS is the planned headway in seconds; 0 when unknown.
+	ScheduledS int
+	// BunchingThresholdS is the headway below which a pair counts as bunched;
+	// 0 when ScheduledS is unknown.
+	BunchingThresholdS int
+	Buckets            []HeadwayBucket
+}
+
+// BunchingEvent is a pair of consecutive buses that arrived at a stop closer
+// together than the bunching threshold.
+type BunchingEvent struct {
+	StopID            int32
+	LeaderVehicleID   int32
+	FollowerVehicleID int32
+	ArrivedAt         time.Time // arrival of the follower
+	HeadwayS          int
+}
+
+// HeadwayService computes actual headways from stop arrival events and
+// compares them with each route's scheduled headway.
+type HeadwayService struct {
+	repo             storage.HeadwaysRepository
+	bunchingFraction float64
+}
+
+// HeadwayOption configures a HeadwayService.
+type HeadwayOption func(*HeadwayService)
+
+// WithBunchingFraction overrides the fraction of the scheduled headway below
+// which two consecutive buses are flagged as bunched.
+func WithBunchingFraction(f float64) HeadwayOption {
+	return func(s *HeadwayService) { s.bunchingFraction = f }
+}
+
+// NewHeadwayService creates a HeadwayService reading arrivals from repo.
+func NewHeadwayService(repo storage.HeadwaysRepository, opts ...HeadwayOption) *HeadwayService {
+	s := &HeadwayService{repo: repo, bunchingFraction: defaultBunchingFraction}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// observedHeadway is the gap between two consecutive arrivals at a stop.
+type observedHeadway struct {
+	stopID   int32
+	leader   storage.StopArrival
+	follower storage.StopArrival
+	seconds  int
+}
+
+// Regularity returns per-bucket headway metrics of routeID for arrivals in
+// [from, to). Buckets are aligned to local time and returned in chronological
+// order; buckets without headways are omitted.
+func (s *HeadwayService) Regularity(ctx context.Context, routeID int32, from, to time.Time, granularity HeadwayGranularity) (*HeadwayReport, error) {
+	if granularity != HeadwayHourly && granularity != HeadwayDaily {
+		return nil, fmt.Errorf("headway: Regularity: unknown granularity %q", granularity)
+	}
+
+	headways, scheduledS, err := s.load(ctx, routeID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("headway: Regularity: %w", err)
+	}
+	threshold := s.threshold(scheduledS)
+
+	grouped := make(map[time.Time][]int)
+	for _, h := range headways {
+		start := bucketStart(h.follower.ArrivedAt, granularity)
+		grouped[start] = append(grouped[start], h.seconds)
+	}
+
+	report := &HeadwayReport{
+		RouteID:            routeID,
+		ScheduledS:         scheduledS,
+		BunchingThresholdS: threshold,
+		Buckets:            make([]HeadwayBucket, 0, len(grouped)),
+	}
+	for start, secs := range grouped {
+		report.Buckets = append(report.Buckets, summarizeHeadways(start, secs, threshold))
+	}
+	sort.Slice(report.Buckets, func(i, j int) bool {
+		return report.Buckets[i].Start.Before(report.Buckets[j].Start)
+	})
+	return report, nil
+}
+
+// Bunching returns every bunched pair of routeID in [from, to), ordered by
+// arrival time. It returns an empty list when the route has no scheduled
+// headway, since there is nothing to compare against.
+func (s *HeadwayService) Bunching(ctx context.Context, routeID int32, from, to time.Time) ([]BunchingEvent, error) {
+	headways, scheduledS, err := s.load(ctx, routeID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("headway: Bunching: %w", err)
+	}
+	threshold := s.threshold(scheduledS)
+
+	events := []BunchingEvent{}
+	for _, h := range headways {
+		if h.seconds >= threshold {
+			continue
+		}
+		events = append(events, BunchingEvent{
+			StopID:            h.stopID,
+			LeaderVehicleID:   h.leader.VehicleID,
+			FollowerVehicleID: h.follower.VehicleID,
+			ArrivedAt:         h.follower.ArrivedAt,
+			HeadwayS:          h.seconds,
+		})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].ArrivedAt.Before(events[j].ArrivedAt)
+	})
+	return events, nil
+}
+
+// load fetches the arrivals and scheduled headway of routeID and derives the
+// observed headways between consecutive arrivals at each stop.
+func (s *HeadwayService) load(ctx context.Context, routeID int32, from, to time.Time) ([]observedHeadway, int, error) {
+	if routeID <= 0 {
+		return nil, 0, fmt.Errorf("invalid route ID %d", routeID)
+	}
+	if !from.Before(to) {
+		return nil, 0, fmt.Errorf("empty time range [%s, %s)", from, to)
+	}
+
+	scheduledS, _, err := s.repo.GetScheduledHeadway(ctx, routeID)
+	if err != nil {
+		return nil, 0, err
+	}
+	arrivals, err := s.repo.ListStopArrivals(ctx, routeID, from, to)
+	if err != nil {
+		return nil, 0, err
+	}
+	return computeHeadways(arrivals), scheduledS, nil
+}
+
+// threshold returns the bunching threshold in seconds for a scheduled
+// headway; 0 (never bunched) when the schedule is unknown.
+func (s *HeadwayService) threshold(scheduledS int) int {
+	return int(float64(scheduledS) * s.bunchingFraction)
+}
+
+// computeHeadways pairs consecutive arrivals at the same stop. arrivals must
+// be ordered by stop and time, as returned by ListStopArrivals. Repeated
+// events from the same vehicle (GPS jitter around the stop) are collapsed
+// into the first one.
+func computeHeadways(arrivals []storage.StopArrival) []observedHeadway {
+	var out []observedHeadway
+	for i := 0; i < len(arrivals); {
+		leader := arrivals[i]
+		j := i + 1
+		for j < len(arrivals) && arrivals[j].StopID == leader.StopID && arrivals[j].VehicleID == leader.VehicleID {
+			j++ // same vehicle again: keep the first arrival of the run
+		}
+		if j < len(arrivals) && arrivals[j].StopID == leader.StopID {
+			follower := arrivals[j]
+			out = append(out, observedHeadway{
+				stopID:   leader.StopID,
+				leader:   leader,
+				follower: follower,
+				seconds:  int(follower.ArrivedAt.Sub(leader.ArrivedAt).Seconds()),
+			})
+		}
+		i = j
+	}
+	return out
+}
+
+// summarizeHeadways computes the metrics of one bucket.
+func summarizeHeadways(start time.Time, secs []int, thresholdS int) HeadwayBucket {
+	b := HeadwayBucket{Start: start, Headways: len(secs), MinS: secs[0]}
+
+	var sum float64
+	for _, v := range secs {
+		sum += float64(v)
+		if v < b.MinS {
+			b.MinS = v
+		}
+		if v < thresholdS {
+			b.Bunched++
+		}
+	}
+	b.MeanS = sum / float64(len(secs))
+
+	var sq float64
+	for _, v := range secs {
+		d := float64(v) - b.MeanS
+		sq += d * d
+	}
+	b.StdDevS = math.Sqrt(sq / float64(len(secs)))
+	if b.MeanS > 0 {
+		b.CV = b.StdDevS / b.MeanS
+	}
+	return b
+}
+
+// bucketStart truncates t to the start of its local hour or day.
+func bucketStart(t time.Time, g HeadwayGranularity) time.Time {
+	t = t.Local()
+	if g == HeadwayDaily {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+// fakeHeadwaysRepo serves a fixed set of arrivals and scheduled headway.
+// stopsAt maps a latitude to the route stop found there.
+type fakeHeadwaysRepo struct {
+	arrivals    []storage.StopArrival
+	scheduledS  int
+	listErr     error
+	stopsAt     map[float64]int32
+	approaching map[int32]int32 // vehicle expected next at each stop
+	since       time.Time
+}
+
+func (f *fakeHeadwaysRepo) RecordStopArrival(_ context.Context, a storage.StopArrival) error {
+	f.arrivals = append(f.arrivals, a)
+	return nil
+}
+
+func (f *fakeHeadwaysRepo) FindRouteStopNear(_ context.Context, _ int32, lat, _, _ float64) (int32, bool, error) {
+	id, ok := f.stopsAt[lat]
+	return id, ok, nil
+}
+
+func (f *fakeHeadwaysRepo) ListStopArrivals(_ context.Context, _ int32, _, _ time.Time) ([]storage.StopArrival, error) {
+	return f.arrivals, f.listErr
+}
+
+func (f *fakeHeadwaysRepo) ListApproachingVehicles(_ context.Context, _ []int32, since time.Time) (map[int32]int32, error) {
+	f.since = since
+	return f.approaching, f.listErr
+}
+
+func (f *fakeHeadwaysRepo) GetScheduledHeadway(_ context.Context, _ int32) (int, bool, error) {
+	return f.scheduledS, f.scheduledS > 0, nil
+}
+
+// arrivalAt builds an arrival at stop for vehicle at 07:00 local + minutes.
+func arrivalAt(stop, vehicle int32, minutes float64) storage.StopArrival {
+	base := time.Date(2025, 3, 10, 7, 0, 0, 0, time.Local)
+	return storage.StopArrival{
+		RouteID:   1,
+		StopID:    stop,
+		VehicleID: vehicle,
+		ArrivedAt: base.Add(time.Duration(minutes * float64(time.Minute))),
+	}
+}
+
+var (
+	headwayFrom = time.Date(2025, 3, 10, 0, 0, 0, 0, time.Local)
+	headwayTo   = headwayFrom.AddDate(0, 0, 1)
+)
+
+func TestComputeHeadways(t *testing.T) {
+	arrivals := []storage.StopArrival{
+		arrivalAt(1, 1, 0),
+		arrivalAt(1, 1, 0.5), // duplicate event from the same bus
+		arrivalAt(1, 2, 10),
+		arrivalAt(1, 3, 12),
+		arrivalAt(2, 1, 5), // new stop: no headway across stops
+		arrivalAt(2, 2, 15),
+	}
+
+	got := computeHeadways(arrivals)
+
+	want := []int{600, 120, 600}
+	if len(got) != len(want) {
+		t.Fatalf("got %d headways, want %d", len(got), len(want))
+	}
+	for i, h := range got {
+		if h.seconds != want[i] {
+			t.Errorf("headway[%d] = %ds, want %ds", i, h.seconds, want[i])
+		}
+	}
+	if got[0].leader.VehicleID != 1 || got[0].follower.VehicleID != 2 {
+		t.Errorf("first pair = %d→%d, want 1→2", got[0].leader.VehicleID, got[0].follower.VehicleID)
+	}
+}
+
+func TestHeadwayService_Regularity_Hourly(t *testing.T) {
+	repo := &fakeHeadwaysRepo{
+		scheduledS: 600,
+		arrivals: []storage.StopArrival{
+			arrivalAt(1, 1, 0),
+			arrivalAt(1, 2, 10), // 600s
+			arrivalAt(1, 3, 12), // 120s → bunched (< 300s)
+			arrivalAt(1, 4, 70), // 3480s, bucket 08:00
+		},
+	}
+	svc := NewHeadwayService(repo)
+
+	report, err := svc.Regularity(context.Background(), 1, headwayFrom, headwayTo, HeadwayHourly)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.BunchingThresholdS != 300 {
+		t.Errorf("threshold = %d, want 300", report.BunchingThresholdS)
+	}
+	if len(report.Buckets) != 2 {
+		t.Fatalf("got %d buckets, want 2", len(report.Buckets))
+	}
+
+	first := report.Buckets[0]
+	if first.Start.Hour() != 7 {
+		t.Errorf("first bucket starts at %v, want 07:00", first.Start)
+	}
+	if first.Headways != 2 || first.Bunched != 1 || first.MinS != 120 {
+		t.Errorf("first bucket = %+v, want 2 headways, 1 bunched, min 120", first)
+	}
+	if first.MeanS != 360 {
+		t.Errorf("mean = %v, want 360", first.MeanS)
+	}
+	// Population stddev of {600, 120} is 240 → CV = 240/360.
+	if math.Abs(first.CV-240.0/360.0) > 1e-9 {
+		t.Errorf("cv = %v, want %v", first.CV, 240.0/360.0)
+	}
+	if report.Buckets[1].Start.Hour() != 8 {
+		t.Errorf("second bucket starts at %v, want 08:00", report.Buckets[1].Start)
+	}
+}
+
+func TestHeadwayService_Regularity_Daily(t *testing.T) {
+	repo := &fakeHeadwaysRepo{
+		scheduledS: 600,
+		arrivals: []storage.StopArrival{
+			arrivalAt(1, 1, 0),
+			arrivalAt(1, 2, 10),
+			arrivalAt(1, 3, 70),
+		},
+	}
+	svc := NewHeadwayService(repo)
+
+	report, err := svc.Regularity(context.Background(), 1, headwayFrom, headwayTo, HeadwayDaily)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(report.Buckets) != 1 || report.Buckets[0].Headways != 2 {
+		t.Fatalf("buckets = %+v, want one daily bucket with 2 headways", report.Buckets)
+	}
+	if !report.Buckets[0].Start.Equal(headwayFrom) {
+		t.Errorf("bucket start = %v, want %v", report.Buckets[0].Start, headwayFrom)
+	}
+}
+
+func TestHeadwayService_NoSchedule_NeverBunched(t *testing.T) {
+	repo := &fakeHeadwaysRepo{
+		arrivals: []storage.StopArrival{
+			arrivalAt(1, 1, 0),
+			arrivalAt(1, 2, 1),
+		},
+	}
+	svc := NewHeadwayService(repo)
+
+	report, err := svc.Regularity(context.Background(), 1, headwayFrom, headwayTo, HeadwayHourly)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Buckets[0].Bunched != 0 {
+		t.Errorf("bunched = %d, want 0 without a schedule", report.Buckets[0].Bunched)
+	}
+
+	events, err := svc.Bunching(context.Background(), 1, headwayFrom, headwayTo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("got %d bunching events, want 0 without a schedule", len(events))
+	}
+}
+
+func TestHeadwayService_Bunching(t *testing.T) {
+	repo := &fakeHeadwaysRepo{
+		scheduledS: 600,
+		arrivals: []storage.StopArrival{
+			arrivalAt(1, 1, 0),
+			arrivalAt(1, 2, 20),
+			arrivalAt(1, 3, 22),
+			arrivalAt(2, 1, 5),
+			arrivalAt(2, 2, 7),
+		},
+	}
+	svc := NewHeadwayService(repo, WithBunchingFraction(0.25))
+
+	events, err := svc.Bunching(context.Background(), 1, headwayFrom, headwayTo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	// Ordered by arrival time: stop 2 at 07:07 comes before stop 1 at 07:22.
+	if events[0].StopID != 2 || events[0].HeadwayS != 120 {
+		t.Errorf("events[0] = %+v, want stop 2 with 120s", events[0])
+	}
+	if events[1].LeaderVehicleID != 2 || events[1].FollowerVehicleID != 3 {
+		t.Errorf("events[1] = %+v, want 2→3", events[1])
+	}
+}
+
+func TestHeadwayService_Errors(t *testing.T) {
+	svc := NewHeadwayService(&fakeHeadwaysRepo{})
+	ctx := context.Background()
+
+	if _, err := svc.Regularity(ctx, 0, headwayFrom, headwayTo, HeadwayHourly); err == nil {
+		t.Error("expected error for route ID 0")
+	}
+	if _, err := svc.Regularity(ctx, 1, headwayTo, headwayFrom, HeadwayHourly); err == nil {
+		t.Error("expected error for an empty range")
+	}
+	if _, err := svc.Regularity(ctx, 1, headwayFrom, headwayTo, "weekly"); err == nil {
+		t.Error("expected error for an unknown granularity")
+	}
+
+	svc = NewHeadwayService(&fakeHeadwaysRepo{listErr: errors.New("db down")})
+	if _, err := svc.Bunching(ctx, 1, headwayFrom, headwayTo); err == nil {
+		t.Error("expected error when arrivals cannot be read")
+	}
+}
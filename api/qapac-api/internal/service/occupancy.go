@@ -0,0 +1,371 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+// OccupancyStatus is the GTFS-Realtime VehiclePosition.OccupancyStatus enum.
+type OccupancyStatus int
+
+const (
+	OccupancyEmpty                   OccupancyStatus = 0
+	OccupancyManySeatsAvailable      OccupancyStatus = 1
+	OccupancyFewSeatsAvailable       OccupancyStatus = 2
+	OccupancyStandingRoomOnly        OccupancyStatus = 3
+	OccupancyCrushedStandingRoomOnly OccupancyStatus = 4
+	OccupancyFull                    OccupancyStatus = 5
+	OccupancyNotAcceptingPassengers  OccupancyStatus = 6
+	OccupancyNoDataAvailable         OccupancyStatus = 7
+	OccupancyNotBoardable            OccupancyStatus = 8
+)
+
+var occupancyStatusNames = [...]string{
+	"EMPTY",
+	"MANY_SEATS_AVAILABLE",
+	"FEW_SEATS_AVAILABLE",
+	"STANDING_ROOM_ONLY",
+	"CRUSHED_STANDING_ROOM_ONLY",
+	"FULL",
+	"NOT_ACCEPTING_PASSENGERS",
+	"NO_DATA_AVAILABLE",
+	"NOT_BOARDABLE",
+}
+
+// String returns the GTFS-Realtime name of s.
+func (s OccupancyStatus) String() string {
+	if s < 0 || int(s) >= len(occupancyStatusNames) {
+		return fmt.Sprintf("OccupancyStatus(%d)", int(s))
+	}
+	return occupancyStatusNames[s]
+}
+
+// ParseOccupancyStatus parses a GTFS-Realtime OccupancyStatus name.
+func ParseOccupancyStatus(name string) (OccupancyStatus, bool) {
+	for i, n := range occupancyStatusNames {
+		if n == name {
+			return OccupancyStatus(i), true
+		}
+	}
+	return 0, false
+}
+
+var (
+	// ErrInvalidOccupancyReport is returned by Report for a status or source
+	// that cannot be recorded.
+	ErrInvalidOccupancyReport = errors.New("invalid occupancy report")
+
+	// ErrUnknownVehicle is returned by Report for a vehicle that is not
+	// registered.
+	ErrUnknownVehicle = errors.New("unknown vehicle")
+
+	// ErrOccupancyReportThrottled is returned by ReportRider when the same
+	// rider reported the same vehicle too recently.
+	ErrOccupancyReportThrottled = errors.New("occupancy report throttled")
+)
+
+const (
+	// defaultOccupancyHalfLife is how long it takes a report to lose half its
+	// weight. Riders board and alight at every stop, so crowding changes
+	// within a few stops (~5 minutes in Lima traffic).
+	defaultOccupancyHalfLife = 5 * time.Minute
+
+	// defaultOccupancyMaxAge discards reports older than this: after six
+	// half-lives a report weighs under 2%.
+	defaultOccupancyMaxAge = 30 * time.Minute
+
+	// defaultRiderReportInterval is the minimum time between two reports of
+	// the same rider on the same vehicle. It keeps one rider from outweighing
+	// the rest of the bus by tapping repeatedly, while still letting them
+	// update the status a couple of stops later.
+	defaultRiderReportInterval = 2 * time.Minute
+
+	// crewReportWeight is the weight of a driver or collector report relative
+	// to a rider report: the crew sees the whole bus and is accountable.
+	crewReportWeight = 3.0
+
+	// approachWindow bounds the age of the last stop arrival of a vehicle
+	// that is still on its way to later stops. A bus that has not reached a
+	// stop in longer has most likely ended its run or stopped reporting.
+	approachWindow = 20 * time.Minute
+)
+
+// OccupancyEstimate is the aggregated crowding of a vehicle.
+type OccupancyEstimate struct {
+	// Status is OccupancyNoDataAvailable when there are no recent reports.
+	Status OccupancyStatus
+	// Reports is the number of reports that contributed to the estimate.
+	Reports int
+	// UpdatedAt is the time of the most recent contributing report.
+	UpdatedAt time.Time
+}
+
+// ApproachingOccupancy is the crowding of the vehicle expected next at a
+// stop.
+type ApproachingOccupancy struct {
+	VehicleID int32
+	OccupancyEstimate
+}
+
+// OccupancyService records crowding reports and aggregates them per vehicle.
+type OccupancyService struct {
+	repo          storage.OccupancyRepository
+	arrivals      storage.HeadwaysRepository
+	halfLife      time.Duration
+	maxAge        time.Duration
+	riderInterval time.Duration
+	now           func() time.Time
+
+	mu        sync.Mutex
+	riders    map[riderVehicle]time.Time // last accepted report of each rider on each vehicle
+	lastSweep time.Time
+}
+
+// riderVehicle keys the rider report throttle.
+type riderVehicle struct {
+	client    string
+	vehicleID int32
+}
+
+// OccupancyOption configures an OccupancyService.
+type OccupancyOption func(*OccupancyService)
+
+// WithOccupancyDecay overrides the report half-life and the maximum age of a
+// report considered by the aggregation.
+func WithOccupancyDecay(halfLife, maxAge time.Duration) OccupancyOption {
+	return func(s *OccupancyService) {
+		s.halfLife = halfLife
+		s.maxAge = maxAge
+	}
+}
+
+// WithRiderReportInterval overrides the minimum time between two reports of
+// the same rider on the same vehicle. Zero disables the throttle.
+func WithRiderReportInterval(d time.Duration) OccupancyOption {
+	return func(s *OccupancyService) { s.riderInterval = d }
+}
+
+// WithApproachingVehicles lets Approaching attribute the next arrival at a
+// stop to a vehicle, from the stop arrivals recorded in repo.
+func WithApproachingVehicles(repo storage.HeadwaysRepository) OccupancyOption {
+	return func(s *OccupancyService) { s.arrivals = repo }
+}
+
+// NewOccupancyService creates an OccupancyService backed by repo.
+func NewOccupancyService(repo storage.OccupancyRepository, opts ...OccupancyOption) *OccupancyService {
+	s := &OccupancyService{
+		repo:          repo,
+		halfLife:      defaultOccupancyHalfLife,
+		maxAge:        defaultOccupancyMaxAge,
+		riderInterval: defaultRiderReportInterval,
+		now:           time.Now,
+		riders:        make(map[riderVehicle]time.Time),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Report records an occupancy observation of vehicleID made now.
+//
+// NO_DATA_AVAILABLE carries no information and is rejected, as are unknown
+// sources; both wrap ErrInvalidOccupancyReport. An unknown vehicle wraps
+// ErrUnknownVehicle.
+func (s *OccupancyService) Report(ctx context.Context, vehicleID int32, status OccupancyStatus, source string) error {
+	if status < OccupancyEmpty || status > OccupancyNotBoardable || status == OccupancyNoDataAvailable {
+		return fmt.Errorf("service: Report: %w: status %d", ErrInvalidOccupancyReport, int(status))
+	}
+	switch source {
+	case storage.OccupancySourceDriver, storage.OccupancySourceCollector, storage.OccupancySourceRider:
+	default:
+		return fmt.Errorf("service: Report: %w: source %q", ErrInvalidOccupancyReport, source)
+	}
+
+	err := s.repo.RecordOccupancyReport(ctx, storage.OccupancyReport{
+		VehicleID:  vehicleID,
+		Status:     int(status),
+		Source:     source,
+		ReportedAt: s.now(),
+	})
+	if errors.Is(err, storage.ErrInvalidReference) {
+		return fmt.Errorf("service: Report: %w: %d", ErrUnknownVehicle, vehicleID)
+	}
+	if err != nil {
+		return fmt.Errorf("service: Report: %w", err)
+	}
+	return nil
+}
+
+// ReportRider records a rider's occupancy observation of vehicleID, unless
+// the same client had a report of that vehicle accepted within the rider
+// report interval; then it returns ErrOccupancyReportThrottled and the time
+// left until the next report is accepted.
+//
+// client identifies the rider, e.g. by IP address. The throttle is kept in
+// memory, so each API instance enforces it on its own.
+func (s *OccupancyService) ReportRider(ctx context.Context, vehicleID int32, status OccupancyStatus, client string) (time.Duration, error) {
+	key := riderVehicle{client: client, vehicleID: vehicleID}
+	now := s.now()
+	if wait := s.reserveRider(key, now); wait > 0 {
+		return wait, fmt.Errorf("service: ReportRider: %w: vehicle %d", ErrOccupancyReportThrottled, vehicleID)
+	}
+
+	if err := s.Report(ctx, vehicleID, status, storage.OccupancySourceRider); err != nil {
+		// Nothing was recorded: do not hold the rider back.
+		s.mu.Lock()
+		if s.riders[key].Equal(now) {
+			delete(s.riders, key)
+		}
+		s.mu.Unlock()
+		return 0, err
+	}
+	return 0, nil
+}
+
+// reserveRider takes the report slot of key at now and returns zero, or
+// returns how long key has to wait for it.
+func (s *OccupancyService) reserveRider(key riderVehicle, now time.Time) time.Duration {
+	if s.riderInterval <= 0 {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if last, ok := s.riders[key]; ok {
+		if wait := last.Add(s.riderInterval).Sub(now); wait > 0 {
+			return wait
+		}
+	}
+	s.riders[key] = now
+
+	// Forget riders whose interval has passed, at most once per interval, so
+	// the map only holds the riders of the last few minutes.
+	cutoff := now.Add(-s.riderInterval)
+	if s.lastSweep.Before(cutoff) {
+		s.lastSweep = now
+		for k, last := range s.riders {
+			if !last.After(cutoff) {
+				delete(s.riders, k)
+			}
+		}
+	}
+	return 0
+}
+
+// Current returns the occupancy estimate of each vehicle in vehicleIDs.
+// Vehicles without recent reports map to OccupancyNoDataAvailable.
+//
+// The estimate is the weighted mean of the recent reports on the ordinal
+// scale EMPTY..NOT_ACCEPTING_PASSENGERS, rounded to the nearest status. Each
+// report's weight halves every half-life, and crew reports weigh
+// crewReportWeight times a rider report.
+func (s *OccupancyService) Current(ctx context.Context, vehicleIDs []int32) (map[int32]OccupancyEstimate, error) {
+	now := s.now()
+	reports, err := s.repo.ListOccupancyReportsSince(ctx, vehicleIDs, now.Add(-s.maxAge))
+	if err != nil {
+		return nil, fmt.Errorf("service: Current: %w", err)
+	}
+
+	type acc struct {
+		weighted, weights float64
+		est               OccupancyEstimate
+	}
+	accs := make(map[int32]*acc, len(vehicleIDs))
+	for _, r := range reports {
+		if OccupancyStatus(r.Status) == OccupancyNoDataAvailable {
+			continue
+		}
+		a := accs[r.VehicleID]
+		if a == nil {
+			a = &acc{}
+			accs[r.VehicleID] = a
+		}
+		w := occupancyReportWeight(r, now, s.halfLife)
+		a.weighted += w * float64(occupancyLevel(OccupancyStatus(r.Status)))
+		a.weights += w
+		a.est.Reports++
+		if r.ReportedAt.After(a.est.UpdatedAt) {
+			a.est.UpdatedAt = r.ReportedAt
+		}
+	}
+
+	out := make(map[int32]OccupancyEstimate, len(vehicleIDs))
+	for _, id := range vehicleIDs {
+		a := accs[id]
+		if a == nil || a.weights == 0 {
+			out[id] = OccupancyEstimate{Status: OccupancyNoDataAvailable}
+			continue
+		}
+		a.est.Status = OccupancyStatus(math.Round(a.weighted / a.weights))
+		out[id] = a.est
+	}
+	return out, nil
+}
+
+// Approaching returns the occupancy of the vehicle expected next at each stop
+// in stopIDs, keyed by stop. That vehicle is the one whose last recorded
+// arrival, within the approach window, was the fewest stops before the stop
+// on a route serving it: ETAs do not identify vehicles, so this is a best
+// guess. Stops without such a vehicle, or whose vehicle has no recent
+// reports, are absent; without WithApproachingVehicles every stop is.
+func (s *OccupancyService) Approaching(ctx context.Context, stopIDs []int32) (map[int32]ApproachingOccupancy, error) {
+	out := make(map[int32]ApproachingOccupancy)
+	if s.arrivals == nil || len(stopIDs) == 0 {
+		return out, nil
+	}
+
+	next, err := s.arrivals.ListApproachingVehicles(ctx, stopIDs, s.now().Add(-approachWindow))
+	if err != nil {
+		return nil, fmt.Errorf("service: Approaching: %w", err)
+	}
+	if len(next) == 0 {
+		return out, nil
+	}
+	vehicleIDs := make([]int32, 0, len(next))
+	for _, id := range next {
+		if !slices.Contains(vehicleIDs, id) {
+			vehicleIDs = append(vehicleIDs, id)
+		}
+	}
+	estimates, err := s.Current(ctx, vehicleIDs)
+	if err != nil {
+		return nil, fmt.Errorf("service: Approaching: %w", err)
+	}
+
+	for stopID, vehicleID := range next {
+		if est := estimates[vehicleID]; est.Status != OccupancyNoDataAvailable {
+			out[stopID] = ApproachingOccupancy{VehicleID: vehicleID, OccupancyEstimate: est}
+		}
+	}
+	return out, nil
+}
+
+// occupancyLevel maps a status onto the ordinal crowding scale. NOT_BOARDABLE
+// counts as NOT_ACCEPTING_PASSENGERS: either way riders cannot get on.
+func occupancyLevel(s OccupancyStatus) int {
+	if s == OccupancyNotBoardable {
+		return int(OccupancyNotAcceptingPassengers)
+	}
+	return int(s)
+}
+
+// occupancyReportWeight returns the decayed weight of r at now.
+func occupancyReportWeight(r storage.OccupancyReport, now time.Time, halfLife time.Duration) float64 {
+	w := 1.0
+	if r.Source != storage.OccupancySourceRider {
+		w = crewReportWeight
+	}
+	age := now.Sub(r.ReportedAt)
+	if age <= 0 || halfLife <= 0 {
+		return w
+	}
+	return w * math.Exp2(-age.Seconds()/halfLife.Seconds())
+}
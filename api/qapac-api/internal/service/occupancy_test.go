@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+// memOccupancyRepo stores reports in memory; vehicle 99 does not exist.
+type memOccupancyRepo struct {
+	reports []storage.OccupancyReport
+	since   time.Time
+}
+
+func (m *memOccupancyRepo) RecordOccupancyReport(_ context.Context, r storage.OccupancyReport) error {
+	if r.VehicleID == 99 {
+		return storage.ErrInvalidReference
+	}
+	m.reports = append(m.reports, r)
+	return nil
+}
+
+func (m *memOccupancyRepo) ListOccupancyReportsSince(_ context.Context, _ []int32, since time.Time) ([]storage.OccupancyReport, error) {
+	m.since = since
+	var out []storage.OccupancyReport
+	for _, r := range m.reports {
+		if !r.ReportedAt.Before(since) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+var occupancyNow = time.Date(2025, 3, 10, 8, 0, 0, 0, time.Local)
+
+func newTestOccupancyService(repo storage.OccupancyRepository) *OccupancyService {
+	s := NewOccupancyService(repo)
+	s.now = func() time.Time { return occupancyNow }
+	return s
+}
+
+func report(vehicle int32, status OccupancyStatus, source string, ago time.Duration) storage.OccupancyReport {
+	return storage.OccupancyReport{VehicleID: vehicle, Status: int(status), Source: source, ReportedAt: occupancyNow.Add(-ago)}
+}
+
+func TestOccupancyStatus_Names(t *testing.T) {
+	if got := OccupancyStandingRoomOnly.String(); got != "STANDING_ROOM_ONLY" {
+		t.Errorf("String() = %q", got)
+	}
+	if s, ok := ParseOccupancyStatus("FULL"); !ok || s != OccupancyFull {
+		t.Errorf("ParseOccupancyStatus(FULL) = %v, %v", s, ok)
+	}
+	if _, ok := ParseOccupancyStatus("full"); ok {
+		t.Error("names are case-sensitive, as in GTFS-Realtime")
+	}
+}
+
+func TestOccupancyService_Report(t *testing.T) {
+	repo := &memOccupancyRepo{}
+	svc := newTestOccupancyService(repo)
+	ctx := context.Background()
+
+	if err := svc.Report(ctx, 1, OccupancyFull, storage.OccupancySourceRider); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repo.reports) != 1 || !repo.reports[0].ReportedAt.Equal(occupancyNow) {
+		t.Errorf("reports = %+v, want one stamped now", repo.reports)
+	}
+
+	for name, err := range map[string]error{
+		"no data":        svc.Report(ctx, 1, OccupancyNoDataAvailable, storage.OccupancySourceRider),
+		"out of range":   svc.Report(ctx, 1, OccupancyStatus(9), storage.OccupancySourceRider),
+		"unknown source": svc.Report(ctx, 1, OccupancyFull, "sensor"),
+	} {
+		if !errors.Is(err, ErrInvalidOccupancyReport) {
+			t.Errorf("%s: err = %v, want ErrInvalidOccupancyReport", name, err)
+		}
+	}
+
+	err := svc.Report(ctx, 99, OccupancyFull, storage.OccupancySourceRider)
+	if !errors.Is(err, ErrUnknownVehicle) || errors.Is(err, ErrInvalidOccupancyReport) {
+		t.Errorf("unknown vehicle: err = %v, want only ErrUnknownVehicle", err)
+	}
+}
+
+func TestOccupancyService_Current_TimeDecay(t *testing.T) {
+	repo := &memOccupancyRepo{reports: []storage.OccupancyReport{
+		// Vehicle 1: an old FULL report is outweighed by a fresh EMPTY one.
+		report(1, OccupancyFull, storage.OccupancySourceRider, 20*time.Minute),
+		report(1, OccupancyEmpty, storage.OccupancySourceRider, 0),
+		// Vehicle 2: two riders say FEW_SEATS, the collector says STANDING.
+		report(2, OccupancyFewSeatsAvailable, storage.OccupancySourceRider, time.Minute),
+		report(2, OccupancyFewSeatsAvailable, storage.OccupancySourceRider, time.Minute),
+		report(2, OccupancyStandingRoomOnly, storage.OccupancySourceCollector, time.Minute),
+		// Vehicle 3: only a report older than the max age.
+		report(3, OccupancyFull, storage.OccupancySourceDriver, time.Hour),
+	}}
+	svc := newTestOccupancyService(repo)
+
+	got, err := svc.Current(context.Background(), []int32{1, 2, 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := occupancyNow.Add(-defaultOccupancyMaxAge); !repo.since.Equal(want) {
+		t.Errorf("queried since %v, want %v", repo.since, want)
+	}
+	if got[1].Status != OccupancyEmpty || got[1].Reports != 2 || !got[1].UpdatedAt.Equal(occupancyNow) {
+		t.Errorf("vehicle 1 = %+v, want EMPTY from 2 reports", got[1])
+	}
+	// (2*1 + 2*1 + 3*3) / (1+1+3) = 2.6 → STANDING_ROOM_ONLY.
+	if got[2].Status != OccupancyStandingRoomOnly {
+		t.Errorf("vehicle 2 = %v, want STANDING_ROOM_ONLY", got[2].Status)
+	}
+	if got[3].Status != OccupancyNoDataAvailable || got[3].Reports != 0 {
+		t.Errorf("vehicle 3 = %+v, want NO_DATA_AVAILABLE", got[3])
+	}
+}
+
+func TestOccupancyReportWeight(t *testing.T) {
+	r := report(1, OccupancyFull, storage.OccupancySourceRider, 10*time.Minute)
+	if w := occupancyReportWeight(r, occupancyNow, 5*time.Minute); w != 0.25 {
+		t.Errorf("weight after two half-lives = %v, want 0.25", w)
+	}
+	r.Source = storage.OccupancySourceDriver
+	if w := occupancyReportWeight(r, occupancyNow, 5*time.Minute); w != 0.75 {
+		t.Errorf("crew weight after two half-lives = %v, want 0.75", w)
+	}
+}
+
+func TestOccupancyService_ReportRider_Throttled(t *testing.T) {
+	repo := &memOccupancyRepo{}
+	svc := newTestOccupancyService(repo)
+	ctx := context.Background()
+
+	if _, err := svc.ReportRider(ctx, 1, OccupancyFull, "198.51.100.7"); err != nil {
+		t.Fatalf("first report: %v", err)
+	}
+
+	svc.now = func() time.Time { return occupancyNow.Add(30 * time.Second) }
+	wait, err := svc.ReportRider(ctx, 1, OccupancyEmpty, "198.51.100.7")
+	if !errors.Is(err, ErrOccupancyReportThrottled) || wait != 90*time.Second {
+		t.Errorf("repeat report = %v, %v; want throttled for 90s", wait, err)
+	}
+	// Other vehicles and other riders are not affected.
+	if _, err := svc.ReportRider(ctx, 2, OccupancyFull, "198.51.100.7"); err != nil {
+		t.Errorf("other vehicle: %v", err)
+	}
+	if _, err := svc.ReportRider(ctx, 1, OccupancyFull, "198.51.100.8"); err != nil {
+		t.Errorf("other rider: %v", err)
+	}
+
+	svc.now = func() time.Time { return occupancyNow.Add(2 * time.Minute) }
+	if _, err := svc.ReportRider(ctx, 1, OccupancyEmpty, "198.51.100.7"); err != nil {
+		t.Errorf("after the interval: %v", err)
+	}
+	if len(repo.reports) != 4 {
+		t.Errorf("recorded %d reports, want 4", len(repo.reports))
+	}
+}
+
+func TestOccupancyService_ReportRider_FailedReportNotThrottled(t *testing.T) {
+	svc := newTestOccupancyService(&memOccupancyRepo{})
+	ctx := context.Background()
+
+	if _, err := svc.ReportRider(ctx, 1, OccupancyNoDataAvailable, "198.51.100.7"); !errors.Is(err, ErrInvalidOccupancyReport) {
+		t.Fatalf("err = %v, want ErrInvalidOccupancyReport", err)
+	}
+	if _, err := svc.ReportRider(ctx, 1, OccupancyFull, "198.51.100.7"); err != nil {
+		t.Errorf("report after a rejected one: %v", err)
+	}
+}
+
+func TestOccupancyService_ReportRider_ForgetsPastRiders(t *testing.T) {
+	svc := newTestOccupancyService(&memOccupancyRepo{})
+	ctx := context.Background()
+
+	for i := range int32(3) {
+		if _, err := svc.ReportRider(ctx, i+1, OccupancyFull, "198.51.100.7"); err != nil {
+			t.Fatalf("report %d: %v", i, err)
+		}
+	}
+	svc.now = func() time.Time { return occupancyNow.Add(10 * time.Minute) }
+	if _, err := svc.ReportRider(ctx, 1, OccupancyFull, "198.51.100.8"); err != nil {
+		t.Fatalf("late report: %v", err)
+	}
+	if len(svc.riders) != 1 {
+		t.Errorf("throttle holds %d riders, want only the latest", len(svc.riders))
+	}
+}
+
+func TestOccupancyService_Approaching(t *testing.T) {
+	repo := &memOccupancyRepo{reports: []storage.OccupancyReport{
+		report(3, OccupancyFull, storage.OccupancySourceCollector, time.Minute),
+	}}
+	// Vehicle 3 is on its way to stop 10 and vehicle 4, without reports, to
+	// stop 11; nothing is known to approach stop 12.
+	arrivals := &fakeHeadwaysRepo{approaching: map[int32]int32{10: 3, 11: 4}}
+	s := NewOccupancyService(repo, WithApproachingVehicles(arrivals))
+	s.now = func() time.Time { return occupancyNow }
+
+	got, err := s.Approaching(context.Background(), []int32{10, 11, 12})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[10].VehicleID != 3 || got[10].Status != OccupancyFull {
+		t.Errorf("approaching = %+v, want only stop 10 with vehicle 3 FULL", got)
+	}
+	if want := occupancyNow.Add(-approachWindow); !arrivals.since.Equal(want) {
+		t.Errorf("since = %s, want %s", arrivals.since, want)
+	}
+
+	// Without arrivals nothing is attributed.
+	got, err = newTestOccupancyService(repo).Approaching(context.Background(), []int32{10})
+	if err != nil || len(got) != 0 {
+		t.Errorf("without arrivals = %+v, %v; want empty", got, err)
+	}
+}
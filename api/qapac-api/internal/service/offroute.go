@@ -0,0 +1,404 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// defaultOffRouteThresholdM is the distance from the route shape beyond
+	// which a position counts as off-route. Urban GPS error plus lane changes
+	// rarely exceed ~50m, while a detour through a parallel street is >100m.
+	defaultOffRouteThresholdM = 150.0
+
+	// defaultOffRoutePersistence is how long a vehicle must stay on one side of
+	// the threshold before the detector changes its state. It filters out GPS
+	// jumps and short manoeuvres around double-parked vehicles.
+	defaultOffRoutePersistence = 2 * time.Minute
+
+	// deviationQueryTimeout is the deadline for each incident read/write query.
+	deviationQueryTimeout = 5 * time.Second
+)
+
+// VehiclePosition is a single position report from a vehicle in service.
+type VehiclePosition struct {
+	// VehicleID references vehicles(id). The ingestion layer resolves the
+	// reporting device to a vehicle and takes RouteID from its active
+	// assignment (see storage.VehiclesRepository.GetActiveAssignment).
+	VehicleID  int32
+	RouteID    int32
+	Lat        float64
+	Lon        float64
+	ReportedAt time.Time
+}
+
+// DeviationIncident describes a vehicle that left the shape of its route.
+type DeviationIncident struct {
+	ID        int32
+	VehicleID int32
+	RouteID   int32
+	// Lat/Lon is the first off-route position of the episode.
+	Lat          float64
+	Lon          float64
+	MaxDistanceM int
+	OpenedAt     time.Time
+}
+
+// DeviationStore abstracts the persistence of deviation incidents.
+type DeviationStore interface {
+	// OpenDeviation records a new open incident and returns its ID.
+	OpenDeviation(ctx context.Context, inc DeviationIncident) (id int32, err error)
+	// CloseDeviation marks the incident as closed at closedAt and records the
+	// largest distance observed during the episode.
+	CloseDeviation(ctx context.Context, id int32, closedAt time.Time, maxDistanceM int) error
+}
+
+// AlertPublisher publishes a rider-facing service alert for an open incident.
+type AlertPublisher interface {
+	PublishDeviationAlert(ctx context.Context, inc DeviationIncident) error
+}
+
+// LogAlertPublisher is an AlertPublisher that writes each alert to a log. It
+// stands in for the rider-facing service alerts, which do not exist yet, so
+// that operators can still see new incidents as they open.
+type LogAlertPublisher struct {
+	logf func(format string, args ...any)
+}
+
+// NewLogAlertPublisher creates a LogAlertPublisher that writes with logf
+// (e.g. log.Printf).
+func NewLogAlertPublisher(logf func(format string, args ...any)) *LogAlertPublisher {
+	return &LogAlertPublisher{logf: logf}
+}
+
+// PublishDeviationAlert logs the incident. It never fails.
+func (p *LogAlertPublisher) PublishDeviationAlert(_ context.Context, inc DeviationIncident) error {
+	p.logf("offroute: vehicle %d left route %d at (%.5f, %.5f) since %s, incident %d (max %d m)",
+		inc.VehicleID, inc.RouteID, inc.Lat, inc.Lon, inc.OpenedAt.Format(time.RFC3339), inc.ID, inc.MaxDistanceM)
+	return nil
+}
+
+// OffRouteDetector compares incoming vehicle positions with the shape of the
+// vehicle's route and opens a deviation incident when the vehicle stays
+// farther than the threshold for longer than the persistence window. The
+// incident is closed once the vehicle has been back on the shape for the same
+// window.
+//
+// State is kept in memory per VehicleID, so a single detector instance must
+// receive every position of a given vehicle. Reports of one vehicle are
+// processed in turn; reports of different vehicles do not wait for each
+// other's store or alert calls. A vehicle that stops reporting for longer than
+// the persistence window is forgotten.
+type OffRouteDetector struct {
+	routes      storage.RoutesRepository
+	store       DeviationStore
+	alerts      AlertPublisher // optional; nil means incidents are not published
+	thresholdM  float64
+	persistence time.Duration
+
+	mu        sync.Mutex // guards vehicles, vehicleTrack.seen and lastSweep
+	vehicles  map[int32]*vehicleTrack
+	lastSweep time.Time
+}
+
+// vehicleTrack is the detector state of a single vehicle.
+type vehicleTrack struct {
+	// seen is the latest report time of the vehicle, used to evict it when
+	// idle. Guarded by OffRouteDetector.mu.
+	seen time.Time
+
+	// mu serializes the reports of the vehicle and guards the fields below.
+	// It is held across store and alert calls.
+	mu       sync.Mutex
+	routeID  int32
+	lastSeen time.Time
+	// offSince is the first report of the current off-route streak; zero when
+	// the last report was on-route.
+	offSince time.Time
+	offLat   float64
+	offLon   float64
+	// onSince is the first report of the current on-route streak while an
+	// incident is open; zero otherwise.
+	onSince time.Time
+	// incidentID is the open incident, or 0 when the vehicle is on-route.
+	incidentID int32
+	maxDistM   float64
+}
+
+// reset starts the track over on routeID, with no incident open. Caller
+// holds t.mu.
+func (t *vehicleTrack) reset(routeID int32) {
+	t.routeID = routeID
+	t.offSince = time.Time{}
+	t.onSince = time.Time{}
+	t.incidentID = 0
+	t.maxDistM = 0
+}
+
+// OffRouteOption configures an OffRouteDetector.
+type OffRouteOption func(*OffRouteDetector)
+
+// WithOffRouteThreshold overrides the off-route distance threshold (metres).
+func WithOffRouteThreshold(meters float64) OffRouteOption {
+	return func(d *OffRouteDetector) { d.thresholdM = meters }
+}
+
+// WithPersistenceWindow overrides how long a vehicle must stay off (or back
+// on) the route before an incident is opened (or closed).
+func WithPersistenceWindow(window time.Duration) OffRouteOption {
+	return func(d *OffRouteDetector) { d.persistence = window }
+}
+
+// WithAlertPublisher enables automatic service alerts for new incidents.
+func WithAlertPublisher(p AlertPublisher) OffRouteOption {
+	return func(d *OffRouteDetector) { d.alerts = p }
+}
+
+// NewOffRouteDetector creates an OffRouteDetector with sensible defaults.
+//
+//   - routes is used to measure the distance from a position to the route shape.
+//   - store persists incidents (use NewPgDeviationStore for production).
+func NewOffRouteDetector(routes storage.RoutesRepository, store DeviationStore, opts ...OffRouteOption) *OffRouteDetector {
+	d := &OffRouteDetector{
+		routes:      routes,
+		store:       store,
+		thresholdM:  defaultOffRouteThresholdM,
+		persistence: defaultOffRoutePersistence,
+		vehicles:    make(map[int32]*vehicleTrack),
+	}
+	for _, o := range opts {
+		o(d)
+	}
+	return d
+}
+
+// Observe feeds a position report into the detector.
+//
+// Reports older than the last one seen for the same vehicle are ignored, as
+// are reports for routes without a recorded shape. When a vehicle switches
+// route its state is reset; an incident still open on the previous route is
+// closed at the time of the new report.
+//
+// Vehicles whose last report is older than the persistence window, measured
+// from this report, are forgotten; an incident still open for one of them is
+// closed at the time of its last report. Failures to close those incidents
+// are returned along with the outcome of this report.
+//
+// Alert publication failures are non-fatal: the incident is still recorded.
+func (d *OffRouteDetector) Observe(ctx context.Context, pos VehiclePosition) error {
+	if pos.VehicleID <= 0 {
+		return fmt.Errorf("offroute: Observe: invalid vehicle ID %d", pos.VehicleID)
+	}
+
+	distM, found, err := d.routes.DistanceToRouteShape(ctx, pos.RouteID, pos.Lat, pos.Lon)
+	if err != nil {
+		return fmt.Errorf("offroute: Observe: distance to route %d: %w", pos.RouteID, err)
+	}
+
+	d.mu.Lock()
+	idle := d.evictIdle(pos.ReportedAt, pos.VehicleID)
+	t, ok := d.vehicles[pos.VehicleID]
+	if !ok {
+		t = &vehicleTrack{routeID: pos.RouteID}
+		d.vehicles[pos.VehicleID] = t
+	}
+	if pos.ReportedAt.After(t.seen) {
+		t.seen = pos.ReportedAt
+	}
+	d.mu.Unlock()
+
+	err = d.observe(ctx, pos, t, distM, found)
+	for _, it := range idle {
+		err = errors.Join(err, d.closeIdle(ctx, it))
+	}
+	return err
+}
+
+// evictIdle removes from d.vehicles the tracks, other than vehicleID's, last
+// seen more than the persistence window before now, and returns them. It
+// scans at most once per window. Caller holds d.mu.
+func (d *OffRouteDetector) evictIdle(now time.Time, vehicleID int32) []*vehicleTrack {
+	cutoff := now.Add(-d.persistence)
+	if !d.lastSweep.Before(cutoff) {
+		return nil
+	}
+	d.lastSweep = now
+
+	var idle []*vehicleTrack
+	for id, t := range d.vehicles {
+		if id != vehicleID && t.seen.Before(cutoff) {
+			delete(d.vehicles, id)
+			idle = append(idle, t)
+		}
+	}
+	return idle
+}
+
+// closeIdle closes the open incident of an evicted track at its last report.
+func (d *OffRouteDetector) closeIdle(ctx context.Context, t *vehicleTrack) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return d.closeIncident(ctx, t, t.lastSeen)
+}
+
+// observe applies a report to the track of its vehicle.
+func (d *OffRouteDetector) observe(ctx context.Context, pos VehiclePosition, t *vehicleTrack, distM float64, found bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if pos.ReportedAt.Before(t.lastSeen) {
+		return nil // out-of-order report
+	}
+	if t.routeID != pos.RouteID {
+		if err := d.closeIncident(ctx, t, pos.ReportedAt); err != nil {
+			return err
+		}
+		t.reset(pos.RouteID)
+	}
+	t.lastSeen = pos.ReportedAt
+
+	if !found {
+		return nil // no shape to compare against
+	}
+
+	if distM > d.thresholdM {
+		return d.observeOffRoute(ctx, pos, t, distM)
+	}
+	return d.observeOnRoute(ctx, pos, t)
+}
+
+// observeOffRoute handles a report beyond the threshold. Caller holds t.mu.
+func (d *OffRouteDetector) observeOffRoute(ctx context.Context, pos VehiclePosition, t *vehicleTrack, distM float64) error {
+	t.onSince = time.Time{}
+	if distM > t.maxDistM {
+		t.maxDistM = distM
+	}
+	if t.incidentID != 0 {
+		return nil // already open
+	}
+	if t.offSince.IsZero() {
+		t.offSince = pos.ReportedAt
+		t.offLat, t.offLon = pos.Lat, pos.Lon
+		t.maxDistM = distM
+	}
+	if pos.ReportedAt.Sub(t.offSince) < d.persistence {
+		return nil
+	}
+
+	inc := DeviationIncident{
+		VehicleID:    pos.VehicleID,
+		RouteID:      pos.RouteID,
+		Lat:          t.offLat,
+		Lon:          t.offLon,
+		MaxDistanceM: int(t.maxDistM),
+		OpenedAt:     t.offSince,
+	}
+	id, err := d.store.OpenDeviation(ctx, inc)
+	if err != nil {
+		return fmt.Errorf("offroute: open incident for vehicle %d: %w", pos.VehicleID, err)
+	}
+	t.incidentID = id
+	inc.ID = id
+
+	if d.alerts != nil {
+		_ = d.alerts.PublishDeviationAlert(ctx, inc)
+	}
+	return nil
+}
+
+// observeOnRoute handles a report within the threshold. Caller holds t.mu.
+func (d *OffRouteDetector) observeOnRoute(ctx context.Context, pos VehiclePosition, t *vehicleTrack) error {
+	if t.incidentID == 0 {
+		// A streak that never reached the persistence window is discarded.
+		t.offSince = time.Time{}
+		t.maxDistM = 0
+		return nil
+	}
+	if t.onSince.IsZero() {
+		t.onSince = pos.ReportedAt
+	}
+	if pos.ReportedAt.Sub(t.onSince) < d.persistence {
+		return nil
+	}
+	return d.closeIncident(ctx, t, t.onSince)
+}
+
+// closeIncident closes the open incident of t, if any, and resets its streaks.
+// Caller holds t.mu.
+func (d *OffRouteDetector) closeIncident(ctx context.Context, t *vehicleTrack, closedAt time.Time) error {
+	if t.incidentID == 0 {
+		return nil
+	}
+	if err := d.store.CloseDeviation(ctx, t.incidentID, closedAt, int(t.maxDistM)); err != nil {
+		return fmt.Errorf("offroute: close incident %d: %w", t.incidentID, err)
+	}
+	t.incidentID = 0
+	t.offSince = time.Time{}
+	t.onSince = time.Time{}
+	t.maxDistM = 0
+	return nil
+}
+
+// --- pgx-backed DeviationStore ---
+
+// pgDeviationStore is the production implementation backed by pgx.
+type pgDeviationStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPgDeviationStore creates a DeviationStore backed by the given connection pool.
+func NewPgDeviationStore(pool *pgxpool.Pool) DeviationStore {
+	return &pgDeviationStore{pool: pool}
+}
+
+// OpenDeviation inserts a new open incident into route_deviation_incidents.
+func (s *pgDeviationStore) OpenDeviation(ctx context.Context, inc DeviationIncident) (int32, error) {
+	ctx, cancel := context.WithTimeout(ctx, deviationQueryTimeout)
+	defer cancel()
+
+	const q = `
+		INSERT INTO route_deviation_incidents
+			(vehicle_id, route_id, geom, max_distance_m, opened_at)
+		VALUES
+			($1, $2, ST_SetSRID(ST_MakePoint($3, $4), 4326), $5, $6)
+		RETURNING id`
+
+	var id int32
+	err := s.pool.QueryRow(ctx, q,
+		inc.VehicleID,
+		inc.RouteID,
+		inc.Lon,
+		inc.Lat,
+		int32(inc.MaxDistanceM),
+		inc.OpenedAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("offroute: store: open: %w", err)
+	}
+	return id, nil
+}
+
+// CloseDeviation sets closed_at on an open incident. Closing an already closed
+// incident is a no-op.
+func (s *pgDeviationStore) CloseDeviation(ctx context.Context, id int32, closedAt time.Time, maxDistanceM int) error {
+	ctx, cancel := context.WithTimeout(ctx, deviationQueryTimeout)
+	defer cancel()
+
+	const q = `
+		UPDATE route_deviation_incidents
+		SET closed_at      = $2,
+		    max_distance_m = GREATEST(max_distance_m, $3)
+		WHERE id = $1
+		  AND closed_at IS NULL`
+
+	if _, err := s.pool.Exec(ctx, q, id, closedAt, int32(maxDistanceM)); err != nil {
+		return fmt.Errorf("offroute: store: close: %w", err)
+	}
+	return nil
+}
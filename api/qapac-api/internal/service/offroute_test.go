@@ -0,0 +1,331 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+// ---------------------------------------------------------------------------
+// Test doubles
+// ---------------------------------------------------------------------------
+
+// fakeRoutesRepo returns a fixed distance to every route shape.
+type fakeRoutesRepo struct {
+	distM   float64
+	noShape bool
+	err     error
+}
+
+func (f *fakeRoutesRepo) GetRouteShape(_ context.Context, _ int32) (*storage.RouteShape, error) {
+	return nil, nil
+}
+
+func (f *fakeRoutesRepo) DistanceToRouteShape(_ context.Context, _ int32, _, _ float64) (float64, bool, error) {
+	if f.err != nil {
+		return 0, false, f.err
+	}
+	return f.distM, !f.noShape, nil
+}
+
+// memDeviationStore records incidents in memory.
+type memDeviationStore struct {
+	opened  []DeviationIncident
+	closed  map[int32]time.Time
+	maxDist map[int32]int
+	openErr error
+}
+
+func newMemDeviationStore() *memDeviationStore {
+	return &memDeviationStore{closed: make(map[int32]time.Time), maxDist: make(map[int32]int)}
+}
+
+func (m *memDeviationStore) OpenDeviation(_ context.Context, inc DeviationIncident) (int32, error) {
+	if m.openErr != nil {
+		return 0, m.openErr
+	}
+	m.opened = append(m.opened, inc)
+	return int32(len(m.opened)), nil
+}
+
+func (m *memDeviationStore) CloseDeviation(_ context.Context, id int32, closedAt time.Time, maxDistanceM int) error {
+	m.closed[id] = closedAt
+	m.maxDist[id] = maxDistanceM
+	return nil
+}
+
+// recordingPublisher counts published alerts.
+type recordingPublisher struct {
+	alerts []DeviationIncident
+	err    error
+}
+
+func (p *recordingPublisher) PublishDeviationAlert(_ context.Context, inc DeviationIncident) error {
+	p.alerts = append(p.alerts, inc)
+	return p.err
+}
+
+var offRouteT0 = time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)
+
+// observeAt feeds a position for vehicle 1 on route 1 at t0+offset.
+func observeAt(t *testing.T, d *OffRouteDetector, offset time.Duration) {
+	t.Helper()
+	err := d.Observe(context.Background(), VehiclePosition{
+		VehicleID:  1,
+		RouteID:    1,
+		Lat:        -12.05,
+		Lon:        -77.04,
+		ReportedAt: offRouteT0.Add(offset),
+	})
+	if err != nil {
+		t.Fatalf("Observe(+%s): unexpected error: %v", offset, err)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// OffRouteDetector
+// ---------------------------------------------------------------------------
+
+func TestOffRoute_OnRoute_NoIncident(t *testing.T) {
+	store := newMemDeviationStore()
+	d := NewOffRouteDetector(&fakeRoutesRepo{distM: 20}, store)
+
+	for i := 0; i < 10; i++ {
+		observeAt(t, d, time.Duration(i)*30*time.Second)
+	}
+	if len(store.opened) != 0 {
+		t.Errorf("opened %d incidents, want 0", len(store.opened))
+	}
+}
+
+func TestOffRoute_ShortExcursion_NoIncident(t *testing.T) {
+	routes := &fakeRoutesRepo{distM: 400}
+	store := newMemDeviationStore()
+	d := NewOffRouteDetector(routes, store, WithPersistenceWindow(2*time.Minute))
+
+	observeAt(t, d, 0)
+	observeAt(t, d, time.Minute)
+	routes.distM = 10
+	observeAt(t, d, 90*time.Second)
+	routes.distM = 400
+	observeAt(t, d, 150*time.Second) // new streak starts here, not at t0
+
+	if len(store.opened) != 0 {
+		t.Errorf("opened %d incidents, want 0", len(store.opened))
+	}
+}
+
+func TestOffRoute_PersistentDeviation_OpensIncident(t *testing.T) {
+	routes := &fakeRoutesRepo{distM: 300}
+	store := newMemDeviationStore()
+	pub := &recordingPublisher{}
+	d := NewOffRouteDetector(routes, store, WithPersistenceWindow(2*time.Minute), WithAlertPublisher(pub))
+
+	observeAt(t, d, 0)
+	routes.distM = 500
+	observeAt(t, d, time.Minute)
+	observeAt(t, d, 2*time.Minute)
+	observeAt(t, d, 3*time.Minute) // must not open a second incident
+
+	if len(store.opened) != 1 {
+		t.Fatalf("opened %d incidents, want 1", len(store.opened))
+	}
+	inc := store.opened[0]
+	if !inc.OpenedAt.Equal(offRouteT0) {
+		t.Errorf("OpenedAt = %v, want start of streak %v", inc.OpenedAt, offRouteT0)
+	}
+	if inc.MaxDistanceM != 500 {
+		t.Errorf("MaxDistanceM = %d, want 500", inc.MaxDistanceM)
+	}
+	if len(pub.alerts) != 1 || pub.alerts[0].ID != 1 {
+		t.Errorf("alerts = %+v, want one alert for incident 1", pub.alerts)
+	}
+}
+
+func TestOffRoute_Rejoin_ClosesIncident(t *testing.T) {
+	routes := &fakeRoutesRepo{distM: 300}
+	store := newMemDeviationStore()
+	d := NewOffRouteDetector(routes, store, WithPersistenceWindow(time.Minute))
+
+	observeAt(t, d, 0)
+	observeAt(t, d, time.Minute)
+	routes.distM = 5
+	observeAt(t, d, 2*time.Minute)
+	if len(store.closed) != 0 {
+		t.Fatal("incident closed before the persistence window elapsed")
+	}
+	observeAt(t, d, 3*time.Minute)
+
+	closedAt, ok := store.closed[1]
+	if !ok {
+		t.Fatal("incident 1 was not closed")
+	}
+	if want := offRouteT0.Add(2 * time.Minute); !closedAt.Equal(want) {
+		t.Errorf("closedAt = %v, want first on-route report %v", closedAt, want)
+	}
+}
+
+func TestOffRoute_CustomThreshold(t *testing.T) {
+	store := newMemDeviationStore()
+	d := NewOffRouteDetector(&fakeRoutesRepo{distM: 100}, store,
+		WithOffRouteThreshold(50), WithPersistenceWindow(time.Minute))
+
+	observeAt(t, d, 0)
+	observeAt(t, d, time.Minute)
+
+	if len(store.opened) != 1 {
+		t.Errorf("opened %d incidents, want 1 (100m > 50m threshold)", len(store.opened))
+	}
+}
+
+func TestOffRoute_NoShape_Ignored(t *testing.T) {
+	store := newMemDeviationStore()
+	d := NewOffRouteDetector(&fakeRoutesRepo{distM: 1000, noShape: true}, store, WithPersistenceWindow(time.Minute))
+
+	observeAt(t, d, 0)
+	observeAt(t, d, 5*time.Minute)
+
+	if len(store.opened) != 0 {
+		t.Errorf("opened %d incidents for a route without shape, want 0", len(store.opened))
+	}
+}
+
+func TestOffRoute_OutOfOrderReportIgnored(t *testing.T) {
+	routes := &fakeRoutesRepo{distM: 300}
+	store := newMemDeviationStore()
+	d := NewOffRouteDetector(routes, store, WithPersistenceWindow(time.Minute))
+
+	observeAt(t, d, 2*time.Minute)
+	observeAt(t, d, 0) // late report must not start the streak earlier
+	observeAt(t, d, 150*time.Second)
+
+	if len(store.opened) != 0 {
+		t.Errorf("opened %d incidents, want 0", len(store.opened))
+	}
+}
+
+func TestOffRoute_RouteChange_ClosesIncident(t *testing.T) {
+	store := newMemDeviationStore()
+	d := NewOffRouteDetector(&fakeRoutesRepo{distM: 300}, store, WithPersistenceWindow(time.Minute))
+
+	observeAt(t, d, 0)
+	observeAt(t, d, time.Minute)
+
+	err := d.Observe(context.Background(), VehiclePosition{
+		VehicleID: 1, RouteID: 2, ReportedAt: offRouteT0.Add(90 * time.Second),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := store.closed[1]; !ok {
+		t.Error("incident on previous route was not closed")
+	}
+}
+
+func TestOffRoute_Errors(t *testing.T) {
+	d := NewOffRouteDetector(&fakeRoutesRepo{}, newMemDeviationStore())
+	if err := d.Observe(context.Background(), VehiclePosition{RouteID: 1}); err == nil {
+		t.Error("expected error for vehicle ID 0")
+	}
+
+	d = NewOffRouteDetector(&fakeRoutesRepo{err: errors.New("db down")}, newMemDeviationStore())
+	if err := d.Observe(context.Background(), VehiclePosition{VehicleID: 1, RouteID: 1}); err == nil {
+		t.Error("expected error when distance lookup fails")
+	}
+
+	store := newMemDeviationStore()
+	store.openErr = errors.New("insert failed")
+	d = NewOffRouteDetector(&fakeRoutesRepo{distM: 300}, store, WithPersistenceWindow(0))
+	err := d.Observe(context.Background(), VehiclePosition{VehicleID: 1, RouteID: 1, ReportedAt: offRouteT0})
+	if err == nil {
+		t.Error("expected error when the incident cannot be stored")
+	}
+}
+
+func TestOffRoute_AlertFailureNonFatal(t *testing.T) {
+	store := newMemDeviationStore()
+	pub := &recordingPublisher{err: errors.New("alerts down")}
+	d := NewOffRouteDetector(&fakeRoutesRepo{distM: 300}, store, WithPersistenceWindow(0), WithAlertPublisher(pub))
+
+	observeAt(t, d, 0)
+
+	if len(store.opened) != 1 {
+		t.Errorf("opened %d incidents, want 1 despite alert failure", len(store.opened))
+	}
+}
+
+// blockingDeviationStore blocks OpenDeviation until release is closed.
+type blockingDeviationStore struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingDeviationStore) OpenDeviation(_ context.Context, _ DeviationIncident) (int32, error) {
+	close(s.entered)
+	<-s.release
+	return 1, nil
+}
+
+func (s *blockingDeviationStore) CloseDeviation(_ context.Context, _ int32, _ time.Time, _ int) error {
+	return nil
+}
+
+func TestOffRoute_SlowStore_DoesNotBlockOtherVehicles(t *testing.T) {
+	store := &blockingDeviationStore{entered: make(chan struct{}), release: make(chan struct{})}
+	d := NewOffRouteDetector(&fakeRoutesRepo{distM: 300}, store, WithPersistenceWindow(time.Minute))
+	defer close(store.release)
+
+	// Vehicle 1 was already off-route for the whole window: opening its
+	// incident blocks in the store.
+	if err := d.Observe(context.Background(), VehiclePosition{VehicleID: 1, RouteID: 1, ReportedAt: offRouteT0}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	go func() {
+		_ = d.Observe(context.Background(), VehiclePosition{VehicleID: 1, RouteID: 1, ReportedAt: offRouteT0.Add(time.Minute)})
+	}()
+	<-store.entered
+
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Observe(context.Background(), VehiclePosition{VehicleID: 2, RouteID: 1, ReportedAt: offRouteT0.Add(time.Minute)})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("vehicle 2: unexpected error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("vehicle 2 waited for the store call of vehicle 1")
+	}
+}
+
+func TestOffRoute_IdleVehicle_EvictedAndIncidentClosed(t *testing.T) {
+	store := newMemDeviationStore()
+	d := NewOffRouteDetector(&fakeRoutesRepo{distM: 300}, store, WithPersistenceWindow(time.Minute))
+
+	observeAt(t, d, 0)
+	observeAt(t, d, time.Minute) // incident 1 opens
+	if len(store.opened) != 1 {
+		t.Fatalf("opened %d incidents, want 1", len(store.opened))
+	}
+
+	// Vehicle 1 stops reporting; vehicle 2 reports well past the window.
+	err := d.Observe(context.Background(), VehiclePosition{VehicleID: 2, RouteID: 1, ReportedAt: offRouteT0.Add(5 * time.Minute)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if closedAt, ok := store.closed[1]; !ok || !closedAt.Equal(offRouteT0.Add(time.Minute)) {
+		t.Errorf("incident 1 closed at %v (%v), want at the last report of vehicle 1", closedAt, ok)
+	}
+	d.mu.Lock()
+	_, tracked := d.vehicles[1]
+	n := len(d.vehicles)
+	d.mu.Unlock()
+	if tracked || n != 1 {
+		t.Errorf("tracked vehicles = %d (vehicle 1 tracked: %v), want only vehicle 2", n, tracked)
+	}
+}
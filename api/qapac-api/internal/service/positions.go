@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+const (
+	// maxPositionClockSkew is how far in the future a report's timestamp may
+	// be. Device clocks drift; anything beyond this is a wrong clock, not
+	// drift.
+	maxPositionClockSkew = time.Minute
+
+	// defaultArrivalRadiusM is how close to a stop of its route a vehicle must
+	// be reported to count as arrived. It covers urban GPS error (~20m) plus
+	// the length of a bus pulled over at the stop, while staying below the
+	// usual 200-300m between consecutive stops.
+	defaultArrivalRadiusM = 50.0
+
+	// arrivalDwell is how long a vehicle reported at the stop it last arrived
+	// at is still on the same visit. Terminal layovers keep reporting from
+	// the stop and must not count as new arrivals; a vehicle parked overnight
+	// next to one must.
+	arrivalDwell = 10 * time.Minute
+)
+
+var (
+	// ErrInvalidPosition is returned by Ingest for a report that cannot be a
+	// real vehicle position.
+	ErrInvalidPosition = errors.New("invalid vehicle position")
+
+	// ErrNoActiveAssignment is returned by Ingest for a registered vehicle
+	// that is not assigned to any route at the time of the report.
+	ErrNoActiveAssignment = errors.New("vehicle has no active assignment")
+
+	// ErrShiftNotInProgress is returned by Ingest for a vehicle whose
+	// assignment at the time of the report was not started by its driver, or
+	// was already ended.
+	ErrShiftNotInProgress = errors.New("vehicle shift not in progress")
+)
+
+// PositionService ingests vehicle position reports and feeds them to the
+// consumers of live positions: the off-route detector and, when enabled, the
+// stop arrival log behind the headway reports.
+type PositionService struct {
+	vehicles       storage.VehiclesRepository
+	detector       *OffRouteDetector
+	arrivals       storage.HeadwaysRepository // optional; nil disables arrival detection
+	arrivalRadiusM float64
+	now            func() time.Time
+	logf           func(format string, args ...any)
+
+	mu     sync.Mutex
+	visits map[int32]stopVisit // last stop each vehicle arrived at
+}
+
+// stopVisit is the stop a vehicle last arrived at.
+type stopVisit struct {
+	routeID int32
+	stopID  int32
+	// seen is the latest report of the vehicle at the stop.
+	seen time.Time
+}
+
+// PositionOption configures a PositionService.
+type PositionOption func(*PositionService)
+
+// WithPositionLogger sets the logger for consumer failures, which do not
+// reject the report. By default they are discarded.
+func WithPositionLogger(l func(format string, args ...any)) PositionOption {
+	return func(s *PositionService) { s.logf = l }
+}
+
+// WithStopArrivals enables arrival detection: each visit of a vehicle to a
+// stop of its route is recorded in repo.
+func WithStopArrivals(repo storage.HeadwaysRepository) PositionOption {
+	return func(s *PositionService) { s.arrivals = repo }
+}
+
+// WithArrivalRadius overrides how close to a stop (metres) a vehicle must be
+// reported to count as arrived.
+func WithArrivalRadius(meters float64) PositionOption {
+	return func(s *PositionService) { s.arrivalRadiusM = meters }
+}
+
+// NewPositionService creates a PositionService that takes the route of each
+// report from the vehicle's assignment in vehicles and feeds detector.
+func NewPositionService(vehicles storage.VehiclesRepository, detector *OffRouteDetector, opts ...PositionOption) *PositionService {
+	s := &PositionService{
+		vehicles:       vehicles,
+		detector:       detector,
+		arrivalRadiusM: defaultArrivalRadiusM,
+		now:            time.Now,
+		visits:         make(map[int32]stopVisit),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Ingest validates a position report, resolves the route the vehicle is
+// serving, passes the report to the off-route detector and records an arrival
+// when the vehicle reaches a stop of that route. A zero ReportedAt means the
+// position was taken now. pos.RouteID is ignored: the route is the one of the
+// vehicle's assignment in effect at ReportedAt.
+//
+// Reports with an invalid vehicle ID or coordinates, or timestamped more than
+// a minute in the future, wrap ErrInvalidPosition. A vehicle that is not
+// registered wraps ErrUnknownVehicle, one without an assignment at ReportedAt
+// wraps ErrNoActiveAssignment, and one whose assignment is not a shift in
+// progress at ReportedAt wraps ErrShiftNotInProgress. Detector and arrival
+// failures are logged: the position itself was valid, and the reporting
+// device cannot do anything about them.
+func (s *PositionService) Ingest(ctx context.Context, pos VehiclePosition) error {
+	now := s.now()
+	if pos.ReportedAt.IsZero() {
+		pos.ReportedAt = now
+	}
+	if err := validatePosition(pos, now); err != nil {
+		return fmt.Errorf("service: Ingest: %w", err)
+	}
+
+	routeID, err := s.activeRoute(ctx, pos.VehicleID, pos.ReportedAt)
+	if err != nil {
+		return fmt.Errorf("service: Ingest: %w", err)
+	}
+	pos.RouteID = routeID
+
+	if err := s.detector.Observe(ctx, pos); err != nil {
+		s.log("positions: vehicle %d: %v", pos.VehicleID, err)
+	}
+	if s.arrivals != nil {
+		if err := s.recordArrival(ctx, pos); err != nil {
+			s.log("positions: vehicle %d: %v", pos.VehicleID, err)
+		}
+	}
+	return nil
+}
+
+// activeRoute returns the route of the assignment of vehicleID in effect at
+// at, provided its shift is in progress. The vehicle itself is only looked up
+// to tell an unknown vehicle from an unassigned one.
+func (s *PositionService) activeRoute(ctx context.Context, vehicleID int32, at time.Time) (int32, error) {
+	a, err := s.vehicles.GetActiveAssignment(ctx, vehicleID, at)
+	if err != nil {
+		return 0, err
+	}
+	if a != nil {
+		if !a.InProgress(at) {
+			return 0, fmt.Errorf("%w: vehicle %d, assignment %d", ErrShiftNotInProgress, vehicleID, a.ID)
+		}
+		return a.RouteID, nil
+	}
+
+	v, err := s.vehicles.GetVehicle(ctx, vehicleID)
+	if err != nil {
+		return 0, err
+	}
+	if v == nil {
+		return 0, fmt.Errorf("%w: %d", ErrUnknownVehicle, vehicleID)
+	}
+	return 0, fmt.Errorf("%w: vehicle %d at %s", ErrNoActiveAssignment, vehicleID, at.Format(time.RFC3339))
+}
+
+// recordArrival records an arrival if pos is at a stop of its route and the
+// vehicle is not still on its visit to that stop.
+func (s *PositionService) recordArrival(ctx context.Context, pos VehiclePosition) error {
+	stopID, found, err := s.arrivals.FindRouteStopNear(ctx, pos.RouteID, pos.Lat, pos.Lon, s.arrivalRadiusM)
+	if err != nil {
+		return fmt.Errorf("positions: find stop: %w", err)
+	}
+	if !found {
+		return nil
+	}
+	if !s.startVisit(pos, stopID) {
+		return nil
+	}
+
+	err = s.arrivals.RecordStopArrival(ctx, storage.StopArrival{
+		RouteID:   pos.RouteID,
+		StopID:    stopID,
+		VehicleID: pos.VehicleID,
+		ArrivedAt: pos.ReportedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("positions: record arrival at stop %d: %w", stopID, err)
+	}
+	return nil
+}
+
+// startVisit reports whether pos, taken at stopID, starts a new visit of the
+// vehicle to that stop, and remembers it as the vehicle's latest visit.
+// Reports older than the latest visit are never a new one.
+func (s *PositionService) startVisit(pos VehiclePosition, stopID int32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last, ok := s.visits[pos.VehicleID]
+	if ok && pos.ReportedAt.Before(last.seen) {
+		return false // out-of-order report
+	}
+	same := ok && last.routeID == pos.RouteID && last.stopID == stopID &&
+		pos.ReportedAt.Sub(last.seen) < arrivalDwell
+	s.visits[pos.VehicleID] = stopVisit{routeID: pos.RouteID, stopID: stopID, seen: pos.ReportedAt}
+	return !same
+}
+
+// validatePosition checks the fields of a report taken at or before now.
+func validatePosition(pos VehiclePosition, now time.Time) error {
+	switch {
+	case pos.VehicleID <= 0:
+		return fmt.Errorf("%w: vehicle ID %d", ErrInvalidPosition, pos.VehicleID)
+	case pos.Lat < -90 || pos.Lat > 90 || pos.Lon < -180 || pos.Lon > 180:
+		return fmt.Errorf("%w: coordinates (%v, %v)", ErrInvalidPosition, pos.Lat, pos.Lon)
+	case pos.ReportedAt.After(now.Add(maxPositionClockSkew)):
+		return fmt.Errorf("%w: reported_at %s is in the future", ErrInvalidPosition, pos.ReportedAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (s *PositionService) log(format string, args ...any) {
+	if s.logf != nil {
+		s.logf(format, args...)
+	}
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+// fakeVehiclesRepo serves the assignments of registered vehicles; only
+// GetVehicle and GetActiveAssignment are used by PositionService.
+type fakeVehiclesRepo struct {
+	storage.VehiclesRepository
+	// routes maps a vehicle to the route it is assigned to; a vehicle mapped
+	// to 0 is registered but unassigned. Shifts are in progress unless the
+	// vehicle is in unstarted.
+	routes    map[int32]int32
+	unstarted map[int32]bool
+	err       error
+}
+
+func (f *fakeVehiclesRepo) GetVehicle(_ context.Context, id int32) (*storage.Vehicle, error) {
+	if _, ok := f.routes[id]; !ok {
+		return nil, nil
+	}
+	return &storage.Vehicle{ID: id, Active: true}, nil
+}
+
+func (f *fakeVehiclesRepo) GetActiveAssignment(_ context.Context, vehicleID int32, at time.Time) (*storage.VehicleAssignment, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	routeID := f.routes[vehicleID]
+	if routeID == 0 {
+		return nil, nil
+	}
+	a := &storage.VehicleAssignment{VehicleID: vehicleID, RouteID: routeID, StartsAt: at.Add(-time.Hour)}
+	if !f.unstarted[vehicleID] {
+		a.StartedAt = &a.StartsAt
+	}
+	return a, nil
+}
+
+// assigned is a fleet where vehicle 1 serves route 1.
+func assigned() *fakeVehiclesRepo {
+	return &fakeVehiclesRepo{routes: map[int32]int32{1: 1}}
+}
+
+// logRecorder collects formatted log lines.
+type logRecorder struct {
+	lines []string
+}
+
+func (l *logRecorder) logf(format string, args ...any) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestPositions_Ingest_FeedsDetector(t *testing.T) {
+	store := newMemDeviationStore()
+	logs := &logRecorder{}
+	d := NewOffRouteDetector(&fakeRoutesRepo{distM: 300}, store,
+		WithPersistenceWindow(0), WithAlertPublisher(NewLogAlertPublisher(logs.logf)))
+	s := NewPositionService(assigned(), d)
+
+	err := s.Ingest(context.Background(), VehiclePosition{
+		VehicleID: 1, Lat: -12.05, Lon: -77.04, ReportedAt: offRouteT0,
+	})
+	if err != nil {
+		t.Fatalf("Ingest: unexpected error: %v", err)
+	}
+	if len(store.opened) != 1 {
+		t.Fatalf("opened %d incidents, want 1", len(store.opened))
+	}
+	if len(logs.lines) != 1 || !strings.Contains(logs.lines[0], "vehicle 1 left route 1") {
+		t.Errorf("alert log = %q, want the new incident", logs.lines)
+	}
+}
+
+func TestPositions_Ingest_DefaultsReportedAtToNow(t *testing.T) {
+	store := newMemDeviationStore()
+	d := NewOffRouteDetector(&fakeRoutesRepo{distM: 300}, store, WithPersistenceWindow(0))
+	s := NewPositionService(assigned(), d)
+	s.now = func() time.Time { return offRouteT0 }
+
+	if err := s.Ingest(context.Background(), VehiclePosition{VehicleID: 1}); err != nil {
+		t.Fatalf("Ingest: unexpected error: %v", err)
+	}
+	if len(store.opened) != 1 || !store.opened[0].OpenedAt.Equal(offRouteT0) {
+		t.Errorf("opened = %+v, want one incident at %s", store.opened, offRouteT0)
+	}
+}
+
+func TestPositions_Ingest_Invalid(t *testing.T) {
+	s := NewPositionService(assigned(), NewOffRouteDetector(&fakeRoutesRepo{}, newMemDeviationStore()))
+	s.now = func() time.Time { return offRouteT0 }
+
+	tests := []VehiclePosition{
+		{VehicleID: 0},
+		{VehicleID: 1, Lat: 91},
+		{VehicleID: 1, Lon: -181},
+		{VehicleID: 1, ReportedAt: offRouteT0.Add(2 * time.Minute)},
+	}
+	for _, pos := range tests {
+		if err := s.Ingest(context.Background(), pos); !errors.Is(err, ErrInvalidPosition) {
+			t.Errorf("Ingest(%+v) = %v, want ErrInvalidPosition", pos, err)
+		}
+	}
+}
+
+func TestPositions_Ingest_DetectorFailureLogged(t *testing.T) {
+	logs := &logRecorder{}
+	d := NewOffRouteDetector(&fakeRoutesRepo{err: errors.New("db down")}, newMemDeviationStore())
+	s := NewPositionService(assigned(), d, WithPositionLogger(logs.logf))
+
+	err := s.Ingest(context.Background(), VehiclePosition{VehicleID: 1, ReportedAt: offRouteT0})
+	if err != nil {
+		t.Fatalf("Ingest: detector failure must not reject the report, got %v", err)
+	}
+	if len(logs.lines) != 1 || !strings.Contains(logs.lines[0], "db down") {
+		t.Errorf("logs = %q, want the detector failure", logs.lines)
+	}
+}
+
+func TestPositions_Ingest_RecordsOneArrivalPerVisit(t *testing.T) {
+	// Stop 5 is at latitude -12.05 and stop 6 at -12.06; -12.055 is between.
+	repo := &fakeHeadwaysRepo{stopsAt: map[float64]int32{-12.05: 5, -12.06: 6}}
+	d := NewOffRouteDetector(&fakeRoutesRepo{}, newMemDeviationStore())
+	s := NewPositionService(assigned(), d, WithStopArrivals(repo))
+
+	reports := []struct {
+		lat    float64
+		offset time.Duration
+	}{
+		{-12.05, 0},                // arrives at 5
+		{-12.05, 30 * time.Second}, // still at 5
+		{-12.055, time.Minute},     // between stops
+		{-12.06, 2 * time.Minute},  // arrives at 6
+		{-12.05, time.Minute},      // out of order: ignored
+		{-12.06, 20 * time.Minute}, // parked at 6 past the dwell: new visit
+	}
+	for _, r := range reports {
+		err := s.Ingest(context.Background(), VehiclePosition{
+			VehicleID: 1, Lat: r.lat, Lon: -77.04, ReportedAt: offRouteT0.Add(r.offset),
+		})
+		if err != nil {
+			t.Fatalf("Ingest(%v, +%s): unexpected error: %v", r.lat, r.offset, err)
+		}
+	}
+
+	want := []struct {
+		stop   int32
+		offset time.Duration
+	}{{5, 0}, {6, 2 * time.Minute}, {6, 20 * time.Minute}}
+	if len(repo.arrivals) != len(want) {
+		t.Fatalf("recorded %d arrivals, want %d: %+v", len(repo.arrivals), len(want), repo.arrivals)
+	}
+	for i, w := range want {
+		a := repo.arrivals[i]
+		if a.StopID != w.stop || a.VehicleID != 1 || a.RouteID != 1 || !a.ArrivedAt.Equal(offRouteT0.Add(w.offset)) {
+			t.Errorf("arrival %d = %+v, want stop %d at +%s", i, a, w.stop, w.offset)
+		}
+	}
+}
+
+func TestPositions_Ingest_RouteFromActiveAssignment(t *testing.T) {
+	store := newMemDeviationStore()
+	d := NewOffRouteDetector(&fakeRoutesRepo{distM: 300}, store, WithPersistenceWindow(0))
+	s := NewPositionService(&fakeVehiclesRepo{routes: map[int32]int32{1: 7}}, d)
+
+	// The route in the report is not trusted.
+	err := s.Ingest(context.Background(), VehiclePosition{VehicleID: 1, RouteID: 2, ReportedAt: offRouteT0})
+	if err != nil {
+		t.Fatalf("Ingest: unexpected error: %v", err)
+	}
+	if len(store.opened) != 1 || store.opened[0].RouteID != 7 {
+		t.Errorf("opened = %+v, want one incident on route 7", store.opened)
+	}
+}
+
+func TestPositions_Ingest_RejectsVehiclesOutOfShift(t *testing.T) {
+	store := newMemDeviationStore()
+	d := NewOffRouteDetector(&fakeRoutesRepo{distM: 300}, store, WithPersistenceWindow(0))
+	s := NewPositionService(&fakeVehiclesRepo{routes: map[int32]int32{2: 0}}, d)
+
+	err := s.Ingest(context.Background(), VehiclePosition{VehicleID: 2, ReportedAt: offRouteT0})
+	if !errors.Is(err, ErrNoActiveAssignment) {
+		t.Errorf("unassigned vehicle: err = %v, want ErrNoActiveAssignment", err)
+	}
+	err = s.Ingest(context.Background(), VehiclePosition{VehicleID: 3, ReportedAt: offRouteT0})
+	if !errors.Is(err, ErrUnknownVehicle) {
+		t.Errorf("unknown vehicle: err = %v, want ErrUnknownVehicle", err)
+	}
+
+	// Assigned, but the driver has not started the shift.
+	s = NewPositionService(&fakeVehiclesRepo{routes: map[int32]int32{4: 1}, unstarted: map[int32]bool{4: true}}, d)
+	err = s.Ingest(context.Background(), VehiclePosition{VehicleID: 4, ReportedAt: offRouteT0})
+	if !errors.Is(err, ErrShiftNotInProgress) {
+		t.Errorf("unstarted shift: err = %v, want ErrShiftNotInProgress", err)
+	}
+	if len(store.opened) != 0 {
+		t.Errorf("opened = %+v, want none: rejected reports must not reach the detector", store.opened)
+	}
+
+	s = NewPositionService(&fakeVehiclesRepo{err: errors.New("db down")}, d)
+	err = s.Ingest(context.Background(), VehiclePosition{VehicleID: 1, ReportedAt: offRouteT0})
+	if err == nil || errors.Is(err, ErrNoActiveAssignment) {
+		t.Errorf("lookup failure: err = %v, want a storage error", err)
+	}
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+const (
+	// minRatingsForScore is how many visible ratings a driver, collector or
+	// route needs before its average is published: with fewer, one angry
+	// rider decides the score.
+	minRatingsForScore = 5
+
+	// maxRatingComment is the longest comment, in characters, a rating may
+	// carry.
+	maxRatingComment = 500
+)
+
+var (
+	// ErrInvalidRating is returned for a rating whose stars, comment or tags
+	// are out of range, or for an unknown moderation status.
+	ErrInvalidRating = errors.New("invalid rating")
+
+	// ErrTripNotCompleted is returned by Rate for a trip that is still in
+	// progress or was abandoned.
+	ErrTripNotCompleted = errors.New("trip is not completed")
+)
+
+// ratingTags are the tags a rating may carry.
+var ratingTags = []string{
+	storage.RatingTagCleanliness,
+	storage.RatingTagCourtesy,
+	storage.RatingTagDriving,
+	storage.RatingTagOvercharging,
+}
+
+// RatingScore is the published score of a driver, collector or route.
+type RatingScore struct {
+	Ratings      int
+	AverageStars *float64       // nil below minRatingsForScore ratings
+	Tags         map[string]int // empty below minRatingsForScore ratings
+}
+
+// RatingService records the ratings riders give to their completed trips,
+// publishes the scores of drivers, collectors and routes, and lets operators
+// moderate them.
+type RatingService struct {
+	ratings  storage.RatingsRepository
+	trips    storage.TripsRepository
+	vehicles storage.VehiclesRepository
+}
+
+// NewRatingService creates a RatingService storing ratings in ratings, of the
+// trips in trips, and resolving crews from the assignments in vehicles.
+func NewRatingService(ratings storage.RatingsRepository, trips storage.TripsRepository, vehicles storage.VehiclesRepository) *RatingService {
+	return &RatingService{ratings: ratings, trips: trips, vehicles: vehicles}
+}
+
+// Rate stores r as the rating of trip tripID of deviceID. Only r.Stars,
+// r.Comment and r.Tags are read: the route and vehicle are those of the
+// trip, and the driver and collector those of the shift the vehicle was on,
+// on the trip's route, when the trip was boarded.
+// Returns (nil, nil) when the device has no such trip.
+//
+// Errors:
+//   - ErrInvalidRating (wrapped) when the stars are not 1 to 5, the comment
+//     is too long, or a tag is unknown.
+//   - ErrTripNotCompleted (wrapped) when the trip is in progress or was
+//     abandoned.
+//   - storage.ErrConflict (wrapped) when the trip is already rated.
+func (s *RatingService) Rate(ctx context.Context, deviceID string, tripID int32, r storage.Rating) (*storage.Rating, error) {
+	tags, err := validateRating(r)
+	if err != nil {
+		return nil, fmt.Errorf("service: Rate: %w", err)
+	}
+
+	trip, err := s.trips.GetTrip(ctx, deviceID, tripID)
+	if err != nil {
+		return nil, fmt.Errorf("service: Rate: %w", err)
+	}
+	if trip == nil {
+		return nil, nil
+	}
+	if TripStatus(*trip, time.Now()) != TripCompleted {
+		return nil, fmt.Errorf("service: Rate: %w: trip %d", ErrTripNotCompleted, tripID)
+	}
+
+	rating := storage.Rating{
+		TripID:    trip.ID,
+		RouteID:   trip.RouteID,
+		VehicleID: trip.VehicleID,
+		Stars:     r.Stars,
+		Comment:   r.Comment,
+		Tags:      tags,
+	}
+	if trip.VehicleID != nil {
+		a, err := s.vehicles.GetActiveAssignment(ctx, *trip.VehicleID, trip.BoardedAt)
+		if err != nil {
+			return nil, fmt.Errorf("service: Rate: %w", err)
+		}
+		// A vehicle that was not on a shift of the trip's route does not tell
+		// who drove it.
+		if a != nil && a.RouteID == trip.RouteID && a.InProgress(trip.BoardedAt) {
+			rating.AssignmentID = &a.ID
+			rating.DriverID = a.DriverID
+			rating.CollectorID = a.CollectorID
+		}
+	}
+
+	created, err := s.ratings.CreateRating(ctx, rating)
+	if err != nil {
+		return nil, fmt.Errorf("service: Rate: %w", err)
+	}
+	return created, nil
+}
+
+// Score returns the published score of the driver, collector or route (see
+// the storage.RatingSubject constants) with the given ID. Hidden ratings do
+// not count.
+func (s *RatingService) Score(ctx context.Context, subject string, id int32) (*RatingScore, error) {
+	agg, err := s.ratings.GetRatingAggregate(ctx, subject, id)
+	if err != nil {
+		return nil, fmt.Errorf("service: Score: %w", err)
+	}
+	score := &RatingScore{Ratings: agg.Ratings, Tags: map[string]int{}}
+	if agg.Ratings >= minRatingsForScore {
+		avg := agg.AverageStars
+		score.AverageStars = &avg
+		score.Tags = agg.Tags
+	}
+	return score, nil
+}
+
+// List returns up to limit ratings with the given status (empty for every
+// status), most recent first, with an ID below beforeID (0 for the most
+// recent rating).
+//
+// Errors:
+//   - ErrInvalidRating (wrapped) for an unknown status.
+func (s *RatingService) List(ctx context.Context, status string, beforeID int32, limit int) ([]storage.Rating, error) {
+	if status != "" && !validRatingStatus(status) {
+		return nil, fmt.Errorf("service: List: %w: status %q", ErrInvalidRating, status)
+	}
+	ratings, err := s.ratings.ListRatings(ctx, status, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("service: List: %w", err)
+	}
+	return ratings, nil
+}
+
+// Moderate sets the status of rating id; a hidden rating leaves every score.
+// Returns (nil, nil) when the rating does not exist.
+//
+// Errors:
+//   - ErrInvalidRating (wrapped) for an unknown status.
+func (s *RatingService) Moderate(ctx context.Context, id int32, status string) (*storage.Rating, error) {
+	if !validRatingStatus(status) {
+		return nil, fmt.Errorf("service: Moderate: %w: status %q", ErrInvalidRating, status)
+	}
+	rating, err := s.ratings.SetRatingStatus(ctx, id, status)
+	if err != nil {
+		return nil, fmt.Errorf("service: Moderate: %w", err)
+	}
+	return rating, nil
+}
+
+// validateRating checks the rider-supplied fields of r and returns its tags
+// sorted and without duplicates.
+func validateRating(r storage.Rating) ([]string, error) {
+	switch {
+	case r.Stars < 1 || r.Stars > 5:
+		return nil, fmt.Errorf("%w: stars must be between 1 and 5", ErrInvalidRating)
+	case utf8.RuneCountInString(r.Comment) > maxRatingComment:
+		return nil, fmt.Errorf("%w: comment longer than %d characters", ErrInvalidRating, maxRatingComment)
+	}
+	tags := slices.Clone(r.Tags)
+	slices.Sort(tags)
+	tags = slices.Compact(tags)
+	for _, tag := range tags {
+		if !slices.Contains(ratingTags, tag) {
+			return nil, fmt.Errorf("%w: unknown tag %q", ErrInvalidRating, tag)
+		}
+	}
+	return tags, nil
+}
+
+func validRatingStatus(status string) bool {
+	return status == storage.RatingVisible || status == storage.RatingHidden
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+// memRatingsRepo is an in-memory storage.RatingsRepository whose aggregate
+// is fixed.
+type memRatingsRepo struct {
+	ratings []storage.Rating
+	agg     storage.RatingAggregate
+}
+
+func (m *memRatingsRepo) CreateRating(_ context.Context, r storage.Rating) (*storage.Rating, error) {
+	for _, existing := range m.ratings {
+		if existing.TripID == r.TripID {
+			return nil, storage.ErrConflict
+		}
+	}
+	r.ID = int32(len(m.ratings) + 1)
+	r.Status = storage.RatingVisible
+	m.ratings = append(m.ratings, r)
+	return &r, nil
+}
+
+func (m *memRatingsRepo) ListRatings(_ context.Context, _ string, _ int32, _ int) ([]storage.Rating, error) {
+	return m.ratings, nil
+}
+
+func (m *memRatingsRepo) SetRatingStatus(_ context.Context, id int32, status string) (*storage.Rating, error) {
+	for i := range m.ratings {
+		if m.ratings[i].ID == id {
+			m.ratings[i].Status = status
+			return &m.ratings[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memRatingsRepo) GetRatingAggregate(_ context.Context, _ string, _ int32) (*storage.RatingAggregate, error) {
+	agg := m.agg
+	return &agg, nil
+}
+
+// crewVehiclesRepo answers GetActiveAssignment with a single assignment.
+type crewVehiclesRepo struct {
+	storage.VehiclesRepository
+	assignment storage.VehicleAssignment
+}
+
+func (c *crewVehiclesRepo) GetActiveAssignment(_ context.Context, vehicleID int32, _ time.Time) (*storage.VehicleAssignment, error) {
+	if vehicleID != c.assignment.VehicleID {
+		return nil, nil
+	}
+	a := c.assignment
+	return &a, nil
+}
+
+// newTestRatingService rates the trips of repo. Vehicle 7 is on a shift of
+// route 1 with driver 40 and collector 41, started two hours before tripsNow.
+func newTestRatingService(trips *memTripsRepo) (*RatingService, *memRatingsRepo) {
+	started := tripsNow.Add(-2 * time.Hour)
+	vehicles := &crewVehiclesRepo{assignment: storage.VehicleAssignment{
+		ID: 3, VehicleID: 7, RouteID: 1, DriverID: int32Ref(40), CollectorID: int32Ref(41),
+		StartsAt: started, StartedAt: &started,
+	}}
+	ratings := &memRatingsRepo{}
+	return NewRatingService(ratings, trips, vehicles), ratings
+}
+
+func TestRatings_Rate_CopiesTripAndCrew(t *testing.T) {
+	onVehicle := manualTrip(1)
+	onVehicle.ID, onVehicle.VehicleID = 1, int32Ref(7)
+	otherRoute := manualTrip(2)
+	otherRoute.ID, otherRoute.VehicleID = 2, int32Ref(7)
+	s, _ := newTestRatingService(&memTripsRepo{trips: []storage.RiderTrip{onVehicle, otherRoute}})
+	ctx := context.Background()
+
+	got, err := s.Rate(ctx, "abc12345", 1, storage.Rating{Stars: 4, Tags: []string{"courtesy", "driving", "courtesy"}})
+	if err != nil {
+		t.Fatalf("Rate: unexpected error: %v", err)
+	}
+	if got.RouteID != 1 || got.VehicleID == nil || *got.VehicleID != 7 ||
+		got.AssignmentID == nil || *got.AssignmentID != 3 ||
+		got.DriverID == nil || *got.DriverID != 40 || got.CollectorID == nil || *got.CollectorID != 41 {
+		t.Errorf("rating = %+v, want route 1, vehicle 7 and the crew of assignment 3", got)
+	}
+	if strings.Join(got.Tags, ",") != "courtesy,driving" {
+		t.Errorf("tags = %v, want [courtesy driving]", got.Tags)
+	}
+
+	// The vehicle was on route 1, not on the route of the trip: no crew.
+	got, err = s.Rate(ctx, "abc12345", 2, storage.Rating{Stars: 2})
+	if err != nil {
+		t.Fatalf("Rate: unexpected error: %v", err)
+	}
+	if got.AssignmentID != nil || got.DriverID != nil || got.CollectorID != nil {
+		t.Errorf("rating = %+v, want no crew", got)
+	}
+}
+
+func TestRatings_Rate_Rejects(t *testing.T) {
+	done := manualTrip(1)
+	done.ID = 1
+	open := storage.RiderTrip{ID: 2, DeviceID: "abc12345", RouteID: 1, BoardingStopID: 1, BoardedAt: time.Now()}
+	s, _ := newTestRatingService(&memTripsRepo{trips: []storage.RiderTrip{done, open}})
+	ctx := context.Background()
+
+	for name, r := range map[string]storage.Rating{
+		"no stars":      {},
+		"six stars":     {Stars: 6},
+		"long comment":  {Stars: 3, Comment: strings.Repeat("á", maxRatingComment+1)},
+		"unknown tag":   {Stars: 3, Tags: []string{"music"}},
+		"tag with case": {Stars: 3, Tags: []string{"Driving"}},
+	} {
+		if _, err := s.Rate(ctx, "abc12345", 1, r); !errors.Is(err, ErrInvalidRating) {
+			t.Errorf("%s: err = %v, want ErrInvalidRating", name, err)
+		}
+	}
+	if got, err := s.Rate(ctx, "other123", 1, storage.Rating{Stars: 3}); got != nil || err != nil {
+		t.Errorf("trip of another device = %+v, %v; want nil, nil", got, err)
+	}
+	if _, err := s.Rate(ctx, "abc12345", 2, storage.Rating{Stars: 3}); !errors.Is(err, ErrTripNotCompleted) {
+		t.Errorf("open trip: err = %v, want ErrTripNotCompleted", err)
+	}
+	if _, err := s.Rate(ctx, "abc12345", 1, storage.Rating{Stars: 3, Comment: strings.Repeat("á", maxRatingComment)}); err != nil {
+		t.Fatalf("first rating: unexpected error: %v", err)
+	}
+	if _, err := s.Rate(ctx, "abc12345", 1, storage.Rating{Stars: 5}); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("second rating: err = %v, want storage.ErrConflict", err)
+	}
+}
+
+func TestRatings_Score_NeedsEnoughRatings(t *testing.T) {
+	s, repo := newTestRatingService(&memTripsRepo{})
+	ctx := context.Background()
+
+	repo.agg = storage.RatingAggregate{Ratings: minRatingsForScore - 1, AverageStars: 1, Tags: map[string]int{"driving": 4}}
+	got, err := s.Score(ctx, storage.RatingSubjectDriver, 40)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Ratings != minRatingsForScore-1 || got.AverageStars != nil || len(got.Tags) != 0 {
+		t.Errorf("score = %+v, want the count only", got)
+	}
+
+	repo.agg.Ratings = minRatingsForScore
+	got, err = s.Score(ctx, storage.RatingSubjectDriver, 40)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.AverageStars == nil || *got.AverageStars != 1 || got.Tags["driving"] != 4 {
+		t.Errorf("score = %+v, want average 1 and 4 driving tags", got)
+	}
+}
+
+func TestRatings_Moderate(t *testing.T) {
+	s, repo := newTestRatingService(&memTripsRepo{})
+	repo.ratings = []storage.Rating{{ID: 1, Stars: 1, Status: storage.RatingVisible}}
+	ctx := context.Background()
+
+	got, err := s.Moderate(ctx, 1, storage.RatingHidden)
+	if err != nil || got == nil || got.Status != storage.RatingHidden {
+		t.Errorf("Moderate = %+v, %v; want the hidden rating", got, err)
+	}
+	if got, err := s.Moderate(ctx, 9, storage.RatingHidden); got != nil || err != nil {
+		t.Errorf("unknown rating = %+v, %v; want nil, nil", got, err)
+	}
+	if _, err := s.Moderate(ctx, 1, "deleted"); !errors.Is(err, ErrInvalidRating) {
+		t.Errorf("unknown status: err = %v, want ErrInvalidRating", err)
+	}
+	if _, err := s.List(ctx, "deleted", 0, 20); !errors.Is(err, ErrInvalidRating) {
+		t.Errorf("List unknown status: err = %v, want ErrInvalidRating", err)
+	}
+}
@@ -14,6 +14,16 @@ import (
 // other errors.
 var ErrStopNotFound = errors.New("stop not found")
 
+// RouteOptions selects how GetRouteTo calculates a route.
+type RouteOptions struct {
+	// Mode is the travel mode; the zero value is walking.
+	Mode routing.TravelMode
+	// Steps asks for turn-by-turn instructions.
+	Steps bool
+	// Alternatives asks for alternate routes.
+	Alternatives bool
+}
+
 // RoutingService orchestrates route lookups from a user's location to a transit stop.
 // It uses a CachedRouter to minimise Google API calls.
 type RoutingService struct {
@@ -23,7 +33,7 @@ type RoutingService struct {
 
 // NewRoutingService creates a RoutingService.
 //
-//   - router should be a *routing.CachedRouter wrapping a *routing.GoogleRouter for
+//   - router should be a *routing.CachedRouter wrapping a *routing.ChainRouter for
 //     production use, or any Router implementation for testing.
 //   - stopsRepo is used to look up the stop's geographic coordinates by ID.
 func NewRoutingService(router routing.Router, stopsRepo storage.StopsRepository) *RoutingService {
@@ -34,12 +44,12 @@ func NewRoutingService(router routing.Router, stopsRepo storage.StopsRepository)
 }
 
 // GetRouteTo calculates the route from (userLat, userLon) to the stop identified by
-// stopID and returns the routing result.
+// stopID, as selected by opts, and returns the routing result.
 //
 // Errors:
 //   - Returns ErrStopNotFound (wrapped) if the stop does not exist.
 //   - Returns a descriptive error if the underlying Router fails.
-func (s *RoutingService) GetRouteTo(ctx context.Context, userLat, userLon float64, stopID int32) (*routing.RoutingResponse, error) {
+func (s *RoutingService) GetRouteTo(ctx context.Context, userLat, userLon float64, stopID int32, opts RouteOptions) (*routing.RoutingResponse, error) {
 	stop, err := s.stopsRepo.GetStop(ctx, stopID)
 	if err != nil {
 		return nil, fmt.Errorf("service: GetRouteTo: fetch stop %d: %w", stopID, err)
@@ -57,6 +67,9 @@ func (s *RoutingService) GetRouteTo(ctx context.Context, userLat, userLon float6
 		OriginLon:      userLon,
 		DestinationLat: stop.Lat,
 		DestinationLon: stop.Lon,
+		Mode:           opts.Mode,
+		Steps:          opts.Steps,
+		Alternatives:   opts.Alternatives,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("service: GetRouteTo: route to stop %d: %w", stopID, err)
@@ -16,7 +16,19 @@ type mockStopsRepo struct {
 	err  error
 }
 
-func (m *mockStopsRepo) FindStopsNear(_ context.Context, _, _, _ float64) ([]storage.Stop, error) {
+func (m *mockStopsRepo) FindStopsNear(_ context.Context, _, _, _ float64) ([]storage.NearbyStop, error) {
+	return nil, nil
+}
+
+func (m *mockStopsRepo) ListRoutesServingStops(_ context.Context, _ []int32) (map[int32][]storage.StopRoute, error) {
+	return nil, nil
+}
+
+func (m *mockStopsRepo) ListStopsInBBox(_ context.Context, _ storage.BBox, _ float64, _ int32, _ int) ([]storage.Stop, error) {
+	return nil, nil
+}
+
+func (m *mockStopsRepo) SearchStops(_ context.Context, _ storage.StopSearch) ([]storage.StopMatch, error) {
 	return nil, nil
 }
 
@@ -44,7 +56,7 @@ func TestRoutingService_GetRouteTo_StopNotFound(t *testing.T) {
 		&mockRouter{resp: &routing.RoutingResponse{}},
 		&mockStopsRepo{stop: nil, err: nil},
 	)
-	_, err := svc.GetRouteTo(context.Background(), -12.0464, -77.0428, 99)
+	_, err := svc.GetRouteTo(context.Background(), -12.0464, -77.0428, 99, RouteOptions{})
 	if err == nil {
 		t.Fatal("expected error when stop not found, got nil")
 	}
@@ -55,7 +67,7 @@ func TestRoutingService_GetRouteTo_StopFetchError(t *testing.T) {
 		&mockRouter{resp: &routing.RoutingResponse{}},
 		&mockStopsRepo{stop: nil, err: errors.New("db error")},
 	)
-	_, err := svc.GetRouteTo(context.Background(), -12.0464, -77.0428, 1)
+	_, err := svc.GetRouteTo(context.Background(), -12.0464, -77.0428, 1, RouteOptions{})
 	if err == nil {
 		t.Fatal("expected error on store failure, got nil")
 	}
@@ -68,7 +80,7 @@ func TestRoutingService_GetRouteTo_Success(t *testing.T) {
 	inner := &mockRouter{resp: routerResp}
 	svc := NewRoutingService(inner, &mockStopsRepo{stop: stop})
 
-	got, err := svc.GetRouteTo(context.Background(), -12.0464, -77.0428, 5)
+	got, err := svc.GetRouteTo(context.Background(), -12.0464, -77.0428, 5, RouteOptions{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -88,7 +100,7 @@ func TestRoutingService_GetRouteTo_RouterError(t *testing.T) {
 	inner := &mockRouter{err: errors.New("google unreachable")}
 	svc := NewRoutingService(inner, &mockStopsRepo{stop: stop})
 
-	_, err := svc.GetRouteTo(context.Background(), -12.0464, -77.0428, 5)
+	_, err := svc.GetRouteTo(context.Background(), -12.0464, -77.0428, 5, RouteOptions{})
 	if err == nil {
 		t.Fatal("expected error when router fails, got nil")
 	}
@@ -106,7 +118,7 @@ func TestRoutingService_GetRouteTo_StopIDInContext(t *testing.T) {
 	}}
 
 	svc := NewRoutingService(spy, &mockStopsRepo{stop: stop})
-	_, err := svc.GetRouteTo(context.Background(), -12.0464, -77.0428, 7)
+	_, err := svc.GetRouteTo(context.Background(), -12.0464, -77.0428, 7, RouteOptions{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+const (
+	// MaxTileZoom is the deepest zoom level served. Mapbox GL over-zooms
+	// beyond it.
+	MaxTileZoom = 20
+
+	// minRouteTileZoom is the first zoom level with route shapes: below it the
+	// whole metropolitan network fits in a few pixels.
+	minRouteTileZoom = 9
+
+	// minStopTileZoom is the first zoom level with stops. Below street level
+	// there are too many to tell apart.
+	minStopTileZoom = 14
+
+	// defaultTileCacheBytes bounds the memory used by cached tiles. A
+	// street-level tile of central Lima is a few KB.
+	defaultTileCacheBytes = 64 << 20
+
+	// tileEntryOverhead approximates the bookkeeping cost of a cache entry so
+	// that empty tiles also count toward the budget.
+	tileEntryOverhead = 64
+
+	// tileVersionCheckInterval is how often the network version is read.
+	// Edits show up on the map at most this late.
+	tileVersionCheckInterval = 5 * time.Second
+)
+
+// Tile is an encoded Mapbox Vector Tile.
+type Tile struct {
+	// Data is empty when the tile has no features.
+	Data []byte
+	// Version is the network version the tile was rendered from.
+	Version int64
+}
+
+type tileKey struct{ z, x, y int }
+
+type tileEntry struct {
+	key  tileKey
+	tile Tile
+}
+
+// TileService renders vector tiles of the network and keeps the most recently
+// used ones in memory. The cache is dropped whenever the network version (see
+// 010_network_version.sql) changes.
+type TileService struct {
+	repo       storage.TilesRepository
+	maxBytes   int
+	checkEvery time.Duration
+	now        func() time.Time
+
+	mu        sync.Mutex
+	version   int64
+	checkedAt time.Time
+	entries   map[tileKey]*list.Element
+	lru       *list.List // front = most recently used
+	bytes     int
+}
+
+// TileOption configures a TileService.
+type TileOption func(*TileService)
+
+// WithTileCacheBytes overrides the memory budget of the tile cache.
+func WithTileCacheBytes(n int) TileOption {
+	return func(s *TileService) { s.maxBytes = n }
+}
+
+// NewTileService creates a TileService backed by repo.
+func NewTileService(repo storage.TilesRepository, opts ...TileOption) *TileService {
+	s := &TileService{
+		repo:       repo,
+		maxBytes:   defaultTileCacheBytes,
+		checkEvery: tileVersionCheckInterval,
+		now:        time.Now,
+		entries:    make(map[tileKey]*list.Element),
+		lru:        list.New(),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// GetTile returns tile z/x/y. Route shapes appear from zoom 9 and stops from
+// zoom 14; shallower tiles are empty. The caller validates the coordinates.
+func (s *TileService) GetTile(ctx context.Context, z, x, y int) (*Tile, error) {
+	version, err := s.currentVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if z < minRouteTileZoom {
+		return &Tile{Version: version}, nil
+	}
+
+	key := tileKey{z, x, y}
+	if t, ok := s.lookup(key, version); ok {
+		return t, nil
+	}
+
+	data, err := s.repo.GetTile(ctx, z, x, y, z >= minStopTileZoom)
+	if err != nil {
+		return nil, fmt.Errorf("service: GetTile: %w", err)
+	}
+	t := Tile{Data: data, Version: version}
+	s.store(key, t)
+	return &t, nil
+}
+
+// currentVersion returns the network version, reading it from the database
+// at most once per checkEvery. A new version empties the cache.
+func (s *TileService) currentVersion(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	if !s.checkedAt.IsZero() && s.now().Sub(s.checkedAt) < s.checkEvery {
+		v := s.version
+		s.mu.Unlock()
+		return v, nil
+	}
+	s.mu.Unlock()
+
+	v, err := s.repo.GetNetworkVersion(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("service: GetTile: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v != s.version {
+		s.version = v
+		s.entries = make(map[tileKey]*list.Element)
+		s.lru.Init()
+		s.bytes = 0
+	}
+	s.checkedAt = s.now()
+	return v, nil
+}
+
+// lookup returns the cached tile for key if it was rendered from version.
+func (s *TileService) lookup(key tileKey, version int64) (*Tile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*tileEntry)
+	if e.tile.Version != version {
+		return nil, false
+	}
+	s.lru.MoveToFront(el)
+	t := e.tile
+	return &t, true
+}
+
+// store caches t, evicting the least recently used tiles over the budget.
+// Tiles rendered from a version that has since been replaced are dropped.
+func (s *TileService) store(key tileKey, t Tile) {
+	size := len(t.Data) + tileEntryOverhead
+	if size > s.maxBytes {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t.Version != s.version {
+		return
+	}
+	if el, ok := s.entries[key]; ok {
+		s.removeElement(el)
+	}
+	s.entries[key] = s.lru.PushFront(&tileEntry{key: key, tile: t})
+	s.bytes += size
+	for s.bytes > s.maxBytes {
+		s.removeElement(s.lru.Back())
+	}
+}
+
+func (s *TileService) removeElement(el *list.Element) {
+	e := s.lru.Remove(el).(*tileEntry)
+	delete(s.entries, e.key)
+	s.bytes -= len(e.tile.Data) + tileEntryOverhead
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// mockTilesRepo renders 100-byte tiles and records every render.
+type mockTilesRepo struct {
+	version    int64
+	versionErr error
+	renders    []tileKey
+	withStops  []bool
+}
+
+func (m *mockTilesRepo) GetNetworkVersion(_ context.Context) (int64, error) {
+	return m.version, m.versionErr
+}
+
+func (m *mockTilesRepo) GetTile(_ context.Context, z, x, y int, withStops bool) ([]byte, error) {
+	m.renders = append(m.renders, tileKey{z, x, y})
+	m.withStops = append(m.withStops, withStops)
+	return make([]byte, 100), nil
+}
+
+func newTestTileService(repo *mockTilesRepo, clock *time.Time, opts ...TileOption) *TileService {
+	s := NewTileService(repo, opts...)
+	s.now = func() time.Time { return *clock }
+	return s
+}
+
+func TestTileService_ZoomLevels(t *testing.T) {
+	repo := &mockTilesRepo{version: 1}
+	now := time.Now()
+	s := newTestTileService(repo, &now)
+
+	tile, err := s.GetTile(context.Background(), 5, 9, 16)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tile.Data) != 0 || len(repo.renders) != 0 {
+		t.Errorf("zoom 5: data=%d renders=%d, want an empty tile without rendering", len(tile.Data), len(repo.renders))
+	}
+
+	for _, z := range []int{12, 15} {
+		if _, err := s.GetTile(context.Background(), z, 0, 0); err != nil {
+			t.Fatalf("zoom %d: unexpected error: %v", z, err)
+		}
+	}
+	if len(repo.withStops) != 2 || repo.withStops[0] || !repo.withStops[1] {
+		t.Errorf("withStops = %v, want [false true]", repo.withStops)
+	}
+}
+
+func TestTileService_CachesUntilVersionChanges(t *testing.T) {
+	repo := &mockTilesRepo{version: 1}
+	now := time.Now()
+	s := newTestTileService(repo, &now)
+	ctx := context.Background()
+
+	for range 3 {
+		if _, err := s.GetTile(ctx, 15, 9400, 17000); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(repo.renders) != 1 {
+		t.Fatalf("renders = %d, want 1", len(repo.renders))
+	}
+
+	// An edit is not seen until the next version check.
+	repo.version = 2
+	tile, _ := s.GetTile(ctx, 15, 9400, 17000)
+	if tile.Version != 1 || len(repo.renders) != 1 {
+		t.Errorf("before check: version=%d renders=%d, want 1, 1", tile.Version, len(repo.renders))
+	}
+
+	now = now.Add(tileVersionCheckInterval)
+	tile, _ = s.GetTile(ctx, 15, 9400, 17000)
+	if tile.Version != 2 || len(repo.renders) != 2 {
+		t.Errorf("after check: version=%d renders=%d, want 2, 2", tile.Version, len(repo.renders))
+	}
+}
+
+func TestTileService_EvictsLeastRecentlyUsed(t *testing.T) {
+	repo := &mockTilesRepo{version: 1}
+	now := time.Now()
+	// Room for two 100-byte tiles.
+	s := newTestTileService(repo, &now, WithTileCacheBytes(2*(100+tileEntryOverhead)))
+	ctx := context.Background()
+
+	for _, x := range []int{1, 2, 1, 3} {
+		if _, err := s.GetTile(ctx, 15, x, 0); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// Tile 2 was the least recently used when tile 3 arrived.
+	_, _ = s.GetTile(ctx, 15, 1, 0)
+	_, _ = s.GetTile(ctx, 15, 2, 0)
+
+	want := []int{1, 2, 3, 2}
+	if len(repo.renders) != len(want) {
+		t.Fatalf("renders = %v, want x = %v", repo.renders, want)
+	}
+	for i, k := range repo.renders {
+		if k.x != want[i] {
+			t.Errorf("render %d: x = %d, want %d", i, k.x, want[i])
+		}
+	}
+}
+
+func TestTileService_VersionError(t *testing.T) {
+	repo := &mockTilesRepo{versionErr: errors.New("db down")}
+	now := time.Now()
+	s := newTestTileService(repo, &now)
+
+	if _, err := s.GetTile(context.Background(), 15, 0, 0); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+const (
+	// checkinExpiry is how long after boarding a check-in stays open. Lima's
+	// longest routes take about two hours end to end; a check-in still open
+	// after three was abandoned (the app was closed, the phone died) and is
+	// closed without an alighting stop.
+	checkinExpiry = 3 * time.Hour
+
+	// maxTripClockSkew is how far in the future a manually entered trip may
+	// end, to tolerate the clock of the rider's phone.
+	maxTripClockSkew = time.Minute
+)
+
+// Trip statuses, derived from a trip and the current time.
+const (
+	TripInProgress = "in_progress"
+	TripCompleted  = "completed"
+	TripAbandoned  = "abandoned"
+)
+
+var (
+	// ErrInvalidTrip is returned for a trip whose fields cannot describe a
+	// real ride.
+	ErrInvalidTrip = errors.New("invalid trip")
+
+	// ErrTripNotOpen is returned by Alight for a trip that is not an open
+	// check-in.
+	ErrTripNotOpen = errors.New("trip is not in progress")
+)
+
+// TripService records the trip history of rider devices and prices each trip
+// with the fare engine when it is completed.
+type TripService struct {
+	repo  storage.TripsRepository
+	fares *FareService
+	now   func() time.Time
+}
+
+// NewTripService creates a TripService storing trips in repo and pricing them
+// with fares.
+func NewTripService(repo storage.TripsRepository, fares *FareService) *TripService {
+	return &TripService{repo: repo, fares: fares, now: time.Now}
+}
+
+// TripStatus returns the status of t at at: a check-in that stays open past
+// checkinExpiry is abandoned even before it is closed.
+func TripStatus(t storage.RiderTrip, at time.Time) string {
+	switch {
+	case t.AlightingStopID != nil:
+		return TripCompleted
+	case t.AlightedAt != nil || !at.Before(t.BoardedAt.Add(checkinExpiry)):
+		return TripAbandoned
+	}
+	return TripInProgress
+}
+
+// RecordTrip stores a completed trip entered by the rider, priced for
+// riderCategoryID (empty for the default category).
+//
+// Errors:
+//   - ErrInvalidTrip (wrapped) when a field is missing, the trip ends before
+//     it starts or in the future, or lasts longer than a check-in can.
+//   - ErrInvalidFareLeg (wrapped) when the route does not run from the
+//     boarding to the alighting stop.
+//   - ErrUnknownRiderCategory (wrapped) for an unknown category.
+//   - storage.ErrInvalidReference (wrapped) for an unknown route, vehicle or
+//     stop.
+//
+// A trip no fare rule prices is stored without a fare.
+func (s *TripService) RecordTrip(ctx context.Context, t storage.RiderTrip, riderCategoryID string) (*storage.RiderTrip, error) {
+	if err := validateTrip(t); err != nil {
+		return nil, fmt.Errorf("service: RecordTrip: %w", err)
+	}
+	switch {
+	case t.AlightingStopID == nil || *t.AlightingStopID <= 0 || t.AlightedAt == nil:
+		return nil, fmt.Errorf("service: RecordTrip: %w: alighting stop and time are required", ErrInvalidTrip)
+	case t.AlightedAt.Before(t.BoardedAt):
+		return nil, fmt.Errorf("service: RecordTrip: %w: alighted before boarding", ErrInvalidTrip)
+	case t.AlightedAt.After(s.now().Add(maxTripClockSkew)):
+		return nil, fmt.Errorf("service: RecordTrip: %w: alighted_at is in the future", ErrInvalidTrip)
+	case t.AlightedAt.Sub(t.BoardedAt) > checkinExpiry:
+		return nil, fmt.Errorf("service: RecordTrip: %w: trip longer than %s", ErrInvalidTrip, checkinExpiry)
+	}
+
+	fare, err := s.price(ctx, t.RouteID, t.BoardingStopID, *t.AlightingStopID, riderCategoryID)
+	if err != nil {
+		return nil, fmt.Errorf("service: RecordTrip: %w", err)
+	}
+	t.FareCents = fare
+	t.Source = storage.TripSourceManual
+
+	created, err := s.repo.CreateTrip(ctx, t)
+	if err != nil {
+		return nil, fmt.Errorf("service: RecordTrip: %w", err)
+	}
+	return created, nil
+}
+
+// CheckIn opens a trip boarded now at t.BoardingStopID. An open check-in of
+// the same device is closed as abandoned: the rider boarded another bus
+// without reporting where they got off the previous one.
+//
+// Errors:
+//   - ErrInvalidTrip (wrapped) when a field is missing.
+//   - storage.ErrInvalidReference (wrapped) for an unknown route, vehicle or
+//     stop.
+//   - storage.ErrConflict (wrapped) when a concurrent check-in of the device
+//     won.
+func (s *TripService) CheckIn(ctx context.Context, t storage.RiderTrip) (*storage.RiderTrip, error) {
+	now := s.now()
+	t.BoardedAt = now
+	if err := validateTrip(t); err != nil {
+		return nil, fmt.Errorf("service: CheckIn: %w", err)
+	}
+
+	t.Source = storage.TripSourceCheckin
+	t.AlightingStopID, t.AlightedAt, t.FareCents = nil, nil, nil
+	created, err := s.repo.OpenTrip(ctx, t, checkinExpiry)
+	if err != nil {
+		return nil, fmt.Errorf("service: CheckIn: %w", err)
+	}
+	return created, nil
+}
+
+// Alight completes the open check-in tripID of deviceID at stopID now, and
+// prices it for riderCategoryID (empty for the default category).
+// Returns (nil, nil) when the device has no such trip.
+//
+// Errors:
+//   - ErrTripNotOpen (wrapped) when the trip is completed or abandoned.
+//   - ErrInvalidFareLeg (wrapped) when the route does not run from the
+//     boarding stop to stopID.
+//   - ErrUnknownRiderCategory (wrapped) for an unknown category.
+func (s *TripService) Alight(ctx context.Context, deviceID string, tripID, stopID int32, riderCategoryID string) (*storage.RiderTrip, error) {
+	trip, err := s.repo.GetTrip(ctx, deviceID, tripID)
+	if err != nil {
+		return nil, fmt.Errorf("service: Alight: %w", err)
+	}
+	if trip == nil {
+		return nil, nil
+	}
+	now := s.now()
+	if TripStatus(*trip, now) != TripInProgress {
+		return nil, fmt.Errorf("service: Alight: %w: trip %d", ErrTripNotOpen, tripID)
+	}
+
+	fare, err := s.price(ctx, trip.RouteID, trip.BoardingStopID, stopID, riderCategoryID)
+	if err != nil {
+		return nil, fmt.Errorf("service: Alight: %w", err)
+	}
+	closed, err := s.repo.CloseTrip(ctx, deviceID, tripID, &stopID, now, fare)
+	if err != nil {
+		return nil, fmt.Errorf("service: Alight: %w", err)
+	}
+	if closed == nil {
+		// Closed by a concurrent check-in since it was read.
+		return nil, fmt.Errorf("service: Alight: %w: trip %d", ErrTripNotOpen, tripID)
+	}
+	return closed, nil
+}
+
+// History returns up to limit trips of deviceID, most recent first, starting
+// after before (nil for the most recent trip).
+func (s *TripService) History(ctx context.Context, deviceID string, before *storage.TripCursor, limit int) ([]storage.RiderTrip, error) {
+	trips, err := s.repo.ListTrips(ctx, deviceID, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("service: History: %w", err)
+	}
+	return trips, nil
+}
+
+// MonthlySummary returns the trips and spending of deviceID in each of the
+// last months calendar months, the current one included, oldest first.
+// Months without trips are returned with zero totals.
+func (s *TripService) MonthlySummary(ctx context.Context, deviceID string, months int) ([]storage.MonthlyTrips, error) {
+	now := s.now()
+	first := time.Date(now.Year(), now.Month()-time.Month(months-1), 1, 0, 0, 0, 0, now.Location())
+
+	rows, err := s.repo.SummarizeTrips(ctx, deviceID, first)
+	if err != nil {
+		return nil, fmt.Errorf("service: MonthlySummary: %w", err)
+	}
+
+	out := make([]storage.MonthlyTrips, months)
+	for i := range out {
+		out[i].Month = first.AddDate(0, i, 0)
+	}
+	for _, row := range rows {
+		i := (row.Month.Year()-first.Year())*12 + int(row.Month.Month()-first.Month())
+		if i >= 0 && i < months {
+			out[i].Trips = row.Trips
+			out[i].TotalCents = row.TotalCents
+		}
+	}
+	return out, nil
+}
+
+// price quotes a ride on routeID from fromStopID to toStopID. It returns nil
+// when no fare rule prices the ride: the trip happened all the same.
+func (s *TripService) price(ctx context.Context, routeID, fromStopID, toStopID int32, riderCategoryID string) (*int, error) {
+	quote, err := s.fares.Quote(ctx, riderCategoryID, []FareLegRequest{
+		{RouteID: routeID, FromStopID: fromStopID, ToStopID: toStopID},
+	})
+	if errors.Is(err, ErrNoFare) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &quote.TotalCents, nil
+}
+
+// validateTrip checks the fields every trip needs.
+func validateTrip(t storage.RiderTrip) error {
+	switch {
+	case t.DeviceID == "":
+		return fmt.Errorf("%w: device ID is required", ErrInvalidTrip)
+	case t.RouteID <= 0 || t.BoardingStopID <= 0:
+		return fmt.Errorf("%w: route and boarding stop are required", ErrInvalidTrip)
+	case t.VehicleID != nil && *t.VehicleID <= 0:
+		return fmt.Errorf("%w: vehicle ID %d", ErrInvalidTrip, *t.VehicleID)
+	case t.BoardedAt.IsZero():
+		return fmt.Errorf("%w: boarding time is required", ErrInvalidTrip)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dom1nux/qapac-api/internal/storage"
+)
+
+// memTripsRepo is an in-memory storage.TripsRepository.
+type memTripsRepo struct {
+	trips   []storage.RiderTrip
+	summary []storage.MonthlyTrips
+	since   time.Time
+}
+
+func (m *memTripsRepo) CreateTrip(_ context.Context, t storage.RiderTrip) (*storage.RiderTrip, error) {
+	t.ID = int32(len(m.trips) + 1)
+	m.trips = append(m.trips, t)
+	return &t, nil
+}
+
+func (m *memTripsRepo) GetTrip(_ context.Context, deviceID string, id int32) (*storage.RiderTrip, error) {
+	for _, t := range m.trips {
+		if t.ID == id && t.DeviceID == deviceID {
+			return &t, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memTripsRepo) OpenTrip(_ context.Context, t storage.RiderTrip, expiry time.Duration) (*storage.RiderTrip, error) {
+	for i, open := range m.trips {
+		if open.DeviceID == t.DeviceID && open.AlightedAt == nil {
+			at := open.BoardedAt.Add(expiry)
+			if t.BoardedAt.Before(at) {
+				at = t.BoardedAt
+			}
+			m.trips[i].AlightedAt = &at
+		}
+	}
+	return m.CreateTrip(context.Background(), t)
+}
+
+func (m *memTripsRepo) CloseTrip(_ context.Context, deviceID string, id int32, stopID *int32, at time.Time, fare *int) (*storage.RiderTrip, error) {
+	for i, t := range m.trips {
+		if t.ID == id && t.DeviceID == deviceID && t.AlightedAt == nil {
+			t.AlightingStopID, t.AlightedAt, t.FareCents = stopID, &at, fare
+			m.trips[i] = t
+			return &t, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memTripsRepo) ListTrips(_ context.Context, _ string, _ *storage.TripCursor, _ int) ([]storage.RiderTrip, error) {
+	return m.trips, nil
+}
+
+func (m *memTripsRepo) SummarizeTrips(_ context.Context, _ string, since time.Time) ([]storage.MonthlyTrips, error) {
+	m.since = since
+	return m.summary, nil
+}
+
+var tripsNow = time.Date(2025, 3, 10, 8, 0, 0, 0, time.Local)
+
+func newTestTripService(repo *memTripsRepo) *TripService {
+	s := NewTripService(repo, NewFareService(limaFares()))
+	s.now = func() time.Time { return tripsNow }
+	return s
+}
+
+func int32Ref(n int32) *int32 { return &n }
+
+func timeRef(t time.Time) *time.Time { return &t }
+
+// manualTrip is a valid manual trip of device "abc12345" on routeID.
+func manualTrip(routeID int32) storage.RiderTrip {
+	return storage.RiderTrip{
+		DeviceID:        "abc12345",
+		RouteID:         routeID,
+		BoardingStopID:  1,
+		AlightingStopID: int32Ref(2),
+		BoardedAt:       tripsNow.Add(-time.Hour),
+		AlightedAt:      timeRef(tripsNow.Add(-30 * time.Minute)),
+	}
+}
+
+func TestTrips_RecordTrip_Prices(t *testing.T) {
+	tests := []struct {
+		name     string
+		routeID  int32
+		category string
+		want     *int
+	}{
+		{"default category", 1, "", intRef(150)},
+		{"student", 2, "estudiante", intRef(125)},
+		{"no fare rule: stored without fare", 5, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestTripService(&memTripsRepo{})
+			got, err := s.RecordTrip(context.Background(), manualTrip(tt.routeID), tt.category)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Source != storage.TripSourceManual {
+				t.Errorf("source = %q, want manual", got.Source)
+			}
+			if (got.FareCents == nil) != (tt.want == nil) || (tt.want != nil && *got.FareCents != *tt.want) {
+				t.Errorf("fare = %v, want %v", got.FareCents, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrips_RecordTrip_Invalid(t *testing.T) {
+	s := newTestTripService(&memTripsRepo{})
+
+	noDevice := manualTrip(1)
+	noDevice.DeviceID = ""
+	noAlighting := manualTrip(1)
+	noAlighting.AlightingStopID = nil
+	backwards := manualTrip(1)
+	backwards.AlightedAt = timeRef(backwards.BoardedAt.Add(-time.Minute))
+	future := manualTrip(1)
+	future.AlightedAt = timeRef(tripsNow.Add(time.Hour))
+	tooLong := manualTrip(1)
+	tooLong.BoardedAt = tripsNow.Add(-5 * time.Hour)
+
+	for name, trip := range map[string]storage.RiderTrip{
+		"no device": noDevice, "no alighting stop": noAlighting, "alights before boarding": backwards,
+		"alights in the future": future, "longer than a check-in": tooLong,
+	} {
+		if _, err := s.RecordTrip(context.Background(), trip, ""); !errors.Is(err, ErrInvalidTrip) {
+			t.Errorf("%s: err = %v, want ErrInvalidTrip", name, err)
+		}
+	}
+	if _, err := s.RecordTrip(context.Background(), manualTrip(4), ""); !errors.Is(err, ErrInvalidFareLeg) {
+		t.Errorf("backwards ride: err = %v, want ErrInvalidFareLeg", err)
+	}
+	if _, err := s.RecordTrip(context.Background(), manualTrip(1), "jubilado"); !errors.Is(err, ErrUnknownRiderCategory) {
+		t.Errorf("unknown category: err = %v, want ErrUnknownRiderCategory", err)
+	}
+}
+
+func TestTrips_CheckInAndAlight(t *testing.T) {
+	repo := &memTripsRepo{}
+	s := newTestTripService(repo)
+	ctx := context.Background()
+
+	trip, err := s.CheckIn(ctx, storage.RiderTrip{DeviceID: "abc12345", RouteID: 2, BoardingStopID: 1})
+	if err != nil {
+		t.Fatalf("CheckIn: unexpected error: %v", err)
+	}
+	if trip.Source != storage.TripSourceCheckin || !trip.BoardedAt.Equal(tripsNow) || TripStatus(*trip, tripsNow) != TripInProgress {
+		t.Errorf("check-in = %+v, want an open check-in boarded now", trip)
+	}
+
+	// Another device cannot see the trip.
+	if got, err := s.Alight(ctx, "other123", trip.ID, 2, ""); got != nil || err != nil {
+		t.Errorf("Alight by another device = %+v, %v; want nil, nil", got, err)
+	}
+
+	done, err := s.Alight(ctx, "abc12345", trip.ID, 2, "")
+	if err != nil {
+		t.Fatalf("Alight: unexpected error: %v", err)
+	}
+	if done.FareCents == nil || *done.FareCents != 250 || TripStatus(*done, tripsNow) != TripCompleted {
+		t.Errorf("alighted trip = %+v, want completed with a 250 fare", done)
+	}
+	if _, err := s.Alight(ctx, "abc12345", trip.ID, 2, ""); !errors.Is(err, ErrTripNotOpen) {
+		t.Errorf("second Alight: err = %v, want ErrTripNotOpen", err)
+	}
+}
+
+func TestTrips_CheckIn_AbandonsOpenTrip(t *testing.T) {
+	repo := &memTripsRepo{}
+	s := newTestTripService(repo)
+	ctx := context.Background()
+
+	// A check-in boarded five hours ago was never closed.
+	repo.trips = []storage.RiderTrip{{
+		ID: 1, DeviceID: "abc12345", RouteID: 1, BoardingStopID: 1,
+		BoardedAt: tripsNow.Add(-5 * time.Hour), Source: storage.TripSourceCheckin,
+	}}
+	if TripStatus(repo.trips[0], tripsNow) != TripAbandoned {
+		t.Errorf("expired check-in status = %s, want abandoned", TripStatus(repo.trips[0], tripsNow))
+	}
+	if _, err := s.Alight(ctx, "abc12345", 1, 2, ""); !errors.Is(err, ErrTripNotOpen) {
+		t.Errorf("Alight of an expired check-in: err = %v, want ErrTripNotOpen", err)
+	}
+
+	if _, err := s.CheckIn(ctx, storage.RiderTrip{DeviceID: "abc12345", RouteID: 2, BoardingStopID: 3}); err != nil {
+		t.Fatalf("CheckIn: unexpected error: %v", err)
+	}
+	old := repo.trips[0]
+	wantAt := old.BoardedAt.Add(checkinExpiry)
+	if old.AlightedAt == nil || !old.AlightedAt.Equal(wantAt) || old.AlightingStopID != nil || old.FareCents != nil {
+		t.Errorf("previous check-in = %+v, want closed at %s without stop or fare", old, wantAt)
+	}
+	if len(repo.trips) != 2 || repo.trips[1].AlightedAt != nil {
+		t.Errorf("trips = %+v, want the new check-in open", repo.trips)
+	}
+}
+
+func TestTrips_MonthlySummary_FillsEmptyMonths(t *testing.T) {
+	jan := time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)
+	mar := time.Date(2025, 3, 1, 0, 0, 0, 0, time.Local)
+	repo := &memTripsRepo{summary: []storage.MonthlyTrips{
+		{Month: jan, Trips: 40, TotalCents: 6000},
+		{Month: mar, Trips: 12, TotalCents: 1800},
+	}}
+	s := newTestTripService(repo)
+
+	got, err := s.MonthlySummary(context.Background(), "abc12345", 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantSince := time.Date(2024, 12, 1, 0, 0, 0, 0, time.Local)
+	if !repo.since.Equal(wantSince) {
+		t.Errorf("since = %s, want %s", repo.since, wantSince)
+	}
+	want := []int{0, 40, 0, 12}
+	if len(got) != len(want) {
+		t.Fatalf("got %d months, want %d", len(got), len(want))
+	}
+	for i, m := range got {
+		if m.Trips != want[i] || !m.Month.Equal(wantSince.AddDate(0, i, 0)) {
+			t.Errorf("month %d = %+v, want %d trips in %s", i, m, want[i], wantSince.AddDate(0, i, 0).Format("2006-01"))
+		}
+	}
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/dom1nux/qapac-api/internal/generated/db"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -27,7 +30,7 @@ func NewStopsRepository(pool *pgxpool.Pool) StopsRepository {
 }
 
 // FindStopsNear returns active stops within radiusMeters of (lat, lon).
-func (r *pgStopsRepository) FindStopsNear(ctx context.Context, lat, lon, radiusMeters float64) ([]Stop, error) {
+func (r *pgStopsRepository) FindStopsNear(ctx context.Context, lat, lon, radiusMeters float64) ([]NearbyStop, error) {
 	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
@@ -40,13 +43,13 @@ func (r *pgStopsRepository) FindStopsNear(ctx context.Context, lat, lon, radiusM
 		return nil, fmt.Errorf("storage: FindStopsNear: %w", err)
 	}
 
-	stops := make([]Stop, 0, len(rows))
+	stops := make([]NearbyStop, 0, len(rows))
 	for _, row := range rows {
 		s, err := rowToStop(row.ID, row.Name, row.Geom)
 		if err != nil {
 			return nil, fmt.Errorf("storage: FindStopsNear: parse geometry: %w", err)
 		}
-		stops = append(stops, s)
+		stops = append(stops, NearbyStop{Stop: s, DistanceM: row.DistanceM})
 	}
 
 	return stops, nil
@@ -73,6 +76,79 @@ func (r *pgStopsRepository) GetStop(ctx context.Context, id int32) (*Stop, error
 	return &s, nil
 }
 
+// ListRoutesServingStops returns the active routes of each stop in stopIDs.
+func (r *pgStopsRepository) ListRoutesServingStops(ctx context.Context, stopIDs []int32) (map[int32][]StopRoute, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.q.ListRoutesServingStops(ctx, stopIDs)
+	if err != nil {
+		return nil, fmt.Errorf("storage: ListRoutesServingStops: %w", err)
+	}
+
+	out := make(map[int32][]StopRoute, len(stopIDs))
+	for _, row := range rows {
+		out[row.StopID] = append(out[row.StopID], StopRoute{ID: row.ID, Name: row.Name})
+	}
+	return out, nil
+}
+
+// ListStopsInBBox returns one page of the (optionally thinned) stops in bbox.
+func (r *pgStopsRepository) ListStopsInBBox(ctx context.Context, bbox BBox, gridDeg float64, afterID int32, limit int) ([]Stop, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.q.ListStopsInBBox(ctx, db.ListStopsInBBoxParams{
+		GridDeg:   gridDeg,
+		MinLon:    bbox.MinLon,
+		MinLat:    bbox.MinLat,
+		MaxLon:    bbox.MaxLon,
+		MaxLat:    bbox.MaxLat,
+		AfterID:   afterID,
+		PageLimit: int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: ListStopsInBBox: %w", err)
+	}
+
+	stops := make([]Stop, 0, len(rows))
+	for _, row := range rows {
+		s, err := rowToStop(row.ID, row.Name, row.Geom)
+		if err != nil {
+			return nil, fmt.Errorf("storage: ListStopsInBBox: parse geometry: %w", err)
+		}
+		stops = append(stops, s)
+	}
+	return stops, nil
+}
+
+// SearchStops runs a trigram search over the accent-folded stop names.
+func (r *pgStopsRepository) SearchStops(ctx context.Context, q StopSearch) ([]StopMatch, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.q.SearchStops(ctx, db.SearchStopsParams{
+		Query:     q.Query,
+		Near:      q.Near,
+		Lon:       q.Lon,
+		Lat:       q.Lat,
+		PageLimit: int32(q.Limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: SearchStops: %w", err)
+	}
+
+	matches := make([]StopMatch, 0, len(rows))
+	for _, row := range rows {
+		s, err := rowToStop(row.ID, row.Name, row.Geom)
+		if err != nil {
+			return nil, fmt.Errorf("storage: SearchStops: parse geometry: %w", err)
+		}
+		matches = append(matches, StopMatch{Stop: s, Score: row.Score})
+	}
+	return matches, nil
+}
+
 // pgRoutesRepository is the pgx-backed implementation of RoutesRepository.
 type pgRoutesRepository struct {
 	q *db.Queries
@@ -111,28 +187,1381 @@ func (r *pgRoutesRepository) GetRouteShape(ctx context.Context, routeID int32) (
 	}, nil
 }
 
-// rowToStop converts a raw query row into a Stop domain object.
-// geom must be a WKT POINT string produced by ST_AsText, e.g. "POINT(lon lat)".
-func rowToStop(id int32, name string, geom interface{}) (Stop, error) {
-	if geom == nil {
-		return Stop{}, fmt.Errorf("stop id=%d has NULL geometry (data integrity issue)", id)
+// DistanceToRouteShape returns the distance in metres from (lat, lon) to the
+// shape of routeID, or (0, false, nil) if the route has no shape.
+func (r *pgRoutesRepository) DistanceToRouteShape(ctx context.Context, routeID int32, lat, lon float64) (float64, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	meters, err := r.q.DistanceToRouteShape(ctx, db.DistanceToRouteShapeParams{
+		Lon:     lon,
+		Lat:     lat,
+		RouteID: routeID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
 	}
-	wkt, ok := geom.(string)
-	if !ok {
-		return Stop{}, fmt.Errorf("unexpected geom type %T", geom)
+	if err != nil {
+		return 0, false, fmt.Errorf("storage: DistanceToRouteShape: %w", err)
 	}
+	return meters, true, nil
+}
 
-	lat, lon, err := parsePointWKT(wkt)
+// pgHeadwaysRepository is the pgx-backed implementation of HeadwaysRepository.
+type pgHeadwaysRepository struct {
+	q *db.Queries
+}
+
+// NewHeadwaysRepository creates a HeadwaysRepository backed by the given connection pool.
+func NewHeadwaysRepository(pool *pgxpool.Pool) HeadwaysRepository {
+	return &pgHeadwaysRepository{q: db.New(pool)}
+}
+
+// RecordStopArrival inserts a row into stop_arrivals.
+func (r *pgHeadwaysRepository) RecordStopArrival(ctx context.Context, a StopArrival) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := r.q.InsertStopArrival(ctx, db.InsertStopArrivalParams{
+		RouteID:   a.RouteID,
+		StopID:    a.StopID,
+		VehicleID: a.VehicleID,
+		ArrivedAt: pgtype.Timestamp{Time: a.ArrivedAt.Local(), Valid: true},
+	})
 	if err != nil {
-		return Stop{}, err
+		return fmt.Errorf("storage: RecordStopArrival: %w", err)
 	}
+	return nil
+}
 
-	return Stop{
-		ID:   id,
-		Name: name,
-		Lat:  lat,
-		Lon:  lon,
-	}, nil
+// FindRouteStopNear returns the stop of routeID closest to (lat, lon) within
+// radiusMeters, or (0, false, nil) if there is none.
+func (r *pgHeadwaysRepository) FindRouteStopNear(ctx context.Context, routeID int32, lat, lon, radiusMeters float64) (int32, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	row, err := r.q.FindRouteStopNear(ctx, db.FindRouteStopNearParams{
+		Lon:     lon,
+		Lat:     lat,
+		RouteID: routeID,
+		RadiusM: radiusMeters,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("storage: FindRouteStopNear: %w", err)
+	}
+	return row.StopID, true, nil
+}
+
+// ListStopArrivals returns the arrivals of routeID in [from, to).
+func (r *pgHeadwaysRepository) ListStopArrivals(ctx context.Context, routeID int32, from, to time.Time) ([]StopArrival, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.q.ListStopArrivals(ctx, db.ListStopArrivalsParams{
+		RouteID: routeID,
+		FromTs:  pgtype.Timestamp{Time: from, Valid: true},
+		ToTs:    pgtype.Timestamp{Time: to, Valid: true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: ListStopArrivals: %w", err)
+	}
+
+	arrivals := make([]StopArrival, 0, len(rows))
+	for _, row := range rows {
+		arrivals = append(arrivals, StopArrival{
+			RouteID:   routeID,
+			StopID:    row.StopID,
+			VehicleID: row.VehicleID,
+			ArrivedAt: LocalTime(row.ArrivedAt),
+		})
+	}
+	return arrivals, nil
+}
+
+// ListApproachingVehicles returns the vehicle expected next at each stop.
+func (r *pgHeadwaysRepository) ListApproachingVehicles(ctx context.Context, stopIDs []int32, since time.Time) (map[int32]int32, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.q.ListApproachingVehicles(ctx, db.ListApproachingVehiclesParams{
+		Since:   pgtype.Timestamp{Time: since.Local(), Valid: true},
+		StopIds: stopIDs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: ListApproachingVehicles: %w", err)
+	}
+
+	vehicles := make(map[int32]int32, len(rows))
+	for _, row := range rows {
+		vehicles[row.StopID] = row.VehicleID
+	}
+	return vehicles, nil
+}
+
+// GetScheduledHeadway returns the scheduled headway of routeID, or
+// (0, false, nil) if the route is unknown or has none.
+func (r *pgHeadwaysRepository) GetScheduledHeadway(ctx context.Context, routeID int32) (int, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	headway, err := r.q.GetScheduledHeadway(ctx, routeID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("storage: GetScheduledHeadway: %w", err)
+	}
+	if !headway.Valid {
+		return 0, false, nil
+	}
+	return int(headway.Int32), true, nil
+}
+
+// pgVehiclesRepository is the pgx-backed implementation of VehiclesRepository.
+type pgVehiclesRepository struct {
+	q *db.Queries
+}
+
+// NewVehiclesRepository creates a VehiclesRepository backed by the given connection pool.
+func NewVehiclesRepository(pool *pgxpool.Pool) VehiclesRepository {
+	return &pgVehiclesRepository{q: db.New(pool)}
+}
+
+// ListVehicles returns the registered vehicles, optionally only active ones.
+func (r *pgVehiclesRepository) ListVehicles(ctx context.Context, onlyActive bool) ([]Vehicle, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.q.ListVehicles(ctx, onlyActive)
+	if err != nil {
+		return nil, fmt.Errorf("storage: ListVehicles: %w", err)
+	}
+
+	vehicles := make([]Vehicle, 0, len(rows))
+	for _, row := range rows {
+		vehicles = append(vehicles, rowToVehicle(row))
+	}
+	return vehicles, nil
+}
+
+// GetVehicle returns a vehicle by ID, or (nil, nil) if not found.
+func (r *pgVehiclesRepository) GetVehicle(ctx context.Context, id int32) (*Vehicle, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	row, err := r.q.GetVehicle(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage: GetVehicle: %w", err)
+	}
+	v := rowToVehicle(row)
+	return &v, nil
+}
+
+// CreateVehicle inserts a row into vehicles.
+func (r *pgVehiclesRepository) CreateVehicle(ctx context.Context, v Vehicle) (*Vehicle, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	row, err := r.q.CreateVehicle(ctx, db.CreateVehicleParams{
+		Plate:                 v.Plate,
+		Operator:              v.Operator,
+		Capacity:              int32(v.Capacity),
+		AccessibilityFeatures: nonNilStrings(v.AccessibilityFeatures),
+		Active:                v.Active,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: CreateVehicle: %w", mapWriteError(err))
+	}
+	created := rowToVehicle(row)
+	return &created, nil
+}
+
+// UpdateVehicle overwrites a vehicle, or returns (nil, nil) if not found.
+func (r *pgVehiclesRepository) UpdateVehicle(ctx context.Context, v Vehicle) (*Vehicle, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	row, err := r.q.UpdateVehicle(ctx, db.UpdateVehicleParams{
+		Plate:                 v.Plate,
+		Operator:              v.Operator,
+		Capacity:              int32(v.Capacity),
+		AccessibilityFeatures: nonNilStrings(v.AccessibilityFeatures),
+		Active:                v.Active,
+		ID:                    v.ID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage: UpdateVehicle: %w", mapWriteError(err))
+	}
+	updated := rowToVehicle(row)
+	return &updated, nil
+}
+
+// DeactivateVehicle sets active = false on a vehicle.
+func (r *pgVehiclesRepository) DeactivateVehicle(ctx context.Context, id int32) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	n, err := r.q.DeactivateVehicle(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("storage: DeactivateVehicle: %w", err)
+	}
+	return n > 0, nil
+}
+
+// ListAssignments returns the assignments of a vehicle, most recent first.
+func (r *pgVehiclesRepository) ListAssignments(ctx context.Context, vehicleID int32) ([]VehicleAssignment, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.q.ListVehicleAssignments(ctx, vehicleID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: ListAssignments: %w", err)
+	}
+
+	assignments := make([]VehicleAssignment, 0, len(rows))
+	for _, row := range rows {
+		assignments = append(assignments, rowToAssignment(row))
+	}
+	return assignments, nil
+}
+
+// CreateAssignment inserts a row into vehicle_assignments.
+func (r *pgVehiclesRepository) CreateAssignment(ctx context.Context, a VehicleAssignment) (*VehicleAssignment, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	params := db.CreateVehicleAssignmentParams{
+		VehicleID: a.VehicleID,
+		RouteID:   a.RouteID,
+		StartsAt:  pgtype.Timestamp{Time: a.StartsAt.Local(), Valid: true},
+	}
+	if a.DriverID != nil {
+		params.DriverID = pgtype.Int4{Int32: *a.DriverID, Valid: true}
+	}
+	if a.EndsAt != nil {
+		params.EndsAt = pgtype.Timestamp{Time: a.EndsAt.Local(), Valid: true}
+	}
+	if a.CollectorID != nil {
+		params.CollectorID = pgtype.Int4{Int32: *a.CollectorID, Valid: true}
+	}
+
+	row, err := r.q.CreateVehicleAssignment(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("storage: CreateAssignment: %w", mapWriteError(err))
+	}
+	created := rowToAssignment(row)
+	return &created, nil
+}
+
+// DeleteAssignment deletes an assignment belonging to vehicleID.
+func (r *pgVehiclesRepository) DeleteAssignment(ctx context.Context, vehicleID, assignmentID int32) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	n, err := r.q.DeleteVehicleAssignment(ctx, db.DeleteVehicleAssignmentParams{
+		ID:        assignmentID,
+		VehicleID: vehicleID,
+	})
+	if err != nil {
+		return false, fmt.Errorf("storage: DeleteAssignment: %w", err)
+	}
+	return n > 0, nil
+}
+
+// GetActiveAssignment returns the assignment in effect at at, or (nil, nil).
+func (r *pgVehiclesRepository) GetActiveAssignment(ctx context.Context, vehicleID int32, at time.Time) (*VehicleAssignment, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	row, err := r.q.GetActiveVehicleAssignment(ctx, db.GetActiveVehicleAssignmentParams{
+		VehicleID: vehicleID,
+		At:        pgtype.Timestamp{Time: at.Local(), Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage: GetActiveAssignment: %w", err)
+	}
+	a := rowToAssignment(row)
+	return &a, nil
+}
+
+// StartShift starts the assignment of driverID in effect at at, or returns
+// (nil, nil) if there is none to start.
+func (r *pgVehiclesRepository) StartShift(ctx context.Context, driverID int32, at time.Time) (*VehicleAssignment, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	row, err := r.q.StartDriverShift(ctx, db.StartDriverShiftParams{
+		At:       pgtype.Timestamp{Time: at.Local(), Valid: true},
+		DriverID: driverID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage: StartShift: %w", err)
+	}
+	a := rowToAssignment(row)
+	return &a, nil
+}
+
+// EndShift ends the shift in progress of driverID, or returns (nil, nil) if
+// there is none.
+func (r *pgVehiclesRepository) EndShift(ctx context.Context, driverID int32, at time.Time) (*VehicleAssignment, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	row, err := r.q.EndDriverShift(ctx, db.EndDriverShiftParams{
+		At:       pgtype.Timestamp{Time: at.Local(), Valid: true},
+		DriverID: driverID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage: EndShift: %w", err)
+	}
+	a := rowToAssignment(row)
+	return &a, nil
+}
+
+// pgFaresRepository is the pgx-backed implementation of FaresRepository.
+type pgFaresRepository struct {
+	q *db.Queries
+}
+
+// NewFaresRepository creates a FaresRepository backed by the given connection pool.
+func NewFaresRepository(pool *pgxpool.Pool) FaresRepository {
+	return &pgFaresRepository{q: db.New(pool)}
+}
+
+// GetFareTables reads every fare table.
+func (r *pgFaresRepository) GetFareTables(ctx context.Context) (*FareTables, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	categories, err := r.q.ListRiderCategories(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("storage: GetFareTables: rider categories: %w", err)
+	}
+	products, err := r.q.ListFareProducts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("storage: GetFareTables: products: %w", err)
+	}
+	legRules, err := r.q.ListFareLegRules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("storage: GetFareTables: leg rules: %w", err)
+	}
+	transferRules, err := r.q.ListFareTransferRules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("storage: GetFareTables: transfer rules: %w", err)
+	}
+
+	t := &FareTables{
+		RiderCategories: make([]RiderCategory, 0, len(categories)),
+		Products:        make([]FareProduct, 0, len(products)),
+		LegRules:        make([]FareLegRule, 0, len(legRules)),
+		TransferRules:   make([]FareTransferRule, 0, len(transferRules)),
+	}
+	for _, c := range categories {
+		t.RiderCategories = append(t.RiderCategories, RiderCategory{ID: c.ID, Name: c.Name, IsDefault: c.IsDefault})
+	}
+	for _, p := range products {
+		t.Products = append(t.Products, FareProduct{
+			ID:              p.ID,
+			RiderCategoryID: p.RiderCategoryID,
+			Name:            p.Name,
+			AmountCents:     int(p.AmountCents),
+			Currency:        p.Currency,
+		})
+	}
+	for _, lr := range legRules {
+		t.LegRules = append(t.LegRules, FareLegRule{
+			ID:            lr.ID,
+			LegGroupID:    lr.LegGroupID.String,
+			NetworkID:     lr.NetworkID.String,
+			FromAreaID:    lr.FromAreaID.String,
+			ToAreaID:      lr.ToAreaID.String,
+			MinDistanceM:  intPtr(lr.MinDistanceM),
+			MaxDistanceM:  intPtr(lr.MaxDistanceM),
+			FareProductID: lr.FareProductID,
+			Priority:      int(lr.RulePriority),
+		})
+	}
+	for _, tr := range transferRules {
+		t.TransferRules = append(t.TransferRules, FareTransferRule{
+			ID:             tr.ID,
+			FromLegGroupID: tr.FromLegGroupID.String,
+			ToLegGroupID:   tr.ToLegGroupID.String,
+			TransferType:   int(tr.FareTransferType),
+			FareProductID:  tr.FareProductID.String,
+		})
+	}
+	return t, nil
+}
+
+// GetRideLeg returns the network, stop sequences, distance and fare areas of
+// a ride, or (nil, nil) if the route does not serve both stops.
+func (r *pgFaresRepository) GetRideLeg(ctx context.Context, routeID, fromStopID, toStopID int32) (*RideLeg, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	row, err := r.q.GetRideLeg(ctx, db.GetRideLegParams{
+		FromStopID: fromStopID,
+		ToStopID:   toStopID,
+		RouteID:    routeID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage: GetRideLeg: %w", err)
+	}
+
+	areas, err := r.q.ListStopAreas(ctx, []int32{fromStopID, toStopID})
+	if err != nil {
+		return nil, fmt.Errorf("storage: GetRideLeg: stop areas: %w", err)
+	}
+
+	leg := &RideLeg{
+		RouteID:      routeID,
+		FromStopID:   fromStopID,
+		ToStopID:     toStopID,
+		NetworkID:    row.NetworkID.String,
+		FromSequence: int(row.FromSequence),
+		ToSequence:   int(row.ToSequence),
+		DistanceM:    row.DistanceM,
+	}
+	for _, a := range areas {
+		if a.StopID == fromStopID {
+			leg.FromAreas = append(leg.FromAreas, a.AreaID)
+		}
+		if a.StopID == toStopID {
+			leg.ToAreas = append(leg.ToAreas, a.AreaID)
+		}
+	}
+	return leg, nil
+}
+
+// pgOccupancyRepository is the pgx-backed implementation of OccupancyRepository.
+type pgOccupancyRepository struct {
+	q *db.Queries
+}
+
+// NewOccupancyRepository creates an OccupancyRepository backed by the given connection pool.
+func NewOccupancyRepository(pool *pgxpool.Pool) OccupancyRepository {
+	return &pgOccupancyRepository{q: db.New(pool)}
+}
+
+// RecordOccupancyReport inserts a row into occupancy_reports.
+func (r *pgOccupancyRepository) RecordOccupancyReport(ctx context.Context, rep OccupancyReport) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := r.q.InsertOccupancyReport(ctx, db.InsertOccupancyReportParams{
+		VehicleID:  rep.VehicleID,
+		Status:     int16(rep.Status),
+		Source:     rep.Source,
+		ReportedAt: pgtype.Timestamp{Time: rep.ReportedAt.Local(), Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("storage: RecordOccupancyReport: %w", mapWriteError(err))
+	}
+	return nil
+}
+
+// ListOccupancyReportsSince returns the recent reports of the given vehicles.
+func (r *pgOccupancyRepository) ListOccupancyReportsSince(ctx context.Context, vehicleIDs []int32, since time.Time) ([]OccupancyReport, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.q.ListOccupancyReportsSince(ctx, db.ListOccupancyReportsSinceParams{
+		VehicleIds: vehicleIDs,
+		Since:      pgtype.Timestamp{Time: since.Local(), Valid: true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: ListOccupancyReportsSince: %w", err)
+	}
+
+	reports := make([]OccupancyReport, 0, len(rows))
+	for _, row := range rows {
+		reports = append(reports, OccupancyReport{
+			VehicleID:  row.VehicleID,
+			Status:     int(row.Status),
+			Source:     row.Source,
+			ReportedAt: LocalTime(row.ReportedAt),
+		})
+	}
+	return reports, nil
+}
+
+// pgTripsRepository is the pgx-backed implementation of TripsRepository.
+type pgTripsRepository struct {
+	pool *pgxpool.Pool
+	q    *db.Queries
+}
+
+// NewTripsRepository creates a TripsRepository backed by the given connection pool.
+func NewTripsRepository(pool *pgxpool.Pool) TripsRepository {
+	return &pgTripsRepository{pool: pool, q: db.New(pool)}
+}
+
+// CreateTrip inserts a row into rider_trips.
+func (r *pgTripsRepository) CreateTrip(ctx context.Context, t RiderTrip) (*RiderTrip, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	row, err := r.q.CreateRiderTrip(ctx, tripParams(t))
+	if err != nil {
+		return nil, fmt.Errorf("storage: CreateTrip: %w", mapWriteError(err))
+	}
+	created := rowToTrip(row)
+	return &created, nil
+}
+
+// OpenTrip abandons the open trip of t.DeviceID and inserts t, in one
+// transaction: a check-in that fails leaves the previous one open.
+func (r *pgTripsRepository) OpenTrip(ctx context.Context, t RiderTrip, expiry time.Duration) (*RiderTrip, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("storage: OpenTrip: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // no-op after Commit
+	q := r.q.WithTx(tx)
+
+	_, err = q.AbandonOpenRiderTrip(ctx, db.AbandonOpenRiderTripParams{
+		At:       pgtype.Timestamp{Time: t.BoardedAt.Local(), Valid: true},
+		ExpiryS:  expiry.Seconds(),
+		DeviceID: t.DeviceID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: OpenTrip: abandon open trip: %w", err)
+	}
+	row, err := q.CreateRiderTrip(ctx, tripParams(t))
+	if err != nil {
+		return nil, fmt.Errorf("storage: OpenTrip: %w", mapWriteError(err))
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("storage: OpenTrip: %w", mapWriteError(err))
+	}
+	created := rowToTrip(row)
+	return &created, nil
+}
+
+// tripParams converts t into the parameters of CreateRiderTrip.
+func tripParams(t RiderTrip) db.CreateRiderTripParams {
+	params := db.CreateRiderTripParams{
+		DeviceID:      t.DeviceID,
+		RouteID:       t.RouteID,
+		VehicleID:     optionalInt4(t.VehicleID),
+		BoardingStop:  t.BoardingStopID,
+		AlightingStop: optionalInt4(t.AlightingStopID),
+		BoardedAt:     pgtype.Timestamp{Time: t.BoardedAt.Local(), Valid: true},
+		Source:        t.Source,
+	}
+	if t.AlightedAt != nil {
+		params.AlightedAt = pgtype.Timestamp{Time: t.AlightedAt.Local(), Valid: true}
+	}
+	if t.FareCents != nil {
+		params.FareCents = pgtype.Int4{Int32: int32(*t.FareCents), Valid: true}
+	}
+	return params
+}
+
+// GetTrip returns a trip of deviceID, or (nil, nil) if not found.
+func (r *pgTripsRepository) GetTrip(ctx context.Context, deviceID string, id int32) (*RiderTrip, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	row, err := r.q.GetRiderTrip(ctx, db.GetRiderTripParams{ID: id, DeviceID: deviceID})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage: GetTrip: %w", err)
+	}
+	t := rowToTrip(row)
+	return &t, nil
+}
+
+// CloseTrip closes an open trip of deviceID, or returns (nil, nil) if there
+// is no such open trip.
+func (r *pgTripsRepository) CloseTrip(ctx context.Context, deviceID string, id int32, alightingStopID *int32, at time.Time, fareCents *int) (*RiderTrip, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	params := db.CloseRiderTripParams{
+		AlightingStop: optionalInt4(alightingStopID),
+		AlightedAt:    pgtype.Timestamp{Time: at.Local(), Valid: true},
+		ID:            id,
+		DeviceID:      deviceID,
+	}
+	if fareCents != nil {
+		params.FareCents = pgtype.Int4{Int32: int32(*fareCents), Valid: true}
+	}
+
+	row, err := r.q.CloseRiderTrip(ctx, params)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage: CloseTrip: %w", mapWriteError(err))
+	}
+	t := rowToTrip(row)
+	return &t, nil
+}
+
+// ListTrips returns one page of the trips of deviceID.
+func (r *pgTripsRepository) ListTrips(ctx context.Context, deviceID string, before *TripCursor, limit int) ([]RiderTrip, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	params := db.ListRiderTripsParams{DeviceID: deviceID, RowLimit: int32(limit)}
+	if before != nil {
+		params.BeforeBoardedAt = pgtype.Timestamp{Time: before.BoardedAt.Local(), Valid: true}
+		params.BeforeID = before.ID
+	}
+
+	rows, err := r.q.ListRiderTrips(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("storage: ListTrips: %w", err)
+	}
+
+	trips := make([]RiderTrip, 0, len(rows))
+	for _, row := range rows {
+		trips = append(trips, rowToTrip(row))
+	}
+	return trips, nil
+}
+
+// SummarizeTrips groups the trips of deviceID boarded since since by month.
+func (r *pgTripsRepository) SummarizeTrips(ctx context.Context, deviceID string, since time.Time) ([]MonthlyTrips, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.q.SummarizeRiderTrips(ctx, db.SummarizeRiderTripsParams{
+		DeviceID: deviceID,
+		Since:    pgtype.Timestamp{Time: since.Local(), Valid: true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: SummarizeTrips: %w", err)
+	}
+
+	months := make([]MonthlyTrips, 0, len(rows))
+	for _, row := range rows {
+		months = append(months, MonthlyTrips{
+			Month:      LocalTime(row.Month),
+			Trips:      int(row.Trips),
+			TotalCents: int(row.TotalCents),
+		})
+	}
+	return months, nil
+}
+
+// pgRatingsRepository is the pgx-backed implementation of RatingsRepository.
+type pgRatingsRepository struct {
+	q *db.Queries
+}
+
+// NewRatingsRepository creates a RatingsRepository backed by the given connection pool.
+func NewRatingsRepository(pool *pgxpool.Pool) RatingsRepository {
+	return &pgRatingsRepository{q: db.New(pool)}
+}
+
+// CreateRating inserts a row into ratings.
+func (r *pgRatingsRepository) CreateRating(ctx context.Context, rt Rating) (*Rating, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	row, err := r.q.CreateRating(ctx, db.CreateRatingParams{
+		TripID:       rt.TripID,
+		RouteID:      rt.RouteID,
+		VehicleID:    optionalInt4(rt.VehicleID),
+		AssignmentID: optionalInt4(rt.AssignmentID),
+		DriverID:     optionalInt4(rt.DriverID),
+		CollectorID:  optionalInt4(rt.CollectorID),
+		Stars:        int16(rt.Stars),
+		Comment:      rt.Comment,
+		Tags:         nonNilStrings(rt.Tags),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: CreateRating: %w", mapWriteError(err))
+	}
+	created := rowToRating(row)
+	return &created, nil
+}
+
+// ListRatings returns one page of ratings.
+func (r *pgRatingsRepository) ListRatings(ctx context.Context, status string, beforeID int32, limit int) ([]Rating, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	params := db.ListRatingsParams{RowLimit: int32(limit)}
+	if status != "" {
+		params.Status = pgtype.Text{String: status, Valid: true}
+	}
+	if beforeID > 0 {
+		params.BeforeID = pgtype.Int4{Int32: beforeID, Valid: true}
+	}
+
+	rows, err := r.q.ListRatings(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("storage: ListRatings: %w", err)
+	}
+
+	ratings := make([]Rating, 0, len(rows))
+	for _, row := range rows {
+		ratings = append(ratings, rowToRating(row))
+	}
+	return ratings, nil
+}
+
+// SetRatingStatus updates the status of a rating, or returns (nil, nil) if
+// not found.
+func (r *pgRatingsRepository) SetRatingStatus(ctx context.Context, id int32, status string) (*Rating, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	row, err := r.q.SetRatingStatus(ctx, db.SetRatingStatusParams{Status: status, ID: id})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage: SetRatingStatus: %w", err)
+	}
+	rt := rowToRating(row)
+	return &rt, nil
+}
+
+// GetRatingAggregate counts the visible ratings and their tags of a subject.
+func (r *pgRatingsRepository) GetRatingAggregate(ctx context.Context, subject string, id int32) (*RatingAggregate, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var driver, collector, route pgtype.Int4
+	subjectID := pgtype.Int4{Int32: id, Valid: true}
+	switch subject {
+	case RatingSubjectDriver:
+		driver = subjectID
+	case RatingSubjectCollector:
+		collector = subjectID
+	case RatingSubjectRoute:
+		route = subjectID
+	default:
+		return nil, fmt.Errorf("storage: GetRatingAggregate: unknown subject %q", subject)
+	}
+
+	row, err := r.q.GetRatingAggregate(ctx, db.GetRatingAggregateParams{DriverID: driver, CollectorID: collector, RouteID: route})
+	if err != nil {
+		return nil, fmt.Errorf("storage: GetRatingAggregate: %w", err)
+	}
+	tags, err := r.q.CountRatingTags(ctx, db.CountRatingTagsParams{DriverID: driver, CollectorID: collector, RouteID: route})
+	if err != nil {
+		return nil, fmt.Errorf("storage: GetRatingAggregate: count tags: %w", err)
+	}
+
+	agg := &RatingAggregate{
+		Ratings:      int(row.Ratings),
+		AverageStars: row.AverageStars,
+		Tags:         make(map[string]int, len(tags)),
+	}
+	for _, t := range tags {
+		agg.Tags[t.Tag] = int(t.Ratings)
+	}
+	return agg, nil
+}
+
+func rowToRating(row db.Rating) Rating {
+	return Rating{
+		ID:           row.ID,
+		TripID:       row.TripID,
+		RouteID:      row.RouteID,
+		VehicleID:    int32Ptr(row.VehicleID),
+		AssignmentID: int32Ptr(row.AssignmentID),
+		DriverID:     int32Ptr(row.DriverID),
+		CollectorID:  int32Ptr(row.CollectorID),
+		Stars:        int(row.Stars),
+		Comment:      row.Comment,
+		Tags:         nonNilStrings(row.Tags),
+		Status:       row.Status,
+		CreatedAt:    LocalTime(row.CreatedAt),
+	}
+}
+
+// pgFavoritesRepository is the pgx-backed implementation of FavoritesRepository.
+type pgFavoritesRepository struct {
+	q *db.Queries
+}
+
+// NewFavoritesRepository creates a FavoritesRepository backed by the given connection pool.
+func NewFavoritesRepository(pool *pgxpool.Pool) FavoritesRepository {
+	return &pgFavoritesRepository{q: db.New(pool)}
+}
+
+// ListFavoriteStops returns the active favorite stops of a device.
+func (r *pgFavoritesRepository) ListFavoriteStops(ctx context.Context, deviceID string) ([]Stop, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.q.ListFavoriteStops(ctx, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: ListFavoriteStops: %w", err)
+	}
+
+	stops := make([]Stop, 0, len(rows))
+	for _, row := range rows {
+		s, err := rowToStop(row.ID, row.Name, row.Geom)
+		if err != nil {
+			return nil, fmt.Errorf("storage: ListFavoriteStops: parse geometry: %w", err)
+		}
+		stops = append(stops, s)
+	}
+	return stops, nil
+}
+
+// AddFavoriteStop inserts a row into favorite_stops unless it exists.
+func (r *pgFavoritesRepository) AddFavoriteStop(ctx context.Context, deviceID string, stopID int32) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	n, err := r.q.AddFavoriteStop(ctx, db.AddFavoriteStopParams{DeviceID: deviceID, StopID: stopID})
+	if err != nil {
+		return false, fmt.Errorf("storage: AddFavoriteStop: %w", err)
+	}
+	return n > 0, nil
+}
+
+// RemoveFavoriteStop deletes a row from favorite_stops.
+func (r *pgFavoritesRepository) RemoveFavoriteStop(ctx context.Context, deviceID string, stopID int32) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	n, err := r.q.DeleteFavoriteStop(ctx, db.DeleteFavoriteStopParams{DeviceID: deviceID, StopID: stopID})
+	if err != nil {
+		return false, fmt.Errorf("storage: RemoveFavoriteStop: %w", err)
+	}
+	return n > 0, nil
+}
+
+// ListFavoriteRoutes returns the active favorite routes of a device.
+func (r *pgFavoritesRepository) ListFavoriteRoutes(ctx context.Context, deviceID string) ([]FavoriteRoute, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.q.ListFavoriteRoutes(ctx, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: ListFavoriteRoutes: %w", err)
+	}
+
+	routes := make([]FavoriteRoute, len(rows))
+	for i, row := range rows {
+		routes[i] = FavoriteRoute{ID: row.ID, Name: row.Name}
+	}
+	return routes, nil
+}
+
+// AddFavoriteRoute inserts a row into favorite_routes unless it exists.
+func (r *pgFavoritesRepository) AddFavoriteRoute(ctx context.Context, deviceID string, routeID int32) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	n, err := r.q.AddFavoriteRoute(ctx, db.AddFavoriteRouteParams{DeviceID: deviceID, RouteID: routeID})
+	if err != nil {
+		return false, fmt.Errorf("storage: AddFavoriteRoute: %w", err)
+	}
+	return n > 0, nil
+}
+
+// RemoveFavoriteRoute deletes a row from favorite_routes.
+func (r *pgFavoritesRepository) RemoveFavoriteRoute(ctx context.Context, deviceID string, routeID int32) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	n, err := r.q.DeleteFavoriteRoute(ctx, db.DeleteFavoriteRouteParams{DeviceID: deviceID, RouteID: routeID})
+	if err != nil {
+		return false, fmt.Errorf("storage: RemoveFavoriteRoute: %w", err)
+	}
+	return n > 0, nil
+}
+
+// ListSavedPlaces returns the saved places of a device.
+func (r *pgFavoritesRepository) ListSavedPlaces(ctx context.Context, deviceID string) ([]SavedPlace, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.q.ListSavedPlaces(ctx, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("storage: ListSavedPlaces: %w", err)
+	}
+
+	places := make([]SavedPlace, 0, len(rows))
+	for _, row := range rows {
+		p, err := rowToSavedPlace(row)
+		if err != nil {
+			return nil, fmt.Errorf("storage: ListSavedPlaces: %w", err)
+		}
+		places = append(places, p)
+	}
+	return places, nil
+}
+
+// CreateSavedPlace inserts a row into saved_places.
+func (r *pgFavoritesRepository) CreateSavedPlace(ctx context.Context, p SavedPlace) (*SavedPlace, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	row, err := r.q.CreateSavedPlace(ctx, db.CreateSavedPlaceParams{
+		DeviceID: p.DeviceID,
+		Name:     p.Name,
+		Lon:      p.Lon,
+		Lat:      p.Lat,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: CreateSavedPlace: %w", mapWriteError(err))
+	}
+	created, err := rowToSavedPlace(db.ListSavedPlacesRow(row))
+	if err != nil {
+		return nil, fmt.Errorf("storage: CreateSavedPlace: %w", err)
+	}
+	return &created, nil
+}
+
+// UpdateSavedPlace replaces the name and location of a saved place.
+func (r *pgFavoritesRepository) UpdateSavedPlace(ctx context.Context, p SavedPlace) (*SavedPlace, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	row, err := r.q.UpdateSavedPlace(ctx, db.UpdateSavedPlaceParams{
+		Name:     p.Name,
+		Lon:      p.Lon,
+		Lat:      p.Lat,
+		ID:       p.ID,
+		DeviceID: p.DeviceID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage: UpdateSavedPlace: %w", mapWriteError(err))
+	}
+	updated, err := rowToSavedPlace(db.ListSavedPlacesRow(row))
+	if err != nil {
+		return nil, fmt.Errorf("storage: UpdateSavedPlace: %w", err)
+	}
+	return &updated, nil
+}
+
+// DeleteSavedPlace deletes a row from saved_places.
+func (r *pgFavoritesRepository) DeleteSavedPlace(ctx context.Context, deviceID string, id int32) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	n, err := r.q.DeleteSavedPlace(ctx, db.DeleteSavedPlaceParams{ID: id, DeviceID: deviceID})
+	if err != nil {
+		return false, fmt.Errorf("storage: DeleteSavedPlace: %w", err)
+	}
+	return n > 0, nil
+}
+
+func rowToSavedPlace(row db.ListSavedPlacesRow) (SavedPlace, error) {
+	wkt, ok := row.Geom.(string)
+	if !ok {
+		return SavedPlace{}, fmt.Errorf("unexpected geom type %T", row.Geom)
+	}
+	lat, lon, err := parsePointWKT(wkt)
+	if err != nil {
+		return SavedPlace{}, fmt.Errorf("parse geometry: %w", err)
+	}
+	return SavedPlace{
+		ID:        row.ID,
+		DeviceID:  row.DeviceID,
+		Name:      row.Name,
+		Lat:       lat,
+		Lon:       lon,
+		CreatedAt: LocalTime(row.CreatedAt),
+	}, nil
+}
+
+// pgTilesRepository is the pgx-backed implementation of TilesRepository.
+type pgTilesRepository struct {
+	q *db.Queries
+}
+
+// NewTilesRepository creates a TilesRepository backed by the given connection pool.
+func NewTilesRepository(pool *pgxpool.Pool) TilesRepository {
+	return &pgTilesRepository{q: db.New(pool)}
+}
+
+// GetNetworkVersion reads the single row of network_version.
+func (r *pgTilesRepository) GetNetworkVersion(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	v, err := r.q.GetNetworkVersion(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("storage: GetNetworkVersion: %w", err)
+	}
+	return v, nil
+}
+
+// GetTile renders tile z/x/y with ST_AsMVT.
+func (r *pgTilesRepository) GetTile(ctx context.Context, z, x, y int, withStops bool) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	tile, err := r.q.GetTile(ctx, db.GetTileParams{
+		Z:         int32(z),
+		X:         int32(x),
+		Y:         int32(y),
+		WithStops: withStops,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: GetTile: %w", err)
+	}
+	return tile, nil
+}
+
+// pgNetworkRepository is the pgx-backed implementation of NetworkRepository.
+type pgNetworkRepository struct {
+	pool *pgxpool.Pool
+	q    *db.Queries
+}
+
+// NewNetworkRepository creates a NetworkRepository backed by the given connection pool.
+func NewNetworkRepository(pool *pgxpool.Pool) NetworkRepository {
+	return &pgNetworkRepository{pool: pool, q: db.New(pool)}
+}
+
+// GetNetworkVersion reads the single row of network_version.
+func (r *pgNetworkRepository) GetNetworkVersion(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	v, err := r.q.GetNetworkVersion(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("storage: GetNetworkVersion: %w", err)
+	}
+	return v, nil
+}
+
+// GetNetworkSnapshot reads the version, stops and routes in one
+// repeatable-read transaction so that they match.
+func (r *pgNetworkRepository) GetNetworkSnapshot(ctx context.Context) (*NetworkSnapshot, error) {
+	var snap *NetworkSnapshot
+	err := r.readSnapshot(ctx, func(q *db.Queries) error {
+		v, err := q.GetNetworkVersion(ctx)
+		if err != nil {
+			return err
+		}
+		snap, err = listNetwork(ctx, q, v, nil, nil)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: GetNetworkSnapshot: %w", err)
+	}
+	return snap, nil
+}
+
+// GetNetworkChangesSince reads network_changes and the changed stops and
+// routes in one repeatable-read transaction.
+func (r *pgNetworkRepository) GetNetworkChangesSince(ctx context.Context, since int64) (*NetworkSnapshot, error) {
+	var snap *NetworkSnapshot
+	err := r.readSnapshot(ctx, func(q *db.Queries) error {
+		v, err := q.GetNetworkVersion(ctx)
+		if err != nil {
+			return err
+		}
+		if since >= v {
+			snap = &NetworkSnapshot{Version: v}
+			return nil
+		}
+
+		reset, err := q.HasNetworkResetSince(ctx, since)
+		if err != nil {
+			return err
+		}
+		if reset {
+			return ErrChangeLogGap
+		}
+
+		changes, err := q.ListNetworkChangesSince(ctx, since)
+		if err != nil {
+			return err
+		}
+		stopIDs, routeIDs := []int32{}, []int32{}
+		for _, c := range changes {
+			if c.Entity == "stop" {
+				stopIDs = append(stopIDs, c.EntityID)
+			} else {
+				routeIDs = append(routeIDs, c.EntityID)
+			}
+		}
+		// Route stop lists only hold active stops, so a stop change can
+		// change the routes serving it.
+		if len(stopIDs) > 0 {
+			serving, err := q.ListRoutesServingStops(ctx, stopIDs)
+			if err != nil {
+				return err
+			}
+			for _, s := range serving {
+				if !slices.Contains(routeIDs, s.ID) {
+					routeIDs = append(routeIDs, s.ID)
+				}
+			}
+		}
+
+		snap, err = listNetwork(ctx, q, v, stopIDs, routeIDs)
+		if err != nil {
+			return err
+		}
+		snap.RemovedStopIDs = missingIDs(stopIDs, snap.Stops, func(s Stop) int32 { return s.ID })
+		snap.RemovedRouteIDs = missingIDs(routeIDs, snap.Routes, func(r NetworkRoute) int32 { return r.ID })
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: GetNetworkChangesSince: %w", err)
+	}
+	return snap, nil
+}
+
+// readSnapshot runs fn in a read-only repeatable-read transaction: every
+// query sees the same committed state of the network.
+func (r *pgNetworkRepository) readSnapshot(ctx context.Context, fn func(q *db.Queries) error) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // no-op after Commit
+
+	if err := fn(r.q.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// listNetwork reads the active stops and routes with the given IDs; nil IDs
+// read all of them.
+func listNetwork(ctx context.Context, q *db.Queries, version int64, stopIDs, routeIDs []int32) (*NetworkSnapshot, error) {
+	snap := &NetworkSnapshot{Version: version, Stops: []Stop{}, Routes: []NetworkRoute{}}
+
+	// An empty (non-nil) filter would match nothing anyway.
+	if stopIDs == nil || len(stopIDs) > 0 {
+		rows, err := q.ListNetworkStops(ctx, stopIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			s, err := rowToStop(row.ID, row.Name, row.Geom)
+			if err != nil {
+				return nil, err
+			}
+			snap.Stops = append(snap.Stops, s)
+		}
+	}
+	if routeIDs == nil || len(routeIDs) > 0 {
+		rows, err := q.ListNetworkRoutes(ctx, routeIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			snap.Routes = append(snap.Routes, NetworkRoute{
+				ID:       row.ID,
+				Name:     row.Name,
+				HeadwayS: intPtr(row.ScheduledHeadwayS),
+				StopIDs:  row.StopIds,
+				Shape:    row.Shape,
+			})
+		}
+	}
+	return snap, nil
+}
+
+// missingIDs returns the IDs in want that no item has, in order.
+func missingIDs[T any](want []int32, items []T, id func(T) int32) []int32 {
+	have := make(map[int32]bool, len(items))
+	for _, it := range items {
+		have[id(it)] = true
+	}
+	missing := []int32{}
+	for _, w := range want {
+		if !have[w] {
+			missing = append(missing, w)
+		}
+	}
+	return missing
+}
+
+// rowToVehicle converts a vehicles row into a Vehicle domain object.
+func rowToVehicle(row db.Vehicle) Vehicle {
+	return Vehicle{
+		ID:                    row.ID,
+		Plate:                 row.Plate,
+		Operator:              row.Operator,
+		Capacity:              int(row.Capacity),
+		AccessibilityFeatures: nonNilStrings(row.AccessibilityFeatures),
+		Active:                row.Active,
+		CreatedAt:             LocalTime(row.CreatedAt),
+	}
+}
+
+// rowToAssignment converts a vehicle_assignments row into a VehicleAssignment.
+func rowToAssignment(row db.VehicleAssignment) VehicleAssignment {
+	a := VehicleAssignment{
+		ID:        row.ID,
+		VehicleID: row.VehicleID,
+		RouteID:   row.RouteID,
+		StartsAt:  LocalTime(row.StartsAt),
+	}
+	if row.DriverID.Valid {
+		id := row.DriverID.Int32
+		a.DriverID = &id
+	}
+	if row.EndsAt.Valid {
+		t := LocalTime(row.EndsAt)
+		a.EndsAt = &t
+	}
+	if row.CollectorID.Valid {
+		id := row.CollectorID.Int32
+		a.CollectorID = &id
+	}
+	if row.StartedAt.Valid {
+		t := LocalTime(row.StartedAt)
+		a.StartedAt = &t
+	}
+	if row.EndedAt.Valid {
+		t := LocalTime(row.EndedAt)
+		a.EndedAt = &t
+	}
+	return a
+}
+
+// rowToTrip converts a rider_trips row into a RiderTrip.
+func rowToTrip(row db.RiderTrip) RiderTrip {
+	t := RiderTrip{
+		ID:             row.ID,
+		DeviceID:       row.DeviceID,
+		RouteID:        row.RouteID,
+		BoardingStopID: row.BoardingStop,
+		BoardedAt:      LocalTime(row.BoardedAt),
+		FareCents:      intPtr(row.FareCents),
+		Source:         row.Source,
+		CreatedAt:      LocalTime(row.CreatedAt),
+	}
+	if row.VehicleID.Valid {
+		id := row.VehicleID.Int32
+		t.VehicleID = &id
+	}
+	if row.AlightingStop.Valid {
+		id := row.AlightingStop.Int32
+		t.AlightingStopID = &id
+	}
+	if row.AlightedAt.Valid {
+		at := LocalTime(row.AlightedAt)
+		t.AlightedAt = &at
+	}
+	return t
+}
+
+// optionalInt4 converts an optional ID into a nullable INT parameter.
+func optionalInt4(id *int32) pgtype.Int4 {
+	if id == nil {
+		return pgtype.Int4{}
+	}
+	return pgtype.Int4{Int32: *id, Valid: true}
+}
+
+// int32Ptr converts a nullable INT ID column into a *int32 (nil when NULL).
+func int32Ptr(v pgtype.Int4) *int32 {
+	if !v.Valid {
+		return nil
+	}
+	id := v.Int32
+	return &id
+}
+
+// intPtr converts a nullable INT column into a *int (nil when NULL).
+func intPtr(v pgtype.Int4) *int {
+	if !v.Valid {
+		return nil
+	}
+	n := int(v.Int32)
+	return &n
+}
+
+// nonNilStrings returns s, or an empty slice when s is nil, so TEXT[] columns
+// are written as '{}' rather than NULL and JSON encodes them as [].
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// mapWriteError translates constraint violations into the package sentinel
+// errors, wrapping the original error so details stay available to logs.
+func mapWriteError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch pgErr.Code {
+	case "23505", "23P01": // unique_violation, exclusion_violation
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case "23503": // foreign_key_violation
+		return fmt.Errorf("%w: %w", ErrInvalidReference, err)
+	}
+	return err
+}
+
+// rowToStop converts a raw query row into a Stop domain object.
+// geom must be a WKT POINT string produced by ST_AsText, e.g. "POINT(lon lat)".
+func rowToStop(id int32, name string, geom interface{}) (Stop, error) {
+	if geom == nil {
+		return Stop{}, fmt.Errorf("stop id=%d has NULL geometry (data integrity issue)", id)
+	}
+	wkt, ok := geom.(string)
+	if !ok {
+		return Stop{}, fmt.Errorf("unexpected geom type %T", geom)
+	}
+
+	lat, lon, err := parsePointWKT(wkt)
+	if err != nil {
+		return Stop{}, err
+	}
+
+	return Stop{
+		ID:   id,
+		Name: name,
+		Lat:  lat,
+		Lon:  lon,
+	}, nil
+}
+
+// LocalTime converts a TIMESTAMP (without time zone) column value into a
+// time.Time in the server's local zone. pgx returns such values with their
+// wall clock in UTC, but every TIMESTAMP in the schema is written as local
+// time (NOW() or a time.Time from time.Now()). Exported for the cache stores
+// of the routing and service packages.
+func LocalTime(ts pgtype.Timestamp) time.Time {
+	t := ts.Time
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
 }
 
 // parsePointWKT parses a WKT POINT string into (lat, lon).
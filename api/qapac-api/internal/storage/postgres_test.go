@@ -1,7 +1,12 @@
 package storage
 
 import (
+	"errors"
 	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 func TestParsePointWKT(t *testing.T) {
@@ -152,3 +157,64 @@ func TestRowToStop(t *testing.T) {
 		})
 	}
 }
+
+func TestLocalTime(t *testing.T) {
+	// pgx decodes TIMESTAMP columns with the stored wall clock in UTC.
+	ts := pgtype.Timestamp{Time: time.Date(2025, 3, 10, 7, 30, 0, 0, time.UTC), Valid: true}
+
+	got := LocalTime(ts)
+
+	if got.Location() != time.Local {
+		t.Errorf("location = %v, want Local", got.Location())
+	}
+	if got.Hour() != 7 || got.Minute() != 30 || got.Day() != 10 {
+		t.Errorf("wall clock = %v, want 2025-03-10 07:30 local", got)
+	}
+}
+
+func TestLocalTime_NonUTCZone(t *testing.T) {
+	// Lima (UTC-5): a row written with time.Now() comes back with the same
+	// wall clock labelled UTC, i.e. 5 h in the future if read as is.
+	defer func(loc *time.Location) { time.Local = loc }(time.Local)
+	time.Local = time.FixedZone("PET", -5*60*60)
+
+	written := time.Now().Add(-30 * time.Second)
+	read := pgtype.Timestamp{Time: time.Date(written.Year(), written.Month(), written.Day(),
+		written.Hour(), written.Minute(), written.Second(), written.Nanosecond(), time.UTC), Valid: true}
+
+	if age := time.Since(LocalTime(read)); age < 29*time.Second || age > time.Minute {
+		t.Errorf("age = %v, want about 30s", age)
+	}
+}
+
+func TestMapWriteError(t *testing.T) {
+	tests := []struct {
+		code string
+		want error
+	}{
+		{"23505", ErrConflict},
+		{"23P01", ErrConflict},
+		{"23503", ErrInvalidReference},
+	}
+	for _, tt := range tests {
+		err := mapWriteError(&pgconn.PgError{Code: tt.code})
+		if !errors.Is(err, tt.want) {
+			t.Errorf("code %s: got %v, want %v", tt.code, err, tt.want)
+		}
+	}
+
+	other := errors.New("connection reset")
+	if got := mapWriteError(other); got != other {
+		t.Errorf("non-pg error = %v, want it unchanged", got)
+	}
+}
+
+func TestMissingIDs(t *testing.T) {
+	stops := []Stop{{ID: 1}, {ID: 3}}
+
+	got := missingIDs([]int32{3, 2, 1, 4}, stops, func(s Stop) int32 { return s.ID })
+
+	if len(got) != 2 || got[0] != 2 || got[1] != 4 {
+		t.Errorf("missingIDs = %v, want [2 4]", got)
+	}
+}
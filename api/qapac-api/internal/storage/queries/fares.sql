@@ -0,0 +1,48 @@
+-- name: GetRideLeg :one
+-- Distance is measured along the route shape between the projections of both
+-- stops; routes without a shape fall back to the straight-line distance.
+SELECT r.network_id,
+       fs.sequence AS from_sequence,
+       ts.sequence AS to_sequence,
+       COALESCE(
+         ST_Length(ST_LineSubstring(
+           sh.geom,
+           LEAST(ST_LineLocatePoint(sh.geom, f.geom), ST_LineLocatePoint(sh.geom, t.geom)),
+           GREATEST(ST_LineLocatePoint(sh.geom, f.geom), ST_LineLocatePoint(sh.geom, t.geom))
+         )::geography),
+         ST_Distance(f.geom::geography, t.geom::geography)
+       )::float8 AS distance_m
+FROM routes r
+JOIN route_stops fs ON fs.route_id = r.id AND fs.stop_id = sqlc.arg(from_stop_id)::int
+JOIN route_stops ts ON ts.route_id = r.id AND ts.stop_id = sqlc.arg(to_stop_id)::int
+JOIN stops f ON f.id = fs.stop_id AND f.active = true
+JOIN stops t ON t.id = ts.stop_id AND t.active = true
+LEFT JOIN route_shapes sh ON sh.route_id = r.id
+WHERE r.id = sqlc.arg(route_id)::int AND r.active = true;
+
+-- name: ListStopAreas :many
+SELECT stop_id, area_id
+FROM stop_areas
+WHERE stop_id = ANY(sqlc.arg(stop_ids)::int[])
+ORDER BY stop_id, area_id;
+
+-- name: ListRiderCategories :many
+SELECT id, name, is_default
+FROM rider_categories
+ORDER BY id;
+
+-- name: ListFareProducts :many
+SELECT id, rider_category_id, name, amount_cents, currency
+FROM fare_products
+ORDER BY id, rider_category_id;
+
+-- name: ListFareLegRules :many
+SELECT id, leg_group_id, network_id, from_area_id, to_area_id,
+       min_distance_m, max_distance_m, fare_product_id, rule_priority
+FROM fare_leg_rules
+ORDER BY id;
+
+-- name: ListFareTransferRules :many
+SELECT id, from_leg_group_id, to_leg_group_id, fare_transfer_type, fare_product_id
+FROM fare_transfer_rules
+ORDER BY id;
@@ -0,0 +1,57 @@
+-- name: ListFavoriteStops :many
+-- Favorite stops of a device in the order they were added. Inactive stops
+-- are kept but not listed.
+SELECT s.id, s.name, ST_AsText(s.geom) AS geom
+FROM favorite_stops f
+JOIN stops s ON s.id = f.stop_id AND s.active = true
+WHERE f.device_id = sqlc.arg(device_id)
+ORDER BY f.created_at, f.stop_id;
+
+-- name: AddFavoriteStop :execrows
+-- Affects no row when the stop does not exist or is inactive; adding a
+-- favorite twice keeps its place in the list.
+INSERT INTO favorite_stops (device_id, stop_id)
+SELECT sqlc.arg(device_id), id FROM stops WHERE id = sqlc.arg(stop_id)::int AND active = true
+ON CONFLICT (device_id, stop_id) DO UPDATE SET created_at = favorite_stops.created_at;
+
+-- name: DeleteFavoriteStop :execrows
+DELETE FROM favorite_stops
+WHERE device_id = sqlc.arg(device_id) AND stop_id = sqlc.arg(stop_id)::int;
+
+-- name: ListFavoriteRoutes :many
+SELECT r.id, r.name
+FROM favorite_routes f
+JOIN routes r ON r.id = f.route_id AND r.active = true
+WHERE f.device_id = sqlc.arg(device_id)
+ORDER BY f.created_at, f.route_id;
+
+-- name: AddFavoriteRoute :execrows
+INSERT INTO favorite_routes (device_id, route_id)
+SELECT sqlc.arg(device_id), id FROM routes WHERE id = sqlc.arg(route_id)::int AND active = true
+ON CONFLICT (device_id, route_id) DO UPDATE SET created_at = favorite_routes.created_at;
+
+-- name: DeleteFavoriteRoute :execrows
+DELETE FROM favorite_routes
+WHERE device_id = sqlc.arg(device_id) AND route_id = sqlc.arg(route_id)::int;
+
+-- name: ListSavedPlaces :many
+SELECT id, device_id, name, ST_AsText(geom) AS geom, created_at
+FROM saved_places
+WHERE device_id = sqlc.arg(device_id)
+ORDER BY created_at, id;
+
+-- name: CreateSavedPlace :one
+INSERT INTO saved_places (device_id, name, geom)
+VALUES (sqlc.arg(device_id), sqlc.arg(name), ST_SetSRID(ST_MakePoint(sqlc.arg(lon)::float8, sqlc.arg(lat)::float8), 4326))
+RETURNING id, device_id, name, ST_AsText(geom) AS geom, created_at;
+
+-- name: UpdateSavedPlace :one
+UPDATE saved_places
+SET name = sqlc.arg(name),
+    geom = ST_SetSRID(ST_MakePoint(sqlc.arg(lon)::float8, sqlc.arg(lat)::float8), 4326)
+WHERE id = sqlc.arg(id)::int AND device_id = sqlc.arg(device_id)
+RETURNING id, device_id, name, ST_AsText(geom) AS geom, created_at;
+
+-- name: DeleteSavedPlace :execrows
+DELETE FROM saved_places
+WHERE id = sqlc.arg(id)::int AND device_id = sqlc.arg(device_id);
@@ -0,0 +1,45 @@
+-- name: InsertStopArrival :exec
+INSERT INTO stop_arrivals (route_id, stop_id, vehicle_id, arrived_at)
+VALUES (sqlc.arg(route_id)::int, sqlc.arg(stop_id)::int, sqlc.arg(vehicle_id)::int, sqlc.arg(arrived_at));
+
+-- name: ListStopArrivals :many
+SELECT stop_id, vehicle_id, arrived_at
+FROM stop_arrivals
+WHERE route_id = sqlc.arg(route_id)::int
+  AND arrived_at >= sqlc.arg(from_ts)
+  AND arrived_at <  sqlc.arg(to_ts)
+ORDER BY stop_id, arrived_at;
+
+-- name: GetScheduledHeadway :one
+SELECT scheduled_headway_s
+FROM routes
+WHERE id = sqlc.arg(id)::int;
+
+-- name: FindRouteStopNear :one
+SELECT rs.stop_id,
+       ST_Distance(s.geom::geography, ST_SetSRID(ST_MakePoint(sqlc.arg(lon)::float8, sqlc.arg(lat)::float8), 4326)::geography)::float8 AS distance_m
+FROM route_stops rs
+JOIN stops s ON s.id = rs.stop_id
+WHERE rs.route_id = sqlc.arg(route_id)::int
+  AND ST_DWithin(s.geom::geography, ST_SetSRID(ST_MakePoint(sqlc.arg(lon)::float8, sqlc.arg(lat)::float8), 4326)::geography, sqlc.arg(radius_m)::float8)
+ORDER BY distance_m
+LIMIT 1;
+
+-- name: ListApproachingVehicles :many
+-- For each stop in stop_ids, the vehicle expected next: among the vehicles
+-- whose latest arrival since since was at an earlier stop of a route serving
+-- it, the one the fewest stops away, then the one that arrived last.
+WITH latest AS (
+  SELECT DISTINCT ON (vehicle_id) vehicle_id, route_id, stop_id, arrived_at
+  FROM stop_arrivals
+  WHERE arrived_at >= sqlc.arg(since)::timestamp
+    AND route_id IN (SELECT route_id FROM route_stops WHERE stop_id = ANY(sqlc.arg(stop_ids)::int[]))
+  ORDER BY vehicle_id, arrived_at DESC
+)
+SELECT DISTINCT ON (target.stop_id) target.stop_id, l.vehicle_id
+FROM route_stops target
+JOIN latest l ON l.route_id = target.route_id
+JOIN route_stops passed ON passed.route_id = l.route_id AND passed.stop_id = l.stop_id
+WHERE target.stop_id = ANY(sqlc.arg(stop_ids)::int[])
+  AND passed.sequence < target.sequence
+ORDER BY target.stop_id, target.sequence - passed.sequence, l.arrived_at DESC;
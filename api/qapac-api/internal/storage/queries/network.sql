@@ -0,0 +1,38 @@
+-- name: HasNetworkResetSince :one
+SELECT EXISTS (
+  SELECT 1 FROM network_changes
+  WHERE entity = 'reset' AND version > sqlc.arg(since)::bigint
+) AS reset;
+
+-- name: ListNetworkChangesSince :many
+SELECT DISTINCT entity, entity_id::int AS entity_id
+FROM network_changes
+WHERE version > sqlc.arg(since)::bigint
+  AND entity IN ('stop', 'route')
+ORDER BY entity, entity_id;
+
+-- name: ListNetworkRoutes :many
+-- Active routes with their stops in sequence (active stops only) and their
+-- shape as an encoded polyline. A NULL ids lists every route.
+SELECT r.id, r.name, r.scheduled_headway_s,
+       COALESCE(ST_AsEncodedPolyline(sh.geom), '')::text AS shape,
+       ARRAY(
+         SELECT rs.stop_id
+         FROM route_stops rs
+         JOIN stops s ON s.id = rs.stop_id AND s.active = true
+         WHERE rs.route_id = r.id
+         ORDER BY rs.sequence
+       )::int[] AS stop_ids
+FROM routes r
+LEFT JOIN route_shapes sh ON sh.route_id = r.id
+WHERE r.active = true
+  AND (sqlc.narg(ids)::int[] IS NULL OR r.id = ANY(sqlc.narg(ids)::int[]))
+ORDER BY r.id;
+
+-- name: ListNetworkStops :many
+-- Active stops; a NULL ids lists every stop.
+SELECT id, name, ST_AsText(geom) AS geom
+FROM stops
+WHERE active = true
+  AND (sqlc.narg(ids)::int[] IS NULL OR id = ANY(sqlc.narg(ids)::int[]))
+ORDER BY id;
@@ -0,0 +1,10 @@
+-- name: InsertOccupancyReport :exec
+INSERT INTO occupancy_reports (vehicle_id, status, source, reported_at)
+VALUES (sqlc.arg(vehicle_id)::int, sqlc.arg(status)::smallint, sqlc.arg(source), sqlc.arg(reported_at)::timestamp);
+
+-- name: ListOccupancyReportsSince :many
+SELECT vehicle_id, status, source, reported_at
+FROM occupancy_reports
+WHERE vehicle_id = ANY(sqlc.arg(vehicle_ids)::int[])
+  AND reported_at >= sqlc.arg(since)::timestamp
+ORDER BY vehicle_id, reported_at;
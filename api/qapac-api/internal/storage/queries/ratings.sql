@@ -0,0 +1,43 @@
+-- name: CreateRating :one
+INSERT INTO ratings (trip_id, route_id, vehicle_id, assignment_id, driver_id, collector_id, stars, comment, tags)
+VALUES (sqlc.arg(trip_id)::int, sqlc.arg(route_id)::int, sqlc.narg(vehicle_id)::int, sqlc.narg(assignment_id)::int,
+        sqlc.narg(driver_id)::int, sqlc.narg(collector_id)::int, sqlc.arg(stars)::smallint, sqlc.arg(comment), sqlc.arg(tags)::text[])
+RETURNING id, trip_id, route_id, vehicle_id, assignment_id, driver_id, collector_id, stars, comment, tags, status, created_at;
+
+-- name: ListRatings :many
+-- Pages through the ratings, most recent first. A NULL status lists every
+-- status; a NULL before_id starts at the most recent rating.
+SELECT id, trip_id, route_id, vehicle_id, assignment_id, driver_id, collector_id, stars, comment, tags, status, created_at
+FROM ratings
+WHERE (sqlc.narg(status)::text IS NULL OR status = sqlc.narg(status)::text)
+  AND (sqlc.narg(before_id)::int IS NULL OR id < sqlc.narg(before_id)::int)
+ORDER BY id DESC
+LIMIT sqlc.arg(row_limit)::int;
+
+-- name: SetRatingStatus :one
+UPDATE ratings
+SET status = sqlc.arg(status)
+WHERE id = sqlc.arg(id)::int
+RETURNING id, trip_id, route_id, vehicle_id, assignment_id, driver_id, collector_id, stars, comment, tags, status, created_at;
+
+-- name: GetRatingAggregate :one
+-- Aggregates the visible ratings of one driver, collector or route: exactly
+-- one of the three arguments is set, and the comparisons with the other two
+-- are NULL, so each arm can use its partial index.
+SELECT COUNT(*)::int AS ratings, COALESCE(AVG(stars), 0)::float8 AS average_stars
+FROM ratings
+WHERE status = 'visible'
+  AND (driver_id = sqlc.narg(driver_id)::int
+       OR collector_id = sqlc.narg(collector_id)::int
+       OR route_id = sqlc.narg(route_id)::int);
+
+-- name: CountRatingTags :many
+-- Counts the tags of the ratings aggregated by GetRatingAggregate.
+SELECT tag::text AS tag, COUNT(*)::int AS ratings
+FROM ratings, unnest(tags) AS tag
+WHERE status = 'visible'
+  AND (driver_id = sqlc.narg(driver_id)::int
+       OR collector_id = sqlc.narg(collector_id)::int
+       OR route_id = sqlc.narg(route_id)::int)
+GROUP BY tag
+ORDER BY tag;
@@ -1,16 +1,64 @@
 -- name: FindStopsNear :many
-SELECT id, name, ST_AsText(geom) AS geom
+SELECT id, name, ST_AsText(geom) AS geom,
+       ST_Distance(geom::geography, ST_SetSRID(ST_MakePoint(sqlc.arg(lon)::float8, sqlc.arg(lat)::float8), 4326)::geography)::float8 AS distance_m
 FROM stops
 WHERE ST_DWithin(geom::geography, ST_SetSRID(ST_MakePoint(sqlc.arg(lon)::float8, sqlc.arg(lat)::float8), 4326)::geography, sqlc.arg(radius_m)::float8)
   AND active = true
-ORDER BY ST_Distance(geom::geography, ST_SetSRID(ST_MakePoint(sqlc.arg(lon)::float8, sqlc.arg(lat)::float8), 4326)::geography);
+ORDER BY distance_m;
 
 -- name: GetStop :one
 SELECT id, name, ST_AsText(geom) AS geom
 FROM stops
 WHERE id = sqlc.arg(id)::int AND active = true;
 
+-- name: ListStopsInBBox :many
+-- With grid_deg > 0 only the lowest-ID stop of each grid cell is kept, so
+-- dense areas are thinned at low zoom levels; 0 disables thinning.
+SELECT id, name, geom
+FROM (
+  SELECT DISTINCT ON (cell_x, cell_y) id, name, ST_AsText(geom) AS geom
+  FROM (
+    SELECT id, name, geom,
+           CASE WHEN sqlc.arg(grid_deg)::float8 > 0 THEN floor(ST_X(geom) / sqlc.arg(grid_deg)::float8) ELSE id END AS cell_x,
+           CASE WHEN sqlc.arg(grid_deg)::float8 > 0 THEN floor(ST_Y(geom) / sqlc.arg(grid_deg)::float8) ELSE 0 END AS cell_y
+    FROM stops
+    WHERE geom && ST_MakeEnvelope(sqlc.arg(min_lon)::float8, sqlc.arg(min_lat)::float8, sqlc.arg(max_lon)::float8, sqlc.arg(max_lat)::float8, 4326)
+      AND active = true
+  ) cells
+  ORDER BY cell_x, cell_y, id
+) thinned
+WHERE id > sqlc.arg(after_id)::int
+ORDER BY id
+LIMIT sqlc.arg(page_limit)::int;
+
+-- name: ListRoutesServingStops :many
+SELECT DISTINCT rs.stop_id, r.id, r.name
+FROM route_stops rs
+JOIN routes r ON r.id = rs.route_id AND r.active = true
+WHERE rs.stop_id = ANY(sqlc.arg(stop_ids)::int[])
+ORDER BY rs.stop_id, r.id;
+
 -- name: GetRouteShape :one
 SELECT id, route_id, ST_AsText(geom) AS geom
 FROM route_shapes
 WHERE route_id = sqlc.arg(route_id)::int;
+
+-- name: DistanceToRouteShape :one
+SELECT ST_Distance(geom::geography, ST_SetSRID(ST_MakePoint(sqlc.arg(lon)::float8, sqlc.arg(lat)::float8), 4326)::geography)::float8 AS distance_m
+FROM route_shapes
+WHERE route_id = sqlc.arg(route_id)::int;
+
+-- name: SearchStops :many
+-- Ranks by trigram word similarity of the accent-folded name; with near a
+-- stop 20 km or more away loses 0.3, closer stops proportionally less.
+WITH q AS (SELECT lower(immutable_unaccent(sqlc.arg(query)::text)) AS text)
+SELECT s.id, s.name, ST_AsText(s.geom) AS geom,
+       (word_similarity(q.text, lower(immutable_unaccent(s.name)))
+        - CASE WHEN sqlc.arg(near)::bool
+               THEN 0.3 * least(ST_Distance(s.geom::geography, ST_SetSRID(ST_MakePoint(sqlc.arg(lon)::float8, sqlc.arg(lat)::float8), 4326)::geography) / 20000.0, 1)
+               ELSE 0 END)::float8 AS score
+FROM stops s, q
+WHERE q.text <% lower(immutable_unaccent(s.name))
+  AND s.active = true
+ORDER BY score DESC, s.id
+LIMIT sqlc.arg(page_limit)::int;
@@ -0,0 +1,35 @@
+-- name: GetNetworkVersion :one
+SELECT version FROM network_version;
+
+-- name: GetTile :one
+-- Renders tile z/x/y as a Mapbox Vector Tile with a "routes" layer and, when
+-- with_stops is set, a "stops" layer. Geometry is stored in WGS-84 and
+-- filtered with the GiST indexes before projecting to Web Mercator.
+WITH bounds AS (
+  SELECT ST_TileEnvelope(sqlc.arg(z)::int, sqlc.arg(x)::int, sqlc.arg(y)::int) AS merc,
+         ST_Transform(ST_TileEnvelope(sqlc.arg(z)::int, sqlc.arg(x)::int, sqlc.arg(y)::int), 4326) AS wgs
+),
+route_features AS (
+  SELECT r.id, r.name,
+         ST_AsMVTGeom(ST_Transform(rs.geom, 3857), b.merc) AS geom
+  FROM route_shapes rs
+  JOIN routes r ON r.id = rs.route_id
+  CROSS JOIN bounds b
+  WHERE r.active = true
+    AND rs.geom && b.wgs
+),
+stop_features AS (
+  SELECT s.id, s.name,
+         (SELECT count(*) FROM route_stops rst JOIN routes r ON r.id = rst.route_id
+          WHERE rst.stop_id = s.id AND r.active = true)::int AS route_count,
+         ST_AsMVTGeom(ST_Transform(s.geom, 3857), b.merc) AS geom
+  FROM stops s
+  CROSS JOIN bounds b
+  WHERE sqlc.arg(with_stops)::boolean
+    AND s.active = true
+    AND s.geom && b.wgs
+)
+SELECT (SELECT COALESCE(ST_AsMVT(route_features, 'routes', 4096, 'geom'), ''::bytea)
+        FROM route_features WHERE geom IS NOT NULL)
+    || (SELECT COALESCE(ST_AsMVT(stop_features, 'stops', 4096, 'geom'), ''::bytea)
+        FROM stop_features WHERE geom IS NOT NULL) AS tile;
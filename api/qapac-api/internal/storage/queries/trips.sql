@@ -0,0 +1,48 @@
+-- name: AbandonOpenRiderTrip :execrows
+-- Closes the open trip of a device, without an alighting stop or fare, at
+-- the earlier of at and its boarding time plus expiry_s seconds.
+UPDATE rider_trips
+SET alighted_at = LEAST(sqlc.arg(at)::timestamp, boarded_at + make_interval(secs => sqlc.arg(expiry_s)::float8))
+WHERE device_id = sqlc.arg(device_id) AND alighted_at IS NULL;
+
+-- name: CreateRiderTrip :one
+INSERT INTO rider_trips (device_id, route_id, vehicle_id, boarding_stop, alighting_stop, boarded_at, alighted_at, fare_cents, source)
+VALUES (sqlc.arg(device_id), sqlc.arg(route_id)::int, sqlc.narg(vehicle_id)::int, sqlc.arg(boarding_stop)::int, sqlc.narg(alighting_stop)::int,
+        sqlc.arg(boarded_at)::timestamp, sqlc.narg(alighted_at)::timestamp, sqlc.narg(fare_cents)::int, sqlc.arg(source))
+RETURNING id, device_id, route_id, vehicle_id, boarding_stop, alighting_stop, boarded_at, alighted_at, fare_cents, source, created_at;
+
+-- name: GetRiderTrip :one
+SELECT id, device_id, route_id, vehicle_id, boarding_stop, alighting_stop, boarded_at, alighted_at, fare_cents, source, created_at
+FROM rider_trips
+WHERE id = sqlc.arg(id)::int AND device_id = sqlc.arg(device_id);
+
+-- name: CloseRiderTrip :one
+UPDATE rider_trips
+SET alighting_stop = sqlc.narg(alighting_stop)::int,
+    alighted_at    = sqlc.arg(alighted_at)::timestamp,
+    fare_cents     = sqlc.narg(fare_cents)::int
+WHERE id = sqlc.arg(id)::int
+  AND device_id = sqlc.arg(device_id)
+  AND alighted_at IS NULL
+RETURNING id, device_id, route_id, vehicle_id, boarding_stop, alighting_stop, boarded_at, alighted_at, fare_cents, source, created_at;
+
+-- name: ListRiderTrips :many
+-- Pages through the trips of a device, most recent first. A NULL
+-- before_boarded_at starts at the most recent trip.
+SELECT id, device_id, route_id, vehicle_id, boarding_stop, alighting_stop, boarded_at, alighted_at, fare_cents, source, created_at
+FROM rider_trips
+WHERE device_id = sqlc.arg(device_id)
+  AND (sqlc.narg(before_boarded_at)::timestamp IS NULL
+       OR (boarded_at, id) < (sqlc.narg(before_boarded_at)::timestamp, sqlc.arg(before_id)::int))
+ORDER BY boarded_at DESC, id DESC
+LIMIT sqlc.arg(row_limit)::int;
+
+-- name: SummarizeRiderTrips :many
+SELECT date_trunc('month', boarded_at)::timestamp AS month,
+       count(*)::int                              AS trips,
+       COALESCE(sum(fare_cents), 0)::int          AS total_cents
+FROM rider_trips
+WHERE device_id = sqlc.arg(device_id)
+  AND boarded_at >= sqlc.arg(since)::timestamp
+GROUP BY month
+ORDER BY month;
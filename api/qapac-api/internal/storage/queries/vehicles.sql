@@ -0,0 +1,75 @@
+-- name: ListVehicles :many
+SELECT id, plate, operator, capacity, accessibility_features, active, created_at
+FROM vehicles
+WHERE NOT sqlc.arg(only_active)::bool OR active = true
+ORDER BY id;
+
+-- name: GetVehicle :one
+SELECT id, plate, operator, capacity, accessibility_features, active, created_at
+FROM vehicles
+WHERE id = sqlc.arg(id)::int;
+
+-- name: CreateVehicle :one
+INSERT INTO vehicles (plate, operator, capacity, accessibility_features, active)
+VALUES (sqlc.arg(plate), sqlc.arg(operator), sqlc.arg(capacity)::int, sqlc.arg(accessibility_features)::text[], sqlc.arg(active)::bool)
+RETURNING id, plate, operator, capacity, accessibility_features, active, created_at;
+
+-- name: UpdateVehicle :one
+UPDATE vehicles
+SET plate                  = sqlc.arg(plate),
+    operator               = sqlc.arg(operator),
+    capacity               = sqlc.arg(capacity)::int,
+    accessibility_features = sqlc.arg(accessibility_features)::text[],
+    active                 = sqlc.arg(active)::bool
+WHERE id = sqlc.arg(id)::int
+RETURNING id, plate, operator, capacity, accessibility_features, active, created_at;
+
+-- name: DeactivateVehicle :execrows
+UPDATE vehicles SET active = false WHERE id = sqlc.arg(id)::int;
+
+-- name: ListVehicleAssignments :many
+SELECT id, vehicle_id, route_id, driver_id, starts_at, ends_at, collector_id, started_at, ended_at
+FROM vehicle_assignments
+WHERE vehicle_id = sqlc.arg(vehicle_id)::int
+ORDER BY starts_at DESC;
+
+-- name: CreateVehicleAssignment :one
+INSERT INTO vehicle_assignments (vehicle_id, route_id, driver_id, starts_at, ends_at, collector_id)
+VALUES (sqlc.arg(vehicle_id)::int, sqlc.arg(route_id)::int, sqlc.narg(driver_id)::int, sqlc.arg(starts_at)::timestamp, sqlc.narg(ends_at)::timestamp, sqlc.narg(collector_id)::int)
+RETURNING id, vehicle_id, route_id, driver_id, starts_at, ends_at, collector_id, started_at, ended_at;
+
+-- name: DeleteVehicleAssignment :execrows
+DELETE FROM vehicle_assignments
+WHERE id = sqlc.arg(id)::int AND vehicle_id = sqlc.arg(vehicle_id)::int;
+
+-- name: GetActiveVehicleAssignment :one
+SELECT id, vehicle_id, route_id, driver_id, starts_at, ends_at, collector_id, started_at, ended_at
+FROM vehicle_assignments
+WHERE vehicle_id = sqlc.arg(vehicle_id)::int
+  AND starts_at <= sqlc.arg(at)::timestamp
+  AND (ends_at IS NULL OR ends_at > sqlc.arg(at)::timestamp);
+
+-- name: StartDriverShift :one
+-- Starts the planned shift of the driver in effect at at, unless the driver
+-- already has a shift in progress.
+UPDATE vehicle_assignments
+SET started_at = sqlc.arg(at)::timestamp
+WHERE driver_id = sqlc.arg(driver_id)::int
+  AND starts_at <= sqlc.arg(at)::timestamp
+  AND (ends_at IS NULL OR ends_at > sqlc.arg(at)::timestamp)
+  AND started_at IS NULL
+  AND NOT EXISTS (
+    SELECT 1 FROM vehicle_assignments cur
+    WHERE cur.driver_id = sqlc.arg(driver_id)::int
+      AND cur.started_at IS NOT NULL
+      AND cur.ended_at IS NULL
+  )
+RETURNING id, vehicle_id, route_id, driver_id, starts_at, ends_at, collector_id, started_at, ended_at;
+
+-- name: EndDriverShift :one
+UPDATE vehicle_assignments
+SET ended_at = GREATEST(started_at, sqlc.arg(at)::timestamp)
+WHERE driver_id = sqlc.arg(driver_id)::int
+  AND started_at IS NOT NULL
+  AND ended_at IS NULL
+RETURNING id, vehicle_id, route_id, driver_id, starts_at, ends_at, collector_id, started_at, ended_at;
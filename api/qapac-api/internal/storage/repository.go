@@ -1,6 +1,22 @@
 package storage
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrConflict is returned when a write violates a uniqueness or
+	// exclusion constraint (duplicate plate, overlapping assignment).
+	ErrConflict = errors.New("storage: conflict")
+	// ErrInvalidReference is returned when a write references a row that does
+	// not exist (unknown vehicle or route).
+	ErrInvalidReference = errors.New("storage: invalid reference")
+	// ErrChangeLogGap is returned when the network change log does not
+	// itemize every change after the requested version.
+	ErrChangeLogGap = errors.New("storage: change log gap")
+)
 
 // Stop represents a public transport stop with its geographic location.
 type Stop struct {
@@ -10,6 +26,40 @@ type Stop struct {
 	Lon  float64
 }
 
+// NearbyStop is a stop found by FindStopsNear.
+type NearbyStop struct {
+	Stop
+	// DistanceM is the geodesic distance in metres from the search point.
+	DistanceM float64
+}
+
+// BBox is a WGS-84 bounding box.
+type BBox struct {
+	MinLon, MinLat, MaxLon, MaxLat float64
+}
+
+// StopSearch is a fuzzy stop name query.
+type StopSearch struct {
+	Query string
+	// Near biases the ranking towards stops close to (Lat, Lon).
+	Near     bool
+	Lat, Lon float64
+	Limit    int
+}
+
+// StopMatch is a stop found by SearchStops.
+type StopMatch struct {
+	Stop
+	// Score is the ranking score; higher is better.
+	Score float64
+}
+
+// StopRoute identifies a route that serves a stop.
+type StopRoute struct {
+	ID   int32
+	Name string
+}
+
 // RouteShape represents the path geometry of a route.
 type RouteShape struct {
 	ID      int32
@@ -22,11 +72,25 @@ type RouteShape struct {
 type StopsRepository interface {
 	// FindStopsNear returns all active stops within radiusMeters of (lat, lon),
 	// ordered by distance ascending.
-	FindStopsNear(ctx context.Context, lat, lon, radiusMeters float64) ([]Stop, error)
+	FindStopsNear(ctx context.Context, lat, lon, radiusMeters float64) ([]NearbyStop, error)
 
 	// GetStop returns a single active stop by ID.
 	// Returns (nil, nil) when the stop does not exist.
 	GetStop(ctx context.Context, id int32) (*Stop, error)
+
+	// ListRoutesServingStops returns the active routes serving each stop in
+	// stopIDs, ordered by route ID. Stops served by no route are absent.
+	ListRoutesServingStops(ctx context.Context, stopIDs []int32) (map[int32][]StopRoute, error)
+
+	// ListStopsInBBox returns up to limit active stops inside bbox with an ID
+	// greater than afterID, ordered by ID. When gridDeg > 0 the box is split
+	// into cells of gridDeg degrees and only the lowest-ID stop of each cell
+	// is returned.
+	ListStopsInBBox(ctx context.Context, bbox BBox, gridDeg float64, afterID int32, limit int) ([]Stop, error)
+
+	// SearchStops returns the active stops whose name resembles the query,
+	// ignoring case and accents, best match first.
+	SearchStops(ctx context.Context, q StopSearch) ([]StopMatch, error)
 }
 
 // RoutesRepository defines read operations on route geometry.
@@ -34,4 +98,454 @@ type RoutesRepository interface {
 	// GetRouteShape returns the shape of the route identified by routeID.
 	// Returns (nil, nil) when the route has no shape recorded.
 	GetRouteShape(ctx context.Context, routeID int32) (*RouteShape, error)
+	// DistanceToRouteShape returns the distance in metres from (lat, lon) to
+	// the shape of the route identified by routeID.
+	// Returns (0, false, nil) when the route has no shape recorded.
+	DistanceToRouteShape(ctx context.Context, routeID int32, lat, lon float64) (meters float64, found bool, err error)
+}
+
+// StopArrival records a vehicle arriving at a stop of its route.
+type StopArrival struct {
+	RouteID   int32
+	StopID    int32
+	VehicleID int32
+	ArrivedAt time.Time
+}
+
+// HeadwaysRepository defines access to stop arrival events and the scheduled
+// headway of each route.
+type HeadwaysRepository interface {
+	// RecordStopArrival stores a single arrival event. The vehicle position
+	// ingestion records one per visit of a vehicle to a stop of its route.
+	RecordStopArrival(ctx context.Context, a StopArrival) error
+	// FindRouteStopNear returns the stop of routeID closest to (lat, lon)
+	// within radiusMeters. Returns (0, false, nil) when there is none.
+	FindRouteStopNear(ctx context.Context, routeID int32, lat, lon, radiusMeters float64) (stopID int32, found bool, err error)
+	// ListStopArrivals returns the arrivals of routeID in [from, to), ordered
+	// by stop ID and then by arrival time.
+	ListStopArrivals(ctx context.Context, routeID int32, from, to time.Time) ([]StopArrival, error)
+	// ListApproachingVehicles returns the vehicle expected next at each stop
+	// in stopIDs: among the vehicles whose latest arrival since since was at
+	// an earlier stop of a route serving the stop, the one the fewest stops
+	// away. Stops without one are absent.
+	ListApproachingVehicles(ctx context.Context, stopIDs []int32, since time.Time) (map[int32]int32, error)
+	// GetScheduledHeadway returns the planned seconds between buses of routeID.
+	// Returns (0, false, nil) when the route does not exist or has no
+	// scheduled headway.
+	GetScheduledHeadway(ctx context.Context, routeID int32) (seconds int, found bool, err error)
+}
+
+// Accessibility features a vehicle can advertise.
+const (
+	FeatureWheelchairRamp     = "wheelchair_ramp"
+	FeatureLowFloor           = "low_floor"
+	FeaturePrioritySeating    = "priority_seating"
+	FeatureAudioAnnouncements = "audio_announcements"
+)
+
+// Vehicle is a bus registered in the fleet.
+type Vehicle struct {
+	ID                    int32
+	Plate                 string
+	Operator              string
+	Capacity              int
+	AccessibilityFeatures []string
+	Active                bool
+	CreatedAt             time.Time
+}
+
+// VehicleAssignment assigns a vehicle to a route, and optionally a driver
+// and a collector, for the half-open interval [StartsAt, EndsAt). It is also
+// the shift of that crew: StartedAt and EndedAt record when the driver
+// actually started and ended it.
+type VehicleAssignment struct {
+	ID          int32
+	VehicleID   int32
+	RouteID     int32
+	DriverID    *int32 // nil when no driver is assigned
+	CollectorID *int32 // nil when the vehicle runs without a collector
+	StartsAt    time.Time
+	EndsAt      *time.Time // nil when open-ended
+	StartedAt   *time.Time // nil until the driver starts the shift
+	EndedAt     *time.Time // nil until the driver ends the shift
+}
+
+// InProgress reports whether the shift had been started, and not yet ended,
+// at at.
+func (a VehicleAssignment) InProgress(at time.Time) bool {
+	return a.StartedAt != nil && !a.StartedAt.After(at) && (a.EndedAt == nil || a.EndedAt.After(at))
+}
+
+// VehiclesRepository defines access to the fleet registry.
+//
+// Writes return ErrConflict when a plate is already registered or an
+// assignment overlaps another one of the same vehicle, driver or collector,
+// and
+// ErrInvalidReference when the referenced vehicle or route does not exist.
+type VehiclesRepository interface {
+	// ListVehicles returns the registered vehicles ordered by ID.
+	ListVehicles(ctx context.Context, onlyActive bool) ([]Vehicle, error)
+	// GetVehicle returns a single vehicle by ID.
+	// Returns (nil, nil) when the vehicle does not exist.
+	GetVehicle(ctx context.Context, id int32) (*Vehicle, error)
+	// CreateVehicle registers v and returns it with ID and CreatedAt set.
+	CreateVehicle(ctx context.Context, v Vehicle) (*Vehicle, error)
+	// UpdateVehicle overwrites the vehicle identified by v.ID.
+	// Returns (nil, nil) when the vehicle does not exist.
+	UpdateVehicle(ctx context.Context, v Vehicle) (*Vehicle, error)
+	// DeactivateVehicle marks a vehicle as out of service. Vehicles are never
+	// deleted because incidents and arrivals reference them.
+	// Returns false when the vehicle does not exist.
+	DeactivateVehicle(ctx context.Context, id int32) (bool, error)
+
+	// ListAssignments returns the assignments of vehicleID, most recent first.
+	ListAssignments(ctx context.Context, vehicleID int32) ([]VehicleAssignment, error)
+	// CreateAssignment stores a and returns it with ID set.
+	CreateAssignment(ctx context.Context, a VehicleAssignment) (*VehicleAssignment, error)
+	// DeleteAssignment removes an assignment of vehicleID.
+	// Returns false when no such assignment exists.
+	DeleteAssignment(ctx context.Context, vehicleID, assignmentID int32) (bool, error)
+	// GetActiveAssignment returns the assignment of vehicleID in effect at at.
+	// Returns (nil, nil) when the vehicle is unassigned at that time.
+	GetActiveAssignment(ctx context.Context, vehicleID int32, at time.Time) (*VehicleAssignment, error)
+
+	// StartShift marks as started at at the assignment of driverID in effect
+	// at that time, and returns it. Returns (nil, nil) when the driver has no
+	// such assignment, it was already started, or the driver has another
+	// shift in progress.
+	StartShift(ctx context.Context, driverID int32, at time.Time) (*VehicleAssignment, error)
+	// EndShift marks as ended at at the shift in progress of driverID, and
+	// returns it. Returns (nil, nil) when the driver has no shift in progress.
+	EndShift(ctx context.Context, driverID int32, at time.Time) (*VehicleAssignment, error)
+}
+
+// RiderCategory is a class of rider with its own prices (e.g. students).
+type RiderCategory struct {
+	ID        string
+	Name      string
+	IsDefault bool
+}
+
+// FareProduct is the price of a product for one rider category.
+type FareProduct struct {
+	ID              string
+	RiderCategoryID string
+	Name            string
+	AmountCents     int
+	Currency        string
+}
+
+// FareLegRule selects the fare product of a single-route leg. Empty strings
+// and nil bounds match any leg.
+type FareLegRule struct {
+	ID            int32
+	LegGroupID    string
+	NetworkID     string
+	FromAreaID    string
+	ToAreaID      string
+	MinDistanceM  *int // inclusive
+	MaxDistanceM  *int // exclusive
+	FareProductID string
+	Priority      int
+}
+
+// FareTransferRule prices a transfer between two consecutive legs, following
+// the GTFS-Fares v2 fare_transfer_type semantics. Empty leg groups match any
+// group; an empty FareProductID is a free transfer.
+type FareTransferRule struct {
+	ID             int32
+	FromLegGroupID string
+	ToLegGroupID   string
+	TransferType   int
+	FareProductID  string
+}
+
+// FareTables holds all the static fare data. The tables are small, so the
+// fare calculator loads them whole for each quote.
+type FareTables struct {
+	RiderCategories []RiderCategory
+	Products        []FareProduct
+	LegRules        []FareLegRule
+	TransferRules   []FareTransferRule
+}
+
+// RideLeg describes a ride on one route between two of its stops.
+type RideLeg struct {
+	RouteID      int32
+	FromStopID   int32
+	ToStopID     int32
+	NetworkID    string // empty when the route has no fare network
+	FromSequence int
+	ToSequence   int
+	// DistanceM is measured along the route shape, or in a straight line when
+	// the route has no shape.
+	DistanceM float64
+	FromAreas []string
+	ToAreas   []string
+}
+
+// FaresRepository defines read access to the fare model.
+type FaresRepository interface {
+	// GetFareTables returns the rider categories, products and rules.
+	GetFareTables(ctx context.Context) (*FareTables, error)
+	// GetRideLeg returns the fare-relevant facts of riding routeID from
+	// fromStopID to toStopID. Returns (nil, nil) when the route is unknown or
+	// inactive, or either stop is not an active stop of the route.
+	GetRideLeg(ctx context.Context, routeID, fromStopID, toStopID int32) (*RideLeg, error)
+}
+
+// Occupancy report sources.
+const (
+	OccupancySourceDriver    = "driver"
+	OccupancySourceCollector = "collector"
+	OccupancySourceRider     = "rider"
+)
+
+// OccupancyReport is a single crowding observation of a vehicle. Status holds
+// a GTFS-Realtime OccupancyStatus value.
+type OccupancyReport struct {
+	VehicleID  int32
+	Status     int
+	Source     string
+	ReportedAt time.Time
+}
+
+// OccupancyRepository defines access to vehicle crowding reports.
+type OccupancyRepository interface {
+	// RecordOccupancyReport stores a single report.
+	// Returns ErrInvalidReference when the vehicle does not exist.
+	RecordOccupancyReport(ctx context.Context, r OccupancyReport) error
+	// ListOccupancyReportsSince returns the reports of vehicleIDs made at or
+	// after since, ordered by vehicle and then by time.
+	ListOccupancyReportsSince(ctx context.Context, vehicleIDs []int32, since time.Time) ([]OccupancyReport, error)
+}
+
+// Rider trip sources.
+const (
+	TripSourceManual  = "manual"  // entered by the rider after the ride
+	TripSourceCheckin = "checkin" // opened by a boarding check-in
+)
+
+// RiderTrip is a ride in the history of a rider's device. A check-in is open
+// while AlightedAt is nil; a closed trip without an AlightingStopID was
+// abandoned.
+type RiderTrip struct {
+	ID              int32
+	DeviceID        string
+	RouteID         int32
+	VehicleID       *int32 // nil when the app does not know it
+	BoardingStopID  int32
+	AlightingStopID *int32
+	BoardedAt       time.Time
+	AlightedAt      *time.Time
+	FareCents       *int // nil when no fare applies or the trip was abandoned
+	Source          string
+	CreatedAt       time.Time
+}
+
+// TripCursor is the position of a trip in the history of a device, which is
+// ordered by (BoardedAt, ID) descending.
+type TripCursor struct {
+	BoardedAt time.Time
+	ID        int32
+}
+
+// MonthlyTrips sums the trips of a device boarded in a calendar month.
+type MonthlyTrips struct {
+	Month      time.Time // first instant of the month, local time
+	Trips      int
+	TotalCents int // trips without a fare count as zero
+}
+
+// TripsRepository defines access to the trip history of rider devices.
+// Every method is scoped to a device: a trip of another device is not found.
+type TripsRepository interface {
+	// CreateTrip stores the closed trip t and returns it with ID and
+	// CreatedAt set.
+	// Returns ErrInvalidReference when the route, vehicle or a stop does not
+	// exist.
+	CreateTrip(ctx context.Context, t RiderTrip) (*RiderTrip, error)
+	// OpenTrip stores the open trip t like CreateTrip. In the same
+	// transaction, the trip the device still has open, if any, is closed as
+	// abandoned at the earlier of t.BoardedAt and its boarding time plus
+	// expiry. Returns ErrConflict when a concurrent OpenTrip of the device
+	// won.
+	OpenTrip(ctx context.Context, t RiderTrip, expiry time.Duration) (*RiderTrip, error)
+	// GetTrip returns a trip of deviceID.
+	// Returns (nil, nil) when it does not exist.
+	GetTrip(ctx context.Context, deviceID string, id int32) (*RiderTrip, error)
+	// CloseTrip closes an open trip of deviceID at at, with the given
+	// alighting stop and fare (both nil when the trip was abandoned).
+	// Returns (nil, nil) when no such open trip exists.
+	CloseTrip(ctx context.Context, deviceID string, id int32, alightingStopID *int32, at time.Time, fareCents *int) (*RiderTrip, error)
+	// ListTrips returns up to limit trips of deviceID, most recent first,
+	// starting after before (nil for the most recent trip).
+	ListTrips(ctx context.Context, deviceID string, before *TripCursor, limit int) ([]RiderTrip, error)
+	// SummarizeTrips returns the trips and spending of deviceID per month,
+	// for the months with trips boarded at or after since, oldest first.
+	SummarizeTrips(ctx context.Context, deviceID string, since time.Time) ([]MonthlyTrips, error)
+}
+
+// Rating tags: what a rider can flag about a ride.
+const (
+	RatingTagDriving      = "driving"
+	RatingTagCleanliness  = "cleanliness"
+	RatingTagCourtesy     = "courtesy"
+	RatingTagOvercharging = "overcharging"
+)
+
+// Rating statuses. Hidden ratings are kept for moderators but left out of
+// every aggregate.
+const (
+	RatingVisible = "visible"
+	RatingHidden  = "hidden"
+)
+
+// Rating subjects: what a RatingAggregate aggregates.
+const (
+	RatingSubjectDriver    = "driver"
+	RatingSubjectCollector = "collector"
+	RatingSubjectRoute     = "route"
+)
+
+// Rating is a rider's score of a completed trip. The route and vehicle are
+// copied from the trip, and the crew from the shift the vehicle was on when
+// the trip was boarded.
+type Rating struct {
+	ID           int32
+	TripID       int32
+	RouteID      int32
+	VehicleID    *int32 // nil when the trip has no vehicle
+	AssignmentID *int32 // nil when no shift was in progress; also after the assignment is deleted
+	DriverID     *int32
+	CollectorID  *int32
+	Stars        int // 1 to 5
+	Comment      string
+	Tags         []string
+	Status       string
+	CreatedAt    time.Time
+}
+
+// RatingAggregate sums the visible ratings of a driver, collector or route.
+type RatingAggregate struct {
+	Ratings      int
+	AverageStars float64        // 0 when there are no ratings
+	Tags         map[string]int // ratings carrying each tag
+}
+
+// RatingsRepository defines access to trip ratings.
+type RatingsRepository interface {
+	// CreateRating stores r and returns it with ID, Status and CreatedAt set.
+	// Returns ErrConflict when the trip is already rated, and
+	// ErrInvalidReference when the trip, route or vehicle does not exist.
+	CreateRating(ctx context.Context, r Rating) (*Rating, error)
+	// ListRatings returns up to limit ratings with the given status (empty
+	// for every status), most recent first, with an ID below beforeID (0 for
+	// the most recent rating).
+	ListRatings(ctx context.Context, status string, beforeID int32, limit int) ([]Rating, error)
+	// SetRatingStatus changes the status of a rating and returns it.
+	// Returns (nil, nil) when the rating does not exist.
+	SetRatingStatus(ctx context.Context, id int32, status string) (*Rating, error)
+	// GetRatingAggregate aggregates the visible ratings of the driver,
+	// collector or route (see the RatingSubject constants) with the given ID.
+	GetRatingAggregate(ctx context.Context, subject string, id int32) (*RatingAggregate, error)
+}
+
+// FavoriteRoute is a route a rider device marked as favorite.
+type FavoriteRoute struct {
+	ID   int32
+	Name string
+}
+
+// SavedPlace is a named place, such as home or work, saved by a rider device.
+type SavedPlace struct {
+	ID        int32
+	DeviceID  string
+	Name      string
+	Lat       float64
+	Lon       float64
+	CreatedAt time.Time
+}
+
+// FavoritesRepository defines access to the favorite stops and routes and the
+// saved places of rider devices. Every method is scoped to a device.
+type FavoritesRepository interface {
+	// ListFavoriteStops returns the active favorite stops of deviceID in the
+	// order they were added.
+	ListFavoriteStops(ctx context.Context, deviceID string) ([]Stop, error)
+	// AddFavoriteStop marks stopID as a favorite of deviceID; marking it again
+	// is not an error. Returns false when the stop does not exist or is
+	// inactive.
+	AddFavoriteStop(ctx context.Context, deviceID string, stopID int32) (bool, error)
+	// RemoveFavoriteStop returns false when stopID was not a favorite.
+	RemoveFavoriteStop(ctx context.Context, deviceID string, stopID int32) (bool, error)
+
+	// ListFavoriteRoutes, AddFavoriteRoute and RemoveFavoriteRoute are the
+	// route counterparts of the stop methods.
+	ListFavoriteRoutes(ctx context.Context, deviceID string) ([]FavoriteRoute, error)
+	AddFavoriteRoute(ctx context.Context, deviceID string, routeID int32) (bool, error)
+	RemoveFavoriteRoute(ctx context.Context, deviceID string, routeID int32) (bool, error)
+
+	// ListSavedPlaces returns the saved places of deviceID in the order they
+	// were created.
+	ListSavedPlaces(ctx context.Context, deviceID string) ([]SavedPlace, error)
+	// CreateSavedPlace stores p and returns it with ID and CreatedAt set.
+	// Returns ErrConflict when the device already has a place with that name.
+	CreateSavedPlace(ctx context.Context, p SavedPlace) (*SavedPlace, error)
+	// UpdateSavedPlace replaces the name and location of place p.ID of
+	// p.DeviceID. Returns (nil, nil) when the device has no such place, and
+	// ErrConflict when the new name is taken.
+	UpdateSavedPlace(ctx context.Context, p SavedPlace) (*SavedPlace, error)
+	// DeleteSavedPlace returns false when the device has no such place.
+	DeleteSavedPlace(ctx context.Context, deviceID string, id int32) (bool, error)
+}
+
+// TilesRepository renders the transit network as Mapbox Vector Tiles.
+type TilesRepository interface {
+	// GetNetworkVersion returns a counter that increases with every edit of
+	// stops, routes, route_stops or route_shapes.
+	GetNetworkVersion(ctx context.Context) (int64, error)
+	// GetTile returns tile z/x/y with a "routes" layer and, when withStops is
+	// set, a "stops" layer. A tile with no features is empty (len 0).
+	GetTile(ctx context.Context, z, x, y int, withStops bool) ([]byte, error)
+}
+
+// NetworkRoute is an active route as shipped to offline clients.
+type NetworkRoute struct {
+	ID   int32
+	Name string
+	// HeadwayS is the scheduled seconds between buses; nil when the route
+	// publishes no frequency.
+	HeadwayS *int
+	// StopIDs lists the active stops of the route in sequence order.
+	StopIDs []int32
+	// Shape is the route geometry as an encoded polyline (precision 5);
+	// empty when the route has no shape.
+	Shape string
+}
+
+// NetworkSnapshot is the network at one version: every active stop and route,
+// or, for a diff, the ones changed since an earlier version.
+type NetworkSnapshot struct {
+	Version int64
+	Stops   []Stop
+	Routes  []NetworkRoute
+	// RemovedStopIDs and RemovedRouteIDs are only set in diffs: stops and
+	// routes changed since the earlier version that are now deleted or
+	// inactive.
+	RemovedStopIDs  []int32
+	RemovedRouteIDs []int32
+}
+
+// NetworkRepository reads the whole network at a consistent version.
+type NetworkRepository interface {
+	// GetNetworkVersion returns the current network version.
+	GetNetworkVersion(ctx context.Context) (int64, error)
+	// GetNetworkSnapshot returns every active stop and route.
+	GetNetworkSnapshot(ctx context.Context) (*NetworkSnapshot, error)
+	// GetNetworkChangesSince returns the stops and routes changed after
+	// version since. A route also counts as changed when one of its stops
+	// did. The returned Version is lower than since when since is in the
+	// future. Returns ErrChangeLogGap when the changes cannot be itemized.
+	GetNetworkChangesSince(ctx context.Context, since int64) (*NetworkSnapshot, error)
 }